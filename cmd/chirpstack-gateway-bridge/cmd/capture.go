@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/capture"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+var captureDumpCmd = &cobra.Command{
+	Use:           "capture-dump",
+	Short:         "Print the captured frames",
+	Long:          "Print the frames captured in the configured capture path (oldest first) as JSON lines.",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if config.C.Capture.Path == "" {
+			return errors.New("frame capture is not configured")
+		}
+
+		return capture.DumpPath(config.C.Capture.Path, config.C.Capture.MaxFiles, os.Stdout)
+	},
+}
@@ -14,17 +14,96 @@ const configTemplate = `[general]
 # debug=5, info=4, warning=3, error=2, fatal=1, panic=0
 log_level={{ .General.LogLevel }}
 
+# Log format.
+#
+# Valid options are:
+# * text: human readable text output
+# * json: one JSON object per log entry (e.g. for log aggregation)
+log_format="{{ .General.LogFormat }}"
+
 # Log to syslog.
 #
 # When set to true, log messages are being written to syslog.
 log_to_syslog={{ .General.LogToSyslog }}
 
+# Log to journald.
+#
+# When set to true, log messages are being written to journald using the
+# native journal protocol. The log fields (e.g. gateway_id) are stored as
+# journal fields (e.g. GATEWAY_ID).
+log_to_journald={{ .General.LogToJournald }}
+
+# Plugins.
+#
+# Go plugins (.so files) to load on startup. Each plugin must expose a
+# Register(hooks.Registry) function, which can be used to register uplink,
+# stats and downlink hooks. These hooks are invoked in registration order
+# and can modify or drop events (by returning hooks.ErrDrop). Dropped
+# downlinks are acknowledged with the DROPPED_BY_HOOK error.
+#
+# Example:
+# plugins=[
+#   "/opt/chirpstack-gateway-bridge/hooks.so",
+# ]
+plugins=[{{ range $index, $elm := .General.Plugins }}
+  "{{ $elm }}",{{ end }}
+]
+
+  # Per-module log levels.
+  #
+  # These override the log_level for the log messages of the given module.
+  # Valid modules are: backend, integration, metadata, forwarder, commands,
+  # filters, metrics, health, webui and capture.
+  #
+  # Example:
+  # backend=5
+  # integration=2
+  [general.log_levels]
+{{ range $module, $level := .General.LogLevels }}  {{ $module }}={{ $level }}
+{{ end }}
+
+# Hooks.
+[hooks]
+
+  # Uplink script hook.
+  #
+  # When a path is set, the script is started on startup and each uplink is
+  # passed to the script before it is forwarded, such that the script can
+  # inspect, modify (e.g. add tags to the context or adjust the RSSI for the
+  # antenna gain) or drop the uplink. The uplink is written to the stdin of
+  # the script as a single line of JSON. The script must reply with a single
+  # line on stdout, containing the (modified) uplink as JSON, or an empty line
+  # to drop the uplink. Scripts can be written in any language, e.g. Lua using
+  # the /usr/bin/env lua shebang, or by setting the interpreter as path and
+  # the script as argument.
+  [hooks.uplink_script]
+
+  # Path of the script (or interpreter).
+  path="{{ .Hooks.UplinkScript.Path }}"
+
+  # Arguments passed to the script.
+  args=[{{ range $index, $elm := .Hooks.UplinkScript.Args }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+  # Timeout.
+  #
+  # The max. duration to wait for the reply of the script. On timeout, the
+  # script is killed and restarted on the next uplink.
+  timeout="{{ .Hooks.UplinkScript.Timeout }}"
+
+  # Drop on error.
+  #
+  # When set to true, the uplink is dropped when the script failed (e.g. on
+  # timeout or an invalid reply). When set to false, the uplink is forwarded
+  # unmodified.
+  drop_on_error={{ .Hooks.UplinkScript.DropOnError }}
+
 
 # Filters.
 #
 # These can be used to filter LoRaWAN frames to reduce bandwith usage between
-# the gateway and ChirpStack Gateway Bride. Depending the used backend, filtering
-# will be performed by the Packet Forwarder or ChirpStack Gateway Bridge.
+# the gateway and ChirpStack Gateway Bride. The filters are applied by the
+# ChirpStack Gateway Bridge to the uplinks of all backends. When using the
+# Basic Station backend, the filtering is also performed by the Basic Station.
 [filters]
 
 # NetIDs filters.
@@ -55,6 +134,46 @@ join_euis=[{{ range $index, $elm := .Filters.JoinEUIs }}
   ["{{ index $elm 0 }}", "{{ index $elm 1 }}"],{{ end }}
 ]
 
+# Min. RSSI (dBm).
+#
+# Uplink frames received with a lower RSSI are dropped. These are usually
+# noise or frames of distant networks. Set to 0 to disable this filter.
+min_rssi={{ .Filters.MinRSSI }}
+
+# Min. SNR (dB).
+#
+# LoRa uplink frames received with a lower SNR are dropped. Set to 0 to
+# disable this filter.
+min_snr={{ .Filters.MinSNR }}
+
+  # Gateway location sanity filter.
+  #
+  # Mobile gateways (and gateways with a poor GPS reception) commonly report
+  # bad GPS fixes, resulting in locations that jump an implausible distance.
+  # When a max. speed is configured, the location of the gateway stats is
+  # compared with the last accepted location of the gateway, and the location
+  # is rejected when the gateway would have moved faster than the max. speed.
+  [filters.location]
+
+  # Max. speed (km/h).
+  #
+  # Set to 0 to disable this filter.
+  max_speed={{ .Filters.Location.MaxSpeed }}
+
+  # Tolerance (meters).
+  #
+  # Location updates within this distance of the last accepted location are
+  # always accepted, to allow for the GPS inaccuracy.
+  tolerance={{ .Filters.Location.Tolerance }}
+
+  # Action.
+  #
+  # The action to perform on implausible location updates:
+  #   * drop: remove the location from the gateway stats
+  #   * flag: keep the location, but set the location_implausible meta-data
+  #           key of the gateway stats to "true"
+  action="{{ .Filters.Location.Action }}"
+
 
 # Gateway backend configuration.
 [backend]
@@ -65,6 +184,8 @@ join_euis=[{{ range $index, $elm := .Filters.JoinEUIs }}
 #   * semtech_udp
 #   * concentratord
 #   * basic_station
+#   * multitech
+#   * simulator
 type="{{ .Backend.Type }}"
 
 
@@ -79,6 +200,16 @@ type="{{ .Backend.Type }}"
   # packet-forwarder matches this port.
   udp_bind = "{{ .Backend.SemtechUDP.UDPBind }}"
 
+  # ip:port list to bind the UDP listeners to
+  #
+  # When set, this overrides the udp_bind setting and a listener is started
+  # for each ip:port. This makes it possible to listen on both IPv6 and IPv4,
+  # e.g. ["[::]:1700", "0.0.0.0:1700"]. Note that when only udp_bind is set
+  # to [::]:1700, the listener accepts both IPv6 and IPv4 (dual-stack).
+  # Downlink frames are sent using the listener on which the gateway was
+  # received.
+  udp_binds = [{{ range $index, $elm := .Backend.SemtechUDP.UDPBinds }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
   # Skip the CRC status-check of received packets
   #
   # This is only has effect when the packet-forwarder is configured to forward
@@ -91,6 +222,79 @@ type="{{ .Backend.Type }}"
   # the time would otherwise be unset.
   fake_rx_time={{ .Backend.SemtechUDP.FakeRxTime }}
 
+  # Per-frequency RX counters.
+  #
+  # When enabled, the uplinks received since the previous stats are counted
+  # per frequency and per spreading factor. These counters are added to the
+  # gateway stats meta-data, e.g. rx_count_868100000="42" and
+  # rx_count_sf7="12".
+  rx_counters={{ .Backend.SemtechUDP.RXCounters }}
+
+  # Max. datagram size.
+  #
+  # UDP packets exceeding this size (in bytes) are rejected. The max. (and
+  # default) value is 65507.
+  max_datagram_size={{ .Backend.SemtechUDP.MaxDatagramSize }}
+
+  # Listeners.
+  #
+  # When set, this overrides the udp_bind and udp_binds settings. Each
+  # listener has its own skip_crc_check and fake_rx_time settings, such that
+  # a mixed fleet of packet-forwarders can be served using different ports.
+  # Downlink frames are sent using the listener on which the gateway was
+  # received.
+  #
+  # Example:
+  # [[backend.semtech_udp.listeners]]
+  # bind="0.0.0.0:1700"
+  # skip_crc_check=false
+  # fake_rx_time=false
+  #
+  # [[backend.semtech_udp.listeners]]
+  # bind="0.0.0.0:1701"
+  # skip_crc_check=false
+  # fake_rx_time=true
+  #
+  # DTLS.
+  #
+  # When enabled, the listener only accepts DTLS 1.2 encrypted packets. This
+  # is intended for packet-forwarders connecting over the internet to a
+  # ChirpStack Gateway Bridge which is not running on the gateway. Both the
+  # PSK (psks) and the certificate based (tls_cert, tls_key) cipher suites
+  # are supported. When ca_cert is set, gateways using a certificate based
+  # cipher suite must present a client certificate signed by this CA.
+  #
+  # Example:
+  # [[backend.semtech_udp.listeners]]
+  # bind="0.0.0.0:1702"
+  #
+  #   [backend.semtech_udp.listeners.dtls]
+  #   enabled=true
+  #   tls_cert="/etc/chirpstack-gateway-bridge/dtls/server.pem"
+  #   tls_key="/etc/chirpstack-gateway-bridge/dtls/server-key.pem"
+  #   ca_cert="/etc/chirpstack-gateway-bridge/dtls/ca.pem"
+  #
+  #   # PSK identity and key (HEX encoded).
+  #   [[backend.semtech_udp.listeners.dtls.psks]]
+  #   identity="0102030405060708"
+  #   key="000102030405060708090a0b0c0d0e0f"
+{{ range $i, $l := .Backend.SemtechUDP.Listeners }}
+    [[backend.semtech_udp.listeners]]
+    bind="{{ $l.Bind }}"
+    skip_crc_check={{ $l.SkipCRCCheck }}
+    fake_rx_time={{ $l.FakeRxTime }}
+{{ if $l.DTLS.Enabled }}
+      [backend.semtech_udp.listeners.dtls]
+      enabled={{ $l.DTLS.Enabled }}
+      tls_cert="{{ $l.DTLS.TLSCert }}"
+      tls_key="{{ $l.DTLS.TLSKey }}"
+      ca_cert="{{ $l.DTLS.CACert }}"
+{{ range $j, $psk := $l.DTLS.PSKs }}
+      [[backend.semtech_udp.listeners.dtls.psks]]
+      identity="{{ $psk.Identity }}"
+      key="{{ $psk.Key }}"
+{{ end }}{{ end }}{{ end }}
+
 {{ range $i, $config := .Backend.SemtechUDP.Configuration }}
     [[backend.semtech_udp.configuration]]
     gateway_id="{{ $config.GatewayID }}"
@@ -99,6 +303,36 @@ type="{{ .Backend.Type }}"
     restart_command="{{ $config.RestartCommand }}"
 {{ end }}
 
+  # Allow-list.
+  #
+  # When set, only the packets received from the allowed source IPs and / or
+  # gateways are accepted. Other packets are dropped and counted as rejected
+  # (source_ip_not_allowed and gateway_not_allowed).
+  [backend.semtech_udp.allow_list]
+
+  # Source IPs.
+  #
+  # List of IP addresses and / or CIDR ranges from which packets are
+  # accepted. When empty, packets from all source IPs are accepted.
+  # Example: ["192.168.1.0/24", "10.0.0.1"]
+  source_ips=[{{ range $index, $elm := .Backend.SemtechUDP.AllowList.SourceIPs }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+  # Gateways.
+  #
+  # When set, only the packets of the configured gateways are accepted. When
+  # the source_ips of the gateway are set, the packets of the gateway must
+  # be received from one of these IP addresses / ranges.
+  #
+  # Example:
+  # [[backend.semtech_udp.allow_list.gateways]]
+  # gateway_id="0102030405060708"
+  # source_ips=["192.168.1.0/24"]
+{{ range $i, $gw := .Backend.SemtechUDP.AllowList.Gateways }}
+    [[backend.semtech_udp.allow_list.gateways]]
+    gateway_id="{{ $gw.GatewayID }}"
+    source_ips=[{{ range $index, $elm := $gw.SourceIPs }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+{{ end }}
+
   # ChirpStack Concentratord backend.
   [backend.concentratord]
 
@@ -111,6 +345,169 @@ type="{{ .Backend.Type }}"
   # Command API URL.
   command_url="{{ .Backend.Concentratord.CommandURL }}"
 
+  # Bandwidth unit.
+  #
+  # The unit used by the Concentratord for the LoRa bandwidth. Valid options are:
+  # * auto: detect the unit from the first received uplink
+  # * hz:   Hz (e.g. 125000)
+  # * khz:  kHz (e.g. 125)
+  #
+  # In auto mode, Hz is assumed until the first uplink has been received, as
+  # the unit can't be derived from the Concentratord version. Set the unit
+  # explicitly when downlinks must be sent before the first uplink.
+  bandwidth_unit="{{ .Backend.Concentratord.BandwidthUnit }}"
+
+  # Command timeout.
+  #
+  # The max. duration to wait for the reply of a command (e.g. a downlink).
+  # On timeout, an error is returned and the command socket is re-created.
+  # Set to 0 to disable the timeout.
+  command_timeout="{{ .Backend.Concentratord.CommandTimeout }}"
+
+  # Concentratord instances.
+  #
+  # When set, the ChirpStack Gateway Bridge connects to multiple Concentratord
+  # instances (e.g. one per concentrator board) and the event_url and
+  # command_url options above are ignored. Downlinks are routed to the instance
+  # reporting the gateway ID of the downlink. When multiple instances report
+  # the same gateway ID, the board field of the uplink is set to the index of
+  # the instance and the board field of the downlink is used for routing.
+  #
+  # Example:
+  # [[backend.concentratord.instances]]
+  # event_url="ipc:///tmp/concentratord_board0_event"
+  # command_url="ipc:///tmp/concentratord_board0_command"
+  #
+  # [[backend.concentratord.instances]]
+  # event_url="ipc:///tmp/concentratord_board1_event"
+  # command_url="ipc:///tmp/concentratord_board1_command"
+{{ range $i, $instance := .Backend.Concentratord.Instances }}
+    [[backend.concentratord.instances]]
+    event_url="{{ $instance.EventURL }}"
+    command_url="{{ $instance.CommandURL }}"
+{{ end }}
+
+    # Gateway mesh (relay).
+    #
+    # When enabled, mesh-encapsulated uplinks received from relay gateways are
+    # unwrapped before they are forwarded. The RSSI, SNR and channel of the
+    # uplink are replaced by the values reported by the relay gateway and the
+    # relay details are stored in the context. Downlinks for these uplinks are
+    # wrapped and sent to the relay gateway using the settings below.
+    [backend.concentratord.mesh]
+
+    # Enable gateway mesh.
+    enabled={{ .Backend.Concentratord.Mesh.Enabled }}
+
+    # Region.
+    #
+    # The region is used to resolve the channel and data-rate reported by the
+    # relay gateway.
+    region="{{ .Backend.Concentratord.Mesh.Region }}"
+
+    # Signing key (AES128, HEX encoded).
+    #
+    # This key is used to sign and validate the mesh frames and must be
+    # equal for all gateways within the mesh.
+    signing_key="{{ .Backend.Concentratord.Mesh.SigningKey }}"
+
+    # Frequencies (Hz).
+    #
+    # The frequencies used to send the mesh downlinks to the relay gateways.
+    frequencies=[{{ range $index, $elm := .Backend.Concentratord.Mesh.Frequencies }}{{ if $index }}, {{ end }}{{ $elm }}{{ end }}]
+
+    # Data-rate.
+    #
+    # The (LoRa) data-rate used to send the mesh downlinks.
+    data_rate={{ .Backend.Concentratord.Mesh.DataRate }}
+
+    # TX power (dBm).
+    #
+    # The TX power used to send the mesh downlinks.
+    tx_power={{ .Backend.Concentratord.Mesh.TXPower }}
+
+    # Uplink channels (Hz).
+    #
+    # The frequencies of the channels used by the relay gateways. When not set,
+    # the default uplink channels of the region are used.
+    uplink_channels=[{{ range $index, $elm := .Backend.Concentratord.Mesh.UplinkChannels }}{{ if $index }}, {{ end }}{{ $elm }}{{ end }}]
+
+
+  # Multitech MQTT packet-forwarder backend.
+  #
+  # This backend connects to the local MQTT broker of the Multitech Conduit,
+  # to which the MQTT packet-forwarder (lora-packet-forwarder-mqtt) publishes
+  # its events.
+  [backend.multitech]
+
+  # MQTT server (e.g. scheme://host:port where scheme is tcp, ssl or tcps).
+  server="{{ .Backend.Multitech.Server }}"
+
+  # Connect with the given username (optional).
+  username="{{ .Backend.Multitech.Username }}"
+
+  # Connect with the given password (optional).
+  password="{{ .Backend.Multitech.Password }}"
+
+  # Client ID (optional).
+  #
+  # When left blank, a random id will be generated.
+  client_id="{{ .Backend.Multitech.ClientID }}"
+
+  # Topic prefix.
+  #
+  # The packet-forwarder publishes the events to [topic_prefix]/[gateway id]/up,
+  # stat and ack and subscribes to [topic_prefix]/[gateway id]/down.
+  topic_prefix="{{ .Backend.Multitech.TopicPrefix }}"
+
+  # Quality of service level.
+  qos={{ .Backend.Multitech.QOS }}
+
+  # Skip the CRC status-check of received packets.
+  skip_crc_check={{ .Backend.Multitech.SkipCRCCheck }}
+
+  # Simulator backend.
+  #
+  # This backend does not connect to any gateway. It simulates the configured
+  # number of gateways, each generating unconfirmed data-up uplinks and stats,
+  # and it acknowledges all downlinks (without transmitting these). This can
+  # be used to load-test the MQTT broker and the ChirpStack pipeline without
+  # gateway hardware. Do not use this backend in production!
+  [backend.simulator]
+  # Number of simulated gateways.
+  gateways={{ .Backend.Simulator.Gateways }}
+
+  # Base gateway ID.
+  #
+  # The simulated gateways use consecutive gateway IDs, starting with this
+  # gateway ID.
+  base_gateway_id="{{ .Backend.Simulator.BaseGatewayID }}"
+
+  # Uplink interval (per gateway).
+  #
+  # With 100 gateways and an interval of 1s, 100 uplinks per second are
+  # generated.
+  uplink_interval="{{ .Backend.Simulator.UplinkInterval }}"
+
+  # Stats interval (per gateway).
+  stats_interval="{{ .Backend.Simulator.StatsInterval }}"
+
+  # FRMPayload size (bytes).
+  payload_size={{ .Backend.Simulator.PayloadSize }}
+
+  # Frequencies (Hz).
+  #
+  # For each uplink, a random frequency of this list is used.
+  frequencies=[{{ range $index, $elm := .Backend.Simulator.Frequencies }}{{ if $index }}, {{ end }}{{ $elm }}{{ end }}]
+
+  # Spreading-factors.
+  #
+  # For each uplink, a random spreading-factor of this list is used.
+  spreading_factors=[{{ range $index, $elm := .Backend.Simulator.SpreadingFactors }}{{ if $index }}, {{ end }}{{ $elm }}{{ end }}]
+
+  # Bandwidth (kHz).
+  bandwidth={{ .Backend.Simulator.Bandwidth }}
+
 
   # Basic Station backend.
   [backend.basic_station]
@@ -122,6 +519,10 @@ type="{{ .Backend.Type }}"
   #
   # When set, the websocket listener will use TLS to secure the connections
   # between the gateways and ChirpStack Gateway Bridge (optional).
+  #
+  # The certificate files (including the ca_cert) are reloaded when modified,
+  # such that these can be rotated without a restart. Existing connections
+  # are not affected.
   tls_cert="{{ .Backend.BasicStation.TLSCert }}"
   tls_key="{{ .Backend.BasicStation.TLSKey }}"
 
@@ -154,6 +555,196 @@ type="{{ .Backend.Type }}"
   # Maximum frequency (Hz).
   frequency_max={{ .Backend.BasicStation.FrequencyMax }}
 
+  # Downlink ID (diid) store.
+  #
+  # The Basic Station identifies a downlink by its diid. The mapping of the
+  # diid to the downlink ID is used to correlate the dntxed messages with the
+  # downlink, duplicate dntxed messages are ignored.
+  [backend.basic_station.diid_store]
+
+  # File.
+  #
+  # When set, the mapping is persisted to this file, such that the dntxed
+  # messages received after a restart of the ChirpStack Gateway Bridge can
+  # still be reported as TX acknowledgement of the downlink.
+  file="{{ .Backend.BasicStation.DIIDStore.File }}"
+
+  # Max. age.
+  #
+  # The mappings older than this duration are removed. When set to 0, the
+  # mappings are never removed (the diid will eventually wrap around).
+  max_age="{{ .Backend.BasicStation.DIIDStore.MaxAge }}"
+
+  # Per-gateway authorization.
+  #
+  # When a file or HTTP authorizer is configured, only the authorized
+  # gateways are accepted by the router-info and gateway endpoints. The
+  # gateway is identified by its router EUI, which must match the client
+  # certificate CommonName when the ca_cert is configured. The token is the
+  # value of the Authorization header sent by the gateway (without the
+  # "Bearer " prefix), see the tc_credentials / cups_credentials token.
+  [backend.basic_station.authorization]
+
+  # Allow-list file.
+  #
+  # JSON file containing an array of the authorized gateways, e.g.:
+  # [{"eui": "0102030405060708", "token": "secret"}, {"eui": "0102030405060709"}]
+  # When the token is set, the gateway must send this token. The file is
+  # reloaded when its modification time has changed.
+  file="{{ .Backend.BasicStation.Authorization.File }}"
+
+  # HTTP authorizer URL.
+  #
+  # For each connection, a JSON object containing the gatewayID, endpoint
+  # (router-info or gateway), commonName, token and remoteAddr is posted to
+  # this URL. The gateway is authorized when the response status code is
+  # 2xx. Only one of file and http_url can be set.
+  http_url="{{ .Backend.BasicStation.Authorization.HTTPURL }}"
+
+  # HTTP authorizer timeout.
+  http_timeout="{{ .Backend.BasicStation.Authorization.HTTPTimeout }}"
+
+  # Region parameters.
+  #
+  # These parameters are added to the router-config message sent to the
+  # gateways (also when the channel-plan is pushed by ChirpStack Network
+  # Server).
+  [backend.basic_station.region_parameters]
+
+  # Max. EIRP (dBm).
+  #
+  # When set to 0, the Basic Station region default is used.
+  max_eirp={{ .Backend.BasicStation.RegionParameters.MaxEIRP }}
+
+  # Dwell-time limit.
+  #
+  # Downlinks of which the airtime exceeds this limit are rejected with a
+  # DWELL_TIME TX acknowledgement error, before they are sent to the gateway
+  # (e.g. 400ms for AS923). When set to 0, no limit is enforced.
+  dwell_time="{{ .Backend.BasicStation.RegionParameters.DwellTime }}"
+
+  # Disable clear channel assessment (listen before talk).
+  nocca={{ .Backend.BasicStation.RegionParameters.NoCCA }}
+
+  # Disable duty-cycle checks.
+  nodc={{ .Backend.BasicStation.RegionParameters.NoDC }}
+
+  # Disable dwell-time checks.
+  #
+  # This disables the dwell-time checks of both the gateway and the
+  # ChirpStack Gateway Bridge.
+  nodwell={{ .Backend.BasicStation.RegionParameters.NoDwell }}
+
+  # Router-info (discovery) configuration.
+  #
+  # By default, the router-info endpoint returns the URI of this Websocket
+  # listener. When routes are configured, the router EUI is matched against
+  # the configured routes (longest prefix wins) and the URI of the matching
+  # route is returned. When no route matches, an error is returned to the
+  # gateway.
+  [backend.basic_station.router_info]
+
+  # Routes file.
+  #
+  # JSON file containing an array of routes (using the same eui, uri and muxs
+  # keys as below). The file is reloaded on router-info requests when its
+  # modification time has changed.
+  routes_file="{{ .Backend.BasicStation.RouterInfo.RoutesFile }}"
+
+  # Lookup URL.
+  #
+  # When set, the route of each router is looked up by posting the router
+  # EUI to this URL (e.g. to redirect gateways to a regional LNS). The
+  # looked-up route takes precedence over the routes file and the routes
+  # below, which are used as fallback when the lookup returns no route or
+  # fails.
+  lookup_url="{{ .Backend.BasicStation.RouterInfo.LookupURL }}"
+
+  # Lookup timeout.
+  lookup_timeout="{{ .Backend.BasicStation.RouterInfo.LookupTimeout }}"
+
+  # Routes.
+  #
+  # The eui must either be an exact EUI or a prefix (e.g. 0102030400000000/32).
+  # The uri is the base URI of the LNS, /gateway/<EUI> will be appended.
+  # The muxs is optional and defaults to the router EUI.
+  # Example:
+  # [[backend.basic_station.router_info.routes]]
+  # eui="0102030400000000/32"
+  # uri="wss://lns.example.com:3001"
+  # muxs="0102030405060708"
+{{ range $i, $route := .Backend.BasicStation.RouterInfo.Routes }}
+    [[backend.basic_station.router_info.routes]]
+    eui="{{ $route.EUI }}"
+    uri="{{ $route.URI }}"
+    muxs="{{ $route.Muxs }}"
+{{ end }}
+
+  # CUPS (Configuration and Update Server) configuration.
+  #
+  # When enabled, the /update-info endpoint is exposed on the Websocket
+  # listener, so that the stations can fetch the TC (LNS) URI, the
+  # credentials and firmware updates directly from the ChirpStack Gateway
+  # Bridge. Note that the station connects to this endpoint using HTTP(S),
+  # thus the cups_uri of the station must be set to http(s)://host:port.
+  [backend.basic_station.cups]
+
+  # Enable the CUPS endpoint.
+  enabled={{ .Backend.BasicStation.CUPS.Enabled }}
+
+  # CUPS URI.
+  #
+  # When set, this URI is sent to stations reporting a different CUPS URI.
+  cups_uri="{{ .Backend.BasicStation.CUPS.CUPSURI }}"
+
+  # TC (LNS) URI.
+  #
+  # When not set, the URI of this Websocket listener is used.
+  tc_uri="{{ .Backend.BasicStation.CUPS.TCURI }}"
+
+  # TC credentials.
+  #
+  # The credentials used by the station to connect to the LNS. These are
+  # sent to the station when the CRC of the credentials does not match.
+  # The ca_cert is required, the tls_cert and tls_key are optional (client
+  # certificate). Instead of a client certificate, a token can be configured
+  # (e.g. "Authorization: Bearer ...") which is sent as HTTP header.
+  [backend.basic_station.cups.tc_credentials]
+  ca_cert="{{ .Backend.BasicStation.CUPS.TCCredentials.CACert }}"
+  tls_cert="{{ .Backend.BasicStation.CUPS.TCCredentials.TLSCert }}"
+  tls_key="{{ .Backend.BasicStation.CUPS.TCCredentials.TLSKey }}"
+  token="{{ .Backend.BasicStation.CUPS.TCCredentials.Token }}"
+
+  # CUPS credentials.
+  #
+  # The credentials used by the station to connect to the CUPS endpoint.
+  # The same options as for the TC credentials apply.
+  [backend.basic_station.cups.cups_credentials]
+  ca_cert="{{ .Backend.BasicStation.CUPS.CUPSCredentials.CACert }}"
+  tls_cert="{{ .Backend.BasicStation.CUPS.CUPSCredentials.TLSCert }}"
+  tls_key="{{ .Backend.BasicStation.CUPS.CUPSCredentials.TLSKey }}"
+  token="{{ .Backend.BasicStation.CUPS.CUPSCredentials.Token }}"
+
+  # Firmware update.
+  #
+  # When a file is configured, it is sent to the stations reporting a
+  # different package version. The update is only sent when the station
+  # reports the signature_key_crc as one of its keys. The signature_file
+  # must contain the (raw) ECDSA signature of the update file.
+  [backend.basic_station.cups.update]
+
+  # Package version of the update.
+  version="{{ .Backend.BasicStation.CUPS.Update.Version }}"
+
+  # Update file.
+  file="{{ .Backend.BasicStation.CUPS.Update.File }}"
+
+  # Signature file.
+  signature_file="{{ .Backend.BasicStation.CUPS.Update.SignatureFile }}"
+
+  # CRC32 of the public key used to verify the signature.
+  signature_key_crc={{ .Backend.BasicStation.CUPS.Update.SignatureKeyCRC }}
+
   # Concentrator configuration.
   #
   # This section contains the configuration for the SX1301 concentrator chips.
@@ -208,23 +799,218 @@ type="{{ .Backend.Type }}"
       frequency={{ $concentrator.FSK.Frequency }}
 {{ end }}
 
+
+  # Backend channels.
+  #
+  # The events received by the backend are passed to the integration through
+  # buffered channels. When a channel is full (e.g. because of a slow MQTT
+  # broker), the configured drop policy is applied. Increasing the buffer
+  # sizes might be needed for gateways handling a high number of uplinks
+  # (e.g. 16 channel gateways).
+  [backend.channels]
+  # Drop policy.
+  #
+  # Valid options are:
+  #   * block:       Block the backend until the event can be passed to the
+  #                  integration. This might delay the handling of other events
+  #                  (e.g. the gateway stats).
+  #   * drop_oldest: Drop the oldest event of the full channel, such that the
+  #                  backend is not blocked. Note that this does not apply to
+  #                  channels with a buffer size of 0, nor to the downlink TX
+  #                  acknowledgements (these are never dropped).
+  drop_policy="{{ .Backend.Channels.DropPolicy }}"
+
+  # Uplink frame buffer size.
+  uplink_frame_size={{ .Backend.Channels.UplinkFrameSize }}
+
+  # Gateway stats buffer size.
+  gateway_stats_size={{ .Backend.Channels.GatewayStatsSize }}
+
+  # Downlink TX acknowledgement buffer size.
+  downlink_tx_ack_size={{ .Backend.Channels.DownlinkTXAckSize }}
+
+  # Raw packet-forwarder event buffer size.
+  raw_packet_forwarder_event_size={{ .Backend.Channels.RawPacketForwarderEventSize }}
+
+  # Log event buffer size.
+  log_event_size={{ .Backend.Channels.LogEventSize }}
+
+
+  # Downlink scheduler.
+  #
+  # When enabled, the GPS epoch timed (e.g. Class-B) and delay timed downlinks
+  # are scheduled by the ChirpStack Gateway Bridge, before these are sent to
+  # the packet-forwarder. This works for all backends. Downlinks which can not
+  # be transmitted in time are rejected with a TOO_LATE TX acknowledgement
+  # error, downlinks which are too far ahead are rejected with TOO_EARLY.
+  # For delay timed downlinks, the TX time is estimated from the time the
+  # uplink was received. When the uplink context contains the 32 bit
+  # concentrator counter (e.g. the Semtech UDP tmst), this counter is tracked
+  # per gateway as an extended 64 bit clock, such that downlinks scheduled
+  # across the counter rollover (every ~71.6 minutes) are timed correctly.
+  [backend.scheduler]
+
+  # Enable the downlink scheduler.
+  enabled={{ .Backend.Scheduler.Enabled }}
+
+  # Dispatch ahead.
+  #
+  # Downlinks are sent to the packet-forwarder this duration before the TX
+  # time. Downlinks of which the TX time is further ahead are queued.
+  dispatch_ahead="{{ .Backend.Scheduler.DispatchAhead }}"
+
+  # Min. lead time.
+  #
+  # Downlinks of which the TX time is closer than this duration (or already
+  # passed) are rejected with TOO_LATE.
+  min_lead_time="{{ .Backend.Scheduler.MinLeadTime }}"
+
+  # Max. queue duration.
+  #
+  # Downlinks of which the TX time is further ahead than this duration are
+  # rejected with TOO_EARLY. Set to 0 to disable this check.
+  max_queue_duration="{{ .Backend.Scheduler.MaxQueueDuration }}"
+
+  # Queue file.
+  #
+  # When set, the queued downlinks are persisted in this file, such that
+  # these survive a restart of the ChirpStack Gateway Bridge. On startup, the
+  # queued downlinks are re-scheduled. Downlinks of which the TX time has
+  # passed during the restart are rejected with TOO_LATE. Leave blank to
+  # only queue the downlinks in memory.
+  queue_file="{{ .Backend.Scheduler.QueueFile }}"
+
+
+  # Gateway connection-state configuration.
+  #
+  # The connection-state (online / offline) of each gateway is published as
+  # conn event (retained when using MQTT) for all the backends.
+  [backend.conn_state]
+
+  # Keepalive timeout.
+  #
+  # A gateway is reported offline when no event (uplink, stats or keepalive)
+  # has been received from the gateway within this duration, also when the
+  # backend did not detect the disconnection (e.g. a Concentratord which
+  # stopped publishing events). This must be greater than the stats interval
+  # of the gateway. Set to 0 to disable.
+  keepalive_timeout="{{ .Backend.ConnState.KeepaliveTimeout }}"
+
+  # Gateway ID mapping.
+  #
+  # This maps the gateway ID reported by the gateway (gateway_id) to an other
+  # gateway ID (mapped_gateway_id), e.g. when replacing the gateway hardware
+  # without re-registering the gateway. The mapped gateway ID is used for all
+  # events, topics and command subscriptions. The gateway ID of the commands
+  # is mapped back to the gateway ID of the gateway.
+  #
+  # Optionally, the uplinks of each board of a multi-board gateway can be
+  # mapped to a separate gateway ID (board_gateway_ids, the first gateway ID
+  # is used for board 0). Downlinks for a board gateway ID are sent using the
+  # corresponding board. The stats are reported using the mapped_gateway_id.
+  #
+  # Example:
+  # [[backend.gateway_id_mapping]]
+  # gateway_id="0102030405060708"
+  # mapped_gateway_id="0807060504030201"
+  # board_gateway_ids=["0807060504030202", "0807060504030203"]
+{{ range $i, $mapping := .Backend.GatewayIDMapping }}
+  [[backend.gateway_id_mapping]]
+  gateway_id="{{ $mapping.GatewayID }}"
+  mapped_gateway_id="{{ $mapping.MappedGatewayID }}"
+  board_gateway_ids=[{{ range $index, $elm := $mapping.BoardGatewayIDs }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+{{ end }}
+
 # Integration configuration.
 [integration]
 # Payload marshaler.
 #
 # This defines how the MQTT payloads are encoded. Valid options are:
-# * protobuf:  Protobuf encoding
-# * json:      JSON encoding (easier for debugging, but less compact than 'protobuf')
+# * protobuf:       Protobuf encoding
+# * json:           JSON encoding (easier for debugging, but less compact than 'protobuf')
+#                   including the fields set to their default value (legacy)
+# * protobuf_json:  Canonical Protobuf JSON encoding, omitting the fields set
+#                   to their default value
+# * cbor:           CBOR encoding (compact and self-describing, using the Protobuf field names)
 marshaler="{{ .Integration.Marshaler }}"
 
+# Gateway API version.
+#
+# This defines the version of the ChirpStack gateway API (gw Protobuf
+# messages) used for the uplink, stats, ack and downlink payloads:
+# * v3:  ChirpStack Network Server v3
+# * v4:  ChirpStack v4 (the downlink items are attempted in order, the v3
+#        fields are included as legacy fields for v3 consumers)
+#
+# Note: the gRPC integration always uses the v3 gateway API.
+api_version="{{ .Integration.APIVersion }}"
+
+# Enabled integrations.
+#
+# Events are published to all the enabled integrations (see the routes
+# below for routing the uplinks). Currently the following integrations are
+# available:
+# * mqtt:      MQTT integration
+# * kafka:     Kafka integration
+# * grpc:      gRPC integration
+# * nats:      NATS (JetStream) integration
+# * http:      HTTP (webhook) integration
+# * amqp:      AMQP (RabbitMQ) integration
+# * gcp_pub_sub: GCP Pub/Sub integration
+# * aws_sqs:   AWS SQS / SNS integration
+# * plugin:    plugin integration (external binary)
+# * semtech_udp: Semtech UDP integration (legacy network server)
+enabled=[{{ range $index, $elm := .Integration.Enabled }}
+  "{{ $elm }}",{{ end }}
+]
+
+  # Per event-type marshalers.
+  #
+  # This overrides the marshaler for the given event types (up, up_set,
+  # stats, ack, exec, raw, log and conn), e.g. to use protobuf for the uplinks
+  # and json for the stats. The marshaler can be referenced in the event
+  # topic (subject, routing-key) templates using the .Marshaler template
+  # variable, such that consumers are able to distinguish the encodings.
+  # The Kafka integration also sets the 'marshaler' message header, the GCP
+  # Pub/Sub integration the 'marshaler' message attribute. Commands are
+  # always decoded using the marshaler above.
+  #
+  # Example:
+  # up="protobuf"
+  # stats="json"
+  [integration.event_marshalers]
+{{ range $k, $v := .Integration.EventMarshalers }}  {{ $k }}="{{ $v }}"
+{{ end }}
   # MQTT integration configuration.
   [integration.mqtt]
+  # Commands enabled.
+  #
+  # When set to false, this integration will only be used for publishing
+  # events. Commands (e.g. downlinks) are only received from the integrations
+  # which have commands enabled. When multiple integrations are enabled, make
+  # sure to enable commands for only one of them to avoid duplicate downlinks.
+  commands_enabled={{ .Integration.MQTT.CommandsEnabled }}
+
   # Event topic template.
+  #
+  # Available template variables: .GatewayID, .EventType, .Marshaler and
+  # .ContentEncoding (see compression).
   event_topic_template="{{ .Integration.MQTT.EventTopicTemplate }}"
 
   # Command topic template.
   command_topic_template="{{ .Integration.MQTT.CommandTopicTemplate }}"
 
+  # Shared subscription group.
+  #
+  # When set, the command topics are subscribed as shared subscription
+  # ($share/[group]/[topic]). The MQTT broker then delivers each command to
+  # only one of the ChirpStack Gateway Bridge instances subscribed using the
+  # same group, such that multiple instances can share the command load
+  # without double transmissions. This requires a MQTT broker supporting
+  # shared subscriptions and is only used by the generic and aws_iot
+  # authentication types.
+  shared_subscription_group="{{ .Integration.MQTT.SharedSubscriptionGroup }}"
+
   # Maximum interval that will be waited between reconnection attempts when connection is lost.
   # Valid units are 'ms', 's', 'm', 'h'. Note that these values can be combined, e.g. '24h30m15s'.
   max_reconnect_interval="{{ .Integration.MQTT.MaxReconnectInterval }}"
@@ -235,6 +1021,168 @@ marshaler="{{ .Integration.Marshaler }}"
   # process will be terminated on a connection error.
   terminate_on_connect_error={{ .Integration.MQTT.TerminateOnConnectError }}
 
+  # MQTT protocol version.
+  #
+  # Valid options are:
+  #   * 4: MQTT 3.1.1
+  #   * 5: MQTT 5 (only supported by the generic authentication type)
+  protocol_version={{ .Integration.MQTT.ProtocolVersion }}
+
+  # Retained events.
+  #
+  # The event types (up, up_set, stats, ack, exec, raw, log and conn) which
+  # are published as retained message. By default only the conn event is
+  # retained, such that the last known connection-state of each gateway is
+  # available to subscribers connecting afterwards.
+  retained_events=[{{ range $index, $elm := .Integration.MQTT.RetainedEvents }}"{{ $elm }}",{{ end }}]
+
+  # Per event-type QoS.
+  #
+  # This overrides the qos of the authentication type (e.g. generic) for the
+  # given event types, e.g. to publish the uplinks at QoS 1 and the stats at
+  # QoS 0. The commands are always subscribed using the qos of the
+  # authentication type.
+  #
+  # Example:
+  # up=1
+  # stats=0
+  [integration.mqtt.event_qos]
+{{ range $k, $v := .Integration.MQTT.EventQOS }}  {{ $k }}={{ $v }}
+{{ end }}
+  # Event buffer.
+  #
+  # Downlink TX acknowledgements and gateway command execution responses that
+  # could not be published because the connection to the MQTT broker was lost,
+  # are buffered and published directly after the connection has been
+  # re-established.
+  [integration.mqtt.event_buffer]
+
+  # Max. number of buffered events.
+  #
+  # When the buffer is full, the oldest event is discarded. Set this to 0 to
+  # disable buffering.
+  max_count={{ .Integration.MQTT.EventBuffer.MaxCount }}
+
+  # Max. age of buffered events.
+  #
+  # Events older than the configured max. age are discarded, as the
+  # network-server has already timed out waiting for these.
+  max_age="{{ .Integration.MQTT.EventBuffer.MaxAge }}"
+
+  # Store-and-forward.
+  #
+  # Uplink events that could not be published because the connection to the
+  # MQTT broker was lost, are stored on disk and published (in order) after
+  # the connection has been re-established. As the events are stored on
+  # disk, these are retained when the ChirpStack Gateway Bridge is restarted.
+  [integration.mqtt.store_and_forward]
+
+  # Path of the database file.
+  #
+  # When empty, store-and-forward is disabled.
+  path="{{ .Integration.MQTT.StoreAndForward.Path }}"
+
+  # Max. size (in bytes) of the stored events.
+  #
+  # When the max. size is exceeded, the oldest events are discarded. Set this
+  # to 0 to disable the size limit.
+  max_size={{ .Integration.MQTT.StoreAndForward.MaxSize }}
+
+  # Max. age of the stored events.
+  #
+  # Events older than the configured max. age are discarded.
+  max_age="{{ .Integration.MQTT.StoreAndForward.MaxAge }}"
+
+  # Replay retention.
+  #
+  # When set, the published uplink events are retained on disk for the
+  # configured duration, such that these can be re-published using the
+  # replay command (e.g. after an outage of the network-server). Set this
+  # to 0 to disable retaining published events.
+  replay_retention="{{ .Integration.MQTT.StoreAndForward.ReplayRetention }}"
+
+  # Compression.
+  #
+  # When enabled, the event payloads are compressed before publishing, e.g.
+  # to reduce the costs of a satellite or cellular backhaul. The
+  # content-encoding (gzip or zstd) of a compressed payload is available as
+  # .ContentEncoding in the event_topic_template and, when using MQTT 5, is
+  # added as content_encoding user property.
+  [integration.mqtt.compression]
+
+  # Compression algorithm.
+  #
+  # Valid options are:
+  #   * none: the payloads are not compressed
+  #   * gzip: gzip compression
+  #   * zstd: Zstandard compression
+  algorithm="{{ .Integration.MQTT.Compression.Algorithm }}"
+
+  # Min. size (in bytes).
+  #
+  # Payloads smaller than the given size are not compressed, as the
+  # compression overhead outweighs the savings for small payloads.
+  min_size={{ .Integration.MQTT.Compression.MinSize }}
+
+  # Remote configuration.
+  #
+  # When enabled, the configuration file can be updated by publishing its
+  # content to the config topic. The received configuration is validated,
+  # written to the configuration file and reloaded (as if a SIGHUP signal
+  # was received). The (retained) state topic contains the hash of the
+  # current configuration file and the error of the last received
+  # configuration, if any.
+  #
+  # Note that this requires a configuration file and that changes to this
+  # section require a restart.
+  [integration.mqtt.remote_config]
+
+  # Enable remote configuration.
+  enabled={{ .Integration.MQTT.RemoteConfig.Enabled }}
+
+  # State topic template.
+  #
+  # Use {{ "{{ .Hostname }}" }} as substitution for the hostname of the gateway.
+  state_topic_template="{{ .Integration.MQTT.RemoteConfig.StateTopicTemplate }}"
+
+  # Config topic template.
+  #
+  # Use {{ "{{ .Hostname }}" }} as substitution for the hostname of the gateway.
+  config_topic_template="{{ .Integration.MQTT.RemoteConfig.ConfigTopicTemplate }}"
+
+  # MQTT 5 settings.
+  #
+  # These settings are only used when the protocol_version is set to 5.
+  [integration.mqtt.v5]
+
+  # Max. number of topic aliases.
+  #
+  # Topic aliases replace the (long) topic of the published events by a short
+  # number after the first publish. The max. of the MQTT broker is used when
+  # it is lower. Set this to 0 to disable topic aliases.
+  topic_alias_maximum={{ .Integration.MQTT.V5.TopicAliasMaximum }}
+
+  # Message expiry interval.
+  #
+  # When set, the MQTT broker discards the published events which have not
+  # been delivered within the given interval. Set this to 0 to disable the
+  # message expiry.
+  message_expiry_interval="{{ .Integration.MQTT.V5.MessageExpiryInterval }}"
+
+  # User properties.
+  #
+  # When set to true, the gateway ID and event type are added to each
+  # published event as the gateway_id and event_type user properties.
+  user_properties={{ .Integration.MQTT.V5.UserProperties }}
+
+  # Session expiry interval.
+  #
+  # When set, the MQTT broker retains the session (the subscriptions and the
+  # undelivered QoS 1 and 2 messages) for the given interval after the
+  # connection has been lost. Use this together with clean_session=false.
+  # Set this to 0 to remove the session on disconnect.
+  session_expiry_interval="{{ .Integration.MQTT.V5.SessionExpiryInterval }}"
+
 
   # MQTT authentication.
   [integration.mqtt.auth]
@@ -249,10 +1197,32 @@ marshaler="{{ .Integration.Marshaler }}"
     #
     # Configure one or multiple MQTT server to connect to. Each item must be in
     # the following format: scheme://host:port where scheme is tcp, ssl or ws.
+    # The servers are tried in the configured order, the first server is the
+    # primary server.
+    #
+    # A broker running on the gateway can also be reached using a unix socket,
+    # e.g. unix:///var/run/mosquitto/mqtt.sock (the socket must be configured
+    # as listener of the broker).
     servers=[{{ range $index, $elm := .Integration.MQTT.Auth.Generic.Servers }}
       "{{ $elm }}",{{ end }}
     ]
 
+    # Round-robin.
+    #
+    # When set to true and multiple servers are configured, each (re)connect
+    # starts with the server following the server used last, instead of the
+    # primary server.
+    round_robin={{ .Integration.MQTT.Auth.Generic.RoundRobin }}
+
+    # Primary server check interval.
+    #
+    # When set and multiple servers are configured, the primary server is
+    # checked at this interval while connected to an other server. Once the
+    # primary server is reachable again, the ChirpStack Gateway Bridge
+    # re-connects to the primary server. This is ignored when round_robin is
+    # enabled. Set to 0 to disable.
+    primary_check_interval="{{ .Integration.MQTT.Auth.Generic.PrimaryCheckInterval }}"
+
     # Connect with the given username (optional)
     username="{{ .Integration.MQTT.Auth.Generic.Username }}"
 
@@ -294,8 +1264,42 @@ marshaler="{{ .Integration.Marshaler }}"
     tls_cert="{{ .Integration.MQTT.Auth.Generic.TLSCert }}"
 
     # mqtt TLS key file (optional)
+    #
+    # The ca_cert, tls_cert and tls_key files are reloaded when modified, such
+    # that these can be rotated without a restart. The new tls_cert and
+    # tls_key are used on the next (re)connect to the MQTT broker, the new
+    # ca_cert on the next connect which is not an automatic re-connect.
     tls_key="{{ .Integration.MQTT.Auth.Generic.TLSKey }}"
 
+      # Generated client certificate (optional).
+      #
+      # When configured, the ChirpStack Gateway Bridge generates the client
+      # certificate (and private key) used for the MQTT connection, signed by
+      # the configured CA. The certificate is renewed and the connection
+      # re-established before the certificate expires. This can not be
+      # combined with the tls_cert and tls_key options.
+      [integration.mqtt.auth.generic.client_certificate]
+      # CA certificate file.
+      ca_cert="{{ .Integration.MQTT.Auth.Generic.ClientCertificate.CACert }}"
+
+      # CA key file.
+      ca_key="{{ .Integration.MQTT.Auth.Generic.ClientCertificate.CAKey }}"
+
+      # Common name.
+      #
+      # This is the common name (CN) of the generated certificate, e.g.
+      # the gateway ID which is used by the MQTT broker for authorization.
+      common_name="{{ .Integration.MQTT.Auth.Generic.ClientCertificate.CommonName }}"
+
+      # Certificate lifetime.
+      lifetime="{{ .Integration.MQTT.Auth.Generic.ClientCertificate.Lifetime }}"
+
+      # Renew before.
+      #
+      # The certificate will be renewed when it expires within the given
+      # duration. This value must be smaller than the lifetime.
+      renew_before="{{ .Integration.MQTT.Auth.Generic.ClientCertificate.RenewBefore }}"
+
 
     # Google Cloud Platform Cloud IoT Core authentication.
     #
@@ -357,6 +1361,13 @@ marshaler="{{ .Integration.Marshaler }}"
     # It must be set for X.509 authentication.
     device_id="{{ .Integration.MQTT.Auth.AzureIoTHub.DeviceID }}"
 
+    # Module ID (module identity).
+    #
+    # When set, ChirpStack Gateway Bridge connects using the module identity
+    # (e.g. when deployed as IoT Edge module). This will be automatically set
+    # when a module connection string is given.
+    module_id="{{ .Integration.MQTT.Auth.AzureIoTHub.ModuleID }}"
+
     # IoT Hub hostname (X.509 authentication).
     #
     # This will be automatically set when a device connection string is given.
@@ -371,6 +1382,1046 @@ marshaler="{{ .Integration.Marshaler }}"
     tls_cert="{{ .Integration.MQTT.Auth.AzureIoTHub.TLSCert }}"
     tls_key="{{ .Integration.MQTT.Auth.AzureIoTHub.TLSKey }}"
 
+    # Direct methods.
+    #
+    # When set to true, commands are received as direct methods (downlink,
+    # config and exec) instead of cloud-to-device messages. The method response
+    # status reflects if the command was handled successfully. Note that this
+    # requires the json marshaler.
+    direct_methods={{ .Integration.MQTT.Auth.AzureIoTHub.DirectMethods }}
+
+      # Device Provisioning Service (optional).
+      #
+      # When the id_scope is set, the gateway registers itself on first boot
+      # using the Azure IoT Hub Device Provisioning Service (DPS). The assigned
+      # IoT Hub hostname and device ID are used instead of the hostname and
+      # device_id options above. For X.509 authentication, the tls_cert and
+      # tls_key options above are used.
+      [integration.mqtt.auth.azure_iot_hub.provisioning]
+      # ID scope of the Device Provisioning Service.
+      id_scope="{{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.IDScope }}"
+
+      # Registration ID.
+      #
+      # In case of X.509 authentication, this must match the common name of
+      # the client certificate.
+      registration_id="{{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.RegistrationID }}"
+
+      # Global device endpoint.
+      endpoint="{{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.Endpoint }}"
+
+      # Symmetric key (symmetric key authentication).
+      #
+      # The primary or secondary key of the individual enrollment, or of the
+      # enrollment group when enrollment_group is set to true.
+      symmetric_key="{{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.SymmetricKey }}"
+
+      # Enrollment group.
+      #
+      # When set to true, the device key is derived from the symmetric_key of
+      # the enrollment group and the registration_id.
+      enrollment_group={{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.EnrollmentGroup }}
+
+      # State file.
+      #
+      # When set, the result of the registration is stored in this file and
+      # the registration is skipped on the next start. Remove this file to
+      # register the device again.
+      state_file="{{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.StateFile }}"
+
+      # Registration timeout.
+      timeout="{{ .Integration.MQTT.Auth.AzureIoTHub.Provisioning.Timeout }}"
+
+    # AWS IoT Core
+    #
+    # Note that AWS IoT Core reserves the topics starting with $, the event
+    # and command topic templates can not start with $.
+    [integration.mqtt.auth.aws_iot]
+
+    # Authentication mode.
+    #
+    # Valid options are:
+    #  * websocket_sigv4:   MQTT over WebSocket, using a SigV4 signed URL
+    #  * custom_authorizer: MQTT over TLS (port 443), using a custom authorizer
+    #  * x509:              MQTT over TLS (port 443, ALPN), using a X.509 client
+    #                       certificate
+    mode="{{ .Integration.MQTT.Auth.AWSIoT.Mode }}"
+
+    # AWS IoT Core (ATS) endpoint.
+    #
+    # Example: xxxxxxxxxxxxxx-ats.iot.eu-west-1.amazonaws.com
+    endpoint="{{ .Integration.MQTT.Auth.AWSIoT.Endpoint }}"
+
+    # AWS region (websocket_sigv4).
+    region="{{ .Integration.MQTT.Auth.AWSIoT.Region }}"
+
+    # MQTT client ID.
+    #
+    # This must match the AWS IoT policy of the gateway, e.g. the gateway ID.
+    client_id="{{ .Integration.MQTT.Auth.AWSIoT.ClientID }}"
+
+    # CA certificate file (optional).
+    #
+    # When not set, the system CA certificates are used.
+    ca_cert="{{ .Integration.MQTT.Auth.AWSIoT.CACert }}"
+
+    # Credential source (websocket_sigv4).
+    #
+    # Valid options are:
+    #  * static: use the access_key_id, secret_access_key and session_token below
+    #  * env:    use the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+    #            AWS_SESSION_TOKEN environment variables
+    #  * ec2:    use the EC2 instance metadata service (instance profile)
+    #  * ecs:    use the ECS container credentials (task role)
+    #
+    # Temporary credentials are refreshed before they expire. This triggers
+    # a re-connect using a freshly signed URL.
+    credential_source="{{ .Integration.MQTT.Auth.AWSIoT.CredentialSource }}"
+
+    # Static credentials (websocket_sigv4).
+    access_key_id="{{ .Integration.MQTT.Auth.AWSIoT.AccessKeyID }}"
+    secret_access_key="{{ .Integration.MQTT.Auth.AWSIoT.SecretAccessKey }}"
+    session_token="{{ .Integration.MQTT.Auth.AWSIoT.SessionToken }}"
+
+    # Username (custom_authorizer).
+    #
+    # The authorizer parameters below are added as query parameters to
+    # the username.
+    username="{{ .Integration.MQTT.Auth.AWSIoT.Username }}"
+
+    # Authorizer name (custom_authorizer).
+    authorizer_name="{{ .Integration.MQTT.Auth.AWSIoT.AuthorizerName }}"
+
+    # Authorizer token key name and token (custom_authorizer).
+    #
+    # The token is also used as MQTT password.
+    authorizer_token_key_name="{{ .Integration.MQTT.Auth.AWSIoT.AuthorizerTokenKeyName }}"
+    authorizer_token="{{ .Integration.MQTT.Auth.AWSIoT.AuthorizerToken }}"
+
+    # Authorizer token signature (custom_authorizer).
+    #
+    # This must be set when token signing is enabled for the authorizer.
+    authorizer_signature="{{ .Integration.MQTT.Auth.AWSIoT.AuthorizerSignature }}"
+
+    # Client certificate (x509).
+    #
+    # The certificate must be registered in AWS IoT Core and attached to the
+    # thing and policy of the gateway.
+    tls_cert="{{ .Integration.MQTT.Auth.AWSIoT.TLSCert }}"
+    tls_key="{{ .Integration.MQTT.Auth.AWSIoT.TLSKey }}"
+
+      # Device shadow reporter.
+      #
+      # When enabled, the gateway stats and connection state are reported
+      # to the (classic) device shadow of the thing of each gateway, such
+      # that the gateways can be monitored from the AWS console. The AWS IoT
+      # policy must allow publishing to the $aws/things/+/shadow/update topic.
+      [integration.mqtt.auth.aws_iot.shadow]
+      # Enable the device shadow reporter.
+      enabled={{ .Integration.MQTT.Auth.AWSIoT.Shadow.Enabled }}
+
+      # Thing name template.
+      #
+      # This template is used to derive the thing name from the gateway ID.
+      thing_name_template="{{ .Integration.MQTT.Auth.AWSIoT.Shadow.ThingNameTemplate }}"
+
+
+  # Kafka integration configuration.
+  [integration.kafka]
+  # Commands enabled.
+  #
+  # When set to true, the commands (e.g. downlinks) are consumed from the
+  # command topic. See the MQTT commands_enabled option to avoid duplicate
+  # downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.Kafka.CommandsEnabled }}
+
+  # Kafka brokers.
+  brokers=[{{ range $index, $elm := .Integration.Kafka.Brokers }}
+    "{{ $elm }}",{{ end }}
+  ]
+
+  # Event topic template.
+  #
+  # The gateway ID is used as message key, the event type is also set
+  # as 'event' message header.
+  event_topic_template="{{ .Integration.Kafka.EventTopicTemplate }}"
+
+  # Command topic.
+  #
+  # The commands for all gateways are consumed from this topic. The message
+  # key must contain the gateway ID and the 'command' message header the
+  # command type (down, config, exec or raw).
+  command_topic="{{ .Integration.Kafka.CommandTopic }}"
+
+  # Consumer group.
+  #
+  # Commands for gateways which are not connected to this ChirpStack Gateway
+  # Bridge instance are ignored. Therefore each instance must use a unique
+  # consumer group.
+  consumer_group="{{ .Integration.Kafka.ConsumerGroup }}"
+
+  # TLS.
+  #
+  # When set to true, the connection to the brokers is made using TLS.
+  tls={{ .Integration.Kafka.TLS }}
+
+  # CA certificate file (optional).
+  #
+  # Use this when setting up a secure connection (when the broker
+  # certificate is not signed by a public CA).
+  ca_cert="{{ .Integration.Kafka.CACert }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.Kafka.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.Kafka.TLSKey }}"
+
+    # SASL authentication.
+    [integration.kafka.sasl]
+    # Mechanism.
+    #
+    # Valid options are:
+    #  * (empty):       SASL authentication is disabled
+    #  * plain:         PLAIN
+    #  * scram_sha_256: SCRAM-SHA-256
+    #  * scram_sha_512: SCRAM-SHA-512
+    mechanism="{{ .Integration.Kafka.SASL.Mechanism }}"
+
+    # Username.
+    username="{{ .Integration.Kafka.SASL.Username }}"
+
+    # Password.
+    password="{{ .Integration.Kafka.SASL.Password }}"
+
+
+  # NATS integration configuration.
+  [integration.nats]
+  # Commands enabled.
+  #
+  # When set to true, the integration subscribes to the command subject of
+  # each gateway. See the MQTT commands_enabled option to avoid duplicate
+  # downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.NATS.CommandsEnabled }}
+
+  # NATS servers.
+  servers=[{{ range $index, $elm := .Integration.NATS.Servers }}
+    "{{ $elm }}",{{ end }}
+  ]
+
+  # Event subject template.
+  event_subject_template="{{ .Integration.NATS.EventSubjectTemplate }}"
+
+  # Command subject template.
+  #
+  # The last token of the subject must contain the command type (down,
+  # config, exec or raw).
+  command_subject_template="{{ .Integration.NATS.CommandSubjectTemplate }}"
+
+  # Reconnect wait.
+  #
+  # The time to wait between reconnect attempts.
+  reconnect_wait="{{ .Integration.NATS.ReconnectWait }}"
+
+  # Username (optional).
+  username="{{ .Integration.NATS.Username }}"
+
+  # Password (optional).
+  password="{{ .Integration.NATS.Password }}"
+
+  # Credentials file (optional).
+  #
+  # The user credentials (JWT and NKey seed) file, for NATS 2.0
+  # decentralized authentication.
+  credentials_file="{{ .Integration.NATS.CredentialsFile }}"
+
+  # CA certificate file (optional).
+  #
+  # Use this when setting up a secure connection (when the server
+  # certificate is not signed by a public CA).
+  ca_cert="{{ .Integration.NATS.CACert }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.NATS.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.NATS.TLSKey }}"
+
+    # JetStream configuration.
+    [integration.nats.jetstream]
+    # Enable JetStream.
+    #
+    # When enabled, the events are published using JetStream. The publish
+    # is acknowledged by the server once the event is persisted in the
+    # stream capturing the event subject.
+    enabled={{ .Integration.NATS.JetStream.Enabled }}
+
+    # Stream (optional).
+    #
+    # When set, the stream is created (using the subjects below) in case it
+    # does not exist.
+    stream="{{ .Integration.NATS.JetStream.Stream }}"
+
+    # Stream subjects.
+    subjects=[{{ range $index, $elm := .Integration.NATS.JetStream.Subjects }}
+      "{{ $elm }}",{{ end }}
+    ]
+
+
+  # HTTP integration configuration.
+  #
+  # The events are POSTed to the configured URL(s), encoded using the
+  # configured marshaler. The X-Event-Type and X-Gateway-ID headers contain
+  # the event type and gateway ID.
+  [integration.http]
+  # Commands enabled.
+  #
+  # When set to true, the commands are received by the command listener
+  # (POST /gateway/{gateway_id}/command/{command}, with command down, config,
+  # exec or raw). See the MQTT commands_enabled option to avoid duplicate
+  # downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.HTTP.CommandsEnabled }}
+
+  # Command listener bind (ip:port).
+  command_bind="{{ .Integration.HTTP.CommandBind }}"
+
+  # Event URL.
+  #
+  # The URL to which the events are POSTed, unless an URL has been configured
+  # for the event type below.
+  event_url="{{ .Integration.HTTP.EventURL }}"
+
+  # Request timeout.
+  timeout="{{ .Integration.HTTP.Timeout }}"
+
+  # HMAC secret (optional).
+  #
+  # When set, the X-Signature-SHA256 header contains the hex encoded
+  # HMAC-SHA256 signature of the request body. Commands must be signed the
+  # same way.
+  hmac_secret="{{ .Integration.HTTP.HMACSecret }}"
+
+  # Max. retries.
+  #
+  # The number of times a request is retried on a connection error or a 5xx
+  # or 429 response, using an exponential backoff starting at retry_interval.
+  max_retries={{ .Integration.HTTP.MaxRetries }}
+
+  # Retry interval.
+  retry_interval="{{ .Integration.HTTP.RetryInterval }}"
+
+  # Max. retry interval.
+  max_retry_interval="{{ .Integration.HTTP.MaxRetryInterval }}"
+
+    # Event URLs.
+    #
+    # Per event type URLs. Events without URL (and without event_url) are not
+    # published.
+    [integration.http.event_urls]
+    # Example:
+    # up="https://example.com/uplink"
+    # stats="https://example.com/stats"
+    {{ range $k, $v := .Integration.HTTP.EventURLs }}
+    {{ $k }}="{{ $v }}"
+    {{ end }}
+
+    # Request headers.
+    #
+    # Additional headers to add to each request.
+    [integration.http.headers]
+    # Example:
+    # Authorization="Bearer secret"
+    {{ range $k, $v := .Integration.HTTP.Headers }}
+    {{ $k }}="{{ $v }}"
+    {{ end }}
+
+
+  # AMQP integration configuration.
+  #
+  # The events are published to the configured (topic) exchange. For each
+  # gateway, a command queue is declared and bound to the same exchange.
+  [integration.amqp]
+  # Commands enabled.
+  #
+  # When set to true, the integration consumes the command queue of each
+  # gateway. See the MQTT commands_enabled option to avoid duplicate
+  # downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.AMQP.CommandsEnabled }}
+
+  # Server URL.
+  #
+  # Use amqps:// for a TLS connection.
+  url="{{ .Integration.AMQP.URL }}"
+
+  # Exchange.
+  #
+  # The exchange must exist and must be of type topic.
+  exchange="{{ .Integration.AMQP.Exchange }}"
+
+  # Event routing-key template.
+  event_routing_key_template="{{ .Integration.AMQP.EventRoutingKeyTemplate }}"
+
+  # Command queue template.
+  #
+  # The command queue is declared as auto-delete, it is removed once the
+  # gateway disconnects.
+  command_queue_template="{{ .Integration.AMQP.CommandQueueTemplate }}"
+
+  # Command routing-key template.
+  #
+  # The routing-key used to bind the command queue to the exchange. The last
+  # token of the routing-key of each command must contain the command type
+  # (down, config, exec or raw).
+  command_routing_key_template="{{ .Integration.AMQP.CommandRoutingKeyTemplate }}"
+
+  # Publisher confirms.
+  #
+  # When enabled, each event must be confirmed by the server before the
+  # publish is considered successful.
+  publisher_confirms={{ .Integration.AMQP.PublisherConfirms }}
+
+  # Confirm timeout.
+  #
+  # The max. time to wait for a publisher confirm.
+  confirm_timeout="{{ .Integration.AMQP.ConfirmTimeout }}"
+
+  # Reconnect interval.
+  #
+  # The time to wait between reconnect attempts.
+  reconnect_interval="{{ .Integration.AMQP.ReconnectInterval }}"
+
+  # CA certificate file (optional).
+  #
+  # Use this when setting up a secure connection (when the server
+  # certificate is not signed by a public CA).
+  ca_cert="{{ .Integration.AMQP.CACert }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.AMQP.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.AMQP.TLSKey }}"
+
+
+  # GCP Pub/Sub integration configuration.
+  #
+  # The events are published directly to a Pub/Sub topic and the commands are
+  # consumed from a Pub/Sub subscription. The message attributes are equal to
+  # the attributes set by Cloud IoT Core (deviceId, deviceRegistryId,
+  # deviceRegistryLocation, projectId and subFolder).
+  [integration.gcp_pub_sub]
+  # Commands enabled.
+  #
+  # When enabled, the commands are consumed from the command_subscription.
+  commands_enabled={{ .Integration.GCPPubSub.CommandsEnabled }}
+
+  # Service-account credentials file.
+  #
+  # Path to the service-account JSON key-file. This can be left blank when
+  # using the Pub/Sub emulator.
+  credentials_file="{{ .Integration.GCPPubSub.CredentialsFile }}"
+
+  # Project ID.
+  #
+  # When left blank, the project ID of the service-account is used.
+  project_id="{{ .Integration.GCPPubSub.ProjectID }}"
+
+  # Cloud region.
+  #
+  # This value is only used for the deviceRegistryLocation attribute.
+  cloud_region="{{ .Integration.GCPPubSub.CloudRegion }}"
+
+  # Registry ID.
+  #
+  # This value is only used for the deviceRegistryId attribute.
+  registry_id="{{ .Integration.GCPPubSub.RegistryID }}"
+
+  # Event topic.
+  #
+  # The name of the Pub/Sub topic to which the events are published.
+  event_topic="{{ .Integration.GCPPubSub.EventTopic }}"
+
+  # Command subscription.
+  #
+  # The name of the Pub/Sub subscription from which the commands are consumed.
+  # The deviceId attribute must be set to gw-[GATEWAY_ID], the subFolder
+  # attribute must be set to the command type (down, config, exec or raw).
+  command_subscription="{{ .Integration.GCPPubSub.CommandSubscription }}"
+
+  # Endpoint.
+  #
+  # The Pub/Sub API endpoint, this can be changed to use the Pub/Sub emulator.
+  endpoint="{{ .Integration.GCPPubSub.Endpoint }}"
+
+  # Request timeout.
+  timeout="{{ .Integration.GCPPubSub.Timeout }}"
+
+
+  # AWS SQS / SNS integration configuration.
+  #
+  # The events are published to an SNS topic or an SQS queue and the commands
+  # are consumed from an SQS queue. The gateway ID, the event (or command) type
+  # and the marshaler are set as message attributes (gateway_id, event or
+  # command and marshaler). Payloads encoded using a binary marshaler
+  # (protobuf or cbor) are base64 encoded.
+  [integration.aws_sqs]
+  # Commands enabled.
+  #
+  # When enabled, the commands are consumed from the command_queue_url.
+  commands_enabled={{ .Integration.AWSSQS.CommandsEnabled }}
+
+  # AWS region.
+  region="{{ .Integration.AWSSQS.Region }}"
+
+  # Credential source.
+  #
+  # Valid options are:
+  #  * static: the access_key_id, secret_access_key and session_token below
+  #  * env:    the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+  #            AWS_SESSION_TOKEN environment variables
+  #  * ec2:    the IAM role of the EC2 instance profile
+  #  * ecs:    the IAM role of the ECS task
+  credential_source="{{ .Integration.AWSSQS.CredentialSource }}"
+
+  # Access key ID (static credential source).
+  access_key_id="{{ .Integration.AWSSQS.AccessKeyID }}"
+
+  # Secret access key (static credential source).
+  secret_access_key="{{ .Integration.AWSSQS.SecretAccessKey }}"
+
+  # Session token (static credential source, optional).
+  session_token="{{ .Integration.AWSSQS.SessionToken }}"
+
+  # Event topic ARN.
+  #
+  # The ARN of the SNS topic to which the events are published. Either this
+  # option or the event_queue_url must be set.
+  event_topic_arn="{{ .Integration.AWSSQS.EventTopicARN }}"
+
+  # Event queue URL.
+  #
+  # The URL of the SQS queue to which the events are published, e.g.
+  # https://sqs.eu-west-1.amazonaws.com/123456789012/events.
+  event_queue_url="{{ .Integration.AWSSQS.EventQueueURL }}"
+
+  # Command queue URL.
+  #
+  # The URL of the SQS queue from which the commands are consumed. The
+  # gateway_id attribute must be set to the gateway ID, the command attribute
+  # must be set to the command type (down, config, exec or raw).
+  command_queue_url="{{ .Integration.AWSSQS.CommandQueueURL }}"
+
+  # SNS endpoint.
+  #
+  # When left blank, the regional SNS endpoint is used.
+  sns_endpoint="{{ .Integration.AWSSQS.SNSEndpoint }}"
+
+  # Wait time.
+  #
+  # The long polling wait time of the command queue (max. 20s).
+  wait_time="{{ .Integration.AWSSQS.WaitTime }}"
+
+  # Request timeout.
+  timeout="{{ .Integration.AWSSQS.Timeout }}"
+
+
+  # gRPC integration configuration.
+  [integration.grpc]
+  # Commands enabled.
+  #
+  # When set to true, the commands (e.g. downlinks) received from the
+  # server are handled. See the MQTT commands_enabled option to avoid
+  # duplicate downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.GRPC.CommandsEnabled }}
+
+  # Server (hostname:port).
+  #
+  # The ChirpStack Gateway Bridge opens a bidirectional stream to this server.
+  server="{{ .Integration.GRPC.Server }}"
+
+  # Maximum interval that will be waited between stream reconnection attempts.
+  max_reconnect_interval="{{ .Integration.GRPC.MaxReconnectInterval }}"
+
+  # TLS.
+  #
+  # When set to true, the connection to the server is made using TLS.
+  tls={{ .Integration.GRPC.TLS }}
+
+  # CA certificate file (optional).
+  #
+  # Use this when setting up a secure connection (when the server
+  # certificate is not signed by a public CA).
+  ca_cert="{{ .Integration.GRPC.CACert }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.GRPC.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.GRPC.TLSKey }}"
+
+
+  # Plugin integration configuration.
+  #
+  # The plugin is an external binary which is started (and restarted when it
+  # exits) by the ChirpStack Gateway Bridge. The plugin must implement the
+  # gRPC integration service on the unix socket of which the path is set in
+  # the CHIRPSTACK_GATEWAY_BRIDGE_PLUGIN_SOCKET environment variable.
+  [integration.plugin]
+  # Commands enabled.
+  #
+  # When set to true, the commands (e.g. downlinks) received from the
+  # plugin are handled. See the MQTT commands_enabled option to avoid
+  # duplicate downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.Plugin.CommandsEnabled }}
+
+  # Path of the plugin binary.
+  path="{{ .Integration.Plugin.Path }}"
+
+  # Arguments passed to the plugin.
+  args=[{{ range $index, $elm := .Integration.Plugin.Args }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+  # Restart interval.
+  #
+  # When the plugin exits, it is restarted after this interval.
+  restart_interval="{{ .Integration.Plugin.RestartInterval }}"
+
+
+  # Semtech UDP integration configuration.
+  #
+  # The Semtech UDP integration forwards the uplinks and stats of each gateway
+  # to a (legacy) network server, acting as a Semtech UDP packet-forwarder
+  # for each gateway (e.g. to feed both ChirpStack and a legacy network
+  # server during a migration, using the mirror integration).
+  [integration.semtech_udp]
+  # Commands enabled.
+  #
+  # When set to true, PULL_DATA keepalives are sent for the connected
+  # gateways and the downlinks (PULL_RESP) received from the network server
+  # are handled. See the MQTT commands_enabled option to avoid duplicate
+  # downlinks when multiple integrations are enabled.
+  commands_enabled={{ .Integration.SemtechUDP.CommandsEnabled }}
+
+  # Network server (hostname:port).
+  server="{{ .Integration.SemtechUDP.Server }}"
+
+  # Keepalive interval.
+  #
+  # The interval at which the PULL_DATA keepalives are sent.
+  keepalive_interval="{{ .Integration.SemtechUDP.KeepaliveInterval }}"
+
+
+  # Uplink routes.
+  #
+  # When configured, the uplinks (up and up_set events) are only published
+  # to the integrations of the routes matching the uplink, e.g. to publish
+  # the uplinks of the private network to ChirpStack using MQTT and the
+  # uplinks of a roaming partner to the partner using HTTP. Each integration
+  # uses the credentials of its own section. Integrations which are not part
+  # of any route receive all uplinks. Other events are always published to
+  # all the enabled integrations.
+  #
+  # A route matches:
+  # * Data uplinks of which the DevAddr matches one of the net_ids or
+  #   dev_addr_prefixes (DevAddr/prefix size)
+  # * Join-requests of which the JoinEUI is within one of the join_euis ranges
+  # * Rejoin-requests matching one of the net_ids (type 0 and 2) or join_euis
+  #   (type 1)
+  # * All uplinks when no net_ids, dev_addr_prefixes and join_euis are set
+  #   (e.g. a default route)
+  #
+  # Uplinks which can not be decoded and proprietary uplinks match all routes.
+  #
+  # Example:
+  # [[integration.routes]]
+  # name="private"
+  # integrations=["mqtt"]
+  # net_ids=["000000"]
+  # join_euis=[["0000000000000000", "00000000000000ff"]]
+  #
+  # [[integration.routes]]
+  # name="partner"
+  # integrations=["http"]
+  # dev_addr_prefixes=["26000000/7"]
+{{ range $i, $route := .Integration.Routes }}
+  [[integration.routes]]
+  name="{{ $route.Name }}"
+  integrations=[{{ range $index, $elm := $route.Integrations }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+  net_ids=[{{ range $index, $elm := $route.NetIDs }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+  dev_addr_prefixes=[{{ range $index, $elm := $route.DevAddrPrefixes }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+  join_euis=[{{ range $index, $elm := $route.JoinEUIs }}{{ if $index }}, {{ end }}["{{ index $elm 0 }}", "{{ index $elm 1 }}"]{{ end }}]
+{{ end }}
+
+# Traffic mirroring.
+#
+# When enabled, all events are also published to the mirror integration(s),
+# e.g. to feed a staging environment or to migrate to a different MQTT broker.
+# The mirror integration is configured using the same options as the
+# [integration] section (including the marshaler), under
+# [mirror.integration]. Options which are not set use the same default as
+# the [integration] section. Example:
+#
+# [mirror.integration]
+# marshaler="json"
+# enabled=["kafka"]
+#
+#   [mirror.integration.kafka]
+#   brokers=["staging-kafka:9092"]
+#
+# The events are handed to the mirror integration through a queue, such that
+# a slow or unavailable mirror never blocks the integration. Events are
+# dropped for the mirror when the queue is full. Commands are never received
+# from the mirror integration and the mirror integration does not affect the
+# readiness of the bridge.
+[mirror]
+# Enable traffic mirroring.
+enabled={{ .Mirror.Enabled }}
+
+# Queue size.
+#
+# The max. number of events queued for the mirror integration.
+queue_size={{ .Mirror.QueueSize }}
+
+
+# Hot-standby mode.
+#
+# When enabled, two (or more) ChirpStack Gateway Bridge instances can be
+# connected to the same gateways (e.g. a packet-forwarder forwarding to both
+# instances) and to the same integration. A single instance is elected as
+# active using a retained message on the lock_topic of the MQTT broker below.
+# Standby instances receive the gateway traffic, but do not publish the events
+# and drop the commands until the active instance fails, such that no
+# duplicate events or downlinks are sent.
+[high_availability]
+# Enable the hot-standby mode.
+enabled={{ .HighAvailability.Enabled }}
+
+# Instance ID.
+#
+# The ID of this instance, this must be unique for each instance. When left
+# blank, the hostname is used.
+instance_id="{{ .HighAvailability.InstanceID }}"
+
+# Lock topic.
+#
+# The MQTT topic containing the instance ID of the active instance.
+lock_topic="{{ .HighAvailability.LockTopic }}"
+
+# Lease duration.
+#
+# A standby instance takes over when it has not received a heartbeat of the
+# active instance within this duration. The active instance falls back to
+# standby when it has not received its own heartbeat within this duration
+# (e.g. when it lost the connection to the broker).
+lease_duration="{{ .HighAvailability.LeaseDuration }}"
+
+# Heartbeat interval.
+#
+# The interval at which the active instance publishes its instance ID to the
+# lock topic. The lease_duration must be at least twice this interval.
+heartbeat_interval="{{ .HighAvailability.HeartbeatInterval }}"
+
+  # MQTT broker used for the election.
+  [high_availability.mqtt]
+  # MQTT server (e.g. scheme://host:port where scheme is tcp, ssl, ws or wss)
+  server="{{ .HighAvailability.MQTT.Server }}"
+
+  # Connect with the given username (optional)
+  username="{{ .HighAvailability.MQTT.Username }}"
+
+  # Connect with the given password (optional)
+  password="{{ .HighAvailability.MQTT.Password }}"
+
+  # CA certificate file (optional)
+  ca_cert="{{ .HighAvailability.MQTT.CACert }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .HighAvailability.MQTT.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .HighAvailability.MQTT.TLSKey }}"
+
+
+# Forwarder configuration.
+[forwarder]
+# Clock-drift compensation.
+#
+# When enabled, the drift between the concentrator counter and the wall-clock
+# time is estimated per gateway, using the timestamps of the received uplinks.
+# The delay of delay-based downlinks (e.g. RX1 / RX2) is corrected using the
+# estimated drift. This only applies to backends using the 32 bit concentrator
+# counter (Semtech UDP and Concentratord). The estimate of a gateway is
+# discarded when the gateway disconnects.
+clock_drift_compensation={{ .Forwarder.ClockDriftCompensation }}
+
+# Clock-drift window.
+#
+# The sliding window of uplinks used to estimate the clock-drift.
+clock_drift_window="{{ .Forwarder.ClockDriftWindow }}"
+
+# Max. timing correction (us).
+#
+# The max. correction (in microseconds) applied to a delay-based downlink.
+max_timing_correction_us={{ .Forwarder.MaxTimingCorrectionUS }}
+
+  # Duty-cycle accounting.
+  #
+  # When enabled, the airtime of the downlinks is tracked per gateway and
+  # sub-band within a sliding window. Downlinks which would exceed the
+  # duty-cycle limit of the sub-band are not sent to the gateway, but are
+  # acknowledged with the DUTY_CYCLE_OVERFLOW error instead.
+  [forwarder.duty_cycle]
+  # Enable duty-cycle accounting.
+  enabled={{ .Forwarder.DutyCycle.Enabled }}
+
+  # Region.
+  #
+  # The region defining the sub-bands and duty-cycle limits. Valid options are:
+  #   * EU868
+  #   * EU433
+  region="{{ .Forwarder.DutyCycle.Region }}"
+
+  # Window.
+  #
+  # The sliding window over which the duty-cycle is calculated.
+  window="{{ .Forwarder.DutyCycle.Window }}"
+
+  # Listen-before-talk (LBT).
+  #
+  # This should be enabled for gateways operating in a region requiring
+  # listen-before-talk. When enabled, the downlinks rejected by the gateway
+  # because the channel was busy are acknowledged with the CHANNEL_BUSY error
+  # (instead of the packet-forwarder specific error, e.g. LBT_NOT_ALLOWED)
+  # and are counted by the forwarder_lbt_channel_busy_count metric.
+  [forwarder.lbt]
+  # Enable listen-before-talk reporting and enforcement.
+  enabled={{ .Forwarder.LBT.Enabled }}
+
+  # Region.
+  #
+  # The region defining the frequencies requiring listen-before-talk. Valid
+  # options are:
+  #   * AS923
+  #   * KR920
+  region="{{ .Forwarder.LBT.Region }}"
+
+  # Channel-busy back-off.
+  #
+  # After a channel was reported busy by the gateway, the downlinks for the
+  # same gateway and frequency are not sent to the gateway during this
+  # period, but are acknowledged with the CHANNEL_BUSY error instead. Set
+  # this to 0s to disable the back-off.
+  channel_busy_backoff="{{ .Forwarder.LBT.ChannelBusyBackoff }}"
+
+  # Downlink validation.
+  #
+  # When enabled, the downlinks of which the frequency, TX power or data-rate
+  # are outside the limits of the configured region are not sent to the
+  # gateway, but are acknowledged with the TX_FREQ, TX_POWER or TX_DATA_RATE
+  # error instead. This protects against a misconfigured network server.
+  # The rejected downlinks are counted by the
+  # forwarder_downlink_validation_reject_count metric.
+  [forwarder.downlink_validation]
+  # Enable downlink validation.
+  enabled={{ .Forwarder.DownlinkValidation.Enabled }}
+
+  # Region.
+  #
+  # The region defining the downlink frequencies, max. TX power and
+  # data-rates. Valid options are EU868, EU433, US915, AU915, AS923, KR920,
+  # IN865, CN470, CN779, RU864 and ISM2400 (LoRa 2.4 GHz).
+  region="{{ .Forwarder.DownlinkValidation.Region }}"
+
+  # Max. TX power (dBm).
+  #
+  # When set, this overrides the max. TX power (EIRP) of the region, e.g.
+  # to take the antenna gain into account. When set to 0, the max. TX power
+  # of the region is used.
+  max_tx_power={{ .Forwarder.DownlinkValidation.MaxTXPower }}
+
+  # Rate limiting.
+  #
+  # When enabled, the up, stats, raw and log events are rate limited per
+  # gateway using a token-bucket, such that a misbehaving packet-forwarder
+  # (e.g. flooding uplinks) can not saturate the integration. The events
+  # exceeding the rate limit are dropped and counted by the
+  # forwarder_rate_limit_drop_count metric.
+  [forwarder.rate_limit]
+  # Enable rate limiting.
+  enabled={{ .Forwarder.RateLimit.Enabled }}
+
+  # Events per second.
+  #
+  # The sustained number of events per second allowed per gateway.
+  events_per_second={{ .Forwarder.RateLimit.EventsPerSecond }}
+
+  # Burst.
+  #
+  # The max. number of events per gateway allowed in a burst.
+  burst={{ .Forwarder.RateLimit.Burst }}
+
+  # Uplink deduplication.
+  #
+  # When enabled, uplinks with the same PHYPayload and frequency received
+  # within the deduplication window (e.g. by multiple packet forwarders
+  # connected to this ChirpStack Gateway Bridge) are merged into a single
+  # up_set event (UplinkFrameSet), instead of publishing an up event per
+  # uplink. Note that this delays the uplinks by the deduplication window.
+  [forwarder.deduplication]
+  # Enable uplink deduplication.
+  enabled={{ .Forwarder.Deduplication.Enabled }}
+
+  # Deduplication window.
+  window="{{ .Forwarder.Deduplication.Window }}"
+
+  # Gateway stats aggregation.
+  #
+  # When enabled, the stats events received from the packet-forwarder within
+  # the aggregation interval are merged into a single stats event per
+  # gateway. The rx / tx packet counters are summed, the other fields (e.g.
+  # location and config version) are taken from the last received stats.
+  # The meta-data configured in the [meta_data] section is added to the
+  # aggregated stats.
+  [forwarder.stats_aggregation]
+  # Enable stats aggregation.
+  enabled={{ .Forwarder.StatsAggregation.Enabled }}
+
+  # Aggregation interval.
+  #
+  # The interval starts with the first stats event received from the
+  # gateway. When the packet-forwarder stats interval is greater than this
+  # interval, each stats event is published individually.
+  interval="{{ .Forwarder.StatsAggregation.Interval }}"
+
+  # Add bridge counters.
+  #
+  # When enabled, the following counters are added to the meta-data of the
+  # aggregated stats. These contain the number of events handled by the
+  # ChirpStack Gateway Bridge since the previous stats event of the gateway:
+  #
+  #   bridge_stats_received:         stats events aggregated
+  #   bridge_uplink_received:        uplinks received from the gateway
+  #   bridge_uplink_forwarded:       uplinks forwarded to the integration
+  #   bridge_uplink_dropped:         uplinks dropped by the filters, rate limit or hooks
+  #   bridge_downlink_received:      downlinks received from the integration
+  #   bridge_downlink_ack_received:  downlink acknowledgements received from the gateway
+  #   bridge_integration_reconnects: re-connects of the integration (e.g. MQTT)
+  bridge_counters={{ .Forwarder.StatsAggregation.BridgeCounters }}
+
+  # Cumulative stats counters.
+  #
+  # When enabled, the rx / tx packet counters of the gateway stats are summed
+  # per gateway and added to the meta-data of the published stats:
+  #
+  #   rx_packets_received_total:    packets received by the gateway
+  #   rx_packets_received_ok_total: packets received by the gateway with a valid CRC
+  #   tx_packets_received_total:    downlinks received by the gateway
+  #   tx_packets_emitted_total:     downlinks emitted by the gateway
+  #   stats_counters_since:         timestamp (RFC3339) since which is counted
+  #
+  # The counters are persisted in the configured state file, such that these
+  # continue from the stored values after a restart. The counters of a gateway
+  # can be reset using the built-in reset_stats_counters gateway command.
+  [forwarder.stats_counters]
+  # Enable cumulative stats counters.
+  enabled={{ .Forwarder.StatsCounters.Enabled }}
+
+  # State file.
+  #
+  # The directory of this file must exist and must be writable.
+  file="{{ .Forwarder.StatsCounters.File }}"
+
+  # Save interval.
+  #
+  # The interval in which the counters are written to the state file (when
+  # changed). The counters received since the previous save are lost on a
+  # power-loss.
+  save_interval="{{ .Forwarder.StatsCounters.SaveInterval }}"
+
+  # Downlink retry.
+  #
+  # When enabled, a downlink which is rejected by the gateway with one of the
+  # configured errors is re-attempted in the RX2 receive-window (1 second
+  # after the RX1 receive-window), using the RX2 frequency and data-rate. Only
+  # downlinks using delay timing (RX1) are retried. The acknowledgement of the
+  # retry is published instead of the acknowledgement of the rejected
+  # downlink, with itemIndex set to 1 when transmitted.
+  [forwarder.downlink_retry]
+  # Enable downlink retry.
+  enabled={{ .Forwarder.DownlinkRetry.Enabled }}
+
+  # Errors for which the downlink is retried. Valid options are TOO_LATE,
+  # TOO_EARLY, COLLISION_PACKET, COLLISION_BEACON, TX_FREQ, TX_POWER,
+  # GPS_UNLOCKED and CHANNEL_BUSY (requires [forwarder.lbt]).
+  errors=[{{ range $index, $elm := .Forwarder.DownlinkRetry.Errors }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+  # Region.
+  #
+  # The region defining the default RX2 frequency and data-rate.
+  region="{{ .Forwarder.DownlinkRetry.Region }}"
+
+  # RX2 frequency (Hz).
+  #
+  # When set to 0, the default RX2 frequency of the region is used.
+  rx2_frequency={{ .Forwarder.DownlinkRetry.RX2Frequency }}
+
+  # RX2 data-rate.
+  #
+  # When set to -1, the default RX2 data-rate of the region is used.
+  rx2_data_rate={{ .Forwarder.DownlinkRetry.RX2DataRate }}
+
+  # Fine-timestamp decryption.
+  #
+  # When an AES key is configured, the encrypted fine-timestamp of uplinks
+  # received by v2 gateways (e.g. SX1301 v2 / SX1303 based) is decrypted and
+  # published as plain fine-timestamp, such that geolocation services do not
+  # need the key. This requires the gateway to be GPS synchronized (the
+  # uplink time is required). Uplinks of gateways without key are published
+  # unmodified.
+  [forwarder.fine_timestamp]
+  # AES key (HEX encoded).
+  #
+  # The key used for gateways without per-gateway key below.
+  aes_key="{{ .Forwarder.FineTimestamp.AESKey }}"
+
+  # Per-gateway AES keys.
+  #
+  # Example:
+  # [[forwarder.fine_timestamp.gateways]]
+  # gateway_id="0102030405060708"
+  # aes_key="00000000000000000000000000000000"
+
+{{ range $i, $gw := .Forwarder.FineTimestamp.Gateways }}
+    [[forwarder.fine_timestamp.gateways]]
+    gateway_id="{{ $gw.GatewayID }}"
+    aes_key="{{ $gw.AESKey }}"
+{{ end }}
+
+  # Antenna gain.
+  #
+  # The TX power of a downlink is requested as EIRP. For gateways with one or
+  # multiple antennas of which the gain is not taken into account by the
+  # packet-forwarder, the gain (dBi, minus the cable loss) can be configured
+  # per antenna. The TX power sent to the concentrator is then the requested
+  # EIRP minus the gain of the antenna selected by the downlink (rounded to
+  # the nearest dBm). When the gateway_id is omitted, the gain applies to all
+  # gateways, a gain configured for a specific gateway takes precedence.
+  #
+  # Example:
+  # [[forwarder.antenna_gain]]
+  # antenna=1
+  # gain=6.0
+  #
+  # [[forwarder.antenna_gain]]
+  # gateway_id="0102030405060708"
+  # antenna=0
+  # gain=2.5
+{{ range $i, $ag := .Forwarder.AntennaGain }}
+  [[forwarder.antenna_gain]]
+  {{ if $ag.GatewayID }}gateway_id="{{ $ag.GatewayID }}"
+  {{ end }}antenna={{ $ag.Antenna }}
+  gain={{ $ag.Gain }}
+{{ end }}
+
 
 # Metrics configuration.
 [metrics]
@@ -387,6 +2438,189 @@ marshaler="{{ .Integration.Marshaler }}"
   # metrics endpoint.
   bind="{{ .Metrics.Prometheus.Bind }}"
 
+  # Per-gateway metrics.
+  #
+  # When enabled, the uplink, downlink, downlink ack and stats counters are
+  # exposed per gateway (using the gateway_id label). This also exposes the
+  # remaining duty-cycle airtime and the estimated clock-drift per gateway,
+  # when duty-cycle accounting and clock-drift compensation are enabled.
+  per_gateway={{ .Metrics.Prometheus.PerGateway }}
+
+  # Max. number of gateways.
+  #
+  # To limit the number of series, the per-gateway counters are exposed for
+  # max. this number of gateways. Other gateways are counted using the
+  # gateway_id="other" label. The series of gateways that disconnected are
+  # removed after 10 minutes.
+  max_gateways={{ .Metrics.Prometheus.MaxGateways }}
+
+  # RF metrics.
+  #
+  # When enabled, the forwarded uplinks are counted per modulation,
+  # spreading-factor, bandwidth and frequency, the forwarded downlinks per TX
+  # power and frequency, and the RSSI and SNR of the uplinks are exposed as
+  # histograms (per spreading-factor).
+  rf_metrics={{ .Metrics.Prometheus.RFMetrics }}
+
+  # SNMP agent.
+  #
+  # The read-only SNMPv2c agent exposes the bridge totals (under <oid_prefix>.1)
+  # and a gateway table (under <oid_prefix>.2.1) containing the uplink,
+  # downlink, downlink ack and stats counters, the connection state and the
+  # last-seen timestamp per gateway. See the metrics documentation for the
+  # OIDs.
+  [metrics.snmp]
+  # Enable the SNMP agent.
+  enabled={{ .Metrics.SNMP.Enabled }}
+
+  # The ip:port to bind the SNMP agent to (UDP).
+  bind="{{ .Metrics.SNMP.Bind }}"
+
+  # Community (read-only).
+  community="{{ .Metrics.SNMP.Community }}"
+
+  # OID prefix.
+  #
+  # The default uses the enterprise number reserved for documentation
+  # (RFC 5612). Replace it by an OID within the subtree of your organization.
+  oid_prefix="{{ .Metrics.SNMP.OIDPrefix }}"
+
+
+# Tracing configuration.
+#
+# When enabled, the uplink and downlink paths are traced and the spans are
+# exported to an OpenTelemetry collector using OTLP (HTTP, JSON encoding).
+# The uplink or downlink ID is used as trace ID and is added as attribute
+# (uplink_id or downlink_id), such that the latency can be measured per
+# uplink or downlink. The uplink traces contain the filters, hooks and
+# publish (per integration) spans, the downlink traces the hooks, backend
+# send and TX acknowledgement spans. The MQTT integration adds the marshal
+# and publish spans for the uplinks and starts the downlink trace when the
+# downlink is received.
+[tracing]
+# Enable tracing.
+enabled={{ .Tracing.Enabled }}
+
+# OTLP (HTTP) traces endpoint.
+endpoint="{{ .Tracing.Endpoint }}"
+
+# Service name.
+#
+# This is exported as the service.name resource attribute.
+service_name="{{ .Tracing.ServiceName }}"
+
+# Export interval.
+#
+# The spans are exported in batches at this interval (or when the batch
+# contains 512 spans). This is also used as timeout of the export request.
+export_interval="{{ .Tracing.ExportInterval }}"
+
+# Queue size.
+#
+# The max. number of spans which are queued for exporting. When the queue is
+# full (e.g. the collector is not available), spans are dropped.
+queue_size={{ .Tracing.QueueSize }}
+
+  # Headers.
+  #
+  # These headers are added to the export requests, e.g. for
+  # authentication. Example:
+  # Authorization="Bearer secret"
+  [tracing.headers]
+{{ range $k, $v := .Tracing.Headers }}  {{ $k }}="{{ $v }}"
+{{ end }}
+
+# Health configuration.
+#
+# The health server exposes the /health (liveness) and /ready (readiness)
+# endpoints, e.g. for Kubernetes probes. Both endpoints return the status of
+# the packet-forwarder connectivity (time of the last received event) and
+# the integration(s) (connection state and time of the last published event)
+# as JSON. The /ready endpoint returns 503 Service Unavailable when the
+# integration is not connected or (when configured) no packet-forwarder
+# event has been received within the backend timeout.
+[health]
+# Expose the health endpoints.
+endpoint_enabled={{ .Health.EndpointEnabled }}
+
+# The ip:port to bind the health server to.
+bind="{{ .Health.Bind }}"
+
+# Backend timeout.
+#
+# When set, the bridge is not ready when no packet-forwarder event (e.g. a
+# PULL_DATA or Concentratord event) has been received within this duration.
+# When set to 0, the packet-forwarder connectivity does not affect the
+# readiness.
+backend_timeout="{{ .Health.BackendTimeout }}"
+
+
+# Web interface configuration.
+#
+# The web interface is a read-only page for local diagnostics, showing the
+# live uplink and downlink frames, the backend and integration connection
+# status, the recent warnings and errors and the current configuration
+# (with passwords and secrets redacted).
+[web_ui]
+# Enable the web interface.
+enabled={{ .WebUI.Enabled }}
+
+# The ip:port to bind the web interface to.
+bind="{{ .WebUI.Bind }}"
+
+# Max. number of uplink frames, downlink frames and errors to show.
+max_frames={{ .WebUI.MaxFrames }}
+
+# HTTP basic authentication.
+#
+# When the username is set, the web interface requires HTTP basic
+# authentication with the given username and password.
+username="{{ .WebUI.Username }}"
+password="{{ .WebUI.Password }}"
+
+
+# Frame capture configuration.
+#
+# The frame capture writes the uplink and downlink frames and the downlink
+# TX acknowledgements (including the meta-data) as JSON lines to a rotating
+# on-disk ring buffer, for debugging RF issues after the fact. The frames are
+# written to frames.jsonl within the configured path. When this file contains
+# file_max_frames frames, it is rotated to frames.jsonl.1 and so on, keeping
+# max_files files (thus the last file_max_frames x max_files frames).
+#
+# The captured frames can be retrieved using the built-in capture_dump
+# gateway command, or locally using the capture-dump sub-command.
+[capture]
+# Path of the capture directory.
+#
+# When empty, the frame capture is disabled.
+path="{{ .Capture.Path }}"
+
+# Max. number of frames per file.
+file_max_frames={{ .Capture.FileMaxFrames }}
+
+# Max. number of files.
+max_files={{ .Capture.MaxFiles }}
+
+
+# Time synchronization.
+#
+# When enabled, the timesync requests of Basic Station gateways are answered
+# using the clock of the ChirpStack Gateway Bridge host (which must be
+# synchronized, e.g. using NTP). For Semtech UDP packet-forwarder gateways,
+# the offset between the gateway clock and the host clock is estimated and
+# added as timesync_offset_us to the gateway stats meta-data and (when using
+# the v4 api_version) to the uplink rxInfo metadata.
+[timesync]
+# Enable time synchronization.
+enabled={{ .TimeSync.Enabled }}
+
+# Estimation window.
+#
+# The offset estimate is based on the gateway time samples and round-trip
+# measurements received within this window.
+window="{{ .TimeSync.Window }}"
+
 
 # Gateway meta-data.
 #
@@ -431,6 +2665,65 @@ marshaler="{{ .Integration.Marshaler }}"
   {{ $k }}="{{ $v }}"
   {{ end }}
 
+
+  # GPS / GNSS location (gpsd).
+  #
+  # When enabled, the location of the gateway stats is set to the live location
+  # reported by gpsd, overriding the location reported by the packet-forwarder
+  # (e.g. the static location of the packet-forwarder configuration). The fix
+  # quality (none, 2d or 3d) is added to the meta-data as gps_fix. For a 2d
+  # fix, the altitude reported by the packet-forwarder is retained. Changes
+  # require a restart.
+  [meta_data.gpsd]
+
+  # Enable gpsd.
+  enabled={{ .MetaData.GPSD.Enabled }}
+
+  # gpsd server (hostname:port).
+  server="{{ .MetaData.GPSD.Server }}"
+
+  # Max. age of the gpsd report.
+  #
+  # When the last report received from gpsd is older than this duration, the
+  # location reported by the packet-forwarder is used. Set to 0 to disable.
+  max_age="{{ .MetaData.GPSD.MaxAge }}"
+
+
+  # System meta-data.
+  #
+  # When enabled, the system meta-data is read from /proc and sysfs (without
+  # executing external commands) in the dynamic meta-data execution interval.
+  # The following keys are added (prefixed by the configured prefix):
+  #
+  #   cpu_load_1, cpu_load_5, cpu_load_15:  load average (1, 5 and 15 min)
+  #   memory_total_kb, memory_available_kb: memory (kB)
+  #   memory_used_percent:                  used memory (%)
+  #   disk_total_kb, disk_free_kb:          disk space (kB)
+  #   disk_used_percent:                    used disk space (%)
+  #   temperature:                          SoC temperature (degree Celsius)
+  #
+  # In case the same key is defined as static or dynamic meta-data, the
+  # static or dynamic value has priority.
+  [meta_data.system]
+
+  # Enable system meta-data.
+  enabled={{ .MetaData.System.Enabled }}
+
+  # Key prefix.
+  prefix="{{ .MetaData.System.Prefix }}"
+
+  # Disk path.
+  #
+  # The disk space is reported for the filesystem containing this path.
+  # Set to an empty string to disable.
+  disk_path="{{ .MetaData.System.DiskPath }}"
+
+  # Temperature path.
+  #
+  # The sysfs file containing the SoC temperature in milli-degree Celsius.
+  # Set to an empty string to disable.
+  temperature_path="{{ .MetaData.System.TemperaturePath }}"
+
 # Executable commands.
 #
 # The configured commands can be triggered by sending a message to the
@@ -440,11 +2733,66 @@ marshaler="{{ .Integration.Marshaler }}"
   # [commands.commands.reboot]
   # max_execution_duration="1s"
   # command="/usr/bin/reboot"
+  #
+  # Streaming output.
+  #
+  # When stream is set to true, the stdout and stderr of the command are
+  # published in chunks while the command is running, e.g. to tail a log
+  # file. Each exec response contains a sequence number (seq) and the last
+  # response contains the end marker (last) and the error (if any). The
+  # buffered output is published when it exceeds stream_chunk_size (bytes,
+  # default 1024) or every stream_flush_interval (default 1s).
+  #
+  # Example:
+  # [commands.commands.tail_log]
+  # max_execution_duration="10m"
+  # command="tail -f /var/log/messages"
+  # stream=true
+  # stream_chunk_size=1024
+  # stream_flush_interval="1s"
+  #
+  # Arguments and sandboxing.
+  #
+  # The command can contain argument placeholders (e.g. {{"{{"}}.host{{"}}"}}), of
+  # which the values are taken from the environment of the exec request. Each
+  # argument must be defined (using a lowercase name) under arguments, with a
+  # regular expression which must match the complete value. Requests with a
+  # missing or invalid value are rejected. Each placeholder is rendered within
+  # a single argument, thus a value never results in additional arguments.
+  #
+  # The working_directory and environment variables (KEY=VALUE) are set for
+  # the executed command. When allowed_environment is set, requests containing
+  # other environment variables (besides the arguments) are rejected. When
+  # max_concurrent is greater than 0, executions exceeding this number of
+  # concurrent executions of the command are rejected.
+  #
+  # Example:
+  # [commands.commands.ping]
+  # max_execution_duration="10s"
+  # command="ping -c {{"{{"}}.count{{"}}"}} {{"{{"}}.host{{"}}"}}"
+  # working_directory="/tmp"
+  # environment=["LC_ALL=C"]
+  # allowed_environment=[]
+  # max_concurrent=1
+  #
+  #   [commands.commands.ping.arguments]
+  #   host='^[a-z0-9.-]+$'
+  #   count='^[1-9]$'
 {{ range $k, $v := .Commands.Commands }}
   [commands.commands.{{ $k }}]
   max_execution_duration="{{ $v.MaxExecutionDuration }}"
   command="{{ $v.Command }}"
-{{ end }}
+  stream={{ $v.Stream }}
+  stream_chunk_size={{ $v.StreamChunkSize }}
+  stream_flush_interval="{{ $v.StreamFlushInterval }}"
+  working_directory="{{ $v.WorkingDirectory }}"
+  environment=[{{ range $index, $elm := $v.Environment }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+  allowed_environment=[{{ range $index, $elm := $v.AllowedEnvironment }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+  max_concurrent={{ $v.MaxConcurrent }}
+
+    [commands.commands.{{ $k }}.arguments]
+{{ range $name, $re := $v.Arguments }}    {{ $name }}='{{ $re }}'
+{{ end }}{{ end }}
 `
 
 var configCmd = &cobra.Command{
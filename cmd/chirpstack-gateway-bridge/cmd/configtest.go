@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+var configTestCmd = &cobra.Command{
+	Use:           "configtest",
+	Short:         "Validate the ChirpStack Gateway Bridge configuration",
+	Long:          "Parse and validate the configuration, without starting the backend and integration(s).",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printReport(os.Stdout, config.C.Validate())
+	},
+}
+
+// printReport prints the pass / fail report of the given checks. It returns
+// an error when one or multiple checks failed.
+func printReport(w io.Writer, checks []config.Check) error {
+	var failed int
+	for _, check := range checks {
+		if check.Err != nil {
+			failed++
+			fmt.Fprintf(w, "[FAIL] %s: %s\n", check.Name, check.Err)
+		} else {
+			fmt.Fprintf(w, "[PASS] %s\n", check.Name)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d checks, %d failed\n", len(checks), failed)
+
+	if failed != 0 {
+		return errors.New("configuration test failed")
+	}
+
+	return nil
+}
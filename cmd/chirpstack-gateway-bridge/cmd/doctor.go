@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// probeTimeout defines the timeout of each live probe.
+var probeTimeout = 5 * time.Second
+
+var doctorCmd = &cobra.Command{
+	Use:           "doctor",
+	Short:         "Validate the configuration and probe the configured services",
+	Long:          "Validate the configuration (see configtest) and perform live probes against the MQTT broker, the Concentratord sockets and the UDP / TCP binds.",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checks := config.C.Validate()
+
+		// the probes are skipped when the configuration itself is invalid
+		if config.ValidationError(checks) == nil {
+			checks = append(checks, probe(config.C)...)
+		}
+
+		return printReport(os.Stdout, checks)
+	},
+}
+
+// probe performs the live probes for the given configuration.
+func probe(conf config.Config) []config.Check {
+	var checks []config.Check
+	add := func(name string, err error) {
+		checks = append(checks, config.Check{Name: name, Err: err})
+	}
+
+	switch conf.Backend.Type {
+	case "semtech_udp":
+		binds := conf.Backend.SemtechUDP.UDPBinds
+		if len(binds) == 0 {
+			binds = []string{conf.Backend.SemtechUDP.UDPBind}
+		}
+		if len(conf.Backend.SemtechUDP.Listeners) != 0 {
+			binds = nil
+			for _, l := range conf.Backend.SemtechUDP.Listeners {
+				binds = append(binds, l.Bind)
+			}
+		}
+		for _, bind := range binds {
+			add(fmt.Sprintf("udp bind %s", bind), probeUDPBind(bind))
+		}
+	case "basic_station":
+		add(fmt.Sprintf("tcp bind %s", conf.Backend.BasicStation.Bind), probeTCPBind(conf.Backend.BasicStation.Bind))
+	case "concentratord":
+		instances := conf.Backend.Concentratord.Instances
+		if len(instances) == 0 {
+			instances = []config.ConcentratordInstance{{
+				EventURL:   conf.Backend.Concentratord.EventURL,
+				CommandURL: conf.Backend.Concentratord.CommandURL,
+			}}
+		}
+		for _, i := range instances {
+			add(fmt.Sprintf("concentratord gateway_id request %s", i.CommandURL), probeConcentratord(i.CommandURL))
+		}
+	}
+
+	for _, server := range mqttServers(conf) {
+		add(fmt.Sprintf("mqtt broker connect %s", server), probeMQTTServer(conf, server))
+	}
+
+	return checks
+}
+
+// mqttServers returns the MQTT broker URLs for the configured
+// authentication type.
+func mqttServers(conf config.Config) []string {
+	auth := conf.Integration.MQTT.Auth
+
+	switch auth.Type {
+	case "generic":
+		return auth.Generic.Servers
+	case "gcp_cloud_iot_core":
+		return []string{auth.GCPCloudIoTCore.Server}
+	case "azure_iot_hub":
+		hostname := auth.AzureIoTHub.Hostname
+		for _, kv := range strings.Split(auth.AzureIoTHub.DeviceConnectionString, ";") {
+			if strings.HasPrefix(kv, "HostName=") {
+				hostname = strings.TrimPrefix(kv, "HostName=")
+			}
+		}
+		if hostname == "" {
+			return nil
+		}
+		return []string{fmt.Sprintf("ssl://%s:8883", hostname)}
+	case "aws_iot":
+		if auth.AWSIoT.Endpoint == "" {
+			return nil
+		}
+		return []string{fmt.Sprintf("wss://%s:443", auth.AWSIoT.Endpoint)}
+	default:
+		return nil
+	}
+}
+
+// probeMQTTServer opens a TCP (or TLS) connection to the given MQTT broker.
+func probeMQTTServer(conf config.Config, server string) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return errors.Wrap(err, "parse server url error")
+	}
+
+	var useTLS bool
+	var defaultPort string
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		defaultPort = "1883"
+	case "ssl", "tls", "tcps", "mqtts":
+		useTLS = true
+		defaultPort = "8883"
+	case "ws":
+		defaultPort = "80"
+	case "wss":
+		useTLS = true
+		defaultPort = "443"
+	default:
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	dialer := &net.Dialer{Timeout: probeTimeout}
+
+	if !useTLS {
+		conn, err := dialer.Dial("tcp", host)
+		if err != nil {
+			return errors.Wrap(err, "tcp connect error")
+		}
+		return conn.Close()
+	}
+
+	tlsConfig, err := probeTLSConfig(conf)
+	if err != nil {
+		return err
+	}
+	tlsConfig.ServerName = u.Hostname()
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	if err != nil {
+		return errors.Wrap(err, "tls connect error")
+	}
+	return conn.Close()
+}
+
+// probeTLSConfig returns the TLS configuration (CA and client certificate)
+// of the configured MQTT authentication type.
+func probeTLSConfig(conf config.Config) (*tls.Config, error) {
+	var caCert, tlsCert, tlsKey string
+	auth := conf.Integration.MQTT.Auth
+
+	switch auth.Type {
+	case "generic":
+		caCert, tlsCert, tlsKey = auth.Generic.CACert, auth.Generic.TLSCert, auth.Generic.TLSKey
+	case "azure_iot_hub":
+		tlsCert, tlsKey = auth.AzureIoTHub.TLSCert, auth.AzureIoTHub.TLSKey
+	case "aws_iot":
+		caCert = auth.AWSIoT.CACert
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if caCert != "" {
+		b, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, errors.Wrap(err, "load ca-cert error")
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(b) {
+			return nil, errors.New("ca-cert does not contain any valid certificate")
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	if tlsCert != "" && tlsKey != "" {
+		kp, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls key-pair error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{kp}
+	}
+
+	return tlsConfig, nil
+}
+
+// probeConcentratord requests the gateway ID from the Concentratord command
+// socket.
+func probeConcentratord(commandURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	errChan := make(chan error, 1)
+	go func() {
+		sock := zmq4.NewReq(ctx)
+		defer sock.Close()
+
+		if err := sock.Dial(commandURL); err != nil {
+			errChan <- errors.Wrap(err, "dial command api url error")
+			return
+		}
+
+		if err := sock.SendMulti(zmq4.NewMsgFrom([]byte("gateway_id"), nil)); err != nil {
+			errChan <- errors.Wrap(err, "send command request error")
+			return
+		}
+
+		reply, err := sock.Recv()
+		if err != nil {
+			errChan <- errors.Wrap(err, "receive command request reply error")
+			return
+		}
+
+		if len(reply.Bytes()) != 8 {
+			errChan <- fmt.Errorf("expected 8 byte gateway id, got %d bytes", len(reply.Bytes()))
+			return
+		}
+
+		errChan <- nil
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return errors.New("timeout waiting for gateway id")
+	}
+}
+
+// probeUDPBind checks that the given UDP address can be bound.
+func probeUDPBind(bind string) error {
+	conn, err := net.ListenPacket("udp", bind)
+	if err != nil {
+		return errors.Wrap(err, "udp bind error")
+	}
+	return conn.Close()
+}
+
+// probeTCPBind checks that the given TCP address can be bound.
+func probeTCPBind(bind string) error {
+	ln, err := net.Listen("tcp", bind)
+	if err != nil {
+		return errors.Wrap(err, "tcp bind error")
+	}
+	return ln.Close()
+}
@@ -1,32 +1,54 @@
 package cmd
 
 import (
+	"bytes"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"github.com/brocaar/chirpstack-gateway-bridge/hooks"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/capture"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/commands"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/filters"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/forwarder"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/logging"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/metadata"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/metrics"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/remoteconfig"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/standby"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/statscounters"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/tracing"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/webui"
 )
 
 func run(cmd *cobra.Command, args []string) error {
 
 	tasks := []func() error{
-		setLogLevel,
-		setSyslog,
+		setupLogging,
 		printStartMessage,
+		validateConfig,
 		setupFilters,
+		setupHooks,
+		setupHealth,
+		setupTracing,
+		setupWebUI,
+		setupCapture,
+		setupStatsCounters,
+		setupTimeSync,
 		setupBackend,
+		setupRemoteConfig,
+		setupStandby,
 		setupIntegration,
 		setupForwarder,
 		setupMetrics,
@@ -40,16 +62,108 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	log.WithField("signal", <-sigChan).Info("signal received")
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		log.WithField("signal", sig).Info("signal received")
+
+		if sig == syscall.SIGHUP {
+			if err := reloadConfig(); err != nil {
+				log.WithError(err).Error("reload configuration error")
+			}
+			continue
+		}
+
+		break
+	}
 	log.Warning("shutting down server")
 
+	if err := standby.Close(); err != nil {
+		log.WithError(err).Error("close standby error")
+	}
+
 	return nil
 }
 
-func setLogLevel() error {
-	log.SetLevel(log.Level(uint8(config.C.General.LogLevel)))
+// reloadMux serializes the configuration reloads, as these can be triggered
+// both by SIGHUP and by the remote configuration.
+var reloadMux sync.Mutex
+
+// reloadConfig re-reads the configuration file and applies the changes to
+// the filters, metadata, log level and integration (e.g. the MQTT topic
+// templates). Other changes require a restart. The backend (and thus the
+// packet-forwarder connections) is not affected by a reload.
+func reloadConfig() error {
+	reloadMux.Lock()
+	defer reloadMux.Unlock()
+
+	if err := readConfigFile(); err != nil {
+		return errors.Wrap(err, "read configuration file error")
+	}
+
+	conf, err := unmarshalConfig()
+	if err != nil {
+		return errors.Wrap(err, "unmarshal config error")
+	}
+
+	if err := config.ValidationError(conf.Validate()); err != nil {
+		return err
+	}
+
+	if err := filters.Setup(conf); err != nil {
+		return errors.Wrap(err, "setup filters error")
+	}
+
+	if err := metadata.Reload(conf); err != nil {
+		return errors.Wrap(err, "reload meta-data error")
+	}
+
+	if err := integration.Reload(conf); err != nil {
+		return errors.Wrap(err, "reload integration error")
+	}
+
+	webui.Reload(conf)
+
+	config.C = conf
+	if err := setupLogging(); err != nil {
+		return err
+	}
+
+	log.Info("configuration reloaded")
+
+	return nil
+}
+
+// validateRemoteConfig validates the configuration file content received by
+// the remote configuration. Viper is restored to the current configuration
+// file afterwards.
+func validateRemoteConfig(b []byte) error {
+	reloadMux.Lock()
+	defer reloadMux.Unlock()
+
+	defer func() {
+		if err := readConfigFile(); err != nil {
+			log.WithError(err).Error("read configuration file error")
+		}
+	}()
+
+	viper.SetConfigType("toml")
+	if err := viper.ReadConfig(bytes.NewBuffer(b)); err != nil {
+		return errors.Wrap(err, "read configuration error")
+	}
+
+	conf, err := unmarshalConfig()
+	if err != nil {
+		return errors.Wrap(err, "unmarshal config error")
+	}
+
+	return config.ValidationError(conf.Validate())
+}
+
+func setupLogging() error {
+	if err := logging.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup logging error")
+	}
 	return nil
 }
 
@@ -61,6 +175,10 @@ func printStartMessage() error {
 	return nil
 }
 
+func validateConfig() error {
+	return config.ValidationError(config.C.Validate())
+}
+
 func setupBackend() error {
 	if err := backend.Setup(config.C); err != nil {
 		return errors.Wrap(err, "setup backend error")
@@ -75,6 +193,13 @@ func setupIntegration() error {
 	return nil
 }
 
+func setupStandby() error {
+	if err := standby.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup standby error")
+	}
+	return nil
+}
+
 func setupForwarder() error {
 	if err := forwarder.Setup(config.C); err != nil {
 		return errors.Wrap(err, "setup forwarder error")
@@ -89,6 +214,60 @@ func setupMetrics() error {
 	return nil
 }
 
+func setupHealth() error {
+	if err := health.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup health error")
+	}
+	return nil
+}
+
+func setupTracing() error {
+	if err := tracing.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup tracing error")
+	}
+	return nil
+}
+
+func setupWebUI() error {
+	if err := webui.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup web ui error")
+	}
+	return nil
+}
+
+func setupCapture() error {
+	if err := capture.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup capture error")
+	}
+	return nil
+}
+
+func setupStatsCounters() error {
+	if err := statscounters.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup stats counters error")
+	}
+	return nil
+}
+
+func setupTimeSync() error {
+	if err := timesync.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup timesync error")
+	}
+	return nil
+}
+
+func setupRemoteConfig() error {
+	file := cfgFile
+	if file == "" {
+		file = viper.ConfigFileUsed()
+	}
+
+	if err := remoteconfig.Setup(config.C, file, validateRemoteConfig, reloadConfig); err != nil {
+		return errors.Wrap(err, "setup remote configuration error")
+	}
+	return nil
+}
+
 func setupMetaData() error {
 	if err := metadata.Setup(config.C); err != nil {
 		return errors.Wrap(err, "setup meta-data error")
@@ -109,3 +288,10 @@ func setupCommands() error {
 	}
 	return nil
 }
+
+func setupHooks() error {
+	if err := hooks.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup hooks error")
+	}
+	return nil
+}
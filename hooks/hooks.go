@@ -0,0 +1,149 @@
+// Package hooks provides an extension point for modifying or dropping events
+// before they are forwarded by the ChirpStack Gateway Bridge.
+//
+// Hooks can be registered by Go plugins (see the general.plugins
+// configuration option). A plugin must expose a Register function:
+//
+//	func Register(r hooks.Registry) {
+//	    r.RegisterUplinkHook(func(pl *gw.UplinkFrame) error {
+//	        return nil
+//	    })
+//	}
+//
+// This package is not internal, so that it can be imported by plugins.
+package hooks
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// ErrDrop can be returned by a hook to drop the event. The remaining hooks
+// will not be invoked.
+var ErrDrop = errors.New("hooks: drop event")
+
+// UplinkHook defines the uplink frame hook signature.
+type UplinkHook func(*gw.UplinkFrame) error
+
+// StatsHook defines the gateway stats hook signature.
+type StatsHook func(*gw.GatewayStats) error
+
+// DownlinkHook defines the downlink frame hook signature.
+type DownlinkHook func(*gw.DownlinkFrame) error
+
+// Registry defines the interface for registering hooks. This interface is
+// passed to the Register function of plugins.
+type Registry interface {
+	// RegisterUplinkHook registers the given uplink frame hook.
+	RegisterUplinkHook(UplinkHook)
+
+	// RegisterStatsHook registers the given gateway stats hook.
+	RegisterStatsHook(StatsHook)
+
+	// RegisterDownlinkHook registers the given downlink frame hook.
+	RegisterDownlinkHook(DownlinkHook)
+}
+
+// registry implements the Registry interface.
+type registry struct {
+	sync.RWMutex
+
+	uplinkHooks   []UplinkHook
+	statsHooks    []StatsHook
+	downlinkHooks []DownlinkHook
+}
+
+var reg registry
+
+// RegisterUplinkHook registers the given uplink frame hook.
+func RegisterUplinkHook(h UplinkHook) {
+	reg.RegisterUplinkHook(h)
+}
+
+// RegisterStatsHook registers the given gateway stats hook.
+func RegisterStatsHook(h StatsHook) {
+	reg.RegisterStatsHook(h)
+}
+
+// RegisterDownlinkHook registers the given downlink frame hook.
+func RegisterDownlinkHook(h DownlinkHook) {
+	reg.RegisterDownlinkHook(h)
+}
+
+// RunUplinkHooks invokes the registered uplink frame hooks in registration
+// order. It returns the first error returned by a hook (e.g. ErrDrop).
+func RunUplinkHooks(pl *gw.UplinkFrame) error {
+	return reg.runUplinkHooks(pl)
+}
+
+// RunStatsHooks invokes the registered gateway stats hooks in registration
+// order. It returns the first error returned by a hook (e.g. ErrDrop).
+func RunStatsHooks(pl *gw.GatewayStats) error {
+	return reg.runStatsHooks(pl)
+}
+
+// RunDownlinkHooks invokes the registered downlink frame hooks in
+// registration order. It returns the first error returned by a hook
+// (e.g. ErrDrop).
+func RunDownlinkHooks(pl *gw.DownlinkFrame) error {
+	return reg.runDownlinkHooks(pl)
+}
+
+func (r *registry) RegisterUplinkHook(h UplinkHook) {
+	r.Lock()
+	defer r.Unlock()
+	r.uplinkHooks = append(r.uplinkHooks, h)
+}
+
+func (r *registry) RegisterStatsHook(h StatsHook) {
+	r.Lock()
+	defer r.Unlock()
+	r.statsHooks = append(r.statsHooks, h)
+}
+
+func (r *registry) RegisterDownlinkHook(h DownlinkHook) {
+	r.Lock()
+	defer r.Unlock()
+	r.downlinkHooks = append(r.downlinkHooks, h)
+}
+
+func (r *registry) runUplinkHooks(pl *gw.UplinkFrame) error {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, h := range r.uplinkHooks {
+		if err := h(pl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *registry) runStatsHooks(pl *gw.GatewayStats) error {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, h := range r.statsHooks {
+		if err := h(pl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *registry) runDownlinkHooks(pl *gw.DownlinkFrame) error {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, h := range r.downlinkHooks {
+		if err := h(pl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
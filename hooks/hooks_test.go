@@ -0,0 +1,140 @@
+package hooks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestUplinkHooks(t *testing.T) {
+	testErr := errors.New("test error")
+
+	tests := []struct {
+		Name          string
+		Hooks         []UplinkHook
+		ExpectedError error
+		ExpectedCalls []int
+	}{
+		{
+			Name:          "no hooks",
+			ExpectedCalls: nil,
+		},
+		{
+			Name: "hooks are invoked in registration order",
+			Hooks: []UplinkHook{
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 1); return nil },
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 2); return nil },
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 3); return nil },
+			},
+			ExpectedCalls: []int{1, 2, 3},
+		},
+		{
+			Name: "drop stops the chain",
+			Hooks: []UplinkHook{
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 1); return ErrDrop },
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 2); return nil },
+			},
+			ExpectedError: ErrDrop,
+			ExpectedCalls: []int{1},
+		},
+		{
+			Name: "error is returned",
+			Hooks: []UplinkHook{
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 1); return nil },
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 2); return testErr },
+				func(pl *gw.UplinkFrame) error { pl.PhyPayload = append(pl.PhyPayload, 3); return nil },
+			},
+			ExpectedError: testErr,
+			ExpectedCalls: []int{1, 2},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var r registry
+			for _, h := range tst.Hooks {
+				r.RegisterUplinkHook(h)
+			}
+
+			var pl gw.UplinkFrame
+			assert.Equal(tst.ExpectedError, r.runUplinkHooks(&pl))
+
+			var calls []int
+			for _, b := range pl.PhyPayload {
+				calls = append(calls, int(b))
+			}
+			assert.Equal(tst.ExpectedCalls, calls)
+		})
+	}
+}
+
+func TestStatsHooks(t *testing.T) {
+	assert := require.New(t)
+
+	var r registry
+	r.RegisterStatsHook(func(pl *gw.GatewayStats) error {
+		pl.MetaData = map[string]string{"site": "a"}
+		return nil
+	})
+	r.RegisterStatsHook(func(pl *gw.GatewayStats) error {
+		if pl.MetaData["site"] == "a" {
+			return ErrDrop
+		}
+		return nil
+	})
+
+	var pl gw.GatewayStats
+	assert.Equal(ErrDrop, r.runStatsHooks(&pl))
+	assert.Equal(map[string]string{"site": "a"}, pl.MetaData)
+}
+
+func TestDownlinkHooks(t *testing.T) {
+	assert := require.New(t)
+
+	var r registry
+	r.RegisterDownlinkHook(func(pl *gw.DownlinkFrame) error {
+		pl.Token = 123
+		return nil
+	})
+
+	var pl gw.DownlinkFrame
+	assert.NoError(r.runDownlinkHooks(&pl))
+	assert.EqualValues(123, pl.Token)
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	t.Run("valid symbol", func(t *testing.T) {
+		assert := require.New(t)
+
+		var r registry
+		var register func(Registry) = func(r Registry) {
+			r.RegisterUplinkHook(func(*gw.UplinkFrame) error { return ErrDrop })
+		}
+
+		assert.NoError(registerPlugin(&r, register))
+		assert.Len(r.uplinkHooks, 1)
+	})
+
+	t.Run("invalid symbol", func(t *testing.T) {
+		assert := require.New(t)
+
+		var r registry
+		register := func() {}
+
+		err := registerPlugin(&r, register)
+		assert.Error(err)
+		assert.Equal("expected Register symbol of type func(hooks.Registry), got: func() (the plugin ABI does not match)", err.Error())
+	})
+
+	t.Run("plugin does not exist", func(t *testing.T) {
+		assert := require.New(t)
+
+		var r registry
+		assert.Error(loadPlugin(&r, "/does/not/exist.so"))
+	})
+}
@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// registerSymbol defines the symbol that a plugin must expose.
+const registerSymbol = "Register"
+
+// Setup loads the configured plugins and registers the uplink script hook
+// (when configured).
+func Setup(conf config.Config) error {
+	for _, path := range conf.General.Plugins {
+		if err := loadPlugin(&reg, path); err != nil {
+			return errors.Wrapf(err, "load plugin %s error", path)
+		}
+
+		log.WithField("plugin", path).Info("hooks: plugin loaded")
+	}
+
+	if conf.Hooks.UplinkScript.Path != "" {
+		h := newScriptHook(conf)
+		reg.RegisterUplinkHook(h.uplinkHook)
+
+		log.WithField("script", h.path).Info("hooks: uplink script hook registered")
+	}
+
+	return nil
+}
+
+func loadPlugin(r Registry, path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open plugin error (make sure the plugin was built with the same Go version and dependency versions as ChirpStack Gateway Bridge)")
+	}
+
+	sym, err := p.Lookup(registerSymbol)
+	if err != nil {
+		return errors.Wrap(err, "lookup Register symbol error")
+	}
+
+	return registerPlugin(r, sym)
+}
+
+// registerPlugin calls the Register function of the plugin, given the
+// looked-up symbol.
+func registerPlugin(r Registry, sym plugin.Symbol) error {
+	register, ok := sym.(func(Registry))
+	if !ok {
+		return fmt.Errorf("expected Register symbol of type func(hooks.Registry), got: %T (the plugin ABI does not match)", sym)
+	}
+
+	register(r)
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
+)
+
+// marshalJSON and unmarshalJSON (un)marshal the uplink frames written to and
+// read from the script. These are wrapped such that the LR-FHSS modulation
+// info is included.
+var marshalJSON, unmarshalJSON = lrfhss.Wrap(
+	func(msg proto.Message) ([]byte, error) {
+		marshaler := jsonpb.Marshaler{EmitDefaults: true}
+		str, err := marshaler.MarshalToString(msg)
+		return []byte(str), err
+	},
+	func(b []byte, msg proto.Message) error {
+		unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		return unmarshaler.Unmarshal(bytes.NewReader(b), msg)
+	},
+)
+
+// scriptHook implements an uplink hook using an external script. The script
+// is started once and kept running (it is restarted after it exited or
+// timed out). For each uplink, the JSON encoded uplink frame is written as a
+// single line to the stdin of the script. The script must reply with a
+// single line on stdout, containing the (modified) JSON encoded uplink
+// frame, or an empty line (or null) to drop the uplink.
+//
+// As this is interpreter agnostic, scripts can be written in any language
+// (e.g. Lua using a #!/usr/bin/env lua shebang).
+type scriptHook struct {
+	sync.Mutex
+
+	path        string
+	args        []string
+	timeout     time.Duration
+	dropOnError bool
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+}
+
+func newScriptHook(conf config.Config) *scriptHook {
+	return &scriptHook{
+		path:        conf.Hooks.UplinkScript.Path,
+		args:        conf.Hooks.UplinkScript.Args,
+		timeout:     conf.Hooks.UplinkScript.Timeout,
+		dropOnError: conf.Hooks.UplinkScript.DropOnError,
+	}
+}
+
+// uplinkHook implements the UplinkHook.
+func (h *scriptHook) uplinkHook(pl *gw.UplinkFrame) error {
+	err := h.run(pl)
+	if err == nil || err == ErrDrop {
+		return err
+	}
+
+	if h.dropOnError {
+		return errors.Wrap(err, "uplink script error")
+	}
+
+	// the uplink is forwarded unmodified
+	log.WithError(err).WithField("script", h.path).Error("hooks: uplink script error, forwarding unmodified uplink")
+	return nil
+}
+
+func (h *scriptHook) run(pl *gw.UplinkFrame) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.cmd == nil {
+		if err := h.start(); err != nil {
+			return errors.Wrap(err, "start script error")
+		}
+	}
+
+	b, err := marshalJSON(pl)
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	if _, err := io.WriteString(h.stdin, string(b)+"\n"); err != nil {
+		h.stop()
+		return errors.Wrap(err, "write to script error")
+	}
+
+	var line []byte
+	var ok bool
+	select {
+	case line, ok = <-h.lines:
+		if !ok {
+			h.stop()
+			return errors.New("script exited")
+		}
+	case <-time.After(h.timeout):
+		h.stop()
+		return errors.New("script timeout")
+	}
+
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || string(line) == "null" {
+		return ErrDrop
+	}
+
+	var out gw.UplinkFrame
+	if err := unmarshalJSON(line, &out); err != nil {
+		return errors.Wrap(err, "unmarshal json error")
+	}
+	*pl = out
+
+	return nil
+}
+
+// start starts the script. The lines written by the script to stdout are
+// sent to the lines channel, which is closed when the script exits.
+func (h *scriptHook) start() error {
+	cmd := exec.Command(h.path, h.args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return errors.Wrap(err, "get stdin pipe error")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "get stdout pipe error")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrap(err, "get stderr pipe error")
+	}
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "execute script error")
+	}
+
+	log.WithFields(log.Fields{
+		"script": h.path,
+		"pid":    cmd.Process.Pid,
+	}).Info("hooks: uplink script started")
+
+	lines := make(chan []byte)
+	go func() {
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				close(lines)
+				cmd.Wait()
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	go func() {
+		s := bufio.NewScanner(stderr)
+		for s.Scan() {
+			log.WithField("script", h.path).Warning("hooks: uplink script stderr: " + s.Text())
+		}
+	}()
+
+	h.cmd = cmd
+	h.stdin = stdin
+	h.lines = lines
+
+	return nil
+}
+
+// stop kills the script. It is restarted on the next uplink.
+func (h *scriptHook) stop() {
+	if h.cmd == nil {
+		return
+	}
+
+	h.stdin.Close()
+	h.cmd.Process.Kill()
+
+	// drain, such that the reader goroutine can exit
+	go func(lines chan []byte) {
+		for range lines {
+		}
+	}(h.lines)
+
+	h.cmd = nil
+	h.stdin = nil
+	h.lines = nil
+}
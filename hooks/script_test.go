@@ -0,0 +1,89 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestScriptHook(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		Name           string
+		Script         string
+		DropOnError    bool
+		ExpectedError  error
+		ExpectError    bool
+		ExpectedUplink gw.UplinkFrame
+	}{
+		{
+			Name:   "modify",
+			Script: `while read -r line; do echo "$line" | sed 's/"rssi":-60/"rssi":-50/'; done`,
+			ExpectedUplink: gw.UplinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				RxInfo:     &gw.UplinkRXInfo{Rssi: -50},
+			},
+		},
+		{
+			Name:          "drop",
+			Script:        `while read -r line; do echo ""; done`,
+			ExpectedError: ErrDrop,
+		},
+		{
+			Name:   "timeout forwards unmodified",
+			Script: `sleep 10`,
+			ExpectedUplink: gw.UplinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				RxInfo:     &gw.UplinkRXInfo{Rssi: -60},
+			},
+		},
+		{
+			Name:        "exit with drop on error",
+			Script:      `exit 1`,
+			DropOnError: true,
+			ExpectError: true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			path := filepath.Join(tempDir, tst.Name)
+			assert.NoError(ioutil.WriteFile(path, []byte("#!/bin/sh\n"+tst.Script+"\n"), 0755))
+
+			var conf config.Config
+			conf.Hooks.UplinkScript.Path = path
+			conf.Hooks.UplinkScript.Timeout = 200 * time.Millisecond
+			conf.Hooks.UplinkScript.DropOnError = tst.DropOnError
+			h := newScriptHook(conf)
+			defer h.stop()
+
+			pl := gw.UplinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				RxInfo:     &gw.UplinkRXInfo{Rssi: -60},
+			}
+			err := h.uplinkHook(&pl)
+			if tst.ExpectError {
+				assert.Error(err)
+				return
+			}
+
+			assert.Equal(tst.ExpectedError, err)
+			if err == nil {
+				assert.Equal(tst.ExpectedUplink.PhyPayload, pl.PhyPayload)
+				assert.Equal(tst.ExpectedUplink.RxInfo.Rssi, pl.RxInfo.Rssi)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package airtime provides functions for calculating the time on air of
+// LoRa and FSK modulated frames.
+//
+// The LoRa formula is defined by the Semtech SX1272/3/6/7/8 LoRa Modem
+// Designer's Guide (AN1200.13).
+package airtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/ism2400"
+)
+
+// CodingRate defines the LoRa coding-rate.
+type CodingRate int
+
+// Available coding-rates.
+const (
+	CodingRate45 CodingRate = 1
+	CodingRate46 CodingRate = 2
+	CodingRate47 CodingRate = 3
+	CodingRate48 CodingRate = 4
+)
+
+// LoRaWAN defaults.
+const (
+	// LoRaPreambleNumber defines the LoRa preamble length (symbols).
+	LoRaPreambleNumber = 8
+
+	// FSKPreambleBytes defines the FSK preamble length (bytes).
+	FSKPreambleBytes = 5
+
+	// FSKSyncWordBytes defines the FSK sync-word length (bytes).
+	FSKSyncWordBytes = 3
+)
+
+// ParseCodingRate parses the coding-rate string (e.g. "4/5"). The
+// long-interleaving coding-rates of the LoRa 2.4 GHz modulation (e.g.
+// "4/8LI") have the same coding overhead as the corresponding coding-rate,
+// and are therefore parsed as such.
+func ParseCodingRate(s string) (CodingRate, error) {
+	switch s {
+	case "4/5", "4/5LI":
+		return CodingRate45, nil
+	case "4/6", "4/6LI":
+		return CodingRate46, nil
+	case "4/7":
+		return CodingRate47, nil
+	case "4/8", "4/8LI":
+		return CodingRate48, nil
+	default:
+		return 0, fmt.Errorf("invalid coding-rate: %s", s)
+	}
+}
+
+// LowDataRateOptimization returns if the low data-rate optimization must be
+// enabled for the given spreading-factor and bandwidth (kHz). This is
+// mandated when the symbol duration exceeds 16ms.
+func LowDataRateOptimization(sf, bandwidth int) bool {
+	return LoRaSymbolDuration(sf, bandwidth) > 16*time.Millisecond
+}
+
+// LoRaSymbolDuration returns the LoRa symbol duration for the given
+// spreading-factor and bandwidth (kHz). The (truncated) LoRa 2.4 GHz
+// bandwidths (e.g. 812 kHz) are converted to the exact bandwidth.
+func LoRaSymbolDuration(sf, bandwidth int) time.Duration {
+	hz := int64(ism2400.BandwidthHz(uint32(bandwidth)))
+	return time.Duration(int64(1<<uint(sf))*int64(time.Second)/hz) * time.Nanosecond
+}
+
+// LoRaPayloadSymbolNumber returns the number of symbols of the header and
+// payload of a LoRa frame.
+func LoRaPayloadSymbolNumber(payloadSize, sf int, codingRate CodingRate, headerEnabled, crcEnabled, lowDataRateOptimization bool) (int, error) {
+	if codingRate < CodingRate45 || codingRate > CodingRate48 {
+		return 0, errors.New("coding-rate must be between 1 - 4")
+	}
+
+	var h, de, crc float64
+	if !headerEnabled {
+		h = 1
+	}
+	if lowDataRateOptimization {
+		de = 1
+	}
+	if crcEnabled {
+		crc = 1
+	}
+
+	a := 8*float64(payloadSize) - 4*float64(sf) + 28 + 16*crc - 20*h
+	b := 4 * (float64(sf) - 2*de)
+	c := float64(codingRate) + 4
+
+	return int(8 + math.Max(math.Ceil(a/b)*c, 0)), nil
+}
+
+// LoRaAirtime returns the time on air of a LoRa frame. The bandwidth must
+// be given in kHz.
+func LoRaAirtime(payloadSize, sf, bandwidth, preambleNumber int, codingRate CodingRate, headerEnabled, crcEnabled, lowDataRateOptimization bool) (time.Duration, error) {
+	if sf < 5 || sf > 12 {
+		return 0, fmt.Errorf("invalid spreading-factor: %d", sf)
+	}
+	if bandwidth <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth: %d", bandwidth)
+	}
+
+	symbolDuration := LoRaSymbolDuration(sf, bandwidth)
+	preambleDuration := time.Duration(100*preambleNumber+425) * symbolDuration / 100
+
+	payloadSymbolNumber, err := LoRaPayloadSymbolNumber(payloadSize, sf, codingRate, headerEnabled, crcEnabled, lowDataRateOptimization)
+	if err != nil {
+		return 0, err
+	}
+
+	return preambleDuration + time.Duration(payloadSymbolNumber)*symbolDuration, nil
+}
+
+// FSKAirtime returns the time on air of a FSK frame, using the LoRaWAN
+// frame format (preamble, sync-word, length byte, payload and CRC). The
+// datarate must be given in bits / second.
+func FSKAirtime(payloadSize, datarate, preambleBytes, syncWordBytes int, crcEnabled bool) (time.Duration, error) {
+	if datarate <= 0 {
+		return 0, fmt.Errorf("invalid datarate: %d", datarate)
+	}
+
+	bytes := preambleBytes + syncWordBytes + 1 + payloadSize
+	if crcEnabled {
+		bytes += 2
+	}
+
+	return time.Duration(int64(bytes) * 8 * int64(time.Second) / int64(datarate)), nil
+}
+
+// DownlinkAirtime returns the time on air of the given downlink frame.
+// LoRaWAN downlinks are sent using an explicit header and without CRC.
+func DownlinkAirtime(downlinkFrame *gw.DownlinkFrame) (time.Duration, error) {
+	txInfo := downlinkFrame.GetTxInfo()
+	size := len(downlinkFrame.GetPhyPayload())
+
+	switch txInfo.GetModulation() {
+	case common.Modulation_LORA:
+		modInfo := txInfo.GetLoraModulationInfo()
+		if modInfo == nil {
+			return 0, errors.New("lora_modulation_info must not be nil")
+		}
+
+		cr, err := ParseCodingRate(modInfo.GetCodeRate())
+		if err != nil {
+			return 0, err
+		}
+
+		sf := int(modInfo.GetSpreadingFactor())
+		bw := int(modInfo.GetBandwidth())
+
+		return LoRaAirtime(size, sf, bw, LoRaPreambleNumber, cr, true, false, LowDataRateOptimization(sf, bw))
+	case common.Modulation_FSK:
+		modInfo := txInfo.GetFskModulationInfo()
+		if modInfo == nil {
+			return 0, errors.New("fsk_modulation_info must not be nil")
+		}
+
+		return FSKAirtime(size, int(modInfo.GetDatarate()), FSKPreambleBytes, FSKSyncWordBytes, true)
+	default:
+		return 0, fmt.Errorf("unsupported modulation: %s", txInfo.GetModulation())
+	}
+}
@@ -0,0 +1,78 @@
+package airtime
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoRaAirtime(t *testing.T) {
+	// The expected values have been validated using the Semtech LoRa
+	// calculator (preamble 8, explicit header).
+	tests := []struct {
+		PayloadSize      int
+		SF               int
+		Bandwidth        int
+		CodingRate       CodingRate
+		CRC              bool
+		ExpectedLDRO     bool
+		ExpectedDuration time.Duration
+	}{
+		{13, 7, 125, CodingRate45, true, false, 46336 * time.Microsecond},
+		{51, 7, 125, CodingRate45, true, false, 102656 * time.Microsecond},
+		{13, 9, 125, CodingRate45, true, false, 164864 * time.Microsecond},
+		{13, 12, 125, CodingRate45, true, true, 1155072 * time.Microsecond},
+		{51, 12, 125, CodingRate45, true, true, 2465792 * time.Microsecond},
+		{51, 12, 125, CodingRate45, false, true, 2301952 * time.Microsecond},
+		{13, 12, 500, CodingRate45, false, false, 247808 * time.Microsecond},
+		{13, 7, 250, CodingRate48, true, false, 30848 * time.Microsecond},
+
+		// LoRa 2.4 GHz (812.5 kHz)
+		{13, 12, 812, CodingRate45, true, false, 177703357 * time.Nanosecond},
+	}
+
+	for _, tst := range tests {
+		t.Run(fmt.Sprintf("SF%d BW%d PL%d CR%d CRC %t", tst.SF, tst.Bandwidth, tst.PayloadSize, tst.CodingRate, tst.CRC), func(t *testing.T) {
+			assert := require.New(t)
+
+			ldro := LowDataRateOptimization(tst.SF, tst.Bandwidth)
+			assert.Equal(tst.ExpectedLDRO, ldro)
+
+			d, err := LoRaAirtime(tst.PayloadSize, tst.SF, tst.Bandwidth, LoRaPreambleNumber, tst.CodingRate, true, tst.CRC, ldro)
+			assert.NoError(err)
+			assert.Equal(tst.ExpectedDuration, d)
+		})
+	}
+
+	t.Run("invalid coding-rate", func(t *testing.T) {
+		assert := require.New(t)
+		_, err := LoRaAirtime(13, 7, 125, LoRaPreambleNumber, 5, true, true, false)
+		assert.Error(err)
+	})
+}
+
+func TestFSKAirtime(t *testing.T) {
+	assert := require.New(t)
+
+	// (5 + 3 + 1 + 13 + 2) bytes * 8 / 50000
+	d, err := FSKAirtime(13, 50000, FSKPreambleBytes, FSKSyncWordBytes, true)
+	assert.NoError(err)
+	assert.Equal(3840*time.Microsecond, d)
+}
+
+func TestParseCodingRate(t *testing.T) {
+	assert := require.New(t)
+
+	cr, err := ParseCodingRate("4/6")
+	assert.NoError(err)
+	assert.Equal(CodingRate46, cr)
+
+	cr, err = ParseCodingRate("4/8LI")
+	assert.NoError(err)
+	assert.Equal(CodingRate48, cr)
+
+	_, err = ParseCodingRate("5/4")
+	assert.Error(err)
+}
@@ -0,0 +1,181 @@
+// Package awsauth implements the AWS credential providers and the AWS
+// Signature Version 4 signing of requests, as used by the AWS integrations.
+package awsauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AWS credential sources.
+const (
+	credentialSourceStatic = "static"
+	credentialSourceEnv    = "env"
+	credentialSourceEC2    = "ec2"
+	credentialSourceECS    = "ecs"
+)
+
+// AWS metadata endpoints. These are variables so that they can be
+// overwritten by the tests.
+var (
+	ec2MetadataURL = "http://169.254.169.254"
+	ecsMetadataURL = "http://169.254.170.2"
+)
+
+// Credentials contains the AWS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expiration is zero for credentials that do not expire.
+	Expiration time.Time
+}
+
+// CredentialsProvider returns the AWS credentials.
+type CredentialsProvider func() (Credentials, error)
+
+// NewCredentialsProvider returns the credentials provider for the given
+// credential source.
+func NewCredentialsProvider(source string, static Credentials) (CredentialsProvider, error) {
+	switch source {
+	case credentialSourceStatic:
+		return func() (Credentials, error) {
+			return static, nil
+		}, nil
+	case credentialSourceEnv:
+		return getEnvCredentials, nil
+	case credentialSourceEC2:
+		return getEC2Credentials, nil
+	case credentialSourceECS:
+		return getECSCredentials, nil
+	default:
+		return nil, fmt.Errorf("unknown credential source: %s", source)
+	}
+}
+
+func getEnvCredentials() (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	return creds, nil
+}
+
+// metadataCredentials contains the credentials as returned by the EC2 and
+// ECS metadata endpoints.
+type metadataCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// getEC2Credentials returns the credentials of the instance profile
+// using the EC2 instance metadata service (IMDSv2).
+func getEC2Credentials() (Credentials, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+
+	req, err := http.NewRequest(http.MethodPut, ec2MetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "new request error")
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+
+	token, err := doMetadataRequest(&client, req)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "get metadata token error")
+	}
+
+	req, err = http.NewRequest(http.MethodGet, ec2MetadataURL+"/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "new request error")
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+
+	role, err := doMetadataRequest(&client, req)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "get instance role error")
+	}
+
+	req, err = http.NewRequest(http.MethodGet, ec2MetadataURL+"/latest/meta-data/iam/security-credentials/"+strings.TrimSpace(string(role)), nil)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "new request error")
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+
+	return getMetadataCredentials(&client, req)
+}
+
+// getECSCredentials returns the credentials of the ECS task role.
+func getECSCredentials() (Credentials, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+
+	u := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		u = ecsMetadataURL + relative
+	}
+	if u == "" {
+		return Credentials{}, errors.New("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI must be set")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "new request error")
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	return getMetadataCredentials(&client, req)
+}
+
+func getMetadataCredentials(client *http.Client, req *http.Request) (Credentials, error) {
+	b, err := doMetadataRequest(client, req)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "get credentials error")
+	}
+
+	var creds metadataCredentials
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return Credentials{}, errors.Wrap(err, "unmarshal credentials error")
+	}
+
+	return Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Expiration:      creds.Expiration,
+	}, nil
+}
+
+func doMetadataRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read body error")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("expected 200, got: %d (%s)", resp.StatusCode, string(b))
+	}
+
+	return b, nil
+}
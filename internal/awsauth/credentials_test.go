@@ -0,0 +1,49 @@
+package awsauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestECSCredentials(t *testing.T) {
+	assert := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/credentials/1234" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"AccessKeyId":"AKID","SecretAccessKey":"secret","Token":"token","Expiration":"2020-05-01T12:00:00Z"}`))
+	}))
+	defer server.Close()
+
+	oldURL := ecsMetadataURL
+	ecsMetadataURL = server.URL
+	defer func() {
+		ecsMetadataURL = oldURL
+	}()
+
+	oldURI, ok := os.LookupEnv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	assert.NoError(os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/1234"))
+	defer func() {
+		if ok {
+			os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", oldURI)
+		} else {
+			os.Unsetenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+		}
+	}()
+
+	creds, err := getECSCredentials()
+	assert.NoError(err)
+	assert.Equal(Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+	}, creds)
+}
@@ -9,11 +9,15 @@ import (
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/basicstation"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/concentratord"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/multitech"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/simulator"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
 )
 
 var backend Backend
+var gatewayIDs *gatewayIDMapper
 
 // Setup configures the backend.
 func Setup(conf config.Config) error {
@@ -26,6 +30,10 @@ func Setup(conf config.Config) error {
 		backend, err = basicstation.NewBackend(conf)
 	case "concentratord":
 		backend, err = concentratord.NewBackend(conf)
+	case "multitech":
+		backend, err = multitech.NewBackend(conf)
+	case "simulator":
+		backend, err = simulator.NewBackend(conf)
 	default:
 		return fmt.Errorf("unknown backend type: %s", conf.Backend.Type)
 	}
@@ -34,6 +42,24 @@ func Setup(conf config.Config) error {
 		return errors.Wrap(err, "new backend error")
 	}
 
+	gatewayIDs = nil
+	if len(conf.Backend.GatewayIDMapping) != 0 {
+		gatewayIDs, err = newGatewayIDMapper(backend, conf)
+		if err != nil {
+			return errors.Wrap(err, "new gateway ID mapper error")
+		}
+		backend = gatewayIDs
+	}
+
+	backend = newConnStateTracker(backend, conf)
+
+	if conf.Backend.Scheduler.Enabled {
+		backend, err = newScheduler(backend, conf)
+		if err != nil {
+			return errors.Wrap(err, "new scheduler error")
+		}
+	}
+
 	return nil
 }
 
@@ -42,6 +68,35 @@ func GetBackend() Backend {
 	return backend
 }
 
+// PurgeCommand is the name of the built-in gateway command which purges the
+// queued downlinks of the gateway.
+const PurgeCommand = "purge_downlinks"
+
+// PurgeDownlinks removes the downlinks of the given gateway which are queued
+// by the downlink scheduler. It returns the number of removed downlinks. The
+// downlinks which have already been sent to the packet-forwarder can not be
+// purged.
+func PurgeDownlinks(gatewayID lorawan.EUI64) int {
+	if s, ok := backend.(*scheduler); ok {
+		return s.purge(gatewayID)
+	}
+	return 0
+}
+
+// MappedGatewayIDs returns the gateway IDs to which the given gateway ID, as
+// reported by the backend, is mapped. This includes the board gateway IDs.
+// It returns the given gateway ID when it is not mapped.
+func MappedGatewayIDs(gatewayID lorawan.EUI64) []lorawan.EUI64 {
+	if gatewayIDs == nil {
+		return []lorawan.EUI64{gatewayID}
+	}
+
+	if lg, ok := gatewayIDs.logical[gatewayID]; ok {
+		return append([]lorawan.EUI64{lg.gatewayID}, lg.boards...)
+	}
+	return []lorawan.EUI64{gatewayID}
+}
+
 // Backend defines the interface that a backend must implement
 type Backend interface {
 	// Close closes the backend.
@@ -59,6 +114,9 @@ type Backend interface {
 	// GetRawPacketForwarderEventChan returns the raw packet-forwarder command channel.
 	GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEvent
 
+	// GetLogEventChan returns the channel for gateway log events.
+	GetLogEventChan() chan events.Log
+
 	// GetSubscribeEventChan returns the channel for the (un)subscribe events.
 	GetSubscribeEventChan() chan events.Subscribe
 
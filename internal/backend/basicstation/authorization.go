@@ -0,0 +1,192 @@
+package basicstation
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/lorawan"
+)
+
+// Authorization endpoints.
+const (
+	endpointRouterInfo = "router-info"
+	endpointGateway    = "gateway"
+)
+
+// authorizationEntry contains a single entry of the allow-list file.
+type authorizationEntry struct {
+	EUI   string `json:"eui"`
+	Token string `json:"token"`
+}
+
+// authorizationRequest contains the request posted to the HTTP authorizer.
+type authorizationRequest struct {
+	GatewayID  lorawan.EUI64 `json:"gatewayID"`
+	Endpoint   string        `json:"endpoint"`
+	CommonName string        `json:"commonName,omitempty"`
+	Token      string        `json:"token,omitempty"`
+	RemoteAddr string        `json:"remoteAddr"`
+}
+
+// authorizer authorizes the gateways connecting to the router-info and
+// gateway endpoints, using either an allow-list file or an HTTP authorizer.
+// The allow-list file is reloaded when its modification time changes.
+type authorizer struct {
+	sync.RWMutex
+
+	file        string
+	fileModTime time.Time
+	allowed     map[lorawan.EUI64]string
+
+	url    string
+	client http.Client
+}
+
+func newAuthorizer(file, url string, timeout time.Duration) (*authorizer, error) {
+	a := authorizer{
+		file:   file,
+		url:    url,
+		client: http.Client{Timeout: timeout},
+	}
+
+	if a.file != "" {
+		if err := a.reload(); err != nil {
+			return nil, errors.Wrap(err, "load allow-list file error")
+		}
+	}
+
+	return &a, nil
+}
+
+// enabled returns true when an allow-list file or HTTP authorizer has been
+// configured.
+func (a *authorizer) enabled() bool {
+	return a.file != "" || a.url != ""
+}
+
+// authorize returns an error when the gateway is not authorized for the
+// given endpoint.
+func (a *authorizer) authorize(endpoint string, gatewayID lorawan.EUI64, r *http.Request) error {
+	req := authorizationRequest{
+		GatewayID:  gatewayID,
+		Endpoint:   endpoint,
+		Token:      strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+		RemoteAddr: r.RemoteAddr,
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		req.CommonName = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	var err error
+	if a.file != "" {
+		err = a.authorizeFile(req)
+	} else {
+		err = a.authorizeHTTP(req)
+	}
+
+	if err != nil {
+		authorizationCounter("rejected").Inc()
+		return err
+	}
+
+	authorizationCounter("authorized").Inc()
+	return nil
+}
+
+func (a *authorizer) authorizeFile(req authorizationRequest) error {
+	if err := a.reload(); err != nil {
+		log.WithError(err).WithField("file", a.file).Error("backend/basicstation: reload authorization allow-list file error")
+	}
+
+	a.RLock()
+	token, ok := a.allowed[req.GatewayID]
+	a.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("gateway %s is not in allow-list", req.GatewayID)
+	}
+
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(req.Token)) != 1 {
+		return fmt.Errorf("invalid token for gateway %s", req.GatewayID)
+	}
+
+	return nil
+}
+
+func (a *authorizer) authorizeHTTP(req authorizationRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gateway %s rejected by authorizer (status code: %d)", req.GatewayID, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// reload (re)loads the allow-list file, when it has been modified since it
+// was last loaded.
+func (a *authorizer) reload() error {
+	fi, err := os.Stat(a.file)
+	if err != nil {
+		return errors.Wrap(err, "stat file error")
+	}
+
+	a.RLock()
+	modified := !fi.ModTime().Equal(a.fileModTime)
+	a.RUnlock()
+
+	if !modified {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		return errors.Wrap(err, "read file error")
+	}
+
+	var entries []authorizationEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return errors.Wrap(err, "unmarshal json error")
+	}
+
+	allowed := make(map[lorawan.EUI64]string)
+	for _, e := range entries {
+		var eui lorawan.EUI64
+		if err := eui.UnmarshalText([]byte(e.EUI)); err != nil {
+			return errors.Wrapf(err, "unmarshal eui %s error", e.EUI)
+		}
+		allowed[eui] = e.Token
+	}
+
+	a.Lock()
+	a.allowed = allowed
+	a.fileModTime = fi.ModTime()
+	a.Unlock()
+
+	log.WithFields(log.Fields{
+		"file":     a.file,
+		"gateways": len(allowed),
+	}).Info("backend/basicstation: authorization allow-list loaded")
+
+	return nil
+}
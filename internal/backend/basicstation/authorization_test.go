@@ -0,0 +1,98 @@
+package basicstation
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestAuthorizerFile(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "authorization")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "allow-list.json")
+	assert.NoError(ioutil.WriteFile(file, []byte(`[{"eui": "0102030405060708", "token": "secret"}, {"eui": "0102030405060709"}]`), 0644))
+
+	a, err := newAuthorizer(file, "", time.Second)
+	assert.NoError(err)
+	assert.True(a.enabled())
+
+	request := func(token string) *http.Request {
+		r, err := http.NewRequest("GET", "/router-info", nil)
+		assert.NoError(err)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r
+	}
+
+	tests := []struct {
+		Name          string
+		GatewayID     lorawan.EUI64
+		Token         string
+		ExpectedError string
+	}{
+		{
+			Name:      "valid token",
+			GatewayID: lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+			Token:     "secret",
+		},
+		{
+			Name:          "invalid token",
+			GatewayID:     lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+			Token:         "invalid",
+			ExpectedError: "invalid token for gateway 0102030405060708",
+		},
+		{
+			Name:      "without token",
+			GatewayID: lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 9},
+		},
+		{
+			Name:          "unknown gateway",
+			GatewayID:     lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 10},
+			ExpectedError: "gateway 010203040506070a is not in allow-list",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			err := a.authorize(endpointRouterInfo, tst.GatewayID, request(tst.Token))
+			if tst.ExpectedError != "" {
+				assert.EqualError(err, tst.ExpectedError)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+
+	t.Run("allow-list file reload", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ioutil.WriteFile(file, []byte(`[{"eui": "010203040506070a"}]`), 0644))
+		modTime := time.Now().Add(time.Second)
+		assert.NoError(os.Chtimes(file, modTime, modTime))
+
+		assert.NoError(a.authorize(endpointGateway, lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 10}, request("")))
+		assert.Error(a.authorize(endpointGateway, lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 9}, request("")))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		a, err := newAuthorizer("", "", time.Second)
+		assert.NoError(err)
+		assert.False(a.enabled())
+	})
+}
@@ -3,12 +3,10 @@ package basicstation
 import (
 	"crypto/rand"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
@@ -22,13 +20,22 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/airtime"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/basicstation/structs"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/certreload"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
 	"github.com/brocaar/lorawan"
 	"github.com/brocaar/lorawan/band"
 )
 
+// dwellTimeError defines the downlink TX acknowledgement error for downlinks
+// exceeding the dwell-time limit.
+const dwellTimeError = "DWELL_TIME"
+
 // websocket upgrade parameters
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -54,6 +61,11 @@ type Backend struct {
 	uplinkFrameChan             chan gw.UplinkFrame
 	gatewayStatsChan            chan gw.GatewayStats
 	rawPacketForwarderEventChan chan gw.RawPacketForwarderEvent
+	logEventChan                chan events.Log
+	sender                      *buffer.Sender
+
+	// logThrottle throttles identical log events.
+	logThrottle *logThrottle
 
 	band         band.Band
 	region       band.Name
@@ -63,10 +75,20 @@ type Backend struct {
 	frequencyMax uint32
 	routerConfig *structs.RouterConfig
 
-	// diidMap stores the mapping of diid to UUIDs. This should take ~ 1MB of
-	// memory. Optionaly this could be optimized by letting keys expire after
-	// a given time.
-	diidMap map[uint16][]byte
+	// regionParameters contains the regional parameters of the router-config.
+	regionParameters config.BasicStationRegionParameters
+
+	// routerInfoRoutes contains the (optional) router-info routing table.
+	routerInfoRoutes *routerInfoRoutes
+
+	// cups contains the (optional) CUPS endpoint.
+	cups *cups
+
+	// diidStore stores the mapping of diid to UUIDs.
+	diidStore *diidStore
+
+	// authorizer contains the (optional) per-gateway authorization.
+	authorizer *authorizer
 }
 
 // NewBackend creates a new Backend.
@@ -79,10 +101,13 @@ func NewBackend(conf config.Config) (*Backend, error) {
 			subscribeEventChan: make(chan events.Subscribe),
 		},
 
-		downlinkTXAckChan:           make(chan gw.DownlinkTXAck),
-		uplinkFrameChan:             make(chan gw.UplinkFrame),
-		gatewayStatsChan:            make(chan gw.GatewayStats),
-		rawPacketForwarderEventChan: make(chan gw.RawPacketForwarderEvent),
+		downlinkTXAckChan:           make(chan gw.DownlinkTXAck, conf.Backend.Channels.DownlinkTXAckSize),
+		uplinkFrameChan:             make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:            make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
+		rawPacketForwarderEventChan: make(chan gw.RawPacketForwarderEvent, conf.Backend.Channels.RawPacketForwarderEventSize),
+		logEventChan:                make(chan events.Log, conf.Backend.Channels.LogEventSize),
+		sender:                      buffer.NewSender("basic_station", conf),
+		logThrottle:                 newLogThrottle(logThrottleDuration),
 
 		pingInterval: conf.Backend.BasicStation.PingInterval,
 		readTimeout:  conf.Backend.BasicStation.ReadTimeout,
@@ -92,7 +117,7 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		frequencyMin: conf.Backend.BasicStation.FrequencyMin,
 		frequencyMax: conf.Backend.BasicStation.FrequencyMax,
 
-		diidMap: make(map[uint16][]byte),
+		regionParameters: conf.Backend.BasicStation.RegionParameters,
 	}
 
 	for _, n := range conf.Filters.NetIDs {
@@ -121,8 +146,13 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		return nil, errors.Wrap(err, "get band config error")
 	}
 
+	b.diidStore, err = newDIIDStore(conf.Backend.BasicStation.DIIDStore.File, conf.Backend.BasicStation.DIIDStore.MaxAge, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "setup diid store error")
+	}
+
 	if len(conf.Backend.BasicStation.Concentrators) != 0 {
-		conf, err := structs.GetRouterConfig(b.region, b.netIDs, b.joinEUIs, b.frequencyMin, b.frequencyMax, conf.Backend.BasicStation.Concentrators)
+		conf, err := structs.GetRouterConfig(b.region, b.netIDs, b.joinEUIs, b.frequencyMin, b.frequencyMax, b.regionParameters, conf.Backend.BasicStation.Concentrators)
 		if err != nil {
 			return nil, errors.Wrap(err, "get router config error")
 		}
@@ -130,10 +160,32 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		b.routerConfig = &conf
 	}
 
+	routerInfo := conf.Backend.BasicStation.RouterInfo
+	b.routerInfoRoutes, err = newRouterInfoRoutes(routerInfo.Routes, routerInfo.RoutesFile, routerInfo.LookupURL, routerInfo.LookupTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "setup router-info routes error")
+	}
+
+	auth := conf.Backend.BasicStation.Authorization
+	b.authorizer, err = newAuthorizer(auth.File, auth.HTTPURL, auth.HTTPTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "setup authorization error")
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/router-info", func(w http.ResponseWriter, r *http.Request) {
 		b.websocketWrap(b.handleRouterInfo, w, r)
 	})
+
+	if conf.Backend.BasicStation.CUPS.Enabled {
+		b.cups, err = newCUPS(conf.Backend.BasicStation.CUPS)
+		if err != nil {
+			return nil, errors.Wrap(err, "setup cups error")
+		}
+
+		mux.HandleFunc("/update-info", b.handleUpdateInfo)
+	}
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		connectCounter().Inc()
 		b.websocketWrap(b.handleGateway, w, r)
@@ -152,20 +204,18 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		Handler: mux,
 	}
 
-	// if the CA cert is configured, setup client certificate verification.
-	if conf.Backend.BasicStation.CACert != "" {
-		rawCACert, err := ioutil.ReadFile(conf.Backend.BasicStation.CACert)
+	// if the TLS cert / key is configured, setup TLS. If the CA cert is
+	// configured, setup client certificate verification. The certificates
+	// are reloaded when modified, such that these can be rotated without a
+	// restart.
+	useTLS := conf.Backend.BasicStation.TLSCert != "" || conf.Backend.BasicStation.TLSKey != "" || conf.Backend.BasicStation.CACert != ""
+	if useTLS {
+		certs, err := certreload.New(conf.Backend.BasicStation.CACert, conf.Backend.BasicStation.TLSCert, conf.Backend.BasicStation.TLSKey)
 		if err != nil {
-			return nil, errors.Wrap(err, "read ca cert error")
+			return nil, errors.Wrap(err, "load certificates error")
 		}
 
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(rawCACert)
-
-		server.TLSConfig = &tls.Config{
-			ClientCAs:  caCertPool,
-			ClientAuth: tls.RequireAndVerifyClientCert,
-		}
+		server.TLSConfig = certs.ServerConfig(tls.RequireAndVerifyClientCert)
 	}
 
 	go func() {
@@ -176,7 +226,7 @@ func NewBackend(conf config.Config) (*Backend, error) {
 			"ca_cert":  conf.Backend.BasicStation.CACert,
 		}).Info("backend/basicstation: starting websocket listener")
 
-		if conf.Backend.BasicStation.TLSCert == "" && conf.Backend.BasicStation.TLSKey == "" && conf.Backend.BasicStation.CACert == "" {
+		if !useTLS {
 			// no tls
 			if err := server.Serve(b.ln); err != nil && !b.isClosed {
 				log.WithError(err).Fatal("backend/basicstation: server error")
@@ -184,7 +234,8 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		} else {
 			// tls
 			b.scheme = "wss"
-			if err := server.ServeTLS(b.ln, conf.Backend.BasicStation.TLSCert, conf.Backend.BasicStation.TLSKey); err != nil && !b.isClosed {
+			// the key-pair is provided by the tls.Config
+			if err := server.ServeTLS(b.ln, "", ""); err != nil && !b.isClosed {
 				log.WithError(err).Fatal("backend/basicstation: server error")
 			}
 		}
@@ -218,6 +269,11 @@ func (b *Backend) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEve
 	return b.rawPacketForwarderEventChan
 }
 
+// GetLogEventChan returns the gateway log event channel.
+func (b *Backend) GetLogEventChan() chan events.Log {
+	return b.logEventChan
+}
+
 // SendDownlinkFrame sends the given downlink frame.
 func (b *Backend) SendDownlinkFrame(df gw.DownlinkFrame) error {
 	b.Lock()
@@ -233,18 +289,39 @@ func (b *Backend) SendDownlinkFrame(df gw.DownlinkFrame) error {
 		df.Token = uint32(binary.BigEndian.Uint16(tokenB))
 	}
 
-	pl, err := structs.DownlinkFrameFromProto(b.band, df)
-	if err != nil {
-		return errors.Wrap(err, "downlink frame from proto error")
-	}
-
 	var gatewayID lorawan.EUI64
 	var downID uuid.UUID
 	copy(gatewayID[:], df.GetTxInfo().GetGatewayId())
 	copy(downID[:], df.GetDownlinkId())
 
+	if err := b.checkDwellTime(df); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id":  gatewayID,
+			"downlink_id": downID,
+		}).Warning("backend/basicstation: downlink-frame rejected")
+
+		b.sender.DownlinkTXAck(b.downlinkTXAckChan, gw.DownlinkTXAck{
+			GatewayId:  gatewayID[:],
+			Token:      df.Token,
+			DownlinkId: df.GetDownlinkId(),
+			Error:      dwellTimeError,
+		})
+
+		return nil
+	}
+
+	pl, err := structs.DownlinkFrameFromProto(b.band, df)
+	if err != nil {
+		return errors.Wrap(err, "downlink frame from proto error")
+	}
+
 	// store token to UUID mapping
-	b.diidMap[uint16(df.Token)] = df.GetDownlinkId()
+	if err := b.diidStore.set(uint16(df.Token), df.GetDownlinkId(), time.Now()); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id":  gatewayID,
+			"downlink_id": downID,
+		}).Error("backend/basicstation: store diid mapping error")
+	}
 
 	websocketSendCounter("dnmsg").Inc()
 	if err := b.sendToGateway(gatewayID, pl); err != nil {
@@ -259,9 +336,28 @@ func (b *Backend) SendDownlinkFrame(df gw.DownlinkFrame) error {
 	return nil
 }
 
+// checkDwellTime returns an error when the airtime of the given downlink
+// frame exceeds the configured dwell-time limit.
+func (b *Backend) checkDwellTime(df gw.DownlinkFrame) error {
+	if b.regionParameters.DwellTime == 0 || b.regionParameters.NoDwell {
+		return nil
+	}
+
+	d, err := airtime.DownlinkAirtime(&df)
+	if err != nil {
+		return errors.Wrap(err, "calculate airtime error")
+	}
+
+	if d > b.regionParameters.DwellTime {
+		return errors.Errorf("airtime %s exceeds dwell-time limit %s", d, b.regionParameters.DwellTime)
+	}
+
+	return nil
+}
+
 // ApplyConfiguration applies the given configuration to the gateway.
 func (b *Backend) ApplyConfiguration(gwConfig gw.GatewayConfiguration) error {
-	rc, err := structs.GetRouterConfigOld(b.region, b.netIDs, b.joinEUIs, b.frequencyMin, b.frequencyMax, gwConfig)
+	rc, err := structs.GetRouterConfigOld(b.region, b.netIDs, b.joinEUIs, b.frequencyMin, b.frequencyMax, b.regionParameters, gwConfig)
 	if err != nil {
 		return errors.Wrap(err, "get router config error")
 	}
@@ -312,6 +408,9 @@ func (b *Backend) RawPacketForwarderCommand(pl gw.RawPacketForwarderCommand) err
 // Close closes the backend.
 func (b *Backend) Close() error {
 	b.isClosed = true
+	if err := b.diidStore.close(); err != nil {
+		return errors.Wrap(err, "close diid store error")
+	}
 	return b.ln.Close()
 }
 
@@ -332,6 +431,19 @@ func (b *Backend) handleRouterInfo(r *http.Request, c *websocket.Conn) {
 		URI:    fmt.Sprintf("%s://%s/gateway/%s", b.scheme, r.Host, lorawan.EUI64(req.Router)),
 	}
 
+	if b.routerInfoRoutes.enabled() {
+		route, ok := b.routerInfoRoutes.get(lorawan.EUI64(req.Router), r.RemoteAddr)
+		if ok {
+			resp.URI = fmt.Sprintf("%s/gateway/%s", strings.TrimRight(route.uri, "/"), lorawan.EUI64(req.Router))
+			if route.muxs != nil {
+				resp.Muxs = structs.EUI64(*route.muxs)
+			}
+		} else {
+			resp.URI = ""
+			resp.Error = fmt.Sprintf("no route for router %s", lorawan.EUI64(req.Router))
+		}
+	}
+
 	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
 		var cn lorawan.EUI64
 
@@ -342,6 +454,18 @@ func (b *Backend) handleRouterInfo(r *http.Request, c *websocket.Conn) {
 		}
 	}
 
+	if resp.Error == "" && b.authorizer.enabled() {
+		if err := b.authorizer.authorize(endpointRouterInfo, lorawan.EUI64(req.Router), r); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"gateway_id":  lorawan.EUI64(req.Router),
+				"remote_addr": r.RemoteAddr,
+			}).Warning("backend/basicstation: router-info request not authorized")
+
+			resp.URI = ""
+			resp.Error = fmt.Sprintf("router %s is not authorized", lorawan.EUI64(req.Router))
+		}
+	}
+
 	bb, err := json.Marshal(resp)
 	if err != nil {
 		log.WithError(err).Error("backend/basicstation: marshal json error")
@@ -386,6 +510,16 @@ func (b *Backend) handleGateway(r *http.Request, c *websocket.Conn) {
 		}
 	}
 
+	if b.authorizer.enabled() {
+		if err := b.authorizer.authorize(endpointGateway, gatewayID, r); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"gateway_id":  gatewayID,
+				"remote_addr": r.RemoteAddr,
+			}).Error("backend/basicstation: gateway not authorized")
+			return
+		}
+	}
+
 	// make sure we're not overwriting an existing connection
 	_, err := b.gateways.get(gatewayID)
 	if err == nil {
@@ -394,7 +528,7 @@ func (b *Backend) handleGateway(r *http.Request, c *websocket.Conn) {
 	}
 
 	// set the gateway connection
-	if err := b.gateways.set(gatewayID, gateway{conn: c}); err != nil {
+	if err := b.gateways.set(gatewayID, gateway{conn: c, connectTime: time.Now()}); err != nil {
 		log.WithError(err).WithField("gateway_id", gatewayID).Error("backend/basicstation: set gateway error")
 	}
 	log.WithFields(log.Fields{
@@ -403,11 +537,13 @@ func (b *Backend) handleGateway(r *http.Request, c *websocket.Conn) {
 	}).Info("backend/basicstation: gateway connected")
 
 	// remove the gateway on return
+	reason := "websocket closed"
 	defer func() {
-		b.gateways.remove(gatewayID)
+		b.gateways.remove(gatewayID, reason)
 		log.WithFields(log.Fields{
 			"gateway_id":  gatewayID,
 			"remote_addr": r.RemoteAddr,
+			"reason":      reason,
 		}).Info("backend/basicstation: gateway disconnected")
 	}()
 
@@ -415,6 +551,7 @@ func (b *Backend) handleGateway(r *http.Request, c *websocket.Conn) {
 	for {
 		mt, msg, err := c.ReadMessage()
 		if err != nil {
+			reason = disconnectReason(err)
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.WithField("gateway_id", gatewayID).WithError(err).Error("backend/basicstation: read message error")
 			}
@@ -423,6 +560,8 @@ func (b *Backend) handleGateway(r *http.Request, c *websocket.Conn) {
 
 		// reset the read deadline as the Basic Station doesn't respond to PONG messages (yet)
 		c.SetReadDeadline(time.Now().Add(b.readTimeout))
+		health.BackendEvent()
+		b.gateways.keepalive(gatewayID)
 
 		if mt == websocket.BinaryMessage {
 			log.WithFields(log.Fields{
@@ -513,6 +652,36 @@ func (b *Backend) handleGateway(r *http.Request, c *websocket.Conn) {
 				continue
 			}
 			b.handleDownlinkTransmittedMessage(gatewayID, pl)
+		case structs.LogMessage, structs.AlarmMessage:
+			// handle log / alarm
+			var pl structs.Log
+			if err := json.Unmarshal(msg, &pl); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"message_type": msgType,
+					"gateway_id":   gatewayID,
+					"payload":      string(msg),
+				}).Error("backend/basicstation: unmarshal json message error")
+				continue
+			}
+			b.handleLogMessage(gatewayID, pl)
+		case structs.TimeSyncMessage:
+			// handle timesync, when disabled the message is forwarded as raw
+			// packet-forwarder event
+			if !timesync.Enabled() {
+				b.handleRawPacketForwarderEvent(gatewayID, msg)
+				continue
+			}
+
+			var pl structs.TimeSyncRequest
+			if err := json.Unmarshal(msg, &pl); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"message_type": msgType,
+					"gateway_id":   gatewayID,
+					"payload":      string(msg),
+				}).Error("backend/basicstation: unmarshal json message error")
+				continue
+			}
+			b.handleTimeSync(gatewayID, pl)
 		default:
 			b.handleRawPacketForwarderEvent(gatewayID, msg)
 		}
@@ -544,12 +713,12 @@ func (b *Backend) handleVersion(gatewayID lorawan.EUI64, pl structs.Version) {
 
 	// TODO: remove this in the next major release
 	if b.routerConfig == nil {
-		b.gatewayStatsChan <- gw.GatewayStats{
+		b.sender.GatewayStats(b.gatewayStatsChan, gw.GatewayStats{
 			GatewayId:     gatewayID[:],
 			Ip:            g.conn.RemoteAddr().String(),
 			Time:          ts,
 			ConfigVersion: g.configVersion,
-		}
+		})
 
 		return
 	}
@@ -587,7 +756,7 @@ func (b *Backend) handleJoinRequest(gatewayID lorawan.EUI64, v structs.JoinReque
 		"uplink_id":  uplinkID,
 	}).Info("backend/basicstation: join-request received")
 
-	b.uplinkFrameChan <- uplinkFrame
+	b.sender.UplinkFrame(b.uplinkFrameChan, uplinkFrame)
 }
 
 func (b *Backend) handleProprietaryDataFrame(gatewayID lorawan.EUI64, v structs.UplinkProprietaryFrame) {
@@ -614,7 +783,7 @@ func (b *Backend) handleProprietaryDataFrame(gatewayID lorawan.EUI64, v structs.
 		"uplink_id":  uplinkID,
 	}).Info("backend/basicstation: proprietary uplink frame received")
 
-	b.uplinkFrameChan <- uplinkFrame
+	b.sender.UplinkFrame(b.uplinkFrameChan, uplinkFrame)
 }
 
 func (b *Backend) handleDownlinkTransmittedMessage(gatewayID lorawan.EUI64, v structs.DownlinkTransmitted) {
@@ -628,17 +797,33 @@ func (b *Backend) handleDownlinkTransmittedMessage(gatewayID lorawan.EUI64, v st
 		}).Error("backend/basicstation: error converting downlink transmitted to protobuf message")
 		return
 	}
-	txack.DownlinkId = b.diidMap[uint16(v.DIID)]
+
+	downlinkID, duplicate, err := b.diidStore.ack(uint16(v.DIID))
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id": gatewayID,
+		}).Error("backend/basicstation: store diid mapping error")
+	}
+	txack.DownlinkId = downlinkID
 
 	var downID uuid.UUID
 	copy(downID[:], txack.GetDownlinkId())
 
+	if duplicate {
+		dntxedDuplicateCounter().Inc()
+		log.WithFields(log.Fields{
+			"gateway_id":  gatewayID,
+			"downlink_id": downID,
+		}).Warning("backend/basicstation: duplicate downlink transmitted message ignored")
+		return
+	}
+
 	log.WithFields(log.Fields{
 		"gateway_id":  gatewayID,
 		"downlink_id": downID,
 	}).Info("backend/basicstation: downlink transmitted message received")
 
-	b.downlinkTXAckChan <- txack
+	b.sender.DownlinkTXAck(b.downlinkTXAckChan, txack)
 }
 
 func (b *Backend) handleUplinkDataFrame(gatewayID lorawan.EUI64, v structs.UplinkDataFrame) {
@@ -665,7 +850,64 @@ func (b *Backend) handleUplinkDataFrame(gatewayID lorawan.EUI64, v structs.Uplin
 		"uplink_id":  uplinkID,
 	}).Info("backend/basicstation: uplink frame received")
 
-	b.uplinkFrameChan <- uplinkFrame
+	b.sender.UplinkFrame(b.uplinkFrameChan, uplinkFrame)
+}
+
+func (b *Backend) handleLogMessage(gatewayID lorawan.EUI64, pl structs.Log) {
+	severity := pl.GetSeverity()
+	logEventCounter(severity).Inc()
+
+	if !b.logThrottle.allow(gatewayID, severity, pl.Message, time.Now()) {
+		logEventThrottledCounter(severity).Inc()
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"severity":   severity,
+		}).Debug("backend/basicstation: log event throttled")
+		return
+	}
+
+	logID, err := uuid.NewV4()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id": gatewayID,
+		}).Error("backend/basicstation: get random log id error")
+		return
+	}
+
+	logEvent := events.Log{
+		GatewayId: gatewayID[:],
+		LogId:     logID[:],
+		Time:      ptypes.TimestampNow(),
+		Severity:  severity,
+		Message:   pl.Message,
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"log_id":     logID,
+		"severity":   severity,
+	}).Info("backend/basicstation: log event received")
+
+	b.sender.LogEvent(b.logEventChan, logEvent)
+}
+
+func (b *Backend) handleTimeSync(gatewayID lorawan.EUI64, pl structs.TimeSyncRequest) {
+	resp := structs.TimeSyncResponse{
+		MessageType: structs.TimeSyncMessage,
+		TxTime:      pl.TxTime,
+		GPSTime:     int64(timesync.TimeSinceGPSEpoch(time.Now()) / time.Microsecond),
+	}
+
+	websocketSendCounter("timesync").Inc()
+	if err := b.sendToGateway(gatewayID, resp); err != nil {
+		log.WithError(err).WithField("gateway_id", gatewayID).Error("backend/basicstation: send to gateway error")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"gps_time":   resp.GPSTime,
+	}).Debug("backend/basicstation: timesync response sent to gateway")
 }
 
 func (b *Backend) handleRawPacketForwarderEvent(gatewayID lorawan.EUI64, pl []byte) {
@@ -688,7 +930,7 @@ func (b *Backend) handleRawPacketForwarderEvent(gatewayID lorawan.EUI64, pl []by
 		"raw_id":     rawID,
 	}).Info("backend/basicstation: raw packet-forwarder event received")
 
-	b.rawPacketForwarderEventChan <- rawEvent
+	b.sender.RawPacketForwarderEvent(b.rawPacketForwarderEventChan, rawEvent)
 }
 
 func (b *Backend) sendToGateway(gatewayID lorawan.EUI64, v interface{}) error {
@@ -767,3 +1009,17 @@ func (b *Backend) websocketWrap(handler func(*http.Request, *websocket.Conn), w
 	handler(r, conn)
 	done <- struct{}{}
 }
+
+// disconnectReason returns the disconnect reason for the given websocket
+// read error.
+func disconnectReason(err error) string {
+	if closeErr, ok := err.(*websocket.CloseError); ok {
+		return fmt.Sprintf("websocket closed with code %d", closeErr.Code)
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "websocket read timeout"
+	}
+
+	return fmt.Sprintf("websocket read error: %s", err)
+}
@@ -1,13 +1,17 @@
 package basicstation
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -17,7 +21,9 @@ import (
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/basicstation/structs"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
 	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
 )
 
 type BackendTestSuite struct {
@@ -59,7 +65,11 @@ func (ts *BackendTestSuite) SetupTest() {
 	assert.NoError(err)
 
 	event := <-ts.backend.GetSubscribeEventChan()
-	assert.Equal(events.Subscribe{Subscribe: true, GatewayID: lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}}, event)
+	assert.True(event.Subscribe)
+	assert.Equal(lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, event.GatewayID)
+	assert.Equal("basic_station", event.ConnState.BackendType)
+	assert.Equal(ts.wsClient.LocalAddr().String(), event.ConnState.RemoteAddress)
+	assert.NotNil(event.ConnState.ConnectTime)
 }
 
 func (ts *BackendTestSuite) TearDownTest() {
@@ -67,7 +77,10 @@ func (ts *BackendTestSuite) TearDownTest() {
 	assert.NoError(ts.wsClient.Close())
 
 	event := <-ts.backend.GetSubscribeEventChan()
-	assert.Equal(events.Subscribe{Subscribe: false, GatewayID: lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}}, event)
+	assert.False(event.Subscribe)
+	assert.Equal(lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, event.GatewayID)
+	assert.Equal("basic_station", event.ConnState.BackendType)
+	assert.Equal("websocket closed with code 1006", event.ConnState.Reason)
 
 	assert.NoError(ts.backend.Close())
 }
@@ -97,6 +110,141 @@ func (ts *BackendTestSuite) TestRouterInfo() {
 	}, resp)
 }
 
+func (ts *BackendTestSuite) TestRouterInfoRoutes() {
+	assert := require.New(ts.T())
+
+	var err error
+	ts.backend.routerInfoRoutes, err = newRouterInfoRoutes([]config.BasicStationRoute{
+		{EUI: "0102030400000000/32", URI: "wss://lns.example.com/", Muxs: "0807060504030201"},
+	}, "", "", 0)
+	assert.NoError(err)
+
+	tests := []struct {
+		Name     string
+		Router   structs.EUI64
+		Expected structs.RouterInfoResponse
+	}{
+		{
+			Name:   "matching route",
+			Router: structs.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Expected: structs.RouterInfoResponse{
+				Router: structs.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				Muxs:   structs.EUI64{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01},
+				URI:    "wss://lns.example.com/gateway/0102030405060708",
+			},
+		},
+		{
+			Name:   "no route",
+			Router: structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Expected: structs.RouterInfoResponse{
+				Router: structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				Muxs:   structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				Error:  "no route for router 0202030405060708",
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		ts.T().Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			d := &websocket.Dialer{}
+			ws, _, err := d.Dial(fmt.Sprintf("ws://%s/router-info", ts.wsAddr), nil)
+			assert.NoError(err)
+			defer ws.Close()
+
+			assert.NoError(ws.WriteJSON(structs.RouterInfoRequest{Router: tst.Router}))
+
+			var resp structs.RouterInfoResponse
+			assert.NoError(ws.ReadJSON(&resp))
+			assert.Equal(tst.Expected, resp)
+		})
+	}
+}
+
+func (ts *BackendTestSuite) TestAuthorization() {
+	assert := require.New(ts.T())
+
+	requests := make(chan authorizationRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req authorizationRequest
+		assert.NoError(json.NewDecoder(r.Body).Decode(&req))
+		requests <- req
+
+		if req.Token != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	var err error
+	ts.backend.authorizer, err = newAuthorizer("", server.URL, time.Second)
+	assert.NoError(err)
+
+	tests := []struct {
+		Name     string
+		Header   http.Header
+		Expected structs.RouterInfoResponse
+	}{
+		{
+			Name:   "authorized",
+			Header: http.Header{"Authorization": []string{"Bearer secret"}},
+			Expected: structs.RouterInfoResponse{
+				Router: structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				Muxs:   structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				URI:    fmt.Sprintf("ws://%s/gateway/0202030405060708", ts.wsAddr),
+			},
+		},
+		{
+			Name: "not authorized",
+			Expected: structs.RouterInfoResponse{
+				Router: structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				Muxs:   structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+				Error:  "router 0202030405060708 is not authorized",
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		ts.T().Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			d := &websocket.Dialer{}
+			ws, _, err := d.Dial(fmt.Sprintf("ws://%s/router-info", ts.wsAddr), tst.Header)
+			assert.NoError(err)
+			defer ws.Close()
+
+			assert.NoError(ws.WriteJSON(structs.RouterInfoRequest{Router: structs.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}}))
+
+			var resp structs.RouterInfoResponse
+			assert.NoError(ws.ReadJSON(&resp))
+			assert.Equal(tst.Expected, resp)
+
+			req := <-requests
+			assert.Equal(endpointRouterInfo, req.Endpoint)
+			assert.Equal(lorawan.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, req.GatewayID)
+		})
+	}
+
+	ts.T().Run("gateway not authorized", func(t *testing.T) {
+		assert := require.New(t)
+
+		d := &websocket.Dialer{}
+		ws, _, err := d.Dial(fmt.Sprintf("ws://%s/gateway/0202030405060708", ts.wsAddr), nil)
+		assert.NoError(err)
+		defer ws.Close()
+
+		_, _, err = ws.ReadMessage()
+		assert.Error(err)
+
+		req := <-requests
+		assert.Equal(endpointGateway, req.Endpoint)
+
+		_, err = ts.backend.gateways.get(lorawan.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+		assert.Error(err)
+	})
+}
+
 func (ts *BackendTestSuite) TestVersionOld() {
 	assert := require.New(ts.T())
 	ts.backend.routerConfig = nil
@@ -291,7 +439,7 @@ func (ts *BackendTestSuite) TestDownlinkTransmitted() {
 	id, err := uuid.NewV4()
 	assert.NoError(err)
 
-	ts.backend.diidMap[12345] = id[:]
+	assert.NoError(ts.backend.diidStore.set(12345, id[:], time.Now()))
 
 	dtx := structs.DownlinkTransmitted{
 		MessageType: structs.DownlinkTransmittedMessage,
@@ -307,6 +455,15 @@ func (ts *BackendTestSuite) TestDownlinkTransmitted() {
 		Token:      12345,
 		DownlinkId: id[:],
 	}, txAck)
+
+	// duplicate dntxed messages are ignored
+	assert.NoError(ts.wsClient.WriteJSON(dtx))
+
+	select {
+	case txAck := <-ts.backend.GetDownlinkTXAckChan():
+		ts.T().Fatalf("unexpected tx ack: %v", txAck)
+	case <-time.After(100 * time.Millisecond):
+	}
 }
 
 func (ts *BackendTestSuite) TestApplyConfiguration() {
@@ -433,7 +590,7 @@ func (ts *BackendTestSuite) TestSendDownlinkFrame() {
 	})
 	assert.NoError(err)
 
-	assert.Equal(id[:], ts.backend.diidMap[1234])
+	assert.Equal(id[:], ts.backend.diidStore.items[1234].DownlinkID)
 
 	var df structs.DownlinkFrame
 	assert.NoError(ts.wsClient.ReadJSON(&df))
@@ -459,6 +616,88 @@ func (ts *BackendTestSuite) TestSendDownlinkFrame() {
 	}, df)
 }
 
+func (ts *BackendTestSuite) TestSendDownlinkFrameDwellTime() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	// AS923 dwell-time limit
+	ts.backend.regionParameters = config.BasicStationRegionParameters{
+		DwellTime: 400 * time.Millisecond,
+	}
+	defer func() {
+		ts.backend.regionParameters = config.BasicStationRegionParameters{}
+	}()
+
+	df := gw.DownlinkFrame{
+		PhyPayload: make([]byte, 20),
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Frequency:  868100000,
+			Power:      14,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:             125,
+					SpreadingFactor:       12,
+					CodeRate:              "4/5",
+					PolarizationInversion: true,
+				},
+			},
+			Timing: gw.DownlinkTiming_DELAY,
+			TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+				DelayTimingInfo: &gw.DelayTimingInfo{
+					Delay: ptypes.DurationProto(time.Second),
+				},
+			},
+			Context: []byte{0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 4},
+		},
+		Token:      1234,
+		DownlinkId: id[:],
+	}
+
+	ts.T().Run("Exceeds dwell-time", func(t *testing.T) {
+		assert := require.New(t)
+
+		errChan := make(chan error)
+		go func() {
+			errChan <- ts.backend.SendDownlinkFrame(df)
+		}()
+
+		txAck := <-ts.backend.GetDownlinkTXAckChan()
+		assert.Equal(gw.DownlinkTXAck{
+			GatewayId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Token:      1234,
+			DownlinkId: id[:],
+			Error:      "DWELL_TIME",
+		}, txAck)
+		assert.NoError(<-errChan)
+	})
+
+	ts.T().Run("Within dwell-time", func(t *testing.T) {
+		assert := require.New(t)
+
+		df.TxInfo.GetLoraModulationInfo().SpreadingFactor = 7
+		assert.NoError(ts.backend.SendDownlinkFrame(df))
+
+		var dl structs.DownlinkFrame
+		assert.NoError(ts.wsClient.ReadJSON(&dl))
+		assert.Equal(1234, int(dl.DIID))
+	})
+
+	ts.T().Run("Dwell-time disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		ts.backend.regionParameters.NoDwell = true
+		df.TxInfo.GetLoraModulationInfo().SpreadingFactor = 12
+		assert.NoError(ts.backend.SendDownlinkFrame(df))
+
+		var dl structs.DownlinkFrame
+		assert.NoError(ts.wsClient.ReadJSON(&dl))
+		assert.Equal(1234, int(dl.DIID))
+	})
+}
+
 func (ts *BackendTestSuite) TestRawPacketForwarderCommand() {
 	assert := require.New(ts.T())
 	id, err := uuid.NewV4()
@@ -531,6 +770,57 @@ func (ts *BackendTestSuite) TestRawPacketForwarderEvent() {
 	})
 }
 
+func (ts *BackendTestSuite) TestTimeSync() {
+	assert := require.New(ts.T())
+
+	var conf config.Config
+	conf.TimeSync.Enabled = true
+	conf.TimeSync.Window = time.Minute
+	assert.NoError(timesync.Setup(conf))
+	defer timesync.Setup(config.Config{})
+
+	assert.NoError(ts.wsClient.WriteMessage(websocket.TextMessage, []byte(`{"msgtype": "timesync", "txtime": 12345.678}`)))
+
+	var resp structs.TimeSyncResponse
+	assert.NoError(ts.wsClient.ReadJSON(&resp))
+	assert.Equal(structs.TimeSyncMessage, resp.MessageType)
+	assert.Equal(12345.678, resp.TxTime)
+
+	gpsTime := time.Time(gps.NewTimeFromTimeSinceGPSEpoch(time.Duration(resp.GPSTime) * time.Microsecond))
+	assert.WithinDuration(time.Now(), gpsTime, time.Second)
+}
+
+func (ts *BackendTestSuite) TestLogEvent() {
+	assert := require.New(ts.T())
+
+	errorCount := testutil.ToFloat64(logEventCounter("ERROR"))
+	throttledCount := testutil.ToFloat64(logEventThrottledCounter("ERROR"))
+
+	for _, msg := range []string{
+		`{"msgtype": "alarm", "msg": "SX1301 radio A error"}`,
+		`{"msgtype": "alarm", "msg": "SX1301 radio A error"}`,
+		`{"msgtype": "log", "level": "warning", "msg": "TX timing missed"}`,
+	} {
+		assert.NoError(ts.wsClient.WriteMessage(websocket.TextMessage, []byte(msg)))
+	}
+
+	// the second alarm is throttled
+	for _, exp := range []events.Log{
+		{Severity: "ERROR", Message: "SX1301 radio A error"},
+		{Severity: "WARNING", Message: "TX timing missed"},
+	} {
+		logEvent := <-ts.backend.GetLogEventChan()
+		assert.Equal([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, logEvent.GatewayId)
+		assert.Len(logEvent.LogId, 16)
+		assert.NotNil(logEvent.Time)
+		assert.Equal(exp.Severity, logEvent.Severity)
+		assert.Equal(exp.Message, logEvent.Message)
+	}
+
+	assert.Equal(errorCount+2, testutil.ToFloat64(logEventCounter("ERROR")))
+	assert.Equal(throttledCount+1, testutil.ToFloat64(logEventThrottledCounter("ERROR")))
+}
+
 func TestBackend(t *testing.T) {
 	suite.Run(t, new(BackendTestSuite))
 }
@@ -0,0 +1,227 @@
+package basicstation
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/basicstation/structs"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// cups implements the CUPS (Configuration and Update Server) endpoint. It
+// provisions the stations with the CUPS / TC (LNS) URIs, the credentials
+// and (optionally) a firmware update.
+type cups struct {
+	cupsURI  string
+	tcURI    string
+	cupsCred []byte
+	tcCred   []byte
+
+	updateVersion   string
+	updateData      []byte
+	signature       []byte
+	signatureKeyCRC uint32
+}
+
+func newCUPS(conf config.BasicStationCUPS) (*cups, error) {
+	c := cups{
+		cupsURI:         conf.CUPSURI,
+		tcURI:           conf.TCURI,
+		updateVersion:   conf.Update.Version,
+		signatureKeyCRC: conf.Update.SignatureKeyCRC,
+	}
+
+	var err error
+	c.cupsCred, err = readCredentials(conf.CUPSCredentials)
+	if err != nil {
+		return nil, errors.Wrap(err, "read cups credentials error")
+	}
+
+	c.tcCred, err = readCredentials(conf.TCCredentials)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tc credentials error")
+	}
+
+	if conf.Update.File != "" {
+		c.updateData, err = ioutil.ReadFile(conf.Update.File)
+		if err != nil {
+			return nil, errors.Wrap(err, "read update file error")
+		}
+
+		c.signature, err = ioutil.ReadFile(conf.Update.SignatureFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read update signature file error")
+		}
+	}
+
+	return &c, nil
+}
+
+// getUpdateInfo returns the update-info response for the given request.
+// The defaultTCURI is used when no TC URI has been configured.
+func (c *cups) getUpdateInfo(req structs.UpdateInfoRequest, defaultTCURI string) structs.UpdateInfoResponse {
+	var resp structs.UpdateInfoResponse
+
+	if c.cupsURI != "" && c.cupsURI != req.CUPSURI {
+		resp.CUPSURI = c.cupsURI
+	}
+
+	tcURI := c.tcURI
+	if tcURI == "" {
+		tcURI = defaultTCURI
+	}
+	if tcURI != req.TCURI {
+		resp.TCURI = tcURI
+	}
+
+	if len(c.cupsCred) != 0 && crc32.ChecksumIEEE(c.cupsCred) != req.CUPSCredCRC {
+		resp.CUPSCredential = c.cupsCred
+	}
+
+	if len(c.tcCred) != 0 && crc32.ChecksumIEEE(c.tcCred) != req.TCCredCRC {
+		resp.TCCredential = c.tcCred
+	}
+
+	if len(c.updateData) != 0 && c.updateVersion != req.Package {
+		for _, key := range req.Keys {
+			if key == c.signatureKeyCRC {
+				resp.SignatureKeyCRC = c.signatureKeyCRC
+				resp.Signature = c.signature
+				resp.UpdateData = c.updateData
+				break
+			}
+		}
+	}
+
+	return resp
+}
+
+func (b *Backend) handleUpdateInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req structs.UpdateInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.WithError(err).Error("backend/basicstation: unmarshal update-info request error")
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		var cn lorawan.EUI64
+		if err := cn.UnmarshalText([]byte(r.TLS.PeerCertificates[0].Subject.CommonName)); err != nil || cn != lorawan.EUI64(req.Router) {
+			log.WithFields(log.Fields{
+				"gateway_id":  lorawan.EUI64(req.Router),
+				"common_name": r.TLS.PeerCertificates[0].Subject.CommonName,
+			}).Error("backend/basicstation: CommonName verification failed")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+
+	resp := b.cups.getUpdateInfo(req, fmt.Sprintf("%s://%s", scheme, r.Host))
+
+	bb, err := resp.MarshalBinary()
+	if err != nil {
+		log.WithError(err).Error("backend/basicstation: marshal update-info response error")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cupsUpdateInfoCounter().Inc()
+	for typ, updated := range map[string]bool{
+		"cups_uri":  resp.CUPSURI != "",
+		"tc_uri":    resp.TCURI != "",
+		"cups_cred": len(resp.CUPSCredential) != 0,
+		"tc_cred":   len(resp.TCCredential) != 0,
+		"update":    len(resp.UpdateData) != 0,
+	} {
+		if updated {
+			cupsUpdateCounter(typ).Inc()
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id":  lorawan.EUI64(req.Router),
+		"remote_addr": r.RemoteAddr,
+		"package":     req.Package,
+		"cups_uri":    resp.CUPSURI,
+		"tc_uri":      resp.TCURI,
+		"update":      len(resp.UpdateData) != 0,
+	}).Info("backend/basicstation: update-info request received")
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(bb)
+}
+
+// readCredentials reads the given credentials and returns them in the format
+// expected by the station: the CA certificate, followed by the client
+// certificate and key (all DER encoded). When using token authentication,
+// the client certificate is replaced by four zero bytes and the key by the
+// token (as HTTP header, e.g. "Authorization: Bearer ...\r\n").
+func readCredentials(conf config.BasicStationCredentials) ([]byte, error) {
+	if conf.CACert == "" {
+		return nil, nil
+	}
+
+	out, err := readDER(conf.CACert)
+	if err != nil {
+		return nil, errors.Wrap(err, "read ca cert error")
+	}
+
+	if conf.Token != "" {
+		out = append(out, 0x00, 0x00, 0x00, 0x00)
+		out = append(out, []byte(conf.Token+"\r\n")...)
+		return out, nil
+	}
+
+	if conf.TLSCert == "" {
+		return out, nil
+	}
+
+	cert, err := readDER(conf.TLSCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tls cert error")
+	}
+
+	key, err := readDER(conf.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tls key error")
+	}
+
+	out = append(out, cert...)
+	out = append(out, key...)
+
+	return out, nil
+}
+
+// readDER reads the given PEM file and returns the DER encoded content of
+// the first block.
+func readDER(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "read file error")
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", file)
+	}
+
+	return block.Bytes, nil
+}
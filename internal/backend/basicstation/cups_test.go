@@ -0,0 +1,117 @@
+package basicstation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/basicstation/structs"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestCUPS(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "cups")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{0x01, 0x02}}), 0644))
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0644))
+	updateFile := filepath.Join(dir, "update.bin")
+	assert.NoError(ioutil.WriteFile(updateFile, []byte{0x05, 0x06}, 0644))
+	sigFile := filepath.Join(dir, "update.sig")
+	assert.NoError(ioutil.WriteFile(sigFile, []byte{0x07}, 0644))
+
+	c, err := newCUPS(config.BasicStationCUPS{
+		Enabled: true,
+		CUPSURI: "https://cups.example.com",
+		TCCredentials: config.BasicStationCredentials{
+			CACert:  caFile,
+			TLSCert: caFile,
+			TLSKey:  keyFile,
+		},
+		CUPSCredentials: config.BasicStationCredentials{
+			CACert: caFile,
+			Token:  "Authorization: Bearer secret",
+		},
+		Update: config.BasicStationCUPSUpdate{
+			Version:         "1.0.1",
+			File:            updateFile,
+			SignatureFile:   sigFile,
+			SignatureKeyCRC: 123,
+		},
+	})
+	assert.NoError(err)
+
+	tcCred := append([]byte{0x01, 0x02, 0x01, 0x02}, keyDER...)
+	cupsCred := append([]byte{0x01, 0x02, 0x00, 0x00, 0x00, 0x00}, []byte("Authorization: Bearer secret\r\n")...)
+
+	tests := []struct {
+		Name     string
+		Request  structs.UpdateInfoRequest
+		Expected structs.UpdateInfoResponse
+	}{
+		{
+			Name: "everything outdated",
+			Request: structs.UpdateInfoRequest{
+				Package: "1.0.0",
+				Keys:    []uint32{123},
+			},
+			Expected: structs.UpdateInfoResponse{
+				CUPSURI:         "https://cups.example.com",
+				TCURI:           "ws://localhost:3001",
+				CUPSCredential:  cupsCred,
+				TCCredential:    tcCred,
+				SignatureKeyCRC: 123,
+				Signature:       []byte{0x07},
+				UpdateData:      []byte{0x05, 0x06},
+			},
+		},
+		{
+			Name: "unknown signing key",
+			Request: structs.UpdateInfoRequest{
+				CUPSURI:     "https://cups.example.com",
+				TCURI:       "ws://localhost:3001",
+				CUPSCredCRC: crc32.ChecksumIEEE(cupsCred),
+				TCCredCRC:   crc32.ChecksumIEEE(tcCred),
+				Package:     "1.0.0",
+				Keys:        []uint32{456},
+			},
+		},
+		{
+			Name: "up to date",
+			Request: structs.UpdateInfoRequest{
+				CUPSURI:     "https://cups.example.com",
+				TCURI:       "ws://localhost:3001",
+				CUPSCredCRC: crc32.ChecksumIEEE(cupsCred),
+				TCCredCRC:   crc32.ChecksumIEEE(tcCred),
+				Package:     "1.0.1",
+				Keys:        []uint32{123},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.Expected, c.getUpdateInfo(tst.Request, "ws://localhost:3001"))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package basicstation
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var diidBucket = []byte("diid")
+
+// diidPruneInterval defines the min. interval between removing the expired
+// diid mappings.
+const diidPruneInterval = time.Minute
+
+// diidStore stores the mapping of the diid (downlink token) to the downlink
+// ID. When a path is configured, the mapping is persisted such that the
+// dntxed messages received after a restart can still be correlated with the
+// downlink. The store also keeps track of the acknowledged downlinks, such
+// that duplicate dntxed messages are reported only once.
+type diidStore struct {
+	sync.Mutex
+
+	// db is nil when the mapping is not persisted.
+	db     *bolt.DB
+	maxAge time.Duration
+
+	items     map[uint16]diidItem
+	lastPrune time.Time
+}
+
+// diidItem is the (on-disk) representation of a diid mapping.
+type diidItem struct {
+	DownlinkID []byte    `json:"downlinkID"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Acked      bool      `json:"acked"`
+}
+
+// newDIIDStore creates a new diid store. When the path is set, the store is
+// opened (or created) at the given path. A max. age of 0 disables the
+// expiration of the mappings.
+func newDIIDStore(path string, maxAge time.Duration, now time.Time) (*diidStore, error) {
+	s := diidStore{
+		maxAge: maxAge,
+		items:  make(map[uint16]diidItem),
+	}
+
+	if path == "" {
+		return &s, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "open database error")
+	}
+	s.db = db
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(diidBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var item diidItem
+			if len(k) != 2 || json.Unmarshal(v, &item) != nil {
+				return nil
+			}
+			s.items[binary.BigEndian.Uint16(k)] = item
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "load diid mapping error")
+	}
+
+	if err := s.prune(now); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "prune diid mapping error")
+	}
+
+	return &s, nil
+}
+
+// set stores the downlink ID for the given diid.
+func (s *diidStore) set(diid uint16, downlinkID []byte, now time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if now.Sub(s.lastPrune) >= diidPruneInterval {
+		if err := s.prune(now); err != nil {
+			return errors.Wrap(err, "prune diid mapping error")
+		}
+	}
+
+	item := diidItem{
+		DownlinkID: downlinkID,
+		CreatedAt:  now,
+	}
+	s.items[diid] = item
+
+	return s.put(diid, item)
+}
+
+// ack returns the downlink ID for the given diid and marks the downlink as
+// acknowledged. It returns true when the downlink was already acknowledged
+// (a duplicate dntxed message).
+func (s *diidStore) ack(diid uint16) ([]byte, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	item, ok := s.items[diid]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if item.Acked {
+		return item.DownlinkID, true, nil
+	}
+
+	item.Acked = true
+	s.items[diid] = item
+
+	return item.DownlinkID, false, s.put(diid, item)
+}
+
+// close closes the store.
+func (s *diidStore) close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *diidStore) put(diid uint16, item diidItem) error {
+	if s.db == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diidBucket).Put(diidKey(diid), b)
+	})
+}
+
+// prune removes the expired mappings. It must be called with the lock held
+// (or during setup).
+func (s *diidStore) prune(now time.Time) error {
+	s.lastPrune = now
+
+	if s.maxAge == 0 {
+		return nil
+	}
+
+	var expired []uint16
+	for diid, item := range s.items {
+		if now.Sub(item.CreatedAt) > s.maxAge {
+			expired = append(expired, diid)
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	for _, diid := range expired {
+		delete(s.items, diid)
+	}
+
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(diidBucket)
+		for _, diid := range expired {
+			if err := bucket.Delete(diidKey(diid)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func diidKey(diid uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, diid)
+	return b
+}
@@ -0,0 +1,78 @@
+package basicstation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDIIDStore(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "diid")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "diid.db")
+	now := time.Now()
+	downID := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	s, err := newDIIDStore(path, time.Hour, now)
+	assert.NoError(err)
+
+	assert.NoError(s.set(1, downID, now))
+	assert.NoError(s.set(2, downID, now.Add(-2*time.Hour)))
+	assert.NoError(s.close())
+
+	t.Run("restored after restart", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newDIIDStore(path, time.Hour, now)
+		assert.NoError(err)
+		defer s.close()
+
+		id, duplicate, err := s.ack(1)
+		assert.NoError(err)
+		assert.False(duplicate)
+		assert.Equal(downID, id)
+
+		// the expired mapping has been removed
+		id, duplicate, err = s.ack(2)
+		assert.NoError(err)
+		assert.False(duplicate)
+		assert.Nil(id)
+	})
+
+	t.Run("duplicate after restart", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newDIIDStore(path, time.Hour, now)
+		assert.NoError(err)
+		defer s.close()
+
+		id, duplicate, err := s.ack(1)
+		assert.NoError(err)
+		assert.True(duplicate)
+		assert.Equal(downID, id)
+	})
+
+	t.Run("not persisted", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newDIIDStore("", 0, now)
+		assert.NoError(err)
+
+		assert.NoError(s.set(3, downID, now.Add(-24*time.Hour)))
+		assert.NoError(s.set(4, downID, now))
+
+		id, duplicate, err := s.ack(3)
+		assert.NoError(err)
+		assert.False(duplicate)
+		assert.Equal(downID, id)
+		assert.NoError(s.close())
+	})
+}
@@ -3,6 +3,9 @@ package basicstation
 import (
 	"errors"
 	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
 
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/lorawan"
@@ -16,6 +19,23 @@ var (
 type gateway struct {
 	conn          *websocket.Conn
 	configVersion string
+	connectTime   time.Time
+}
+
+// connState returns the connection state details of the gateway.
+func (g gateway) connState() *events.ConnState {
+	connectTime, _ := ptypes.TimestampProto(g.connectTime)
+
+	cs := events.ConnState{
+		BackendType: "basic_station",
+		ConnectTime: connectTime,
+	}
+
+	if g.conn != nil {
+		cs.RemoteAddress = g.conn.RemoteAddr().String()
+	}
+
+	return &cs
 }
 
 type gateways struct {
@@ -41,15 +61,30 @@ func (g *gateways) set(id lorawan.EUI64, gw gateway) error {
 	defer g.Unlock()
 
 	g.gateways[id] = gw
-	g.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: id}
+	g.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: id, ConnState: gw.connState()}
 	return nil
 }
 
-func (g *gateways) remove(id lorawan.EUI64) error {
+// keepalive reports that the gateway is still connected. The keepalive is
+// dropped when the subscribe event channel is not ready to receive, as a
+// next message from the gateway refreshes it.
+func (g *gateways) keepalive(id lorawan.EUI64) {
+	select {
+	case g.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: id}:
+	default:
+	}
+}
+
+// remove removes the gateway. The reason is included in the connection
+// state details.
+func (g *gateways) remove(id lorawan.EUI64, reason string) error {
 	g.Lock()
 	defer g.Unlock()
 
-	g.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: id}
+	connState := g.gateways[id].connState()
+	connState.Reason = reason
+
+	g.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: id, ConnState: connState}
 	delete(g.gateways, id)
 	return nil
 }
@@ -0,0 +1,100 @@
+package basicstation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/brocaar/lorawan"
+)
+
+// logThrottleDuration defines the duration within which identical log events
+// (same gateway, severity and message) are dropped.
+var logThrottleDuration = time.Minute
+
+// logThrottleCleanupInterval defines the interval at which the expired
+// entries are removed.
+var logThrottleCleanupInterval = 10 * time.Second
+
+// maxLogThrottleMessageLength defines the max. length of the message used
+// for detecting identical log events. Longer messages are truncated.
+const maxLogThrottleMessageLength = 256
+
+// maxLogThrottleEntries defines the max. number of distinct log events per
+// gateway within the throttle duration. Once this number is reached, the
+// other log events of the gateway are dropped until the entries expire.
+const maxLogThrottleEntries = 100
+
+type logThrottleKey struct {
+	gatewayID lorawan.EUI64
+	severity  string
+	message   string
+}
+
+// logThrottle throttles identical log events to avoid event storms, e.g.
+// when a concentrator keeps reporting the same radio error.
+type logThrottle struct {
+	sync.Mutex
+
+	duration    time.Duration
+	seen        map[logThrottleKey]time.Time
+	counts      map[lorawan.EUI64]int
+	lastCleanup time.Time
+}
+
+func newLogThrottle(duration time.Duration) *logThrottle {
+	return &logThrottle{
+		duration: duration,
+		seen:     make(map[logThrottleKey]time.Time),
+		counts:   make(map[lorawan.EUI64]int),
+	}
+}
+
+// allow returns true when the given log event must be forwarded.
+func (t *logThrottle) allow(gatewayID lorawan.EUI64, severity, message string, now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if now.Sub(t.lastCleanup) >= logThrottleCleanupInterval {
+		t.cleanup(now)
+	}
+
+	if len(message) > maxLogThrottleMessageLength {
+		message = message[:maxLogThrottleMessageLength]
+	}
+
+	key := logThrottleKey{
+		gatewayID: gatewayID,
+		severity:  severity,
+		message:   message,
+	}
+
+	// the entry might be expired, but not yet removed by cleanup
+	if ts, ok := t.seen[key]; ok {
+		if now.Sub(ts) < t.duration {
+			return false
+		}
+	} else {
+		if t.counts[gatewayID] >= maxLogThrottleEntries {
+			return false
+		}
+		t.counts[gatewayID]++
+	}
+
+	t.seen[key] = now
+	return true
+}
+
+// cleanup removes the expired entries. It must be called with the lock held.
+func (t *logThrottle) cleanup(now time.Time) {
+	for k, ts := range t.seen {
+		if now.Sub(ts) >= t.duration {
+			delete(t.seen, k)
+
+			t.counts[k.gatewayID]--
+			if t.counts[k.gatewayID] <= 0 {
+				delete(t.counts, k.gatewayID)
+			}
+		}
+	}
+	t.lastCleanup = now
+}
@@ -0,0 +1,67 @@
+package basicstation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestLogThrottle(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	throttle := newLogThrottle(time.Minute)
+
+	assert.True(throttle.allow(gatewayID, "ERROR", "radio error", now))
+	assert.False(throttle.allow(gatewayID, "ERROR", "radio error", now.Add(30*time.Second)))
+
+	// different severity, message or gateway
+	assert.True(throttle.allow(gatewayID, "WARNING", "radio error", now))
+	assert.True(throttle.allow(gatewayID, "ERROR", "other error", now))
+	assert.True(throttle.allow(lorawan.EUI64{1}, "ERROR", "radio error", now))
+
+	// after the throttle duration, the message is forwarded again and the
+	// expired entries are removed
+	assert.True(throttle.allow(gatewayID, "ERROR", "radio error", now.Add(time.Minute)))
+	assert.Len(throttle.seen, 1)
+
+	t.Run("max entries", func(t *testing.T) {
+		assert := require.New(t)
+
+		throttle := newLogThrottle(time.Minute)
+		for i := 0; i < maxLogThrottleEntries; i++ {
+			assert.True(throttle.allow(gatewayID, "ERROR", fmt.Sprintf("error %d", i), now))
+		}
+
+		// the gateway exceeded the max. number of distinct log events
+		assert.False(throttle.allow(gatewayID, "ERROR", "other error", now))
+		assert.Len(throttle.seen, maxLogThrottleEntries)
+
+		// this does not affect other gateways
+		assert.True(throttle.allow(lorawan.EUI64{1}, "ERROR", "other error", now))
+
+		// the entries are removed after the throttle duration
+		assert.True(throttle.allow(gatewayID, "ERROR", "other error", now.Add(time.Minute)))
+		assert.Len(throttle.seen, 1)
+		assert.Equal(map[lorawan.EUI64]int{gatewayID: 1}, throttle.counts)
+	})
+
+	t.Run("long messages", func(t *testing.T) {
+		assert := require.New(t)
+
+		throttle := newLogThrottle(time.Minute)
+		message := strings.Repeat("a", 2*maxLogThrottleMessageLength)
+
+		assert.True(throttle.allow(gatewayID, "ERROR", message, now))
+		assert.False(throttle.allow(gatewayID, "ERROR", message+"b", now))
+		for k := range throttle.seen {
+			assert.Len(k.message, maxLogThrottleMessageLength)
+		}
+	})
+}
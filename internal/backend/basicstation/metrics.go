@@ -21,6 +21,41 @@ var (
 		Help: "The number of WebSocket messages sent by the backend (per msgtype).",
 	}, []string{"msgtype"})
 
+	lec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_basicstation_log_event_count",
+		Help: "The number of log / alarm events received by the backend (per severity).",
+	}, []string{"severity"})
+
+	let = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_basicstation_log_event_throttled_count",
+		Help: "The number of log / alarm events dropped by the throttling (per severity).",
+	}, []string{"severity"})
+
+	ddc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backend_basicstation_dntxed_duplicate_count",
+		Help: "The number of duplicate downlink transmitted (dntxed) messages ignored by the backend.",
+	})
+
+	cuc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backend_basicstation_cups_update_info_count",
+		Help: "The number of CUPS update-info requests received by the backend.",
+	})
+
+	cup = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_basicstation_cups_update_count",
+		Help: "The number of CUPS updates sent to the gateways (per type).",
+	}, []string{"type"})
+
+	auc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_basicstation_authorization_count",
+		Help: "The number of gateway authorizations (per result).",
+	}, []string{"result"})
+
+	rlc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_basicstation_router_info_lookup_count",
+		Help: "The number of router-info route lookups (per result).",
+	}, []string{"result"})
+
 	gwc = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "backend_basicstation_gateway_connect_count",
 		Help: "The number of gateway connections received by the backend.",
@@ -44,6 +79,34 @@ func websocketSendCounter(msgtype string) prometheus.Counter {
 	return wss.With(prometheus.Labels{"msgtype": msgtype})
 }
 
+func logEventCounter(severity string) prometheus.Counter {
+	return lec.With(prometheus.Labels{"severity": severity})
+}
+
+func logEventThrottledCounter(severity string) prometheus.Counter {
+	return let.With(prometheus.Labels{"severity": severity})
+}
+
+func dntxedDuplicateCounter() prometheus.Counter {
+	return ddc
+}
+
+func cupsUpdateInfoCounter() prometheus.Counter {
+	return cuc
+}
+
+func cupsUpdateCounter(typ string) prometheus.Counter {
+	return cup.With(prometheus.Labels{"type": typ})
+}
+
+func authorizationCounter(result string) prometheus.Counter {
+	return auc.With(prometheus.Labels{"result": result})
+}
+
+func routerInfoLookupCounter(result string) prometheus.Counter {
+	return rlc.With(prometheus.Labels{"result": result})
+}
+
 func connectCounter() prometheus.Counter {
 	return gwc
 }
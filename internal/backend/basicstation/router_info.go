@@ -0,0 +1,265 @@
+package basicstation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// routerInfoRoute contains a single router-info route.
+type routerInfoRoute struct {
+	prefix lorawan.EUI64
+	size   int // prefix size in bits
+	uri    string
+	muxs   *lorawan.EUI64
+}
+
+// match returns true when the given EUI matches the route.
+func (r routerInfoRoute) match(eui lorawan.EUI64) bool {
+	if r.size == 0 {
+		return true
+	}
+
+	mask := ^uint64(0) << uint(64-r.size)
+	return binary.BigEndian.Uint64(eui[:])&mask == binary.BigEndian.Uint64(r.prefix[:])&mask
+}
+
+// routerInfoLookupRequest contains the request posted to the lookup URL.
+type routerInfoLookupRequest struct {
+	GatewayID  lorawan.EUI64 `json:"gatewayID"`
+	RemoteAddr string        `json:"remoteAddr"`
+}
+
+// routerInfoLookupResponse contains the response of the lookup URL.
+type routerInfoLookupResponse struct {
+	URI  string `json:"uri"`
+	Muxs string `json:"muxs"`
+}
+
+// routerInfoRoutes contains the router-info routing table. The routes can
+// be configured statically and / or loaded from a file. The file is reloaded
+// when its modification time changes. When a lookup URL is configured, the
+// route is looked up first and the routing table is used as fallback.
+type routerInfoRoutes struct {
+	sync.RWMutex
+
+	static      []routerInfoRoute
+	fromFile    []routerInfoRoute
+	file        string
+	fileModTime time.Time
+
+	lookupURL string
+	client    http.Client
+}
+
+func newRouterInfoRoutes(routes []config.BasicStationRoute, file, lookupURL string, lookupTimeout time.Duration) (*routerInfoRoutes, error) {
+	static, err := parseRouterInfoRoutes(routes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse routes error")
+	}
+
+	r := routerInfoRoutes{
+		static:    static,
+		file:      file,
+		lookupURL: lookupURL,
+		client:    http.Client{Timeout: lookupTimeout},
+	}
+
+	if r.file != "" {
+		if err := r.reload(); err != nil {
+			return nil, errors.Wrap(err, "load routes file error")
+		}
+	}
+
+	return &r, nil
+}
+
+// enabled returns true when routes or a lookup URL have been configured.
+func (r *routerInfoRoutes) enabled() bool {
+	return len(r.static) != 0 || r.file != "" || r.lookupURL != ""
+}
+
+// get returns the route for the given EUI. The looked-up route (if any) takes
+// precedence over the routing table. In case multiple routes of the routing
+// table match, the route with the longest prefix is returned.
+func (r *routerInfoRoutes) get(eui lorawan.EUI64, remoteAddr string) (routerInfoRoute, bool) {
+	if r.lookupURL != "" {
+		route, ok, err := r.lookup(eui, remoteAddr)
+		if err != nil {
+			routerInfoLookupCounter("error").Inc()
+			log.WithError(err).WithFields(log.Fields{
+				"gateway_id": eui,
+				"lookup_url": r.lookupURL,
+			}).Error("backend/basicstation: router-info route lookup error")
+		} else if ok {
+			routerInfoLookupCounter("found").Inc()
+			return route, true
+		} else {
+			routerInfoLookupCounter("not_found").Inc()
+		}
+	}
+
+	if r.file != "" {
+		if err := r.reload(); err != nil {
+			log.WithError(err).WithField("file", r.file).Error("backend/basicstation: reload router-info routes file error")
+		}
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	var out routerInfoRoute
+	var found bool
+
+	for _, routes := range [][]routerInfoRoute{r.static, r.fromFile} {
+		for _, route := range routes {
+			if route.match(eui) && (!found || route.size > out.size) {
+				out = route
+				found = true
+			}
+		}
+	}
+
+	return out, found
+}
+
+// lookup posts the given EUI to the lookup URL and returns the route. A 404
+// response means that there is no route for the given EUI.
+func (r *routerInfoRoutes) lookup(eui lorawan.EUI64, remoteAddr string) (routerInfoRoute, bool, error) {
+	b, err := json.Marshal(routerInfoLookupRequest{
+		GatewayID:  eui,
+		RemoteAddr: remoteAddr,
+	})
+	if err != nil {
+		return routerInfoRoute{}, false, errors.Wrap(err, "marshal json error")
+	}
+
+	resp, err := r.client.Post(r.lookupURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return routerInfoRoute{}, false, errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return routerInfoRoute{}, false, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return routerInfoRoute{}, false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var lookupResp routerInfoLookupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lookupResp); err != nil {
+		return routerInfoRoute{}, false, errors.Wrap(err, "unmarshal json error")
+	}
+
+	routes, err := parseRouterInfoRoutes([]config.BasicStationRoute{
+		{EUI: eui.String(), URI: lookupResp.URI, Muxs: lookupResp.Muxs},
+	})
+	if err != nil {
+		return routerInfoRoute{}, false, errors.Wrap(err, "parse route error")
+	}
+
+	return routes[0], true, nil
+}
+
+// reload (re)loads the routes file, when it has been modified since it was
+// last loaded.
+func (r *routerInfoRoutes) reload() error {
+	fi, err := os.Stat(r.file)
+	if err != nil {
+		return errors.Wrap(err, "stat file error")
+	}
+
+	r.RLock()
+	modified := !fi.ModTime().Equal(r.fileModTime)
+	r.RUnlock()
+
+	if !modified {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return errors.Wrap(err, "read file error")
+	}
+
+	var routes []config.BasicStationRoute
+	if err := json.Unmarshal(b, &routes); err != nil {
+		return errors.Wrap(err, "unmarshal json error")
+	}
+
+	fromFile, err := parseRouterInfoRoutes(routes)
+	if err != nil {
+		return errors.Wrap(err, "parse routes error")
+	}
+
+	r.Lock()
+	r.fromFile = fromFile
+	r.fileModTime = fi.ModTime()
+	r.Unlock()
+
+	log.WithFields(log.Fields{
+		"file":   r.file,
+		"routes": len(fromFile),
+	}).Info("backend/basicstation: router-info routes loaded")
+
+	return nil
+}
+
+// parseRouterInfoRoutes parses the given routes. The EUI must either be an
+// exact EUI (e.g. 0102030405060708) or a prefix (e.g. 0102030400000000/32).
+func parseRouterInfoRoutes(routes []config.BasicStationRoute) ([]routerInfoRoute, error) {
+	var out []routerInfoRoute
+
+	for _, r := range routes {
+		route := routerInfoRoute{
+			size: 64,
+			uri:  r.URI,
+		}
+
+		if route.uri == "" {
+			return nil, fmt.Errorf("uri for route %s must not be empty", r.EUI)
+		}
+
+		euiStr := r.EUI
+		if parts := strings.SplitN(r.EUI, "/", 2); len(parts) == 2 {
+			size, err := strconv.Atoi(parts[1])
+			if err != nil || size < 0 || size > 64 {
+				return nil, fmt.Errorf("invalid prefix size in %s", r.EUI)
+			}
+			route.size = size
+			euiStr = parts[0]
+		}
+
+		if err := route.prefix.UnmarshalText([]byte(euiStr)); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal eui %s error", r.EUI)
+		}
+
+		if r.Muxs != "" {
+			var muxs lorawan.EUI64
+			if err := muxs.UnmarshalText([]byte(r.Muxs)); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal muxs %s error", r.Muxs)
+			}
+			route.muxs = &muxs
+		}
+
+		out = append(out, route)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,189 @@
+package basicstation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestRouterInfoRoutes(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "router-info")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "routes.json")
+	assert.NoError(ioutil.WriteFile(file, []byte(`[{"eui": "0102030405060708", "uri": "wss://file.example.com"}]`), 0644))
+
+	routes, err := newRouterInfoRoutes([]config.BasicStationRoute{
+		{EUI: "0000000000000000/0", URI: "wss://default.example.com"},
+		{EUI: "0102030400000000/32", URI: "wss://prefix.example.com"},
+	}, file, "", 0)
+	assert.NoError(err)
+	assert.True(routes.enabled())
+
+	tests := []struct {
+		Name        string
+		EUI         lorawan.EUI64
+		ExpectedURI string
+	}{
+		{
+			Name:        "exact match",
+			EUI:         lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			ExpectedURI: "wss://file.example.com",
+		},
+		{
+			Name:        "prefix match",
+			EUI:         lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x09},
+			ExpectedURI: "wss://prefix.example.com",
+		},
+		{
+			Name:        "default route",
+			EUI:         lorawan.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			ExpectedURI: "wss://default.example.com",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			route, ok := routes.get(tst.EUI, "")
+			assert.True(ok)
+			assert.Equal(tst.ExpectedURI, route.uri)
+		})
+	}
+
+	t.Run("routes file reload", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ioutil.WriteFile(file, []byte(`[{"eui": "0102030405060708", "uri": "wss://reloaded.example.com"}]`), 0644))
+		modTime := time.Now().Add(time.Second)
+		assert.NoError(os.Chtimes(file, modTime, modTime))
+
+		route, ok := routes.get(lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, "")
+		assert.True(ok)
+		assert.Equal("wss://reloaded.example.com", route.uri)
+	})
+}
+
+func TestRouterInfoRoutesLookup(t *testing.T) {
+	assert := require.New(t)
+
+	var lookupReq routerInfoLookupRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&lookupReq); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch lookupReq.GatewayID {
+		case lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}:
+			w.Write([]byte(`{"uri": "wss://eu.example.com", "muxs": "0807060504030201"}`))
+		case lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x09}:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	routes, err := newRouterInfoRoutes([]config.BasicStationRoute{
+		{EUI: "0102030400000000/32", URI: "wss://fallback.example.com"},
+	}, "", server.URL, time.Second)
+	assert.NoError(err)
+	assert.True(routes.enabled())
+
+	tests := []struct {
+		Name         string
+		EUI          lorawan.EUI64
+		ExpectedOK   bool
+		ExpectedURI  string
+		ExpectedMuxs *lorawan.EUI64
+	}{
+		{
+			Name:         "looked-up route",
+			EUI:          lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			ExpectedOK:   true,
+			ExpectedURI:  "wss://eu.example.com",
+			ExpectedMuxs: &lorawan.EUI64{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01},
+		},
+		{
+			Name:        "lookup error falls back to routing table",
+			EUI:         lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x09},
+			ExpectedOK:  true,
+			ExpectedURI: "wss://fallback.example.com",
+		},
+		{
+			Name:        "not found falls back to routing table",
+			EUI:         lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x0a},
+			ExpectedOK:  true,
+			ExpectedURI: "wss://fallback.example.com",
+		},
+		{
+			Name: "no route",
+			EUI:  lorawan.EUI64{0x02, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			route, ok := routes.get(tst.EUI, "192.168.1.5:48832")
+			assert.Equal(tst.ExpectedOK, ok)
+			assert.Equal(tst.ExpectedURI, route.uri)
+			assert.Equal(tst.ExpectedMuxs, route.muxs)
+			assert.Equal(tst.EUI, lookupReq.GatewayID)
+			assert.Equal("192.168.1.5:48832", lookupReq.RemoteAddr)
+		})
+	}
+}
+
+func TestParseRouterInfoRoutes(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Routes        []config.BasicStationRoute
+		ExpectedError string
+	}{
+		{
+			Name:   "valid",
+			Routes: []config.BasicStationRoute{{EUI: "0102030400000000/32", URI: "wss://example.com", Muxs: "0102030405060708"}},
+		},
+		{
+			Name:          "missing uri",
+			Routes:        []config.BasicStationRoute{{EUI: "0102030405060708"}},
+			ExpectedError: "uri for route 0102030405060708 must not be empty",
+		},
+		{
+			Name:          "invalid prefix size",
+			Routes:        []config.BasicStationRoute{{EUI: "0102030400000000/65", URI: "wss://example.com"}},
+			ExpectedError: "invalid prefix size in 0102030400000000/65",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := parseRouterInfoRoutes(tst.Routes)
+			if tst.ExpectedError != "" {
+				assert.Error(err)
+				assert.Equal(tst.ExpectedError, err.Error())
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
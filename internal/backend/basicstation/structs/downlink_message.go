@@ -61,6 +61,14 @@ func DownlinkFrameFromProto(loraBand band.Band, pb gw.DownlinkFrame) (DownlinkFr
 		out.XTime = &xtime
 	}
 
+	// antenna
+	// the radio context selects the antenna used for the transmission, when
+	// an antenna has been selected this overrides the uplink radio context
+	if pb.TxInfo.Antenna != 0 {
+		rctx := uint64(pb.TxInfo.Antenna)
+		out.RCtx = &rctx
+	}
+
 	// get data-rate
 	var dr int
 	var err error
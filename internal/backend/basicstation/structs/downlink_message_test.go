@@ -18,6 +18,7 @@ func TestDownlinkFrameFromProto(t *testing.T) {
 	dr7 := 7
 	freq := uint32(868100000)
 	rCtx := uint64(3)
+	antennaRCtx := uint64(1)
 	xTime := uint64(4)
 	gpsTime := uint64(time.Second / time.Microsecond)
 
@@ -182,6 +183,48 @@ func TestDownlinkFrameFromProto(t *testing.T) {
 				RX2Freq:     &freq,
 			},
 		},
+		{
+			Name: "Class-A with antenna",
+			In: gw.DownlinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				TxInfo: &gw.DownlinkTXInfo{
+					GatewayId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+					Frequency:  868100000,
+					Power:      14,
+					Modulation: common.Modulation_LORA,
+					ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+						LoraModulationInfo: &gw.LoRaModulationInfo{
+							Bandwidth:             125,
+							SpreadingFactor:       10,
+							CodeRate:              "4/5",
+							PolarizationInversion: true,
+						},
+					},
+					Antenna: 1,
+					Timing:  gw.DownlinkTiming_DELAY,
+					TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+						DelayTimingInfo: &gw.DelayTimingInfo{
+							Delay: ptypes.DurationProto(time.Second),
+						},
+					},
+					Context: []byte{0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 4},
+				},
+				Token: 1234,
+			},
+			Out: DownlinkFrame{
+				MessageType: DownlinkMessage,
+				DevEui:      "00-00-00-00-00-00-00-00",
+				DC:          0,
+				DIID:        1234,
+				Priority:    1,
+				PDU:         "01020304",
+				RCtx:        &antennaRCtx,
+				XTime:       &xTime,
+				RxDelay:     &delay1,
+				RX1DR:       &dr2,
+				RX1Freq:     &freq,
+			},
+		},
 	}
 
 	assert := require.New(t)
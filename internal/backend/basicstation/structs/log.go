@@ -0,0 +1,25 @@
+package structs
+
+import "strings"
+
+// Log implements the log / alarm message, sent by the station to report
+// (radio) errors.
+type Log struct {
+	MessageType MessageType `json:"msgtype"`
+	Level       string      `json:"level"`
+	Message     string      `json:"msg"`
+}
+
+// GetSeverity returns the severity of the log message. Alarm messages
+// without level are reported as ERROR.
+func (l Log) GetSeverity() string {
+	if l.Level != "" {
+		return strings.ToUpper(l.Level)
+	}
+
+	if l.MessageType == AlarmMessage {
+		return "ERROR"
+	}
+
+	return "INFO"
+}
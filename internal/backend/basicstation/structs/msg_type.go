@@ -18,6 +18,9 @@ const (
 	ProprietaryDataFrameMessage MessageType = "propdf"
 	DownlinkMessage             MessageType = "dnmsg"
 	DownlinkTransmittedMessage  MessageType = "dntxed"
+	LogMessage                  MessageType = "log"
+	AlarmMessage                MessageType = "alarm"
+	TimeSyncMessage             MessageType = "timesync"
 )
 
 type messageTypePayload struct {
@@ -36,6 +36,10 @@ type RouterConfig struct {
 	FreqRange   []uint32     `json:"freq_range"`
 	DRs         [][]int      `json:"DRs"`
 	SX1301Conf  []SX1301Conf `json:"sx1301_conf"`
+	MaxEIRP     float32      `json:"max_eirp,omitempty"`
+	NoCCA       bool         `json:"nocca,omitempty"`
+	NoDC        bool         `json:"nodc,omitempty"`
+	NoDwell     bool         `json:"nodwell,omitempty"`
 }
 
 // SX1301Conf implements a single SX1301 configuration.
@@ -81,9 +85,18 @@ type SX1301ConfChanMultiSF struct {
 	IF     int  `json:"if"`
 }
 
+// setRegionParameters sets the max. EIRP and the CCA, duty-cycle and
+// dwell-time flags of the router-config.
+func setRegionParameters(c *RouterConfig, params config.BasicStationRegionParameters) {
+	c.MaxEIRP = params.MaxEIRP
+	c.NoCCA = params.NoCCA
+	c.NoDC = params.NoDC
+	c.NoDwell = params.NoDwell
+}
+
 // GetRouterConfigOld returns the router-config message.
 // Currently only 8 multi SF + 1 single + 1 FSK channels are supported.
-func GetRouterConfigOld(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]lorawan.EUI64, freqMin, freqMax uint32, config gw.GatewayConfiguration) (RouterConfig, error) {
+func GetRouterConfigOld(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]lorawan.EUI64, freqMin, freqMax uint32, params config.BasicStationRegionParameters, gwConfig gw.GatewayConfiguration) (RouterConfig, error) {
 	c := RouterConfig{
 		MessageType: RouterConfigMessage,
 		Region:      regionNameMapping[region],
@@ -92,6 +105,8 @@ func GetRouterConfigOld(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]
 		SX1301Conf:  make([]SX1301Conf, 1),
 	}
 
+	setRegionParameters(&c, params)
+
 	// set NetID filter
 	for _, netID := range netIDs {
 		c.NetID = append(c.NetID, binary.BigEndian.Uint32(append([]byte{0x00}, netID[:]...)))
@@ -130,7 +145,7 @@ func GetRouterConfigOld(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]
 	}
 
 	// Get radio frequencies
-	radioFrequencies, err := sx1301v1.GetRadioFrequencies(config.Channels)
+	radioFrequencies, err := sx1301v1.GetRadioFrequencies(gwConfig.Channels)
 	if err != nil {
 		return c, errors.Wrap(err, "get radio frequencies error")
 	}
@@ -149,7 +164,7 @@ func GetRouterConfigOld(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]
 
 	// set channels
 	var channelI int
-	for _, channel := range config.Channels {
+	for _, channel := range gwConfig.Channels {
 		r, err := sx1301v1.GetRadioForChannel(radioFrequencies, channel)
 		if err != nil {
 			return c, errors.Wrap(err, "get radio for channel error")
@@ -210,7 +225,7 @@ func GetRouterConfigOld(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]
 }
 
 // GetRouterConfig returns the router-config message.
-func GetRouterConfig(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]lorawan.EUI64, freqMin, freqMax uint32, concentrators []config.BasicStationConcentrator) (RouterConfig, error) {
+func GetRouterConfig(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]lorawan.EUI64, freqMin, freqMax uint32, params config.BasicStationRegionParameters, concentrators []config.BasicStationConcentrator) (RouterConfig, error) {
 	concentratorCount := len(concentrators)
 
 	c := RouterConfig{
@@ -221,6 +236,8 @@ func GetRouterConfig(region band.Name, netIDs []lorawan.NetID, joinEUIs [][2]lor
 		SX1301Conf:  make([]SX1301Conf, concentratorCount),
 	}
 
+	setRegionParameters(&c, params)
+
 	// set NetID filter
 	for _, netID := range netIDs {
 		c.NetID = append(c.NetID, binary.BigEndian.Uint32(append([]byte{0x00}, netID[:]...)))
@@ -1,6 +1,7 @@
 package structs
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -20,6 +21,7 @@ func TestRouterConfigOld(t *testing.T) {
 		JoinEUIs             [][2]lorawan.EUI64
 		FrequencyMin         uint32
 		FrequencyMax         uint32
+		RegionParameters     config.BasicStationRegionParameters
 		GatewayConfiguration gw.GatewayConfiguration
 
 		ExpectedRouterConfig RouterConfig
@@ -506,7 +508,7 @@ func TestRouterConfigOld(t *testing.T) {
 		t.Run(tst.Name, func(t *testing.T) {
 			assert := require.New(t)
 
-			rc, err := GetRouterConfigOld(tst.Region, tst.NetIDs, tst.JoinEUIs, tst.FrequencyMin, tst.FrequencyMax, tst.GatewayConfiguration)
+			rc, err := GetRouterConfigOld(tst.Region, tst.NetIDs, tst.JoinEUIs, tst.FrequencyMin, tst.FrequencyMax, tst.RegionParameters, tst.GatewayConfiguration)
 			assert.Equal(tst.ExpectedError, err)
 			if err != nil {
 				return
@@ -525,7 +527,8 @@ func TestRouterConfig(t *testing.T) {
 		FrequencyMin uint32
 		FrequencyMax uint32
 
-		Concentrators []config.BasicStationConcentrator
+		RegionParameters config.BasicStationRegionParameters
+		Concentrators    []config.BasicStationConcentrator
 
 		ExpectedRouterConfig RouterConfig
 		ExpectedError        error
@@ -714,6 +717,10 @@ func TestRouterConfig(t *testing.T) {
 			JoinEUIs:     [][2]lorawan.EUI64{{{}, {0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}}},
 			FrequencyMin: 902000000,
 			FrequencyMax: 928000000,
+			RegionParameters: config.BasicStationRegionParameters{
+				MaxEIRP: 30,
+				NoCCA:   true,
+			},
 			Concentrators: []config.BasicStationConcentrator{
 				{
 					MultiSF: config.BasicStationConcentratorMultiSF{
@@ -734,6 +741,8 @@ func TestRouterConfig(t *testing.T) {
 				Region:      "US902",
 				HWSpec:      "sx1301/1",
 				FreqRange:   []uint32{902000000, 928000000},
+				MaxEIRP:     30,
+				NoCCA:       true,
 				DRs: [][]int{
 					{10, 125, 0},
 					{9, 125, 0},
@@ -822,7 +831,7 @@ func TestRouterConfig(t *testing.T) {
 			var conf config.Config
 			conf.Backend.BasicStation.Concentrators = tst.Concentrators
 
-			rc, err := GetRouterConfig(tst.Region, tst.NetIDs, tst.JoinEUIs, tst.FrequencyMin, tst.FrequencyMax, conf.Backend.BasicStation.Concentrators)
+			rc, err := GetRouterConfig(tst.Region, tst.NetIDs, tst.JoinEUIs, tst.FrequencyMin, tst.FrequencyMax, tst.RegionParameters, conf.Backend.BasicStation.Concentrators)
 			assert.Equal(tst.ExpectedError, err)
 			if err != nil {
 				return
@@ -831,3 +840,26 @@ func TestRouterConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestRouterConfigRegionParametersJSON(t *testing.T) {
+	assert := require.New(t)
+
+	rc, err := GetRouterConfig(band.US915, nil, nil, 902000000, 928000000, config.BasicStationRegionParameters{
+		MaxEIRP: 30,
+		NoCCA:   true,
+		NoDC:    true,
+		NoDwell: true,
+	}, nil)
+	assert.NoError(err)
+
+	b, err := json.Marshal(rc)
+	assert.NoError(err)
+
+	var out map[string]interface{}
+	assert.NoError(json.Unmarshal(b, &out))
+	assert.Equal("US902", out["region"])
+	assert.EqualValues(30, out["max_eirp"])
+	assert.Equal(true, out["nocca"])
+	assert.Equal(true, out["nodc"])
+	assert.Equal(true, out["nodwell"])
+}
@@ -0,0 +1,17 @@
+package structs
+
+// TimeSyncRequest implements the timesync request, sent by the station to
+// synchronize its clock.
+type TimeSyncRequest struct {
+	MessageType MessageType `json:"msgtype"`
+	TxTime      float64     `json:"txtime"`
+}
+
+// TimeSyncResponse implements the timesync response. The TxTime is echoed
+// from the request, the GPSTime contains the GPS time (in microseconds) at
+// which the response was sent.
+type TimeSyncResponse struct {
+	MessageType MessageType `json:"msgtype"`
+	TxTime      float64     `json:"txtime"`
+	GPSTime     int64       `json:"gpstime"`
+}
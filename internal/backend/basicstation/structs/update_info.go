@@ -0,0 +1,77 @@
+package structs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// UpdateInfoRequest implements the CUPS update-info request.
+type UpdateInfoRequest struct {
+	Router      EUI64    `json:"router"`
+	CUPSURI     string   `json:"cupsUri"`
+	TCURI       string   `json:"tcUri"`
+	CUPSCredCRC uint32   `json:"cupsCredCrc"`
+	TCCredCRC   uint32   `json:"tcCredCrc"`
+	Station     string   `json:"station"`
+	Model       string   `json:"model"`
+	Package     string   `json:"package"`
+	Keys        []uint32 `json:"keys"`
+}
+
+// UpdateInfoResponse implements the CUPS update-info response. Empty fields
+// signal the station that no update is needed.
+type UpdateInfoResponse struct {
+	CUPSURI        string
+	TCURI          string
+	CUPSCredential []byte
+	TCCredential   []byte
+	// SignatureKeyCRC is the CRC32 of the key used to sign the update data.
+	SignatureKeyCRC uint32
+	Signature       []byte
+	UpdateData      []byte
+}
+
+// MarshalBinary encodes the response into the binary format expected by the
+// station.
+func (r UpdateInfoResponse) MarshalBinary() ([]byte, error) {
+	if len(r.CUPSURI) > 255 {
+		return nil, fmt.Errorf("cups uri exceeds max length of 255 bytes")
+	}
+	if len(r.TCURI) > 255 {
+		return nil, fmt.Errorf("tc uri exceeds max length of 255 bytes")
+	}
+	if len(r.CUPSCredential) > 65535 {
+		return nil, fmt.Errorf("cups credential exceeds max length of 65535 bytes")
+	}
+	if len(r.TCCredential) > 65535 {
+		return nil, fmt.Errorf("tc credential exceeds max length of 65535 bytes")
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte(uint8(len(r.CUPSURI)))
+	buf.WriteString(r.CUPSURI)
+
+	buf.WriteByte(uint8(len(r.TCURI)))
+	buf.WriteString(r.TCURI)
+
+	binary.Write(&buf, binary.LittleEndian, uint16(len(r.CUPSCredential)))
+	buf.Write(r.CUPSCredential)
+
+	binary.Write(&buf, binary.LittleEndian, uint16(len(r.TCCredential)))
+	buf.Write(r.TCCredential)
+
+	if len(r.Signature) == 0 {
+		binary.Write(&buf, binary.LittleEndian, uint32(0))
+	} else {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(r.Signature)+4))
+		binary.Write(&buf, binary.LittleEndian, r.SignatureKeyCRC)
+		buf.Write(r.Signature)
+	}
+
+	binary.Write(&buf, binary.LittleEndian, uint32(len(r.UpdateData)))
+	buf.Write(r.UpdateData)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package structs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateInfoRequest(t *testing.T) {
+	assert := require.New(t)
+
+	jsonStr := `{"router": "::1", "cupsUri": "https://cups.example.com", "tcUri": "", "cupsCredCrc": 1, "tcCredCrc": 2, "station": "2.0.5", "model": "linux", "package": "1.0.0", "keys": [3]}`
+
+	var req UpdateInfoRequest
+	assert.NoError(json.Unmarshal([]byte(jsonStr), &req))
+	assert.Equal(UpdateInfoRequest{
+		Router:      EUI64{0, 0, 0, 0, 0, 0, 0, 1},
+		CUPSURI:     "https://cups.example.com",
+		CUPSCredCRC: 1,
+		TCCredCRC:   2,
+		Station:     "2.0.5",
+		Model:       "linux",
+		Package:     "1.0.0",
+		Keys:        []uint32{3},
+	}, req)
+}
+
+func TestUpdateInfoResponse(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Response UpdateInfoResponse
+		Expected []byte
+	}{
+		{
+			Name:     "no updates",
+			Expected: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			Name: "uris and credentials",
+			Response: UpdateInfoResponse{
+				CUPSURI:        "a",
+				TCURI:          "bc",
+				CUPSCredential: []byte{0x01},
+				TCCredential:   []byte{0x02, 0x03},
+			},
+			Expected: []byte{
+				0x01, 'a',
+				0x02, 'b', 'c',
+				0x01, 0x00, 0x01,
+				0x02, 0x00, 0x02, 0x03,
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+			},
+		},
+		{
+			Name: "update",
+			Response: UpdateInfoResponse{
+				SignatureKeyCRC: 0x04030201,
+				Signature:       []byte{0x05},
+				UpdateData:      []byte{0x06, 0x07},
+			},
+			Expected: []byte{
+				0x00,
+				0x00,
+				0x00, 0x00,
+				0x00, 0x00,
+				0x05, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05,
+				0x02, 0x00, 0x00, 0x00, 0x06, 0x07,
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			b, err := tst.Response.MarshalBinary()
+			assert.NoError(err)
+			assert.Equal(tst.Expected, b)
+		})
+	}
+}
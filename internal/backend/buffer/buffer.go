@@ -0,0 +1,165 @@
+// Package buffer implements the sending of events on the (buffered) backend
+// channels. When a channel is full (e.g. because of a slow integration), the
+// configured drop policy is applied.
+package buffer
+
+import (
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// Drop policies.
+const (
+	// DropPolicyBlock blocks until the event can be sent.
+	DropPolicyBlock = "block"
+
+	// DropPolicyDropOldest drops the oldest event of the full channel, such
+	// that the backend is never blocked.
+	DropPolicyDropOldest = "drop_oldest"
+)
+
+// Sender sends the events of a backend on the backend channels.
+type Sender struct {
+	backend    string
+	dropOldest bool
+}
+
+// NewSender creates a new Sender for the given backend type.
+func NewSender(backend string, conf config.Config) *Sender {
+	return &Sender{
+		backend:    backend,
+		dropOldest: conf.Backend.Channels.DropPolicy == DropPolicyDropOldest,
+	}
+}
+
+// UplinkFrame sends the given uplink frame.
+func (s *Sender) UplinkFrame(ch chan gw.UplinkFrame, pl gw.UplinkFrame) {
+	s.send("uplink_frame", cap(ch),
+		func() bool {
+			select {
+			case ch <- pl:
+				return true
+			default:
+				return false
+			}
+		},
+		func() bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		},
+		func() { ch <- pl },
+	)
+}
+
+// GatewayStats sends the given gateway stats.
+func (s *Sender) GatewayStats(ch chan gw.GatewayStats, pl gw.GatewayStats) {
+	s.send("gateway_stats", cap(ch),
+		func() bool {
+			select {
+			case ch <- pl:
+				return true
+			default:
+				return false
+			}
+		},
+		func() bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		},
+		func() { ch <- pl },
+	)
+}
+
+// DownlinkTXAck sends the given downlink TX acknowledgement. As the TX
+// acknowledgement is the only outcome of a downlink already committed by the
+// network server, it is never dropped: the send blocks regardless of the drop
+// policy.
+func (s *Sender) DownlinkTXAck(ch chan gw.DownlinkTXAck, pl gw.DownlinkTXAck) {
+	select {
+	case ch <- pl:
+	default:
+		channelFullCounter(s.backend, "downlink_tx_ack").Inc()
+		ch <- pl
+	}
+}
+
+// RawPacketForwarderEvent sends the given raw packet-forwarder event.
+func (s *Sender) RawPacketForwarderEvent(ch chan gw.RawPacketForwarderEvent, pl gw.RawPacketForwarderEvent) {
+	s.send("raw_packet_forwarder_event", cap(ch),
+		func() bool {
+			select {
+			case ch <- pl:
+				return true
+			default:
+				return false
+			}
+		},
+		func() bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		},
+		func() { ch <- pl },
+	)
+}
+
+// LogEvent sends the given log event.
+func (s *Sender) LogEvent(ch chan events.Log, pl events.Log) {
+	s.send("log_event", cap(ch),
+		func() bool {
+			select {
+			case ch <- pl:
+				return true
+			default:
+				return false
+			}
+		},
+		func() bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		},
+		func() { ch <- pl },
+	)
+}
+
+// send implements the drop policy, given the non-blocking send and receive
+// and the blocking send functions of the channel. As an unbuffered channel
+// does not contain an oldest event, the send blocks for unbuffered channels.
+func (s *Sender) send(channel string, size int, trySend, tryDrop func() bool, send func()) {
+	if trySend() {
+		return
+	}
+
+	channelFullCounter(s.backend, channel).Inc()
+
+	if !s.dropOldest || size == 0 {
+		send()
+		return
+	}
+
+	for {
+		if tryDrop() {
+			channelDropCounter(s.backend, channel).Inc()
+		}
+
+		if trySend() {
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestSender(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Backend.Channels.DropPolicy = DropPolicyBlock
+		s := NewSender("test_block", conf)
+
+		ch := make(chan gw.GatewayStats, 1)
+		s.GatewayStats(ch, gw.GatewayStats{Ip: "1"})
+
+		done := make(chan struct{})
+		go func() {
+			s.GatewayStats(ch, gw.GatewayStats{Ip: "2"})
+			close(done)
+		}()
+
+		assert.Equal("1", (<-ch).Ip)
+		<-done
+		assert.Equal("2", (<-ch).Ip)
+
+		assert.Equal(float64(0), testutil.ToFloat64(channelDropCounter("test_block", "gateway_stats")))
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Backend.Channels.DropPolicy = DropPolicyDropOldest
+		s := NewSender("test_drop_oldest", conf)
+
+		ch := make(chan gw.UplinkFrame, 2)
+		for _, b := range []byte{1, 2, 3, 4} {
+			s.UplinkFrame(ch, gw.UplinkFrame{PhyPayload: []byte{b}})
+		}
+
+		assert.Equal([]byte{3}, (<-ch).PhyPayload)
+		assert.Equal([]byte{4}, (<-ch).PhyPayload)
+
+		assert.Equal(float64(2), testutil.ToFloat64(channelFullCounter("test_drop_oldest", "uplink_frame")))
+		assert.Equal(float64(2), testutil.ToFloat64(channelDropCounter("test_drop_oldest", "uplink_frame")))
+	})
+
+	t.Run("drop oldest does not drop tx acks", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Backend.Channels.DropPolicy = DropPolicyDropOldest
+		s := NewSender("test_drop_oldest_ack", conf)
+
+		ch := make(chan gw.DownlinkTXAck, 1)
+		s.DownlinkTXAck(ch, gw.DownlinkTXAck{Token: 1})
+
+		done := make(chan struct{})
+		go func() {
+			s.DownlinkTXAck(ch, gw.DownlinkTXAck{Token: 2})
+			close(done)
+		}()
+
+		// the second ack blocks until the first ack has been received
+		assert.Eventually(func() bool {
+			return testutil.ToFloat64(channelFullCounter("test_drop_oldest_ack", "downlink_tx_ack")) == 1
+		}, time.Second, time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("tx ack must not be dropped")
+		default:
+		}
+
+		assert.Equal(uint32(1), (<-ch).Token)
+		<-done
+		assert.Equal(uint32(2), (<-ch).Token)
+
+		assert.Equal(float64(0), testutil.ToFloat64(channelDropCounter("test_drop_oldest_ack", "downlink_tx_ack")))
+	})
+}
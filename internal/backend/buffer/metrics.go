@@ -0,0 +1,26 @@
+package buffer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cfc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_channel_full_count",
+		Help: "The number of times an event could not be passed to the forwarder immediately because the channel was full (per backend and channel).",
+	}, []string{"backend", "channel"})
+
+	cdc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_channel_drop_count",
+		Help: "The number of events dropped because the channel was full, when using the drop_oldest drop policy (per backend and channel).",
+	}, []string{"backend", "channel"})
+)
+
+func channelFullCounter(backend, channel string) prometheus.Counter {
+	return cfc.With(prometheus.Labels{"backend": backend, "channel": channel})
+}
+
+func channelDropCounter(backend, channel string) prometheus.Counter {
+	return cdc.With(prometheus.Labels{"backend": backend, "channel": channel})
+}
@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/lorawan"
+)
+
+// maxCounterJump defines the max. difference between the elapsed wall-clock
+// time and the elapsed concentrator counter time of two consecutive counter
+// values. A bigger difference indicates that the concentrator counter has
+// been reset (e.g. after a packet-forwarder restart).
+const maxCounterJump = time.Second
+
+// gatewayClock contains the extended concentrator clock of a single gateway.
+type gatewayClock struct {
+	counter  uint32    // last 32 bit counter value
+	extended uint64    // last extended (64 bit) counter value
+	lastSeen time.Time // wall-clock time of the last counter value
+}
+
+// concentratorClock tracks, per gateway, the 32 bit concentrator counter
+// (e.g. the Semtech UDP tmst) as an extended 64 bit monotonic clock. The
+// 32 bit microsecond counter rolls over every ~71.6 minutes, the extended
+// clock keeps counting across the rollover such that concentrator counter
+// values before and after the rollover can be compared.
+type concentratorClock struct {
+	sync.Mutex
+	gateways map[lorawan.EUI64]*gatewayClock
+}
+
+func newConcentratorClock() *concentratorClock {
+	return &concentratorClock{
+		gateways: make(map[lorawan.EUI64]*gatewayClock),
+	}
+}
+
+// update updates the clock of the gateway with the given counter value,
+// received at the given time. It returns the extended counter value.
+func (c *concentratorClock) update(gatewayID lorawan.EUI64, counter uint32, now time.Time) uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	g, ok := c.gateways[gatewayID]
+	if !ok {
+		g = &gatewayClock{
+			counter:  counter,
+			extended: uint64(counter),
+			lastSeen: now,
+		}
+		c.gateways[gatewayID] = g
+		return g.extended
+	}
+
+	// The expected counter value is based on the elapsed wall-clock time.
+	// The counter value is extended to the value nearest to the expected
+	// value, such that the rollover is handled, also when no counter value
+	// has been seen for more than half of the counter period.
+	expected := int64(now.Sub(g.lastSeen) / time.Microsecond)
+	delta := expected + int64(int32(counter-g.counter-uint32(expected)))
+
+	jump := time.Duration(delta-expected) * time.Microsecond
+	if jump < 0 {
+		jump = -jump
+	}
+
+	if jump > maxCounterJump {
+		// the counter has been reset, continue the extended clock from
+		// the expected value such that it stays monotonic
+		log.WithFields(log.Fields{
+			"gateway_id":   gatewayID,
+			"counter":      counter,
+			"last_counter": g.counter,
+		}).Warning("backend/scheduler: concentrator counter reset detected")
+		concentratorClockCounter("reset").Inc()
+
+		if expected < 0 {
+			expected = 0
+		}
+		g.counter = counter
+		g.extended += uint64(expected)
+		g.lastSeen = now
+		return g.extended
+	}
+
+	extended := uint64(int64(g.extended) + delta)
+
+	// out-of-order counter values do not update the clock
+	if extended <= g.extended {
+		return extended
+	}
+
+	if extended>>32 != g.extended>>32 {
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"extended":   extended,
+		}).Debug("backend/scheduler: concentrator counter rollover")
+		concentratorClockCounter("rollover").Inc()
+	}
+
+	g.counter = counter
+	g.extended = extended
+	g.lastSeen = now
+	return extended
+}
+
+// txWait returns the duration until the given delay after the given counter
+// value, at the given time. The counter value must be a recent counter value
+// of the gateway (e.g. the counter of the uplink to which the downlink
+// responds). It returns false when the gateway clock is unknown or when the
+// counter value is not within the given max. age.
+func (c *concentratorClock) txWait(gatewayID lorawan.EUI64, counter uint32, delay time.Duration, maxAge time.Duration, now time.Time) (time.Duration, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	g, ok := c.gateways[gatewayID]
+	if !ok {
+		return 0, false
+	}
+
+	// the counter value relative to the last counter value
+	offset := time.Duration(int32(counter-g.counter)) * time.Microsecond
+	if offset < -maxAge || offset > maxCounterJump {
+		return 0, false
+	}
+
+	rx := int64(g.extended) + int64(offset/time.Microsecond)
+	tx := rx + int64(delay/time.Microsecond)
+	current := int64(g.extended) + int64(now.Sub(g.lastSeen)/time.Microsecond)
+
+	return time.Duration(tx-current) * time.Microsecond, true
+}
@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestConcentratorClock(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	start := time.Now()
+
+	tests := []struct {
+		Name             string
+		Counter          uint32
+		Elapsed          time.Duration
+		ExpectedExtended uint64
+	}{
+		{
+			Name:             "first counter",
+			Counter:          0xfff00000,
+			ExpectedExtended: 0xfff00000,
+		},
+		{
+			Name:             "out of order",
+			Counter:          0xffefff00,
+			Elapsed:          time.Millisecond,
+			ExpectedExtended: 0xffefff00,
+		},
+		{
+			Name:             "before rollover",
+			Counter:          0xfff80000,
+			Elapsed:          524288 * time.Microsecond,
+			ExpectedExtended: 0xfff80000,
+		},
+		{
+			Name:             "after rollover",
+			Counter:          0x00080000,
+			Elapsed:          2 * 524288 * time.Microsecond,
+			ExpectedExtended: 0x100080000,
+		},
+		{
+			Name:             "idle for more than half the counter period",
+			Counter:          0x00080000,
+			Elapsed:          2*524288*time.Microsecond + 0x100000000*time.Microsecond,
+			ExpectedExtended: 0x200080000,
+		},
+		{
+			Name:             "counter reset",
+			Counter:          0x00000010,
+			Elapsed:          2*524288*time.Microsecond + 0x100000000*time.Microsecond + time.Minute,
+			ExpectedExtended: 0x200080000 + uint64(time.Minute/time.Microsecond),
+		},
+	}
+
+	c := newConcentratorClock()
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.ExpectedExtended, c.update(gatewayID, tst.Counter, start.Add(tst.Elapsed)))
+		})
+	}
+
+	t.Run("tx wait across rollover", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := newConcentratorClock()
+		c.update(gatewayID, 0xffffff00, start)
+
+		// the tx counter (0xffffff00 + 1s) rolls over
+		wait, ok := c.txWait(gatewayID, 0xffffff00, time.Second, time.Minute, start.Add(100*time.Millisecond))
+		assert.True(ok)
+		assert.Equal(900*time.Millisecond, wait)
+
+		// uplink after the rollover, the downlink context is before the
+		// rollover
+		c.update(gatewayID, 0x00000100, start.Add(512*time.Microsecond))
+		wait, ok = c.txWait(gatewayID, 0xffffff00, time.Second, time.Minute, start.Add(100*time.Millisecond))
+		assert.True(ok)
+		assert.Equal(900*time.Millisecond, wait)
+	})
+
+	t.Run("tx wait unknown", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, ok := c.txWait(lorawan.EUI64{}, 0, time.Second, time.Minute, start)
+		assert.False(ok)
+
+		// the counter is too old
+		counter := uint32(0x00000010)
+		counter -= uint32(2 * time.Minute / time.Microsecond)
+		_, ok = c.txWait(gatewayID, counter, time.Second, time.Minute, start)
+		assert.False(ok)
+	})
+}
@@ -0,0 +1,107 @@
+package concentratord
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/ism2400"
+)
+
+// Bandwidth units used by the Concentratord for the LoRa bandwidth.
+const (
+	bandwidthUnitAuto = "auto"
+	bandwidthUnitHz   = "hz"
+	bandwidthUnitKHz  = "khz"
+)
+
+// bandwidthConverter converts the LoRa bandwidth between the unit used by
+// the ChirpStack Gateway Bridge (kHz) and the unit used by the Concentratord.
+//
+// In auto mode, the unit is detected from the first uplink. Until the unit
+// has been detected, Hz is assumed, thus downlinks sent before the first
+// uplink are sent using Hz. The unit can't be derived from the Concentratord
+// version, the version is only informational (it is logged once the unit
+// has been detected). Set the unit explicitly when downlinks must be sent
+// before the first uplink has been received.
+type bandwidthConverter struct {
+	sync.RWMutex
+
+	auto     bool
+	detected bool
+	unit     string
+
+	// version holds the Concentratord version, for logging only.
+	version string
+}
+
+func newBandwidthConverter(unit, version string) (*bandwidthConverter, error) {
+	c := bandwidthConverter{
+		unit:    unit,
+		version: version,
+	}
+
+	switch unit {
+	case bandwidthUnitAuto, "":
+		c.auto = true
+		c.unit = bandwidthUnitHz
+	case bandwidthUnitHz, bandwidthUnitKHz:
+	default:
+		return nil, fmt.Errorf("invalid bandwidth unit: %s", unit)
+	}
+
+	return &c, nil
+}
+
+// detect detects the bandwidth unit from the given uplink bandwidth. This is
+// a no-op when the unit is not set to auto or when it has already been
+// detected.
+func (c *bandwidthConverter) detect(bw uint32) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.auto || c.detected {
+		return
+	}
+
+	switch {
+	case bw == 125 || bw == 250 || bw == 500 || ism2400.IsBandwidth(bw):
+		c.unit = bandwidthUnitKHz
+	case bw >= 125000:
+		c.unit = bandwidthUnitHz
+	default:
+		return
+	}
+
+	c.detected = true
+
+	log.WithFields(log.Fields{
+		"bandwidth_unit": c.unit,
+		"version":        c.version,
+	}).Info("backend/concentratord: bandwidth unit detected")
+}
+
+// toKHz converts the bandwidth received from the Concentratord to kHz.
+func (c *bandwidthConverter) toKHz(bw uint32) uint32 {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.unit == bandwidthUnitHz {
+		return ism2400.BandwidthKHz(bw)
+	}
+	return bw
+}
+
+// fromKHz converts the given bandwidth in kHz to the unit used by the
+// Concentratord. The (truncated) LoRa 2.4 GHz bandwidths are converted to
+// the exact bandwidth in Hz.
+func (c *bandwidthConverter) fromKHz(bw uint32) uint32 {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.unit == bandwidthUnitHz {
+		return ism2400.BandwidthHz(bw)
+	}
+	return bw
+}
@@ -0,0 +1,70 @@
+package concentratord
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthConverter(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Unit         string
+		Uplink       uint32
+		ExpectedUnit string
+	}{
+		{"auto defaults to hz", bandwidthUnitAuto, 0, bandwidthUnitHz},
+		{"auto detects hz", bandwidthUnitAuto, 250000, bandwidthUnitHz},
+		{"auto detects khz", bandwidthUnitAuto, 250, bandwidthUnitKHz},
+		{"auto detects 2.4 ghz hz", bandwidthUnitAuto, 812500, bandwidthUnitHz},
+		{"auto detects 2.4 ghz khz", bandwidthUnitAuto, 812, bandwidthUnitKHz},
+		{"hz is not overridden", bandwidthUnitHz, 125, bandwidthUnitHz},
+		{"khz is not overridden", bandwidthUnitKHz, 125000, bandwidthUnitKHz},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			c, err := newBandwidthConverter(tst.Unit, "")
+			assert.NoError(err)
+
+			if tst.Uplink != 0 {
+				c.detect(tst.Uplink)
+			}
+			assert.Equal(tst.ExpectedUnit, c.unit)
+		})
+	}
+
+	t.Run("detected once", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := newBandwidthConverter(bandwidthUnitAuto, "")
+		assert.NoError(err)
+
+		c.detect(125)
+		c.detect(125000)
+		assert.Equal(bandwidthUnitKHz, c.unit)
+		assert.EqualValues(125, c.toKHz(125))
+		assert.EqualValues(125, c.fromKHz(125))
+	})
+
+	t.Run("2.4 ghz bandwidth", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := newBandwidthConverter(bandwidthUnitHz, "")
+		assert.NoError(err)
+
+		assert.EqualValues(812, c.toKHz(812500))
+		assert.EqualValues(812500, c.fromKHz(812))
+		assert.EqualValues(1625000, c.fromKHz(1625))
+		assert.EqualValues(125000, c.fromKHz(125))
+	})
+
+	t.Run("invalid unit", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := newBandwidthConverter("mhz", "")
+		assert.EqualError(err, "invalid bandwidth unit: mhz")
+	})
+}
@@ -1,160 +1,157 @@
 package concentratord
 
 import (
-	"context"
+	"encoding/hex"
 	"sync"
 	"time"
 
-	"github.com/go-zeromq/zmq4"
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/logging"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
 	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
 )
 
+// eventHandler handles the payload of a single event type.
+type eventHandler func(i *instance, bb []byte) error
+
 // Backend implements a ConcentratorD backend.
 type Backend struct {
-	eventSockCancel   func()
-	commandSockCancel func()
-	eventSock         zmq4.Socket
-	commandSock       zmq4.Socket
-	commandMux        sync.Mutex
+	instances []*instance
+
+	// eventHandlers contains the handlers per event type.
+	eventHandlers map[string]eventHandler
 
-	downlinkTXAckChan  chan gw.DownlinkTXAck
-	uplinkFrameChan    chan gw.UplinkFrame
-	gatewayStatsChan   chan gw.GatewayStats
-	subscribeEventChan chan events.Subscribe
-	disconnectChan     chan lorawan.EUI64
+	// unknownEvents contains the unknown event types which have been logged.
+	unknownEventsMux sync.Mutex
+	unknownEvents    map[string]struct{}
 
-	eventURL   string
-	commandURL string
+	downlinkTXAckChan           chan gw.DownlinkTXAck
+	uplinkFrameChan             chan gw.UplinkFrame
+	gatewayStatsChan            chan gw.GatewayStats
+	rawPacketForwarderEventChan chan gw.RawPacketForwarderEvent
+	subscribeEventChan          chan events.Subscribe
+	sender                      *buffer.Sender
 
-	gatewayID lorawan.EUI64
+	// connected contains the number of connected instances per gateway ID.
+	connectedMux sync.Mutex
+	connected    map[lorawan.EUI64]int
 
 	crcCheck bool
+
+	// mesh is set when the gateway mesh (relay) support is enabled.
+	mesh *mesh
 }
 
 // NewBackend creates a new Backend.
 func NewBackend(conf config.Config) (*Backend, error) {
+	instances := conf.Backend.Concentratord.Instances
+	if len(instances) == 0 {
+		instances = []config.ConcentratordInstance{
+			{
+				EventURL:   conf.Backend.Concentratord.EventURL,
+				CommandURL: conf.Backend.Concentratord.CommandURL,
+			},
+		}
+	}
+
 	log.WithFields(log.Fields{
-		"event_url":   conf.Backend.Concentratord.EventURL,
-		"command_url": conf.Backend.Concentratord.CommandURL,
+		"instances": len(instances),
 	}).Info("backend/concentratord: setting up backend")
 
 	b := Backend{
-		downlinkTXAckChan:  make(chan gw.DownlinkTXAck, 1),
-		uplinkFrameChan:    make(chan gw.UplinkFrame, 1),
-		gatewayStatsChan:   make(chan gw.GatewayStats, 1),
-		subscribeEventChan: make(chan events.Subscribe, 1),
-
-		eventURL:   conf.Backend.Concentratord.EventURL,
-		commandURL: conf.Backend.Concentratord.CommandURL,
+		downlinkTXAckChan:           make(chan gw.DownlinkTXAck, conf.Backend.Channels.DownlinkTXAckSize),
+		uplinkFrameChan:             make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:            make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
+		rawPacketForwarderEventChan: make(chan gw.RawPacketForwarderEvent, conf.Backend.Channels.RawPacketForwarderEventSize),
+		subscribeEventChan:          make(chan events.Subscribe, len(instances)),
+		connected:                   make(map[lorawan.EUI64]int),
+		unknownEvents:               make(map[string]struct{}),
+		sender:                      buffer.NewSender("concentratord", conf),
 
 		crcCheck: conf.Backend.Concentratord.CRCCheck,
 	}
 
-	b.dialEventSockLoop()
-	b.dialCommandSockLoop()
-
-	var err error
-	b.gatewayID, err = b.getGatewayID()
-	if err != nil {
-		return nil, errors.Wrap(err, "get gateway id error")
+	b.eventHandlers = map[string]eventHandler{
+		"up":       b.handleUplinkFrame,
+		"stats":    b.handleGatewayStats,
+		"raw":      b.handleRawEvent,
+		"gps":      b.handleGPSEvent,
+		"timesync": b.handleTimeSyncEvent,
 	}
 
-	b.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: b.gatewayID}
-
-	go b.eventLoop()
-
-	return &b, nil
-}
-
-func (b *Backend) dialEventSock() error {
-	ctx := context.Background()
-	ctx, b.eventSockCancel = context.WithCancel(ctx)
-
-	b.eventSock = zmq4.NewSub(ctx)
-	err := b.eventSock.Dial(b.eventURL)
-	if err != nil {
-		return errors.Wrap(err, "dial event api url error")
+	if conf.Backend.Concentratord.Mesh.Enabled {
+		m, err := newMesh(conf)
+		if err != nil {
+			return nil, errors.Wrap(err, "new mesh error")
+		}
+		b.mesh = m
 	}
 
-	err = b.eventSock.SetOption(zmq4.OptionSubscribe, "")
-	if err != nil {
-		return errors.Wrap(err, "set event option error")
+	for _, c := range instances {
+		i, err := newInstance(c.EventURL, c.CommandURL, conf.Backend.Concentratord.BandwidthUnit, conf.Backend.Concentratord.CommandTimeout)
+		if err != nil {
+			b.Close()
+			return nil, errors.Wrap(err, "new concentratord instance error")
+		}
+		b.instances = append(b.instances, i)
 	}
 
-	log.WithFields(log.Fields{
-		"event_url": b.eventURL,
-	}).Info("backend/concentratord: connected to event socket")
-
-	return nil
-}
-
-func (b *Backend) dialCommandSock() error {
-	ctx := context.Background()
-	ctx, b.commandSockCancel = context.WithCancel(ctx)
+	// Instances reporting the same gateway ID (e.g. a multi-board gateway
+	// running a Concentratord per board) are distinguished by the board
+	// field. The subscribe event is sent once per distinct gateway ID.
+	boards := make(map[lorawan.EUI64][]*instance)
+	for _, i := range b.instances {
+		if _, ok := boards[i.gatewayID]; !ok {
+			b.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: i.gatewayID, ConnState: i.connState()}
+		}
 
-	b.commandSock = zmq4.NewReq(ctx)
-	err := b.commandSock.Dial(b.commandURL)
-	if err != nil {
-		return errors.Wrap(err, "dial command api url error")
+		i.board = uint32(len(boards[i.gatewayID]))
+		boards[i.gatewayID] = append(boards[i.gatewayID], i)
+		b.connected[i.gatewayID]++
 	}
-
-	log.WithFields(log.Fields{
-		"command_url": b.eventURL,
-	}).Info("backend/concentratord: connected to command socket")
-
-	return nil
-}
-
-func (b *Backend) dialCommandSockLoop() {
-	for {
-		if err := b.dialCommandSock(); err != nil {
-			log.WithError(err).Error("backend/concentratord: command socket dial error")
-			time.Sleep(time.Second)
-			continue
+	// When all instances belong to a single gateway, the gateway ID is added
+	// to all log entries.
+	if len(boards) == 1 {
+		for gatewayID := range boards {
+			logging.SetGatewayID(gatewayID)
 		}
-		break
 	}
-}
 
-func (b *Backend) dialEventSockLoop() {
-	for {
-		if err := b.dialEventSock(); err != nil {
-			log.WithError(err).Error("backend/concentratord: event socket dial error")
-			time.Sleep(time.Second)
+	for _, shared := range boards {
+		if len(shared) < 2 {
 			continue
 		}
-		break
-	}
-}
 
-func (b *Backend) getGatewayID() (lorawan.EUI64, error) {
-	var gatewayID lorawan.EUI64
-
-	bb, err := b.commandRequest("gateway_id", nil)
-	if err != nil {
-		return gatewayID, errors.Wrap(err, "request gateway id error")
+		for _, i := range shared {
+			i.shared = true
+		}
 	}
 
-	copy(gatewayID[:], bb)
+	for _, i := range b.instances {
+		go i.eventLoop(b.handleEvent, b.handleConnected)
+	}
 
-	return gatewayID, nil
+	return &b, nil
 }
 
 // Close closes the backend.
 func (b *Backend) Close() error {
-	b.eventSock.Close()
-	b.commandSock.Close()
-
-	b.eventSockCancel()
-	b.commandSockCancel()
+	for _, i := range b.instances {
+		i.close()
+	}
 
 	return nil
 }
@@ -181,9 +178,28 @@ func (b *Backend) GetSubscribeEventChan() chan events.Subscribe {
 
 // SendDownlinkFrame sends the given downlink frame.
 func (b *Backend) SendDownlinkFrame(pl gw.DownlinkFrame) error {
+	// the frame is modified below (e.g. the bandwidth unit), the TX info
+	// must not be modified for the caller
+	pl = *proto.Clone(&pl).(*gw.DownlinkFrame)
+
+	i, err := b.getDownlinkInstance(pl)
+	if err != nil {
+		return errors.Wrap(err, "get concentratord instance error")
+	}
+
+	if b.mesh != nil {
+		ok, err := b.mesh.wrapDownlink(&pl)
+		if err != nil {
+			return errors.Wrap(err, "wrap mesh downlink error")
+		}
+		if ok {
+			meshCounter("down").Inc()
+		}
+	}
+
 	loRaModInfo := pl.GetTxInfo().GetLoraModulationInfo()
 	if loRaModInfo != nil {
-		loRaModInfo.Bandwidth = loRaModInfo.Bandwidth * 1000
+		loRaModInfo.Bandwidth = i.bandwidth.fromKHz(loRaModInfo.Bandwidth)
 	}
 
 	var downlinkID uuid.UUID
@@ -191,11 +207,12 @@ func (b *Backend) SendDownlinkFrame(pl gw.DownlinkFrame) error {
 
 	log.WithFields(log.Fields{
 		"downlink_id": downlinkID,
+		"command_url": i.commandURL,
 	}).Info("backend/concentratord: forwarding downlink command")
 
-	bb, err := b.commandRequest("down", &pl)
+	bb, err := i.commandRequest("down", &pl)
 	if err != nil {
-		log.WithError(err).Fatal("backend/concentratord: send downlink command error")
+		return errors.Wrap(err, "send downlink command error")
 	}
 	if len(bb) == 0 {
 		return errors.New("no reply receieved, check concentratord logs for error")
@@ -203,118 +220,190 @@ func (b *Backend) SendDownlinkFrame(pl gw.DownlinkFrame) error {
 
 	var ack gw.DownlinkTXAck
 	if err = proto.Unmarshal(bb, &ack); err != nil {
+		unmarshalErrorCounter("down").Inc()
 		return errors.Wrap(err, "protobuf unmarshal error")
 	}
 
-	b.downlinkTXAckChan <- ack
+	b.sender.DownlinkTXAck(b.downlinkTXAckChan, ack)
 
 	commandCounter("down").Inc()
 
 	return nil
 }
 
-// ApplyConfiguration is not implemented.
-func (b *Backend) ApplyConfiguration(gw.GatewayConfiguration) error {
-	return nil
+// getDownlinkInstance returns the instance for the given downlink frame.
+// When multiple instances report the same gateway ID, the board field of the
+// TX info is used to select the instance (see handleUplinkFrame), in which
+// case the board field is reset before sending the downlink.
+func (b *Backend) getDownlinkInstance(pl gw.DownlinkFrame) (*instance, error) {
+	if len(b.instances) == 1 {
+		return b.instances[0], nil
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], pl.GetTxInfo().GetGatewayId())
+
+	for _, i := range b.instances {
+		if i.gatewayID != gatewayID {
+			continue
+		}
+
+		if !i.shared {
+			return i, nil
+		}
+
+		if pl.GetTxInfo().GetBoard() == i.board {
+			if pl.TxInfo != nil {
+				pl.TxInfo.Board = 0
+			}
+			return i, nil
+		}
+	}
+
+	return nil, errors.Errorf("no concentratord instance for gateway_id: %s, board: %d", gatewayID, pl.GetTxInfo().GetBoard())
 }
 
-// GetRawPacketForwarderEventChan returns nil.
+// GetRawPacketForwarderEventChan returns the channel for raw packet-forwarder
+// events.
 func (b *Backend) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEvent {
-	return nil
+	return b.rawPacketForwarderEventChan
 }
 
-// RawPacketForwarderCommand is not implemented.
-func (b *Backend) RawPacketForwarderCommand(gw.RawPacketForwarderCommand) error {
+// GetLogEventChan returns nil.
+func (b *Backend) GetLogEventChan() chan events.Log {
 	return nil
 }
 
-func (b *Backend) commandRequest(command string, v proto.Message) ([]byte, error) {
-	b.commandMux.Lock()
-	defer b.commandMux.Unlock()
+// RawPacketForwarderCommand forwards the given raw command to the raw command
+// endpoint of the Concentratord. A non-empty reply is passed to the forwarder
+// as raw packet-forwarder event, using the raw ID of the command.
+func (b *Backend) RawPacketForwarderCommand(pl gw.RawPacketForwarderCommand) error {
+	var gatewayID lorawan.EUI64
+	var rawID uuid.UUID
 
-	var bb []byte
-	var err error
+	copy(gatewayID[:], pl.GatewayId)
+	copy(rawID[:], pl.RawId)
 
-	if v != nil {
-		bb, err = proto.Marshal(v)
-		if err != nil {
-			return nil, errors.Wrap(err, "protobuf marshal error")
-		}
+	if len(pl.Payload) == 0 {
+		return errors.New("raw packet-forwarder command payload is empty")
 	}
 
-	msg := zmq4.NewMsgFrom([]byte(command), bb)
-	if err = b.commandSock.SendMulti(msg); err != nil {
-		b.commandSockCancel()
-		b.dialCommandSock()
-		return nil, errors.Wrap(err, "send command request error")
+	i, err := b.getInstance(gatewayID)
+	if err != nil {
+		return errors.Wrap(err, "get concentratord instance error")
 	}
 
-	reply, err := b.commandSock.Recv()
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"raw_id":      rawID,
+		"command_url": i.commandURL,
+	}).Info("backend/concentratord: forwarding raw packet-forwarder command")
+
+	bb, err := i.commandRequest("raw", &pl)
 	if err != nil {
-		b.commandSockCancel()
-		b.dialCommandSock()
-		return nil, errors.Wrap(err, "receive command request reply error")
+		return errors.Wrap(err, "send raw packet-forwarder command error")
+	}
+
+	commandCounter("raw").Inc()
+
+	if len(bb) == 0 {
+		return nil
+	}
+
+	var event gw.RawPacketForwarderEvent
+	if err = proto.Unmarshal(bb, &event); err != nil {
+		unmarshalErrorCounter("raw").Inc()
+		return errors.Wrap(err, "protobuf unmarshal error")
+	}
+	if len(event.RawId) == 0 {
+		event.RawId = pl.RawId
 	}
 
-	return reply.Bytes(), nil
+	return b.handleRawPacketForwarderEvent(i, event)
 }
 
-func (b *Backend) eventLoop() {
-	for {
-		msg, err := b.eventSock.Recv()
-		if err != nil {
-			log.WithError(err).Error("backend/concentratord: receive event message error")
-
-			// We need to recover both the event and command sockets.
-			func() {
-				b.commandMux.Lock()
-				defer b.commandMux.Unlock()
-
-				b.eventSockCancel()
-				b.commandSockCancel()
-				b.dialEventSockLoop()
-				b.dialCommandSockLoop()
-			}()
-			continue
-		}
+// getInstance returns the first instance reporting the given gateway ID.
+func (b *Backend) getInstance(gatewayID lorawan.EUI64) (*instance, error) {
+	if len(b.instances) == 1 {
+		return b.instances[0], nil
+	}
 
-		if len(msg.Frames) == 0 {
-			continue
+	for _, i := range b.instances {
+		if i.gatewayID == gatewayID {
+			return i, nil
 		}
+	}
 
-		if len(msg.Frames) != 2 {
-			log.WithFields(log.Fields{
-				"frame_count": len(msg.Frames),
-			}).Error("backend/concentratord: expected 2 frames in event message")
-			continue
-		}
+	return nil, errors.Errorf("no concentratord instance for gateway_id: %s", gatewayID)
+}
 
-		switch string(msg.Frames[0]) {
-		case "up":
-			err = b.handleUplinkFrame(msg.Frames[1])
-		case "stats":
-			err = b.handleGatewayStats(msg.Frames[1])
-		default:
-			log.WithFields(log.Fields{
-				"event": string(msg.Frames[0]),
-			}).Error("backend/concentratord: unexpected event received")
-			continue
-		}
+// handleConnected handles the (re)connection of the given instance. The
+// (un)subscribe event is sent when the first instance of a gateway connects
+// or when the last instance of a gateway disconnects.
+func (b *Backend) handleConnected(i *instance, connected bool, reason string) {
+	// The Concentratord might have been restarted with the configuration
+	// from its configuration file, therefore the configuration must be
+	// re-applied after a re-connect.
+	if !connected {
+		i.setConfigVersion("")
+	}
 
-		if err != nil {
-			log.WithError(err).WithFields(log.Fields{
-				"event": string(msg.Frames[0]),
-			}).Error("backend/concentratord: handle event error")
-		}
+	b.connectedMux.Lock()
+	if connected {
+		b.connected[i.gatewayID]++
+	} else {
+		b.connected[i.gatewayID]--
+	}
+	count := b.connected[i.gatewayID]
+	b.connectedMux.Unlock()
 
-		eventCounter(string(msg.Frames[0])).Inc()
+	if (connected && count != 1) || (!connected && count != 0) {
+		return
 	}
+
+	connState := i.connState()
+	connState.Reason = reason
+
+	b.subscribeEventChan <- events.Subscribe{Subscribe: connected, GatewayID: i.gatewayID, ConnState: connState}
+}
+
+func (b *Backend) handleEvent(i *instance, event string, bb []byte) error {
+	eventCounter(event).Inc()
+	health.BackendEvent()
+
+	handler, ok := b.eventHandlers[event]
+	if !ok {
+		b.handleUnknownEvent(event)
+		return nil
+	}
+
+	return handler(i, bb)
+}
+
+// handleUnknownEvent counts the unknown event. As newer Concentratord
+// versions might publish event types which are not (yet) supported, each
+// unknown event type is only logged once as warning.
+func (b *Backend) handleUnknownEvent(event string) {
+	unknownEventCounter(event).Inc()
+
+	b.unknownEventsMux.Lock()
+	_, logged := b.unknownEvents[event]
+	b.unknownEvents[event] = struct{}{}
+	b.unknownEventsMux.Unlock()
+
+	if logged {
+		log.WithField("event", event).Debug("backend/concentratord: unknown event received")
+		return
+	}
+
+	log.WithField("event", event).Warning("backend/concentratord: unknown event received, ignoring events of this type")
 }
 
-func (b *Backend) handleUplinkFrame(bb []byte) error {
+func (b *Backend) handleUplinkFrame(i *instance, bb []byte) error {
 	var pl gw.UplinkFrame
 	err := proto.Unmarshal(bb, &pl)
 	if err != nil {
+		unmarshalErrorCounter("up").Inc()
 		return errors.Wrap(err, "protobuf unmarshal error")
 	}
 
@@ -326,30 +415,68 @@ func (b *Backend) handleUplinkFrame(bb []byte) error {
 			"uplink_id":  uplinkID,
 			"crc_status": pl.GetRxInfo().GetCrcStatus(),
 		}).Debug("backend/concentratord: ignoring uplink event, CRC is not valid")
+		crcDroppedCounter().Inc()
 		return nil
 	}
 
 	loRaModInfo := pl.GetTxInfo().GetLoraModulationInfo()
 	if loRaModInfo != nil {
-		loRaModInfo.Bandwidth = loRaModInfo.Bandwidth / 1000
+		i.bandwidth.detect(loRaModInfo.Bandwidth)
+		loRaModInfo.Bandwidth = i.bandwidth.toKHz(loRaModInfo.Bandwidth)
+	}
+
+	// The board is set to the index of the instance, such that the downlink
+	// can be sent to the instance which received the uplink.
+	if i.shared && pl.RxInfo != nil {
+		pl.RxInfo.Board = i.board
+	}
+
+	if b.mesh != nil && isMeshFrame(pl.PhyPayload) {
+		up, err := b.mesh.unwrapUplink(&pl)
+		if err == nil {
+			log.WithFields(log.Fields{
+				"uplink_id": uplinkID,
+				"relay_id":  hex.EncodeToString(up.relayID[:]),
+				"hop_count": up.hopCount,
+			}).Debug("backend/concentratord: mesh uplink unwrapped")
+			meshCounter("up").Inc()
+		} else if err != errNotMeshFrame {
+			log.WithError(err).WithFields(log.Fields{
+				"uplink_id": uplinkID,
+			}).Error("backend/concentratord: unwrap mesh uplink error")
+			return nil
+		}
 	}
 
 	log.WithFields(log.Fields{
 		"uplink_id": uplinkID,
 	}).Info("backend/concentratord: uplink event received")
 
-	b.uplinkFrameChan <- pl
+	b.sender.UplinkFrame(b.uplinkFrameChan, pl)
 
 	return nil
 }
 
-func (b *Backend) handleGatewayStats(bb []byte) error {
+func (b *Backend) handleGatewayStats(i *instance, bb []byte) error {
 	var pl gw.GatewayStats
 	err := proto.Unmarshal(bb, &pl)
 	if err != nil {
+		unmarshalErrorCounter("stats").Inc()
 		return errors.Wrap(err, "protobuf unmarshal error")
 	}
 
+	// report the version of the configuration applied by ApplyConfiguration,
+	// such that the network server knows when (not) to re-send it
+	if pl.ConfigVersion == "" {
+		pl.ConfigVersion = i.getConfigVersion()
+	}
+
+	// report the location of the last gps event, when the stats do not
+	// contain a location
+	if pl.Location == nil {
+		pl.Location = i.getLocation()
+	}
+
 	var statsID uuid.UUID
 	copy(statsID[:], pl.GetStatsId())
 
@@ -357,7 +484,92 @@ func (b *Backend) handleGatewayStats(bb []byte) error {
 		"stats_id": statsID,
 	}).Info("backend/concentratord: stats event received")
 
-	b.gatewayStatsChan <- pl
+	b.sender.GatewayStats(b.gatewayStatsChan, pl)
+
+	return nil
+}
+
+// handleGPSEvent handles the gps event, containing the location of the
+// gateway (e.g. published by newer Concentratord versions on a GPS fix). The
+// location is reported in the gateway stats.
+func (b *Backend) handleGPSEvent(i *instance, bb []byte) error {
+	var pl common.Location
+	if err := proto.Unmarshal(bb, &pl); err != nil {
+		unmarshalErrorCounter("gps").Inc()
+		return errors.Wrap(err, "protobuf unmarshal error")
+	}
+
+	i.setLocation(&pl)
+
+	log.WithFields(log.Fields{
+		"gateway_id": i.gatewayID,
+		"latitude":   pl.Latitude,
+		"longitude":  pl.Longitude,
+		"altitude":   pl.Altitude,
+	}).Debug("backend/concentratord: gps event received")
+
+	return nil
+}
+
+// handleTimeSyncEvent handles the timesync event, containing the time since
+// GPS epoch of the concentrator clock. This is added as sample to the time
+// synchronization (when enabled).
+func (b *Backend) handleTimeSyncEvent(i *instance, bb []byte) error {
+	var pl duration.Duration
+	if err := proto.Unmarshal(bb, &pl); err != nil {
+		unmarshalErrorCounter("timesync").Inc()
+		return errors.Wrap(err, "protobuf unmarshal error")
+	}
+
+	d, err := ptypes.Duration(&pl)
+	if err != nil {
+		return errors.Wrap(err, "parse duration error")
+	}
+
+	gatewayTime := time.Time(gps.NewTimeFromTimeSinceGPSEpoch(d))
+	timesync.AddSample(i.gatewayID, gatewayTime, time.Now(), time.Microsecond)
+
+	log.WithFields(log.Fields{
+		"gateway_id":           i.gatewayID,
+		"time_since_gps_epoch": d,
+	}).Debug("backend/concentratord: timesync event received")
+
+	return nil
+}
+
+// handleRawEvent handles the raw packet-forwarder event.
+func (b *Backend) handleRawEvent(i *instance, bb []byte) error {
+	var pl gw.RawPacketForwarderEvent
+	if err := proto.Unmarshal(bb, &pl); err != nil {
+		unmarshalErrorCounter("raw").Inc()
+		return errors.Wrap(err, "protobuf unmarshal error")
+	}
+	return b.handleRawPacketForwarderEvent(i, pl)
+}
+
+// handleRawPacketForwarderEvent passes the given raw event to the forwarder.
+// The gateway ID is set to the gateway ID of the instance and a random raw ID
+// is set when the event does not have one.
+func (b *Backend) handleRawPacketForwarderEvent(i *instance, pl gw.RawPacketForwarderEvent) error {
+	pl.GatewayId = i.gatewayID[:]
+
+	if len(pl.RawId) == 0 {
+		rawID, err := uuid.NewV4()
+		if err != nil {
+			return errors.Wrap(err, "get random raw id error")
+		}
+		pl.RawId = rawID[:]
+	}
+
+	var rawID uuid.UUID
+	copy(rawID[:], pl.RawId)
+
+	log.WithFields(log.Fields{
+		"gateway_id": i.gatewayID,
+		"raw_id":     rawID,
+	}).Info("backend/concentratord: raw packet-forwarder event received")
+
+	b.sender.RawPacketForwarderEvent(b.rawPacketForwarderEventChan, pl)
 
 	return nil
 }
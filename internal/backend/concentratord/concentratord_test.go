@@ -6,19 +6,34 @@ import (
 	"io/ioutil"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-zeromq/zmq4"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
 	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
 )
 
+// setDefaultChannelSizes sets the channel sizes to the configuration defaults,
+// as the downlink TX ack is sent before SendDownlinkFrame returns.
+func setDefaultChannelSizes(conf *config.Config) {
+	conf.Backend.Channels.UplinkFrameSize = 1
+	conf.Backend.Channels.GatewayStatsSize = 1
+	conf.Backend.Channels.DownlinkTXAckSize = 1
+	conf.Backend.Channels.RawPacketForwarderEventSize = 1
+}
+
 type BackendTestSuite struct {
 	suite.Suite
 
@@ -47,6 +62,7 @@ func (ts *BackendTestSuite) SetupTest() {
 	conf.Backend.Concentratord.EventURL = fmt.Sprintf("ipc://%s/events", tempDir)
 	conf.Backend.Concentratord.CommandURL = fmt.Sprintf("ipc://%s/commands", tempDir)
 	conf.Backend.Concentratord.CRCCheck = true
+	setDefaultChannelSizes(&conf)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -56,13 +72,19 @@ func (ts *BackendTestSuite) SetupTest() {
 		assert.NoError(err)
 		assert.Equal("gateway_id", string(msg.Bytes()))
 		assert.NoError(ts.repSock.Send(zmq4.NewMsg([]byte{1, 2, 3, 4, 5, 6, 7, 8})))
+
+		// followed by the version request
+		msg, err = ts.repSock.Recv()
+		assert.NoError(err)
+		assert.Equal("version", string(msg.Bytes()))
+		assert.NoError(ts.repSock.Send(zmq4.NewMsg([]byte("3.0.0"))))
 		wg.Done()
 	}()
 
 	ts.backend, err = NewBackend(conf)
 	wg.Wait()
 	assert.NoError(err)
-
+	assert.Equal("3.0.0", ts.backend.instances[0].version)
 }
 
 func (ts *BackendTestSuite) TearDownTest() {
@@ -74,10 +96,11 @@ func (ts *BackendTestSuite) TestSubscribeEvent() {
 	assert := require.New(ts.T())
 
 	e := <-ts.backend.GetSubscribeEventChan()
-	assert.Equal(events.Subscribe{
-		Subscribe: true,
-		GatewayID: lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
-	}, e)
+	assert.True(e.Subscribe)
+	assert.Equal(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}, e.GatewayID)
+	assert.Equal("concentratord", e.ConnState.BackendType)
+	assert.Equal(ts.backend.instances[0].eventURL, e.ConnState.RemoteAddress)
+	assert.Equal("3.0.0", e.ConnState.ProtocolVersion)
 }
 
 func (ts *BackendTestSuite) TestGatewayStats() {
@@ -123,13 +146,50 @@ func (ts *BackendTestSuite) TestUplinkFrame() {
 	assert.True(proto.Equal(&uf, &recv))
 }
 
+func (ts *BackendTestSuite) TestUplinkFrameMetrics() {
+	assert := require.New(ts.T())
+
+	crcDropped := testutil.ToFloat64(crcDroppedCounter())
+	unmarshalErrors := testutil.ToFloat64(unmarshalErrorCounter("up"))
+	events := testutil.ToFloat64(eventCounter("up"))
+
+	uf := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		RxInfo: &gw.UplinkRXInfo{
+			CrcStatus: gw.CRCStatus_BAD_CRC,
+		},
+	}
+	b, err := proto.Marshal(&uf)
+	assert.NoError(err)
+
+	assert.NoError(ts.backend.handleEvent(ts.backend.instances[0], "up", b))
+	assert.Error(ts.backend.handleEvent(ts.backend.instances[0], "up", []byte{0xff}))
+
+	assert.Equal(crcDropped+1, testutil.ToFloat64(crcDroppedCounter()))
+	assert.Equal(unmarshalErrors+1, testutil.ToFloat64(unmarshalErrorCounter("up")))
+	assert.Equal(events+2, testutil.ToFloat64(eventCounter("up")))
+}
+
 func (ts *BackendTestSuite) TestSendDownlinkFrame() {
 	assert := require.New(ts.T())
 
 	down := gw.DownlinkFrame{
 		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:       125,
+					SpreadingFactor: 7,
+				},
+			},
+		},
 	}
-	downB, err := proto.Marshal(&down)
+
+	// the bandwidth is sent in the unit of the concentratord (Hz)
+	sent := proto.Clone(&down).(*gw.DownlinkFrame)
+	sent.TxInfo.GetLoraModulationInfo().Bandwidth = 125000
+	downB, err := proto.Marshal(sent)
 	assert.NoError(err)
 
 	ack := gw.DownlinkTXAck{
@@ -150,6 +210,663 @@ func (ts *BackendTestSuite) TestSendDownlinkFrame() {
 
 	recv := <-ts.backend.GetDownlinkTXAckChan()
 	assert.True(proto.Equal(&ack, &recv))
+
+	// the frame of the caller is not modified
+	assert.EqualValues(125, down.TxInfo.GetLoraModulationInfo().Bandwidth)
+}
+
+func (ts *BackendTestSuite) TestApplyConfiguration() {
+	assert := require.New(ts.T())
+
+	newConfig := func(version string) gw.GatewayConfiguration {
+		return gw.GatewayConfiguration{
+			GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Version:   version,
+			Channels: []*gw.ChannelConfiguration{
+				{
+					Frequency:  868100000,
+					Modulation: common.Modulation_LORA,
+					ModulationConfig: &gw.ChannelConfiguration_LoraModulationConfig{
+						LoraModulationConfig: &gw.LoRaModulationConfig{
+							Bandwidth:        125,
+							SpreadingFactors: []uint32{7, 8, 9, 10, 11, 12},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	configs := make(chan gw.GatewayConfiguration, 2)
+	go func() {
+		for n := 0; n < 2; n++ {
+			msg, err := ts.repSock.Recv()
+			assert.NoError(err)
+			assert.Equal("config", string(msg.Frames[0]))
+
+			var pl gw.GatewayConfiguration
+			assert.NoError(proto.Unmarshal(msg.Frames[1], &pl))
+			configs <- pl
+
+			assert.NoError(ts.repSock.Send(zmq4.NewMsg(nil)))
+		}
+	}()
+
+	// the bandwidth is converted to the unit of the concentratord (Hz)
+	assert.NoError(ts.backend.ApplyConfiguration(newConfig("1")))
+	pl := <-configs
+	assert.Equal("1", pl.Version)
+	assert.EqualValues(125000, pl.Channels[0].GetLoraModulationConfig().Bandwidth)
+
+	// the same version is not re-applied
+	assert.NoError(ts.backend.ApplyConfiguration(newConfig("1")))
+	assert.NoError(ts.backend.ApplyConfiguration(newConfig("2")))
+	pl = <-configs
+	assert.Equal("2", pl.Version)
+
+	// the applied version is reported in the stats
+	stats := gw.GatewayStats{
+		GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	b, err := proto.Marshal(&stats)
+	assert.NoError(err)
+
+	assert.NoError(ts.pubSock.SendMulti(zmq4.Msg{
+		Frames: [][]byte{
+			[]byte("stats"),
+			b,
+		},
+	}))
+
+	recv := <-ts.backend.GetGatewayStatsChan()
+	assert.Equal("2", recv.ConfigVersion)
+}
+
+func (ts *BackendTestSuite) TestRawPacketForwarderEvent() {
+	assert := require.New(ts.T())
+
+	event := gw.RawPacketForwarderEvent{
+		Payload: []byte{1, 2, 3},
+	}
+	b, err := proto.Marshal(&event)
+	assert.NoError(err)
+
+	assert.NoError(ts.pubSock.SendMulti(zmq4.Msg{
+		Frames: [][]byte{
+			[]byte("raw"),
+			b,
+		},
+	}))
+
+	recv := <-ts.backend.GetRawPacketForwarderEventChan()
+	assert.Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}, recv.GatewayId)
+	assert.Len(recv.RawId, 16)
+	assert.Equal(event.Payload, recv.Payload)
+}
+
+func (ts *BackendTestSuite) TestGPSEvent() {
+	assert := require.New(ts.T())
+
+	location := common.Location{
+		Latitude:  52.3740,
+		Longitude: 4.8897,
+		Altitude:  10,
+		Source:    common.LocationSource_GPS,
+	}
+	b, err := proto.Marshal(&location)
+	assert.NoError(err)
+
+	assert.NoError(ts.pubSock.SendMulti(zmq4.Msg{
+		Frames: [][]byte{
+			[]byte("gps"),
+			b,
+		},
+	}))
+
+	stats := gw.GatewayStats{
+		GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	b, err = proto.Marshal(&stats)
+	assert.NoError(err)
+
+	assert.NoError(ts.pubSock.SendMulti(zmq4.Msg{
+		Frames: [][]byte{
+			[]byte("stats"),
+			b,
+		},
+	}))
+
+	recv := <-ts.backend.GetGatewayStatsChan()
+	assert.True(proto.Equal(&location, recv.Location))
+}
+
+func (ts *BackendTestSuite) TestTimeSyncEvent() {
+	assert := require.New(ts.T())
+
+	var conf config.Config
+	conf.TimeSync.Enabled = true
+	conf.TimeSync.Window = time.Minute
+	assert.NoError(timesync.Setup(conf))
+	defer timesync.Setup(config.Config{})
+
+	// the concentrator clock is 2 seconds ahead
+	b, err := proto.Marshal(ptypes.DurationProto(gps.Time(time.Now().Add(2 * time.Second)).TimeSinceGPSEpoch()))
+	assert.NoError(err)
+
+	assert.NoError(ts.backend.handleEvent(ts.backend.instances[0], "timesync", b))
+
+	offset, ok := timesync.GetOffset(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8})
+	assert.True(ok)
+	assert.InDelta(2*time.Second, offset, float64(100*time.Millisecond))
+}
+
+func (ts *BackendTestSuite) TestUnknownEvent() {
+	assert := require.New(ts.T())
+
+	unknownEvents := testutil.ToFloat64(unknownEventCounter("foo"))
+
+	assert.NoError(ts.backend.handleEvent(ts.backend.instances[0], "foo", []byte{1, 2, 3}))
+	assert.NoError(ts.backend.handleEvent(ts.backend.instances[0], "foo", []byte{1, 2, 3}))
+
+	assert.Equal(unknownEvents+2, testutil.ToFloat64(unknownEventCounter("foo")))
+}
+
+func (ts *BackendTestSuite) TestRawPacketForwarderCommand() {
+	assert := require.New(ts.T())
+
+	cmd := gw.RawPacketForwarderCommand{
+		GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		RawId:     []byte{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		Payload:   []byte("spectral_scan"),
+	}
+	cmdB, err := proto.Marshal(&cmd)
+	assert.NoError(err)
+
+	ts.T().Run("empty payload", func(t *testing.T) {
+		assert := require.New(t)
+		assert.Error(ts.backend.RawPacketForwarderCommand(gw.RawPacketForwarderCommand{}))
+	})
+
+	ts.T().Run("reply", func(t *testing.T) {
+		assert := require.New(t)
+
+		reply := gw.RawPacketForwarderEvent{
+			Payload: []byte{4, 5, 6},
+		}
+		replyB, err := proto.Marshal(&reply)
+		assert.NoError(err)
+
+		go func() {
+			msg, err := ts.repSock.Recv()
+			assert.NoError(err)
+			assert.Equal("raw", string(msg.Frames[0]))
+			assert.Equal(cmdB, msg.Frames[1])
+			assert.NoError(ts.repSock.Send(zmq4.NewMsg(replyB)))
+		}()
+
+		assert.NoError(ts.backend.RawPacketForwarderCommand(cmd))
+
+		recv := <-ts.backend.GetRawPacketForwarderEventChan()
+		assert.Equal(cmd.GatewayId, recv.GatewayId)
+		assert.Equal(cmd.RawId, recv.RawId)
+		assert.Equal(reply.Payload, recv.Payload)
+	})
+
+	ts.T().Run("empty reply", func(t *testing.T) {
+		assert := require.New(t)
+
+		go func() {
+			_, err := ts.repSock.Recv()
+			assert.NoError(err)
+			assert.NoError(ts.repSock.Send(zmq4.NewMsg(nil)))
+		}()
+
+		assert.NoError(ts.backend.RawPacketForwarderCommand(cmd))
+
+		select {
+		case <-ts.backend.GetRawPacketForwarderEventChan():
+			t.Fatal("unexpected raw packet-forwarder event")
+		default:
+		}
+	})
+}
+
+func (ts *BackendTestSuite) TestBandwidthUnit() {
+	tests := []struct {
+		Name                      string
+		UplinkBandwidth           uint32
+		ExpectedUplinkBandwidth   uint32
+		DownlinkBandwidth         uint32
+		ExpectedDownlinkBandwidth uint32
+	}{
+		{
+			Name:                      "hz",
+			UplinkBandwidth:           125000,
+			ExpectedUplinkBandwidth:   125,
+			DownlinkBandwidth:         125,
+			ExpectedDownlinkBandwidth: 125000,
+		},
+		{
+			Name:                      "khz",
+			UplinkBandwidth:           125,
+			ExpectedUplinkBandwidth:   125,
+			DownlinkBandwidth:         125,
+			ExpectedDownlinkBandwidth: 125,
+		},
+	}
+
+	for _, tst := range tests {
+		ts.T().Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var err error
+			ts.backend.instances[0].bandwidth, err = newBandwidthConverter(bandwidthUnitAuto, "")
+			assert.NoError(err)
+
+			// uplink
+			uf := gw.UplinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				TxInfo: &gw.UplinkTXInfo{
+					Modulation: common.Modulation_LORA,
+					ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+						LoraModulationInfo: &gw.LoRaModulationInfo{
+							Bandwidth:       tst.UplinkBandwidth,
+							SpreadingFactor: 7,
+						},
+					},
+				},
+				RxInfo: &gw.UplinkRXInfo{
+					CrcStatus: gw.CRCStatus_CRC_OK,
+				},
+			}
+			b, err := proto.Marshal(&uf)
+			assert.NoError(err)
+
+			assert.NoError(ts.pubSock.SendMulti(zmq4.Msg{
+				Frames: [][]byte{
+					[]byte("up"),
+					b,
+				},
+			}))
+
+			recv := <-ts.backend.GetUplinkFrameChan()
+			assert.Equal(tst.ExpectedUplinkBandwidth, recv.GetTxInfo().GetLoraModulationInfo().GetBandwidth())
+
+			// downlink
+			down := gw.DownlinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				TxInfo: &gw.DownlinkTXInfo{
+					Modulation: common.Modulation_LORA,
+					ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+						LoraModulationInfo: &gw.LoRaModulationInfo{
+							Bandwidth:       tst.DownlinkBandwidth,
+							SpreadingFactor: 7,
+						},
+					},
+				},
+			}
+
+			go func() {
+				msg, err := ts.repSock.Recv()
+				assert.NoError(err)
+
+				var pl gw.DownlinkFrame
+				assert.NoError(proto.Unmarshal(msg.Frames[1], &pl))
+				assert.Equal(tst.ExpectedDownlinkBandwidth, pl.GetTxInfo().GetLoraModulationInfo().GetBandwidth())
+
+				ackB, err := proto.Marshal(&gw.DownlinkTXAck{GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8}})
+				assert.NoError(err)
+				assert.NoError(ts.repSock.Send(zmq4.NewMsg(ackB)))
+			}()
+
+			assert.NoError(ts.backend.SendDownlinkFrame(down))
+			<-ts.backend.GetDownlinkTXAckChan()
+		})
+	}
+
+	ts.T().Run("fsk downlink", func(t *testing.T) {
+		assert := require.New(t)
+
+		var err error
+		ts.backend.instances[0].bandwidth, err = newBandwidthConverter(bandwidthUnitHz, "")
+		assert.NoError(err)
+
+		down := gw.DownlinkFrame{
+			PhyPayload: []byte{1, 2, 3, 4},
+			TxInfo: &gw.DownlinkTXInfo{
+				Modulation: common.Modulation_FSK,
+				ModulationInfo: &gw.DownlinkTXInfo_FskModulationInfo{
+					FskModulationInfo: &gw.FSKModulationInfo{
+						FrequencyDeviation: 25000,
+						Datarate:           50000,
+					},
+				},
+			},
+		}
+		downB, err := proto.Marshal(&down)
+		assert.NoError(err)
+
+		go func() {
+			msg, err := ts.repSock.Recv()
+			assert.NoError(err)
+			assert.Equal(downB, msg.Frames[1])
+
+			ackB, err := proto.Marshal(&gw.DownlinkTXAck{GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8}})
+			assert.NoError(err)
+			assert.NoError(ts.repSock.Send(zmq4.NewMsg(ackB)))
+		}()
+
+		assert.NoError(ts.backend.SendDownlinkFrame(down))
+		<-ts.backend.GetDownlinkTXAckChan()
+	})
+}
+
+// fakeConcentratord implements the Concentratord event and command sockets.
+type fakeConcentratord struct {
+	eventURL   string
+	commandURL string
+	pubSock    zmq4.Socket
+	repSock    zmq4.Socket
+}
+
+func newFakeConcentratord(t *testing.T, gatewayID lorawan.EUI64) *fakeConcentratord {
+	tempDir, err := ioutil.TempDir("", "test")
+	require.NoError(t, err)
+
+	f := fakeConcentratord{
+		eventURL:   fmt.Sprintf("ipc://%s/events", tempDir),
+		commandURL: fmt.Sprintf("ipc://%s/commands", tempDir),
+	}
+	f.start(t, gatewayID)
+
+	return &f
+}
+
+// start listens on the event and command sockets and replies to the
+// gateway_id and version requests.
+func (f *fakeConcentratord) start(t *testing.T, gatewayID lorawan.EUI64) {
+	assert := require.New(t)
+
+	f.pubSock = zmq4.NewPub(context.Background())
+	f.repSock = zmq4.NewRep(context.Background())
+
+	assert.NoError(f.pubSock.Listen(f.eventURL))
+	assert.NoError(f.repSock.Listen(f.commandURL))
+
+	go func() {
+		msg, err := f.repSock.Recv()
+		assert.NoError(err)
+		assert.Equal("gateway_id", string(msg.Bytes()))
+		assert.NoError(f.repSock.Send(zmq4.NewMsg(gatewayID[:])))
+
+		msg, err = f.repSock.Recv()
+		assert.NoError(err)
+		assert.Equal("version", string(msg.Bytes()))
+		assert.NoError(f.repSock.Send(zmq4.NewMsg([]byte("3.0.0"))))
+	}()
+}
+
+func (f *fakeConcentratord) close() {
+	f.pubSock.Close()
+	f.repSock.Close()
+}
+
+// expectDownlink expects a downlink command and replies with an ack
+// containing the given token.
+func (f *fakeConcentratord) expectDownlink(t *testing.T, token uint32) {
+	assert := require.New(t)
+
+	go func() {
+		msg, err := f.repSock.Recv()
+		assert.NoError(err)
+		assert.Equal("down", string(msg.Frames[0]))
+
+		ackB, err := proto.Marshal(&gw.DownlinkTXAck{Token: token})
+		assert.NoError(err)
+		assert.NoError(f.repSock.Send(zmq4.NewMsg(ackB)))
+	}()
+}
+
+func TestMultipleInstances(t *testing.T) {
+	log.SetLevel(log.ErrorLevel)
+
+	tests := []struct {
+		Name                    string
+		GatewayIDs              [2]lorawan.EUI64
+		ExpectedSubscribeEvents []events.Subscribe
+		ExpectedBoards          [2]uint32
+	}{
+		{
+			Name: "different gateway ids",
+			GatewayIDs: [2]lorawan.EUI64{
+				{1, 1, 1, 1, 1, 1, 1, 1},
+				{2, 2, 2, 2, 2, 2, 2, 2},
+			},
+			ExpectedSubscribeEvents: []events.Subscribe{
+				{Subscribe: true, GatewayID: lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}},
+				{Subscribe: true, GatewayID: lorawan.EUI64{2, 2, 2, 2, 2, 2, 2, 2}},
+			},
+			ExpectedBoards: [2]uint32{3, 3},
+		},
+		{
+			Name: "same gateway id",
+			GatewayIDs: [2]lorawan.EUI64{
+				{1, 1, 1, 1, 1, 1, 1, 1},
+				{1, 1, 1, 1, 1, 1, 1, 1},
+			},
+			ExpectedSubscribeEvents: []events.Subscribe{
+				{Subscribe: true, GatewayID: lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}},
+			},
+			ExpectedBoards: [2]uint32{0, 1},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var fakes []*fakeConcentratord
+			var conf config.Config
+			setDefaultChannelSizes(&conf)
+			for _, id := range tst.GatewayIDs {
+				f := newFakeConcentratord(t, id)
+				defer f.close()
+
+				fakes = append(fakes, f)
+				conf.Backend.Concentratord.Instances = append(conf.Backend.Concentratord.Instances, config.ConcentratordInstance{
+					EventURL:   f.eventURL,
+					CommandURL: f.commandURL,
+				})
+			}
+
+			backend, err := NewBackend(conf)
+			assert.NoError(err)
+			defer backend.Close()
+
+			assert.Len(backend.GetSubscribeEventChan(), len(tst.ExpectedSubscribeEvents))
+			for _, exp := range tst.ExpectedSubscribeEvents {
+				e := <-backend.GetSubscribeEventChan()
+				assert.Equal(exp.GatewayID, e.GatewayID)
+				assert.Equal(exp.Subscribe, e.Subscribe)
+			}
+
+			for i, f := range fakes {
+				t.Run(fmt.Sprintf("instance %d", i), func(t *testing.T) {
+					assert := require.New(t)
+
+					// uplink
+					uf := gw.UplinkFrame{
+						PhyPayload: []byte{byte(i)},
+						RxInfo: &gw.UplinkRXInfo{
+							GatewayId: tst.GatewayIDs[i][:],
+							Board:     3,
+						},
+					}
+					b, err := proto.Marshal(&uf)
+					assert.NoError(err)
+
+					assert.NoError(f.pubSock.SendMulti(zmq4.Msg{
+						Frames: [][]byte{
+							[]byte("up"),
+							b,
+						},
+					}))
+
+					recv := <-backend.GetUplinkFrameChan()
+					assert.Equal([]byte{byte(i)}, recv.PhyPayload)
+					assert.Equal(tst.ExpectedBoards[i], recv.GetRxInfo().GetBoard())
+
+					// downlink
+					f.expectDownlink(t, uint32(i+10))
+					assert.NoError(backend.SendDownlinkFrame(gw.DownlinkFrame{
+						PhyPayload: []byte{1, 2, 3, 4},
+						TxInfo: &gw.DownlinkTXInfo{
+							GatewayId: tst.GatewayIDs[i][:],
+							Board:     recv.GetRxInfo().GetBoard(),
+						},
+					}))
+
+					ack := <-backend.GetDownlinkTXAckChan()
+					assert.Equal(uint32(i+10), ack.Token)
+				})
+			}
+
+			assert.Error(backend.SendDownlinkFrame(gw.DownlinkFrame{
+				TxInfo: &gw.DownlinkTXInfo{
+					GatewayId: []byte{3, 3, 3, 3, 3, 3, 3, 3},
+				},
+			}))
+		})
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	assert := require.New(t)
+
+	defer func(d time.Duration) {
+		reconnectInterval = d
+	}(reconnectInterval)
+	reconnectInterval = 10 * time.Millisecond
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	f := newFakeConcentratord(t, gatewayID)
+
+	var conf config.Config
+	conf.Backend.Concentratord.EventURL = f.eventURL
+	conf.Backend.Concentratord.CommandURL = f.commandURL
+	setDefaultChannelSizes(&conf)
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+
+	e := <-backend.GetSubscribeEventChan()
+	assert.True(e.Subscribe)
+	assert.Equal(gatewayID, e.GatewayID)
+
+	// concentratord restart
+	f.close()
+
+	e = <-backend.GetSubscribeEventChan()
+	assert.False(e.Subscribe)
+	assert.Equal(gatewayID, e.GatewayID)
+	assert.Contains(e.ConnState.Reason, "event socket receive error")
+
+	f.start(t, gatewayID)
+	defer f.close()
+
+	e = <-backend.GetSubscribeEventChan()
+	assert.True(e.Subscribe)
+	assert.Equal(gatewayID, e.GatewayID)
+	assert.Equal("", e.ConnState.Reason)
+	assert.Equal("3.0.0", e.ConnState.ProtocolVersion)
+
+	// the events of the restarted concentratord are received
+	b, err := proto.Marshal(&gw.UplinkFrame{PhyPayload: []byte{1, 2, 3}})
+	assert.NoError(err)
+
+	// the subscription of the event socket is not instant
+	go func() {
+		for i := 0; i < 50; i++ {
+			if err := f.pubSock.SendMulti(zmq4.NewMsgFrom([]byte("up"), b)); err != nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	uf := <-backend.GetUplinkFrameChan()
+	assert.Equal([]byte{1, 2, 3}, uf.PhyPayload)
+
+	// downlinks are sent to the restarted concentratord
+	f.expectDownlink(t, 123)
+	assert.NoError(backend.SendDownlinkFrame(gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: gatewayID[:],
+		},
+	}))
+	ack := <-backend.GetDownlinkTXAckChan()
+	assert.Equal(uint32(123), ack.Token)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	log.SetLevel(log.FatalLevel)
+	assert := require.New(t)
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	f := newFakeConcentratord(t, gatewayID)
+	defer f.close()
+
+	var conf config.Config
+	conf.Backend.Concentratord.EventURL = f.eventURL
+	conf.Backend.Concentratord.CommandURL = f.commandURL
+	conf.Backend.Concentratord.CommandTimeout = 100 * time.Millisecond
+	setDefaultChannelSizes(&conf)
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+	<-backend.GetSubscribeEventChan()
+
+	down := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: gatewayID[:],
+		},
+	}
+
+	// the first downlink command is never answered
+	received := make(chan struct{})
+	go func() {
+		msg, err := f.repSock.Recv()
+		assert.NoError(err)
+		assert.Equal("down", string(msg.Frames[0]))
+		close(received)
+	}()
+
+	start := time.Now()
+	err = backend.SendDownlinkFrame(down)
+	assert.EqualError(err, "send downlink command error: receive command request reply error: timeout after 100ms")
+	assert.True(time.Since(start) < time.Second)
+	<-received
+
+	// the next command is sent using the re-created socket
+	f.expectDownlink(t, 123)
+	assert.NoError(backend.SendDownlinkFrame(down))
+	ack := <-backend.GetDownlinkTXAckChan()
+	assert.Equal(uint32(123), ack.Token)
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(time.Second, reconnectBackoff(0))
+	assert.Equal(2*time.Second, reconnectBackoff(1))
+	assert.Equal(16*time.Second, reconnectBackoff(4))
+	assert.Equal(30*time.Second, reconnectBackoff(5))
+	assert.Equal(30*time.Second, reconnectBackoff(100))
 }
 
 func TestBackend(t *testing.T) {
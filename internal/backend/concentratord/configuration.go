@@ -0,0 +1,96 @@
+package concentratord
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// ApplyConfiguration forwards the given gateway configuration (channel-plan)
+// to the Concentratord instance(s) of the gateway using the config command.
+// When multiple instances report the same gateway ID, each instance receives
+// the channels of its board. A configuration of which the version has already
+// been applied to an instance is not re-applied.
+func (b *Backend) ApplyConfiguration(pl gw.GatewayConfiguration) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], pl.GetGatewayId())
+
+	var found bool
+	for _, i := range b.instances {
+		if len(b.instances) != 1 && i.gatewayID != gatewayID {
+			continue
+		}
+		found = true
+
+		if err := b.applyConfiguration(i, pl); err != nil {
+			return errors.Wrap(err, "apply configuration error")
+		}
+	}
+
+	if !found {
+		return errors.Errorf("no concentratord instance for gateway_id: %s", gatewayID)
+	}
+
+	return nil
+}
+
+func (b *Backend) applyConfiguration(i *instance, pl gw.GatewayConfiguration) error {
+	if pl.Version != "" && pl.Version == i.getConfigVersion() {
+		log.WithFields(log.Fields{
+			"gateway_id":  i.gatewayID,
+			"version":     pl.Version,
+			"command_url": i.commandURL,
+		}).Debug("backend/concentratord: configuration version already applied")
+		return nil
+	}
+
+	conf := instanceConfiguration(i, pl)
+
+	log.WithFields(log.Fields{
+		"gateway_id":  i.gatewayID,
+		"version":     pl.Version,
+		"channels":    len(conf.Channels),
+		"command_url": i.commandURL,
+	}).Info("backend/concentratord: forwarding configuration command")
+
+	if _, err := i.commandRequest("config", &conf); err != nil {
+		return errors.Wrap(err, "send configuration command error")
+	}
+
+	commandCounter("config").Inc()
+	i.setConfigVersion(pl.Version)
+
+	return nil
+}
+
+// instanceConfiguration returns the configuration for the given instance.
+// The LoRa bandwidth is converted to the unit used by the Concentratord.
+// When the instance shares its gateway ID with other instances, only the
+// channels of its board are included (with the board reset to 0).
+func instanceConfiguration(i *instance, pl gw.GatewayConfiguration) gw.GatewayConfiguration {
+	conf := gw.GatewayConfiguration{
+		GatewayId: pl.GatewayId,
+		Version:   pl.Version,
+	}
+
+	for _, c := range pl.Channels {
+		if i.shared && c.GetBoard() != i.board {
+			continue
+		}
+
+		c = proto.Clone(c).(*gw.ChannelConfiguration)
+		if i.shared {
+			c.Board = 0
+		}
+		if mod := c.GetLoraModulationConfig(); mod != nil {
+			mod.Bandwidth = i.bandwidth.fromKHz(mod.Bandwidth)
+		}
+
+		conf.Channels = append(conf.Channels, c)
+	}
+
+	return conf
+}
@@ -0,0 +1,441 @@
+package concentratord
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/lorawan"
+)
+
+// Reconnect backoff, the interval is doubled after each failed attempt until
+// the max. interval has been reached.
+var (
+	reconnectInterval    = time.Second
+	maxReconnectInterval = 30 * time.Second
+)
+
+// reconnectBackoff returns the reconnect interval for the given attempt
+// (starting at 0).
+func reconnectBackoff(attempt int) time.Duration {
+	d := reconnectInterval
+	for n := 0; n < attempt && d < maxReconnectInterval; n++ {
+		d *= 2
+	}
+
+	if d > maxReconnectInterval {
+		return maxReconnectInterval
+	}
+	return d
+}
+
+// instance holds the event and command sockets of a single Concentratord
+// instance (e.g. one per concentrator board).
+type instance struct {
+	eventSockCancel   func()
+	commandSockCancel func()
+	eventSock         zmq4.Socket
+	commandSock       zmq4.Socket
+	commandMux        sync.Mutex
+	commandTimeout    time.Duration
+
+	// done is closed when the instance is closed.
+	done chan struct{}
+
+	eventURL   string
+	commandURL string
+
+	gatewayID   lorawan.EUI64
+	version     string
+	bandwidth   *bandwidthConverter
+	connectTime time.Time
+
+	// board is the index of the instance within the instances sharing the
+	// same gateway ID. It is only used when shared is set.
+	board  uint32
+	shared bool
+
+	// configVersion contains the version of the last applied gateway
+	// configuration.
+	configMux     sync.RWMutex
+	configVersion string
+
+	// location contains the location of the last gps event.
+	locationMux sync.RWMutex
+	location    *common.Location
+}
+
+func newInstance(eventURL, commandURL, bandwidthUnit string, commandTimeout time.Duration) (*instance, error) {
+	log.WithFields(log.Fields{
+		"event_url":   eventURL,
+		"command_url": commandURL,
+	}).Info("backend/concentratord: setting up concentratord instance")
+
+	i := instance{
+		done:           make(chan struct{}),
+		eventURL:       eventURL,
+		commandURL:     commandURL,
+		commandTimeout: commandTimeout,
+	}
+
+	i.dialEventSockLoop()
+	i.dialCommandSockLoop()
+
+	var err error
+	i.gatewayID, err = i.getGatewayID()
+	if err != nil {
+		return nil, errors.Wrap(err, "get gateway id error")
+	}
+
+	i.connectTime = time.Now()
+	i.version = i.getVersion()
+	log.WithFields(log.Fields{
+		"gateway_id": i.gatewayID,
+		"version":    i.version,
+		"event_url":  i.eventURL,
+	}).Info("backend/concentratord: concentratord version received")
+
+	i.bandwidth, err = newBandwidthConverter(bandwidthUnit, i.version)
+	if err != nil {
+		return nil, errors.Wrap(err, "new bandwidth converter error")
+	}
+
+	return &i, nil
+}
+
+// connState returns the connection state details of the instance.
+func (i *instance) connState() *events.ConnState {
+	connectTime, _ := ptypes.TimestampProto(i.connectTime)
+
+	return &events.ConnState{
+		BackendType:     "concentratord",
+		RemoteAddress:   i.eventURL,
+		ProtocolVersion: i.version,
+		ConnectTime:     connectTime,
+	}
+}
+
+func (i *instance) dialEventSock() error {
+	ctx := context.Background()
+	ctx, i.eventSockCancel = context.WithCancel(ctx)
+
+	i.eventSock = zmq4.NewSub(ctx)
+	err := i.eventSock.Dial(i.eventURL)
+	if err != nil {
+		return errors.Wrap(err, "dial event api url error")
+	}
+
+	err = i.eventSock.SetOption(zmq4.OptionSubscribe, "")
+	if err != nil {
+		return errors.Wrap(err, "set event option error")
+	}
+
+	log.WithFields(log.Fields{
+		"event_url": i.eventURL,
+	}).Info("backend/concentratord: connected to event socket")
+
+	return nil
+}
+
+func (i *instance) dialCommandSock() error {
+	ctx := context.Background()
+	ctx, i.commandSockCancel = context.WithCancel(ctx)
+
+	i.commandSock = zmq4.NewReq(ctx)
+	err := i.commandSock.Dial(i.commandURL)
+	if err != nil {
+		return errors.Wrap(err, "dial command api url error")
+	}
+
+	log.WithFields(log.Fields{
+		"command_url": i.commandURL,
+	}).Info("backend/concentratord: connected to command socket")
+
+	return nil
+}
+
+func (i *instance) dialCommandSockLoop() {
+	for attempt := 0; !i.isClosed(); attempt++ {
+		if err := i.dialCommandSock(); err != nil {
+			log.WithError(err).WithField("command_url", i.commandURL).Error("backend/concentratord: command socket dial error")
+			i.sleep(reconnectBackoff(attempt))
+			continue
+		}
+		break
+	}
+}
+
+func (i *instance) dialEventSockLoop() {
+	for attempt := 0; !i.isClosed(); attempt++ {
+		if err := i.dialEventSock(); err != nil {
+			log.WithError(err).WithField("event_url", i.eventURL).Error("backend/concentratord: event socket dial error")
+			i.sleep(reconnectBackoff(attempt))
+			continue
+		}
+		break
+	}
+}
+
+// reconnect re-establishes the event and command sockets and re-requests
+// the gateway ID and version. It blocks until the Concentratord is reachable
+// again or the instance has been closed.
+func (i *instance) reconnect() {
+	// We need to recover both the event and command sockets.
+	func() {
+		i.commandMux.Lock()
+		defer i.commandMux.Unlock()
+
+		i.cancelSockets()
+		i.dialEventSockLoop()
+		i.dialCommandSockLoop()
+	}()
+
+	for attempt := 0; !i.isClosed(); attempt++ {
+		gatewayID, err := i.getGatewayID()
+		if err != nil {
+			log.WithError(err).WithField("command_url", i.commandURL).Error("backend/concentratord: get gateway id error")
+			i.sleep(reconnectBackoff(attempt))
+			continue
+		}
+
+		// The gateway ID is used for routing the downlinks and for the
+		// subscriptions, changing it requires a restart.
+		if gatewayID != i.gatewayID {
+			log.WithFields(log.Fields{
+				"gateway_id":     i.gatewayID,
+				"new_gateway_id": gatewayID,
+				"command_url":    i.commandURL,
+			}).Warning("backend/concentratord: gateway id has changed, restart to apply")
+		}
+		break
+	}
+
+	if i.isClosed() {
+		return
+	}
+
+	i.connectTime = time.Now()
+	i.version = i.getVersion()
+	log.WithFields(log.Fields{
+		"gateway_id": i.gatewayID,
+		"version":    i.version,
+		"event_url":  i.eventURL,
+	}).Info("backend/concentratord: reconnected to concentratord")
+}
+
+// sleep sleeps for the given duration, or until the instance is closed.
+func (i *instance) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-i.done:
+	}
+}
+
+func (i *instance) isClosed() bool {
+	select {
+	case <-i.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (i *instance) getGatewayID() (lorawan.EUI64, error) {
+	var gatewayID lorawan.EUI64
+
+	bb, err := i.commandRequest("gateway_id", nil)
+	if err != nil {
+		return gatewayID, errors.Wrap(err, "request gateway id error")
+	}
+
+	copy(gatewayID[:], bb)
+
+	return gatewayID, nil
+}
+
+// getVersion returns the Concentratord version. Concentratord versions not
+// implementing the version command return an empty reply, in which case
+// "unknown" is returned.
+func (i *instance) getVersion() string {
+	bb, err := i.commandRequest("version", nil)
+	if err != nil {
+		log.WithError(err).Warning("backend/concentratord: request version error")
+		return "unknown"
+	}
+
+	if len(bb) == 0 {
+		return "unknown"
+	}
+
+	return string(bb)
+}
+
+func (i *instance) getConfigVersion() string {
+	i.configMux.RLock()
+	defer i.configMux.RUnlock()
+
+	return i.configVersion
+}
+
+func (i *instance) setConfigVersion(version string) {
+	i.configMux.Lock()
+	defer i.configMux.Unlock()
+
+	i.configVersion = version
+}
+
+func (i *instance) getLocation() *common.Location {
+	i.locationMux.RLock()
+	defer i.locationMux.RUnlock()
+
+	return i.location
+}
+
+func (i *instance) setLocation(location *common.Location) {
+	i.locationMux.Lock()
+	defer i.locationMux.Unlock()
+
+	i.location = location
+}
+
+func (i *instance) close() {
+	close(i.done)
+
+	i.eventSock.Close()
+	i.commandSock.Close()
+
+	i.eventSockCancel()
+	i.commandSockCancel()
+}
+
+// cancelSockets cancels the event and command sockets before re-dialing.
+// Note that the sockets are not closed, as closing a socket removes the ipc
+// file of the dialed endpoint (which is owned by the Concentratord).
+func (i *instance) cancelSockets() {
+	i.eventSockCancel()
+	i.commandSockCancel()
+}
+
+func (i *instance) commandRequest(command string, v proto.Message) ([]byte, error) {
+	i.commandMux.Lock()
+	defer i.commandMux.Unlock()
+
+	var bb []byte
+	var err error
+
+	if v != nil {
+		bb, err = proto.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "protobuf marshal error")
+		}
+	}
+
+	start := time.Now()
+	msg := zmq4.NewMsgFrom([]byte(command), bb)
+	if err = i.commandSock.SendMulti(msg); err != nil {
+		i.redialCommandSock()
+		return nil, errors.Wrap(err, "send command request error")
+	}
+
+	reply, err := i.recvCommandReply(command)
+	if err != nil {
+		// A REQ socket without reply is unable to send the next request,
+		// therefore the socket is re-created.
+		i.redialCommandSock()
+		return nil, errors.Wrap(err, "receive command request reply error")
+	}
+
+	commandDurationHistogram(command).Observe(time.Since(start).Seconds())
+
+	return reply.Bytes(), nil
+}
+
+// recvCommandReply receives the command reply. When the command timeout is
+// set and no reply is received within this timeout, an error is returned.
+func (i *instance) recvCommandReply(command string) (zmq4.Msg, error) {
+	if i.commandTimeout == 0 {
+		return i.commandSock.Recv()
+	}
+
+	type result struct {
+		msg zmq4.Msg
+		err error
+	}
+
+	sock := i.commandSock
+	resultChan := make(chan result, 1)
+	go func() {
+		msg, err := sock.Recv()
+		resultChan <- result{msg, err}
+	}()
+
+	select {
+	case res := <-resultChan:
+		return res.msg, res.err
+	case <-time.After(i.commandTimeout):
+		commandTimeoutCounter(command).Inc()
+		return zmq4.Msg{}, errors.Errorf("timeout after %s", i.commandTimeout)
+	}
+}
+
+// redialCommandSock cancels the command socket and dials a new one (see
+// cancelSockets why the socket is not closed).
+func (i *instance) redialCommandSock() {
+	i.commandSockCancel()
+
+	if err := i.dialCommandSock(); err != nil {
+		log.WithError(err).WithField("command_url", i.commandURL).Error("backend/concentratord: command socket dial error")
+	}
+}
+
+// eventLoop receives the events of the instance and passes them to the
+// given handler. On a receive error, connected is called with false and the
+// instance reconnects. Once reconnected, connected is called with true.
+func (i *instance) eventLoop(handle func(i *instance, event string, bb []byte) error, connected func(i *instance, connected bool, reason string)) {
+	for {
+		msg, err := i.eventSock.Recv()
+		if i.isClosed() {
+			return
+		}
+
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"event_url": i.eventURL,
+			}).Error("backend/concentratord: receive event message error")
+
+			connected(i, false, fmt.Sprintf("event socket receive error: %s", err))
+			i.reconnect()
+			if i.isClosed() {
+				return
+			}
+			connected(i, true, "")
+			continue
+		}
+
+		if len(msg.Frames) == 0 {
+			continue
+		}
+
+		if len(msg.Frames) != 2 {
+			log.WithFields(log.Fields{
+				"frame_count": len(msg.Frames),
+			}).Error("backend/concentratord: expected 2 frames in event message")
+			continue
+		}
+
+		if err := handle(i, string(msg.Frames[0]), msg.Frames[1]); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"event": string(msg.Frames[0]),
+			}).Error("backend/concentratord: handle event error")
+		}
+	}
+}
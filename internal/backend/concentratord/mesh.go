@@ -0,0 +1,445 @@
+package concentratord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/jacobsa/crypto/cmac"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/band"
+)
+
+// Mesh frames are sent as proprietary LoRaWAN frames. The MHDR contains the
+// proprietary MType, the mesh payload type and the hop count:
+//
+//	| 7..5 MType (111) | 4..3 Payload type | 2..0 Hop count - 1 |
+//
+// Uplink payload:
+//
+//	| MHDR (1) | Metadata (5) | Relay ID (4) | PHYPayload (n) | MIC (4) |
+//
+// Uplink metadata (MSB first):
+//
+//	| Uplink ID (12b) | DR (4b) | -RSSI (8b) | RFU (2b) | SNR (6b, signed) | Channel (8b) |
+//
+// Downlink payload:
+//
+//	| MHDR (1) | Metadata (6) | Relay ID (4) | PHYPayload (n) | MIC (4) |
+//
+// Downlink metadata (MSB first):
+//
+//	| Uplink ID (12b) | DR (4b) | Frequency / 100 (24b) | TX power / 2 (4b) | Delay - 1 (4b) |
+//
+// The MIC contains the first 4 bytes of the AES-CMAC (using the signing key)
+// of all the preceding bytes.
+const (
+	meshMType               = 0x07
+	meshPayloadTypeUplink   = 0x00
+	meshPayloadTypeDownlink = 0x01
+
+	meshUplinkMetadataLen   = 5
+	meshDownlinkMetadataLen = 6
+	meshRelayIDLen          = 4
+	meshMICLen              = 4
+)
+
+// meshContextMarker is the first byte of the rxInfo / txInfo context of
+// relayed frames. The context contains the relay details, followed by the
+// original context:
+//
+//	| Marker (1) | Hop count (1) | Relay ID (4) | Uplink ID (2) | Context (n) |
+const meshContextMarker = 0xe0
+
+const meshContextHeaderLen = 8
+
+// errNotMeshFrame is returned when the frame is not a (valid) mesh frame,
+// in which case the frame is handled as a regular frame.
+var errNotMeshFrame = errors.New("not a mesh frame")
+
+// meshUplinkPayload contains a mesh-encapsulated uplink, received by a relay
+// gateway.
+type meshUplinkPayload struct {
+	hopCount   uint8
+	uplinkID   uint16
+	dr         uint8
+	rssi       int16
+	snr        int8
+	channel    uint8
+	relayID    [meshRelayIDLen]byte
+	phyPayload []byte
+}
+
+// meshDownlinkPayload contains a mesh-encapsulated downlink, to be
+// transmitted by a relay gateway.
+type meshDownlinkPayload struct {
+	hopCount   uint8
+	uplinkID   uint16
+	dr         uint8
+	frequency  uint32
+	txPower    uint8
+	delay      uint8
+	relayID    [meshRelayIDLen]byte
+	phyPayload []byte
+}
+
+// mesh implements the unwrapping of relayed uplinks and the wrapping of
+// downlinks destined to relay gateways.
+type mesh struct {
+	signingKey     lorawan.AES128Key
+	band           band.Band
+	uplinkChannels []int
+
+	frequencies []int
+	dataRate    band.DataRate
+	txPower     int
+}
+
+func newMesh(conf config.Config) (*mesh, error) {
+	meshConf := conf.Backend.Concentratord.Mesh
+
+	m := mesh{
+		uplinkChannels: meshConf.UplinkChannels,
+		frequencies:    meshConf.Frequencies,
+		txPower:        meshConf.TXPower,
+	}
+
+	if err := m.signingKey.UnmarshalText([]byte(meshConf.SigningKey)); err != nil {
+		return nil, errors.Wrap(err, "decode signing key error")
+	}
+
+	var err error
+	m.band, err = band.GetConfig(band.Name(meshConf.Region), false, lorawan.DwellTimeNoLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "get band config error")
+	}
+
+	m.dataRate, err = m.band.GetDataRate(meshConf.DataRate)
+	if err != nil {
+		return nil, errors.Wrap(err, "get mesh data-rate error")
+	}
+	if m.dataRate.Modulation != band.LoRaModulation {
+		return nil, errors.New("mesh data-rate must use LoRa modulation")
+	}
+
+	if len(m.frequencies) == 0 {
+		return nil, errors.New("at least one mesh frequency must be configured")
+	}
+
+	return &m, nil
+}
+
+// isMeshFrame returns true when the given PHYPayload is a proprietary frame
+// and thus could be a mesh frame.
+func isMeshFrame(b []byte) bool {
+	return len(b) != 0 && b[0]>>5 == meshMType
+}
+
+// unwrapUplink replaces the mesh-encapsulated uplink by the relayed uplink.
+// The RSSI, SNR and channel are replaced by the values reported by the relay
+// gateway, the frequency and modulation are derived from the reported channel
+// and data-rate. The relay details are stored in the context, such that a
+// downlink can be wrapped for the same relay. errNotMeshFrame is returned in
+// case the frame is not a valid mesh uplink.
+func (m *mesh) unwrapUplink(pl *gw.UplinkFrame) (meshUplinkPayload, error) {
+	up, err := unmarshalMeshUplink(pl.PhyPayload, m.signingKey)
+	if err != nil {
+		return up, err
+	}
+
+	dr, err := m.band.GetDataRate(int(up.dr))
+	if err != nil {
+		return up, errors.Wrap(err, "get data-rate error")
+	}
+
+	freq, err := m.uplinkFrequency(int(up.channel))
+	if err != nil {
+		return up, err
+	}
+
+	if pl.TxInfo == nil {
+		pl.TxInfo = &gw.UplinkTXInfo{}
+	}
+	pl.TxInfo.Frequency = uint32(freq)
+
+	switch dr.Modulation {
+	case band.LoRaModulation:
+		pl.TxInfo.Modulation = common.Modulation_LORA
+		pl.TxInfo.ModulationInfo = &gw.UplinkTXInfo_LoraModulationInfo{
+			LoraModulationInfo: &gw.LoRaModulationInfo{
+				Bandwidth:       uint32(dr.Bandwidth),
+				SpreadingFactor: uint32(dr.SpreadFactor),
+				CodeRate:        "4/5",
+			},
+		}
+	case band.FSKModulation:
+		pl.TxInfo.Modulation = common.Modulation_FSK
+		pl.TxInfo.ModulationInfo = &gw.UplinkTXInfo_FskModulationInfo{
+			FskModulationInfo: &gw.FSKModulationInfo{
+				Datarate: uint32(dr.BitRate),
+			},
+		}
+	}
+
+	if pl.RxInfo == nil {
+		pl.RxInfo = &gw.UplinkRXInfo{}
+	}
+	pl.RxInfo.Rssi = int32(up.rssi)
+	pl.RxInfo.LoraSnr = float64(up.snr)
+	pl.RxInfo.Channel = uint32(up.channel)
+	pl.RxInfo.Context = marshalMeshContext(up.hopCount, up.relayID, up.uplinkID, pl.RxInfo.Context)
+	pl.PhyPayload = up.phyPayload
+
+	return up, nil
+}
+
+// uplinkFrequency returns the frequency of the given relay channel. When the
+// uplink channels are not configured, the channels of the region are used.
+func (m *mesh) uplinkFrequency(channel int) (int, error) {
+	if len(m.uplinkChannels) != 0 {
+		if channel >= len(m.uplinkChannels) {
+			return 0, fmt.Errorf("channel %d is not configured", channel)
+		}
+		return m.uplinkChannels[channel], nil
+	}
+
+	c, err := m.band.GetUplinkChannel(channel)
+	if err != nil {
+		return 0, errors.Wrap(err, "get uplink channel error")
+	}
+	return c.Frequency, nil
+}
+
+// wrapDownlink wraps the given downlink into a mesh downlink when the context
+// contains the relay details (see unwrapUplink). It returns false when the
+// downlink is not destined to a relay gateway. The wrapped downlink is
+// transmitted immediately using the mesh frequency and data-rate, the relay
+// gateway applies the delay.
+func (m *mesh) wrapDownlink(pl *gw.DownlinkFrame) (bool, error) {
+	hopCount, relayID, uplinkID, ctx, ok := unmarshalMeshContext(pl.GetTxInfo().GetContext())
+	if !ok {
+		return false, nil
+	}
+
+	txInfo := pl.TxInfo
+
+	var dr band.DataRate
+	switch txInfo.Modulation {
+	case common.Modulation_LORA:
+		modInfo := txInfo.GetLoraModulationInfo()
+		dr = band.DataRate{
+			Modulation:   band.LoRaModulation,
+			SpreadFactor: int(modInfo.GetSpreadingFactor()),
+			Bandwidth:    int(modInfo.GetBandwidth()),
+		}
+	case common.Modulation_FSK:
+		dr = band.DataRate{
+			Modulation: band.FSKModulation,
+			BitRate:    int(txInfo.GetFskModulationInfo().GetDatarate()),
+		}
+	}
+
+	drIndex, err := m.band.GetDataRateIndex(false, dr)
+	if err != nil {
+		return true, errors.Wrap(err, "get data-rate index error")
+	}
+
+	delay := time.Second
+	if txInfo.Timing == gw.DownlinkTiming_DELAY {
+		delay, err = ptypes.Duration(txInfo.GetDelayTimingInfo().GetDelay())
+		if err != nil {
+			return true, errors.Wrap(err, "parse delay error")
+		}
+	}
+	if delay < time.Second || delay > 16*time.Second {
+		return true, fmt.Errorf("delay must be between 1 and 16 seconds, got: %s", delay)
+	}
+
+	txPower := txInfo.Power
+	if txPower < 0 {
+		txPower = 0
+	}
+
+	b, err := meshDownlinkPayload{
+		hopCount:   hopCount,
+		uplinkID:   uplinkID,
+		dr:         uint8(drIndex),
+		frequency:  txInfo.Frequency,
+		txPower:    uint8(txPower / 2),
+		delay:      uint8(delay / time.Second),
+		relayID:    relayID,
+		phyPayload: pl.PhyPayload,
+	}.marshal(m.signingKey)
+	if err != nil {
+		return true, errors.Wrap(err, "marshal mesh downlink error")
+	}
+
+	pl.PhyPayload = b
+	pl.TxInfo = &gw.DownlinkTXInfo{
+		GatewayId:  txInfo.GatewayId,
+		Frequency:  uint32(m.frequencies[int(uplinkID)%len(m.frequencies)]),
+		Power:      int32(m.txPower),
+		Modulation: common.Modulation_LORA,
+		ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+			LoraModulationInfo: &gw.LoRaModulationInfo{
+				Bandwidth:             uint32(m.dataRate.Bandwidth),
+				SpreadingFactor:       uint32(m.dataRate.SpreadFactor),
+				CodeRate:              "4/5",
+				PolarizationInversion: false,
+			},
+		},
+		Board:   txInfo.Board,
+		Antenna: txInfo.Antenna,
+		Timing:  gw.DownlinkTiming_IMMEDIATELY,
+		TimingInfo: &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+			ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+		},
+		Context: ctx,
+	}
+
+	return true, nil
+}
+
+func marshalMeshContext(hopCount uint8, relayID [meshRelayIDLen]byte, uplinkID uint16, ctx []byte) []byte {
+	b := make([]byte, meshContextHeaderLen, meshContextHeaderLen+len(ctx))
+	b[0] = meshContextMarker
+	b[1] = hopCount
+	copy(b[2:6], relayID[:])
+	binary.BigEndian.PutUint16(b[6:8], uplinkID)
+	return append(b, ctx...)
+}
+
+func unmarshalMeshContext(b []byte) (uint8, [meshRelayIDLen]byte, uint16, []byte, bool) {
+	var relayID [meshRelayIDLen]byte
+	if len(b) < meshContextHeaderLen || b[0] != meshContextMarker {
+		return 0, relayID, 0, nil, false
+	}
+
+	copy(relayID[:], b[2:6])
+	return b[1], relayID, binary.BigEndian.Uint16(b[6:8]), b[meshContextHeaderLen:], true
+}
+
+func meshMHDR(payloadType, hopCount uint8) byte {
+	return meshMType<<5 | (payloadType&0x03)<<3 | (hopCount-1)&0x07
+}
+
+func meshMIC(key lorawan.AES128Key, b []byte) ([meshMICLen]byte, error) {
+	var mic [meshMICLen]byte
+
+	hash, err := cmac.New(key[:])
+	if err != nil {
+		return mic, errors.Wrap(err, "new cmac error")
+	}
+	if _, err := hash.Write(b); err != nil {
+		return mic, errors.Wrap(err, "write cmac error")
+	}
+
+	copy(mic[:], hash.Sum(nil))
+	return mic, nil
+}
+
+// unmarshalMeshPayload validates the MHDR, payload type and MIC and returns
+// the hop count and the payload between the MHDR and MIC.
+func unmarshalMeshPayload(b []byte, payloadType uint8, metadataLen int, key lorawan.AES128Key) (uint8, []byte, error) {
+	if len(b) < 1+metadataLen+meshRelayIDLen+meshMICLen || !isMeshFrame(b) {
+		return 0, nil, errNotMeshFrame
+	}
+
+	if (b[0]>>3)&0x03 != payloadType {
+		return 0, nil, errNotMeshFrame
+	}
+
+	mic, err := meshMIC(key, b[:len(b)-meshMICLen])
+	if err != nil {
+		return 0, nil, err
+	}
+	if !bytes.Equal(mic[:], b[len(b)-meshMICLen:]) {
+		return 0, nil, errNotMeshFrame
+	}
+
+	return b[0]&0x07 + 1, b[1 : len(b)-meshMICLen], nil
+}
+
+func unmarshalMeshUplink(b []byte, key lorawan.AES128Key) (meshUplinkPayload, error) {
+	var up meshUplinkPayload
+
+	hopCount, pl, err := unmarshalMeshPayload(b, meshPayloadTypeUplink, meshUplinkMetadataLen, key)
+	if err != nil {
+		return up, err
+	}
+
+	up.hopCount = hopCount
+	up.uplinkID = binary.BigEndian.Uint16(pl[0:2]) >> 4
+	up.dr = pl[1] & 0x0f
+	up.rssi = -int16(pl[2])
+	up.snr = int8(pl[3]<<2) >> 2 // sign-extend the 6 bit value
+	up.channel = pl[4]
+	copy(up.relayID[:], pl[meshUplinkMetadataLen:meshUplinkMetadataLen+meshRelayIDLen])
+	up.phyPayload = append([]byte{}, pl[meshUplinkMetadataLen+meshRelayIDLen:]...)
+
+	return up, nil
+}
+
+func (up meshUplinkPayload) marshal(key lorawan.AES128Key) ([]byte, error) {
+	b := make([]byte, 1+meshUplinkMetadataLen, 1+meshUplinkMetadataLen+meshRelayIDLen+len(up.phyPayload)+meshMICLen)
+	b[0] = meshMHDR(meshPayloadTypeUplink, up.hopCount)
+	binary.BigEndian.PutUint16(b[1:3], up.uplinkID<<4|uint16(up.dr&0x0f))
+	b[3] = uint8(-up.rssi)
+	b[4] = uint8(up.snr) & 0x3f
+	b[5] = up.channel
+	b = append(b, up.relayID[:]...)
+	b = append(b, up.phyPayload...)
+
+	mic, err := meshMIC(key, b)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, mic[:]...), nil
+}
+
+func unmarshalMeshDownlink(b []byte, key lorawan.AES128Key) (meshDownlinkPayload, error) {
+	var down meshDownlinkPayload
+
+	hopCount, pl, err := unmarshalMeshPayload(b, meshPayloadTypeDownlink, meshDownlinkMetadataLen, key)
+	if err != nil {
+		return down, err
+	}
+
+	down.hopCount = hopCount
+	down.uplinkID = binary.BigEndian.Uint16(pl[0:2]) >> 4
+	down.dr = pl[1] & 0x0f
+	down.frequency = (uint32(pl[2])<<16 | uint32(pl[3])<<8 | uint32(pl[4])) * 100
+	down.txPower = pl[5] >> 4
+	down.delay = pl[5]&0x0f + 1
+	copy(down.relayID[:], pl[meshDownlinkMetadataLen:meshDownlinkMetadataLen+meshRelayIDLen])
+	down.phyPayload = append([]byte{}, pl[meshDownlinkMetadataLen+meshRelayIDLen:]...)
+
+	return down, nil
+}
+
+func (down meshDownlinkPayload) marshal(key lorawan.AES128Key) ([]byte, error) {
+	freq := down.frequency / 100
+
+	b := make([]byte, 1+meshDownlinkMetadataLen, 1+meshDownlinkMetadataLen+meshRelayIDLen+len(down.phyPayload)+meshMICLen)
+	b[0] = meshMHDR(meshPayloadTypeDownlink, down.hopCount)
+	binary.BigEndian.PutUint16(b[1:3], down.uplinkID<<4|uint16(down.dr&0x0f))
+	b[3] = uint8(freq >> 16)
+	b[4] = uint8(freq >> 8)
+	b[5] = uint8(freq)
+	b[6] = (down.txPower&0x0f)<<4 | (down.delay-1)&0x0f
+	b = append(b, down.relayID[:]...)
+	b = append(b, down.phyPayload...)
+
+	mic, err := meshMIC(key, b)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, mic[:]...), nil
+}
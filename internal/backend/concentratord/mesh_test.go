@@ -0,0 +1,208 @@
+package concentratord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func testMesh(t *testing.T) *mesh {
+	var conf config.Config
+	conf.Backend.Concentratord.Mesh = config.ConcentratordMesh{
+		Enabled:     true,
+		Region:      "EU868",
+		SigningKey:  "01020304050607080102030405060708",
+		Frequencies: []int{869525000},
+		DataRate:    3,
+		TXPower:     16,
+	}
+
+	m, err := newMesh(conf)
+	require.NoError(t, err)
+	return m
+}
+
+func TestMeshPayload(t *testing.T) {
+	key := lorawan.AES128Key{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("Uplink", func(t *testing.T) {
+		assert := require.New(t)
+
+		up := meshUplinkPayload{
+			hopCount:   2,
+			uplinkID:   1234,
+			dr:         5,
+			rssi:       -120,
+			snr:        -10,
+			channel:    2,
+			relayID:    [4]byte{1, 2, 3, 4},
+			phyPayload: []byte{0x40, 1, 2, 3},
+		}
+
+		b, err := up.marshal(key)
+		assert.NoError(err)
+		assert.True(isMeshFrame(b))
+		assert.Equal(byte(0xe1), b[0])
+
+		out, err := unmarshalMeshUplink(b, key)
+		assert.NoError(err)
+		assert.Equal(up, out)
+
+		// invalid mic
+		b[len(b)-1]++
+		_, err = unmarshalMeshUplink(b, key)
+		assert.Equal(errNotMeshFrame, err)
+	})
+
+	t.Run("Downlink", func(t *testing.T) {
+		assert := require.New(t)
+
+		down := meshDownlinkPayload{
+			hopCount:   1,
+			uplinkID:   1234,
+			dr:         5,
+			frequency:  868100000,
+			txPower:    7,
+			delay:      1,
+			relayID:    [4]byte{1, 2, 3, 4},
+			phyPayload: []byte{0x60, 1, 2, 3},
+		}
+
+		b, err := down.marshal(key)
+		assert.NoError(err)
+
+		out, err := unmarshalMeshDownlink(b, key)
+		assert.NoError(err)
+		assert.Equal(down, out)
+
+		// a downlink is not an uplink
+		_, err = unmarshalMeshUplink(b, key)
+		assert.Equal(errNotMeshFrame, err)
+	})
+}
+
+func TestMeshUnwrapUplink(t *testing.T) {
+	assert := require.New(t)
+	m := testMesh(t)
+
+	b, err := meshUplinkPayload{
+		hopCount:   1,
+		uplinkID:   10,
+		dr:         5,
+		rssi:       -100,
+		snr:        7,
+		channel:    1,
+		relayID:    [4]byte{1, 2, 3, 4},
+		phyPayload: []byte{0x40, 1, 2, 3},
+	}.marshal(m.signingKey)
+	assert.NoError(err)
+
+	pl := gw.UplinkFrame{
+		PhyPayload: b,
+		TxInfo: &gw.UplinkTXInfo{
+			Frequency: 869525000,
+		},
+		RxInfo: &gw.UplinkRXInfo{
+			Rssi:    -50,
+			LoraSnr: 10,
+			Context: []byte{1, 2, 3},
+		},
+	}
+
+	_, err = m.unwrapUplink(&pl)
+	assert.NoError(err)
+	assert.Equal([]byte{0x40, 1, 2, 3}, pl.PhyPayload)
+	assert.EqualValues(868300000, pl.TxInfo.Frequency)
+	assert.Equal(&gw.LoRaModulationInfo{
+		Bandwidth:       125,
+		SpreadingFactor: 7,
+		CodeRate:        "4/5",
+	}, pl.TxInfo.GetLoraModulationInfo())
+	assert.EqualValues(-100, pl.RxInfo.Rssi)
+	assert.EqualValues(7, pl.RxInfo.LoraSnr)
+	assert.EqualValues(1, pl.RxInfo.Channel)
+	assert.Equal([]byte{0xe0, 1, 1, 2, 3, 4, 0, 10, 1, 2, 3}, pl.RxInfo.Context)
+
+	t.Run("Not a mesh frame", func(t *testing.T) {
+		assert := require.New(t)
+
+		pl := gw.UplinkFrame{
+			PhyPayload: []byte{0xe0, 1, 2, 3},
+		}
+		_, err := m.unwrapUplink(&pl)
+		assert.Equal(errNotMeshFrame, err)
+	})
+}
+
+func TestMeshWrapDownlink(t *testing.T) {
+	assert := require.New(t)
+	m := testMesh(t)
+
+	t.Run("Not relayed", func(t *testing.T) {
+		assert := require.New(t)
+
+		pl := gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				Context: []byte{1, 2, 3},
+			},
+		}
+		ok, err := m.wrapDownlink(&pl)
+		assert.NoError(err)
+		assert.False(ok)
+	})
+
+	pl := gw.DownlinkFrame{
+		PhyPayload: []byte{0x60, 1, 2, 3},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Frequency:  868300000,
+			Power:      14,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:             125,
+					SpreadingFactor:       7,
+					CodeRate:              "4/5",
+					PolarizationInversion: true,
+				},
+			},
+			Timing: gw.DownlinkTiming_DELAY,
+			TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+				DelayTimingInfo: &gw.DelayTimingInfo{
+					Delay: ptypes.DurationProto(time.Second),
+				},
+			},
+			Context: []byte{0xe0, 1, 1, 2, 3, 4, 0, 10, 1, 2, 3},
+		},
+	}
+
+	ok, err := m.wrapDownlink(&pl)
+	assert.NoError(err)
+	assert.True(ok)
+
+	assert.EqualValues(869525000, pl.TxInfo.Frequency)
+	assert.EqualValues(16, pl.TxInfo.Power)
+	assert.Equal(gw.DownlinkTiming_IMMEDIATELY, pl.TxInfo.Timing)
+	assert.Equal([]byte{1, 2, 3}, pl.TxInfo.Context)
+	assert.EqualValues(9, pl.TxInfo.GetLoraModulationInfo().SpreadingFactor)
+
+	down, err := unmarshalMeshDownlink(pl.PhyPayload, m.signingKey)
+	assert.NoError(err)
+	assert.Equal(meshDownlinkPayload{
+		hopCount:   1,
+		uplinkID:   10,
+		dr:         5,
+		frequency:  868300000,
+		txPower:    7,
+		delay:      1,
+		relayID:    [4]byte{1, 2, 3, 4},
+		phyPayload: []byte{0x60, 1, 2, 3},
+	}, down)
+}
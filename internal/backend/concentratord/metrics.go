@@ -15,6 +15,36 @@ var (
 		Name: "backend_concentratord_command_count",
 		Help: "The number of received commands (per type)",
 	}, []string{"command"})
+
+	cto = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_concentratord_command_timeout_count",
+		Help: "The number of commands for which no reply was received within the command timeout (per type)",
+	}, []string{"command"})
+
+	cd = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "backend_concentratord_command_duration_seconds",
+		Help: "The round-trip duration of the commands (per type)",
+	}, []string{"command"})
+
+	uec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_concentratord_unmarshal_error_count",
+		Help: "The number of events and command replies that could not be unmarshaled (per type)",
+	}, []string{"type"})
+
+	uc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_concentratord_unknown_event_count",
+		Help: "The number of received events of an unknown type (per type)",
+	}, []string{"event"})
+
+	cdc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backend_concentratord_crc_dropped_count",
+		Help: "The number of uplinks dropped because of an invalid CRC",
+	})
+
+	mc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_concentratord_mesh_count",
+		Help: "The number of unwrapped mesh uplinks and wrapped mesh downlinks (per direction)",
+	}, []string{"direction"})
 )
 
 func eventCounter(typ string) prometheus.Counter {
@@ -24,3 +54,27 @@ func eventCounter(typ string) prometheus.Counter {
 func commandCounter(typ string) prometheus.Counter {
 	return cc.With(prometheus.Labels{"command": typ})
 }
+
+func commandTimeoutCounter(typ string) prometheus.Counter {
+	return cto.With(prometheus.Labels{"command": typ})
+}
+
+func commandDurationHistogram(typ string) prometheus.Observer {
+	return cd.With(prometheus.Labels{"command": typ})
+}
+
+func unmarshalErrorCounter(typ string) prometheus.Counter {
+	return uec.With(prometheus.Labels{"type": typ})
+}
+
+func unknownEventCounter(typ string) prometheus.Counter {
+	return uc.With(prometheus.Labels{"event": typ})
+}
+
+func crcDroppedCounter() prometheus.Counter {
+	return cdc
+}
+
+func meshCounter(direction string) prometheus.Counter {
+	return mc.With(prometheus.Labels{"direction": direction})
+}
@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// gatewayConnState holds the connection state of a single gateway.
+type gatewayConnState struct {
+	online    bool
+	lastSeen  time.Time
+	connState *events.ConnState
+}
+
+// connStateTracker wraps a Backend and unifies the detection of the gateway
+// connection state across the backends. A gateway goes online when the
+// backend reports the connection, or when an event (uplink, stats or
+// keepalive) is received from the gateway. It goes offline when the backend
+// reports the disconnection, or when no event has been received within the
+// keepalive timeout.
+//
+// Only the state changes are forwarded as (un)subscribe events, each with
+// the connection state details, such that exactly one conn event is
+// published per state change.
+type connStateTracker struct {
+	Backend
+
+	backendType      string
+	keepaliveTimeout time.Duration
+
+	uplinkFrameChan    chan gw.UplinkFrame
+	gatewayStatsChan   chan gw.GatewayStats
+	subscribeEventChan chan events.Subscribe
+	sender             *buffer.Sender
+
+	sync.Mutex
+	gateways map[lorawan.EUI64]*gatewayConnState
+}
+
+func newConnStateTracker(b Backend, conf config.Config) *connStateTracker {
+	t := connStateTracker{
+		Backend:            b,
+		backendType:        conf.Backend.Type,
+		keepaliveTimeout:   conf.Backend.ConnState.KeepaliveTimeout,
+		uplinkFrameChan:    make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:   make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
+		subscribeEventChan: make(chan events.Subscribe),
+		sender:             buffer.NewSender("conn_state", conf),
+		gateways:           make(map[lorawan.EUI64]*gatewayConnState),
+	}
+
+	go t.subscribeEventLoop()
+	go t.uplinkFrameLoop()
+	go t.gatewayStatsLoop()
+
+	if t.keepaliveTimeout != 0 {
+		go t.keepaliveLoop()
+	}
+
+	return &t
+}
+
+// GetUplinkFrameChan returns the channel for received uplinks.
+func (t *connStateTracker) GetUplinkFrameChan() chan gw.UplinkFrame {
+	return t.uplinkFrameChan
+}
+
+// GetGatewayStatsChan returns the channel for gateway statistics.
+func (t *connStateTracker) GetGatewayStatsChan() chan gw.GatewayStats {
+	return t.gatewayStatsChan
+}
+
+// GetSubscribeEventChan returns the channel for the (un)subscribe events.
+func (t *connStateTracker) GetSubscribeEventChan() chan events.Subscribe {
+	return t.subscribeEventChan
+}
+
+func (t *connStateTracker) subscribeEventLoop() {
+	for event := range t.Backend.GetSubscribeEventChan() {
+		if event.Subscribe {
+			t.setOnline(event.GatewayID, event.ConnState, time.Now())
+		} else {
+			t.setOffline(event.GatewayID, event.ConnState)
+		}
+	}
+}
+
+func (t *connStateTracker) uplinkFrameLoop() {
+	for uplinkFrame := range t.Backend.GetUplinkFrameChan() {
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], uplinkFrame.GetRxInfo().GetGatewayId())
+
+		t.setOnline(gatewayID, nil, time.Now())
+		t.sender.UplinkFrame(t.uplinkFrameChan, uplinkFrame)
+	}
+}
+
+func (t *connStateTracker) gatewayStatsLoop() {
+	for stats := range t.Backend.GetGatewayStatsChan() {
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], stats.GetGatewayId())
+
+		t.setOnline(gatewayID, nil, time.Now())
+		t.sender.GatewayStats(t.gatewayStatsChan, stats)
+	}
+}
+
+func (t *connStateTracker) keepaliveLoop() {
+	for {
+		time.Sleep(t.keepaliveTimeout / 2)
+		t.expire(time.Now())
+	}
+}
+
+// setOnline marks the gateway as seen. When the gateway was not yet online,
+// or when the backend reports a new connection (connState is set), the
+// subscribe event is forwarded.
+func (t *connStateTracker) setOnline(gatewayID lorawan.EUI64, connState *events.ConnState, now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+
+	gw, ok := t.gateways[gatewayID]
+	if !ok {
+		gw = &gatewayConnState{}
+		t.gateways[gatewayID] = gw
+	}
+	gw.lastSeen = now
+
+	if gw.online && connState == nil {
+		return
+	}
+
+	if connState == nil {
+		// The gateway came (back) online without the backend reporting a
+		// new connection, e.g. after a keepalive timeout. The connection
+		// details of the previous connection are re-used.
+		connState = t.copyConnState(gw)
+		connState.Reason = ""
+		connState.ConnectTime, _ = ptypes.TimestampProto(now)
+	}
+
+	gw.online = true
+	gw.connState = connState
+	connStateCounter("online").Inc()
+
+	t.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: gatewayID, ConnState: t.copyConnState(gw)}
+}
+
+// setOffline marks the gateway as offline. The unsubscribe event is only
+// forwarded when the gateway was online.
+func (t *connStateTracker) setOffline(gatewayID lorawan.EUI64, connState *events.ConnState) {
+	t.Lock()
+	defer t.Unlock()
+
+	gw, ok := t.gateways[gatewayID]
+	if !ok || !gw.online {
+		return
+	}
+
+	if connState != nil {
+		gw.connState = connState
+	}
+	gw.online = false
+	connStateCounter("offline").Inc()
+
+	t.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: gatewayID, ConnState: t.copyConnState(gw)}
+}
+
+// expire marks the online gateways from which no event has been received
+// within the keepalive timeout as offline.
+func (t *connStateTracker) expire(now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+
+	for gatewayID, gw := range t.gateways {
+		if !gw.online || now.Sub(gw.lastSeen) <= t.keepaliveTimeout {
+			continue
+		}
+
+		connState := t.copyConnState(gw)
+		connState.Reason = fmt.Sprintf("keepalive timeout (no event received within %s)", t.keepaliveTimeout)
+
+		gw.online = false
+		gw.connState = connState
+		connStateCounter("keepalive_timeout").Inc()
+
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"last_seen":  gw.lastSeen,
+		}).Warning("backend/conn_state: gateway keepalive timeout")
+
+		t.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: gatewayID, ConnState: t.copyConnState(gw)}
+	}
+}
+
+// copyConnState returns a copy of the connection state details of the given
+// gateway. When the backend did not report any details, only the backend
+// type is set.
+func (t *connStateTracker) copyConnState(gw *gatewayConnState) *events.ConnState {
+	if gw.connState == nil {
+		return &events.ConnState{BackendType: t.backendType}
+	}
+
+	connState := *gw.connState
+	return &connState
+}
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestConnStateTracker(t *testing.T) {
+	b := &testBackend{
+		uplinkFrameChan:    make(chan gw.UplinkFrame),
+		gatewayStatsChan:   make(chan gw.GatewayStats),
+		subscribeEventChan: make(chan events.Subscribe),
+	}
+
+	var conf config.Config
+	conf.Backend.Type = "concentratord"
+
+	// the keepalive loop is not started, expire is called by the test
+	tr := newConnStateTracker(b, conf)
+	tr.keepaliveTimeout = time.Minute
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("backend reports connection", func(t *testing.T) {
+		assert := require.New(t)
+
+		b.subscribeEventChan <- events.Subscribe{
+			Subscribe: true,
+			GatewayID: gatewayID,
+			ConnState: &events.ConnState{BackendType: "concentratord", ProtocolVersion: "3.3.0"},
+		}
+
+		event := <-tr.GetSubscribeEventChan()
+		assert.True(event.Subscribe)
+		assert.Equal(gatewayID, event.GatewayID)
+		assert.Equal("3.3.0", event.ConnState.ProtocolVersion)
+	})
+
+	t.Run("events of online gateway are not forwarded", func(t *testing.T) {
+		assert := require.New(t)
+
+		b.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: gatewayID}
+		b.gatewayStatsChan <- gw.GatewayStats{GatewayId: gatewayID[:]}
+
+		stats := <-tr.GetGatewayStatsChan()
+		assert.Equal(gatewayID[:], stats.GatewayId)
+
+		select {
+		case event := <-tr.GetSubscribeEventChan():
+			t.Fatalf("unexpected event: %+v", event)
+		default:
+		}
+	})
+
+	t.Run("keepalive timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		// nothing expires within the keepalive timeout
+		go tr.expire(time.Now().Add(30 * time.Second))
+		select {
+		case event := <-tr.GetSubscribeEventChan():
+			t.Fatalf("unexpected event: %+v", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		go tr.expire(time.Now().Add(2 * time.Minute))
+
+		event := <-tr.GetSubscribeEventChan()
+		assert.False(event.Subscribe)
+		assert.Equal(gatewayID, event.GatewayID)
+		assert.Equal("3.3.0", event.ConnState.ProtocolVersion)
+		assert.Equal("keepalive timeout (no event received within 1m0s)", event.ConnState.Reason)
+	})
+
+	t.Run("uplink brings gateway back online", func(t *testing.T) {
+		assert := require.New(t)
+
+		go func() {
+			b.uplinkFrameChan <- gw.UplinkFrame{RxInfo: &gw.UplinkRXInfo{GatewayId: gatewayID[:]}}
+		}()
+
+		event := <-tr.GetSubscribeEventChan()
+		assert.True(event.Subscribe)
+		assert.Equal("3.3.0", event.ConnState.ProtocolVersion)
+		assert.Equal("", event.ConnState.Reason)
+		assert.NotNil(event.ConnState.ConnectTime)
+
+		uplinkFrame := <-tr.GetUplinkFrameChan()
+		assert.Equal(gatewayID[:], uplinkFrame.RxInfo.GatewayId)
+	})
+
+	t.Run("backend reports disconnection", func(t *testing.T) {
+		assert := require.New(t)
+
+		b.subscribeEventChan <- events.Subscribe{
+			Subscribe: false,
+			GatewayID: gatewayID,
+			ConnState: &events.ConnState{BackendType: "concentratord", Reason: "event socket receive error"},
+		}
+
+		event := <-tr.GetSubscribeEventChan()
+		assert.False(event.Subscribe)
+		assert.Equal("event socket receive error", event.ConnState.Reason)
+
+		// a second disconnect is not forwarded
+		go func() {
+			b.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: gatewayID}
+		}()
+		select {
+		case event := <-tr.GetSubscribeEventChan():
+			t.Fatalf("unexpected event: %+v", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
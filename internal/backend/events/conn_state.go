@@ -0,0 +1,41 @@
+package events
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// Connection states.
+const (
+	ConnStateOnline  = "ONLINE"
+	ConnStateOffline = "OFFLINE"
+)
+
+// ConnState contains the connection state of a gateway and the backend
+// specific connection details. It implements proto.Message so that it can be
+// published using the configured marshaler.
+type ConnState struct {
+	// Gateway ID.
+	GatewayId []byte `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayID,proto3" json:"gateway_id,omitempty"`
+	// State (ONLINE or OFFLINE).
+	State string `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	// Backend type (e.g. semtech_udp, basic_station, concentratord).
+	BackendType string `protobuf:"bytes,3,opt,name=backend_type,json=backendType,proto3" json:"backend_type,omitempty"`
+	// Remote address (e.g. the UDP source or websocket peer address).
+	RemoteAddress string `protobuf:"bytes,4,opt,name=remote_address,json=remoteAddress,proto3" json:"remote_address,omitempty"`
+	// Protocol version.
+	ProtocolVersion string `protobuf:"bytes,5,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	// Time the gateway connected.
+	ConnectTime *timestamp.Timestamp `protobuf:"bytes,6,opt,name=connect_time,json=connectTime,proto3" json:"connect_time,omitempty"`
+	// Reason the gateway went offline.
+	Reason string `protobuf:"bytes,7,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+// Reset resets the connection state.
+func (m *ConnState) Reset() { *m = ConnState{} }
+
+// String returns the text representation of the connection state.
+func (m *ConnState) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*ConnState) ProtoMessage() {}
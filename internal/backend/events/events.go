@@ -9,4 +9,9 @@ type Subscribe struct {
 
 	// Subscribe (true) or unsubscribe (false) the gateway.
 	Subscribe bool
+
+	// Connection state details (optional). This is only set when the
+	// connection state of the gateway changed, in which case a conn event
+	// is published.
+	ConnState *ConnState
 }
@@ -0,0 +1,31 @@
+package events
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// Log contains a log / alarm event sent by the gateway (e.g. radio errors).
+// It implements proto.Message so that it can be published using the
+// configured marshaler.
+type Log struct {
+	// Gateway ID.
+	GatewayId []byte `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayID,proto3" json:"gateway_id,omitempty"`
+	// Log ID (UUID).
+	LogId []byte `protobuf:"bytes,2,opt,name=log_id,json=logID,proto3" json:"log_id,omitempty"`
+	// Time the log event was received.
+	Time *timestamp.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	// Severity (e.g. INFO, WARNING, ERROR).
+	Severity string `protobuf:"bytes,4,opt,name=severity,proto3" json:"severity,omitempty"`
+	// Log message.
+	Message string `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+// Reset resets the log event.
+func (m *Log) Reset() { *m = Log{} }
+
+// String returns the text representation of the log event.
+func (m *Log) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*Log) ProtoMessage() {}
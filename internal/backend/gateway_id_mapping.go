@@ -0,0 +1,319 @@
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// downlinkBoardTTL defines the duration the mapped gateway ID of a downlink
+// sent to a board gateway ID is kept for mapping the TX acknowledgement.
+const downlinkBoardTTL = time.Minute
+
+// logicalGateway contains the mapped gateway IDs of a gateway.
+type logicalGateway struct {
+	gatewayID lorawan.EUI64
+	boards    []lorawan.EUI64
+}
+
+// physicalGateway contains the gateway ID, as reported by the backend, and
+// the board of a mapped gateway ID.
+type physicalGateway struct {
+	gatewayID lorawan.EUI64
+	board     uint32
+	hasBoard  bool
+}
+
+// downlinkToken identifies a downlink sent to a board gateway ID.
+type downlinkToken struct {
+	gatewayID lorawan.EUI64
+	token     uint32
+}
+
+// downlinkBoard holds the board gateway ID of a downlink.
+type downlinkBoard struct {
+	gatewayID lorawan.EUI64
+	sent      time.Time
+}
+
+// gatewayIDMapper wraps a Backend and maps the gateway IDs reported by the
+// backend to the configured (logical) gateway IDs. The mapping is applied to
+// all events, such that the integration topics and command subscriptions use
+// the mapped gateway ID. The gateway IDs of the commands are mapped back
+// before these are sent to the backend.
+//
+// Optionally, the uplinks of each board of a multi-board gateway can be
+// mapped to a separate gateway ID. Downlinks for such a board gateway ID are
+// sent using the board of the gateway.
+type gatewayIDMapper struct {
+	Backend
+
+	logical  map[lorawan.EUI64]logicalGateway
+	physical map[lorawan.EUI64]physicalGateway
+
+	uplinkFrameChan             chan gw.UplinkFrame
+	gatewayStatsChan            chan gw.GatewayStats
+	downlinkTXAckChan           chan gw.DownlinkTXAck
+	subscribeEventChan          chan events.Subscribe
+	rawPacketForwarderEventChan chan gw.RawPacketForwarderEvent
+	logEventChan                chan events.Log
+	sender                      *buffer.Sender
+
+	sync.Mutex
+	downlinks map[downlinkToken]downlinkBoard
+}
+
+func newGatewayIDMapper(b Backend, conf config.Config) (*gatewayIDMapper, error) {
+	m := gatewayIDMapper{
+		Backend:            b,
+		logical:            make(map[lorawan.EUI64]logicalGateway),
+		physical:           make(map[lorawan.EUI64]physicalGateway),
+		uplinkFrameChan:    make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:   make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
+		downlinkTXAckChan:  make(chan gw.DownlinkTXAck, conf.Backend.Channels.DownlinkTXAckSize),
+		subscribeEventChan: make(chan events.Subscribe),
+		sender:             buffer.NewSender("gateway_id_mapping", conf),
+		downlinks:          make(map[downlinkToken]downlinkBoard),
+	}
+
+	for _, mapping := range conf.Backend.GatewayIDMapping {
+		var gatewayID lorawan.EUI64
+		var lg logicalGateway
+
+		if err := gatewayID.UnmarshalText([]byte(mapping.GatewayID)); err != nil {
+			return nil, errors.Wrap(err, "decode gateway_id error")
+		}
+		if err := lg.gatewayID.UnmarshalText([]byte(mapping.MappedGatewayID)); err != nil {
+			return nil, errors.Wrap(err, "decode mapped_gateway_id error")
+		}
+		m.physical[lg.gatewayID] = physicalGateway{gatewayID: gatewayID}
+
+		for i, s := range mapping.BoardGatewayIDs {
+			var boardID lorawan.EUI64
+			if err := boardID.UnmarshalText([]byte(s)); err != nil {
+				return nil, errors.Wrap(err, "decode board_gateway_ids error")
+			}
+			lg.boards = append(lg.boards, boardID)
+			m.physical[boardID] = physicalGateway{gatewayID: gatewayID, board: uint32(i), hasBoard: true}
+		}
+
+		m.logical[gatewayID] = lg
+	}
+
+	go m.uplinkFrameLoop()
+	go m.gatewayStatsLoop()
+	go m.downlinkTXAckLoop()
+	go m.subscribeEventLoop()
+
+	if c := b.GetRawPacketForwarderEventChan(); c != nil {
+		m.rawPacketForwarderEventChan = make(chan gw.RawPacketForwarderEvent, conf.Backend.Channels.RawPacketForwarderEventSize)
+		go m.rawPacketForwarderEventLoop(c)
+	}
+
+	if c := b.GetLogEventChan(); c != nil {
+		m.logEventChan = make(chan events.Log, conf.Backend.Channels.LogEventSize)
+		go m.logEventLoop(c)
+	}
+
+	return &m, nil
+}
+
+// GetUplinkFrameChan returns the channel for received uplinks.
+func (m *gatewayIDMapper) GetUplinkFrameChan() chan gw.UplinkFrame {
+	return m.uplinkFrameChan
+}
+
+// GetGatewayStatsChan returns the channel for gateway statistics.
+func (m *gatewayIDMapper) GetGatewayStatsChan() chan gw.GatewayStats {
+	return m.gatewayStatsChan
+}
+
+// GetDownlinkTXAckChan returns the channel for downlink tx acknowledgements.
+func (m *gatewayIDMapper) GetDownlinkTXAckChan() chan gw.DownlinkTXAck {
+	return m.downlinkTXAckChan
+}
+
+// GetSubscribeEventChan returns the channel for the (un)subscribe events.
+func (m *gatewayIDMapper) GetSubscribeEventChan() chan events.Subscribe {
+	return m.subscribeEventChan
+}
+
+// GetRawPacketForwarderEventChan returns the raw packet-forwarder event channel.
+func (m *gatewayIDMapper) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEvent {
+	return m.rawPacketForwarderEventChan
+}
+
+// GetLogEventChan returns the channel for gateway log events.
+func (m *gatewayIDMapper) GetLogEventChan() chan events.Log {
+	return m.logEventChan
+}
+
+// SendDownlinkFrame maps the gateway ID of the given downlink and sends it
+// to the backend.
+func (m *gatewayIDMapper) SendDownlinkFrame(df gw.DownlinkFrame) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], df.GetTxInfo().GetGatewayId())
+
+	pg, ok := m.physical[gatewayID]
+	if !ok {
+		return m.Backend.SendDownlinkFrame(df)
+	}
+
+	// the tx info is copied, as the downlink frame is shared with the
+	// forwarder (e.g. for retrying the downlink)
+	df.TxInfo = proto.Clone(df.GetTxInfo()).(*gw.DownlinkTXInfo)
+	df.TxInfo.GatewayId = pg.gatewayID[:]
+
+	if pg.hasBoard {
+		df.TxInfo.Board = pg.board
+		m.addDownlink(pg.gatewayID, df.Token, gatewayID, time.Now())
+	}
+
+	return m.Backend.SendDownlinkFrame(df)
+}
+
+// ApplyConfiguration maps the gateway ID of the given configuration and
+// applies it.
+func (m *gatewayIDMapper) ApplyConfiguration(conf gw.GatewayConfiguration) error {
+	conf.GatewayId = m.physicalID(conf.GetGatewayId())
+	return m.Backend.ApplyConfiguration(conf)
+}
+
+// RawPacketForwarderCommand maps the gateway ID of the given command and
+// sends it to the backend.
+func (m *gatewayIDMapper) RawPacketForwarderCommand(pl gw.RawPacketForwarderCommand) error {
+	pl.GatewayId = m.physicalID(pl.GetGatewayId())
+	return m.Backend.RawPacketForwarderCommand(pl)
+}
+
+// mappedID returns the mapped gateway ID of the given gateway ID bytes.
+func (m *gatewayIDMapper) mappedID(b []byte) []byte {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], b)
+
+	if lg, ok := m.logical[gatewayID]; ok {
+		return lg.gatewayID[:]
+	}
+	return b
+}
+
+// physicalID returns the gateway ID, as reported by the backend, of the
+// given mapped gateway ID bytes.
+func (m *gatewayIDMapper) physicalID(b []byte) []byte {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], b)
+
+	if pg, ok := m.physical[gatewayID]; ok {
+		return pg.gatewayID[:]
+	}
+	return b
+}
+
+func (m *gatewayIDMapper) uplinkFrameLoop() {
+	for uplinkFrame := range m.Backend.GetUplinkFrameChan() {
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], uplinkFrame.GetRxInfo().GetGatewayId())
+
+		if lg, ok := m.logical[gatewayID]; ok {
+			mappedID := lg.gatewayID
+			if board := uplinkFrame.GetRxInfo().GetBoard(); int(board) < len(lg.boards) {
+				mappedID = lg.boards[board]
+			}
+
+			uplinkFrame.RxInfo = proto.Clone(uplinkFrame.GetRxInfo()).(*gw.UplinkRXInfo)
+			uplinkFrame.RxInfo.GatewayId = mappedID[:]
+		}
+
+		m.sender.UplinkFrame(m.uplinkFrameChan, uplinkFrame)
+	}
+}
+
+func (m *gatewayIDMapper) gatewayStatsLoop() {
+	for stats := range m.Backend.GetGatewayStatsChan() {
+		stats.GatewayId = m.mappedID(stats.GetGatewayId())
+		m.sender.GatewayStats(m.gatewayStatsChan, stats)
+	}
+}
+
+func (m *gatewayIDMapper) downlinkTXAckLoop() {
+	for txAck := range m.Backend.GetDownlinkTXAckChan() {
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], txAck.GetGatewayId())
+
+		if boardID, ok := m.popDownlink(gatewayID, txAck.GetToken()); ok {
+			txAck.GatewayId = boardID[:]
+		} else {
+			txAck.GatewayId = m.mappedID(txAck.GetGatewayId())
+		}
+
+		m.sender.DownlinkTXAck(m.downlinkTXAckChan, txAck)
+	}
+}
+
+// subscribeEventLoop maps the (un)subscribe events. For a gateway with board
+// gateway IDs, the event is forwarded for each board gateway ID, such that
+// these are subscribed to the commands.
+func (m *gatewayIDMapper) subscribeEventLoop() {
+	for event := range m.Backend.GetSubscribeEventChan() {
+		lg, ok := m.logical[event.GatewayID]
+		if !ok {
+			m.subscribeEventChan <- event
+			continue
+		}
+
+		for _, gatewayID := range append([]lorawan.EUI64{lg.gatewayID}, lg.boards...) {
+			e := event
+			e.GatewayID = gatewayID
+			m.subscribeEventChan <- e
+		}
+	}
+}
+
+func (m *gatewayIDMapper) rawPacketForwarderEventLoop(c chan gw.RawPacketForwarderEvent) {
+	for event := range c {
+		event.GatewayId = m.mappedID(event.GetGatewayId())
+		m.sender.RawPacketForwarderEvent(m.rawPacketForwarderEventChan, event)
+	}
+}
+
+func (m *gatewayIDMapper) logEventLoop(c chan events.Log) {
+	for event := range c {
+		event.GatewayId = m.mappedID(event.GatewayId)
+		m.sender.LogEvent(m.logEventChan, event)
+	}
+}
+
+// addDownlink stores the board gateway ID of the given downlink, for mapping
+// the TX acknowledgement.
+func (m *gatewayIDMapper) addDownlink(gatewayID lorawan.EUI64, token uint32, boardID lorawan.EUI64, now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	for k, d := range m.downlinks {
+		if now.Sub(d.sent) > downlinkBoardTTL {
+			delete(m.downlinks, k)
+		}
+	}
+
+	m.downlinks[downlinkToken{gatewayID: gatewayID, token: token}] = downlinkBoard{gatewayID: boardID, sent: now}
+}
+
+// popDownlink returns and removes the board gateway ID of the given
+// downlink.
+func (m *gatewayIDMapper) popDownlink(gatewayID lorawan.EUI64, token uint32) (lorawan.EUI64, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := downlinkToken{gatewayID: gatewayID, token: token}
+	d, ok := m.downlinks[key]
+	delete(m.downlinks, key)
+	return d.gatewayID, ok
+}
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestGatewayIDMapper(t *testing.T) {
+	assert := require.New(t)
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	mappedID := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	board0ID := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 2}
+	board1ID := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 3}
+	otherID := lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+
+	b := testBackend{
+		uplinkFrameChan:    make(chan gw.UplinkFrame),
+		gatewayStatsChan:   make(chan gw.GatewayStats),
+		subscribeEventChan: make(chan events.Subscribe),
+		downlinkTXAckChan:  make(chan gw.DownlinkTXAck),
+		downlinkFrameChan:  make(chan gw.DownlinkFrame, 1),
+	}
+
+	var conf config.Config
+	conf.Backend.GatewayIDMapping = []config.GatewayIDMapping{
+		{
+			GatewayID:       gatewayID.String(),
+			MappedGatewayID: mappedID.String(),
+			BoardGatewayIDs: []string{board0ID.String(), board1ID.String()},
+		},
+	}
+
+	m, err := newGatewayIDMapper(&b, conf)
+	assert.NoError(err)
+
+	t.Run("Subscribe", func(t *testing.T) {
+		assert := require.New(t)
+
+		b.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: gatewayID}
+		assert.Equal(events.Subscribe{Subscribe: true, GatewayID: mappedID}, <-m.GetSubscribeEventChan())
+		assert.Equal(events.Subscribe{Subscribe: true, GatewayID: board0ID}, <-m.GetSubscribeEventChan())
+		assert.Equal(events.Subscribe{Subscribe: true, GatewayID: board1ID}, <-m.GetSubscribeEventChan())
+
+		b.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: otherID}
+		assert.Equal(events.Subscribe{Subscribe: true, GatewayID: otherID}, <-m.GetSubscribeEventChan())
+	})
+
+	t.Run("Uplink", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			gatewayID  lorawan.EUI64
+			board      uint32
+			expectedID lorawan.EUI64
+		}{
+			{"board 0", gatewayID, 0, board0ID},
+			{"board 1", gatewayID, 1, board1ID},
+			{"board without board gateway ID", gatewayID, 2, mappedID},
+			{"not mapped", otherID, 1, otherID},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+
+				rxInfo := gw.UplinkRXInfo{GatewayId: tst.gatewayID[:], Board: tst.board}
+				b.uplinkFrameChan <- gw.UplinkFrame{RxInfo: &rxInfo}
+
+				uplinkFrame := <-m.GetUplinkFrameChan()
+				assert.Equal(tst.expectedID[:], uplinkFrame.RxInfo.GatewayId)
+				assert.Equal(tst.gatewayID[:], rxInfo.GatewayId)
+			})
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		assert := require.New(t)
+
+		b.gatewayStatsChan <- gw.GatewayStats{GatewayId: gatewayID[:]}
+		assert.Equal(mappedID[:], (<-m.GetGatewayStatsChan()).GatewayId)
+	})
+
+	t.Run("Downlink", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			gatewayID     lorawan.EUI64
+			token         uint32
+			expectedID    lorawan.EUI64
+			expectedBoard uint32
+		}{
+			{"mapped gateway ID", mappedID, 1, gatewayID, 0},
+			{"board 0 gateway ID", board0ID, 2, gatewayID, 0},
+			{"board 1 gateway ID", board1ID, 3, gatewayID, 1},
+			{"not mapped", otherID, 4, otherID, 0},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+
+				txInfo := gw.DownlinkTXInfo{GatewayId: tst.gatewayID[:]}
+				assert.NoError(m.SendDownlinkFrame(gw.DownlinkFrame{Token: tst.token, TxInfo: &txInfo}))
+
+				df := <-b.downlinkFrameChan
+				assert.Equal(tst.expectedID[:], df.TxInfo.GatewayId)
+				assert.Equal(tst.expectedBoard, df.TxInfo.Board)
+				assert.Equal(tst.gatewayID[:], txInfo.GatewayId)
+
+				// the ack is mapped to the gateway ID of the downlink
+				b.downlinkTXAckChan <- gw.DownlinkTXAck{GatewayId: df.TxInfo.GatewayId, Token: tst.token}
+				assert.Equal(gw.DownlinkTXAck{GatewayId: tst.gatewayID[:], Token: tst.token}, <-m.GetDownlinkTXAckChan())
+			})
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sdc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_scheduler_downlink_count",
+		Help: "The number of downlinks handled by the scheduler (per result).",
+	}, []string{"result"})
+
+	sqs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "backend_scheduler_queue_size",
+		Help: "The number of downlinks queued by the scheduler.",
+	})
+
+	ccc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_scheduler_concentrator_clock_count",
+		Help: "The number of concentrator counter rollovers and resets detected by the scheduler (per event).",
+	}, []string{"event"})
+
+	csc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_conn_state_change_count",
+		Help: "The number of gateway connection-state changes (per change).",
+	}, []string{"change"})
+)
+
+func schedulerCounter(result string) prometheus.Counter {
+	return sdc.With(prometheus.Labels{"result": result})
+}
+
+func schedulerQueueGauge() prometheus.Gauge {
+	return sqs
+}
+
+func concentratorClockCounter(event string) prometheus.Counter {
+	return ccc.With(prometheus.Labels{"event": event})
+}
+
+func connStateCounter(change string) prometheus.Counter {
+	return csc.With(prometheus.Labels{"change": change})
+}
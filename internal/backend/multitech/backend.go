@@ -0,0 +1,430 @@
+// Package multitech implements a backend for the MQTT based packet-forwarder
+// protocol of the Multitech Conduit (lora-packet-forwarder-mqtt). The
+// packet-forwarder publishes its events to the local MQTT broker of the
+// gateway (mts-io), using the Semtech UDP JSON schema for the payloads.
+package multitech
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp/packets"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/lorawan"
+)
+
+// The event types published by the packet-forwarder (the last topic level).
+const (
+	eventUp   = "up"
+	eventStat = "stat"
+	eventAck  = "ack"
+)
+
+// downPayload contains the payload of a downlink command.
+type downPayload struct {
+	Token uint16 `json:"token"`
+	packets.PullRespPayload
+}
+
+// ackPayload contains the payload of an ack event.
+type ackPayload struct {
+	Token uint16 `json:"token"`
+	packets.TXACKPayload
+}
+
+// Backend implements a Multitech MQTT packet-forwarder backend.
+type Backend struct {
+	sync.RWMutex
+
+	conn         paho.Client
+	server       string
+	topicPrefix  string
+	qos          byte
+	skipCRCCheck bool
+	closed       bool
+
+	// publish publishes the given payload. This is a field, such that it
+	// can be overridden by the tests.
+	publish func(topic string, payload []byte) error
+
+	// gateways contains the gateway ID, as used within the topics, of the
+	// gateways from which an event has been received.
+	gateways map[lorawan.EUI64]string
+
+	// tokens contains the downlink ID by downlink token.
+	tokens map[uint16][]byte
+
+	downlinkTXAckChan  chan gw.DownlinkTXAck
+	uplinkFrameChan    chan gw.UplinkFrame
+	gatewayStatsChan   chan gw.GatewayStats
+	subscribeEventChan chan events.Subscribe
+	sender             *buffer.Sender
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	b := newBackend(conf)
+
+	opts := paho.NewClientOptions()
+	opts.AddBroker(b.server)
+	opts.SetUsername(conf.Backend.Multitech.Username)
+	opts.SetPassword(conf.Backend.Multitech.Password)
+	opts.SetClientID(conf.Backend.Multitech.ClientID)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(b.onConnected)
+	opts.SetConnectionLostHandler(b.onConnectionLost)
+	b.conn = paho.NewClient(opts)
+
+	b.publish = func(topic string, payload []byte) error {
+		if token := b.conn.Publish(topic, b.qos, false, payload); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"server":       b.server,
+		"topic_prefix": b.topicPrefix,
+	}).Info("backend/multitech: connecting to mqtt broker")
+
+	// The local MQTT broker might not yet be running when the ChirpStack
+	// Gateway Bridge is started, therefore the connect is retried in the
+	// background.
+	go b.connectLoop()
+
+	return b, nil
+}
+
+func newBackend(conf config.Config) *Backend {
+	return &Backend{
+		server:       conf.Backend.Multitech.Server,
+		topicPrefix:  strings.TrimSuffix(conf.Backend.Multitech.TopicPrefix, "/"),
+		qos:          conf.Backend.Multitech.QOS,
+		skipCRCCheck: conf.Backend.Multitech.SkipCRCCheck,
+
+		gateways: make(map[lorawan.EUI64]string),
+		tokens:   make(map[uint16][]byte),
+
+		downlinkTXAckChan:  make(chan gw.DownlinkTXAck, conf.Backend.Channels.DownlinkTXAckSize),
+		uplinkFrameChan:    make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:   make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
+		subscribeEventChan: make(chan events.Subscribe),
+		sender:             buffer.NewSender("multitech", conf),
+	}
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	b.Lock()
+	b.closed = true
+	b.Unlock()
+
+	if b.conn != nil {
+		b.conn.Disconnect(250)
+	}
+
+	return nil
+}
+
+// GetDownlinkTXAckChan returns the channel for downlink tx acknowledgements.
+func (b *Backend) GetDownlinkTXAckChan() chan gw.DownlinkTXAck {
+	return b.downlinkTXAckChan
+}
+
+// GetGatewayStatsChan returns the channel for gateway statistics.
+func (b *Backend) GetGatewayStatsChan() chan gw.GatewayStats {
+	return b.gatewayStatsChan
+}
+
+// GetUplinkFrameChan returns the channel for received uplinks.
+func (b *Backend) GetUplinkFrameChan() chan gw.UplinkFrame {
+	return b.uplinkFrameChan
+}
+
+// GetSubscribeEventChan returns the channel for the (un)subscribe events.
+func (b *Backend) GetSubscribeEventChan() chan events.Subscribe {
+	return b.subscribeEventChan
+}
+
+// GetRawPacketForwarderEventChan returns the raw packet-forwarder command channel.
+func (b *Backend) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEvent {
+	// not provided by the Multitech packet-forwarder.
+	return nil
+}
+
+// GetLogEventChan returns the gateway log event channel.
+func (b *Backend) GetLogEventChan() chan events.Log {
+	// not provided by the Multitech packet-forwarder.
+	return nil
+}
+
+// SendDownlinkFrame publishes the given downlink frame to the down topic of
+// the gateway.
+func (b *Backend) SendDownlinkFrame(frame gw.DownlinkFrame) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], frame.GetTxInfo().GetGatewayId())
+
+	// if Token == 0, generate it in order to be backwards compatible.
+	if frame.Token == 0 {
+		tokenB := make([]byte, 2)
+		if _, err := rand.Read(tokenB); err != nil {
+			return errors.Wrap(err, "read random bytes error")
+		}
+		frame.Token = uint32(binary.BigEndian.Uint16(tokenB))
+	}
+
+	b.Lock()
+	topicID, ok := b.gateways[gatewayID]
+	if ok {
+		b.tokens[uint16(frame.Token)] = frame.DownlinkId
+	}
+	b.Unlock()
+
+	if !ok {
+		return errors.Errorf("gateway %s is not connected", gatewayID)
+	}
+
+	pullResp, err := packets.GetPullRespPacket(packets.ProtocolVersion2, uint16(frame.Token), frame)
+	if err != nil {
+		return errors.Wrap(err, "get PullRespPacket error")
+	}
+
+	bb, err := json.Marshal(downPayload{
+		Token:           uint16(frame.Token),
+		PullRespPayload: pullResp.Payload,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	var downlinkID uuid.UUID
+	copy(downlinkID[:], frame.GetDownlinkId())
+
+	topic := b.topicPrefix + "/" + topicID + "/down"
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downlinkID,
+		"topic":       topic,
+	}).Info("backend/multitech: publishing downlink command")
+
+	if err := b.publish(topic, bb); err != nil {
+		return errors.Wrap(err, "publish downlink command error")
+	}
+
+	commandCounter("down").Inc()
+
+	return nil
+}
+
+// ApplyConfiguration is not supported by the Multitech packet-forwarder.
+func (b *Backend) ApplyConfiguration(gw.GatewayConfiguration) error {
+	return errors.New("gateway configuration not implemented by Multitech packet-forwarder")
+}
+
+// RawPacketForwarderCommand is not supported by the Multitech packet-forwarder.
+func (b *Backend) RawPacketForwarderCommand(gw.RawPacketForwarderCommand) error {
+	return errors.New("raw packet-forwarder command not implemented by Multitech packet-forwarder")
+}
+
+func (b *Backend) isClosed() bool {
+	b.RLock()
+	defer b.RUnlock()
+	return b.closed
+}
+
+// connectLoop blocks until the client is connected or the backend has been
+// closed.
+func (b *Backend) connectLoop() {
+	for !b.isClosed() {
+		token := b.conn.Connect()
+		if token.Wait() && token.Error() == nil {
+			return
+		}
+
+		log.WithError(token.Error()).WithField("server", b.server).Error("backend/multitech: connect to mqtt broker error")
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (b *Backend) onConnected(c paho.Client) {
+	mqttConnectCounter().Inc()
+
+	filters := make(map[string]byte)
+	for _, event := range []string{eventUp, eventStat, eventAck} {
+		filters[b.topicPrefix+"/+/"+event] = b.qos
+	}
+
+	log.WithFields(log.Fields{
+		"server":       b.server,
+		"topic_prefix": b.topicPrefix,
+	}).Info("backend/multitech: connected to mqtt broker, subscribing to event topics")
+
+	if token := c.SubscribeMultiple(filters, b.handleMessage); token.Wait() && token.Error() != nil {
+		log.WithError(token.Error()).Error("backend/multitech: subscribe event topics error")
+	}
+}
+
+// onConnectionLost unsubscribes all gateways, as no events will be received
+// until the connection with the broker has been restored.
+func (b *Backend) onConnectionLost(c paho.Client, err error) {
+	mqttDisconnectCounter().Inc()
+	log.WithError(err).Error("backend/multitech: mqtt connection error")
+
+	b.Lock()
+	gateways := b.gateways
+	b.gateways = make(map[lorawan.EUI64]string)
+	b.Unlock()
+
+	for gatewayID := range gateways {
+		b.subscribeEventChan <- events.Subscribe{
+			Subscribe: false,
+			GatewayID: gatewayID,
+			ConnState: &events.ConnState{
+				BackendType:   "multitech",
+				RemoteAddress: b.server,
+				Reason:        "mqtt connection lost",
+			},
+		}
+	}
+}
+
+func (b *Backend) handleMessage(c paho.Client, msg paho.Message) {
+	if err := b.handleEvent(msg.Topic(), msg.Payload()); err != nil {
+		log.WithError(err).WithField("topic", msg.Topic()).Error("backend/multitech: handle event error")
+	}
+}
+
+// handleEvent handles the payload received on the given topic. The topic
+// must be formatted as [prefix]/[gateway id]/[event].
+func (b *Backend) handleEvent(topic string, payload []byte) error {
+	if !strings.HasPrefix(topic, b.topicPrefix+"/") {
+		return errors.New("topic does not match the topic prefix")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(topic, b.topicPrefix+"/"), "/")
+	if len(parts) != 2 {
+		return errors.New("topic must be formatted as [prefix]/[gateway id]/[event]")
+	}
+	topicID, event := parts[0], parts[1]
+
+	// The mPower firmware formats the gateway ID as 00-80-00-00-00-00-00-01.
+	var gatewayID lorawan.EUI64
+	if err := gatewayID.UnmarshalText([]byte(strings.Replace(topicID, "-", "", -1))); err != nil {
+		return errors.Wrap(err, "decode gateway id error")
+	}
+
+	eventCounter(event).Inc()
+	health.BackendEvent()
+	b.setGateway(gatewayID, topicID)
+
+	switch event {
+	case eventUp, eventStat:
+		return b.handlePushData(gatewayID, event, payload)
+	case eventAck:
+		return b.handleAck(gatewayID, payload)
+	default:
+		log.WithField("event", event).Debug("backend/multitech: unknown event received")
+		return nil
+	}
+}
+
+// setGateway stores the topic gateway ID of the given gateway. The subscribe
+// event is sent for the first event received from a gateway.
+func (b *Backend) setGateway(gatewayID lorawan.EUI64, topicID string) {
+	b.Lock()
+	_, ok := b.gateways[gatewayID]
+	b.gateways[gatewayID] = topicID
+	b.Unlock()
+
+	if ok {
+		return
+	}
+
+	connectTime, _ := ptypes.TimestampProto(time.Now())
+
+	b.subscribeEventChan <- events.Subscribe{
+		Subscribe: true,
+		GatewayID: gatewayID,
+		ConnState: &events.ConnState{
+			BackendType:   "multitech",
+			RemoteAddress: b.server,
+			ConnectTime:   connectTime,
+		},
+	}
+}
+
+// handlePushData handles the up and stat events, both containing the
+// payload of a Semtech UDP PUSH_DATA packet.
+func (b *Backend) handlePushData(gatewayID lorawan.EUI64, event string, payload []byte) error {
+	p := packets.PushDataPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		GatewayMAC:      gatewayID,
+	}
+	if err := json.Unmarshal(payload, &p.Payload); err != nil {
+		unmarshalErrorCounter(event).Inc()
+		return errors.Wrap(err, "unmarshal json error")
+	}
+
+	stats, err := p.GetGatewayStats()
+	if err != nil {
+		unmarshalErrorCounter(event).Inc()
+		return errors.Wrap(err, "get stats error")
+	}
+	if stats != nil {
+		b.sender.GatewayStats(b.gatewayStatsChan, *stats)
+	}
+
+	uplinkFrames, err := p.GetUplinkFrames(b.skipCRCCheck, false)
+	if err != nil {
+		unmarshalErrorCounter(event).Inc()
+		return errors.Wrap(err, "get uplink frames error")
+	}
+	for i := range uplinkFrames {
+		b.sender.UplinkFrame(b.uplinkFrameChan, uplinkFrames[i])
+	}
+
+	return nil
+}
+
+// handleAck handles the ack event of a downlink command.
+func (b *Backend) handleAck(gatewayID lorawan.EUI64, payload []byte) error {
+	var pl ackPayload
+	if err := json.Unmarshal(payload, &pl); err != nil {
+		unmarshalErrorCounter(eventAck).Inc()
+		return errors.Wrap(err, "unmarshal json error")
+	}
+
+	b.Lock()
+	downlinkID := b.tokens[pl.Token]
+	delete(b.tokens, pl.Token)
+	b.Unlock()
+
+	ack := gw.DownlinkTXAck{
+		GatewayId:  gatewayID[:],
+		Token:      uint32(pl.Token),
+		DownlinkId: downlinkID,
+	}
+	if pl.TXPKACK.Error != "" && pl.TXPKACK.Error != "NONE" {
+		ack.Error = pl.TXPKACK.Error
+	}
+
+	b.sender.DownlinkTXAck(b.downlinkTXAckChan, ack)
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package multitech
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type publishedMessage struct {
+	topic   string
+	payload []byte
+}
+
+type BackendTestSuite struct {
+	suite.Suite
+
+	backend   *Backend
+	published chan publishedMessage
+	gatewayID lorawan.EUI64
+}
+
+func (ts *BackendTestSuite) SetupTest() {
+	var conf config.Config
+	conf.Backend.Multitech.Server = "tcp://127.0.0.1:1883"
+	conf.Backend.Multitech.TopicPrefix = "lora"
+	conf.Backend.Channels.UplinkFrameSize = 1
+	conf.Backend.Channels.GatewayStatsSize = 1
+	conf.Backend.Channels.DownlinkTXAckSize = 1
+
+	ts.gatewayID = lorawan.EUI64{0, 0x80, 0, 0, 0xa0, 0, 0x0f, 0x4d}
+	ts.published = make(chan publishedMessage, 1)
+
+	ts.backend = newBackend(conf)
+	ts.backend.subscribeEventChan = make(chan events.Subscribe, 1)
+	ts.backend.publish = func(topic string, payload []byte) error {
+		ts.published <- publishedMessage{topic: topic, payload: payload}
+		return nil
+	}
+}
+
+func (ts *BackendTestSuite) TestUplink() {
+	assert := require.New(ts.T())
+
+	assert.NoError(ts.backend.handleEvent("lora/00-80-00-00-a0-00-0f-4d/up", []byte(`{"rxpk":[{"tmst":1000,"chan":2,"rfch":1,"freq":868.5,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","rssi":-60,"lsnr":7.5,"size":4,"data":"AQIDBA=="}]}`)))
+
+	sub := <-ts.backend.GetSubscribeEventChan()
+	assert.True(sub.Subscribe)
+	assert.Equal(ts.gatewayID, sub.GatewayID)
+	assert.Equal("multitech", sub.ConnState.BackendType)
+
+	frame := <-ts.backend.GetUplinkFrameChan()
+	assert.Equal([]byte{1, 2, 3, 4}, frame.PhyPayload)
+	assert.Equal(ts.gatewayID[:], frame.RxInfo.GatewayId)
+	assert.EqualValues(868500000, frame.TxInfo.Frequency)
+	assert.EqualValues(7, frame.TxInfo.GetLoraModulationInfo().SpreadingFactor)
+	assert.EqualValues(-60, frame.RxInfo.Rssi)
+	assert.EqualValues(7.5, frame.RxInfo.LoraSnr)
+
+	ts.T().Run("CRC error", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.backend.handleEvent("lora/00-80-00-00-a0-00-0f-4d/up", []byte(`{"rxpk":[{"tmst":1000,"freq":868.5,"stat":-1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","size":4,"data":"AQIDBA=="}]}`)))
+		assert.Len(ts.backend.GetUplinkFrameChan(), 0)
+	})
+
+	ts.T().Run("Invalid payload", func(t *testing.T) {
+		assert := require.New(t)
+
+		count := testutil.ToFloat64(unmarshalErrorCounter("up"))
+		assert.Error(ts.backend.handleEvent("lora/00-80-00-00-a0-00-0f-4d/up", []byte(`{"rxpk":[{]}`)))
+		assert.Equal(count+1, testutil.ToFloat64(unmarshalErrorCounter("up")))
+	})
+}
+
+func (ts *BackendTestSuite) TestStats() {
+	assert := require.New(ts.T())
+
+	assert.NoError(ts.backend.handleEvent("lora/00800000a0000f4d/stat", []byte(`{"stat":{"time":"2020-01-01 10:00:00 GMT","rxnb":3,"rxok":2,"rxfw":2,"ackr":100,"dwnb":1,"txnb":1}}`)))
+	<-ts.backend.GetSubscribeEventChan()
+
+	stats := <-ts.backend.GetGatewayStatsChan()
+	assert.Equal(ts.gatewayID[:], stats.GatewayId)
+	assert.EqualValues(3, stats.RxPacketsReceived)
+	assert.EqualValues(2, stats.RxPacketsReceivedOk)
+	assert.EqualValues(1, stats.TxPacketsEmitted)
+}
+
+func (ts *BackendTestSuite) TestDownlink() {
+	assert := require.New(ts.T())
+
+	frame := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		Token:      1234,
+		DownlinkId: []byte{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId:  ts.gatewayID[:],
+			Frequency:  868100000,
+			Power:      14,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:             125,
+					SpreadingFactor:       12,
+					CodeRate:              "4/5",
+					PolarizationInversion: true,
+				},
+			},
+			Timing: gw.DownlinkTiming_IMMEDIATELY,
+			TimingInfo: &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+				ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+			},
+		},
+	}
+
+	ts.T().Run("Gateway not connected", func(t *testing.T) {
+		assert := require.New(t)
+		assert.Error(ts.backend.SendDownlinkFrame(frame))
+	})
+
+	assert.NoError(ts.backend.handleEvent("lora/00-80-00-00-a0-00-0f-4d/stat", []byte(`{}`)))
+	<-ts.backend.GetSubscribeEventChan()
+
+	assert.NoError(ts.backend.SendDownlinkFrame(frame))
+	msg := <-ts.published
+	assert.Equal("lora/00-80-00-00-a0-00-0f-4d/down", msg.topic)
+
+	var pl downPayload
+	assert.NoError(json.Unmarshal(msg.payload, &pl))
+	assert.EqualValues(1234, pl.Token)
+	assert.True(pl.TXPK.Imme)
+	assert.Equal(868.1, pl.TXPK.Freq)
+	assert.Equal("SF12BW125", pl.TXPK.DatR.LoRa)
+	assert.Equal([]byte{1, 2, 3, 4}, pl.TXPK.Data)
+
+	ts.T().Run("Ack", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.backend.handleEvent("lora/00-80-00-00-a0-00-0f-4d/ack", []byte(`{"token":1234,"txpk_ack":{"error":"NONE"}}`)))
+		ack := <-ts.backend.GetDownlinkTXAckChan()
+		assert.Equal(gw.DownlinkTXAck{
+			GatewayId:  ts.gatewayID[:],
+			Token:      1234,
+			DownlinkId: frame.DownlinkId,
+		}, ack)
+	})
+
+	ts.T().Run("Ack error", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.backend.handleEvent("lora/00-80-00-00-a0-00-0f-4d/ack", []byte(`{"token":1235,"txpk_ack":{"error":"TOO_LATE"}}`)))
+		ack := <-ts.backend.GetDownlinkTXAckChan()
+		assert.Equal("TOO_LATE", ack.Error)
+	})
+}
+
+func (ts *BackendTestSuite) TestInvalidTopic() {
+	tests := []string{
+		"gateway/00800000a0000f4d/up",
+		"lora/00800000a0000f4d",
+		"lora/invalid/up",
+	}
+
+	for _, topic := range tests {
+		ts.T().Run(topic, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Error(ts.backend.handleEvent(topic, []byte(`{}`)))
+		})
+	}
+}
+
+func (ts *BackendTestSuite) TestConnectionLost() {
+	assert := require.New(ts.T())
+
+	assert.NoError(ts.backend.handleEvent("lora/00800000a0000f4d/stat", []byte(`{}`)))
+	<-ts.backend.GetSubscribeEventChan()
+
+	go ts.backend.onConnectionLost(nil, nil)
+	sub := <-ts.backend.GetSubscribeEventChan()
+	assert.False(sub.Subscribe)
+	assert.Equal(ts.gatewayID, sub.GatewayID)
+	assert.Equal("mqtt connection lost", sub.ConnState.Reason)
+}
+
+func TestBackend(t *testing.T) {
+	suite.Run(t, new(BackendTestSuite))
+}
@@ -0,0 +1,53 @@
+package multitech
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_multitech_event_count",
+		Help: "The number of received events (per type)",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_multitech_command_count",
+		Help: "The number of published commands (per type)",
+	}, []string{"command"})
+
+	uec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_multitech_unmarshal_error_count",
+		Help: "The number of events that could not be unmarshaled (per type)",
+	}, []string{"event"})
+
+	mcc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backend_multitech_mqtt_connect_count",
+		Help: "The number of times the backend connected to the local MQTT broker",
+	})
+
+	mdc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backend_multitech_mqtt_disconnect_count",
+		Help: "The number of times the backend disconnected from the local MQTT broker",
+	})
+)
+
+func eventCounter(event string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": event})
+}
+
+func commandCounter(command string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": command})
+}
+
+func unmarshalErrorCounter(event string) prometheus.Counter {
+	return uec.With(prometheus.Labels{"event": event})
+}
+
+func mqttConnectCounter() prometheus.Counter {
+	return mcc
+}
+
+func mqttDisconnectCounter() prometheus.Counter {
+	return mdc
+}
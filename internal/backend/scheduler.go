@@ -0,0 +1,455 @@
+package backend
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
+)
+
+// The downlink TX acknowledgement errors returned by the scheduler. These
+// are equal to the errors returned by the Semtech UDP packet-forwarder.
+const (
+	tooEarlyError = "TOO_EARLY"
+	tooLateError  = "TOO_LATE"
+)
+
+// schedulerBucket is the bucket containing the queued downlinks.
+var schedulerBucket = []byte("downlinks")
+
+// uplinkContextTTL defines the duration the receive time of an uplink is
+// kept for resolving the TX time of delay timed downlinks.
+const uplinkContextTTL = time.Minute
+
+// scheduler wraps a Backend and schedules the GPS epoch and delay timed
+// downlinks. Downlinks of which the TX time is too far ahead for the
+// packet-forwarder are queued and sent to the backend dispatch_ahead before
+// the TX time. Downlinks which can not be sent in time, or which are too far
+// ahead to be queued, are rejected with a TOO_LATE or TOO_EARLY TX
+// acknowledgement.
+//
+// When a queue file is configured, the queued downlinks are persisted such
+// that these survive a restart of the ChirpStack Gateway Bridge.
+type scheduler struct {
+	Backend
+
+	dispatchAhead    time.Duration
+	minLeadTime      time.Duration
+	maxQueueDuration time.Duration
+
+	uplinkFrameChan chan gw.UplinkFrame
+	sender          *buffer.Sender
+	db              *bolt.DB
+	clock           *concentratorClock
+
+	sync.Mutex
+	uplinks     map[uplinkContext]time.Time
+	lastCleanup time.Time
+	queued      map[uuid.UUID]queuedTimer
+}
+
+// queuedTimer holds the timer of a queued downlink.
+type queuedTimer struct {
+	gatewayID lorawan.EUI64
+	timer     *time.Timer
+}
+
+// uplinkContext identifies an uplink by gateway ID and context.
+type uplinkContext struct {
+	gatewayID lorawan.EUI64
+	context   string
+}
+
+// queuedDownlink is the on-disk representation of a queued downlink.
+type queuedDownlink struct {
+	TXTime        time.Time `json:"txTime"`
+	DownlinkFrame []byte    `json:"downlinkFrame"`
+}
+
+func newScheduler(b Backend, conf config.Config) (*scheduler, error) {
+	s := scheduler{
+		Backend:          b,
+		dispatchAhead:    conf.Backend.Scheduler.DispatchAhead,
+		minLeadTime:      conf.Backend.Scheduler.MinLeadTime,
+		maxQueueDuration: conf.Backend.Scheduler.MaxQueueDuration,
+		uplinkFrameChan:  make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		sender:           buffer.NewSender("scheduler", conf),
+		clock:            newConcentratorClock(),
+		uplinks:          make(map[uplinkContext]time.Time),
+		queued:           make(map[uuid.UUID]queuedTimer),
+	}
+
+	if path := conf.Backend.Scheduler.QueueFile; path != "" {
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return nil, errors.Wrap(err, "open queue file error")
+		}
+		s.db = db
+
+		if err := s.restoreQueue(); err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "restore queue error")
+		}
+	}
+
+	go s.uplinkFrameLoop()
+
+	return &s, nil
+}
+
+// Close closes the backend and the queue file. The downlinks which are still
+// queued remain in the queue file and are restored on the next start.
+func (s *scheduler) Close() error {
+	if err := s.Backend.Close(); err != nil {
+		return err
+	}
+
+	if s.db != nil {
+		return s.db.Close()
+	}
+
+	return nil
+}
+
+// GetUplinkFrameChan returns the channel for received uplinks.
+func (s *scheduler) GetUplinkFrameChan() chan gw.UplinkFrame {
+	return s.uplinkFrameChan
+}
+
+// SendDownlinkFrame schedules the given downlink frame.
+func (s *scheduler) SendDownlinkFrame(df gw.DownlinkFrame) error {
+	var gatewayID lorawan.EUI64
+	var downID uuid.UUID
+	copy(gatewayID[:], df.GetTxInfo().GetGatewayId())
+	copy(downID[:], df.GetDownlinkId())
+
+	txTime, ok := s.getTXTime(df)
+	if !ok {
+		schedulerCounter("sent").Inc()
+		return s.Backend.SendDownlinkFrame(df)
+	}
+
+	wait := time.Until(txTime)
+	logFields := log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+		"tx_time":     txTime,
+	}
+
+	switch {
+	case wait < s.minLeadTime:
+		log.WithFields(logFields).Warning("backend/scheduler: downlink-frame rejected, tx time is too late")
+		schedulerCounter("too_late").Inc()
+		s.sendTXAck(gatewayID, df, tooLateError)
+	case s.maxQueueDuration != 0 && wait > s.maxQueueDuration:
+		log.WithFields(logFields).Warning("backend/scheduler: downlink-frame rejected, tx time is too early")
+		schedulerCounter("too_early").Inc()
+		s.sendTXAck(gatewayID, df, tooEarlyError)
+	case wait > s.dispatchAhead:
+		key, err := uuid.NewV4()
+		if err != nil {
+			return errors.Wrap(err, "new uuid error")
+		}
+
+		if err := s.storeQueued(key, df, txTime); err != nil {
+			log.WithError(err).WithFields(logFields).Error("backend/scheduler: store queued downlink-frame error")
+		}
+
+		log.WithFields(logFields).Info("backend/scheduler: downlink-frame queued")
+		schedulerCounter("queued").Inc()
+		s.queue(key, df, txTime)
+	default:
+		schedulerCounter("sent").Inc()
+		return s.Backend.SendDownlinkFrame(df)
+	}
+
+	return nil
+}
+
+// queue sends the given downlink to the backend dispatch_ahead before the
+// given TX time.
+func (s *scheduler) queue(key uuid.UUID, df gw.DownlinkFrame, txTime time.Time) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], df.GetTxInfo().GetGatewayId())
+
+	schedulerQueueGauge().Inc()
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.queued[key] = queuedTimer{
+		gatewayID: gatewayID,
+		timer: time.AfterFunc(time.Until(txTime)-s.dispatchAhead, func() {
+			// the downlink was purged while the timer fired
+			s.Lock()
+			_, ok := s.queued[key]
+			delete(s.queued, key)
+			s.Unlock()
+			if !ok {
+				return
+			}
+
+			schedulerQueueGauge().Dec()
+
+			if err := s.deleteQueued(key); err != nil {
+				log.WithError(err).Error("backend/scheduler: delete queued downlink-frame error")
+			}
+
+			schedulerCounter("sent").Inc()
+			if err := s.Backend.SendDownlinkFrame(df); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"downlink_id": uuid.FromBytesOrNil(df.GetDownlinkId()),
+					"tx_time":     txTime,
+				}).Error("backend/scheduler: send queued downlink-frame error")
+			}
+		}),
+	}
+}
+
+// purge removes the queued downlinks of the given gateway. It returns the
+// number of removed downlinks.
+func (s *scheduler) purge(gatewayID lorawan.EUI64) int {
+	var keys []uuid.UUID
+
+	s.Lock()
+	for k, q := range s.queued {
+		if q.gatewayID == gatewayID {
+			q.timer.Stop()
+			delete(s.queued, k)
+			keys = append(keys, k)
+		}
+	}
+	s.Unlock()
+
+	for _, k := range keys {
+		schedulerQueueGauge().Dec()
+		schedulerCounter("purged").Inc()
+
+		if err := s.deleteQueued(k); err != nil {
+			log.WithError(err).Error("backend/scheduler: delete queued downlink-frame error")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"count":      len(keys),
+	}).Info("backend/scheduler: queued downlink-frames purged")
+
+	return len(keys)
+}
+
+// storeQueued persists the given queued downlink (when a queue file is
+// configured).
+func (s *scheduler) storeQueued(key uuid.UUID, df gw.DownlinkFrame, txTime time.Time) error {
+	if s.db == nil {
+		return nil
+	}
+
+	b, err := proto.Marshal(&df)
+	if err != nil {
+		return errors.Wrap(err, "marshal downlink-frame error")
+	}
+
+	b, err = json.Marshal(queuedDownlink{
+		TXTime:        txTime,
+		DownlinkFrame: b,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal queued downlink error")
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulerBucket).Put(key[:], b)
+	})
+}
+
+// deleteQueued removes the given queued downlink from the queue file.
+func (s *scheduler) deleteQueued(key uuid.UUID) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulerBucket).Delete(key[:])
+	})
+}
+
+// restoreQueue re-schedules the downlinks of the queue file. Downlinks of
+// which the TX time has passed (or is closer than the min. lead time) are
+// rejected with a TOO_LATE TX acknowledgement.
+func (s *scheduler) restoreQueue() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(schedulerBucket)
+		if err != nil {
+			return err
+		}
+
+		var keys [][]byte
+		if err := bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			key := uuid.FromBytesOrNil(k)
+			v := bucket.Get(k)
+
+			var qd queuedDownlink
+			var df gw.DownlinkFrame
+			if err := json.Unmarshal(v, &qd); err != nil {
+				log.WithError(err).Error("backend/scheduler: unmarshal queued downlink error")
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := proto.Unmarshal(qd.DownlinkFrame, &df); err != nil {
+				log.WithError(err).Error("backend/scheduler: unmarshal queued downlink-frame error")
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+				continue
+			}
+
+			var gatewayID lorawan.EUI64
+			copy(gatewayID[:], df.GetTxInfo().GetGatewayId())
+			logFields := log.Fields{
+				"gateway_id":  gatewayID,
+				"downlink_id": uuid.FromBytesOrNil(df.GetDownlinkId()),
+				"tx_time":     qd.TXTime,
+			}
+
+			if time.Until(qd.TXTime) < s.minLeadTime {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+
+				log.WithFields(logFields).Warning("backend/scheduler: restored downlink-frame rejected, tx time is too late")
+				schedulerCounter("too_late").Inc()
+
+				// the tx acks are sent in the background, as the tx ack
+				// channel is not yet consumed during the setup
+				go s.sendTXAck(gatewayID, df, tooLateError)
+				continue
+			}
+
+			log.WithFields(logFields).Info("backend/scheduler: queued downlink-frame restored")
+			schedulerCounter("restored").Inc()
+			s.queue(key, df, qd.TXTime)
+		}
+
+		return nil
+	})
+}
+
+// getTXTime returns the (wall-clock) TX time of the given downlink. It
+// returns false for immediately timed downlinks or when the TX time can not
+// be resolved (e.g. the uplink of a delay timed downlink is unknown).
+//
+// For delay timed downlinks of which the context contains the 32 bit
+// concentrator counter, the TX time is resolved using the extended
+// concentrator clock, such that downlinks scheduled across the counter
+// rollover are timed correctly.
+func (s *scheduler) getTXTime(df gw.DownlinkFrame) (time.Time, bool) {
+	txInfo := df.GetTxInfo()
+
+	switch txInfo.GetTiming() {
+	case gw.DownlinkTiming_GPS_EPOCH:
+		d, err := ptypes.Duration(txInfo.GetGpsEpochTimingInfo().GetTimeSinceGpsEpoch())
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Time(gps.NewTimeFromTimeSinceGPSEpoch(d)), true
+	case gw.DownlinkTiming_DELAY:
+		d, err := ptypes.Duration(txInfo.GetDelayTimingInfo().GetDelay())
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		var key uplinkContext
+		copy(key.gatewayID[:], txInfo.GetGatewayId())
+		key.context = string(txInfo.GetContext())
+
+		// the context contains the 32 bit concentrator counter, the TX
+		// time is resolved using the extended concentrator clock
+		if len(key.context) == 4 {
+			now := time.Now()
+			wait, ok := s.clock.txWait(key.gatewayID, binary.BigEndian.Uint32(txInfo.GetContext()), d, uplinkContextTTL, now)
+			if !ok {
+				return time.Time{}, false
+			}
+			return now.Add(wait), true
+		}
+
+		s.Lock()
+		rxTime, ok := s.uplinks[key]
+		s.Unlock()
+
+		if !ok {
+			return time.Time{}, false
+		}
+		return rxTime.Add(d), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func (s *scheduler) sendTXAck(gatewayID lorawan.EUI64, df gw.DownlinkFrame, e string) {
+	s.sender.DownlinkTXAck(s.Backend.GetDownlinkTXAckChan(), gw.DownlinkTXAck{
+		GatewayId:  gatewayID[:],
+		Token:      df.GetToken(),
+		DownlinkId: df.GetDownlinkId(),
+		Error:      e,
+	})
+}
+
+// uplinkFrameLoop stores the receive time of each uplink (for resolving the
+// TX time of delay timed downlinks) and forwards the uplink.
+func (s *scheduler) uplinkFrameLoop() {
+	for uplinkFrame := range s.Backend.GetUplinkFrameChan() {
+		s.addUplink(uplinkFrame, time.Now())
+		s.sender.UplinkFrame(s.uplinkFrameChan, uplinkFrame)
+	}
+}
+
+func (s *scheduler) addUplink(uplinkFrame gw.UplinkFrame, now time.Time) {
+	var key uplinkContext
+	copy(key.gatewayID[:], uplinkFrame.GetRxInfo().GetGatewayId())
+	key.context = string(uplinkFrame.GetRxInfo().GetContext())
+
+	// the context contains the 32 bit concentrator counter (e.g. the
+	// Semtech UDP tmst), which is tracked by the concentrator clock
+	if len(key.context) == 4 {
+		s.clock.update(key.gatewayID, binary.BigEndian.Uint32(uplinkFrame.GetRxInfo().GetContext()), now)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.uplinks[key] = now
+
+	if now.Sub(s.lastCleanup) > uplinkContextTTL {
+		for k, t := range s.uplinks {
+			if now.Sub(t) > uplinkContextTTL {
+				delete(s.uplinks, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+}
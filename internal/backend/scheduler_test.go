@@ -0,0 +1,272 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
+)
+
+type testBackend struct {
+	Backend
+
+	uplinkFrameChan    chan gw.UplinkFrame
+	gatewayStatsChan   chan gw.GatewayStats
+	subscribeEventChan chan events.Subscribe
+	downlinkTXAckChan  chan gw.DownlinkTXAck
+	downlinkFrameChan  chan gw.DownlinkFrame
+}
+
+func (b *testBackend) GetUplinkFrameChan() chan gw.UplinkFrame {
+	return b.uplinkFrameChan
+}
+
+func (b *testBackend) GetGatewayStatsChan() chan gw.GatewayStats {
+	return b.gatewayStatsChan
+}
+
+func (b *testBackend) GetSubscribeEventChan() chan events.Subscribe {
+	return b.subscribeEventChan
+}
+
+func (b *testBackend) GetDownlinkTXAckChan() chan gw.DownlinkTXAck {
+	return b.downlinkTXAckChan
+}
+
+func (b *testBackend) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEvent {
+	return nil
+}
+
+func (b *testBackend) GetLogEventChan() chan events.Log {
+	return nil
+}
+
+func (b *testBackend) SendDownlinkFrame(df gw.DownlinkFrame) error {
+	b.downlinkFrameChan <- df
+	return nil
+}
+
+func (b *testBackend) Close() error {
+	return nil
+}
+
+func gpsDownlink(token uint32, txTime time.Time) gw.DownlinkFrame {
+	return gw.DownlinkFrame{
+		Token: token,
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Timing:    gw.DownlinkTiming_GPS_EPOCH,
+			TimingInfo: &gw.DownlinkTXInfo_GpsEpochTimingInfo{
+				GpsEpochTimingInfo: &gw.GPSEpochTimingInfo{
+					TimeSinceGpsEpoch: ptypes.DurationProto(gps.Time(txTime).TimeSinceGPSEpoch()),
+				},
+			},
+		},
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	b := &testBackend{
+		uplinkFrameChan:   make(chan gw.UplinkFrame),
+		downlinkTXAckChan: make(chan gw.DownlinkTXAck, 1),
+		downlinkFrameChan: make(chan gw.DownlinkFrame, 1),
+	}
+
+	var conf config.Config
+	conf.Backend.Scheduler.DispatchAhead = 100 * time.Millisecond
+	conf.Backend.Scheduler.MinLeadTime = 10 * time.Millisecond
+	conf.Backend.Scheduler.MaxQueueDuration = time.Minute
+
+	s, err := newScheduler(b, conf)
+	require.NoError(t, err)
+
+	gatewayID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("immediately", func(t *testing.T) {
+		assert := require.New(t)
+
+		df := gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID,
+				Timing:    gw.DownlinkTiming_IMMEDIATELY,
+			},
+		}
+		assert.NoError(s.SendDownlinkFrame(df))
+		assert.Equal(df, <-b.downlinkFrameChan)
+	})
+
+	t.Run("gps epoch within dispatch ahead", func(t *testing.T) {
+		assert := require.New(t)
+
+		df := gpsDownlink(123, time.Now().Add(50*time.Millisecond))
+		assert.NoError(s.SendDownlinkFrame(df))
+		assert.Equal(df, <-b.downlinkFrameChan)
+	})
+
+	t.Run("gps epoch queued", func(t *testing.T) {
+		assert := require.New(t)
+
+		df := gpsDownlink(123, time.Now().Add(300*time.Millisecond))
+		assert.NoError(s.SendDownlinkFrame(df))
+		assert.Len(b.downlinkFrameChan, 0)
+
+		select {
+		case out := <-b.downlinkFrameChan:
+			assert.Equal(df, out)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for queued downlink")
+		}
+	})
+
+	t.Run("gps epoch queued and purged", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(s.SendDownlinkFrame(gpsDownlink(123, time.Now().Add(300*time.Millisecond))))
+		assert.NoError(s.SendDownlinkFrame(gpsDownlink(124, time.Now().Add(300*time.Millisecond))))
+
+		assert.Equal(0, s.purge(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}))
+		assert.Equal(2, s.purge(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}))
+		assert.Equal(0, s.purge(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}))
+
+		select {
+		case <-b.downlinkFrameChan:
+			t.Fatal("purged downlink must not be sent")
+		case <-time.After(400 * time.Millisecond):
+		}
+	})
+
+	t.Run("gps epoch too late", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(s.SendDownlinkFrame(gpsDownlink(123, time.Now().Add(-time.Second))))
+		assert.Equal(gw.DownlinkTXAck{
+			GatewayId: gatewayID,
+			Token:     123,
+			Error:     "TOO_LATE",
+		}, <-b.downlinkTXAckChan)
+	})
+
+	t.Run("gps epoch too early", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(s.SendDownlinkFrame(gpsDownlink(123, time.Now().Add(time.Hour))))
+		assert.Equal(gw.DownlinkTXAck{
+			GatewayId: gatewayID,
+			Token:     123,
+			Error:     "TOO_EARLY",
+		}, <-b.downlinkTXAckChan)
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		assert := require.New(t)
+
+		up := gw.UplinkFrame{
+			RxInfo: &gw.UplinkRXInfo{
+				GatewayId: gatewayID,
+				Context:   []byte{1, 2, 3, 4},
+			},
+		}
+		b.uplinkFrameChan <- up
+		assert.Equal(up, <-s.GetUplinkFrameChan())
+
+		delayDownlink := func(context []byte) gw.DownlinkFrame {
+			return gw.DownlinkFrame{
+				Token: 123,
+				TxInfo: &gw.DownlinkTXInfo{
+					GatewayId: gatewayID,
+					Context:   context,
+					Timing:    gw.DownlinkTiming_DELAY,
+					TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+						DelayTimingInfo: &gw.DelayTimingInfo{
+							Delay: ptypes.DurationProto(0),
+						},
+					},
+				},
+			}
+		}
+
+		// the uplink is known and the delay has expired
+		assert.NoError(s.SendDownlinkFrame(delayDownlink([]byte{1, 2, 3, 4})))
+		assert.Equal("TOO_LATE", (<-b.downlinkTXAckChan).Error)
+
+		// unknown uplink, the downlink is passed to the backend
+		df := delayDownlink([]byte{4, 3, 2, 1})
+		assert.NoError(s.SendDownlinkFrame(df))
+		assert.Equal(df, <-b.downlinkFrameChan)
+
+		// uplink just before the concentrator counter rollover, the tx time
+		// is after the rollover
+		up.RxInfo.Context = []byte{0xff, 0xff, 0xff, 0xff}
+		b.uplinkFrameChan <- up
+		assert.Equal(up, <-s.GetUplinkFrameChan())
+
+		df = delayDownlink([]byte{0xff, 0xff, 0xff, 0xff})
+		df.TxInfo.GetDelayTimingInfo().Delay = ptypes.DurationProto(50 * time.Millisecond)
+		assert.NoError(s.SendDownlinkFrame(df))
+		assert.Equal(df, <-b.downlinkFrameChan)
+	})
+}
+
+func TestSchedulerQueueFile(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "scheduler")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var conf config.Config
+	conf.Backend.Scheduler.DispatchAhead = 100 * time.Millisecond
+	conf.Backend.Scheduler.MinLeadTime = 10 * time.Millisecond
+	conf.Backend.Scheduler.QueueFile = filepath.Join(dir, "queue.db")
+
+	newTestBackend := func() *testBackend {
+		return &testBackend{
+			uplinkFrameChan:   make(chan gw.UplinkFrame),
+			downlinkTXAckChan: make(chan gw.DownlinkTXAck, 2),
+			downlinkFrameChan: make(chan gw.DownlinkFrame, 2),
+		}
+	}
+
+	// queue two downlinks and stop before these are sent
+	s, err := newScheduler(newTestBackend(), conf)
+	assert.NoError(err)
+
+	dfLate := gpsDownlink(1, time.Now().Add(300*time.Millisecond))
+	dfValid := gpsDownlink(2, time.Now().Add(time.Second))
+	assert.NoError(s.SendDownlinkFrame(dfLate))
+	assert.NoError(s.SendDownlinkFrame(dfValid))
+	assert.NoError(s.Close())
+
+	// restart after the tx time of the first downlink has passed
+	time.Sleep(400 * time.Millisecond)
+
+	b := newTestBackend()
+	s, err = newScheduler(b, conf)
+	assert.NoError(err)
+	defer s.Close()
+
+	select {
+	case ack := <-b.downlinkTXAckChan:
+		assert.Equal(uint32(1), ack.Token)
+		assert.Equal("TOO_LATE", ack.Error)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for tx ack")
+	}
+
+	select {
+	case df := <-b.downlinkFrameChan:
+		assert.Equal(uint32(2), df.Token)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for restored downlink")
+	}
+}
@@ -0,0 +1,110 @@
+package semtechudp
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// allowList restricts the source IPs and gateways from which packets are
+// accepted. An empty list of source IPs or gateways allows all source IPs or
+// gateways.
+type allowList struct {
+	sourceIPs []*net.IPNet
+
+	// gateways contains the allowed gateways and their (optional) source IP
+	// ranges.
+	gateways map[lorawan.EUI64][]*net.IPNet
+}
+
+func newAllowList(sourceIPs []string, gateways []config.SemtechUDPAllowedGateway) (*allowList, error) {
+	var a allowList
+	var err error
+
+	a.sourceIPs, err = parseIPNets(sourceIPs)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse source ips error")
+	}
+
+	if len(gateways) != 0 {
+		a.gateways = make(map[lorawan.EUI64][]*net.IPNet)
+	}
+
+	for _, gw := range gateways {
+		var gatewayID lorawan.EUI64
+		if err := gatewayID.UnmarshalText([]byte(gw.GatewayID)); err != nil {
+			return nil, errors.Wrap(err, "unmarshal gateway id error")
+		}
+
+		a.gateways[gatewayID], err = parseIPNets(gw.SourceIPs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse source ips of gateway %s error", gatewayID)
+		}
+	}
+
+	return &a, nil
+}
+
+// allowSource returns true when packets from the given IP are allowed.
+func (a *allowList) allowSource(ip net.IP) bool {
+	return len(a.sourceIPs) == 0 || containsIP(a.sourceIPs, ip)
+}
+
+// allowGateway returns true when packets from the given gateway and IP are
+// allowed.
+func (a *allowList) allowGateway(gatewayID lorawan.EUI64, ip net.IP) bool {
+	if a.gateways == nil {
+		return true
+	}
+
+	ipNets, ok := a.gateways[gatewayID]
+	if !ok {
+		return false
+	}
+
+	return len(ipNets) == 0 || containsIP(ipNets, ip)
+}
+
+// parseIPNets parses the given list of IP addresses and CIDR ranges. An IP
+// address without prefix length is handled as a single host range.
+func parseIPNets(list []string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.Errorf("invalid ip: %s", s)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ipNet)
+	}
+
+	return out, nil
+}
+
+func containsIP(ipNets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package semtechudp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestAllowList(t *testing.T) {
+	gw1 := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	gw2 := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 9}
+	gw3 := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 10}
+
+	tests := []struct {
+		Name            string
+		SourceIPs       []string
+		Gateways        []config.SemtechUDPAllowedGateway
+		IP              net.IP
+		GatewayID       lorawan.EUI64
+		ExpectedSource  bool
+		ExpectedGateway bool
+	}{
+		{
+			Name:            "empty allow-list",
+			IP:              net.ParseIP("192.168.1.5"),
+			GatewayID:       gw1,
+			ExpectedSource:  true,
+			ExpectedGateway: true,
+		},
+		{
+			Name:            "source ip in range",
+			SourceIPs:       []string{"10.0.0.1", "192.168.1.0/24"},
+			IP:              net.ParseIP("192.168.1.5"),
+			GatewayID:       gw1,
+			ExpectedSource:  true,
+			ExpectedGateway: true,
+		},
+		{
+			Name:            "ipv4-mapped ipv6 source ip in range",
+			SourceIPs:       []string{"192.168.1.0/24"},
+			IP:              net.ParseIP("::ffff:192.168.1.5"),
+			GatewayID:       gw1,
+			ExpectedSource:  true,
+			ExpectedGateway: true,
+		},
+		{
+			Name:            "source ip not in range",
+			SourceIPs:       []string{"10.0.0.1", "192.168.1.0/24"},
+			IP:              net.ParseIP("192.168.2.5"),
+			GatewayID:       gw1,
+			ExpectedGateway: true,
+		},
+		{
+			Name: "gateway allowed",
+			Gateways: []config.SemtechUDPAllowedGateway{
+				{GatewayID: gw1.String()},
+				{GatewayID: gw2.String(), SourceIPs: []string{"10.0.0.0/8"}},
+			},
+			IP:              net.ParseIP("192.168.1.5"),
+			GatewayID:       gw1,
+			ExpectedSource:  true,
+			ExpectedGateway: true,
+		},
+		{
+			Name: "gateway allowed from source ip",
+			Gateways: []config.SemtechUDPAllowedGateway{
+				{GatewayID: gw1.String()},
+				{GatewayID: gw2.String(), SourceIPs: []string{"10.0.0.0/8"}},
+			},
+			IP:              net.ParseIP("10.1.2.3"),
+			GatewayID:       gw2,
+			ExpectedSource:  true,
+			ExpectedGateway: true,
+		},
+		{
+			Name: "gateway not allowed from source ip",
+			Gateways: []config.SemtechUDPAllowedGateway{
+				{GatewayID: gw1.String()},
+				{GatewayID: gw2.String(), SourceIPs: []string{"10.0.0.0/8"}},
+			},
+			IP:             net.ParseIP("192.168.1.5"),
+			GatewayID:      gw2,
+			ExpectedSource: true,
+		},
+		{
+			Name: "unknown gateway",
+			Gateways: []config.SemtechUDPAllowedGateway{
+				{GatewayID: gw1.String()},
+			},
+			IP:             net.ParseIP("192.168.1.5"),
+			GatewayID:      gw3,
+			ExpectedSource: true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			a, err := newAllowList(tst.SourceIPs, tst.Gateways)
+			assert.NoError(err)
+
+			assert.Equal(tst.ExpectedSource, a.allowSource(tst.IP))
+			assert.Equal(tst.ExpectedGateway, a.allowGateway(tst.GatewayID, tst.IP))
+		})
+	}
+}
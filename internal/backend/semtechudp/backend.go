@@ -15,15 +15,41 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp/packets"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
-	"github.com/brocaar/chirpstack-gateway-bridge/internal/filters"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
 	"github.com/brocaar/lorawan"
 )
 
+// maxUDPDataSize defines the max. UDP data size.
+const maxUDPDataSize = 65507
+
+// Reasons for rejecting UDP packets.
+const (
+	rejectDatagramTooLarge  = "datagram_too_large"
+	rejectInvalidHeader     = "invalid_header"
+	rejectUnknownPacketType = "unknown_packet_type"
+	rejectInvalidPacket     = "invalid_packet"
+	rejectInvalidPayload    = "invalid_payload"
+	rejectSourceIP          = "source_ip_not_allowed"
+	rejectGateway           = "gateway_not_allowed"
+)
+
+// packetConn defines the interface of a gateway listener. This is
+// implemented by *net.UDPConn and by the DTLS listener (*dtlsConn).
+type packetConn interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+	LocalAddr() net.Addr
+	Close() error
+}
+
 // udpPacket represents a raw UDP packet.
 type udpPacket struct {
+	conn packetConn
 	addr *net.UDPAddr
 	data []byte
 }
@@ -45,46 +71,89 @@ type Backend struct {
 	// a given time.
 	tokenMap map[uint16][]byte
 
+	// txTimes stores the time at which the PULL_RESP was sent, by token. This
+	// is used for the timesync round-trip measurement. It has its own mutex
+	// as the TX_ACK is handled while holding the read-lock.
+	txTimesMu sync.Mutex
+	txTimes   map[uint16]time.Time
+
 	downlinkTXAckChan chan gw.DownlinkTXAck
 	uplinkFrameChan   chan gw.UplinkFrame
 	gatewayStatsChan  chan gw.GatewayStats
 	udpSendChan       chan udpPacket
+	sender            *buffer.Sender
 
 	wg             sync.WaitGroup
-	conn           *net.UDPConn
+	conns          []packetConn
+	listeners      map[packetConn]config.SemtechUDPListener
 	closed         bool
 	gateways       gateways
-	fakeRxTime     bool
 	configurations []pfConfiguration
-	skipCRCCheck   bool
+	rxCounters     *rxCounters
+	allowList      *allowList
+
+	maxDatagramSize int
 }
 
 // NewBackend creates a new backend.
 func NewBackend(conf config.Config) (*Backend, error) {
-	addr, err := net.ResolveUDPAddr("udp", conf.Backend.SemtechUDP.UDPBind)
-	if err != nil {
-		return nil, errors.Wrap(err, "resolve udp addr error")
-	}
-
-	log.WithField("addr", addr).Info("backend/semtechudp: starting gateway udp listener")
-	conn, err := net.ListenUDP("udp", addr)
-	if err != nil {
-		return nil, errors.Wrap(err, "listen udp error")
+	listenerConfs := getListeners(conf)
+
+	var conns []packetConn
+	listeners := make(map[packetConn]config.SemtechUDPListener)
+	for _, l := range listenerConfs {
+		var conn packetConn
+		var err error
+		if l.DTLS.Enabled {
+			conn, err = listenDTLS(l.Bind, len(listenerConfs) > 1, l.DTLS)
+		} else {
+			var udpConn *net.UDPConn
+			udpConn, err = listenUDP(l.Bind, len(listenerConfs) > 1)
+			conn = udpConn
+		}
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+		listeners[conn] = l
 	}
 
 	b := &Backend{
-		conn:              conn,
-		downlinkTXAckChan: make(chan gw.DownlinkTXAck),
-		uplinkFrameChan:   make(chan gw.UplinkFrame),
-		gatewayStatsChan:  make(chan gw.GatewayStats),
+		conns:             conns,
+		listeners:         listeners,
+		downlinkTXAckChan: make(chan gw.DownlinkTXAck, conf.Backend.Channels.DownlinkTXAckSize),
+		uplinkFrameChan:   make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:  make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
 		udpSendChan:       make(chan udpPacket),
+		sender:            buffer.NewSender("semtech_udp", conf),
 		gateways: gateways{
 			gateways:           make(map[lorawan.EUI64]gateway),
 			subscribeEventChan: make(chan events.Subscribe),
 		},
-		fakeRxTime:   conf.Backend.SemtechUDP.FakeRxTime,
-		skipCRCCheck: conf.Backend.SemtechUDP.SkipCRCCheck,
-		tokenMap:     make(map[uint16][]byte),
+		tokenMap: make(map[uint16][]byte),
+		txTimes:  make(map[uint16]time.Time),
+
+		maxDatagramSize: conf.Backend.SemtechUDP.MaxDatagramSize,
+	}
+
+	if b.maxDatagramSize <= 0 || b.maxDatagramSize > maxUDPDataSize {
+		b.maxDatagramSize = maxUDPDataSize
+	}
+
+	if conf.Backend.SemtechUDP.RXCounters {
+		b.rxCounters = newRXCounters()
+	}
+
+	var err error
+	b.allowList, err = newAllowList(conf.Backend.SemtechUDP.AllowList.SourceIPs, conf.Backend.SemtechUDP.AllowList.Gateways)
+	if err != nil {
+		for _, c := range conns {
+			c.Close()
+		}
+		return nil, errors.Wrap(err, "setup allow-list error")
 	}
 
 	for _, pfConf := range conf.Backend.SemtechUDP.Configuration {
@@ -105,21 +174,26 @@ func NewBackend(conf config.Config) (*Backend, error) {
 			if err := b.gateways.cleanup(); err != nil {
 				log.WithError(err).Error("backend/semtechudp: gateway registry cleanup failed")
 			}
+			if b.rxCounters != nil {
+				b.rxCounters.cleanup(time.Now())
+			}
 			time.Sleep(time.Minute)
 		}
 	}()
 
-	go func() {
+	for _, conn := range b.conns {
 		b.wg.Add(1)
-		err := b.readPackets()
-		if !b.isClosed() {
-			log.WithError(err).Error("backend/semtechudp: read udp packets error")
-		}
-		b.wg.Done()
-	}()
+		go func(conn packetConn) {
+			err := b.readPackets(conn)
+			if !b.isClosed() {
+				log.WithError(err).WithField("listener", conn.LocalAddr()).Error("backend/semtechudp: read udp packets error")
+			}
+			b.wg.Done()
+		}(conn)
+	}
 
+	b.wg.Add(1)
 	go func() {
-		b.wg.Add(1)
 		err := b.sendPackets()
 		if !b.isClosed() {
 			log.WithError(err).Error("backend/semtechudp: send udp packets error")
@@ -130,6 +204,76 @@ func NewBackend(conf config.Config) (*Backend, error) {
 	return b, nil
 }
 
+// getListeners returns the configured listeners. When no listeners are
+// configured, a listener is returned for each udp_binds (or the udp_bind)
+// address, using the global skip_crc_check and fake_rx_time settings.
+func getListeners(conf config.Config) []config.SemtechUDPListener {
+	if len(conf.Backend.SemtechUDP.Listeners) != 0 {
+		return conf.Backend.SemtechUDP.Listeners
+	}
+
+	binds := conf.Backend.SemtechUDP.UDPBinds
+	if len(binds) == 0 {
+		binds = []string{conf.Backend.SemtechUDP.UDPBind}
+	}
+
+	var out []config.SemtechUDPListener
+	for _, bind := range binds {
+		out = append(out, config.SemtechUDPListener{
+			Bind:         bind,
+			SkipCRCCheck: conf.Backend.SemtechUDP.SkipCRCCheck,
+			FakeRxTime:   conf.Backend.SemtechUDP.FakeRxTime,
+		})
+	}
+
+	return out
+}
+
+// listenUDP starts an UDP listener on the given bind address. When
+// ipFamilyOnly is set, the listener only accepts packets of the IP family
+// of the given address. This makes it possible to bind both [::]:1700 and
+// 0.0.0.0:1700. Otherwise, binding [::]:1700 results in a dual-stack
+// listener.
+func listenUDP(bind string, ipFamilyOnly bool) (*net.UDPConn, error) {
+	network, addr, err := resolveUDPAddr(bind, ipFamilyOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"addr":    addr,
+		"network": network,
+	}).Info("backend/semtechudp: starting gateway udp listener")
+
+	conn, err := net.ListenUDP(network, addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen udp error")
+	}
+
+	return conn, nil
+}
+
+// resolveUDPAddr resolves the given bind address. When ipFamilyOnly is set
+// and the address contains an IP, the returned network is restricted to the
+// IP family of the address.
+func resolveUDPAddr(bind string, ipFamilyOnly bool) (string, *net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", bind)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "resolve udp addr error")
+	}
+
+	network := "udp"
+	if ipFamilyOnly && addr.IP != nil {
+		if addr.IP.To4() != nil {
+			network = "udp4"
+		} else {
+			network = "udp6"
+		}
+	}
+
+	return network, addr, nil
+}
+
 // Close closes the backend.
 func (b *Backend) Close() error {
 	b.Lock()
@@ -137,8 +281,10 @@ func (b *Backend) Close() error {
 
 	log.Info("backend/semtechudp: closing gateway backend")
 
-	if err := b.conn.Close(); err != nil {
-		return errors.Wrap(err, "close udp listener error")
+	for _, conn := range b.conns {
+		if err := conn.Close(); err != nil {
+			return errors.Wrap(err, "close udp listener error")
+		}
 	}
 
 	log.Info("backend/semtechudp: handling last packets")
@@ -174,6 +320,12 @@ func (b *Backend) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEve
 	return nil
 }
 
+// GetLogEventChan returns the gateway log event channel.
+func (b *Backend) GetLogEventChan() chan events.Log {
+	// not provided by the Semtech packet-forwarder.
+	return nil
+}
+
 // SendDownlinkFrame sends the given downlink frame to the gateway.
 func (b *Backend) SendDownlinkFrame(frame gw.DownlinkFrame) error {
 	// mutex is needed in order to write to tokenMap
@@ -210,7 +362,14 @@ func (b *Backend) SendDownlinkFrame(frame gw.DownlinkFrame) error {
 		return errors.Wrap(err, "backend/semtechudp: marshal PullRespPacket error")
 	}
 
+	if timesync.Enabled() {
+		b.txTimesMu.Lock()
+		b.txTimes[uint16(frame.Token)] = time.Now()
+		b.txTimesMu.Unlock()
+	}
+
 	b.udpSendChan <- udpPacket{
+		conn: gw.conn,
 		data: bytes,
 		addr: gw.addr,
 	}
@@ -301,10 +460,11 @@ func (b *Backend) isClosed() bool {
 	return b.closed
 }
 
-func (b *Backend) readPackets() error {
-	buf := make([]byte, 65507) // max udp data size
+func (b *Backend) readPackets(conn packetConn) error {
+	// the additional byte is used to detect datagrams exceeding the max size
+	buf := make([]byte, b.maxDatagramSize+1)
 	for {
-		i, addr, err := b.conn.ReadFromUDP(buf)
+		i, addr, err := conn.ReadFromUDP(buf)
 		if err != nil {
 			if b.isClosed() {
 				return nil
@@ -313,9 +473,18 @@ func (b *Backend) readPackets() error {
 			log.WithError(err).Error("gateway: read from udp error")
 			continue
 		}
+		if i > b.maxDatagramSize {
+			log.WithFields(log.Fields{
+				"addr":              addr,
+				"listener":          conn.LocalAddr(),
+				"max_datagram_size": b.maxDatagramSize,
+			}).Error("backend/semtechudp: udp packet exceeds max datagram size")
+			udpRejectedCounter(rejectDatagramTooLarge).Inc()
+			continue
+		}
 		data := make([]byte, i)
 		copy(data, buf[:i])
-		up := udpPacket{data: data, addr: addr}
+		up := udpPacket{conn: conn, data: data, addr: addr}
 
 		// handle packet async
 		go func(up udpPacket) {
@@ -323,6 +492,7 @@ func (b *Backend) readPackets() error {
 				log.WithError(err).WithFields(log.Fields{
 					"data_base64": base64.StdEncoding.EncodeToString(up.data),
 					"addr":        up.addr,
+					"listener":    up.conn.LocalAddr(),
 				}).Error("backend/semtechudp: could not handle packet")
 			}
 		}(up)
@@ -342,11 +512,12 @@ func (b *Backend) sendPackets() error {
 
 		log.WithFields(log.Fields{
 			"addr":             p.addr,
+			"listener":         p.conn.LocalAddr(),
 			"type":             pt,
 			"protocol_version": p.data[0],
 		}).Debug("backend/semtechudp: sending udp packet to gateway")
 
-		_, err = b.conn.WriteToUDP(p.data, p.addr)
+		_, err = p.conn.WriteToUDP(p.data, p.addr)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"addr":             p.addr,
@@ -370,24 +541,50 @@ func (b *Backend) handlePacket(up udpPacket) error {
 
 	pt, err := packets.GetPacketType(up.data)
 	if err != nil {
+		udpRejectedCounter(rejectInvalidHeader).Inc()
 		return err
 	}
 	log.WithFields(log.Fields{
 		"addr":             up.addr,
+		"listener":         up.conn.LocalAddr(),
 		"type":             pt,
 		"protocol_version": up.data[0],
 	}).Debug("backend/semtechudp: received udp packet from gateway")
 
-	udpReadCounter(pt.String()).Inc()
+	if !b.allowList.allowSource(up.addr.IP) {
+		udpRejectedCounter(rejectSourceIP).Inc()
+		return fmt.Errorf("source ip %s is not allowed", up.addr.IP)
+	}
+
+	// the PUSH_DATA, PULL_DATA and TX_ACK packets contain the gateway ID
+	// after the 4 byte header
+	switch pt {
+	case packets.PushData, packets.PullData, packets.TXACK:
+		if len(up.data) >= 12 {
+			var gatewayID lorawan.EUI64
+			copy(gatewayID[:], up.data[4:12])
+
+			if !b.allowList.allowGateway(gatewayID, up.addr.IP) {
+				udpRejectedCounter(rejectGateway).Inc()
+				return fmt.Errorf("gateway %s is not allowed from source ip %s", gatewayID, up.addr.IP)
+			}
+		}
+
+		health.BackendEvent()
+	}
 
 	switch pt {
 	case packets.PushData:
+		udpReadCounter(pt.String()).Inc()
 		return b.handlePushData(up)
 	case packets.PullData:
+		udpReadCounter(pt.String()).Inc()
 		return b.handlePullData(up)
 	case packets.TXACK:
+		udpReadCounter(pt.String()).Inc()
 		return b.handleTXACK(up)
 	default:
+		udpRejectedCounter(rejectUnknownPacketType).Inc()
 		return fmt.Errorf("backend/semtechudp: unknown packet type: %s", pt)
 	}
 }
@@ -395,6 +592,7 @@ func (b *Backend) handlePacket(up udpPacket) error {
 func (b *Backend) handlePullData(up udpPacket) error {
 	var p packets.PullDataPacket
 	if err := p.UnmarshalBinary(up.data); err != nil {
+		udpRejectedCounter(rejectInvalidPacket).Inc()
 		return err
 	}
 	ack := packets.PullACKPacket{
@@ -407,6 +605,7 @@ func (b *Backend) handlePullData(up udpPacket) error {
 	}
 
 	err = b.gateways.set(p.GatewayMAC, gateway{
+		conn:            up.conn,
 		addr:            up.addr,
 		lastSeen:        time.Now().UTC(),
 		protocolVersion: p.ProtocolVersion,
@@ -416,6 +615,7 @@ func (b *Backend) handlePullData(up udpPacket) error {
 	}
 
 	b.udpSendChan <- udpPacket{
+		conn: up.conn,
 		addr: up.addr,
 		data: bytes,
 	}
@@ -425,24 +625,36 @@ func (b *Backend) handlePullData(up udpPacket) error {
 func (b *Backend) handleTXACK(up udpPacket) error {
 	var p packets.TXACKPacket
 	if err := p.UnmarshalBinary(up.data); err != nil {
+		udpRejectedCounter(rejectInvalidPacket).Inc()
 		return err
 	}
 
 	downID := b.tokenMap[p.RandomToken]
 
+	// the time between sending the PULL_RESP and receiving the TX_ACK is used
+	// as round-trip time
+	b.txTimesMu.Lock()
+	txTime, ok := b.txTimes[p.RandomToken]
+	delete(b.txTimes, p.RandomToken)
+	b.txTimesMu.Unlock()
+	if ok {
+		now := time.Now()
+		timesync.AddRoundTrip(p.GatewayMAC, now.Sub(txTime), now)
+	}
+
 	if p.Payload != nil && p.Payload.TXPKACK.Error != "" && p.Payload.TXPKACK.Error != "NONE" {
-		b.downlinkTXAckChan <- gw.DownlinkTXAck{
+		b.sender.DownlinkTXAck(b.downlinkTXAckChan, gw.DownlinkTXAck{
 			GatewayId:  p.GatewayMAC[:],
 			Token:      uint32(p.RandomToken),
 			DownlinkId: downID,
 			Error:      p.Payload.TXPKACK.Error,
-		}
+		})
 	} else {
-		b.downlinkTXAckChan <- gw.DownlinkTXAck{
+		b.sender.DownlinkTXAck(b.downlinkTXAckChan, gw.DownlinkTXAck{
 			GatewayId:  p.GatewayMAC[:],
 			Token:      uint32(p.RandomToken),
 			DownlinkId: downID,
-		}
+		})
 	}
 
 	return nil
@@ -451,6 +663,7 @@ func (b *Backend) handleTXACK(up udpPacket) error {
 func (b *Backend) handlePushData(up udpPacket) error {
 	var p packets.PushDataPacket
 	if err := p.UnmarshalBinary(up.data); err != nil {
+		udpRejectedCounter(rejectInvalidPacket).Inc()
 		return err
 	}
 
@@ -464,6 +677,7 @@ func (b *Backend) handlePushData(up udpPacket) error {
 		return err
 	}
 	b.udpSendChan <- udpPacket{
+		conn: up.conn,
 		addr: up.addr,
 		data: bytes,
 	}
@@ -471,6 +685,7 @@ func (b *Backend) handlePushData(up udpPacket) error {
 	// gateway stats
 	stats, err := p.GetGatewayStats()
 	if err != nil {
+		udpRejectedCounter(rejectInvalidPayload).Inc()
 		return errors.Wrap(err, "get stats error")
 	}
 	if stats != nil {
@@ -489,9 +704,15 @@ func (b *Backend) handlePushData(up udpPacket) error {
 		b.handleStats(p.GatewayMAC, *stats)
 	}
 
+	// timesync samples
+	b.addTimeSyncSamples(p, time.Now())
+
 	// uplink frames
-	uplinkFrames, err := p.GetUplinkFrames(b.skipCRCCheck, b.fakeRxTime)
+	// the skip CRC check and fake RX time settings are configured per listener
+	l := b.listeners[up.conn]
+	uplinkFrames, err := p.GetUplinkFrames(l.SkipCRCCheck, l.FakeRxTime)
 	if err != nil {
+		udpRejectedCounter(rejectInvalidPayload).Inc()
 		return errors.Wrap(err, "get uplink frames error")
 	}
 	b.handleUplinkFrames(uplinkFrames)
@@ -507,18 +728,48 @@ func (b *Backend) handleStats(gatewayID lorawan.EUI64, stats gw.GatewayStats) {
 		}
 	}
 
-	b.gatewayStatsChan <- stats
+	// set the uplink counters since the previous stats, if enabled
+	if b.rxCounters != nil {
+		stats.MetaData = b.rxCounters.flush(gatewayID, time.Now())
+	}
+
+	// set the estimated clock offset, if available
+	for k, v := range timesync.GetMetaData(gatewayID) {
+		if stats.MetaData == nil {
+			stats.MetaData = make(map[string]string)
+		}
+		stats.MetaData[k] = v
+	}
+
+	b.sender.GatewayStats(b.gatewayStatsChan, stats)
+}
+
+// addTimeSyncSamples adds the gateway time of the received packets as
+// timesync samples. The rxpk time has a microsecond resolution, the stat
+// time has a second resolution.
+func (b *Backend) addTimeSyncSamples(p packets.PushDataPacket, hostTime time.Time) {
+	if !timesync.Enabled() {
+		return
+	}
+
+	for _, rxpk := range p.Payload.RXPK {
+		if rxpk.Time != nil && !time.Time(*rxpk.Time).IsZero() {
+			timesync.AddSample(p.GatewayMAC, time.Time(*rxpk.Time), hostTime, time.Microsecond)
+		}
+	}
+
+	if p.Payload.Stat != nil && !time.Time(p.Payload.Stat.Time).IsZero() {
+		timesync.AddSample(p.GatewayMAC, time.Time(p.Payload.Stat.Time), hostTime, time.Second)
+	}
 }
 
 func (b *Backend) handleUplinkFrames(uplinkFrames []gw.UplinkFrame) error {
 	for i := range uplinkFrames {
-		if filters.MatchFilters(uplinkFrames[i].PhyPayload) {
-			b.uplinkFrameChan <- uplinkFrames[i]
-		} else {
-			log.WithFields(log.Fields{
-				"data_base64": base64.StdEncoding.EncodeToString(uplinkFrames[i].PhyPayload),
-			}).Debug("backend/semtechudp: frame dropped because of configured filters")
+		if b.rxCounters != nil {
+			b.rxCounters.add(uplinkFrames[i], time.Now())
 		}
+
+		b.sender.UplinkFrame(b.uplinkFrameChan, uplinkFrames[i])
 	}
 
 	return nil
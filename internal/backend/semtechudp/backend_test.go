@@ -1,18 +1,22 @@
 package semtechudp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/pion/dtls/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -21,6 +25,7 @@ import (
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp/packets"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
 	"github.com/brocaar/lorawan"
 )
 
@@ -63,7 +68,7 @@ func (ts *BackendTestSuite) SetupTest() {
 	ts.backend, err = NewBackend(conf)
 	assert.NoError(err)
 
-	ts.backendUDPAddr, err = net.ResolveUDPAddr("udp", ts.backend.conn.LocalAddr().String())
+	ts.backendUDPAddr, err = net.ResolveUDPAddr("udp", ts.backend.conns[0].LocalAddr().String())
 	assert.NoError(err)
 
 	gwAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
@@ -1022,3 +1027,592 @@ func (ts *BackendTestSuite) TestApplyConfiguration() {
 func TestBackend(t *testing.T) {
 	suite.Run(t, new(BackendTestSuite))
 }
+
+func TestBackendDTLSListener(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.Listeners = []config.SemtechUDPListener{
+		{
+			Bind: "127.0.0.1:0",
+			DTLS: config.SemtechUDPDTLS{
+				Enabled: true,
+				PSKs: []config.SemtechUDPDTLSPSK{
+					{Identity: "0102030405060708", Key: "01020304050607080102030405060708"},
+				},
+			},
+		},
+	}
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+	assert.Len(backend.conns, 1)
+	assert.IsType(&dtlsConn{}, backend.conns[0])
+	backendAddr := backend.conns[0].LocalAddr().(*net.UDPAddr)
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(err)
+	defer gwConn.Close()
+	assert.NoError(gwConn.SetDeadline(time.Now().Add(100 * time.Millisecond)))
+
+	// An unencrypted PullData is not handled
+	pullData := packets.PullDataPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		GatewayMAC:      lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	b, err := pullData.MarshalBinary()
+	assert.NoError(err)
+	_, err = gwConn.WriteToUDP(b, backendAddr)
+	assert.NoError(err)
+
+	_, _, err = gwConn.ReadFromUDP(make([]byte, 65507))
+	assert.Error(err)
+
+	t.Run("PSK", func(t *testing.T) {
+		assert := require.New(t)
+
+		conn, err := dtls.Dial("udp", backendAddr, &dtls.Config{
+			PSK: func([]byte) ([]byte, error) {
+				return []byte{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}, nil
+			},
+			PSKIdentityHint: []byte("0102030405060708"),
+			CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		})
+		assert.NoError(err)
+		defer conn.Close()
+		assert.NoError(conn.SetDeadline(time.Now().Add(time.Second)))
+
+		pullData.RandomToken = 12345
+		b, err := pullData.MarshalBinary()
+		assert.NoError(err)
+		_, err = conn.Write(b)
+		assert.NoError(err)
+
+		buf := make([]byte, 65507)
+		i, err := conn.Read(buf)
+		assert.NoError(err)
+		var ack packets.PullACKPacket
+		assert.NoError(ack.UnmarshalBinary(buf[:i]))
+		assert.Equal(pullData.RandomToken, ack.RandomToken)
+	})
+
+	t.Run("Unknown PSK identity", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := dtls.Dial("udp", backendAddr, &dtls.Config{
+			PSK: func([]byte) ([]byte, error) {
+				return []byte{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}, nil
+			},
+			PSKIdentityHint: []byte("0807060504030201"),
+			CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+			FlightInterval:  10 * time.Millisecond,
+			ConnectContextMaker: func() (context.Context, func()) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+		})
+		assert.Error(err)
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		assert := require.New(t)
+
+		conf.Backend.SemtechUDP.Listeners[0].DTLS.PSKs = nil
+		_, err := NewBackend(conf)
+		assert.Error(err)
+	})
+}
+
+func TestBackendMultipleListeners(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.UDPBinds = []string{"127.0.0.1:0", "127.0.0.1:0"}
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+	assert.Len(backend.conns, 2)
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gatewayIDs := []lorawan.EUI64{
+		{1, 1, 1, 1, 1, 1, 1, 1},
+		{2, 2, 2, 2, 2, 2, 2, 2},
+	}
+
+	for i, gatewayID := range gatewayIDs {
+		listenerAddr := backend.conns[i].LocalAddr().(*net.UDPAddr)
+
+		gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.NoError(err)
+		defer gwConn.Close()
+		assert.NoError(gwConn.SetDeadline(time.Now().Add(time.Second)))
+
+		// PullData is received by the listener of the gateway
+		pullData := packets.PullDataPacket{
+			ProtocolVersion: packets.ProtocolVersion2,
+			RandomToken:     uint16(i),
+			GatewayMAC:      gatewayID,
+		}
+		b, err := pullData.MarshalBinary()
+		assert.NoError(err)
+		_, err = gwConn.WriteToUDP(b, listenerAddr)
+		assert.NoError(err)
+
+		buf := make([]byte, 65507)
+		_, addr, err := gwConn.ReadFromUDP(buf)
+		assert.NoError(err)
+		assert.Equal(listenerAddr.String(), addr.String())
+
+		// PullResp is sent using the same listener
+		assert.NoError(backend.SendDownlinkFrame(gw.DownlinkFrame{
+			PhyPayload: []byte{1, 2, 3, 4},
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId:  gatewayID[:],
+				Frequency:  868100000,
+				Modulation: common.Modulation_LORA,
+				ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+					LoraModulationInfo: &gw.LoRaModulationInfo{
+						Bandwidth:       125,
+						SpreadingFactor: 7,
+						CodeRate:        "4/5",
+					},
+				},
+				Timing: gw.DownlinkTiming_IMMEDIATELY,
+				TimingInfo: &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+					ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+				},
+			},
+		}))
+
+		n, addr, err := gwConn.ReadFromUDP(buf)
+		assert.NoError(err)
+		assert.Equal(listenerAddr.String(), addr.String())
+
+		var pullResp packets.PullRespPacket
+		assert.NoError(pullResp.UnmarshalBinary(buf[:n]))
+	}
+}
+
+func TestBackendListenerSettings(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.Listeners = []config.SemtechUDPListener{
+		{Bind: "127.0.0.1:0"},
+		{Bind: "127.0.0.1:0", SkipCRCCheck: true, FakeRxTime: true},
+	}
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+	assert.Len(backend.conns, 2)
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(err)
+	defer gwConn.Close()
+	assert.NoError(gwConn.SetDeadline(time.Now().Add(time.Second)))
+
+	// an uplink with CRC error and without time
+	pushData := packets.PushDataPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		RandomToken:     1234,
+		GatewayMAC:      [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Payload: packets.PushDataPayload{
+			RXPK: []packets.RXPK{
+				{
+					Tmst: 708016819,
+					Freq: 868.1,
+					Stat: -1,
+					Modu: "LORA",
+					DatR: packets.DatR{LoRa: "SF7BW125"},
+					CodR: "4/5",
+					Size: 4,
+					Data: []byte{1, 2, 3, 4},
+				},
+			},
+		},
+	}
+	b, err := pushData.MarshalBinary()
+	assert.NoError(err)
+
+	buf := make([]byte, 65507)
+	for _, conn := range backend.conns {
+		_, err = gwConn.WriteToUDP(b, conn.LocalAddr().(*net.UDPAddr))
+		assert.NoError(err)
+		_, _, err = gwConn.ReadFromUDP(buf)
+		assert.NoError(err)
+	}
+
+	// only the second listener skips the CRC check and fakes the RX time
+	select {
+	case uplink := <-backend.GetUplinkFrameChan():
+		assert.NotNil(uplink.RxInfo.Time)
+	case <-time.After(time.Second):
+		assert.FailNow("uplink not received")
+	}
+
+	select {
+	case <-backend.GetUplinkFrameChan():
+		assert.FailNow("unexpected uplink")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBackendRXCounters(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.UDPBind = "127.0.0.1:0"
+	conf.Backend.SemtechUDP.RXCounters = true
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(err)
+	defer gwConn.Close()
+	assert.NoError(gwConn.SetDeadline(time.Now().Add(time.Second)))
+
+	send := func(payload packets.PushDataPayload) {
+		pushData := packets.PushDataPacket{
+			ProtocolVersion: packets.ProtocolVersion2,
+			RandomToken:     1234,
+			GatewayMAC:      [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Payload:         payload,
+		}
+		b, err := pushData.MarshalBinary()
+		assert.NoError(err)
+		_, err = gwConn.WriteToUDP(b, backend.conns[0].LocalAddr().(*net.UDPAddr))
+		assert.NoError(err)
+
+		// ack
+		buf := make([]byte, 65507)
+		_, _, err = gwConn.ReadFromUDP(buf)
+		assert.NoError(err)
+	}
+
+	// uplinks spread over three channels
+	var rxpk []packets.RXPK
+	for _, u := range []struct {
+		Freq float64
+		DatR string
+	}{
+		{868.1, "SF7BW125"},
+		{868.1, "SF7BW125"},
+		{868.1, "SF9BW125"},
+		{868.3, "SF7BW125"},
+		{868.3, "SF12BW125"},
+		{868.5, "SF7BW125"},
+	} {
+		rxpk = append(rxpk, packets.RXPK{
+			Tmst: 708016819,
+			Freq: u.Freq,
+			Stat: 1,
+			Modu: "LORA",
+			DatR: packets.DatR{LoRa: u.DatR},
+			CodR: "4/5",
+			Size: 4,
+			Data: []byte{1, 2, 3, 4},
+		})
+	}
+	send(packets.PushDataPayload{RXPK: rxpk})
+	for range rxpk {
+		<-backend.GetUplinkFrameChan()
+	}
+
+	stat := packets.PushDataPayload{
+		Stat: &packets.Stat{
+			Time: packets.ExpandedTime(time.Now().UTC()),
+			RXNb: 6,
+			RXOK: 6,
+		},
+	}
+
+	send(stat)
+	stats := <-backend.GetGatewayStatsChan()
+	assert.Equal(map[string]string{
+		"rx_count_868100000": "3",
+		"rx_count_868300000": "2",
+		"rx_count_868500000": "1",
+		"rx_count_sf7":       "4",
+		"rx_count_sf9":       "1",
+		"rx_count_sf12":      "1",
+	}, stats.MetaData)
+
+	// the counters are reset after each stats
+	send(stat)
+	stats = <-backend.GetGatewayStatsChan()
+	assert.Len(stats.MetaData, 0)
+}
+
+func TestBackendTimeSync(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.UDPBind = "127.0.0.1:0"
+	conf.TimeSync.Enabled = true
+	conf.TimeSync.Window = time.Minute
+	assert.NoError(timesync.Setup(conf))
+	defer timesync.Setup(config.Config{})
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(err)
+	defer gwConn.Close()
+	assert.NoError(gwConn.SetDeadline(time.Now().Add(time.Second)))
+
+	send := func(payload packets.PushDataPayload) {
+		pushData := packets.PushDataPacket{
+			ProtocolVersion: packets.ProtocolVersion2,
+			RandomToken:     1234,
+			GatewayMAC:      [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+			Payload:         payload,
+		}
+		b, err := pushData.MarshalBinary()
+		assert.NoError(err)
+		_, err = gwConn.WriteToUDP(b, backend.conns[0].LocalAddr().(*net.UDPAddr))
+		assert.NoError(err)
+
+		// ack
+		buf := make([]byte, 65507)
+		_, _, err = gwConn.ReadFromUDP(buf)
+		assert.NoError(err)
+	}
+
+	// the gateway clock is 5 seconds ahead
+	rxTime := packets.CompactTime(time.Now().Add(5 * time.Second).UTC())
+	send(packets.PushDataPayload{
+		RXPK: []packets.RXPK{
+			{
+				Time: &rxTime,
+				Tmst: 708016819,
+				Freq: 868.1,
+				Stat: 1,
+				Modu: "LORA",
+				DatR: packets.DatR{LoRa: "SF7BW125"},
+				CodR: "4/5",
+				Size: 4,
+				Data: []byte{1, 2, 3, 4},
+			},
+		},
+	})
+	<-backend.GetUplinkFrameChan()
+
+	send(packets.PushDataPayload{
+		Stat: &packets.Stat{
+			Time: packets.ExpandedTime(time.Now().Add(5 * time.Second).UTC()),
+		},
+	})
+	stats := <-backend.GetGatewayStatsChan()
+
+	offset, err := strconv.ParseInt(stats.MetaData[timesync.MetaDataKey], 10, 64)
+	assert.NoError(err)
+	assert.InDelta(5000000, offset, 100000)
+}
+
+func TestBackendRejectedPackets(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.UDPBind = "127.0.0.1:0"
+	conf.Backend.SemtechUDP.MaxDatagramSize = 100
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(err)
+	defer gwConn.Close()
+	assert.NoError(gwConn.SetDeadline(time.Now().Add(time.Second)))
+
+	header := []byte{2, 1, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	tests := []struct {
+		Name   string
+		Data   []byte
+		Reason string
+	}{
+		{
+			Name:   "datagram too large",
+			Data:   append(header, make([]byte, 100)...),
+			Reason: rejectDatagramTooLarge,
+		},
+		{
+			Name:   "invalid header",
+			Data:   []byte{9, 1, 0, 0},
+			Reason: rejectInvalidHeader,
+		},
+		{
+			Name:   "unknown packet type",
+			Data:   []byte{2, 1, 0, 99},
+			Reason: rejectUnknownPacketType,
+		},
+		{
+			Name:   "invalid packet",
+			Data:   append(header, []byte(`{"rxpk":[{]}`)...),
+			Reason: rejectInvalidPacket,
+		},
+		{
+			Name:   "invalid payload",
+			Data:   append(header, []byte(`{"rxpk":[{"stat":1,"freq":868.1,"datr":"SF7"}]}`)...),
+			Reason: rejectInvalidPayload,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			before := testutil.ToFloat64(udpRejectedCounter(tst.Reason))
+
+			_, err := gwConn.WriteToUDP(tst.Data, backend.conns[0].LocalAddr().(*net.UDPAddr))
+			assert.NoError(err)
+
+			// the invalid payload is detected after the PUSH_ACK has been sent
+			if tst.Reason == rejectInvalidPayload {
+				buf := make([]byte, 65507)
+				_, _, err = gwConn.ReadFromUDP(buf)
+				assert.NoError(err)
+			}
+
+			assert.Eventually(func() bool {
+				return testutil.ToFloat64(udpRejectedCounter(tst.Reason)) == before+1
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+
+	// the backend still handles valid packets
+	pullData := packets.PullDataPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		RandomToken:     1234,
+		GatewayMAC:      [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}
+	b, err := pullData.MarshalBinary()
+	assert.NoError(err)
+	_, err = gwConn.WriteToUDP(b, backend.conns[0].LocalAddr().(*net.UDPAddr))
+	assert.NoError(err)
+
+	buf := make([]byte, 65507)
+	i, _, err := gwConn.ReadFromUDP(buf)
+	assert.NoError(err)
+	var ack packets.PullACKPacket
+	assert.NoError(ack.UnmarshalBinary(buf[:i]))
+	assert.Equal(pullData.RandomToken, ack.RandomToken)
+}
+
+func TestBackendAllowList(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Backend.SemtechUDP.UDPBind = "127.0.0.1:0"
+	conf.Backend.SemtechUDP.AllowList.SourceIPs = []string{"127.0.0.0/8"}
+	conf.Backend.SemtechUDP.AllowList.Gateways = []config.SemtechUDPAllowedGateway{
+		{GatewayID: "0102030405060708"},
+		{GatewayID: "0102030405060709", SourceIPs: []string{"10.0.0.1"}},
+	}
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+
+	go func() {
+		for range backend.GetSubscribeEventChan() {
+		}
+	}()
+
+	gwConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(err)
+	defer gwConn.Close()
+	assert.NoError(gwConn.SetDeadline(time.Now().Add(time.Second)))
+
+	pullData := func(gatewayID lorawan.EUI64) []byte {
+		b, err := packets.PullDataPacket{
+			ProtocolVersion: packets.ProtocolVersion2,
+			RandomToken:     1234,
+			GatewayMAC:      gatewayID,
+		}.MarshalBinary()
+		assert.NoError(err)
+		return b
+	}
+
+	tests := []struct {
+		Name      string
+		GatewayID lorawan.EUI64
+	}{
+		{
+			Name:      "unknown gateway",
+			GatewayID: lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1},
+		},
+		{
+			Name:      "gateway from other source ip",
+			GatewayID: lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 9},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			before := testutil.ToFloat64(udpRejectedCounter(rejectGateway))
+
+			_, err := gwConn.WriteToUDP(pullData(tst.GatewayID), backend.conns[0].LocalAddr().(*net.UDPAddr))
+			assert.NoError(err)
+
+			assert.Eventually(func() bool {
+				return testutil.ToFloat64(udpRejectedCounter(rejectGateway)) == before+1
+			}, time.Second, 10*time.Millisecond)
+
+			_, err = backend.gateways.get(tst.GatewayID)
+			assert.Error(err)
+		})
+	}
+
+	t.Run("allowed gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := gwConn.WriteToUDP(pullData(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}), backend.conns[0].LocalAddr().(*net.UDPAddr))
+		assert.NoError(err)
+
+		buf := make([]byte, 65507)
+		i, _, err := gwConn.ReadFromUDP(buf)
+		assert.NoError(err)
+		var ack packets.PullACKPacket
+		assert.NoError(ack.UnmarshalBinary(buf[:i]))
+		assert.Equal(uint16(1234), ack.RandomToken)
+	})
+}
@@ -0,0 +1,297 @@
+package semtechudp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/protocol"
+	"github.com/pion/dtls/v2/pkg/protocol/recordlayer"
+	"github.com/pion/transport/v2/udp"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// The DTLS session timeouts. A session which is idle for dtlsSessionTimeout
+// (the packet-forwarder sends a PULL_DATA every few seconds) or of which the
+// handshake does not complete within dtlsHandshakeTimeout is closed.
+var (
+	dtlsSessionTimeout   = 5 * time.Minute
+	dtlsHandshakeTimeout = 30 * time.Second
+)
+
+// dtlsCipherSuites contains the enabled cipher suites. These are the cipher
+// suites commonly supported by the DTLS stacks used by packet-forwarders.
+// The suites not matching the configured PSKs and / or certificate are
+// filtered out by the DTLS library.
+var dtlsCipherSuites = []dtls.CipherSuiteID{
+	dtls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	dtls.TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8,
+	dtls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	dtls.TLS_PSK_WITH_AES_128_GCM_SHA256,
+	dtls.TLS_PSK_WITH_AES_128_CCM_8,
+}
+
+// dtlsDatagram holds the decrypted application data of a datagram.
+type dtlsDatagram struct {
+	addr *net.UDPAddr
+	data []byte
+}
+
+// dtlsConn implements the packetConn interface on top of a DTLS listener.
+// Each gateway (address) has its own DTLS connection, of which the decrypted
+// datagrams are returned by ReadFromUDP. WriteToUDP writes to the connection
+// of the given address.
+type dtlsConn struct {
+	listener  net.Listener
+	config    *dtls.Config
+	datagrams chan dtlsDatagram
+
+	// ctx is cancelled on Close, this aborts the pending handshakes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mux    sync.Mutex
+	conns  map[string]*dtls.Conn
+	closed bool
+}
+
+// listenDTLS starts a DTLS listener on the given bind address, using the
+// given configuration.
+func listenDTLS(bind string, ipFamilyOnly bool, conf config.SemtechUDPDTLS) (packetConn, error) {
+	dtlsConf := dtls.Config{
+		CipherSuites:         dtlsCipherSuites,
+		ExtendedMasterSecret: dtls.RequestExtendedMasterSecret,
+	}
+
+	if len(conf.PSKs) != 0 {
+		psks := make(map[string][]byte)
+		for _, psk := range conf.PSKs {
+			key, err := hex.DecodeString(psk.Key)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode psk error")
+			}
+			psks[psk.Identity] = key
+		}
+
+		// On the server side, the callback is called with the PSK identity
+		// of the client.
+		dtlsConf.PSK = func(identity []byte) ([]byte, error) {
+			key, ok := psks[string(identity)]
+			if !ok {
+				return nil, errors.New("unknown psk identity")
+			}
+			return key, nil
+		}
+	}
+
+	if conf.TLSCert != "" || conf.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load x509 keypair error")
+		}
+		dtlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	if conf.CACert != "" {
+		rawCACert, err := ioutil.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca cert error")
+		}
+
+		dtlsConf.ClientCAs = x509.NewCertPool()
+		if !dtlsConf.ClientCAs.AppendCertsFromPEM(rawCACert) {
+			return nil, errors.New("append ca certificate error")
+		}
+
+		// This only applies to the certificate based cipher suites.
+		dtlsConf.ClientAuth = dtls.RequireAndVerifyClientCert
+	}
+
+	if dtlsConf.PSK == nil && len(dtlsConf.Certificates) == 0 {
+		return nil, errors.New("no cipher suites enabled, configure a psk and / or certificate")
+	}
+
+	network, addr, err := resolveUDPAddr(bind, ipFamilyOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"addr":     addr,
+		"network":  network,
+		"psks":     len(conf.PSKs),
+		"tls_cert": conf.TLSCert,
+		"tls_key":  conf.TLSKey,
+		"ca_cert":  conf.CACert,
+	}).Info("backend/semtechudp: starting gateway dtls listener")
+
+	// Only handshake records create a new connection, other records of
+	// unknown addresses are dropped.
+	lc := udp.ListenConfig{
+		AcceptFilter: func(b []byte) bool {
+			pkts, err := recordlayer.UnpackDatagram(b)
+			if err != nil || len(pkts) == 0 {
+				return false
+			}
+			var h recordlayer.Header
+			if err := h.Unmarshal(pkts[0]); err != nil {
+				return false
+			}
+			return h.ContentType == protocol.ContentTypeHandshake
+		},
+	}
+
+	l, err := lc.Listen(network, addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen udp error")
+	}
+
+	c := dtlsConn{
+		listener:  l,
+		config:    &dtlsConf,
+		datagrams: make(chan dtlsDatagram),
+		conns:     make(map[string]*dtls.Conn),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	go c.acceptLoop()
+
+	return &c, nil
+}
+
+// ReadFromUDP returns the next decrypted datagram.
+func (c *dtlsConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case d := <-c.datagrams:
+		return copy(b, d.data), d.addr, nil
+	case <-c.ctx.Done():
+		return 0, nil, errors.New("dtls listener closed")
+	}
+}
+
+// WriteToUDP writes the given data to the DTLS connection of the given
+// address.
+func (c *dtlsConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	c.mux.Lock()
+	conn, ok := c.conns[addr.String()]
+	c.mux.Unlock()
+
+	if !ok {
+		return 0, errors.New("no dtls session for address")
+	}
+
+	return conn.Write(b)
+}
+
+// LocalAddr returns the local address of the listener.
+func (c *dtlsConn) LocalAddr() net.Addr {
+	return c.listener.Addr()
+}
+
+// Close closes the listener and the DTLS connections.
+func (c *dtlsConn) Close() error {
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+
+	for k, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, k)
+	}
+	c.mux.Unlock()
+
+	return c.listener.Close()
+}
+
+// acceptLoop accepts the new connections. The handshake of each connection
+// is performed in its own goroutine, such that a slow or stalled handshake
+// does not block the other gateways.
+func (c *dtlsConn) acceptLoop() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			select {
+			case <-c.ctx.Done():
+			default:
+				log.WithError(err).WithField("listener", c.listener.Addr()).Error("backend/semtechudp: accept dtls connection error")
+			}
+			return
+		}
+
+		go c.handleConn(conn)
+	}
+}
+
+// handleConn performs the handshake and reads the datagrams of the given
+// connection, until it is closed or idle for dtlsSessionTimeout.
+func (c *dtlsConn) handleConn(conn net.Conn) {
+	addr, ok := conn.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, dtlsHandshakeTimeout)
+	sess, err := dtls.ServerWithContext(ctx, conn, c.config)
+	cancel()
+	if err != nil {
+		log.WithError(err).WithField("addr", addr).Warning("backend/semtechudp: dtls handshake error")
+		dtlsHandshakeCounter("error").Inc()
+		conn.Close()
+		return
+	}
+	dtlsHandshakeCounter("ok").Inc()
+
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		sess.Close()
+		return
+	}
+	c.conns[addr.String()] = sess
+	c.mux.Unlock()
+
+	defer func() {
+		c.mux.Lock()
+		if c.conns[addr.String()] == sess {
+			delete(c.conns, addr.String())
+		}
+		c.mux.Unlock()
+		sess.Close()
+	}()
+
+	buf := make([]byte, maxUDPDataSize+1)
+	for {
+		if err := sess.SetReadDeadline(time.Now().Add(dtlsSessionTimeout)); err != nil {
+			return
+		}
+
+		n, err := sess.Read(buf)
+		if err != nil {
+			log.WithError(err).WithField("addr", addr).Debug("backend/semtechudp: dtls session closed")
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		select {
+		case c.datagrams <- dtlsDatagram{addr: addr, data: data}:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
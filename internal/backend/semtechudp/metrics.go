@@ -16,6 +16,11 @@ var (
 		Help: "The number of UDP packets received by the backend (per packet_type).",
 	}, []string{"packet_type"})
 
+	udr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_semtechudp_udp_rejected_count",
+		Help: "The number of UDP packets rejected by the backend (per reason).",
+	}, []string{"reason"})
+
 	gwc = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "backend_semtechudp_gateway_connect_count",
 		Help: "The number of gateway connections received by the backend.",
@@ -25,6 +30,11 @@ var (
 		Name: "backend_semtechudp_gateway_diconnect_count",
 		Help: "The number of gateways that disconnected from the backend.",
 	})
+
+	dhc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_semtechudp_dtls_handshake_count",
+		Help: "The number of DTLS handshakes handled by the backend (per result).",
+	}, []string{"result"})
 )
 
 func udpWriteCounter(pt string) prometheus.Counter {
@@ -35,6 +45,10 @@ func udpReadCounter(pt string) prometheus.Counter {
 	return urc.With(prometheus.Labels{"packet_type": pt})
 }
 
+func udpRejectedCounter(reason string) prometheus.Counter {
+	return udr.With(prometheus.Labels{"reason": reason})
+}
+
 func connectCounter() prometheus.Counter {
 	return gwc
 }
@@ -42,3 +56,7 @@ func connectCounter() prometheus.Counter {
 func disconnectCounter() prometheus.Counter {
 	return gwd
 }
+
+func dtlsHandshakeCounter(result string) prometheus.Counter {
+	return dhc.With(prometheus.Labels{"result": result})
+}
@@ -0,0 +1,103 @@
+package packets
+
+import (
+	"testing"
+)
+
+// header returns the 12 byte header for the given packet type.
+func header(pt PacketType) []byte {
+	return []byte{0x02, 0xa3, 0x5c, byte(pt), 0xaa, 0x55, 0x5a, 0x00, 0x00, 0x00, 0x01, 0x01}
+}
+
+// pushDataCorpus contains PUSH_DATA datagrams captured from packet-forwarders.
+var pushDataCorpus = []string{
+	`{"stat":{"time":"2020-03-09 08:59:28 GMT","lati":46.24000,"long":3.25230,"alti":145,"rxnb":2,"rxok":2,"rxfw":2,"ackr":100.0,"dwnb":2,"txnb":2}}`,
+	`{"rxpk":[{"tmst":3512348611,"chan":2,"rfch":0,"freq":866.349812,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/6","rssi":-35,"lsnr":5.1,"size":32,"data":"-DS4CGaDCdG+48eJNM3Vai-zDpsR71Pn9CPA9uCON84"}]}`,
+	`{"rxpk":[{"time":"2013-03-31T16:21:17.528002Z","tmst":3512348611,"chan":2,"rfch":0,"freq":866.349812,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/6","rssi":-35,"lsnr":5.1,"size":32,"data":"-DS4CGaDCdG+48eJNM3Vai-zDpsR71Pn9CPA9uCON84"},{"time":"2013-03-31T16:21:17.530974Z","tmst":3512348514,"chan":9,"rfch":1,"freq":869.1,"stat":1,"modu":"FSK","datr":50000,"rssi":-75,"size":16,"data":"VEVTVF9QQUNLRVRfMTIzNA=="}]}`,
+	`{"rxpk":[{"tmst":1377519540,"time":"2020-03-09T08:59:27.853912Z","tmms":1267779585853,"chan":3,"rfch":0,"freq":867.100000,"stat":1,"modu":"LORA","datr":"SF12BW125","codr":"4/5","lsnr":-10.8,"rssi":-119,"size":23,"data":"QAQTASaAAQACzHKFAWqq9+ZX7GQ=","aesk":0,"brd":1,"rsig":[{"ant":0,"chan":3,"rssic":-119,"lsnr":-10.8,"etime":"KaJSwMYXT1KbOwhJRwXb5w=="},{"ant":1,"chan":3,"rssic":-121,"lsnr":-13.1}]}]}`,
+	`{"rxpk":[{"tmst":1,"stat":-1,"freq":868.1,"modu":"LORA","datr":"SF10BW125","codr":"4/5","data":""}]}`,
+	`{}`,
+}
+
+// txACKCorpus contains TX_ACK datagrams captured from packet-forwarders.
+var txACKCorpus = []string{
+	``,
+	`{"txpk_ack":{"error":"NONE"}}`,
+	`{"txpk_ack":{"error":"TOO_LATE"}}`,
+	`{"txpk_ack":{"warn":"TX_POWER","value":14}}`,
+}
+
+// The seeds of the fuzz targets. These are also run by TestFuzzSeeds, such
+// that the seeds are tested by toolchains without fuzzing support.
+func pushDataSeeds() [][]byte {
+	var out [][]byte
+	for _, pl := range pushDataCorpus {
+		out = append(out, append(header(PushData), []byte(pl)...))
+	}
+	return append(out, []byte{0x02, 0x00, 0x00, 0x00}, []byte{})
+}
+
+func pullDataSeeds() [][]byte {
+	return [][]byte{header(PullData), {0x01, 0x00, 0x00, 0x02}, {}}
+}
+
+func txACKSeeds() [][]byte {
+	var out [][]byte
+	for _, pl := range txACKCorpus {
+		out = append(out, append(header(TXACK), []byte(pl)...))
+	}
+	return append(out, []byte{0x02, 0x00, 0x00, 0x05}, []byte{})
+}
+
+func getPacketTypeSeeds() [][]byte {
+	return [][]byte{header(PushData), {0x02}}
+}
+
+func checkPushData(t *testing.T, data []byte) {
+	var p PushDataPacket
+	if err := p.UnmarshalBinary(data); err != nil {
+		return
+	}
+
+	if len(p.Payload.RXPK) > MaxRXPKCount {
+		t.Fatalf("expected max %d rxpk items, got %d", MaxRXPKCount, len(p.Payload.RXPK))
+	}
+
+	p.GetGatewayStats()
+	p.GetUplinkFrames(true, true)
+}
+
+func checkPullData(t *testing.T, data []byte) {
+	var p PullDataPacket
+	p.UnmarshalBinary(data)
+}
+
+func checkTXACK(t *testing.T, data []byte) {
+	var p TXACKPacket
+	p.UnmarshalBinary(data)
+}
+
+func checkGetPacketType(t *testing.T, data []byte) {
+	GetPacketType(data)
+}
+
+func TestFuzzSeeds(t *testing.T) {
+	tests := []struct {
+		name  string
+		seeds [][]byte
+		check func(*testing.T, []byte)
+	}{
+		{"PushData", pushDataSeeds(), checkPushData},
+		{"PullData", pullDataSeeds(), checkPullData},
+		{"TXACK", txACKSeeds(), checkTXACK},
+		{"GetPacketType", getPacketTypeSeeds(), checkGetPacketType},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			for _, seed := range tst.seeds {
+				tst.check(t, seed)
+			}
+		})
+	}
+}
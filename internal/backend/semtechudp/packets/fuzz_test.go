@@ -0,0 +1,36 @@
+//go:build go1.18
+// +build go1.18
+
+package packets
+
+import (
+	"testing"
+)
+
+func FuzzPushData(f *testing.F) {
+	for _, seed := range pushDataSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(checkPushData)
+}
+
+func FuzzPullData(f *testing.F) {
+	for _, seed := range pullDataSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(checkPullData)
+}
+
+func FuzzTXACK(f *testing.F) {
+	for _, seed := range txACKSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(checkTXACK)
+}
+
+func FuzzGetPacketType(f *testing.F) {
+	for _, seed := range getPacketTypeSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(checkGetPacketType)
+}
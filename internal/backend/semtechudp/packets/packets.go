@@ -28,6 +28,22 @@ const (
 	ProtocolVersion2 uint8 = 0x02
 )
 
+// Limits applied when decoding packets sent by the gateway.
+const (
+	// headerSize defines the size of the protocol version, random token,
+	// identifier and gateway MAC header.
+	headerSize = 12
+
+	// MaxRXPKCount defines the max. number of rxpk items in a PUSH_DATA packet.
+	MaxRXPKCount = 255
+
+	// MaxRSigCount defines the max. number of rsig items in a rxpk item.
+	MaxRSigCount = 16
+
+	// MaxPHYPayloadSize defines the max. size of the (decoded) rxpk data.
+	MaxPHYPayloadSize = 255
+)
+
 // Errors
 var (
 	ErrInvalidProtocolVersion = errors.New("gateway: invalid protocol version")
@@ -99,11 +115,13 @@ func (t *CompactTime) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// DatR implements the data rate which can be either a string (LoRa identifier)
-// or an unsigned integer in case of FSK (bits per second).
+// DatR implements the data rate which can be either a string (LoRa or
+// LR-FHSS identifier) or an unsigned integer in case of FSK (bits per
+// second).
 type DatR struct {
-	LoRa string
-	FSK  uint32
+	LoRa   string
+	FSK    uint32
+	LRFHSS string
 }
 
 // MarshalJSON implements the json.Marshaler interface.
@@ -111,6 +129,9 @@ func (d DatR) MarshalJSON() ([]byte, error) {
 	if d.LoRa != "" {
 		return []byte(`"` + d.LoRa + `"`), nil
 	}
+	if d.LRFHSS != "" {
+		return []byte(`"` + d.LRFHSS + `"`), nil
+	}
 	return []byte(strconv.FormatUint(uint64(d.FSK), 10)), nil
 }
 
@@ -118,7 +139,14 @@ func (d DatR) MarshalJSON() ([]byte, error) {
 func (d *DatR) UnmarshalJSON(data []byte) error {
 	i, err := strconv.ParseUint(string(data), 10, 32)
 	if err != nil {
-		d.LoRa = strings.Trim(string(data), `"`)
+		str := strings.Trim(string(data), `"`)
+
+		// LR-FHSS data-rates are identified as e.g. M0CW137
+		if strings.HasPrefix(str, "M0CW") {
+			d.LRFHSS = str
+		} else {
+			d.LoRa = str
+		}
 		return nil
 	}
 	d.FSK = uint32(i)
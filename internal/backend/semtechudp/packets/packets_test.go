@@ -23,6 +23,10 @@ func TestDatR(t *testing.T) {
 			DatR:   DatR{FSK: 50000},
 			String: "50000",
 		},
+		{
+			DatR:   DatR{LRFHSS: "M0CW137"},
+			String: `"M0CW137"`,
+		},
 	}
 
 	for _, test := range testTable {
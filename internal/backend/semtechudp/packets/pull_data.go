@@ -24,7 +24,7 @@ func (p PullDataPacket) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary decodes the object from binary form.
 func (p *PullDataPacket) UnmarshalBinary(data []byte) error {
-	if len(data) != 12 {
+	if len(data) != headerSize {
 		return errors.New("gateway: 12 bytes of data are expected")
 	}
 	if data[3] != byte(PullData) {
@@ -11,6 +11,7 @@ import (
 
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
 )
 
 // PullRespPacket is used by the server to send RF packets and associated
@@ -99,6 +100,11 @@ func GetPullRespPacket(protoVersion uint8, randomToken uint16, frame gw.Downlink
 		},
 	}
 
+	// the txpk does not define the LR-FHSS modulation parameters
+	if frame.TxInfo.Modulation == lrfhss.Modulation {
+		return packet, errors.New("gateway: LR-FHSS modulation is not supported for downlinks")
+	}
+
 	if frame.TxInfo.Modulation == common.Modulation_LORA {
 		modInfo := frame.TxInfo.GetLoraModulationInfo()
 		if modInfo == nil {
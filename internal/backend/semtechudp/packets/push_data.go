@@ -3,6 +3,7 @@ package packets
 import (
 	"encoding/binary"
 	"encoding/json"
+	"math"
 	"regexp"
 	"strconv"
 	"time"
@@ -13,12 +14,17 @@ import (
 
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
 	"github.com/brocaar/lorawan"
 )
 
 // loRaDataRateRegex contains a regexp for parsing the data-rate string.
 var loRaDataRateRegex = regexp.MustCompile(`SF(\d+)BW(\d+)`)
 
+// lrFHSSDataRateRegex contains a regexp for parsing the LR-FHSS data-rate
+// string.
+var lrFHSSDataRateRegex = regexp.MustCompile(`M0CW(\d+)`)
+
 // PushDataPacket type is used by the gateway mainly to forward the RF packets
 // received, and associated metadata, to the server.
 type PushDataPacket struct {
@@ -153,6 +159,10 @@ func setUplinkFrameRSig(frame gw.UplinkFrame, rxPK RXPK, rSig RSig) gw.UplinkFra
 }
 
 func getUplinkFrame(gatewayID []byte, rxpk RXPK, FakeRxInfoTime bool) (gw.UplinkFrame, error) {
+	if rxpk.Freq < 0 || rxpk.Freq*1000000 > math.MaxUint32 {
+		return gw.UplinkFrame{}, errors.Errorf("backend/semtechudp/packets: invalid frequency: %f", rxpk.Freq)
+	}
+
 	frame := gw.UplinkFrame{
 		PhyPayload: rxpk.Data,
 		TxInfo: &gw.UplinkTXInfo{
@@ -229,6 +239,28 @@ func getUplinkFrame(gatewayID []byte, rxpk RXPK, FakeRxInfoTime bool) (gw.Uplink
 		}
 	}
 
+	// LR-FHSS data-rate
+	if rxpk.DatR.LRFHSS != "" {
+		match := lrFHSSDataRateRegex.FindStringSubmatch(rxpk.DatR.LRFHSS)
+		// parse e.g. M0CW137 into the operating channel width (kHz)
+		if len(match) != 2 {
+			return frame, errors.New("backend/semtechudp/packets: could not parse LR-FHSS data-rate")
+		}
+
+		ocw, err := strconv.Atoi(match[1])
+		if err != nil {
+			return frame, errors.Wrap(err, "backend/semtechudp/packets: could not parse operating channel width to int")
+		}
+
+		if err := lrfhss.SetUplinkModulationInfo(frame.TxInfo, &lrfhss.ModulationInfo{
+			OperatingChannelWidth: uint32(ocw) * 1000,
+			CodeRate:              rxpk.CodR,
+			GridSteps:             uint32(rxpk.HPW),
+		}); err != nil {
+			return frame, errors.Wrap(err, "backend/semtechudp/packets: set LR-FHSS modulation info error")
+		}
+	}
+
 	// FSK data-rate
 	if rxpk.DatR.FSK != 0 {
 		frame.TxInfo.Modulation = common.Modulation_FSK
@@ -245,7 +277,7 @@ func getUplinkFrame(gatewayID []byte, rxpk RXPK, FakeRxInfoTime bool) (gw.Uplink
 
 // UnmarshalBinary decodes the packet from Semtech UDP binary form.
 func (p *PushDataPacket) UnmarshalBinary(data []byte) error {
-	if len(data) < 13 {
+	if len(data) < headerSize+1 {
 		return errors.New("backend/semtechudp/packets: at least 13 bytes are expected")
 	}
 	if data[3] != byte(PushData) {
@@ -262,7 +294,11 @@ func (p *PushDataPacket) UnmarshalBinary(data []byte) error {
 		p.GatewayMAC[i] = data[4+i]
 	}
 
-	return json.Unmarshal(data[12:], &p.Payload)
+	if err := json.Unmarshal(data[headerSize:], &p.Payload); err != nil {
+		return errors.Wrap(err, "backend/semtechudp/packets: unmarshal json error")
+	}
+
+	return p.Payload.validate()
 }
 
 // PushDataPayload represents the upstream JSON data structure.
@@ -271,6 +307,25 @@ type PushDataPayload struct {
 	Stat *Stat  `json:"stat,omitempty"`
 }
 
+// validate validates the bounds of the array fields.
+func (p PushDataPayload) validate() error {
+	if len(p.RXPK) > MaxRXPKCount {
+		return errors.Errorf("backend/semtechudp/packets: max %d rxpk items are expected", MaxRXPKCount)
+	}
+
+	for _, rxpk := range p.RXPK {
+		if len(rxpk.RSig) > MaxRSigCount {
+			return errors.Errorf("backend/semtechudp/packets: max %d rsig items are expected", MaxRSigCount)
+		}
+
+		if len(rxpk.Data) > MaxPHYPayloadSize {
+			return errors.Errorf("backend/semtechudp/packets: max %d bytes of rxpk data are expected", MaxPHYPayloadSize)
+		}
+	}
+
+	return nil
+}
+
 // Stat contains the status of the gateway.
 type Stat struct {
 	Time ExpandedTime `json:"time"` // UTC 'system' time of the gateway, ISO 8601 'expanded' format (e.g 2014-01-12 08:59:28 GMT)
@@ -299,11 +354,13 @@ type RXPK struct {
 	RSSI int16        `json:"rssi"` // RSSI in dBm (signed integer, 1 dB precision)
 	Size uint16       `json:"size"` // RF packet payload size in bytes (unsigned integer)
 	DatR DatR         `json:"datr"` // LoRa datarate identifier (eg. SF12BW500) || FSK datarate (unsigned, in bits per second)
-	Modu string       `json:"modu"` // Modulation identifier "LORA" or "FSK"
-	CodR string       `json:"codr"` // LoRa ECC coding rate identifier
+	Modu string       `json:"modu"` // Modulation identifier "LORA", "FSK" or "LR-FHSS"
+	CodR string       `json:"codr"` // LoRa / LR-FHSS ECC coding rate identifier
 	LSNR float64      `json:"lsnr"` // Lora SNR ratio in dB (signed float, 0.1 dB precision)
 	Data []byte       `json:"data"` // Base64 encoded RF packet payload, padded
 	RSig []RSig       `json:"rsig"` // Received signal information, per antenna (Optional)
+
+	HPW uint8 `json:"hpw,omitempty"` // LR-FHSS hopping grid number of steps (Optional)
 }
 
 // RSig contains the received signal information per antenna.
@@ -1,6 +1,8 @@
 package packets
 
 import (
+	"encoding/base64"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
 	"github.com/brocaar/lorawan"
 )
 
@@ -250,6 +253,56 @@ func TestGetUplinkFrame(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "2.4 ghz uplink",
+			PushDataPacket: PushDataPacket{
+				GatewayMAC:      lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+				ProtocolVersion: ProtocolVersion2,
+				Payload: PushDataPayload{
+					RXPK: []RXPK{
+						{
+							Time: &ctNow,
+							Tmst: 1000000,
+							Freq: 2403,
+							Chan: 0,
+							RFCh: 0,
+							Stat: 1,
+							Modu: "LORA",
+							DatR: DatR{LoRa: "SF12BW812"},
+							CodR: "4/8LI",
+							RSSI: -60,
+							LSNR: 5.5,
+							Size: 5,
+							Data: []byte{1, 2, 3, 4, 5},
+						},
+					},
+				},
+			},
+			UplinkFrames: []gw.UplinkFrame{
+				{
+					PhyPayload: []byte{1, 2, 3, 4, 5},
+					TxInfo: &gw.UplinkTXInfo{
+						Frequency:  2403000000,
+						Modulation: common.Modulation_LORA,
+						ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+							LoraModulationInfo: &gw.LoRaModulationInfo{
+								Bandwidth:       812,
+								SpreadingFactor: 12,
+								CodeRate:        "4/8LI",
+							},
+						},
+					},
+					RxInfo: &gw.UplinkRXInfo{
+						GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+						Time:      pbTime,
+						Rssi:      -60,
+						LoraSnr:   5.5,
+						Context:   []byte{0x00, 0x0f, 0x42, 0x40},
+						CrcStatus: gw.CRCStatus_CRC_OK,
+					},
+				},
+			},
+		},
 		{
 			Name: "uplink with gps time",
 			PushDataPacket: PushDataPacket{
@@ -434,3 +487,125 @@ func TestGetUplinkFrame(t *testing.T) {
 		})
 	}
 }
+
+func TestGetUplinkFrameLRFHSS(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now().Truncate(time.Second)
+	ctNow := CompactTime(now)
+
+	p := PushDataPacket{
+		GatewayMAC:      lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		ProtocolVersion: ProtocolVersion2,
+		Payload: PushDataPayload{
+			RXPK: []RXPK{
+				{
+					Time: &ctNow,
+					Tmst: 1000000,
+					Freq: 868.1,
+					Stat: 1,
+					Modu: "LR-FHSS",
+					DatR: DatR{LRFHSS: "M0CW137"},
+					CodR: "2/6",
+					HPW:  8,
+					RSSI: -60,
+					Size: 5,
+					Data: []byte{1, 2, 3, 4, 5},
+				},
+			},
+		},
+	}
+
+	f, err := p.GetUplinkFrames(false, false)
+	assert.NoError(err)
+	assert.Len(f, 1)
+
+	assert.Equal(uint32(868100000), f[0].TxInfo.Frequency)
+	assert.Equal(lrfhss.Modulation, f[0].TxInfo.Modulation)
+	assert.Nil(f[0].TxInfo.ModulationInfo)
+
+	info := lrfhss.GetUplinkModulationInfo(f[0].TxInfo)
+	assert.NotNil(info)
+	assert.Equal(uint32(137000), info.OperatingChannelWidth)
+	assert.Equal("2/6", info.CodeRate)
+	assert.Equal(uint32(8), info.GridSteps)
+}
+
+func TestPushDataPacketBounds(t *testing.T) {
+	h := []byte{2, 123, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	rxpk := func(n int, item string) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = item
+		}
+		return `{"rxpk":[` + strings.Join(items, ",") + `]}`
+	}
+
+	tests := []struct {
+		Name          string
+		Payload       string
+		ExpectedError string
+	}{
+		{
+			Name:          "header only",
+			Payload:       "",
+			ExpectedError: "backend/semtechudp/packets: at least 13 bytes are expected",
+		},
+		{
+			Name:          "invalid json",
+			Payload:       `{"rxpk":[`,
+			ExpectedError: "backend/semtechudp/packets: unmarshal json error: unexpected end of JSON input",
+		},
+		{
+			Name:    "max rxpk items",
+			Payload: rxpk(MaxRXPKCount, `{}`),
+		},
+		{
+			Name:          "too many rxpk items",
+			Payload:       rxpk(MaxRXPKCount+1, `{}`),
+			ExpectedError: "backend/semtechudp/packets: max 255 rxpk items are expected",
+		},
+		{
+			Name:          "too many rsig items",
+			Payload:       rxpk(1, `{"rsig":[`+strings.Repeat(`{},`, MaxRSigCount)+`{}]}`),
+			ExpectedError: "backend/semtechudp/packets: max 16 rsig items are expected",
+		},
+		{
+			Name:          "rxpk data too large",
+			Payload:       rxpk(1, `{"data":"`+base64.StdEncoding.EncodeToString(make([]byte, MaxPHYPayloadSize+1))+`"}`),
+			ExpectedError: "backend/semtechudp/packets: max 255 bytes of rxpk data are expected",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var p PushDataPacket
+			err := p.UnmarshalBinary(append(h, []byte(tst.Payload)...))
+			if tst.ExpectedError != "" {
+				assert.EqualError(err, tst.ExpectedError)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestGetUplinkFramesInvalidFrequency(t *testing.T) {
+	assert := require.New(t)
+
+	for _, freq := range []float64{-868.1, 4295} {
+		p := PushDataPacket{
+			Payload: PushDataPayload{
+				RXPK: []RXPK{
+					{Stat: 1, Freq: freq, DatR: DatR{LoRa: "SF7BW125"}},
+				},
+			},
+		}
+
+		_, err := p.GetUplinkFrames(false, false)
+		assert.Error(err)
+	}
+}
@@ -40,7 +40,7 @@ func (p TXACKPacket) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary decodes the object from binary form.
 func (p *TXACKPacket) UnmarshalBinary(data []byte) error {
-	if len(data) < 12 {
+	if len(data) < headerSize {
 		return errors.New("gateway: at least 12 bytes of data are expected")
 	}
 	if data[3] != byte(TXACK) {
@@ -54,9 +54,9 @@ func (p *TXACKPacket) UnmarshalBinary(data []byte) error {
 	for i := 0; i < 8; i++ {
 		p.GatewayMAC[i] = data[4+i]
 	}
-	if len(data) > 13 { // the min payload + the length of at least "{}"
+	if len(data) > headerSize+1 { // the min payload + the length of at least "{}"
 		p.Payload = &TXACKPayload{}
-		return json.Unmarshal(data[12:], p.Payload)
+		return json.Unmarshal(data[headerSize:], p.Payload)
 	}
 	return nil
 }
@@ -2,10 +2,14 @@ package semtechudp
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/lorawan"
 )
@@ -21,11 +25,30 @@ var gatewayCleanupDuration = -1 * time.Minute
 
 // gateway contains a connection and meta-data for a gateway connection.
 type gateway struct {
+	conn            packetConn
 	addr            *net.UDPAddr
 	lastSeen        time.Time
+	connectTime     time.Time
 	protocolVersion uint8
 }
 
+// connState returns the connection state details of the gateway.
+func (g gateway) connState() *events.ConnState {
+	connectTime, _ := ptypes.TimestampProto(g.connectTime)
+
+	cs := events.ConnState{
+		BackendType:     "semtech_udp",
+		ProtocolVersion: strconv.FormatUint(uint64(g.protocolVersion), 10),
+		ConnectTime:     connectTime,
+	}
+
+	if g.addr != nil {
+		cs.RemoteAddress = g.addr.String()
+	}
+
+	return &cs
+}
+
 // gateways contains the gateways registry.
 type gateways struct {
 	sync.RWMutex
@@ -55,12 +78,21 @@ func (c *gateways) set(gatewayID lorawan.EUI64, gw gateway) error {
 	c.Lock()
 	defer c.Unlock()
 
-	_, ok := c.gateways[gatewayID]
+	subscribe := events.Subscribe{Subscribe: true, GatewayID: gatewayID}
+
+	existing, ok := c.gateways[gatewayID]
 	if !ok {
 		connectCounter().Inc()
+
+		if gw.connectTime.IsZero() {
+			gw.connectTime = gw.lastSeen
+		}
+		subscribe.ConnState = gw.connState()
+	} else {
+		gw.connectTime = existing.connectTime
 	}
 
-	c.subscribeEventChan <- events.Subscribe{Subscribe: true, GatewayID: gatewayID}
+	c.subscribeEventChan <- subscribe
 	c.gateways[gatewayID] = gw
 	return nil
 }
@@ -73,7 +105,11 @@ func (c *gateways) cleanup() error {
 	for gatewayID := range c.gateways {
 		if c.gateways[gatewayID].lastSeen.Before(time.Now().Add(gatewayCleanupDuration)) {
 			disconnectCounter().Inc()
-			c.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: gatewayID}
+
+			connState := c.gateways[gatewayID].connState()
+			connState.Reason = fmt.Sprintf("keepalive timeout (no PULL_DATA received within %s)", -gatewayCleanupDuration)
+
+			c.subscribeEventChan <- events.Subscribe{Subscribe: false, GatewayID: gatewayID, ConnState: connState}
 			delete(c.gateways, gatewayID)
 		}
 	}
@@ -0,0 +1,100 @@
+package semtechudp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/lorawan"
+)
+
+func TestGatewaysConnState(t *testing.T) {
+	assert := require.New(t)
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	addr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 54321}
+	connectTime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	connectTimeProto, _ := ptypes.TimestampProto(connectTime)
+
+	reg := gateways{
+		gateways:           make(map[lorawan.EUI64]gateway),
+		subscribeEventChan: make(chan events.Subscribe, 1),
+	}
+
+	// new gateway
+	assert.NoError(reg.set(gatewayID, gateway{
+		addr:            addr,
+		lastSeen:        connectTime,
+		protocolVersion: 2,
+	}))
+	assert.Equal(events.Subscribe{
+		Subscribe: true,
+		GatewayID: gatewayID,
+		ConnState: &events.ConnState{
+			BackendType:     "semtech_udp",
+			RemoteAddress:   "192.168.1.10:54321",
+			ProtocolVersion: "2",
+			ConnectTime:     connectTimeProto,
+		},
+	}, <-reg.subscribeEventChan)
+
+	// keepalive of the connected gateway does not change the conn state
+	assert.NoError(reg.set(gatewayID, gateway{
+		addr:            addr,
+		lastSeen:        connectTime.Add(time.Second * 10),
+		protocolVersion: 2,
+	}))
+	assert.Equal(events.Subscribe{
+		Subscribe: true,
+		GatewayID: gatewayID,
+	}, <-reg.subscribeEventChan)
+
+	gw, err := reg.get(gatewayID)
+	assert.NoError(err)
+	assert.Equal(connectTime, gw.connectTime)
+
+	// keepalive timeout
+	assert.NoError(reg.cleanup())
+	e := <-reg.subscribeEventChan
+	assert.Equal(events.Subscribe{
+		Subscribe: false,
+		GatewayID: gatewayID,
+		ConnState: &events.ConnState{
+			BackendType:     "semtech_udp",
+			RemoteAddress:   "192.168.1.10:54321",
+			ProtocolVersion: "2",
+			ConnectTime:     connectTimeProto,
+			Reason:          "keepalive timeout (no PULL_DATA received within 1m0s)",
+		},
+	}, e)
+
+	_, err = reg.get(gatewayID)
+	assert.Equal(errGatewayDoesNotExist, err)
+
+	t.Run("marshal", func(t *testing.T) {
+		assert := require.New(t)
+
+		connState := *e.ConnState
+		connState.GatewayId = gatewayID[:]
+		connState.State = events.ConnStateOffline
+
+		// json
+		str, err := (&jsonpb.Marshaler{}).MarshalToString(&connState)
+		assert.NoError(err)
+		assert.Equal(`{"gatewayID":"AQIDBAUGBwg=","state":"OFFLINE","backendType":"semtech_udp","remoteAddress":"192.168.1.10:54321","protocolVersion":"2","connectTime":"2020-01-01T12:00:00Z","reason":"keepalive timeout (no PULL_DATA received within 1m0s)"}`, str)
+
+		// protobuf
+		b, err := proto.Marshal(&connState)
+		assert.NoError(err)
+
+		var decoded events.ConnState
+		assert.NoError(proto.Unmarshal(b, &decoded))
+		assert.True(proto.Equal(&connState, &decoded))
+	})
+}
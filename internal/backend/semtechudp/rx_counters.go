@@ -0,0 +1,102 @@
+package semtechudp
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// rxCountersCleanupDuration contains the duration after which the counters
+// of a gateway are removed when no uplink or stats have been received.
+var rxCountersCleanupDuration = time.Hour
+
+// rxCounter contains the uplink counters of a single gateway since the last
+// stats.
+type rxCounter struct {
+	lastSeen        time.Time
+	frequency       map[uint32]uint32
+	spreadingFactor map[uint32]uint32
+}
+
+// rxCounters counts, per gateway, the received uplinks per frequency and per
+// spreading factor since the last stats.
+type rxCounters struct {
+	sync.Mutex
+	gateways map[lorawan.EUI64]*rxCounter
+}
+
+func newRXCounters() *rxCounters {
+	return &rxCounters{
+		gateways: make(map[lorawan.EUI64]*rxCounter),
+	}
+}
+
+// add counts the given uplink frame.
+func (c *rxCounters) add(uplinkFrame gw.UplinkFrame, now time.Time) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], uplinkFrame.GetRxInfo().GetGatewayId())
+
+	c.Lock()
+	defer c.Unlock()
+
+	counter := c.get(gatewayID, now)
+	counter.frequency[uplinkFrame.GetTxInfo().GetFrequency()]++
+	if modInfo := uplinkFrame.GetTxInfo().GetLoraModulationInfo(); modInfo != nil {
+		counter.spreadingFactor[modInfo.GetSpreadingFactor()]++
+	}
+}
+
+// flush returns the counters of the given gateway as meta-data and resets
+// the counters.
+func (c *rxCounters) flush(gatewayID lorawan.EUI64, now time.Time) map[string]string {
+	c.Lock()
+	defer c.Unlock()
+
+	counter := c.get(gatewayID, now)
+	out := make(map[string]string)
+
+	for freq, count := range counter.frequency {
+		out[fmt.Sprintf("rx_count_%d", freq)] = strconv.FormatUint(uint64(count), 10)
+	}
+	for sf, count := range counter.spreadingFactor {
+		out[fmt.Sprintf("rx_count_sf%d", sf)] = strconv.FormatUint(uint64(count), 10)
+	}
+
+	counter.frequency = make(map[uint32]uint32)
+	counter.spreadingFactor = make(map[uint32]uint32)
+
+	return out
+}
+
+// cleanup removes the counters of the gateways which have not been seen
+// within the cleanup duration.
+func (c *rxCounters) cleanup(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	for gatewayID, counter := range c.gateways {
+		if now.Sub(counter.lastSeen) > rxCountersCleanupDuration {
+			delete(c.gateways, gatewayID)
+		}
+	}
+}
+
+// get returns the counter of the given gateway, creating it when it does
+// not exist. This must be called with the lock held.
+func (c *rxCounters) get(gatewayID lorawan.EUI64, now time.Time) *rxCounter {
+	counter, ok := c.gateways[gatewayID]
+	if !ok {
+		counter = &rxCounter{
+			frequency:       make(map[uint32]uint32),
+			spreadingFactor: make(map[uint32]uint32),
+		}
+		c.gateways[gatewayID] = counter
+	}
+	counter.lastSeen = now
+
+	return counter
+}
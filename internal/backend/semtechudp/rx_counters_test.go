@@ -0,0 +1,35 @@
+package semtechudp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestRXCountersCleanup(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	c := newRXCounters()
+
+	for i, gatewayID := range []lorawan.EUI64{{1}, {2}} {
+		c.add(gw.UplinkFrame{
+			TxInfo: &gw.UplinkTXInfo{
+				Frequency: 868100000,
+			},
+			RxInfo: &gw.UplinkRXInfo{
+				GatewayId: gatewayID[:],
+			},
+		}, now.Add(time.Duration(i)*time.Hour))
+	}
+
+	c.cleanup(now.Add(90 * time.Minute))
+	assert.Len(c.gateways, 1)
+
+	_, ok := c.gateways[lorawan.EUI64{2}]
+	assert.True(ok)
+}
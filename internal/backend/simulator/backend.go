@@ -0,0 +1,384 @@
+// Package simulator implements a backend which simulates gateways. It
+// synthesizes uplink and stats events for a configurable number of virtual
+// gateways and acknowledges the downlinks, such that the MQTT broker and the
+// ChirpStack pipeline can be load-tested without gateway hardware.
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/buffer"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// virtualGateway contains the state of a simulated gateway.
+type virtualGateway struct {
+	gatewayID lorawan.EUI64
+	devAddr   lorawan.DevAddr
+	fCnt      uint32
+	started   time.Time
+
+	// counters since the previous stats
+	rxReceived uint32
+	txReceived uint32
+	txEmitted  uint32
+}
+
+// Backend implements a simulator backend.
+type Backend struct {
+	sync.Mutex
+
+	uplinkInterval   time.Duration
+	statsInterval    time.Duration
+	payloadSize      int
+	frequencies      []int
+	spreadingFactors []int
+	bandwidth        int
+
+	gateways map[lorawan.EUI64]*virtualGateway
+	closed   chan struct{}
+
+	downlinkTXAckChan  chan gw.DownlinkTXAck
+	uplinkFrameChan    chan gw.UplinkFrame
+	gatewayStatsChan   chan gw.GatewayStats
+	subscribeEventChan chan events.Subscribe
+	sender             *buffer.Sender
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	b, err := newBackend(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"gateways":        len(b.gateways),
+		"uplink_interval": b.uplinkInterval,
+		"stats_interval":  b.statsInterval,
+	}).Warning("backend/simulator: simulating gateways, do not use this backend in production")
+
+	// the gateways are started in the background, as the subscribe
+	// event channel is not yet consumed during the setup
+	go b.start()
+
+	return b, nil
+}
+
+func newBackend(conf config.Config) (*Backend, error) {
+	sim := conf.Backend.Simulator
+
+	var baseID lorawan.EUI64
+	if err := baseID.UnmarshalText([]byte(sim.BaseGatewayID)); err != nil {
+		return nil, errors.Wrap(err, "decode base_gateway_id error")
+	}
+
+	b := Backend{
+		uplinkInterval:   sim.UplinkInterval,
+		statsInterval:    sim.StatsInterval,
+		payloadSize:      sim.PayloadSize,
+		frequencies:      sim.Frequencies,
+		spreadingFactors: sim.SpreadingFactors,
+		bandwidth:        sim.Bandwidth,
+
+		gateways: make(map[lorawan.EUI64]*virtualGateway),
+		closed:   make(chan struct{}),
+
+		downlinkTXAckChan:  make(chan gw.DownlinkTXAck, conf.Backend.Channels.DownlinkTXAckSize),
+		uplinkFrameChan:    make(chan gw.UplinkFrame, conf.Backend.Channels.UplinkFrameSize),
+		gatewayStatsChan:   make(chan gw.GatewayStats, conf.Backend.Channels.GatewayStatsSize),
+		subscribeEventChan: make(chan events.Subscribe),
+		sender:             buffer.NewSender("simulator", conf),
+	}
+
+	base := binary.BigEndian.Uint64(baseID[:])
+	for i := 0; i < sim.Gateways; i++ {
+		var vg virtualGateway
+		binary.BigEndian.PutUint64(vg.gatewayID[:], base+uint64(i))
+		binary.BigEndian.PutUint32(vg.devAddr[:], uint32(i))
+		b.gateways[vg.gatewayID] = &vg
+	}
+
+	return &b, nil
+}
+
+// Close stops the simulated gateways.
+func (b *Backend) Close() error {
+	close(b.closed)
+	return nil
+}
+
+// GetDownlinkTXAckChan returns the channel for downlink tx acknowledgements.
+func (b *Backend) GetDownlinkTXAckChan() chan gw.DownlinkTXAck {
+	return b.downlinkTXAckChan
+}
+
+// GetGatewayStatsChan returns the channel for gateway statistics.
+func (b *Backend) GetGatewayStatsChan() chan gw.GatewayStats {
+	return b.gatewayStatsChan
+}
+
+// GetUplinkFrameChan returns the channel for received uplinks.
+func (b *Backend) GetUplinkFrameChan() chan gw.UplinkFrame {
+	return b.uplinkFrameChan
+}
+
+// GetSubscribeEventChan returns the channel for the (un)subscribe events.
+func (b *Backend) GetSubscribeEventChan() chan events.Subscribe {
+	return b.subscribeEventChan
+}
+
+// GetRawPacketForwarderEventChan returns the raw packet-forwarder command channel.
+func (b *Backend) GetRawPacketForwarderEventChan() chan gw.RawPacketForwarderEvent {
+	// not provided by the simulator.
+	return nil
+}
+
+// GetLogEventChan returns the gateway log event channel.
+func (b *Backend) GetLogEventChan() chan events.Log {
+	// not provided by the simulator.
+	return nil
+}
+
+// SendDownlinkFrame acknowledges the given downlink frame. The downlink is
+// not transmitted.
+func (b *Backend) SendDownlinkFrame(frame gw.DownlinkFrame) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], frame.GetTxInfo().GetGatewayId())
+
+	b.Lock()
+	vg, ok := b.gateways[gatewayID]
+	if ok {
+		vg.txReceived++
+		vg.txEmitted++
+	}
+	b.Unlock()
+
+	if !ok {
+		return errors.Errorf("gateway %s is not simulated", gatewayID)
+	}
+
+	commandCounter("down").Inc()
+
+	b.sender.DownlinkTXAck(b.downlinkTXAckChan, gw.DownlinkTXAck{
+		GatewayId:  gatewayID[:],
+		Token:      frame.Token,
+		DownlinkId: frame.DownlinkId,
+	})
+
+	return nil
+}
+
+// ApplyConfiguration is not supported by the simulator.
+func (b *Backend) ApplyConfiguration(gw.GatewayConfiguration) error {
+	return errors.New("gateway configuration not implemented by simulator")
+}
+
+// RawPacketForwarderCommand is not supported by the simulator.
+func (b *Backend) RawPacketForwarderCommand(gw.RawPacketForwarderCommand) error {
+	return errors.New("raw packet-forwarder command not implemented by simulator")
+}
+
+// start connects the simulated gateways and starts the uplink and stats
+// loop of each gateway. The start of the gateways is spread over the uplink
+// interval.
+func (b *Backend) start() {
+	var i int
+	for gatewayID := range b.gateways {
+		b.connect(gatewayID)
+
+		offset := b.uplinkInterval * time.Duration(i) / time.Duration(len(b.gateways))
+		go b.gatewayLoop(gatewayID, offset)
+		i++
+	}
+}
+
+// connect sends the subscribe event for the given gateway.
+func (b *Backend) connect(gatewayID lorawan.EUI64) {
+	now := time.Now()
+	connectTime, _ := ptypes.TimestampProto(now)
+
+	b.Lock()
+	b.gateways[gatewayID].started = now
+	b.Unlock()
+
+	b.subscribeEventChan <- events.Subscribe{
+		Subscribe: true,
+		GatewayID: gatewayID,
+		ConnState: &events.ConnState{
+			BackendType: "simulator",
+			ConnectTime: connectTime,
+		},
+	}
+}
+
+// gatewayLoop generates the uplinks and stats of the given gateway until
+// the backend is closed.
+func (b *Backend) gatewayLoop(gatewayID lorawan.EUI64, offset time.Duration) {
+	select {
+	case <-time.After(offset):
+	case <-b.closed:
+		return
+	}
+
+	uplinkTicker := time.NewTicker(b.uplinkInterval)
+	defer uplinkTicker.Stop()
+	statsTicker := time.NewTicker(b.statsInterval)
+	defer statsTicker.Stop()
+
+	for {
+		select {
+		case <-uplinkTicker.C:
+			uplinkFrame, err := b.generateUplink(gatewayID, time.Now())
+			if err != nil {
+				log.WithError(err).WithField("gateway_id", gatewayID).Error("backend/simulator: generate uplink error")
+				continue
+			}
+			eventCounter("up").Inc()
+			b.sender.UplinkFrame(b.uplinkFrameChan, uplinkFrame)
+		case <-statsTicker.C:
+			stats, err := b.generateStats(gatewayID, time.Now())
+			if err != nil {
+				log.WithError(err).WithField("gateway_id", gatewayID).Error("backend/simulator: generate stats error")
+				continue
+			}
+			eventCounter("stats").Inc()
+			b.sender.GatewayStats(b.gatewayStatsChan, stats)
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+// generateUplink generates an unconfirmed data-up uplink for the given
+// gateway, using a random frequency, spreading-factor, RSSI and SNR.
+func (b *Backend) generateUplink(gatewayID lorawan.EUI64, now time.Time) (gw.UplinkFrame, error) {
+	b.Lock()
+	vg := b.gateways[gatewayID]
+	vg.rxReceived++
+	vg.fCnt++
+	devAddr := vg.devAddr
+	fCnt := vg.fCnt
+	started := vg.started
+	b.Unlock()
+
+	frmPayload := make([]byte, b.payloadSize)
+	if _, err := rand.Read(frmPayload); err != nil {
+		return gw.UplinkFrame{}, errors.Wrap(err, "read random bytes error")
+	}
+
+	fPort := uint8(1)
+	phy := lorawan.PHYPayload{
+		MHDR: lorawan.MHDR{
+			MType: lorawan.UnconfirmedDataUp,
+			Major: lorawan.LoRaWANR1,
+		},
+		MACPayload: &lorawan.MACPayload{
+			FHDR: lorawan.FHDR{
+				DevAddr: devAddr,
+				FCnt:    fCnt,
+			},
+			FPort:      &fPort,
+			FRMPayload: []lorawan.Payload{&lorawan.DataPayload{Bytes: frmPayload}},
+		},
+	}
+	// the MIC is random, as the simulated devices have no session keys
+	if _, err := rand.Read(phy.MIC[:]); err != nil {
+		return gw.UplinkFrame{}, errors.Wrap(err, "read random bytes error")
+	}
+
+	phyB, err := phy.MarshalBinary()
+	if err != nil {
+		return gw.UplinkFrame{}, errors.Wrap(err, "marshal phypayload error")
+	}
+
+	uplinkID, err := uuid.NewV4()
+	if err != nil {
+		return gw.UplinkFrame{}, errors.Wrap(err, "new uuid error")
+	}
+
+	// the context contains the 32 bit concentrator counter, like the
+	// Semtech UDP tmst
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, uint32(now.Sub(started)/time.Microsecond))
+
+	channel := randomInt(len(b.frequencies))
+
+	return gw.UplinkFrame{
+		PhyPayload: phyB,
+		TxInfo: &gw.UplinkTXInfo{
+			Frequency:  uint32(b.frequencies[channel]),
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:       uint32(b.bandwidth),
+					SpreadingFactor: uint32(b.spreadingFactors[randomInt(len(b.spreadingFactors))]),
+					CodeRate:        "4/5",
+				},
+			},
+		},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId: gatewayID[:],
+			Rssi:      int32(-120 + randomInt(80)),
+			LoraSnr:   float64(-20+randomInt(30)) + 0.5,
+			Channel:   uint32(channel),
+			Context:   counter,
+			UplinkId:  uplinkID[:],
+			CrcStatus: gw.CRCStatus_CRC_OK,
+		},
+	}, nil
+}
+
+// generateStats generates the stats of the given gateway and resets the
+// counters.
+func (b *Backend) generateStats(gatewayID lorawan.EUI64, now time.Time) (gw.GatewayStats, error) {
+	statsID, err := uuid.NewV4()
+	if err != nil {
+		return gw.GatewayStats{}, errors.Wrap(err, "new uuid error")
+	}
+
+	ts, err := ptypes.TimestampProto(now)
+	if err != nil {
+		return gw.GatewayStats{}, errors.Wrap(err, "timestamp proto error")
+	}
+
+	b.Lock()
+	vg := b.gateways[gatewayID]
+	stats := gw.GatewayStats{
+		GatewayId:           gatewayID[:],
+		Time:                ts,
+		StatsId:             statsID[:],
+		RxPacketsReceived:   vg.rxReceived,
+		RxPacketsReceivedOk: vg.rxReceived,
+		TxPacketsReceived:   vg.txReceived,
+		TxPacketsEmitted:    vg.txEmitted,
+	}
+	vg.rxReceived = 0
+	vg.txReceived = 0
+	vg.txEmitted = 0
+	b.Unlock()
+
+	return stats, nil
+}
+
+// randomInt returns a random int in the range [0, max).
+func randomInt(max int) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0
+	}
+	return int(n.Int64())
+}
@@ -0,0 +1,131 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type BackendTestSuite struct {
+	suite.Suite
+
+	backend *Backend
+}
+
+func (ts *BackendTestSuite) SetupTest() {
+	assert := require.New(ts.T())
+
+	var conf config.Config
+	conf.Backend.Simulator.Gateways = 2
+	conf.Backend.Simulator.BaseGatewayID = "0102030405060708"
+	conf.Backend.Simulator.UplinkInterval = 10 * time.Millisecond
+	conf.Backend.Simulator.StatsInterval = 50 * time.Millisecond
+	conf.Backend.Simulator.PayloadSize = 12
+	conf.Backend.Simulator.Frequencies = []int{868100000}
+	conf.Backend.Simulator.SpreadingFactors = []int{9}
+	conf.Backend.Simulator.Bandwidth = 125
+	conf.Backend.Channels.DownlinkTXAckSize = 1
+
+	var err error
+	ts.backend, err = newBackend(conf)
+	assert.NoError(err)
+}
+
+func (ts *BackendTestSuite) TearDownTest() {
+	ts.backend.Close()
+}
+
+func (ts *BackendTestSuite) TestGateways() {
+	assert := require.New(ts.T())
+
+	go ts.backend.start()
+
+	gateways := make(map[lorawan.EUI64]bool)
+	for i := 0; i < 2; i++ {
+		sub := <-ts.backend.GetSubscribeEventChan()
+		assert.True(sub.Subscribe)
+		assert.Equal("simulator", sub.ConnState.BackendType)
+		gateways[sub.GatewayID] = true
+	}
+	assert.Equal(map[lorawan.EUI64]bool{
+		{1, 2, 3, 4, 5, 6, 7, 8}: true,
+		{1, 2, 3, 4, 5, 6, 7, 9}: true,
+	}, gateways)
+
+	ts.T().Run("Uplink", func(t *testing.T) {
+		assert := require.New(t)
+
+		uplinkFrame := <-ts.backend.GetUplinkFrameChan()
+		assert.EqualValues(868100000, uplinkFrame.TxInfo.Frequency)
+		assert.EqualValues(9, uplinkFrame.TxInfo.GetLoraModulationInfo().SpreadingFactor)
+		assert.Len(uplinkFrame.RxInfo.Context, 4)
+
+		var phy lorawan.PHYPayload
+		assert.NoError(phy.UnmarshalBinary(uplinkFrame.PhyPayload))
+		assert.Equal(lorawan.UnconfirmedDataUp, phy.MHDR.MType)
+		assert.Len(uplinkFrame.PhyPayload, 12+13)
+	})
+
+	ts.T().Run("Stats", func(t *testing.T) {
+		assert := require.New(t)
+
+		// the uplinks must be consumed, as the (unbuffered) uplink channel
+		// blocks the gateway loop
+		for {
+			select {
+			case <-ts.backend.GetUplinkFrameChan():
+				continue
+			case stats := <-ts.backend.GetGatewayStatsChan():
+				assert.True(stats.RxPacketsReceived > 0)
+				assert.Equal(stats.RxPacketsReceived, stats.RxPacketsReceivedOk)
+			}
+			break
+		}
+	})
+}
+
+func (ts *BackendTestSuite) TestDownlink() {
+	ts.T().Run("Simulated gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 9}
+		assert.NoError(ts.backend.SendDownlinkFrame(gw.DownlinkFrame{
+			Token:      123,
+			DownlinkId: []byte{1, 2, 3},
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID[:],
+			},
+		}))
+
+		assert.Equal(gw.DownlinkTXAck{
+			GatewayId:  gatewayID[:],
+			Token:      123,
+			DownlinkId: []byte{1, 2, 3},
+		}, <-ts.backend.GetDownlinkTXAckChan())
+
+		stats, err := ts.backend.generateStats(gatewayID, time.Now())
+		assert.NoError(err)
+		assert.EqualValues(1, stats.TxPacketsReceived)
+		assert.EqualValues(1, stats.TxPacketsEmitted)
+	})
+
+	ts.T().Run("Unknown gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.Error(ts.backend.SendDownlinkFrame(gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: []byte{8, 7, 6, 5, 4, 3, 2, 1},
+			},
+		}))
+	})
+}
+
+func TestBackend(t *testing.T) {
+	suite.Run(t, new(BackendTestSuite))
+}
@@ -0,0 +1,26 @@
+package simulator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_simulator_event_count",
+		Help: "The number of generated events (per type)",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_simulator_command_count",
+		Help: "The number of received commands (per type)",
+	}, []string{"command"})
+)
+
+func eventCounter(event string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": event})
+}
+
+func commandCounter(command string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": command})
+}
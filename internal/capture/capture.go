@@ -0,0 +1,300 @@
+// Package capture implements the frame capture, which writes the uplink and
+// downlink frames (including the meta-data) to a rotating on-disk ring
+// buffer for debugging RF issues after the fact.
+//
+// The frames are written as JSON lines (one record per line) to the
+// frames.jsonl file within the configured directory. When this file contains
+// the max. number of frames, it is rotated to frames.jsonl.1 (the existing
+// frames.jsonl.1 to frames.jsonl.2 and so on) and the oldest file is removed.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// Command is the name of the built-in gateway command which returns the
+// captured frames.
+const Command = "capture_dump"
+
+// fileName defines the name of the file to which the frames are written.
+const fileName = "frames.jsonl"
+
+// Record types.
+const (
+	TypeUplink        = "up"
+	TypeDownlink      = "down"
+	TypeDownlinkTXAck = "ack"
+)
+
+// Record defines the capture record format.
+type Record struct {
+	Time      time.Time       `json:"time"`
+	Type      string          `json:"type"`
+	GatewayID lorawan.EUI64   `json:"gateway_id"`
+	Frame     json.RawMessage `json:"frame"`
+}
+
+var (
+	mux sync.Mutex
+
+	buffer *ringBuffer
+)
+
+// Setup configures the frame capture.
+func Setup(conf config.Config) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if conf.Capture.Path == "" {
+		return nil
+	}
+
+	b, err := newRingBuffer(conf.Capture.Path, conf.Capture.FileMaxFrames, conf.Capture.MaxFiles)
+	if err != nil {
+		return errors.Wrap(err, "open capture ring buffer error")
+	}
+	buffer = b
+
+	log.WithFields(log.Fields{
+		"path":            conf.Capture.Path,
+		"file_max_frames": conf.Capture.FileMaxFrames,
+		"max_files":       conf.Capture.MaxFiles,
+	}).Info("capture: frame capture enabled")
+
+	return nil
+}
+
+// Enabled returns true when the frame capture is enabled.
+func Enabled() bool {
+	mux.Lock()
+	defer mux.Unlock()
+
+	return buffer != nil
+}
+
+// Uplink captures the given uplink frame.
+func Uplink(uplinkFrame gw.UplinkFrame) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], uplinkFrame.GetRxInfo().GetGatewayId())
+	write(TypeUplink, gatewayID, &uplinkFrame)
+}
+
+// Downlink captures the given downlink frame.
+func Downlink(downlinkFrame gw.DownlinkFrame) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	write(TypeDownlink, gatewayID, &downlinkFrame)
+}
+
+// DownlinkTXAck captures the given downlink TX acknowledgement.
+func DownlinkTXAck(txAck gw.DownlinkTXAck) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], txAck.GetGatewayId())
+	write(TypeDownlinkTXAck, gatewayID, &txAck)
+}
+
+// Dump writes the captured records, oldest first, to the given writer.
+func Dump(w io.Writer) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if buffer == nil {
+		return errors.New("frame capture is not enabled")
+	}
+
+	return buffer.dump(w)
+}
+
+// DumpPath writes the records captured in the given directory, oldest first,
+// to the given writer. Unlike Dump, this does not require the frame capture
+// to be set up, e.g. to read the captured frames while the bridge is not
+// running.
+func DumpPath(path string, maxFiles int, w io.Writer) error {
+	b := ringBuffer{
+		path:     path,
+		maxFiles: maxFiles,
+	}
+	return b.dump(w)
+}
+
+func write(typ string, gatewayID lorawan.EUI64, msg proto.Message) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if buffer == nil {
+		return
+	}
+
+	m := jsonpb.Marshaler{
+		EmitDefaults: true,
+	}
+	frame, err := m.MarshalToString(msg)
+	if err != nil {
+		log.WithError(err).Error("capture: marshal frame error")
+		return
+	}
+
+	b, err := json.Marshal(Record{
+		Time:      time.Now(),
+		Type:      typ,
+		GatewayID: gatewayID,
+		Frame:     json.RawMessage(frame),
+	})
+	if err != nil {
+		log.WithError(err).Error("capture: marshal record error")
+		return
+	}
+
+	if err := buffer.write(b); err != nil {
+		log.WithError(err).Error("capture: write record error")
+	}
+}
+
+// ringBuffer implements the rotating on-disk ring buffer.
+type ringBuffer struct {
+	path          string
+	fileMaxFrames int
+	maxFiles      int
+
+	f     *os.File
+	count int
+}
+
+func newRingBuffer(path string, fileMaxFrames, maxFiles int) (*ringBuffer, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, errors.Wrap(err, "create directory error")
+	}
+
+	b := ringBuffer{
+		path:          path,
+		fileMaxFrames: fileMaxFrames,
+		maxFiles:      maxFiles,
+	}
+
+	// continue with the existing file (e.g. after a restart)
+	count, err := countLines(b.fileName(0))
+	if err != nil {
+		return nil, errors.Wrap(err, "read capture file error")
+	}
+	b.count = count
+
+	if err := b.open(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// fileName returns the name of the n-th file, 0 being the file to which
+// the frames are written.
+func (b *ringBuffer) fileName(n int) string {
+	if n == 0 {
+		return filepath.Join(b.path, fileName)
+	}
+	return filepath.Join(b.path, fmt.Sprintf("%s.%d", fileName, n))
+}
+
+func (b *ringBuffer) open() error {
+	f, err := os.OpenFile(b.fileName(0), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open capture file error")
+	}
+	b.f = f
+	return nil
+}
+
+func (b *ringBuffer) write(record []byte) error {
+	if b.count >= b.fileMaxFrames {
+		if err := b.rotate(); err != nil {
+			return errors.Wrap(err, "rotate capture file error")
+		}
+	}
+
+	if _, err := b.f.Write(append(record, '\n')); err != nil {
+		return err
+	}
+	b.count++
+
+	return nil
+}
+
+func (b *ringBuffer) rotate() error {
+	if err := b.f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(b.fileName(b.maxFiles - 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for n := b.maxFiles - 2; n >= 0; n-- {
+		if err := os.Rename(b.fileName(n), b.fileName(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	b.count = 0
+	return b.open()
+}
+
+func (b *ringBuffer) dump(w io.Writer) error {
+	for n := b.maxFiles - 1; n >= 0; n-- {
+		f, err := os.Open(b.fileName(n))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "open capture file error")
+		}
+
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, "read capture file error")
+		}
+	}
+
+	return nil
+}
+
+func countLines(name string) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	var count int
+	r := bufio.NewReader(f)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		count += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
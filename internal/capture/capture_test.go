@@ -0,0 +1,113 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestCapture(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "capture")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var conf config.Config
+	conf.Capture.Path = filepath.Join(dir, "capture")
+	conf.Capture.FileMaxFrames = 2
+	conf.Capture.MaxFiles = 2
+
+	assert.NoError(Setup(conf))
+	defer func() {
+		buffer.f.Close()
+		buffer = nil
+	}()
+	assert.True(Enabled())
+
+	records := func() []Record {
+		var buf bytes.Buffer
+		assert.NoError(Dump(&buf))
+
+		var out []Record
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var r Record
+			assert.NoError(json.Unmarshal(scanner.Bytes(), &r))
+			out = append(out, r)
+		}
+		return out
+	}
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("uplink, downlink and ack", func(t *testing.T) {
+		assert := require.New(t)
+
+		Uplink(gw.UplinkFrame{
+			PhyPayload: []byte{1},
+			RxInfo: &gw.UplinkRXInfo{
+				GatewayId: gatewayID[:],
+			},
+		})
+		Downlink(gw.DownlinkFrame{
+			PhyPayload: []byte{2},
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID[:],
+			},
+		})
+		DownlinkTXAck(gw.DownlinkTXAck{
+			GatewayId: gatewayID[:],
+			Error:     "TOO_LATE",
+		})
+
+		recs := records()
+		assert.Len(recs, 3)
+		assert.Equal(TypeUplink, recs[0].Type)
+		assert.Equal(TypeDownlink, recs[1].Type)
+		assert.Equal(TypeDownlinkTXAck, recs[2].Type)
+		assert.Equal(gatewayID, recs[0].GatewayID)
+
+		var ack map[string]interface{}
+		assert.NoError(json.Unmarshal(recs[2].Frame, &ack))
+		assert.Equal("TOO_LATE", ack["error"])
+	})
+
+	t.Run("rotation drops the oldest file", func(t *testing.T) {
+		assert := require.New(t)
+
+		// the first file contains the uplink and downlink, the second file
+		// the ack and this frame
+		Uplink(gw.UplinkFrame{PhyPayload: []byte{3}, RxInfo: &gw.UplinkRXInfo{GatewayId: gatewayID[:]}})
+
+		// this removes the first file
+		Uplink(gw.UplinkFrame{PhyPayload: []byte{4}, RxInfo: &gw.UplinkRXInfo{GatewayId: gatewayID[:]}})
+
+		recs := records()
+		assert.Len(recs, 3)
+		assert.Equal(TypeDownlinkTXAck, recs[0].Type)
+		assert.Equal(TypeUplink, recs[2].Type)
+	})
+
+	t.Run("restart continues the existing file", func(t *testing.T) {
+		assert := require.New(t)
+
+		buffer.f.Close()
+		assert.NoError(Setup(conf))
+		assert.Equal(1, buffer.count)
+
+		var buf bytes.Buffer
+		assert.NoError(DumpPath(conf.Capture.Path, conf.Capture.MaxFiles, &buf))
+		assert.Equal(3, bytes.Count(buf.Bytes(), []byte{'\n'}))
+	})
+}
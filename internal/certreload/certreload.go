@@ -0,0 +1,220 @@
+// Package certreload implements the reloading of the TLS certificate files.
+//
+// The certificate files are watched by comparing their modification times
+// when the TLS configuration is used (e.g. on each TLS handshake). When one
+// of the files has been modified, all files are reloaded, such that
+// short-lived certificates can be rotated without restarting the ChirpStack
+// Gateway Bridge. When the reloading fails (e.g. the key-pair does not match
+// because only one of the files has been written), the previously loaded
+// certificates remain in use until the next successful reload.
+package certreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkInterval defines the min. interval between two checks of the
+// modification times of the files.
+const checkInterval = time.Second
+
+// Reloader holds the (reloaded) CA certificate and TLS key-pair.
+type Reloader struct {
+	caCert  string
+	tlsCert string
+	tlsKey  string
+
+	sync.RWMutex
+	modTimes    []time.Time
+	checkedAt   time.Time
+	certPool    *x509.CertPool
+	certificate *tls.Certificate
+}
+
+// New creates a new Reloader and loads the given files. The CA certificate
+// and the key-pair are optional, an empty file name disables these.
+func New(caCert, tlsCert, tlsKey string) (*Reloader, error) {
+	r := Reloader{
+		caCert:  caCert,
+		tlsCert: tlsCert,
+		tlsKey:  tlsKey,
+	}
+
+	if err := r.load(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// CertPool returns the CA certificate pool. It returns nil when no CA
+// certificate is configured.
+func (r *Reloader) CertPool() *x509.CertPool {
+	r.reload()
+
+	r.RLock()
+	defer r.RUnlock()
+	return r.certPool
+}
+
+// GetCertificate returns the TLS key-pair. It implements the GetCertificate
+// callback of the tls.Config of a server.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.getCertificate()
+}
+
+// GetClientCertificate returns the TLS key-pair. It implements the
+// GetClientCertificate callback of the tls.Config of a client.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.getCertificate()
+}
+
+// ServerConfig returns the tls.Config for a server. The configuration of
+// each TLS handshake uses the latest key-pair and, when set, the latest CA
+// certificate for the verification of the client certificates.
+func (r *Reloader) ServerConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		GetCertificate: r.GetCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			conf := tls.Config{
+				ClientCAs:      r.CertPool(),
+				GetCertificate: r.GetCertificate,
+			}
+			if conf.ClientCAs != nil {
+				conf.ClientAuth = clientAuth
+			}
+			return &conf, nil
+		},
+	}
+}
+
+// ClientConfig returns the tls.Config for a client. The client certificate
+// is reloaded on each TLS handshake. As the tls.Config must not be modified
+// once in use, the CA certificate of the returned configuration is not
+// updated, ClientConfig must be called again to use the latest CA
+// certificate.
+func (r *Reloader) ClientConfig() *tls.Config {
+	conf := tls.Config{
+		RootCAs: r.CertPool(),
+	}
+
+	if r.tlsCert != "" && r.tlsKey != "" {
+		conf.GetClientCertificate = r.GetClientCertificate
+	}
+
+	return &conf
+}
+
+func (r *Reloader) getCertificate() (*tls.Certificate, error) {
+	r.reload()
+
+	r.RLock()
+	defer r.RUnlock()
+
+	if r.certificate == nil {
+		return nil, errors.New("no tls key-pair configured")
+	}
+	return r.certificate, nil
+}
+
+// reload reloads the files when at least one of the files has been modified
+// since these were last loaded.
+func (r *Reloader) reload() {
+	now := time.Now()
+
+	r.RLock()
+	check := now.Sub(r.checkedAt) >= checkInterval
+	r.RUnlock()
+
+	if !check {
+		return
+	}
+
+	if err := r.load(now); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"ca_cert":  r.caCert,
+			"tls_cert": r.tlsCert,
+			"tls_key":  r.tlsKey,
+		}).Error("certreload: reload certificates error")
+	}
+}
+
+// load loads the files, unless these have not been modified since these
+// were last loaded.
+func (r *Reloader) load(now time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.checkedAt = now
+
+	var modTimes []time.Time
+	for _, f := range []string{r.caCert, r.tlsCert, r.tlsKey} {
+		if f == "" {
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return errors.Wrap(err, "stat file error")
+		}
+		modTimes = append(modTimes, fi.ModTime())
+	}
+
+	if r.modTimes != nil && equalTimes(modTimes, r.modTimes) {
+		return nil
+	}
+
+	var certPool *x509.CertPool
+	if r.caCert != "" {
+		b, err := ioutil.ReadFile(r.caCert)
+		if err != nil {
+			return errors.Wrap(err, "read ca-cert error")
+		}
+
+		certPool = x509.NewCertPool()
+		certPool.AppendCertsFromPEM(b)
+	}
+
+	var certificate *tls.Certificate
+	if r.tlsCert != "" && r.tlsKey != "" {
+		kp, err := tls.LoadX509KeyPair(r.tlsCert, r.tlsKey)
+		if err != nil {
+			return errors.Wrap(err, "load tls key-pair error")
+		}
+		certificate = &kp
+	}
+
+	// only log reloads, not the initial load
+	if r.modTimes != nil {
+		log.WithFields(log.Fields{
+			"ca_cert":  r.caCert,
+			"tls_cert": r.tlsCert,
+			"tls_key":  r.tlsKey,
+		}).Info("certreload: certificates reloaded")
+	}
+
+	r.modTimes = modTimes
+	r.certPool = certPool
+	r.certificate = certificate
+
+	return nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
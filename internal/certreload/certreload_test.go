@@ -0,0 +1,108 @@
+package certreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair writes a self-signed key-pair with the given common name.
+func writeKeyPair(t *testing.T, certFile, keyFile, commonName string) {
+	assert := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+	assert.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+
+	assert.NoError(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600))
+	assert.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+// commonName returns the common name of the key-pair of the reloader.
+func commonName(t *testing.T, r *Reloader) string {
+	assert := require.New(t)
+
+	cert, err := r.GetCertificate(nil)
+	assert.NoError(err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "certreload")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeKeyPair(t, certFile, keyFile, "first")
+
+	r, err := New(certFile, certFile, keyFile)
+	assert.NoError(err)
+	assert.NotNil(r.CertPool())
+	assert.Equal("first", commonName(t, r))
+
+	t.Run("Not modified", func(t *testing.T) {
+		r.checkedAt = time.Time{}
+		assert.Equal("first", commonName(t, r))
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		writeKeyPair(t, certFile, keyFile, "second")
+		modTime := time.Now().Add(time.Minute)
+		for _, f := range []string{certFile, keyFile} {
+			assert.NoError(os.Chtimes(f, modTime, modTime))
+		}
+
+		// the files are checked at most once per check interval
+		assert.Equal("first", commonName(t, r))
+
+		r.checkedAt = time.Time{}
+		assert.Equal("second", commonName(t, r))
+	})
+
+	t.Run("Invalid key-pair", func(t *testing.T) {
+		// the previous key-pair remains in use
+		assert.NoError(ioutil.WriteFile(keyFile, []byte("invalid"), 0600))
+		modTime := time.Now().Add(2 * time.Minute)
+		assert.NoError(os.Chtimes(keyFile, modTime, modTime))
+
+		r.checkedAt = time.Time{}
+		assert.Equal("second", commonName(t, r))
+	})
+
+	t.Run("Client config", func(t *testing.T) {
+		conf := r.ClientConfig()
+		assert.NotNil(conf.RootCAs)
+		assert.NotNil(conf.GetClientCertificate)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := New("", filepath.Join(dir, "missing.pem"), keyFile)
+		assert.Error(err)
+	})
+}
@@ -1,12 +1,17 @@
 package commands
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -14,14 +19,45 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/capture"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/statscounters"
 	"github.com/brocaar/lorawan"
 )
 
+// Defaults for the streaming of the command output.
+const (
+	defaultStreamChunkSize     = 1024
+	defaultStreamFlushInterval = time.Second
+)
+
 type command struct {
 	Command              string
 	MaxExecutionDuration time.Duration
+
+	// When set, the output is published in chunks while the command is
+	// running (see executeStream).
+	Stream              bool
+	StreamChunkSize     int
+	StreamFlushInterval time.Duration
+
+	// Arguments contains the argument placeholders of the command. The
+	// values are taken from the request environment and must match the
+	// regular expression. These are not exposed as environment variables.
+	Arguments map[string]*regexp.Regexp
+
+	// WorkingDirectory and Environment (KEY=VALUE) are set for the
+	// executed command.
+	WorkingDirectory string
+	Environment      []string
+
+	// When not empty, only these request environment variables are accepted.
+	AllowedEnvironment []string
+
+	// sem limits the number of concurrent executions (nil when unlimited).
+	sem chan struct{}
 }
 
 var (
@@ -38,15 +74,58 @@ func Setup(conf config.Config) error {
 	commands = make(map[string]command)
 
 	for k, v := range conf.Commands.Commands {
-		commands[k] = command{
+		cmd := command{
 			Command:              v.Command,
 			MaxExecutionDuration: v.MaxExecutionDuration,
+			Stream:               v.Stream,
+			StreamChunkSize:      v.StreamChunkSize,
+			StreamFlushInterval:  v.StreamFlushInterval,
+			Arguments:            make(map[string]*regexp.Regexp),
+			WorkingDirectory:     v.WorkingDirectory,
+			Environment:          v.Environment,
+			AllowedEnvironment:   v.AllowedEnvironment,
+		}
+		if cmd.StreamChunkSize <= 0 {
+			cmd.StreamChunkSize = defaultStreamChunkSize
+		}
+		if cmd.StreamFlushInterval <= 0 {
+			cmd.StreamFlushInterval = defaultStreamFlushInterval
+		}
+		if v.MaxConcurrent > 0 {
+			cmd.sem = make(chan struct{}, v.MaxConcurrent)
+		}
+
+		for name, expr := range v.Arguments {
+			// the value must match the complete expression
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return errors.Wrapf(err, "compile argument %s regexp error for command %s", name, k)
+			}
+			cmd.Arguments[name] = re
+		}
+
+		// Validate the placeholders by rendering the arguments using an empty
+		// value for each argument.
+		args, err := ParseCommandLine(cmd.Command)
+		if err != nil {
+			return errors.Wrapf(err, "parse command %s error", k)
+		}
+		data := make(map[string]string)
+		for name := range cmd.Arguments {
+			data[name] = ""
+		}
+		if _, err := renderArgs(args, data); err != nil {
+			return errors.Wrapf(err, "command %s error", k)
 		}
 
+		commands[k] = cmd
+
 		log.WithFields(log.Fields{
 			"command":                k,
 			"command_exec":           v.Command,
 			"max_execution_duration": v.MaxExecutionDuration,
+			"stream":                 v.Stream,
+			"max_concurrent":         v.MaxConcurrent,
 		}).Info("commands: configuring command")
 	}
 
@@ -67,7 +146,24 @@ func executeCommand(cmd gw.GatewayCommandExecRequest) {
 	var gatewayID lorawan.EUI64
 	copy(gatewayID[:], cmd.GatewayId)
 
-	stdout, stderr, err := execute(cmd.Command, cmd.Stdin, cmd.Environment)
+	if isStream(cmd.Command) {
+		executeStreamCommand(gatewayID, cmd)
+		return
+	}
+
+	var stdout, stderr []byte
+	var err error
+
+	if cmd.Command == capture.Command && capture.Enabled() {
+		stdout, err = dumpCapture()
+	} else if cmd.Command == backend.PurgeCommand {
+		stdout = purgeDownlinks(gatewayID)
+	} else if cmd.Command == statscounters.Command && statscounters.Enabled() {
+		err = resetStatsCounters(gatewayID)
+	} else {
+		stdout, stderr, err = execute(cmd.Command, cmd.Stdin, cmd.Environment)
+	}
+
 	resp := gw.GatewayCommandExecResponse{
 		GatewayId: cmd.GatewayId,
 		ExecId:    cmd.ExecId,
@@ -85,11 +181,103 @@ func executeCommand(cmd gw.GatewayCommandExecRequest) {
 	}
 }
 
+// dumpCapture returns the captured frames as output of the built-in
+// capture_dump command.
+func dumpCapture() ([]byte, error) {
+	log.WithField("command", capture.Command).Info("commands: executing built-in command")
+
+	var buf bytes.Buffer
+	if err := capture.Dump(&buf); err != nil {
+		return nil, errors.Wrap(err, "dump capture error")
+	}
+	return buf.Bytes(), nil
+}
+
+// purgeDownlinks purges the queued downlinks of the given gateway and
+// returns the number of purged downlinks as output of the built-in
+// purge_downlinks command.
+func purgeDownlinks(gatewayID lorawan.EUI64) []byte {
+	log.WithFields(log.Fields{
+		"command":    backend.PurgeCommand,
+		"gateway_id": gatewayID,
+	}).Info("commands: executing built-in command")
+
+	return []byte(strconv.Itoa(backend.PurgeDownlinks(gatewayID)) + "\n")
+}
+
+// resetStatsCounters resets the cumulative stats counters of the given
+// gateway for the built-in reset_stats_counters command.
+func resetStatsCounters(gatewayID lorawan.EUI64) error {
+	log.WithFields(log.Fields{
+		"command":    statscounters.Command,
+		"gateway_id": gatewayID,
+	}).Info("commands: executing built-in command")
+
+	if err := statscounters.Reset(gatewayID); err != nil {
+		return errors.Wrap(err, "reset stats counters error")
+	}
+	return nil
+}
+
 func execute(command string, stdin []byte, environment map[string]string) ([]byte, []byte, error) {
+	cmdCtx, cancel, err := newCmd(command, environment)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cancel()
+
+	stdinPipe, err := cmdCtx.StdinPipe()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get stdin pipe error")
+	}
+
+	stdoutPipe, err := cmdCtx.StdoutPipe()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get stdout pipe error")
+	}
+
+	stderrPipe, err := cmdCtx.StderrPipe()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get stderr pipe error")
+	}
+
+	go func() {
+		defer stdinPipe.Close()
+		if _, err := stdinPipe.Write(stdin); err != nil {
+			log.WithError(err).Error("commands: write to stdin error")
+		}
+	}()
+
+	if err := cmdCtx.Start(); err != nil {
+		return nil, nil, errors.Wrap(err, "starting command error")
+	}
+
+	stdoutB, _ := ioutil.ReadAll(stdoutPipe)
+	stderrB, _ := ioutil.ReadAll(stderrPipe)
+
+	if err := cmdCtx.Wait(); err != nil {
+		return nil, nil, errors.Wrap(err, "waiting for command to finish error")
+	}
+
+	return stdoutB, stderrB, nil
+}
+
+// isStream returns true when the output of the given command must be
+// streamed.
+func isStream(command string) bool {
 	mux.RLock()
 	defer mux.RUnlock()
 
+	return commands[command].Stream
+}
+
+// newCmd returns the exec.Cmd for the given command. The returned cancel
+// function must be called when the command has completed.
+func newCmd(command string, environment map[string]string) (*exec.Cmd, context.CancelFunc, error) {
+	mux.RLock()
 	cmd, ok := commands[command]
+	mux.RUnlock()
+
 	if !ok {
 		return nil, nil, errors.New("command does not exist")
 	}
@@ -102,6 +290,24 @@ func execute(command string, stdin []byte, environment map[string]string) ([]byt
 		return nil, nil, errors.New("no command is given")
 	}
 
+	data, env, err := cmd.splitEnvironment(environment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmdArgs, err = renderArgs(cmdArgs, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cmd.sem != nil {
+		select {
+		case cmd.sem <- struct{}{}:
+		default:
+			return nil, nil, errors.New("max concurrent executions reached")
+		}
+	}
+
 	log.WithFields(log.Fields{
 		"command":                command,
 		"exec":                   cmdArgs[0],
@@ -110,52 +316,93 @@ func execute(command string, stdin []byte, environment map[string]string) ([]byt
 	}).Info("commands: executing command")
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(cmd.MaxExecutionDuration))
-	defer cancel()
 
 	cmdCtx := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmdCtx.Dir = cmd.WorkingDirectory
 
 	// The default is that when cmdCtx.Env is nil, os.Environ() are being used
 	// automatically. As we want to add additional env. variables, we want to
 	// extend this list, thus first need to set them to os.Environ()
 	cmdCtx.Env = os.Environ()
-	for k, v := range environment {
+	cmdCtx.Env = append(cmdCtx.Env, cmd.Environment...)
+	for k, v := range env {
 		cmdCtx.Env = append(cmdCtx.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	stdinPipe, err := cmdCtx.StdinPipe()
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "get stdin pipe error")
-	}
+	return cmdCtx, func() {
+		cancel()
+		if cmd.sem != nil {
+			<-cmd.sem
+		}
+	}, nil
+}
 
-	stdoutPipe, err := cmdCtx.StdoutPipe()
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "get stdout pipe error")
+// splitEnvironment splits the request environment into the argument values
+// and the environment variables. It returns an error when an argument is
+// missing or invalid, or when an environment variable is not allowed.
+func (c command) splitEnvironment(environment map[string]string) (map[string]string, map[string]string, error) {
+	data := make(map[string]string)
+	env := make(map[string]string)
+
+	for name, re := range c.Arguments {
+		v, ok := environment[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("argument %s is missing", name)
+		}
+		if !re.MatchString(v) {
+			return nil, nil, fmt.Errorf("argument %s is invalid", name)
+		}
+		data[name] = v
 	}
 
-	stderrPipe, err := cmdCtx.StderrPipe()
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "get stderr pipe error")
+	for k, v := range environment {
+		if _, ok := data[k]; ok {
+			continue
+		}
+
+		if len(c.AllowedEnvironment) != 0 && !contains(c.AllowedEnvironment, k) {
+			return nil, nil, fmt.Errorf("environment variable %s is not allowed", k)
+		}
+		env[k] = v
 	}
 
-	go func() {
-		defer stdinPipe.Close()
-		if _, err := stdinPipe.Write(stdin); err != nil {
-			log.WithError(err).Error("commands: write to stdin error")
+	return data, env, nil
+}
+
+// renderArgs renders the argument placeholders (e.g. {{.host}}) of the given
+// (parsed) command line. As each argument is rendered separately, an
+// argument value never results in additional arguments.
+func renderArgs(args []string, data map[string]string) ([]string, error) {
+	out := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		if !strings.Contains(arg, "{{") {
+			out = append(out, arg)
+			continue
 		}
-	}()
 
-	if err := cmdCtx.Start(); err != nil {
-		return nil, nil, errors.Wrap(err, "starting command error")
+		tmpl, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse argument template error")
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, errors.Wrap(err, "execute argument template error")
+		}
+		out = append(out, buf.String())
 	}
 
-	stdoutB, _ := ioutil.ReadAll(stdoutPipe)
-	stderrB, _ := ioutil.ReadAll(stderrPipe)
+	return out, nil
+}
 
-	if err := cmdCtx.Wait(); err != nil {
-		return nil, nil, errors.Wrap(err, "waiting for command to finish error")
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
-
-	return stdoutB, stderrB, nil
+	return false
 }
 
 // ParseCommandLine parses the given command to commands and arguments.
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"regexp"
 	"testing"
 	"time"
 
@@ -112,6 +113,87 @@ func TestExecute(t *testing.T) {
 			Command:       "foobar",
 			ExpectedError: errors.New(`starting command error: exec: "foobartest": executable file not found in $PATH`),
 		},
+		{
+			Name: "argument placeholder",
+			Commands: map[string]command{
+				"echo": command{
+					Command:              "echo --host={{.host}} {{.count}}",
+					MaxExecutionDuration: time.Second,
+					Arguments: map[string]*regexp.Regexp{
+						"host":  regexp.MustCompile(`^(?:[a-z0-9.]+)$`),
+						"count": regexp.MustCompile(`^(?:[0-9]+)$`),
+					},
+				},
+			},
+			Command: "echo",
+			Environment: map[string]string{
+				"host":  "example.com",
+				"count": "4",
+			},
+			ExpectedStdout: []byte("--host=example.com 4\n"),
+			ExpectedStdErr: []byte{},
+		},
+		{
+			Name: "argument not matching regexp",
+			Commands: map[string]command{
+				"echo": command{
+					Command:              "echo {{.host}}",
+					MaxExecutionDuration: time.Second,
+					Arguments: map[string]*regexp.Regexp{
+						"host": regexp.MustCompile(`^(?:[a-z0-9.]+)$`),
+					},
+				},
+			},
+			Command: "echo",
+			Environment: map[string]string{
+				"host": "example.com; reboot",
+			},
+			ExpectedError: errors.New("argument host is invalid"),
+		},
+		{
+			Name: "argument missing",
+			Commands: map[string]command{
+				"echo": command{
+					Command:              "echo {{.host}}",
+					MaxExecutionDuration: time.Second,
+					Arguments: map[string]*regexp.Regexp{
+						"host": regexp.MustCompile(`^(?:[a-z0-9.]+)$`),
+					},
+				},
+			},
+			Command:       "echo",
+			ExpectedError: errors.New("argument host is missing"),
+		},
+		{
+			Name: "environment variable not allowed",
+			Commands: map[string]command{
+				"printenv": command{
+					Command:              "printenv FOO",
+					MaxExecutionDuration: time.Second,
+					AllowedEnvironment:   []string{"FOO"},
+				},
+			},
+			Command: "printenv",
+			Environment: map[string]string{
+				"FOO":        "bar",
+				"LD_PRELOAD": "/tmp/evil.so",
+			},
+			ExpectedError: errors.New("environment variable LD_PRELOAD is not allowed"),
+		},
+		{
+			Name: "working directory and environment",
+			Commands: map[string]command{
+				"pwd": command{
+					Command:              `sh -c 'pwd; echo $FOO'`,
+					MaxExecutionDuration: time.Second,
+					WorkingDirectory:     "/",
+					Environment:          []string{"FOO=bar"},
+				},
+			},
+			Command:        "pwd",
+			ExpectedStdout: []byte("/\nbar\n"),
+			ExpectedStdErr: []byte{},
+		},
 	}
 
 	for _, tst := range tests {
@@ -131,3 +213,47 @@ func TestExecute(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteMaxConcurrent(t *testing.T) {
+	assert := require.New(t)
+
+	commands = map[string]command{
+		"sleep": command{
+			Command:              "sleep 0.2",
+			MaxExecutionDuration: time.Second,
+			sem:                  make(chan struct{}, 1),
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		_, _, err := execute("sleep", nil, nil)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	_, _, err := execute("sleep", nil, nil)
+	assert.EqualError(err, "max concurrent executions reached")
+	assert.NoError(<-done)
+
+	// the slot is released after the execution has completed
+	_, _, err = execute("sleep", nil, nil)
+	assert.NoError(err)
+}
+
+func TestRenderArgs(t *testing.T) {
+	assert := require.New(t)
+
+	out, err := renderArgs([]string{"ping", "-c", "1", "{{.host}}"}, map[string]string{"host": "example.com"})
+	assert.NoError(err)
+	assert.Equal([]string{"ping", "-c", "1", "example.com"}, out)
+
+	// a value containing spaces does not result in additional arguments
+	out, err = renderArgs([]string{"echo", "{{.msg}}"}, map[string]string{"msg": "foo bar"})
+	assert.NoError(err)
+	assert.Equal([]string{"echo", "foo bar"}, out)
+
+	// undefined placeholder
+	_, err = renderArgs([]string{"echo", "{{.foo}}"}, map[string]string{})
+	assert.Error(err)
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration"
+	"github.com/brocaar/lorawan"
+)
+
+// execStreamResponse extends the gw.GatewayCommandExecResponse message with
+// the sequence number of the chunk and the end marker. The fields 1 - 5 are
+// equal to gw.GatewayCommandExecResponse, such that consumers are able to
+// decode it as gw.GatewayCommandExecResponse.
+type execStreamResponse struct {
+	// Gateway ID.
+	GatewayId []byte `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayID,proto3" json:"gateway_id,omitempty"`
+	// Execution request ID (UUID).
+	ExecId []byte `protobuf:"bytes,2,opt,name=exec_id,json=execID,proto3" json:"exec_id,omitempty"`
+	// Standard output (chunk).
+	Stdout []byte `protobuf:"bytes,3,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	// Standard error (chunk).
+	Stderr []byte `protobuf:"bytes,4,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	// Error message.
+	Error string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	// Sequence number of the chunk, starting at 0.
+	Seq uint32 `protobuf:"varint,100,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Set for the last response of the execution.
+	Last bool `protobuf:"varint,101,opt,name=last,proto3" json:"last,omitempty"`
+}
+
+func (m *execStreamResponse) Reset()         { *m = execStreamResponse{} }
+func (m *execStreamResponse) String() string { return proto.CompactTextString(m) }
+func (*execStreamResponse) ProtoMessage()    {}
+
+// streamWriter buffers the stdout and stderr output of the command and
+// publishes it in chunks of at most chunkSize bytes. The buffered output is
+// published when the chunk size has been reached or on flush.
+type streamWriter struct {
+	sync.Mutex
+
+	gatewayID []byte
+	execID    []byte
+	chunkSize int
+	publish   func(*execStreamResponse)
+
+	seq    uint32
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// outputWriter implements io.Writer for the stdout or stderr output.
+type outputWriter struct {
+	w      *streamWriter
+	stderr bool
+}
+
+func (o outputWriter) Write(p []byte) (int, error) {
+	o.w.Lock()
+	defer o.w.Unlock()
+
+	buf := &o.w.stdout
+	if o.stderr {
+		buf = &o.w.stderr
+	}
+	buf.Write(p)
+
+	if buf.Len() >= o.w.chunkSize {
+		o.w.flushLocked(false, "")
+	}
+
+	return len(p), nil
+}
+
+// flush publishes the buffered output. When last is set, the end marker is
+// published, also when there is no buffered output.
+func (w *streamWriter) flush(last bool, errStr string) {
+	w.Lock()
+	defer w.Unlock()
+	w.flushLocked(last, errStr)
+}
+
+func (w *streamWriter) flushLocked(last bool, errStr string) {
+	for w.stdout.Len() != 0 || w.stderr.Len() != 0 || last {
+		resp := execStreamResponse{
+			GatewayId: w.gatewayID,
+			ExecId:    w.execID,
+			Stdout:    nextChunk(&w.stdout, w.chunkSize),
+			Stderr:    nextChunk(&w.stderr, w.chunkSize),
+			Seq:       w.seq,
+		}
+		w.seq++
+
+		if w.stdout.Len() == 0 && w.stderr.Len() == 0 && last {
+			resp.Last = true
+			resp.Error = errStr
+			last = false
+		}
+
+		w.publish(&resp)
+	}
+}
+
+// nextChunk returns a copy of the next n bytes of the buffer, or nil when the
+// buffer is empty.
+func nextChunk(buf *bytes.Buffer, n int) []byte {
+	if buf.Len() == 0 {
+		return nil
+	}
+	return append([]byte{}, buf.Next(n)...)
+}
+
+// executeStream executes the given command and publishes its output in
+// chunks while the command is running. The buffered output is flushed every
+// flushInterval. The last published response contains the end marker and the
+// execution error (if any).
+func executeStream(command string, stdin []byte, environment map[string]string, w *streamWriter) {
+	err := func() error {
+		mux.RLock()
+		cmd := commands[command]
+		mux.RUnlock()
+
+		cmdCtx, cancel, err := newCmd(command, environment)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		w.chunkSize = cmd.StreamChunkSize
+
+		cmdCtx.Stdin = bytes.NewReader(stdin)
+		cmdCtx.Stdout = outputWriter{w: w}
+		cmdCtx.Stderr = outputWriter{w: w, stderr: true}
+
+		if err := cmdCtx.Start(); err != nil {
+			return errors.Wrap(err, "starting command error")
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			ticker := time.NewTicker(cmd.StreamFlushInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					w.flush(false, "")
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		if err := cmdCtx.Wait(); err != nil {
+			return errors.Wrap(err, "waiting for command to finish error")
+		}
+
+		return nil
+	}()
+
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+	w.flush(true, errStr)
+}
+
+func executeStreamCommand(gatewayID lorawan.EUI64, cmd gw.GatewayCommandExecRequest) {
+	w := streamWriter{
+		gatewayID: cmd.GatewayId,
+		execID:    cmd.ExecId,
+		chunkSize: defaultStreamChunkSize,
+		publish: func(resp *execStreamResponse) {
+			var id uuid.UUID
+			if err := integration.GetIntegration().PublishEvent(gatewayID, "exec", id, resp); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"seq": resp.Seq,
+				}).Error("commands: publish command execution event error")
+			}
+		},
+	}
+
+	executeStream(cmd.Command, cmd.Stdin, cmd.Environment, &w)
+}
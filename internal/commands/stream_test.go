@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteStream(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Commands map[string]command
+
+		Command string
+		Stdin   []byte
+
+		ExpectedResponses []execStreamResponse
+	}{
+		{
+			Name:    "command not configured",
+			Command: "reboot",
+			ExpectedResponses: []execStreamResponse{
+				{Seq: 0, Last: true, Error: "command does not exist"},
+			},
+		},
+		{
+			Name: "chunked stdout",
+			Commands: map[string]command{
+				"cat": {
+					Command:              "cat",
+					MaxExecutionDuration: time.Second,
+					Stream:               true,
+					StreamChunkSize:      4,
+					StreamFlushInterval:  time.Minute,
+				},
+			},
+			Command: "cat",
+			Stdin:   []byte("foo bar test"),
+			ExpectedResponses: []execStreamResponse{
+				{Seq: 0, Stdout: []byte("foo ")},
+				{Seq: 1, Stdout: []byte("bar ")},
+				{Seq: 2, Stdout: []byte("test")},
+				{Seq: 3, Last: true},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			commands = tst.Commands
+
+			var responses []execStreamResponse
+			w := streamWriter{
+				chunkSize: defaultStreamChunkSize,
+				publish: func(resp *execStreamResponse) {
+					responses = append(responses, *resp)
+				},
+			}
+
+			executeStream(tst.Command, tst.Stdin, nil, &w)
+			assert.Equal(tst.ExpectedResponses, responses)
+		})
+	}
+
+	t.Run("flush interval", func(t *testing.T) {
+		assert := require.New(t)
+
+		commands = map[string]command{
+			"tail": {
+				Command:              `sh -c 'echo "foo"; sleep 0.2; echo "bar" >&2; exit 1'`,
+				MaxExecutionDuration: time.Second,
+				Stream:               true,
+				StreamChunkSize:      1024,
+				StreamFlushInterval:  50 * time.Millisecond,
+			},
+		}
+
+		var responses []execStreamResponse
+		w := streamWriter{
+			publish: func(resp *execStreamResponse) {
+				responses = append(responses, *resp)
+			},
+		}
+
+		executeStream("tail", nil, nil, &w)
+
+		// the stdout must be flushed before the command completes
+		assert.True(len(responses) >= 2)
+		assert.Equal(execStreamResponse{Stdout: []byte("foo\n")}, responses[0])
+
+		last := responses[len(responses)-1]
+		assert.True(last.Last)
+		assert.Equal("waiting for command to finish error: exit status 1", last.Error)
+		assert.EqualValues(len(responses)-1, last.Seq)
+
+		var stderr []byte
+		for _, resp := range responses {
+			stderr = append(stderr, resp.Stderr...)
+		}
+		assert.Equal([]byte("bar\n"), stderr)
+	})
+}
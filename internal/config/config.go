@@ -7,28 +7,57 @@ import (
 // Config defines the configuration structure.
 type Config struct {
 	General struct {
-		LogLevel    int  `mapstructure:"log_level"`
-		LogToSyslog bool `mapstructure:"log_to_syslog"`
+		LogLevel      int            `mapstructure:"log_level"`
+		LogLevels     map[string]int `mapstructure:"log_levels"`
+		LogFormat     string         `mapstructure:"log_format"`
+		LogToSyslog   bool           `mapstructure:"log_to_syslog"`
+		LogToJournald bool           `mapstructure:"log_to_journald"`
+		Plugins       []string       `mapstructure:"plugins"`
 	}
 
+	Hooks struct {
+		UplinkScript struct {
+			Path        string        `mapstructure:"path"`
+			Args        []string      `mapstructure:"args"`
+			Timeout     time.Duration `mapstructure:"timeout"`
+			DropOnError bool          `mapstructure:"drop_on_error"`
+		} `mapstructure:"uplink_script"`
+	} `mapstructure:"hooks"`
+
 	Filters struct {
 		NetIDs   []string    `mapstructure:"net_ids"`
 		JoinEUIs [][2]string `mapstructure:"join_euis"`
+		MinRSSI  int         `mapstructure:"min_rssi"`
+		MinSNR   float64     `mapstructure:"min_snr"`
+
+		Location struct {
+			MaxSpeed  float64 `mapstructure:"max_speed"`
+			Tolerance float64 `mapstructure:"tolerance"`
+			Action    string  `mapstructure:"action"`
+		} `mapstructure:"location"`
 	} `mapstructure:"filters"`
 
 	Backend struct {
 		Type string `mapstructure:"type"`
 
 		SemtechUDP struct {
-			UDPBind       string `mapstructure:"udp_bind"`
-			SkipCRCCheck  bool   `mapstructure:"skip_crc_check"`
-			FakeRxTime    bool   `mapstructure:"fake_rx_time"`
-			Configuration []struct {
+			UDPBind         string               `mapstructure:"udp_bind"`
+			UDPBinds        []string             `mapstructure:"udp_binds"`
+			SkipCRCCheck    bool                 `mapstructure:"skip_crc_check"`
+			FakeRxTime      bool                 `mapstructure:"fake_rx_time"`
+			RXCounters      bool                 `mapstructure:"rx_counters"`
+			MaxDatagramSize int                  `mapstructure:"max_datagram_size"`
+			Listeners       []SemtechUDPListener `mapstructure:"listeners"`
+			Configuration   []struct {
 				GatewayID      string `mapstructure:"gateway_id"`
 				BaseFile       string `mapstructure:"base_file"`
 				OutputFile     string `mapstructure:"output_file"`
 				RestartCommand string `mapstructure:"restart_command"`
 			} `mapstructure:"configuration"`
+			AllowList struct {
+				SourceIPs []string                   `mapstructure:"source_ips"`
+				Gateways  []SemtechUDPAllowedGateway `mapstructure:"gateways"`
+			} `mapstructure:"allow_list"`
 		} `mapstructure:"semtech_udp"`
 
 		BasicStation struct {
@@ -44,74 +73,221 @@ type Config struct {
 				NetIDs   []string    `mapstructure:"net_ids"`
 				JoinEUIs [][2]string `mapstructure:"join_euis"`
 			} `mapstructure:"filters"`
-			Region        string                     `mapstructure:"region"`
-			FrequencyMin  uint32                     `mapstructure:"frequency_min"`
-			FrequencyMax  uint32                     `mapstructure:"frequency_max"`
-			Concentrators []BasicStationConcentrator `mapstructure:"concentrators"`
+			Region           string                       `mapstructure:"region"`
+			FrequencyMin     uint32                       `mapstructure:"frequency_min"`
+			FrequencyMax     uint32                       `mapstructure:"frequency_max"`
+			Concentrators    []BasicStationConcentrator   `mapstructure:"concentrators"`
+			RegionParameters BasicStationRegionParameters `mapstructure:"region_parameters"`
+			RouterInfo       struct {
+				Routes        []BasicStationRoute `mapstructure:"routes"`
+				RoutesFile    string              `mapstructure:"routes_file"`
+				LookupURL     string              `mapstructure:"lookup_url"`
+				LookupTimeout time.Duration       `mapstructure:"lookup_timeout"`
+			} `mapstructure:"router_info"`
+			CUPS      BasicStationCUPS `mapstructure:"cups"`
+			DIIDStore struct {
+				File   string        `mapstructure:"file"`
+				MaxAge time.Duration `mapstructure:"max_age"`
+			} `mapstructure:"diid_store"`
+			Authorization struct {
+				File        string        `mapstructure:"file"`
+				HTTPURL     string        `mapstructure:"http_url"`
+				HTTPTimeout time.Duration `mapstructure:"http_timeout"`
+			} `mapstructure:"authorization"`
 		} `mapstructure:"basic_station"`
 
 		Concentratord struct {
-			EventURL   string `mapstructure:"event_url"`
-			CommandURL string `mapstructure:"command_url"`
-			CRCCheck   bool   `mapstructure:"crc_check"`
+			EventURL       string                  `mapstructure:"event_url"`
+			CommandURL     string                  `mapstructure:"command_url"`
+			CRCCheck       bool                    `mapstructure:"crc_check"`
+			BandwidthUnit  string                  `mapstructure:"bandwidth_unit"`
+			CommandTimeout time.Duration           `mapstructure:"command_timeout"`
+			Instances      []ConcentratordInstance `mapstructure:"instances"`
+			Mesh           ConcentratordMesh       `mapstructure:"mesh"`
 		} `mapstructure:"concentratord"`
+
+		Multitech struct {
+			Server       string `mapstructure:"server"`
+			Username     string `mapstructure:"username"`
+			Password     string `mapstructure:"password"`
+			ClientID     string `mapstructure:"client_id"`
+			TopicPrefix  string `mapstructure:"topic_prefix"`
+			QOS          uint8  `mapstructure:"qos"`
+			SkipCRCCheck bool   `mapstructure:"skip_crc_check"`
+		} `mapstructure:"multitech"`
+
+		Simulator struct {
+			Gateways         int           `mapstructure:"gateways"`
+			BaseGatewayID    string        `mapstructure:"base_gateway_id"`
+			UplinkInterval   time.Duration `mapstructure:"uplink_interval"`
+			StatsInterval    time.Duration `mapstructure:"stats_interval"`
+			PayloadSize      int           `mapstructure:"payload_size"`
+			Frequencies      []int         `mapstructure:"frequencies"`
+			SpreadingFactors []int         `mapstructure:"spreading_factors"`
+			Bandwidth        int           `mapstructure:"bandwidth"`
+		} `mapstructure:"simulator"`
+
+		Channels struct {
+			DropPolicy                  string `mapstructure:"drop_policy"`
+			UplinkFrameSize             int    `mapstructure:"uplink_frame_size"`
+			GatewayStatsSize            int    `mapstructure:"gateway_stats_size"`
+			DownlinkTXAckSize           int    `mapstructure:"downlink_tx_ack_size"`
+			RawPacketForwarderEventSize int    `mapstructure:"raw_packet_forwarder_event_size"`
+			LogEventSize                int    `mapstructure:"log_event_size"`
+		} `mapstructure:"channels"`
+
+		Scheduler struct {
+			Enabled          bool          `mapstructure:"enabled"`
+			DispatchAhead    time.Duration `mapstructure:"dispatch_ahead"`
+			MinLeadTime      time.Duration `mapstructure:"min_lead_time"`
+			MaxQueueDuration time.Duration `mapstructure:"max_queue_duration"`
+			QueueFile        string        `mapstructure:"queue_file"`
+		} `mapstructure:"scheduler"`
+
+		ConnState struct {
+			KeepaliveTimeout time.Duration `mapstructure:"keepalive_timeout"`
+		} `mapstructure:"conn_state"`
+
+		GatewayIDMapping []GatewayIDMapping `mapstructure:"gateway_id_mapping"`
 	} `mapstructure:"backend"`
 
-	Integration struct {
-		Marshaler string `mapstructure:"marshaler"`
-
-		MQTT struct {
-			EventTopicTemplate      string        `mapstructure:"event_topic_template"`
-			CommandTopicTemplate    string        `mapstructure:"command_topic_template"`
-			MaxReconnectInterval    time.Duration `mapstructure:"max_reconnect_interval"`
-			TerminateOnConnectError bool          `mapstructure:"terminate_on_connect_error"`
-
-			Auth struct {
-				Type string `mapstructure:"type"`
-
-				Generic struct {
-					Server       string   `mapstructure:"server"`
-					Servers      []string `mapstructure:"servers"`
-					Username     string   `mapstructure:"username"`
-					Password     string   `mapstrucure:"password"`
-					CACert       string   `mapstructure:"ca_cert"`
-					TLSCert      string   `mapstructure:"tls_cert"`
-					TLSKey       string   `mapstructure:"tls_key"`
-					QOS          uint8    `mapstructure:"qos"`
-					CleanSession bool     `mapstructure:"clean_session"`
-					ClientID     string   `mapstructure:"client_id"`
-				} `mapstructure:"generic"`
-
-				GCPCloudIoTCore struct {
-					Server        string        `mapstructure:"server"`
-					DeviceID      string        `mapstructure:"device_id"`
-					ProjectID     string        `mapstructure:"project_id"`
-					CloudRegion   string        `mapstructure:"cloud_region"`
-					RegistryID    string        `mapstructure:"registry_id"`
-					JWTExpiration time.Duration `mapstructure:"jwt_expiration"`
-					JWTKeyFile    string        `mapstructure:"jwt_key_file"`
-				} `mapstructure:"gcp_cloud_iot_core"`
-
-				AzureIoTHub struct {
-					DeviceConnectionString string        `mapstructure:"device_connection_string"`
-					DeviceID               string        `mapstructure:"device_id"`
-					Hostname               string        `mapstructure:"hostname"`
-					DeviceKey              string        `mapstructure:"-"`
-					SASTokenExpiration     time.Duration `mapstructure:"sas_token_expiration"`
-					TLSCert                string        `mapstructure:"tls_cert"`
-					TLSKey                 string        `mapstructure:"tls_key"`
-				} `mapstructure:"azure_iot_hub"`
-			} `mapstructure:"auth"`
+	Integration Integration `mapstructure:"integration"`
+
+	Mirror struct {
+		Enabled     bool        `mapstructure:"enabled"`
+		QueueSize   int         `mapstructure:"queue_size"`
+		Integration Integration `mapstructure:"integration"`
+	} `mapstructure:"mirror"`
+
+	HighAvailability struct {
+		Enabled           bool          `mapstructure:"enabled"`
+		InstanceID        string        `mapstructure:"instance_id"`
+		LockTopic         string        `mapstructure:"lock_topic"`
+		LeaseDuration     time.Duration `mapstructure:"lease_duration"`
+		HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+		MQTT              struct {
+			Server   string `mapstructure:"server"`
+			Username string `mapstructure:"username"`
+			Password string `mapstructure:"password"`
+			CACert   string `mapstructure:"ca_cert"`
+			TLSCert  string `mapstructure:"tls_cert"`
+			TLSKey   string `mapstructure:"tls_key"`
 		} `mapstructure:"mqtt"`
-	} `mapstructure:"integration"`
+	} `mapstructure:"high_availability"`
+
+	Forwarder struct {
+		ClockDriftCompensation bool          `mapstructure:"clock_drift_compensation"`
+		ClockDriftWindow       time.Duration `mapstructure:"clock_drift_window"`
+		MaxTimingCorrectionUS  int64         `mapstructure:"max_timing_correction_us"`
+
+		DutyCycle struct {
+			Enabled bool          `mapstructure:"enabled"`
+			Region  string        `mapstructure:"region"`
+			Window  time.Duration `mapstructure:"window"`
+		} `mapstructure:"duty_cycle"`
+
+		LBT struct {
+			Enabled            bool          `mapstructure:"enabled"`
+			Region             string        `mapstructure:"region"`
+			ChannelBusyBackoff time.Duration `mapstructure:"channel_busy_backoff"`
+		} `mapstructure:"lbt"`
+
+		DownlinkValidation struct {
+			Enabled    bool   `mapstructure:"enabled"`
+			Region     string `mapstructure:"region"`
+			MaxTXPower int    `mapstructure:"max_tx_power"`
+		} `mapstructure:"downlink_validation"`
+
+		RateLimit struct {
+			Enabled         bool    `mapstructure:"enabled"`
+			EventsPerSecond float64 `mapstructure:"events_per_second"`
+			Burst           int     `mapstructure:"burst"`
+		} `mapstructure:"rate_limit"`
+
+		Deduplication struct {
+			Enabled bool          `mapstructure:"enabled"`
+			Window  time.Duration `mapstructure:"window"`
+		} `mapstructure:"deduplication"`
+
+		StatsAggregation struct {
+			Enabled        bool          `mapstructure:"enabled"`
+			Interval       time.Duration `mapstructure:"interval"`
+			BridgeCounters bool          `mapstructure:"bridge_counters"`
+		} `mapstructure:"stats_aggregation"`
+
+		StatsCounters struct {
+			Enabled      bool          `mapstructure:"enabled"`
+			File         string        `mapstructure:"file"`
+			SaveInterval time.Duration `mapstructure:"save_interval"`
+		} `mapstructure:"stats_counters"`
+
+		DownlinkRetry struct {
+			Enabled      bool     `mapstructure:"enabled"`
+			Errors       []string `mapstructure:"errors"`
+			Region       string   `mapstructure:"region"`
+			RX2Frequency int      `mapstructure:"rx2_frequency"`
+			RX2DataRate  int      `mapstructure:"rx2_data_rate"`
+		} `mapstructure:"downlink_retry"`
+
+		FineTimestamp struct {
+			AESKey   string             `mapstructure:"aes_key"`
+			Gateways []FineTimestampKey `mapstructure:"gateways"`
+		} `mapstructure:"fine_timestamp"`
+
+		AntennaGain []AntennaGain `mapstructure:"antenna_gain"`
+	} `mapstructure:"forwarder"`
 
 	Metrics struct {
 		Prometheus struct {
 			EndpointEnabled bool   `mapstructure:"endpoint_enabled"`
 			Bind            string `mapstructure:"bind"`
+			PerGateway      bool   `mapstructure:"per_gateway"`
+			MaxGateways     int    `mapstructure:"max_gateways"`
+			RFMetrics       bool   `mapstructure:"rf_metrics"`
 		}
+
+		SNMP struct {
+			Enabled   bool   `mapstructure:"enabled"`
+			Bind      string `mapstructure:"bind"`
+			Community string `mapstructure:"community"`
+			OIDPrefix string `mapstructure:"oid_prefix"`
+		} `mapstructure:"snmp"`
 	}
 
+	Tracing struct {
+		Enabled        bool              `mapstructure:"enabled"`
+		Endpoint       string            `mapstructure:"endpoint"`
+		Headers        map[string]string `mapstructure:"headers"`
+		ServiceName    string            `mapstructure:"service_name"`
+		ExportInterval time.Duration     `mapstructure:"export_interval"`
+		QueueSize      int               `mapstructure:"queue_size"`
+	} `mapstructure:"tracing"`
+
+	Health struct {
+		EndpointEnabled bool          `mapstructure:"endpoint_enabled"`
+		Bind            string        `mapstructure:"bind"`
+		BackendTimeout  time.Duration `mapstructure:"backend_timeout"`
+	} `mapstructure:"health"`
+
+	WebUI struct {
+		Enabled   bool   `mapstructure:"enabled"`
+		Bind      string `mapstructure:"bind"`
+		MaxFrames int    `mapstructure:"max_frames"`
+		Username  string `mapstructure:"username"`
+		Password  string `mapstructure:"password"`
+	} `mapstructure:"web_ui"`
+
+	Capture struct {
+		Path          string `mapstructure:"path"`
+		FileMaxFrames int    `mapstructure:"file_max_frames"`
+		MaxFiles      int    `mapstructure:"max_files"`
+	} `mapstructure:"capture"`
+
+	TimeSync struct {
+		Enabled bool          `mapstructure:"enabled"`
+		Window  time.Duration `mapstructure:"window"`
+	} `mapstructure:"timesync"`
+
 	MetaData struct {
 		Static  map[string]string `mapstructure:"static"`
 		Dynamic struct {
@@ -119,16 +295,366 @@ type Config struct {
 			MaxExecutionDuration time.Duration     `mapstructure:"max_execution_duration"`
 			Commands             map[string]string `mapstructure:"commands"`
 		} `mapstructure:"dynamic"`
+		GPSD struct {
+			Enabled bool          `mapstructure:"enabled"`
+			Server  string        `mapstructure:"server"`
+			MaxAge  time.Duration `mapstructure:"max_age"`
+		} `mapstructure:"gpsd"`
+		System struct {
+			Enabled         bool   `mapstructure:"enabled"`
+			Prefix          string `mapstructure:"prefix"`
+			DiskPath        string `mapstructure:"disk_path"`
+			TemperaturePath string `mapstructure:"temperature_path"`
+		} `mapstructure:"system"`
 	} `mapstructure:"meta_data"`
 
 	Commands struct {
-		Commands map[string]struct {
-			MaxExecutionDuration time.Duration `mapstructure:"max_execution_duration"`
-			Command              string        `mapstructure:"command"`
-		} `mapstructure:"commands"`
+		Commands map[string]Command `mapstructure:"commands"`
 	} `mapstructure:"commands"`
 }
 
+// Integration holds the integration configuration. It is used by both the
+// integration and the mirror integration.
+type Integration struct {
+	// IsMirror is set for the mirror integration configuration. It is not
+	// part of the configuration file.
+	IsMirror bool `mapstructure:"-"`
+
+	Marshaler       string             `mapstructure:"marshaler"`
+	EventMarshalers map[string]string  `mapstructure:"event_marshalers"`
+	APIVersion      string             `mapstructure:"api_version"`
+	Enabled         []string           `mapstructure:"enabled"`
+	Routes          []IntegrationRoute `mapstructure:"routes"`
+
+	MQTT struct {
+		CommandsEnabled         bool          `mapstructure:"commands_enabled"`
+		EventTopicTemplate      string        `mapstructure:"event_topic_template"`
+		CommandTopicTemplate    string        `mapstructure:"command_topic_template"`
+		SharedSubscriptionGroup string        `mapstructure:"shared_subscription_group"`
+		MaxReconnectInterval    time.Duration `mapstructure:"max_reconnect_interval"`
+		TerminateOnConnectError bool          `mapstructure:"terminate_on_connect_error"`
+		ProtocolVersion         int           `mapstructure:"protocol_version"`
+
+		EventQOS       map[string]uint8 `mapstructure:"event_qos"`
+		RetainedEvents []string         `mapstructure:"retained_events"`
+
+		V5 struct {
+			TopicAliasMaximum     uint16        `mapstructure:"topic_alias_maximum"`
+			MessageExpiryInterval time.Duration `mapstructure:"message_expiry_interval"`
+			UserProperties        bool          `mapstructure:"user_properties"`
+			SessionExpiryInterval time.Duration `mapstructure:"session_expiry_interval"`
+		} `mapstructure:"v5"`
+
+		EventBuffer struct {
+			MaxCount int           `mapstructure:"max_count"`
+			MaxAge   time.Duration `mapstructure:"max_age"`
+		} `mapstructure:"event_buffer"`
+
+		StoreAndForward struct {
+			Path            string        `mapstructure:"path"`
+			MaxSize         int           `mapstructure:"max_size"`
+			MaxAge          time.Duration `mapstructure:"max_age"`
+			ReplayRetention time.Duration `mapstructure:"replay_retention"`
+		} `mapstructure:"store_and_forward"`
+
+		Compression struct {
+			Algorithm string `mapstructure:"algorithm"`
+			MinSize   int    `mapstructure:"min_size"`
+		} `mapstructure:"compression"`
+
+		RemoteConfig struct {
+			Enabled             bool   `mapstructure:"enabled"`
+			StateTopicTemplate  string `mapstructure:"state_topic_template"`
+			ConfigTopicTemplate string `mapstructure:"config_topic_template"`
+		} `mapstructure:"remote_config"`
+
+		Auth struct {
+			Type string `mapstructure:"type"`
+
+			Generic struct {
+				Server       string   `mapstructure:"server"`
+				Servers      []string `mapstructure:"servers"`
+				Username     string   `mapstructure:"username"`
+				Password     string   `mapstrucure:"password"`
+				CACert       string   `mapstructure:"ca_cert"`
+				TLSCert      string   `mapstructure:"tls_cert"`
+				TLSKey       string   `mapstructure:"tls_key"`
+				QOS          uint8    `mapstructure:"qos"`
+				CleanSession bool     `mapstructure:"clean_session"`
+				ClientID     string   `mapstructure:"client_id"`
+
+				RoundRobin           bool          `mapstructure:"round_robin"`
+				PrimaryCheckInterval time.Duration `mapstructure:"primary_check_interval"`
+
+				ClientCertificate struct {
+					CACert      string        `mapstructure:"ca_cert"`
+					CAKey       string        `mapstructure:"ca_key"`
+					CommonName  string        `mapstructure:"common_name"`
+					Lifetime    time.Duration `mapstructure:"lifetime"`
+					RenewBefore time.Duration `mapstructure:"renew_before"`
+				} `mapstructure:"client_certificate"`
+			} `mapstructure:"generic"`
+
+			GCPCloudIoTCore struct {
+				Server        string        `mapstructure:"server"`
+				DeviceID      string        `mapstructure:"device_id"`
+				ProjectID     string        `mapstructure:"project_id"`
+				CloudRegion   string        `mapstructure:"cloud_region"`
+				RegistryID    string        `mapstructure:"registry_id"`
+				JWTExpiration time.Duration `mapstructure:"jwt_expiration"`
+				JWTKeyFile    string        `mapstructure:"jwt_key_file"`
+			} `mapstructure:"gcp_cloud_iot_core"`
+
+			AzureIoTHub struct {
+				DeviceConnectionString string                  `mapstructure:"device_connection_string"`
+				DeviceID               string                  `mapstructure:"device_id"`
+				ModuleID               string                  `mapstructure:"module_id"`
+				Hostname               string                  `mapstructure:"hostname"`
+				DeviceKey              string                  `mapstructure:"-"`
+				SASTokenExpiration     time.Duration           `mapstructure:"sas_token_expiration"`
+				TLSCert                string                  `mapstructure:"tls_cert"`
+				TLSKey                 string                  `mapstructure:"tls_key"`
+				DirectMethods          bool                    `mapstructure:"direct_methods"`
+				Provisioning           AzureIoTHubProvisioning `mapstructure:"provisioning"`
+			} `mapstructure:"azure_iot_hub"`
+
+			AWSIoT struct {
+				Mode                   string `mapstructure:"mode"`
+				Endpoint               string `mapstructure:"endpoint"`
+				Region                 string `mapstructure:"region"`
+				ClientID               string `mapstructure:"client_id"`
+				CACert                 string `mapstructure:"ca_cert"`
+				CredentialSource       string `mapstructure:"credential_source"`
+				AccessKeyID            string `mapstructure:"access_key_id"`
+				SecretAccessKey        string `mapstructure:"secret_access_key"`
+				SessionToken           string `mapstructure:"session_token"`
+				Username               string `mapstructure:"username"`
+				AuthorizerName         string `mapstructure:"authorizer_name"`
+				AuthorizerTokenKeyName string `mapstructure:"authorizer_token_key_name"`
+				AuthorizerToken        string `mapstructure:"authorizer_token"`
+				AuthorizerSignature    string `mapstructure:"authorizer_signature"`
+				TLSCert                string `mapstructure:"tls_cert"`
+				TLSKey                 string `mapstructure:"tls_key"`
+
+				Shadow struct {
+					Enabled           bool   `mapstructure:"enabled"`
+					ThingNameTemplate string `mapstructure:"thing_name_template"`
+				} `mapstructure:"shadow"`
+			} `mapstructure:"aws_iot"`
+		} `mapstructure:"auth"`
+	} `mapstructure:"mqtt"`
+
+	Kafka struct {
+		CommandsEnabled    bool     `mapstructure:"commands_enabled"`
+		Brokers            []string `mapstructure:"brokers"`
+		EventTopicTemplate string   `mapstructure:"event_topic_template"`
+		CommandTopic       string   `mapstructure:"command_topic"`
+		ConsumerGroup      string   `mapstructure:"consumer_group"`
+		TLS                bool     `mapstructure:"tls"`
+		CACert             string   `mapstructure:"ca_cert"`
+		TLSCert            string   `mapstructure:"tls_cert"`
+		TLSKey             string   `mapstructure:"tls_key"`
+
+		SASL struct {
+			Mechanism string `mapstructure:"mechanism"`
+			Username  string `mapstructure:"username"`
+			Password  string `mapstructure:"password"`
+		} `mapstructure:"sasl"`
+	} `mapstructure:"kafka"`
+
+	NATS struct {
+		CommandsEnabled        bool          `mapstructure:"commands_enabled"`
+		Servers                []string      `mapstructure:"servers"`
+		EventSubjectTemplate   string        `mapstructure:"event_subject_template"`
+		CommandSubjectTemplate string        `mapstructure:"command_subject_template"`
+		ReconnectWait          time.Duration `mapstructure:"reconnect_wait"`
+		Username               string        `mapstructure:"username"`
+		Password               string        `mapstructure:"password"`
+		CredentialsFile        string        `mapstructure:"credentials_file"`
+		CACert                 string        `mapstructure:"ca_cert"`
+		TLSCert                string        `mapstructure:"tls_cert"`
+		TLSKey                 string        `mapstructure:"tls_key"`
+
+		JetStream struct {
+			Enabled  bool     `mapstructure:"enabled"`
+			Stream   string   `mapstructure:"stream"`
+			Subjects []string `mapstructure:"subjects"`
+		} `mapstructure:"jetstream"`
+	} `mapstructure:"nats"`
+
+	HTTP struct {
+		CommandsEnabled  bool              `mapstructure:"commands_enabled"`
+		CommandBind      string            `mapstructure:"command_bind"`
+		EventURL         string            `mapstructure:"event_url"`
+		EventURLs        map[string]string `mapstructure:"event_urls"`
+		Headers          map[string]string `mapstructure:"headers"`
+		Timeout          time.Duration     `mapstructure:"timeout"`
+		HMACSecret       string            `mapstructure:"hmac_secret"`
+		MaxRetries       int               `mapstructure:"max_retries"`
+		RetryInterval    time.Duration     `mapstructure:"retry_interval"`
+		MaxRetryInterval time.Duration     `mapstructure:"max_retry_interval"`
+	} `mapstructure:"http"`
+
+	GRPC struct {
+		CommandsEnabled      bool          `mapstructure:"commands_enabled"`
+		Server               string        `mapstructure:"server"`
+		MaxReconnectInterval time.Duration `mapstructure:"max_reconnect_interval"`
+		TLS                  bool          `mapstructure:"tls"`
+		CACert               string        `mapstructure:"ca_cert"`
+		TLSCert              string        `mapstructure:"tls_cert"`
+		TLSKey               string        `mapstructure:"tls_key"`
+	} `mapstructure:"grpc"`
+
+	Plugin struct {
+		CommandsEnabled bool          `mapstructure:"commands_enabled"`
+		Path            string        `mapstructure:"path"`
+		Args            []string      `mapstructure:"args"`
+		RestartInterval time.Duration `mapstructure:"restart_interval"`
+	} `mapstructure:"plugin"`
+
+	SemtechUDP struct {
+		CommandsEnabled   bool          `mapstructure:"commands_enabled"`
+		Server            string        `mapstructure:"server"`
+		KeepaliveInterval time.Duration `mapstructure:"keepalive_interval"`
+	} `mapstructure:"semtech_udp"`
+
+	AMQP struct {
+		CommandsEnabled           bool          `mapstructure:"commands_enabled"`
+		URL                       string        `mapstructure:"url"`
+		Exchange                  string        `mapstructure:"exchange"`
+		EventRoutingKeyTemplate   string        `mapstructure:"event_routing_key_template"`
+		CommandQueueTemplate      string        `mapstructure:"command_queue_template"`
+		CommandRoutingKeyTemplate string        `mapstructure:"command_routing_key_template"`
+		PublisherConfirms         bool          `mapstructure:"publisher_confirms"`
+		ConfirmTimeout            time.Duration `mapstructure:"confirm_timeout"`
+		ReconnectInterval         time.Duration `mapstructure:"reconnect_interval"`
+		CACert                    string        `mapstructure:"ca_cert"`
+		TLSCert                   string        `mapstructure:"tls_cert"`
+		TLSKey                    string        `mapstructure:"tls_key"`
+	} `mapstructure:"amqp"`
+
+	GCPPubSub struct {
+		CommandsEnabled     bool          `mapstructure:"commands_enabled"`
+		CredentialsFile     string        `mapstructure:"credentials_file"`
+		ProjectID           string        `mapstructure:"project_id"`
+		CloudRegion         string        `mapstructure:"cloud_region"`
+		RegistryID          string        `mapstructure:"registry_id"`
+		EventTopic          string        `mapstructure:"event_topic"`
+		CommandSubscription string        `mapstructure:"command_subscription"`
+		Endpoint            string        `mapstructure:"endpoint"`
+		Timeout             time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"gcp_pub_sub"`
+
+	AWSSQS struct {
+		CommandsEnabled  bool          `mapstructure:"commands_enabled"`
+		Region           string        `mapstructure:"region"`
+		CredentialSource string        `mapstructure:"credential_source"`
+		AccessKeyID      string        `mapstructure:"access_key_id"`
+		SecretAccessKey  string        `mapstructure:"secret_access_key"`
+		SessionToken     string        `mapstructure:"session_token"`
+		EventTopicARN    string        `mapstructure:"event_topic_arn"`
+		EventQueueURL    string        `mapstructure:"event_queue_url"`
+		CommandQueueURL  string        `mapstructure:"command_queue_url"`
+		SNSEndpoint      string        `mapstructure:"sns_endpoint"`
+		WaitTime         time.Duration `mapstructure:"wait_time"`
+		Timeout          time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"aws_sqs"`
+}
+
+// Command holds the configuration of a gateway command.
+type Command struct {
+	MaxExecutionDuration time.Duration     `mapstructure:"max_execution_duration"`
+	Command              string            `mapstructure:"command"`
+	Stream               bool              `mapstructure:"stream"`
+	StreamChunkSize      int               `mapstructure:"stream_chunk_size"`
+	StreamFlushInterval  time.Duration     `mapstructure:"stream_flush_interval"`
+	Arguments            map[string]string `mapstructure:"arguments"`
+	WorkingDirectory     string            `mapstructure:"working_directory"`
+	Environment          []string          `mapstructure:"environment"`
+	AllowedEnvironment   []string          `mapstructure:"allowed_environment"`
+	MaxConcurrent        int               `mapstructure:"max_concurrent"`
+}
+
+// GatewayIDMapping holds the gateway ID mapping of a gateway.
+type GatewayIDMapping struct {
+	GatewayID       string   `mapstructure:"gateway_id"`
+	MappedGatewayID string   `mapstructure:"mapped_gateway_id"`
+	BoardGatewayIDs []string `mapstructure:"board_gateway_ids"`
+}
+
+// SemtechUDPListener holds the configuration of a Semtech UDP listener.
+type SemtechUDPListener struct {
+	Bind         string         `mapstructure:"bind"`
+	SkipCRCCheck bool           `mapstructure:"skip_crc_check"`
+	FakeRxTime   bool           `mapstructure:"fake_rx_time"`
+	DTLS         SemtechUDPDTLS `mapstructure:"dtls"`
+}
+
+// SemtechUDPDTLS holds the DTLS configuration of a Semtech UDP listener.
+type SemtechUDPDTLS struct {
+	Enabled bool                `mapstructure:"enabled"`
+	PSKs    []SemtechUDPDTLSPSK `mapstructure:"psks"`
+	TLSCert string              `mapstructure:"tls_cert"`
+	TLSKey  string              `mapstructure:"tls_key"`
+	CACert  string              `mapstructure:"ca_cert"`
+}
+
+// SemtechUDPDTLSPSK holds a DTLS pre-shared key and its identity.
+type SemtechUDPDTLSPSK struct {
+	Identity string `mapstructure:"identity"`
+	Key      string `mapstructure:"key"`
+}
+
+// SemtechUDPAllowedGateway holds a gateway of the Semtech UDP allow-list.
+type SemtechUDPAllowedGateway struct {
+	GatewayID string   `mapstructure:"gateway_id"`
+	SourceIPs []string `mapstructure:"source_ips"`
+}
+
+// ConcentratordInstance holds the event and command URLs of a Concentratord
+// instance.
+type ConcentratordInstance struct {
+	EventURL   string `mapstructure:"event_url"`
+	CommandURL string `mapstructure:"command_url"`
+}
+
+// ConcentratordMesh holds the gateway mesh (relay) configuration of the
+// Concentratord backend.
+type ConcentratordMesh struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Region         string `mapstructure:"region"`
+	SigningKey     string `mapstructure:"signing_key"`
+	Frequencies    []int  `mapstructure:"frequencies"`
+	DataRate       int    `mapstructure:"data_rate"`
+	TXPower        int    `mapstructure:"tx_power"`
+	UplinkChannels []int  `mapstructure:"uplink_channels"`
+}
+
+// FineTimestampKey holds the fine-timestamp decryption key of a gateway.
+type FineTimestampKey struct {
+	GatewayID string `mapstructure:"gateway_id"`
+	AESKey    string `mapstructure:"aes_key"`
+}
+
+// AntennaGain holds the TX gain of a gateway antenna.
+type AntennaGain struct {
+	GatewayID string  `mapstructure:"gateway_id"`
+	Antenna   uint32  `mapstructure:"antenna"`
+	Gain      float64 `mapstructure:"gain"`
+}
+
+// AzureIoTHubProvisioning holds the Azure IoT Hub Device Provisioning Service
+// configuration.
+type AzureIoTHubProvisioning struct {
+	IDScope         string        `mapstructure:"id_scope"`
+	RegistrationID  string        `mapstructure:"registration_id"`
+	Endpoint        string        `mapstructure:"endpoint"`
+	SymmetricKey    string        `mapstructure:"symmetric_key"`
+	EnrollmentGroup bool          `mapstructure:"enrollment_group"`
+	StateFile       string        `mapstructure:"state_file"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+}
+
 // BasicStationConcentrator holds the configuration for a BasicStation concentrator.
 type BasicStationConcentrator struct {
 	MultiSF BasicStationConcentratorMultiSF `mapstructure:"multi_sf"`
@@ -136,6 +662,62 @@ type BasicStationConcentrator struct {
 	FSK     BasicStationConcentratorFSK     `mapstructure:"fsk"`
 }
 
+// BasicStationRegionParameters holds the regional parameters of the
+// router-config.
+type BasicStationRegionParameters struct {
+	MaxEIRP   float32       `mapstructure:"max_eirp"`
+	DwellTime time.Duration `mapstructure:"dwell_time"`
+	NoCCA     bool          `mapstructure:"nocca"`
+	NoDC      bool          `mapstructure:"nodc"`
+	NoDwell   bool          `mapstructure:"nodwell"`
+}
+
+// IntegrationRoute holds an uplink routing rule. Uplinks matching the
+// filters of the route are published to the integrations of the route.
+type IntegrationRoute struct {
+	Name            string      `mapstructure:"name"`
+	Integrations    []string    `mapstructure:"integrations"`
+	NetIDs          []string    `mapstructure:"net_ids"`
+	DevAddrPrefixes []string    `mapstructure:"dev_addr_prefixes"`
+	JoinEUIs        [][2]string `mapstructure:"join_euis"`
+}
+
+// BasicStationRoute holds a router-info (discovery) route.
+type BasicStationRoute struct {
+	EUI  string `mapstructure:"eui" json:"eui"`
+	URI  string `mapstructure:"uri" json:"uri"`
+	Muxs string `mapstructure:"muxs" json:"muxs"`
+}
+
+// BasicStationCUPS holds the CUPS (Configuration and Update Server)
+// configuration.
+type BasicStationCUPS struct {
+	Enabled         bool                    `mapstructure:"enabled"`
+	CUPSURI         string                  `mapstructure:"cups_uri"`
+	TCURI           string                  `mapstructure:"tc_uri"`
+	CUPSCredentials BasicStationCredentials `mapstructure:"cups_credentials"`
+	TCCredentials   BasicStationCredentials `mapstructure:"tc_credentials"`
+	Update          BasicStationCUPSUpdate  `mapstructure:"update"`
+}
+
+// BasicStationCredentials holds the credentials which are provisioned to
+// the station by the CUPS endpoint.
+type BasicStationCredentials struct {
+	CACert  string `mapstructure:"ca_cert"`
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+	Token   string `mapstructure:"token"`
+}
+
+// BasicStationCUPSUpdate holds the firmware update configuration of the
+// CUPS endpoint.
+type BasicStationCUPSUpdate struct {
+	Version         string `mapstructure:"version"`
+	File            string `mapstructure:"file"`
+	SignatureFile   string `mapstructure:"signature_file"`
+	SignatureKeyCRC uint32 `mapstructure:"signature_key_crc"`
+}
+
 // BasicStationConcentratorMultiSF holds the multi-SF channels.
 type BasicStationConcentratorMultiSF struct {
 	Frequencies []uint32 `mapstructure:"frequencies"`
@@ -0,0 +1,1394 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/band"
+)
+
+// Check holds the result of a single configuration check.
+type Check struct {
+	// Name of the check (typically the configuration key).
+	Name string
+	// Error (nil when the check passed).
+	Err error
+}
+
+// Validate validates the configuration, without starting any backend or
+// integration or connecting to any external service. It returns the result
+// of each performed check.
+func (c Config) Validate() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	add("general.log_format", validateEnum(c.General.LogFormat, "", "text", "json"))
+	for module, level := range c.General.LogLevels {
+		err := validateEnum(module, "backend", "integration", "metadata", "forwarder", "commands", "filters", "metrics", "health", "webui", "capture")
+		if err == nil && (level < 0 || level > 6) {
+			err = fmt.Errorf("invalid log level %d, expected a value between 0 and 6", level)
+		}
+		add(fmt.Sprintf("general.log_levels.%s", module), err)
+	}
+
+	if c.Hooks.UplinkScript.Path != "" {
+		add("hooks.uplink_script.path", validateFile(c.Hooks.UplinkScript.Path, true))
+
+		var err error
+		if c.Hooks.UplinkScript.Timeout <= 0 {
+			err = errors.New("timeout must be greater than zero")
+		}
+		add("hooks.uplink_script.timeout", err)
+	}
+
+	if c.Filters.Location.MaxSpeed != 0 {
+		var err error
+		if c.Filters.Location.MaxSpeed < 0 {
+			err = errors.New("max_speed must not be negative")
+		}
+		add("filters.location.max_speed", err)
+
+		err = nil
+		if c.Filters.Location.Tolerance < 0 {
+			err = errors.New("tolerance must not be negative")
+		}
+		add("filters.location.tolerance", err)
+		add("filters.location.action", validateEnum(c.Filters.Location.Action, "drop", "flag"))
+	}
+
+	if strings.ContainsAny(c.Backend.Type, ", ") {
+		add("backend.type", errors.New("the backends are mutually exclusive, only one backend can be configured"))
+	} else {
+		add("backend.type", validateEnum(c.Backend.Type, "semtech_udp", "basic_station", "concentratord", "multitech", "simulator"))
+	}
+
+	switch c.Backend.Type {
+	case "semtech_udp":
+		for i, conf := range c.Backend.SemtechUDP.Configuration {
+			add(fmt.Sprintf("backend.semtech_udp.configuration[%d].base_file", i), validateFile(conf.BaseFile, true))
+		}
+
+		for i, l := range c.Backend.SemtechUDP.Listeners {
+			var err error
+			if l.Bind == "" {
+				err = errors.New("bind must be set")
+			}
+			add(fmt.Sprintf("backend.semtech_udp.listeners[%d].bind", i), err)
+
+			if l.DTLS.Enabled {
+				prefix := fmt.Sprintf("backend.semtech_udp.listeners[%d].dtls", i)
+
+				err = nil
+				if len(l.DTLS.PSKs) == 0 && l.DTLS.TLSCert == "" {
+					err = errors.New("at least one psk or the tls_cert must be set")
+				}
+				add(prefix, err)
+
+				add(prefix+".tls_cert", validateFile(l.DTLS.TLSCert, false))
+				add(prefix+".tls_key", validateFile(l.DTLS.TLSKey, false))
+				add(prefix+".ca_cert", validateFile(l.DTLS.CACert, false))
+				add(prefix+".tls_cert / tls_key", validatePair(l.DTLS.TLSCert, l.DTLS.TLSKey))
+
+				for j, psk := range l.DTLS.PSKs {
+					err = nil
+					if psk.Identity == "" {
+						err = errors.New("identity must be set")
+					}
+					add(fmt.Sprintf("%s.psks[%d].identity", prefix, j), err)
+
+					b, err := hex.DecodeString(psk.Key)
+					if err == nil && len(b) == 0 {
+						err = errors.New("key must be set")
+					}
+					add(fmt.Sprintf("%s.psks[%d].key", prefix, j), err)
+				}
+			}
+		}
+
+		for i, ip := range c.Backend.SemtechUDP.AllowList.SourceIPs {
+			add(fmt.Sprintf("backend.semtech_udp.allow_list.source_ips[%d]", i), validateIPNet(ip))
+		}
+
+		for i, gw := range c.Backend.SemtechUDP.AllowList.Gateways {
+			var gatewayID lorawan.EUI64
+			add(fmt.Sprintf("backend.semtech_udp.allow_list.gateways[%d].gateway_id", i), gatewayID.UnmarshalText([]byte(gw.GatewayID)))
+
+			for j, ip := range gw.SourceIPs {
+				add(fmt.Sprintf("backend.semtech_udp.allow_list.gateways[%d].source_ips[%d]", i, j), validateIPNet(ip))
+			}
+		}
+	case "basic_station":
+		_, err := band.GetConfig(band.Name(c.Backend.BasicStation.Region), false, lorawan.DwellTimeNoLimit)
+		add("backend.basic_station.region", err)
+
+		add("backend.basic_station.tls_cert", validateFile(c.Backend.BasicStation.TLSCert, false))
+		add("backend.basic_station.tls_key", validateFile(c.Backend.BasicStation.TLSKey, false))
+		add("backend.basic_station.ca_cert", validateFile(c.Backend.BasicStation.CACert, false))
+		add("backend.basic_station.tls_cert / tls_key", validatePair(c.Backend.BasicStation.TLSCert, c.Backend.BasicStation.TLSKey))
+
+		if c.Backend.BasicStation.DIIDStore.File != "" {
+			add("backend.basic_station.diid_store.file", validateDir(filepath.Dir(c.Backend.BasicStation.DIIDStore.File)))
+		}
+
+		err = nil
+		if c.Backend.BasicStation.DIIDStore.MaxAge < 0 {
+			err = errors.New("max_age must not be negative")
+		}
+		add("backend.basic_station.diid_store.max_age", err)
+
+		auth := c.Backend.BasicStation.Authorization
+		if auth.File != "" && auth.HTTPURL != "" {
+			add("backend.basic_station.authorization", errors.New("only one of file and http_url can be set"))
+		}
+		add("backend.basic_station.authorization.file", validateFile(auth.File, false))
+		if auth.HTTPURL != "" {
+			add("backend.basic_station.authorization.http_url", validateURL(auth.HTTPURL, "http", "https"))
+		}
+
+		if c.Backend.BasicStation.RouterInfo.LookupURL != "" {
+			add("backend.basic_station.router_info.lookup_url", validateURL(c.Backend.BasicStation.RouterInfo.LookupURL, "http", "https"))
+		}
+
+		if c.Backend.BasicStation.CUPS.Enabled {
+			checks = append(checks, c.validateCUPS()...)
+		}
+	case "concentratord":
+		add("backend.concentratord.bandwidth_unit", validateEnum(c.Backend.Concentratord.BandwidthUnit, "", "auto", "hz", "khz"))
+
+		if c.Backend.Concentratord.Mesh.Enabled {
+			mesh := c.Backend.Concentratord.Mesh
+
+			b, err := band.GetConfig(band.Name(mesh.Region), false, lorawan.DwellTimeNoLimit)
+			add("backend.concentratord.mesh.region", err)
+			if err == nil {
+				dr, err := b.GetDataRate(mesh.DataRate)
+				if err == nil && dr.Modulation != band.LoRaModulation {
+					err = errors.New("data_rate must use LoRa modulation")
+				}
+				add("backend.concentratord.mesh.data_rate", err)
+			}
+
+			var key lorawan.AES128Key
+			add("backend.concentratord.mesh.signing_key", key.UnmarshalText([]byte(mesh.SigningKey)))
+
+			err = nil
+			if len(mesh.Frequencies) == 0 {
+				err = errors.New("at least one frequency must be set")
+			}
+			add("backend.concentratord.mesh.frequencies", err)
+		}
+	case "multitech":
+		add("backend.multitech.server", validateURL(c.Backend.Multitech.Server, "tcp", "ssl", "tcps"))
+
+		var err error
+		if c.Backend.Multitech.TopicPrefix == "" || strings.ContainsAny(c.Backend.Multitech.TopicPrefix, "+#") {
+			err = errors.New("topic_prefix must be set and must not contain '+' or '#'")
+		}
+		add("backend.multitech.topic_prefix", err)
+
+		if c.Backend.Multitech.QOS > 2 {
+			add("backend.multitech.qos", fmt.Errorf("invalid value %d, expected one of: 0, 1, 2", c.Backend.Multitech.QOS))
+		}
+	case "simulator":
+		sim := c.Backend.Simulator
+
+		var err error
+		if sim.Gateways <= 0 {
+			err = errors.New("gateways must be greater than zero")
+		}
+		add("backend.simulator.gateways", err)
+
+		var gatewayID lorawan.EUI64
+		add("backend.simulator.base_gateway_id", gatewayID.UnmarshalText([]byte(sim.BaseGatewayID)))
+
+		err = nil
+		if sim.UplinkInterval <= 0 {
+			err = errors.New("the uplink_interval must be greater than zero")
+		}
+		add("backend.simulator.uplink_interval", err)
+
+		err = nil
+		if sim.StatsInterval <= 0 {
+			err = errors.New("the stats_interval must be greater than zero")
+		}
+		add("backend.simulator.stats_interval", err)
+
+		err = nil
+		if sim.PayloadSize < 0 || sim.PayloadSize > 242 {
+			err = fmt.Errorf("invalid value %d, expected a value between 0 and 242", sim.PayloadSize)
+		}
+		add("backend.simulator.payload_size", err)
+
+		err = nil
+		if len(sim.Frequencies) == 0 {
+			err = errors.New("at least one frequency must be set")
+		}
+		add("backend.simulator.frequencies", err)
+
+		err = nil
+		if len(sim.SpreadingFactors) == 0 {
+			err = errors.New("at least one spreading-factor must be set")
+		}
+		for _, sf := range sim.SpreadingFactors {
+			if sf < 5 || sf > 12 {
+				err = fmt.Errorf("invalid value %d, expected a value between 5 and 12", sf)
+			}
+		}
+		add("backend.simulator.spreading_factors", err)
+
+		add("backend.simulator.bandwidth", validateEnum(strconv.Itoa(sim.Bandwidth), "125", "250", "500"))
+	}
+
+	add("backend.channels.drop_policy", validateEnum(c.Backend.Channels.DropPolicy, "", "block", "drop_oldest"))
+	for _, size := range []struct {
+		name  string
+		value int
+	}{
+		{"uplink_frame_size", c.Backend.Channels.UplinkFrameSize},
+		{"gateway_stats_size", c.Backend.Channels.GatewayStatsSize},
+		{"downlink_tx_ack_size", c.Backend.Channels.DownlinkTXAckSize},
+		{"raw_packet_forwarder_event_size", c.Backend.Channels.RawPacketForwarderEventSize},
+		{"log_event_size", c.Backend.Channels.LogEventSize},
+	} {
+		var err error
+		if size.value < 0 {
+			err = fmt.Errorf("%s must not be negative", size.name)
+		}
+		add("backend.channels."+size.name, err)
+	}
+
+	if c.Backend.Scheduler.Enabled {
+		var err error
+		if c.Backend.Scheduler.DispatchAhead <= 0 {
+			err = errors.New("dispatch_ahead must be greater than zero")
+		}
+		add("backend.scheduler.dispatch_ahead", err)
+
+		err = nil
+		if c.Backend.Scheduler.MaxQueueDuration != 0 && c.Backend.Scheduler.MaxQueueDuration < c.Backend.Scheduler.DispatchAhead {
+			err = errors.New("max_queue_duration must be greater than dispatch_ahead")
+		}
+		add("backend.scheduler.max_queue_duration", err)
+
+		if c.Backend.Scheduler.QueueFile != "" {
+			add("backend.scheduler.queue_file", validateDir(filepath.Dir(c.Backend.Scheduler.QueueFile)))
+		}
+	}
+
+	if c.Backend.ConnState.KeepaliveTimeout < 0 {
+		add("backend.conn_state.keepalive_timeout", errors.New("keepalive_timeout must not be negative"))
+	}
+
+	// the gateway IDs and the mapped gateway IDs must be unique, else the
+	// mapping would be ambiguous
+	gatewayIDs := make(map[lorawan.EUI64]bool)
+	mappedGatewayIDs := make(map[lorawan.EUI64]bool)
+	for i, mapping := range c.Backend.GatewayIDMapping {
+		prefix := fmt.Sprintf("backend.gateway_id_mapping[%d]", i)
+
+		var gatewayID lorawan.EUI64
+		err := gatewayID.UnmarshalText([]byte(mapping.GatewayID))
+		if err == nil && gatewayIDs[gatewayID] {
+			err = fmt.Errorf("gateway_id %s is mapped more than once", gatewayID)
+		}
+		gatewayIDs[gatewayID] = true
+		add(prefix+".gateway_id", err)
+
+		var mappedGatewayID lorawan.EUI64
+		err = mappedGatewayID.UnmarshalText([]byte(mapping.MappedGatewayID))
+		if err == nil && mappedGatewayIDs[mappedGatewayID] {
+			err = fmt.Errorf("gateway ID %s is used more than once as mapped gateway ID", mappedGatewayID)
+		}
+		mappedGatewayIDs[mappedGatewayID] = true
+		add(prefix+".mapped_gateway_id", err)
+
+		for j, s := range mapping.BoardGatewayIDs {
+			var boardGatewayID lorawan.EUI64
+			err := boardGatewayID.UnmarshalText([]byte(s))
+			if err == nil && mappedGatewayIDs[boardGatewayID] {
+				err = fmt.Errorf("gateway ID %s is used more than once as mapped gateway ID", boardGatewayID)
+			}
+			mappedGatewayIDs[boardGatewayID] = true
+			add(fmt.Sprintf("%s.board_gateway_ids[%d]", prefix, j), err)
+		}
+	}
+
+	checks = append(checks, c.validateIntegration()...)
+
+	if c.Mirror.Enabled {
+		var err error
+		if c.Mirror.QueueSize <= 0 {
+			err = errors.New("queue_size must be greater than zero")
+		}
+		add("mirror.queue_size", err)
+
+		// the mirror integration is validated using the same checks as the
+		// integration
+		mc := c
+		mc.Integration = c.Mirror.Integration
+		for _, check := range mc.validateIntegration() {
+			add("mirror."+check.Name, check.Err)
+		}
+	}
+
+	if c.HighAvailability.Enabled {
+		ha := c.HighAvailability
+
+		var err error
+		if ha.LockTopic == "" {
+			err = errors.New("lock_topic must be set")
+		}
+		add("high_availability.lock_topic", err)
+
+		err = nil
+		if ha.HeartbeatInterval <= 0 {
+			err = errors.New("heartbeat_interval must be greater than zero")
+		}
+		add("high_availability.heartbeat_interval", err)
+
+		err = nil
+		if ha.LeaseDuration < 2*ha.HeartbeatInterval {
+			err = errors.New("lease_duration must be at least twice the heartbeat_interval")
+		}
+		add("high_availability.lease_duration", err)
+
+		add("high_availability.mqtt.server", validateURL(ha.MQTT.Server, "tcp", "ssl", "ws", "wss"))
+		add("high_availability.mqtt.ca_cert", validateFile(ha.MQTT.CACert, false))
+		add("high_availability.mqtt.tls_cert / tls_key", validatePair(ha.MQTT.TLSCert, ha.MQTT.TLSKey))
+	}
+
+	if c.Forwarder.DutyCycle.Enabled {
+		add("forwarder.duty_cycle.region", validateEnum(c.Forwarder.DutyCycle.Region, "EU868", "EU433"))
+
+		var err error
+		if c.Forwarder.DutyCycle.Window <= 0 {
+			err = errors.New("the window must be greater than zero")
+		}
+		add("forwarder.duty_cycle.window", err)
+	}
+
+	if c.Forwarder.LBT.Enabled {
+		add("forwarder.lbt.region", validateEnum(c.Forwarder.LBT.Region, "AS923", "KR920"))
+
+		var err error
+		if c.Forwarder.LBT.ChannelBusyBackoff < 0 {
+			err = errors.New("the back-off must not be negative")
+		}
+		add("forwarder.lbt.channel_busy_backoff", err)
+	}
+
+	if c.Forwarder.DownlinkValidation.Enabled {
+		add("forwarder.downlink_validation.region", validateEnum(c.Forwarder.DownlinkValidation.Region, "EU868", "EU433", "US915", "AU915", "AS923", "KR920", "IN865", "CN470", "CN779", "RU864", "ISM2400"))
+
+		var err error
+		if c.Forwarder.DownlinkValidation.MaxTXPower < 0 {
+			err = errors.New("max_tx_power must not be negative")
+		}
+		add("forwarder.downlink_validation.max_tx_power", err)
+	}
+
+	if c.Forwarder.RateLimit.Enabled {
+		var err error
+		if c.Forwarder.RateLimit.EventsPerSecond <= 0 {
+			err = errors.New("events_per_second must be greater than zero")
+		}
+		add("forwarder.rate_limit.events_per_second", err)
+
+		err = nil
+		if c.Forwarder.RateLimit.Burst < 1 {
+			err = errors.New("burst must be at least 1")
+		}
+		add("forwarder.rate_limit.burst", err)
+	}
+
+	if c.Forwarder.DownlinkRetry.Enabled {
+		retry := c.Forwarder.DownlinkRetry
+
+		for i, e := range retry.Errors {
+			add(fmt.Sprintf("forwarder.downlink_retry.errors[%d]", i), validateEnum(e, "TOO_LATE", "TOO_EARLY", "COLLISION_PACKET", "COLLISION_BEACON", "TX_FREQ", "TX_POWER", "GPS_UNLOCKED", "CHANNEL_BUSY"))
+		}
+
+		b, err := band.GetConfig(band.Name(retry.Region), false, lorawan.DwellTimeNoLimit)
+		add("forwarder.downlink_retry.region", err)
+		if err == nil && retry.RX2DataRate != -1 {
+			dr, err := b.GetDataRate(retry.RX2DataRate)
+			if err == nil && dr.Modulation != band.LoRaModulation {
+				err = errors.New("rx2_data_rate must use LoRa modulation")
+			}
+			add("forwarder.downlink_retry.rx2_data_rate", err)
+		}
+	}
+
+	if c.Forwarder.Deduplication.Enabled {
+		var err error
+		if c.Forwarder.Deduplication.Window <= 0 {
+			err = errors.New("the window must be greater than zero")
+		}
+		add("forwarder.deduplication.window", err)
+	}
+
+	if c.Forwarder.StatsAggregation.Enabled {
+		var err error
+		if c.Forwarder.StatsAggregation.Interval <= 0 {
+			err = errors.New("the interval must be greater than zero")
+		}
+		add("forwarder.stats_aggregation.interval", err)
+	}
+
+	if c.Forwarder.StatsCounters.Enabled {
+		var err error
+		if c.Forwarder.StatsCounters.File == "" {
+			err = errors.New("the file must be set")
+		} else {
+			err = validateDir(filepath.Dir(filepath.Clean(c.Forwarder.StatsCounters.File)))
+		}
+		add("forwarder.stats_counters.file", err)
+
+		err = nil
+		if c.Forwarder.StatsCounters.SaveInterval <= 0 {
+			err = errors.New("the save_interval must be greater than zero")
+		}
+		add("forwarder.stats_counters.save_interval", err)
+
+		err = nil
+		if _, ok := c.Commands.Commands["reset_stats_counters"]; ok {
+			err = errors.New("the reset_stats_counters command is reserved for the built-in reset stats counters command")
+		}
+		add("commands.commands.reset_stats_counters", err)
+	}
+
+	if c.Forwarder.FineTimestamp.AESKey != "" {
+		var key lorawan.AES128Key
+		add("forwarder.fine_timestamp.aes_key", key.UnmarshalText([]byte(c.Forwarder.FineTimestamp.AESKey)))
+	}
+
+	for i, gw := range c.Forwarder.FineTimestamp.Gateways {
+		var gatewayID lorawan.EUI64
+		var key lorawan.AES128Key
+		add(fmt.Sprintf("forwarder.fine_timestamp.gateways[%d].gateway_id", i), gatewayID.UnmarshalText([]byte(gw.GatewayID)))
+		add(fmt.Sprintf("forwarder.fine_timestamp.gateways[%d].aes_key", i), key.UnmarshalText([]byte(gw.AESKey)))
+	}
+
+	antennaGains := make(map[string]bool)
+	for i, ag := range c.Forwarder.AntennaGain {
+		prefix := fmt.Sprintf("forwarder.antenna_gain[%d]", i)
+
+		if ag.GatewayID != "" {
+			var gatewayID lorawan.EUI64
+			add(prefix+".gateway_id", gatewayID.UnmarshalText([]byte(ag.GatewayID)))
+		}
+
+		key := fmt.Sprintf("%s/%d", strings.ToLower(ag.GatewayID), ag.Antenna)
+		if antennaGains[key] {
+			add(prefix+".antenna", fmt.Errorf("gain of antenna %d is configured more than once", ag.Antenna))
+		}
+		antennaGains[key] = true
+	}
+
+	if c.Metrics.SNMP.Enabled {
+		_, _, err := net.SplitHostPort(c.Metrics.SNMP.Bind)
+		add("metrics.snmp.bind", err)
+
+		err = nil
+		if c.Metrics.SNMP.Community == "" {
+			err = errors.New("community must be set")
+		}
+		add("metrics.snmp.community", err)
+		add("metrics.snmp.oid_prefix", validateOID(c.Metrics.SNMP.OIDPrefix))
+	}
+
+	if c.Tracing.Enabled {
+		add("tracing.endpoint", validateURL(c.Tracing.Endpoint, "http", "https"))
+
+		var err error
+		if c.Tracing.ExportInterval <= 0 {
+			err = errors.New("export_interval must be greater than zero")
+		}
+		add("tracing.export_interval", err)
+
+		err = nil
+		if c.Tracing.QueueSize <= 0 {
+			err = errors.New("queue_size must be greater than zero")
+		}
+		add("tracing.queue_size", err)
+	}
+
+	if c.WebUI.Enabled {
+		_, _, err := net.SplitHostPort(c.WebUI.Bind)
+		add("web_ui.bind", err)
+
+		err = nil
+		if c.WebUI.MaxFrames <= 0 {
+			err = errors.New("max_frames must be greater than 0")
+		}
+		add("web_ui.max_frames", err)
+	}
+
+	if c.Capture.Path != "" {
+		add("capture.path", validateDir(filepath.Dir(filepath.Clean(c.Capture.Path))))
+
+		var err error
+		if c.Capture.FileMaxFrames <= 0 {
+			err = errors.New("file_max_frames must be greater than 0")
+		}
+		add("capture.file_max_frames", err)
+
+		err = nil
+		if c.Capture.MaxFiles <= 0 {
+			err = errors.New("max_files must be greater than 0")
+		}
+		add("capture.max_files", err)
+
+		err = nil
+		if _, ok := c.Commands.Commands["capture_dump"]; ok {
+			err = errors.New("the capture_dump command is reserved for the built-in frame capture command")
+		}
+		add("commands.commands.capture_dump", err)
+	}
+
+	if _, ok := c.Commands.Commands["purge_downlinks"]; ok {
+		add("commands.commands.purge_downlinks", errors.New("the purge_downlinks command is reserved for the built-in purge downlinks command"))
+	}
+
+	for name, cmd := range c.Commands.Commands {
+		prefix := "commands.commands." + name
+
+		for arg, re := range cmd.Arguments {
+			_, err := regexp.Compile(re)
+			add(fmt.Sprintf("%s.arguments.%s", prefix, arg), err)
+		}
+
+		if cmd.WorkingDirectory != "" {
+			add(prefix+".working_directory", validateDir(cmd.WorkingDirectory))
+		}
+
+		for i, env := range cmd.Environment {
+			var err error
+			if strings.Index(env, "=") < 1 {
+				err = fmt.Errorf("invalid value '%s', expected KEY=VALUE", env)
+			}
+			add(fmt.Sprintf("%s.environment[%d]", prefix, i), err)
+		}
+
+		var err error
+		if cmd.MaxConcurrent < 0 {
+			err = errors.New("max_concurrent must not be negative")
+		}
+		add(prefix+".max_concurrent", err)
+	}
+
+	if c.TimeSync.Enabled {
+		var err error
+		if c.TimeSync.Window <= 0 {
+			err = errors.New("window must be greater than 0")
+		}
+		add("timesync.window", err)
+	}
+
+	if c.MetaData.GPSD.Enabled {
+		_, _, err := net.SplitHostPort(c.MetaData.GPSD.Server)
+		add("meta_data.gpsd.server", err)
+	}
+
+	if c.MetaData.System.Enabled && c.MetaData.System.DiskPath != "" {
+		add("meta_data.system.disk_path", validateDir(c.MetaData.System.DiskPath))
+	}
+
+	return checks
+}
+
+// ValidationError returns an error containing all failed checks, or nil
+// when all checks passed.
+func ValidationError(checks []Check) error {
+	var errs []string
+	for _, check := range checks {
+		if check.Err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", check.Name, check.Err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+func (c Config) validateIntegration() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	add("integration.marshaler", validateEnum(c.Integration.Marshaler, "json", "protobuf_json", "protobuf", "cbor"))
+	for event, marshaler := range c.Integration.EventMarshalers {
+		err := validateEnum(event, "up", "up_set", "stats", "ack", "exec", "raw", "log", "conn")
+		if err == nil {
+			err = validateEnum(marshaler, "json", "protobuf_json", "protobuf", "cbor")
+		}
+		add(fmt.Sprintf("integration.event_marshalers.%s", event), err)
+	}
+	add("integration.api_version", validateEnum(c.Integration.APIVersion, "", "v3", "v4"))
+
+	enabled := c.Integration.Enabled
+	if len(enabled) == 0 {
+		enabled = []string{"mqtt"}
+	}
+	seen := make(map[string]bool)
+	for _, name := range enabled {
+		err := validateEnum(name, "mqtt", "kafka", "grpc", "nats", "http", "amqp", "gcp_pub_sub", "aws_sqs", "plugin", "semtech_udp")
+		if err == nil && seen[name] {
+			err = fmt.Errorf("integration '%s' is enabled more than once", name)
+		}
+		seen[name] = true
+		add("integration.enabled", err)
+	}
+
+	routeNames := make(map[string]bool)
+	for i, rt := range c.Integration.Routes {
+		prefix := fmt.Sprintf("integration.routes[%d]", i)
+
+		var err error
+		if rt.Name == "" {
+			err = errors.New("name must be set")
+		} else if routeNames[rt.Name] {
+			err = fmt.Errorf("route '%s' is configured more than once", rt.Name)
+		}
+		routeNames[rt.Name] = true
+		add(prefix+".name", err)
+
+		err = nil
+		if len(rt.Integrations) == 0 {
+			err = errors.New("integrations must be set")
+		}
+		add(prefix+".integrations", err)
+		for _, name := range rt.Integrations {
+			err = nil
+			if !seen[name] {
+				err = fmt.Errorf("integration '%s' is not enabled", name)
+			}
+			add(prefix+".integrations", err)
+		}
+
+		for _, s := range rt.NetIDs {
+			var netID lorawan.NetID
+			add(prefix+".net_ids", netID.UnmarshalText([]byte(s)))
+		}
+
+		for _, s := range rt.DevAddrPrefixes {
+			add(prefix+".dev_addr_prefixes", validateDevAddrPrefix(s))
+		}
+
+		for _, set := range rt.JoinEUIs {
+			for _, s := range set {
+				var joinEUI lorawan.EUI64
+				add(prefix+".join_euis", joinEUI.UnmarshalText([]byte(s)))
+			}
+		}
+	}
+
+	if seen["mqtt"] {
+		checks = append(checks, c.validateMQTT()...)
+	}
+
+	if seen["kafka"] {
+		checks = append(checks, c.validateKafka()...)
+	}
+
+	if seen["grpc"] {
+		var err error
+		if c.Integration.GRPC.Server == "" {
+			err = errors.New("server must be set")
+		}
+		add("integration.grpc.server", err)
+
+		if c.Integration.GRPC.TLS {
+			add("integration.grpc.ca_cert", validateFile(c.Integration.GRPC.CACert, false))
+			add("integration.grpc.tls_cert", validateFile(c.Integration.GRPC.TLSCert, false))
+			add("integration.grpc.tls_key", validateFile(c.Integration.GRPC.TLSKey, false))
+			add("integration.grpc.tls_cert / tls_key", validatePair(c.Integration.GRPC.TLSCert, c.Integration.GRPC.TLSKey))
+		}
+	}
+
+	if seen["nats"] {
+		checks = append(checks, c.validateNATS()...)
+	}
+
+	if seen["http"] {
+		checks = append(checks, c.validateHTTP()...)
+	}
+
+	if seen["amqp"] {
+		checks = append(checks, c.validateAMQP()...)
+	}
+
+	if seen["gcp_pub_sub"] {
+		checks = append(checks, c.validateGCPPubSub()...)
+	}
+	if seen["aws_sqs"] {
+		checks = append(checks, c.validateAWSSQS()...)
+	}
+
+	if seen["plugin"] {
+		add("integration.plugin.path", validateFile(c.Integration.Plugin.Path, true))
+
+		var err error
+		if c.Integration.Plugin.RestartInterval <= 0 {
+			err = errors.New("restart_interval must be greater than zero")
+		}
+		add("integration.plugin.restart_interval", err)
+	}
+
+	if seen["semtech_udp"] {
+		_, _, err := net.SplitHostPort(c.Integration.SemtechUDP.Server)
+		add("integration.semtech_udp.server", err)
+
+		err = nil
+		if c.Integration.SemtechUDP.KeepaliveInterval <= 0 {
+			err = errors.New("keepalive_interval must be greater than zero")
+		}
+		add("integration.semtech_udp.keepalive_interval", err)
+	}
+
+	return checks
+}
+
+func (c Config) validateMQTT() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	mqtt := c.Integration.MQTT
+
+	// The topic templates are only used by the generic and aws_iot
+	// authentication types, the others have fixed topics.
+	if mqtt.Auth.Type == "generic" || mqtt.Auth.Type == "aws_iot" {
+		add("integration.mqtt.event_topic_template", validateTemplate(mqtt.EventTopicTemplate, struct {
+			GatewayID       lorawan.EUI64
+			EventType       string
+			Marshaler       string
+			ContentEncoding string
+		}{}))
+		add("integration.mqtt.command_topic_template", validateTemplate(mqtt.CommandTopicTemplate, struct{ GatewayID lorawan.EUI64 }{}))
+	}
+
+	if mqtt.SharedSubscriptionGroup != "" {
+		var err error
+		if mqtt.Auth.Type != "generic" && mqtt.Auth.Type != "aws_iot" {
+			err = errors.New("shared subscriptions require the generic or aws_iot authentication type")
+		} else if strings.ContainsAny(mqtt.SharedSubscriptionGroup, "/+#") {
+			err = errors.New("group must not contain '/', '+' or '#'")
+		}
+		add("integration.mqtt.shared_subscription_group", err)
+	}
+
+	if mqtt.V5.SessionExpiryInterval < 0 {
+		add("integration.mqtt.v5.session_expiry_interval", errors.New("session_expiry_interval must not be negative"))
+	}
+
+	if mqtt.StoreAndForward.Path != "" {
+		add("integration.mqtt.store_and_forward.path", validateDir(filepath.Dir(mqtt.StoreAndForward.Path)))
+	}
+
+	if mqtt.StoreAndForward.ReplayRetention != 0 {
+		var err error
+		if mqtt.StoreAndForward.Path == "" {
+			err = errors.New("replay_retention requires the path to be set")
+		}
+		add("integration.mqtt.store_and_forward.replay_retention", err)
+	}
+
+	add("integration.mqtt.compression.algorithm", validateEnum(mqtt.Compression.Algorithm, "", "none", "gzip", "zstd"))
+	if mqtt.Compression.MinSize < 0 {
+		add("integration.mqtt.compression.min_size", errors.New("min_size must not be negative"))
+	}
+
+	if mqtt.RemoteConfig.Enabled {
+		add("integration.mqtt.remote_config.state_topic_template", validateTemplate(mqtt.RemoteConfig.StateTopicTemplate, struct{ Hostname string }{}))
+		add("integration.mqtt.remote_config.config_topic_template", validateTemplate(mqtt.RemoteConfig.ConfigTopicTemplate, struct{ Hostname string }{}))
+	}
+
+	for event, qos := range mqtt.EventQOS {
+		err := validateEnum(event, "up", "up_set", "stats", "ack", "exec", "raw", "log", "conn")
+		if err == nil && qos > 2 {
+			err = fmt.Errorf("invalid value %d, expected one of: 0, 1, 2", qos)
+		}
+		add(fmt.Sprintf("integration.mqtt.event_qos.%s", event), err)
+	}
+	for i, event := range mqtt.RetainedEvents {
+		add(fmt.Sprintf("integration.mqtt.retained_events[%d]", i), validateEnum(event, "up", "up_set", "stats", "ack", "exec", "raw", "log", "conn"))
+	}
+
+	add("integration.mqtt.auth.type", validateEnum(mqtt.Auth.Type, "generic", "gcp_cloud_iot_core", "azure_iot_hub", "aws_iot"))
+
+	switch mqtt.ProtocolVersion {
+	case 4:
+	case 5:
+		// The cloud-provider authentication types only support MQTT 3.1.1
+		// (or require websockets).
+		if mqtt.Auth.Type != "generic" {
+			add("integration.mqtt.protocol_version", errors.New("protocol version 5 requires the generic authentication type"))
+		}
+		for _, server := range mqtt.Auth.Generic.Servers {
+			// unix sockets are validated below
+			if strings.HasPrefix(server, "unix://") {
+				continue
+			}
+			add("integration.mqtt.auth.generic.servers", validateURL(server, "tcp", "mqtt", "ssl", "tls", "tcps", "mqtts"))
+		}
+	default:
+		add("integration.mqtt.protocol_version", fmt.Errorf("invalid value %d, expected one of: 4, 5", mqtt.ProtocolVersion))
+	}
+
+	switch mqtt.Auth.Type {
+	case "generic":
+		var err error
+		if len(mqtt.Auth.Generic.Servers) == 0 {
+			err = errors.New("at least one server must be configured")
+		}
+		for _, server := range mqtt.Auth.Generic.Servers {
+			if strings.HasPrefix(server, "unix://") && strings.TrimPrefix(server, "unix://") == "" {
+				err = errors.New("the path of the unix socket must be set")
+			}
+		}
+		add("integration.mqtt.auth.generic.servers", err)
+		add("integration.mqtt.auth.generic.ca_cert", validateFile(mqtt.Auth.Generic.CACert, false))
+		add("integration.mqtt.auth.generic.tls_cert", validateFile(mqtt.Auth.Generic.TLSCert, false))
+		add("integration.mqtt.auth.generic.tls_key", validateFile(mqtt.Auth.Generic.TLSKey, false))
+		add("integration.mqtt.auth.generic.tls_cert / tls_key", validatePair(mqtt.Auth.Generic.TLSCert, mqtt.Auth.Generic.TLSKey))
+
+		err = nil
+		if mqtt.Auth.Generic.PrimaryCheckInterval < 0 {
+			err = errors.New("primary_check_interval must not be negative")
+		}
+		add("integration.mqtt.auth.generic.primary_check_interval", err)
+
+		if cc := mqtt.Auth.Generic.ClientCertificate; cc.CACert != "" || cc.CAKey != "" {
+			add("integration.mqtt.auth.generic.client_certificate.ca_cert", validateFile(cc.CACert, true))
+			add("integration.mqtt.auth.generic.client_certificate.ca_key", validateFile(cc.CAKey, true))
+
+			err = nil
+			if cc.CommonName == "" {
+				err = errors.New("common_name must be set")
+			}
+			add("integration.mqtt.auth.generic.client_certificate.common_name", err)
+
+			err = nil
+			if cc.RenewBefore <= 0 || cc.RenewBefore >= cc.Lifetime {
+				err = errors.New("renew_before must be greater than zero and less than the lifetime")
+			}
+			add("integration.mqtt.auth.generic.client_certificate.renew_before", err)
+
+			err = nil
+			if mqtt.Auth.Generic.TLSCert != "" {
+				err = errors.New("tls_cert / tls_key can not be used together with the client_certificate")
+			}
+			add("integration.mqtt.auth.generic.client_certificate", err)
+		}
+	case "gcp_cloud_iot_core":
+		add("integration.mqtt.auth.gcp_cloud_iot_core.jwt_key_file", validateFile(mqtt.Auth.GCPCloudIoTCore.JWTKeyFile, true))
+	case "azure_iot_hub":
+		add("integration.mqtt.auth.azure_iot_hub.tls_cert", validateFile(mqtt.Auth.AzureIoTHub.TLSCert, false))
+		add("integration.mqtt.auth.azure_iot_hub.tls_key", validateFile(mqtt.Auth.AzureIoTHub.TLSKey, false))
+		add("integration.mqtt.auth.azure_iot_hub.tls_cert / tls_key", validatePair(mqtt.Auth.AzureIoTHub.TLSCert, mqtt.Auth.AzureIoTHub.TLSKey))
+
+		if mqtt.Auth.AzureIoTHub.DirectMethods {
+			var err error
+			if c.Integration.Marshaler != "json" {
+				err = fmt.Errorf("direct_methods requires the json marshaler, got: '%s'", c.Integration.Marshaler)
+			}
+			add("integration.mqtt.auth.azure_iot_hub.direct_methods", err)
+		}
+
+		if p := mqtt.Auth.AzureIoTHub.Provisioning; p.IDScope != "" {
+			var err error
+			if p.RegistrationID == "" {
+				err = errors.New("registration_id must be set when id_scope is set")
+			}
+			add("integration.mqtt.auth.azure_iot_hub.provisioning.registration_id", err)
+
+			err = nil
+			if p.SymmetricKey == "" && mqtt.Auth.AzureIoTHub.TLSCert == "" {
+				err = errors.New("symmetric_key or tls_cert / tls_key must be set when id_scope is set")
+			} else if p.SymmetricKey != "" {
+				_, err = base64.StdEncoding.DecodeString(p.SymmetricKey)
+			}
+			add("integration.mqtt.auth.azure_iot_hub.provisioning.symmetric_key", err)
+
+			err = nil
+			if p.Timeout <= 0 {
+				err = errors.New("the timeout must be greater than zero")
+			}
+			add("integration.mqtt.auth.azure_iot_hub.provisioning.timeout", err)
+		}
+	case "aws_iot":
+		add("integration.mqtt.auth.aws_iot.mode", validateEnum(mqtt.Auth.AWSIoT.Mode, "websocket_sigv4", "custom_authorizer", "x509"))
+		if mqtt.Auth.AWSIoT.Mode == "websocket_sigv4" {
+			add("integration.mqtt.auth.aws_iot.credential_source", validateEnum(mqtt.Auth.AWSIoT.CredentialSource, "static", "env", "ec2", "ecs"))
+		}
+		add("integration.mqtt.auth.aws_iot.ca_cert", validateFile(mqtt.Auth.AWSIoT.CACert, false))
+		if mqtt.Auth.AWSIoT.Mode == "x509" {
+			add("integration.mqtt.auth.aws_iot.tls_cert", validateFile(mqtt.Auth.AWSIoT.TLSCert, true))
+			add("integration.mqtt.auth.aws_iot.tls_key", validateFile(mqtt.Auth.AWSIoT.TLSKey, true))
+		}
+		if mqtt.Auth.AWSIoT.Shadow.Enabled {
+			add("integration.mqtt.auth.aws_iot.shadow.thing_name_template", validateTemplate(mqtt.Auth.AWSIoT.Shadow.ThingNameTemplate, struct{ GatewayID lorawan.EUI64 }{}))
+		}
+	}
+
+	return checks
+}
+
+func (c Config) validateCUPS() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	cups := c.Backend.BasicStation.CUPS
+
+	for _, cred := range []struct {
+		name string
+		BasicStationCredentials
+	}{
+		{"tc_credentials", cups.TCCredentials},
+		{"cups_credentials", cups.CUPSCredentials},
+	} {
+		prefix := "backend.basic_station.cups." + cred.name
+		add(prefix+".ca_cert", validateFile(cred.CACert, cred.TLSCert != "" || cred.Token != ""))
+		add(prefix+".tls_cert", validateFile(cred.TLSCert, false))
+		add(prefix+".tls_key", validateFile(cred.TLSKey, false))
+		add(prefix+".tls_cert / tls_key", validatePair(cred.TLSCert, cred.TLSKey))
+	}
+
+	if cups.Update.File != "" {
+		add("backend.basic_station.cups.update.file", validateFile(cups.Update.File, true))
+		add("backend.basic_station.cups.update.signature_file", validateFile(cups.Update.SignatureFile, true))
+	}
+
+	return checks
+}
+
+func (c Config) validateKafka() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	kafka := c.Integration.Kafka
+
+	var err error
+	if len(kafka.Brokers) == 0 {
+		err = errors.New("at least one broker must be configured")
+	}
+	add("integration.kafka.brokers", err)
+
+	add("integration.kafka.event_topic_template", validateTemplate(kafka.EventTopicTemplate, struct {
+		GatewayID lorawan.EUI64
+		EventType string
+		Marshaler string
+	}{}))
+
+	if kafka.CommandsEnabled {
+		err = nil
+		if kafka.CommandTopic == "" || kafka.ConsumerGroup == "" {
+			err = errors.New("command_topic and consumer_group must be set when commands are enabled")
+		}
+		add("integration.kafka.command_topic", err)
+	}
+
+	add("integration.kafka.sasl.mechanism", validateEnum(kafka.SASL.Mechanism, "", "plain", "scram_sha_256", "scram_sha_512"))
+
+	if kafka.TLS {
+		add("integration.kafka.ca_cert", validateFile(kafka.CACert, false))
+		add("integration.kafka.tls_cert", validateFile(kafka.TLSCert, false))
+		add("integration.kafka.tls_key", validateFile(kafka.TLSKey, false))
+		add("integration.kafka.tls_cert / tls_key", validatePair(kafka.TLSCert, kafka.TLSKey))
+	}
+
+	return checks
+}
+
+func (c Config) validateNATS() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	nats := c.Integration.NATS
+
+	var err error
+	if len(nats.Servers) == 0 {
+		err = errors.New("at least one server must be configured")
+	}
+	add("integration.nats.servers", err)
+
+	add("integration.nats.event_subject_template", validateTemplate(nats.EventSubjectTemplate, struct {
+		GatewayID lorawan.EUI64
+		EventType string
+		Marshaler string
+	}{}))
+	add("integration.nats.command_subject_template", validateTemplate(nats.CommandSubjectTemplate, struct{ GatewayID lorawan.EUI64 }{}))
+
+	add("integration.nats.credentials_file", validateFile(nats.CredentialsFile, false))
+	add("integration.nats.ca_cert", validateFile(nats.CACert, false))
+	add("integration.nats.tls_cert", validateFile(nats.TLSCert, false))
+	add("integration.nats.tls_key", validateFile(nats.TLSKey, false))
+	add("integration.nats.tls_cert / tls_key", validatePair(nats.TLSCert, nats.TLSKey))
+
+	if nats.JetStream.Enabled && nats.JetStream.Stream != "" {
+		err = nil
+		if len(nats.JetStream.Subjects) == 0 {
+			err = errors.New("at least one subject must be configured when the stream is set")
+		}
+		add("integration.nats.jetstream.subjects", err)
+	}
+
+	return checks
+}
+
+func (c Config) validateAMQP() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	amqp := c.Integration.AMQP
+
+	add("integration.amqp.url", validateURL(amqp.URL, "amqp", "amqps"))
+	add("integration.amqp.event_routing_key_template", validateTemplate(amqp.EventRoutingKeyTemplate, struct {
+		GatewayID lorawan.EUI64
+		EventType string
+		Marshaler string
+	}{}))
+	add("integration.amqp.command_queue_template", validateTemplate(amqp.CommandQueueTemplate, struct{ GatewayID lorawan.EUI64 }{}))
+	add("integration.amqp.command_routing_key_template", validateTemplate(amqp.CommandRoutingKeyTemplate, struct{ GatewayID lorawan.EUI64 }{}))
+
+	if amqp.PublisherConfirms {
+		var err error
+		if amqp.ConfirmTimeout <= 0 {
+			err = errors.New("confirm_timeout must be greater than 0 when publisher_confirms is enabled")
+		}
+		add("integration.amqp.confirm_timeout", err)
+	}
+
+	add("integration.amqp.ca_cert", validateFile(amqp.CACert, false))
+	add("integration.amqp.tls_cert", validateFile(amqp.TLSCert, false))
+	add("integration.amqp.tls_key", validateFile(amqp.TLSKey, false))
+	add("integration.amqp.tls_cert / tls_key", validatePair(amqp.TLSCert, amqp.TLSKey))
+
+	return checks
+}
+
+func (c Config) validateGCPPubSub() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	ps := c.Integration.GCPPubSub
+
+	add("integration.gcp_pub_sub.credentials_file", validateFile(ps.CredentialsFile, false))
+
+	var err error
+	if ps.ProjectID == "" && ps.CredentialsFile == "" {
+		err = errors.New("project_id must be set when no credentials_file is configured")
+	}
+	add("integration.gcp_pub_sub.project_id", err)
+
+	err = nil
+	if ps.EventTopic == "" {
+		err = errors.New("event_topic must be set")
+	}
+	add("integration.gcp_pub_sub.event_topic", err)
+
+	if ps.CommandsEnabled {
+		err = nil
+		if ps.CommandSubscription == "" {
+			err = errors.New("command_subscription must be set when commands are enabled")
+		}
+		add("integration.gcp_pub_sub.command_subscription", err)
+	}
+
+	add("integration.gcp_pub_sub.endpoint", validateURL(ps.Endpoint, "http", "https"))
+
+	err = nil
+	if ps.Timeout <= 0 {
+		err = errors.New("the timeout must be greater than zero")
+	}
+	add("integration.gcp_pub_sub.timeout", err)
+
+	return checks
+}
+
+func (c Config) validateAWSSQS() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	sqs := c.Integration.AWSSQS
+
+	var err error
+	if sqs.Region == "" {
+		err = errors.New("region must be set")
+	}
+	add("integration.aws_sqs.region", err)
+
+	add("integration.aws_sqs.credential_source", validateEnum(sqs.CredentialSource, "static", "env", "ec2", "ecs"))
+	if sqs.CredentialSource == "static" {
+		err = nil
+		if sqs.AccessKeyID == "" || sqs.SecretAccessKey == "" {
+			err = errors.New("access_key_id and secret_access_key must be set")
+		}
+		add("integration.aws_sqs.access_key_id / secret_access_key", err)
+	}
+
+	err = nil
+	if (sqs.EventTopicARN == "") == (sqs.EventQueueURL == "") {
+		err = errors.New("either event_topic_arn or event_queue_url must be set")
+	}
+	add("integration.aws_sqs.event_topic_arn / event_queue_url", err)
+
+	if sqs.EventQueueURL != "" {
+		add("integration.aws_sqs.event_queue_url", validateURL(sqs.EventQueueURL, "http", "https"))
+	}
+
+	if sqs.CommandsEnabled {
+		add("integration.aws_sqs.command_queue_url", validateURL(sqs.CommandQueueURL, "http", "https"))
+	}
+
+	if sqs.SNSEndpoint != "" {
+		add("integration.aws_sqs.sns_endpoint", validateURL(sqs.SNSEndpoint, "http", "https"))
+	}
+
+	err = nil
+	if sqs.WaitTime < 0 || sqs.WaitTime > 20*time.Second {
+		err = errors.New("the wait_time must be between 0 and 20 seconds")
+	}
+	add("integration.aws_sqs.wait_time", err)
+
+	err = nil
+	if sqs.Timeout <= 0 {
+		err = errors.New("the timeout must be greater than zero")
+	}
+	add("integration.aws_sqs.timeout", err)
+
+	return checks
+}
+
+func (c Config) validateHTTP() []Check {
+	var checks []Check
+	add := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	h := c.Integration.HTTP
+
+	var err error
+	if h.EventURL == "" && len(h.EventURLs) == 0 {
+		err = errors.New("event_url or event_urls must be configured")
+	} else if h.EventURL != "" {
+		err = validateURL(h.EventURL, "http", "https")
+	}
+	add("integration.http.event_url", err)
+
+	for event, u := range h.EventURLs {
+		err := validateEnum(event, "up", "up_set", "stats", "ack", "exec", "raw", "log", "conn")
+		if err == nil {
+			err = validateURL(u, "http", "https")
+		}
+		add("integration.http.event_urls."+event, err)
+	}
+
+	err = nil
+	if h.Timeout <= 0 {
+		err = errors.New("the timeout must be greater than zero")
+	}
+	add("integration.http.timeout", err)
+
+	err = nil
+	if h.MaxRetries < 0 {
+		err = errors.New("max_retries must not be negative")
+	} else if h.MaxRetries > 0 && (h.RetryInterval <= 0 || h.MaxRetryInterval < h.RetryInterval) {
+		err = errors.New("retry_interval must be greater than zero and not greater than max_retry_interval")
+	}
+	add("integration.http.max_retries", err)
+
+	if h.CommandsEnabled {
+		err = nil
+		if h.CommandBind == "" {
+			err = errors.New("command_bind must be set when commands are enabled")
+		}
+		add("integration.http.command_bind", err)
+	}
+
+	return checks
+}
+
+// validateEnum returns an error when the given value is not one of the
+// valid values.
+func validateEnum(value string, valid ...string) error {
+	for _, v := range valid {
+		if value == v {
+			return nil
+		}
+	}
+
+	var quoted []string
+	for _, v := range valid {
+		if v != "" {
+			quoted = append(quoted, fmt.Sprintf("'%s'", v))
+		}
+	}
+
+	return fmt.Errorf("invalid value '%s', expected one of: %s", value, strings.Join(quoted, ", "))
+}
+
+// validateFile returns an error when the given file does not exist. An
+// empty path is only valid when the file is not required.
+func validateFile(path string, required bool) error {
+	if path == "" {
+		if required {
+			return errors.New("file must be set")
+		}
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "stat file error")
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	return nil
+}
+
+// validateDir returns an error when the given directory does not exist.
+func validateDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "stat directory error")
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+
+	return nil
+}
+
+// validatePair returns an error when only one of the certificate and key
+// files is set.
+func validatePair(cert, key string) error {
+	if (cert == "") != (key == "") {
+		return errors.New("tls_cert and tls_key must both be set")
+	}
+	return nil
+}
+
+// validateTemplate returns an error when the template can not be parsed or
+// executed using the given data.
+func validateTemplate(tmpl string, data interface{}) error {
+	t, err := template.New("topic").Parse(tmpl)
+	if err != nil {
+		return errors.Wrap(err, "parse template error")
+	}
+
+	if err := t.Execute(&bytes.Buffer{}, data); err != nil {
+		return errors.Wrap(err, "execute template error")
+	}
+
+	return nil
+}
+
+// validateURL returns an error when the given URL can not be parsed or does
+// not use one of the given schemes.
+func validateURL(u string, schemes ...string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return errors.Wrap(err, "parse url error")
+	}
+
+	if err := validateEnum(parsed.Scheme, schemes...); err != nil {
+		return errors.Wrap(err, "invalid url scheme")
+	}
+
+	if parsed.Host == "" {
+		return errors.New("url must contain a host")
+	}
+
+	return nil
+}
+
+// validateOID returns an error when the given OID is not a dotted OID of at
+// least two sub-identifiers (e.g. 1.3.6.1.4.1).
+func validateOID(oid string) error {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid oid '%s'", oid)
+	}
+
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 32); err != nil {
+			return fmt.Errorf("invalid oid '%s'", oid)
+		}
+	}
+
+	return nil
+}
+
+// validateIPNet returns an error when the given value is not an IP address or
+// CIDR range (e.g. 192.168.1.0/24).
+func validateIPNet(s string) error {
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err
+	}
+
+	if net.ParseIP(s) == nil {
+		return fmt.Errorf("invalid ip '%s'", s)
+	}
+
+	return nil
+}
+
+// validateDevAddrPrefix returns an error when the given value is not a
+// DevAddr prefix (e.g. 26000000/7).
+func validateDevAddrPrefix(s string) error {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid DevAddr prefix '%s'", s)
+	}
+
+	var devAddr lorawan.DevAddr
+	if err := devAddr.UnmarshalText([]byte(parts[0])); err != nil {
+		return errors.Wrap(err, "unmarshal DevAddr error")
+	}
+
+	if size, err := strconv.Atoi(parts[1]); err != nil || size < 0 || size > 32 {
+		return fmt.Errorf("invalid DevAddr prefix '%s'", s)
+	}
+
+	return nil
+}
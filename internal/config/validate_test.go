@@ -0,0 +1,706 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() Config {
+	var c Config
+	c.Backend.Type = "semtech_udp"
+	c.Integration.Marshaler = "protobuf"
+	c.Integration.MQTT.EventTopicTemplate = "gateway/{{ .GatewayID }}/event/{{ .EventType }}"
+	c.Integration.MQTT.CommandTopicTemplate = "gateway/{{ .GatewayID }}/command/#"
+	c.Integration.MQTT.Auth.Type = "generic"
+	c.Integration.MQTT.Auth.Generic.Servers = []string{"tcp://127.0.0.1:1883"}
+	c.Integration.MQTT.ProtocolVersion = 4
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("cert"), 0644))
+
+	tests := []struct {
+		Name          string
+		Config        func(c *Config)
+		ExpectedError string
+	}{
+		{
+			Name:   "valid",
+			Config: func(c *Config) {},
+		},
+		{
+			Name: "invalid log format",
+			Config: func(c *Config) {
+				c.General.LogFormat = "xml"
+			},
+			ExpectedError: "invalid configuration: general.log_format: invalid value 'xml', expected one of: 'text', 'json'",
+		},
+		{
+			Name: "invalid module log level",
+			Config: func(c *Config) {
+				c.General.LogLevels = map[string]int{"backend": 7}
+			},
+			ExpectedError: "invalid configuration: general.log_levels.backend: invalid log level 7, expected a value between 0 and 6",
+		},
+		{
+			Name: "invalid location filter action",
+			Config: func(c *Config) {
+				c.Filters.Location.MaxSpeed = 300
+				c.Filters.Location.Action = "ignore"
+			},
+			ExpectedError: "invalid configuration: filters.location.action: invalid value 'ignore', expected one of: 'drop', 'flag'",
+		},
+		{
+			Name: "invalid backend type",
+			Config: func(c *Config) {
+				c.Backend.Type = "udp"
+			},
+			ExpectedError: "invalid configuration: backend.type: invalid value 'udp', expected one of: 'semtech_udp', 'basic_station', 'concentratord', 'multitech', 'simulator'",
+		},
+		{
+			Name: "multiple backends",
+			Config: func(c *Config) {
+				c.Backend.Type = "semtech_udp,concentratord"
+			},
+			ExpectedError: "invalid configuration: backend.type: the backends are mutually exclusive, only one backend can be configured",
+		},
+		{
+			Name: "invalid marshaler",
+			Config: func(c *Config) {
+				c.Integration.Marshaler = "xml"
+			},
+			ExpectedError: "invalid configuration: integration.marshaler: invalid value 'xml', expected one of: 'json', 'protobuf_json', 'protobuf', 'cbor'",
+		},
+		{
+			Name: "invalid api version",
+			Config: func(c *Config) {
+				c.Integration.APIVersion = "v5"
+			},
+			ExpectedError: "invalid configuration: integration.api_version: invalid value 'v5', expected one of: 'v3', 'v4'",
+		},
+		{
+			Name: "unknown integration",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"mqtt", "redis"}
+			},
+			ExpectedError: "invalid configuration: integration.enabled: invalid value 'redis', expected one of: 'mqtt', 'kafka', 'grpc', 'nats', 'http', 'amqp', 'gcp_pub_sub', 'aws_sqs', 'plugin', 'semtech_udp'",
+		},
+		{
+			Name: "kafka invalid sasl mechanism",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"kafka"}
+				c.Integration.Kafka.Brokers = []string{"127.0.0.1:9092"}
+				c.Integration.Kafka.EventTopicTemplate = "gateway.{{ .EventType }}"
+				c.Integration.Kafka.SASL.Mechanism = "gssapi"
+			},
+			ExpectedError: "invalid configuration: integration.kafka.sasl.mechanism: invalid value 'gssapi', expected one of: 'plain', 'scram_sha_256', 'scram_sha_512'",
+		},
+		{
+			Name: "mirror invalid queue size and marshaler",
+			Config: func(c *Config) {
+				c.Mirror.Enabled = true
+				c.Mirror.Integration = c.Integration
+				c.Mirror.Integration.Marshaler = "xml"
+			},
+			ExpectedError: "invalid configuration: mirror.queue_size: queue_size must be greater than zero, mirror.integration.marshaler: invalid value 'xml', expected one of: 'json', 'protobuf_json', 'protobuf', 'cbor'",
+		},
+		{
+			Name: "nats unknown command subject template field",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"nats"}
+				c.Integration.NATS.Servers = []string{"nats://127.0.0.1:4222"}
+				c.Integration.NATS.EventSubjectTemplate = "gateway.{{ .GatewayID }}.event.{{ .EventType }}"
+				c.Integration.NATS.CommandSubjectTemplate = "gateway.{{ .GatewayEUI }}.command.*"
+			},
+			ExpectedError: "invalid configuration: integration.nats.command_subject_template: execute template error: template: topic:1:11: executing \"topic\" at <.GatewayEUI>: can't evaluate field GatewayEUI in type struct { GatewayID lorawan.EUI64 }",
+		},
+		{
+			Name: "amqp invalid url scheme",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"amqp"}
+				c.Integration.AMQP.URL = "http://localhost:5672"
+				c.Integration.AMQP.EventRoutingKeyTemplate = "gateway.{{ .GatewayID }}.event.{{ .EventType }}"
+				c.Integration.AMQP.CommandQueueTemplate = "gateway.{{ .GatewayID }}.command"
+				c.Integration.AMQP.CommandRoutingKeyTemplate = "gateway.{{ .GatewayID }}.command.*"
+			},
+			ExpectedError: "invalid configuration: integration.amqp.url: invalid url scheme: invalid value 'http', expected one of: 'amqp', 'amqps'",
+		},
+		{
+			Name: "fine-timestamp invalid aes key",
+			Config: func(c *Config) {
+				c.Forwarder.FineTimestamp.Gateways = []FineTimestampKey{
+					{GatewayID: "0102030405060708", AESKey: "0102"},
+				}
+			},
+			ExpectedError: "invalid configuration: forwarder.fine_timestamp.gateways[0].aes_key: lorawan: exactly 16 bytes are expected",
+		},
+		{
+			Name: "duplicate antenna gain",
+			Config: func(c *Config) {
+				c.Forwarder.AntennaGain = []AntennaGain{
+					{Antenna: 1, Gain: 6},
+					{GatewayID: "0102030405060708", Antenna: 1, Gain: 3},
+					{Antenna: 1, Gain: 3},
+				}
+			},
+			ExpectedError: "invalid configuration: forwarder.antenna_gain[2].antenna: gain of antenna 1 is configured more than once",
+		},
+		{
+			Name: "gcp pub/sub commands without subscription",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"gcp_pub_sub"}
+				c.Integration.GCPPubSub.ProjectID = "test-project"
+				c.Integration.GCPPubSub.EventTopic = "events"
+				c.Integration.GCPPubSub.CommandsEnabled = true
+				c.Integration.GCPPubSub.Endpoint = "https://pubsub.googleapis.com"
+				c.Integration.GCPPubSub.Timeout = time.Second
+			},
+			ExpectedError: "invalid configuration: integration.gcp_pub_sub.command_subscription: command_subscription must be set when commands are enabled",
+		},
+		{
+			Name: "mqtt invalid event qos",
+			Config: func(c *Config) {
+				c.Integration.MQTT.EventQOS = map[string]uint8{"stats": 3}
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.event_qos.stats: invalid value 3, expected one of: 0, 1, 2",
+		},
+		{
+			Name: "high availability lease shorter than heartbeat interval",
+			Config: func(c *Config) {
+				c.HighAvailability.Enabled = true
+				c.HighAvailability.LockTopic = "chirpstack-gateway-bridge/standby/lock"
+				c.HighAvailability.HeartbeatInterval = 10 * time.Second
+				c.HighAvailability.LeaseDuration = 15 * time.Second
+				c.HighAvailability.MQTT.Server = "tcp://127.0.0.1:1883"
+			},
+			ExpectedError: "invalid configuration: high_availability.lease_duration: lease_duration must be at least twice the heartbeat_interval",
+		},
+		{
+			Name: "aws sqs with event topic and event queue",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"aws_sqs"}
+				c.Integration.AWSSQS.Region = "eu-west-1"
+				c.Integration.AWSSQS.CredentialSource = "env"
+				c.Integration.AWSSQS.EventTopicARN = "arn:aws:sns:eu-west-1:123456789012:events"
+				c.Integration.AWSSQS.EventQueueURL = "https://sqs.eu-west-1.amazonaws.com/123456789012/events"
+				c.Integration.AWSSQS.WaitTime = 20 * time.Second
+				c.Integration.AWSSQS.Timeout = time.Second
+			},
+			ExpectedError: "invalid configuration: integration.aws_sqs.event_topic_arn / event_queue_url: either event_topic_arn or event_queue_url must be set",
+		},
+		{
+			Name: "plugin without path",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"plugin"}
+				c.Integration.Plugin.RestartInterval = time.Second
+			},
+			ExpectedError: "invalid configuration: integration.plugin.path: file must be set",
+		},
+		{
+			Name: "semtech udp without server",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"semtech_udp"}
+				c.Integration.SemtechUDP.KeepaliveInterval = 10 * time.Second
+			},
+			ExpectedError: "invalid configuration: integration.semtech_udp.server: missing port in address",
+		},
+		{
+			Name: "tracing without export interval",
+			Config: func(c *Config) {
+				c.Tracing.Enabled = true
+				c.Tracing.Endpoint = "http://localhost:4318/v1/traces"
+				c.Tracing.QueueSize = 2048
+			},
+			ExpectedError: "invalid configuration: tracing.export_interval: export_interval must be greater than zero",
+		},
+		{
+			Name: "route with disabled integration",
+			Config: func(c *Config) {
+				c.Integration.Routes = []IntegrationRoute{
+					{Name: "partner", Integrations: []string{"http"}, NetIDs: []string{"000013"}},
+				}
+			},
+			ExpectedError: "invalid configuration: integration.routes[0].integrations: integration 'http' is not enabled",
+		},
+		{
+			Name: "route with invalid dev_addr prefix",
+			Config: func(c *Config) {
+				c.Integration.Routes = []IntegrationRoute{
+					{Name: "private", Integrations: []string{"mqtt"}, DevAddrPrefixes: []string{"26000000/33"}},
+				}
+			},
+			ExpectedError: "invalid configuration: integration.routes[0].dev_addr_prefixes: invalid DevAddr prefix '26000000/33'",
+		},
+		{
+			Name: "http invalid event url scheme",
+			Config: func(c *Config) {
+				c.Integration.Enabled = []string{"http"}
+				c.Integration.HTTP.EventURLs = map[string]string{"up": "ftp://example.com/up"}
+				c.Integration.HTTP.Timeout = time.Second
+			},
+			ExpectedError: "invalid configuration: integration.http.event_urls.up: invalid url scheme: invalid value 'ftp', expected one of: 'http', 'https'",
+		},
+		{
+			Name: "invalid event topic template syntax",
+			Config: func(c *Config) {
+				c.Integration.MQTT.EventTopicTemplate = "gateway/{{ .GatewayID }/event"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.event_topic_template: parse template error: template: topic:1: unexpected \"}\" in operand",
+		},
+		{
+			Name: "unknown command topic template field",
+			Config: func(c *Config) {
+				c.Integration.MQTT.CommandTopicTemplate = "gateway/{{ .GatewayEUI }}/command/#"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.command_topic_template: execute template error: template: topic:1:11: executing \"topic\" at <.GatewayEUI>: can't evaluate field GatewayEUI in type struct { GatewayID lorawan.EUI64 }",
+		},
+		{
+			Name: "missing mqtt ca cert",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Generic.CACert = filepath.Join(dir, "ca.pem")
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.generic.ca_cert: stat file error: stat " + filepath.Join(dir, "ca.pem") + ": no such file or directory",
+		},
+		{
+			Name: "mqtt tls cert without key",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Generic.TLSCert = certFile
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.generic.tls_cert / tls_key: tls_cert and tls_key must both be set",
+		},
+		{
+			Name: "mqtt client certificate renew before exceeds lifetime",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Generic.ClientCertificate.CACert = certFile
+				c.Integration.MQTT.Auth.Generic.ClientCertificate.CAKey = certFile
+				c.Integration.MQTT.Auth.Generic.ClientCertificate.CommonName = "0102030405060708"
+				c.Integration.MQTT.Auth.Generic.ClientCertificate.Lifetime = 24 * time.Hour
+				c.Integration.MQTT.Auth.Generic.ClientCertificate.RenewBefore = 48 * time.Hour
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.generic.client_certificate.renew_before: renew_before must be greater than zero and less than the lifetime",
+		},
+		{
+			Name: "azure dps without registration id",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Type = "azure_iot_hub"
+				c.Integration.MQTT.Auth.AzureIoTHub.Provisioning.IDScope = "0ne00000000"
+				c.Integration.MQTT.Auth.AzureIoTHub.Provisioning.SymmetricKey = "c2VjcmV0"
+				c.Integration.MQTT.Auth.AzureIoTHub.Provisioning.Timeout = time.Minute
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.azure_iot_hub.provisioning.registration_id: registration_id must be set when id_scope is set",
+		},
+		{
+			Name: "azure direct methods without json marshaler",
+			Config: func(c *Config) {
+				c.Integration.Marshaler = "protobuf"
+				c.Integration.MQTT.Auth.Type = "azure_iot_hub"
+				c.Integration.MQTT.Auth.AzureIoTHub.DirectMethods = true
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.azure_iot_hub.direct_methods: direct_methods requires the json marshaler, got: 'protobuf'",
+		},
+		{
+			Name: "invalid mqtt protocol version",
+			Config: func(c *Config) {
+				c.Integration.MQTT.ProtocolVersion = 3
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.protocol_version: invalid value 3, expected one of: 4, 5",
+		},
+		{
+			Name: "mqtt v5 with websocket server",
+			Config: func(c *Config) {
+				c.Integration.MQTT.ProtocolVersion = 5
+				c.Integration.MQTT.Auth.Generic.Servers = []string{"ws://127.0.0.1:8080"}
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.generic.servers: invalid url scheme: invalid value 'ws', expected one of: 'tcp', 'mqtt', 'ssl', 'tls', 'tcps', 'mqtts'",
+		},
+		{
+			Name: "mqtt unix socket without path",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Generic.Servers = []string{"unix://"}
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.generic.servers: the path of the unix socket must be set",
+		},
+		{
+			Name: "store-and-forward missing directory",
+			Config: func(c *Config) {
+				c.Integration.MQTT.StoreAndForward.Path = filepath.Join(dir, "missing", "store.db")
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.store_and_forward.path: stat directory error: stat " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+		{
+			Name: "mqtt invalid compression algorithm",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Compression.Algorithm = "brotli"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.compression.algorithm: invalid value 'brotli', expected one of: 'none', 'gzip', 'zstd'",
+		},
+		{
+			Name: "mqtt invalid shared subscription group",
+			Config: func(c *Config) {
+				c.Integration.MQTT.SharedSubscriptionGroup = "bridge/a"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.shared_subscription_group: group must not contain '/', '+' or '#'",
+		},
+		{
+			Name: "mqtt remote config invalid topic template",
+			Config: func(c *Config) {
+				c.Integration.MQTT.RemoteConfig.Enabled = true
+				c.Integration.MQTT.RemoteConfig.StateTopicTemplate = "gateway/{{ .Hostname }}/config/state"
+				c.Integration.MQTT.RemoteConfig.ConfigTopicTemplate = "gateway/{{ .GatewayID }}/config/set"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.remote_config.config_topic_template: execute template error: template: topic:1:11: executing \"topic\" at <.GatewayID>: can't evaluate field GatewayID in type struct { Hostname string }",
+		},
+		{
+			Name: "duty-cycle invalid region",
+			Config: func(c *Config) {
+				c.Forwarder.DutyCycle.Enabled = true
+				c.Forwarder.DutyCycle.Region = "US915"
+				c.Forwarder.DutyCycle.Window = time.Hour
+			},
+			ExpectedError: "invalid configuration: forwarder.duty_cycle.region: invalid value 'US915', expected one of: 'EU868', 'EU433'",
+		},
+		{
+			Name: "lbt invalid region",
+			Config: func(c *Config) {
+				c.Forwarder.LBT.Enabled = true
+				c.Forwarder.LBT.Region = "EU868"
+			},
+			ExpectedError: "invalid configuration: forwarder.lbt.region: invalid value 'EU868', expected one of: 'AS923', 'KR920'",
+		},
+		{
+			Name: "rate limit invalid burst",
+			Config: func(c *Config) {
+				c.Forwarder.RateLimit.Enabled = true
+				c.Forwarder.RateLimit.EventsPerSecond = 10
+			},
+			ExpectedError: "invalid configuration: forwarder.rate_limit.burst: burst must be at least 1",
+		},
+		{
+			Name: "stats aggregation invalid interval",
+			Config: func(c *Config) {
+				c.Forwarder.StatsAggregation.Enabled = true
+			},
+			ExpectedError: "invalid configuration: forwarder.stats_aggregation.interval: the interval must be greater than zero",
+		},
+		{
+			Name: "stats counters missing file",
+			Config: func(c *Config) {
+				c.Forwarder.StatsCounters.Enabled = true
+				c.Forwarder.StatsCounters.SaveInterval = time.Minute
+			},
+			ExpectedError: "invalid configuration: forwarder.stats_counters.file: the file must be set",
+		},
+		{
+			Name: "snmp invalid oid prefix",
+			Config: func(c *Config) {
+				c.Metrics.SNMP.Enabled = true
+				c.Metrics.SNMP.Bind = "0.0.0.0:1161"
+				c.Metrics.SNMP.Community = "public"
+				c.Metrics.SNMP.OIDPrefix = "1.3.6.x"
+			},
+			ExpectedError: "invalid configuration: metrics.snmp.oid_prefix: invalid oid '1.3.6.x'",
+		},
+		{
+			Name: "invalid event marshaler",
+			Config: func(c *Config) {
+				c.Integration.EventMarshalers = map[string]string{
+					"stats": "xml",
+				}
+			},
+			ExpectedError: "invalid configuration: integration.event_marshalers.stats: invalid value 'xml', expected one of: 'json', 'protobuf_json', 'protobuf', 'cbor'",
+		},
+		{
+			Name: "web ui invalid max frames",
+			Config: func(c *Config) {
+				c.WebUI.Enabled = true
+				c.WebUI.Bind = "0.0.0.0:8082"
+			},
+			ExpectedError: "invalid configuration: web_ui.max_frames: max_frames must be greater than 0",
+		},
+		{
+			Name: "capture invalid max files",
+			Config: func(c *Config) {
+				c.Capture.Path = filepath.Join(os.TempDir(), "capture")
+				c.Capture.FileMaxFrames = 1000
+			},
+			ExpectedError: "invalid configuration: capture.max_files: max_files must be greater than 0",
+		},
+		{
+			Name: "timesync invalid window",
+			Config: func(c *Config) {
+				c.TimeSync.Enabled = true
+			},
+			ExpectedError: "invalid configuration: timesync.window: window must be greater than 0",
+		},
+		{
+			Name: "downlink validation invalid region",
+			Config: func(c *Config) {
+				c.Forwarder.DownlinkValidation.Enabled = true
+				c.Forwarder.DownlinkValidation.Region = "EU999"
+			},
+			ExpectedError: "invalid configuration: forwarder.downlink_validation.region: invalid value 'EU999', expected one of: 'EU868', 'EU433', 'US915', 'AU915', 'AS923', 'KR920', 'IN865', 'CN470', 'CN779', 'RU864', 'ISM2400'",
+		},
+		{
+			Name: "basic station diid store invalid dir",
+			Config: func(c *Config) {
+				c.Backend.Type = "basic_station"
+				c.Backend.BasicStation.Region = "EU868"
+				c.Backend.BasicStation.DIIDStore.File = "/non-existing/diid.db"
+			},
+			ExpectedError: "invalid configuration: backend.basic_station.diid_store.file: stat directory error: stat /non-existing: no such file or directory",
+		},
+		{
+			Name: "basic station authorization file and http_url",
+			Config: func(c *Config) {
+				c.Backend.Type = "basic_station"
+				c.Backend.BasicStation.Region = "EU868"
+				c.Backend.BasicStation.Authorization.HTTPURL = "http://localhost:8080/authorize"
+				c.Backend.BasicStation.Authorization.File = "/non-existing/allow-list.json"
+			},
+			ExpectedError: "invalid configuration: backend.basic_station.authorization: only one of file and http_url can be set, backend.basic_station.authorization.file: stat file error: stat /non-existing/allow-list.json: no such file or directory",
+		},
+		{
+			Name: "basic station router-info invalid lookup_url",
+			Config: func(c *Config) {
+				c.Backend.Type = "basic_station"
+				c.Backend.BasicStation.Region = "EU868"
+				c.Backend.BasicStation.RouterInfo.LookupURL = "ws://localhost:8080/lookup"
+			},
+			ExpectedError: "invalid configuration: backend.basic_station.router_info.lookup_url: invalid url scheme: invalid value 'ws', expected one of: 'http', 'https'",
+		},
+		{
+			Name: "semtech udp allow-list invalid source ip",
+			Config: func(c *Config) {
+				c.Backend.SemtechUDP.AllowList.SourceIPs = []string{"192.168.1.0/24", "192.168.2.x"}
+				c.Backend.SemtechUDP.AllowList.Gateways = []SemtechUDPAllowedGateway{
+					{GatewayID: "0102030405060708", SourceIPs: []string{"10.0.0.0/33"}},
+				}
+			},
+			ExpectedError: "invalid configuration: backend.semtech_udp.allow_list.source_ips[1]: invalid ip '192.168.2.x', backend.semtech_udp.allow_list.gateways[0].source_ips[0]: invalid CIDR address: 10.0.0.0/33",
+		},
+		{
+			Name: "semtech udp dtls invalid",
+			Config: func(c *Config) {
+				c.Backend.SemtechUDP.Listeners = []SemtechUDPListener{
+					{Bind: "0.0.0.0:1700", DTLS: SemtechUDPDTLS{Enabled: true}},
+					{Bind: "0.0.0.0:1701", DTLS: SemtechUDPDTLS{Enabled: true, TLSCert: certFile, PSKs: []SemtechUDPDTLSPSK{{Key: "0102zz"}}}},
+				}
+			},
+			ExpectedError: "invalid configuration: backend.semtech_udp.listeners[0].dtls: at least one psk or the tls_cert must be set, backend.semtech_udp.listeners[1].dtls.tls_cert / tls_key: tls_cert and tls_key must both be set, backend.semtech_udp.listeners[1].dtls.psks[0].identity: identity must be set, backend.semtech_udp.listeners[1].dtls.psks[0].key: encoding/hex: invalid byte: U+007A 'z'",
+		},
+		{
+			Name: "commands invalid argument regexp",
+			Config: func(c *Config) {
+				c.Commands.Commands = map[string]Command{
+					"ping": {
+						Command:       "ping -c 1 {{.host}}",
+						Arguments:     map[string]string{"host": "[a-z"},
+						Environment:   []string{"LC_ALL=C", "FOO"},
+						MaxConcurrent: -1,
+					},
+				}
+			},
+			ExpectedError: "invalid configuration: commands.commands.ping.arguments.host: error parsing regexp: missing closing ]: `[a-z`, commands.commands.ping.environment[1]: invalid value 'FOO', expected KEY=VALUE, commands.commands.ping.max_concurrent: max_concurrent must not be negative",
+		},
+		{
+			Name: "commands reserved purge_downlinks",
+			Config: func(c *Config) {
+				c.Commands.Commands = map[string]Command{
+					"purge_downlinks": {Command: "echo"},
+				}
+			},
+			ExpectedError: "invalid configuration: commands.commands.purge_downlinks: the purge_downlinks command is reserved for the built-in purge downlinks command",
+		},
+		{
+			Name: "gpsd invalid server",
+			Config: func(c *Config) {
+				c.MetaData.GPSD.Enabled = true
+				c.MetaData.GPSD.Server = "localhost"
+			},
+			ExpectedError: "invalid configuration: meta_data.gpsd.server: address localhost: missing port in address",
+		},
+		{
+			Name: "system meta-data invalid disk path",
+			Config: func(c *Config) {
+				c.MetaData.System.Enabled = true
+				c.MetaData.System.DiskPath = "/non-existing"
+			},
+			ExpectedError: "invalid configuration: meta_data.system.disk_path: stat directory error: stat /non-existing: no such file or directory",
+		},
+		{
+			Name: "downlink retry invalid error",
+			Config: func(c *Config) {
+				c.Forwarder.DownlinkRetry.Enabled = true
+				c.Forwarder.DownlinkRetry.Region = "EU868"
+				c.Forwarder.DownlinkRetry.RX2DataRate = -1
+				c.Forwarder.DownlinkRetry.Errors = []string{"TX_FREQ", "DUTY_CYCLE_OVERFLOW"}
+			},
+			ExpectedError: "invalid configuration: forwarder.downlink_retry.errors[1]: invalid value 'DUTY_CYCLE_OVERFLOW', expected one of: 'TOO_LATE', 'TOO_EARLY', 'COLLISION_PACKET', 'COLLISION_BEACON', 'TX_FREQ', 'TX_POWER', 'GPS_UNLOCKED', 'CHANNEL_BUSY'",
+		},
+		{
+			Name: "basic station invalid region",
+			Config: func(c *Config) {
+				c.Backend.Type = "basic_station"
+				c.Backend.BasicStation.Region = "EU869"
+			},
+			ExpectedError: "invalid configuration: backend.basic_station.region: lorawan/band: band EU869 is undefined",
+		},
+		{
+			Name: "basic station cups update without signature",
+			Config: func(c *Config) {
+				c.Backend.Type = "basic_station"
+				c.Backend.BasicStation.Region = "EU868"
+				c.Backend.BasicStation.CUPS.Enabled = true
+				c.Backend.BasicStation.CUPS.Update.File = certFile
+			},
+			ExpectedError: "invalid configuration: backend.basic_station.cups.update.signature_file: file must be set",
+		},
+		{
+			Name: "channels invalid drop policy",
+			Config: func(c *Config) {
+				c.Backend.Channels.DropPolicy = "drop_newest"
+			},
+			ExpectedError: "invalid configuration: backend.channels.drop_policy: invalid value 'drop_newest', expected one of: 'block', 'drop_oldest'",
+		},
+		{
+			Name: "channels negative size",
+			Config: func(c *Config) {
+				c.Backend.Channels.UplinkFrameSize = -1
+			},
+			ExpectedError: "invalid configuration: backend.channels.uplink_frame_size: uplink_frame_size must not be negative",
+		},
+		{
+			Name: "scheduler without dispatch ahead",
+			Config: func(c *Config) {
+				c.Backend.Scheduler.Enabled = true
+			},
+			ExpectedError: "invalid configuration: backend.scheduler.dispatch_ahead: dispatch_ahead must be greater than zero",
+		},
+		{
+			Name: "negative conn-state keepalive timeout",
+			Config: func(c *Config) {
+				c.Backend.ConnState.KeepaliveTimeout = -time.Second
+			},
+			ExpectedError: "invalid configuration: backend.conn_state.keepalive_timeout: keepalive_timeout must not be negative",
+		},
+		{
+			Name: "concentratord invalid bandwidth unit",
+			Config: func(c *Config) {
+				c.Backend.Type = "concentratord"
+				c.Backend.Concentratord.BandwidthUnit = "mhz"
+			},
+			ExpectedError: "invalid configuration: backend.concentratord.bandwidth_unit: invalid value 'mhz', expected one of: 'auto', 'hz', 'khz'",
+		},
+		{
+			Name: "uplink script hook invalid timeout",
+			Config: func(c *Config) {
+				c.Hooks.UplinkScript.Path = filepath.Join(dir, "hook.sh")
+				c.Hooks.UplinkScript.Timeout = 0
+			},
+			ExpectedError: "invalid configuration: hooks.uplink_script.path: stat file error: stat " + filepath.Join(dir, "hook.sh") + ": no such file or directory, hooks.uplink_script.timeout: timeout must be greater than zero",
+		},
+		{
+			Name: "simulator invalid",
+			Config: func(c *Config) {
+				c.Backend.Type = "simulator"
+				c.Backend.Simulator.Gateways = 1
+				c.Backend.Simulator.BaseGatewayID = "0000000000000001"
+				c.Backend.Simulator.UplinkInterval = time.Second
+				c.Backend.Simulator.StatsInterval = time.Second
+				c.Backend.Simulator.Frequencies = []int{868100000}
+				c.Backend.Simulator.SpreadingFactors = []int{7, 13}
+				c.Backend.Simulator.Bandwidth = 125
+			},
+			ExpectedError: "invalid configuration: backend.simulator.spreading_factors: invalid value 13, expected a value between 5 and 12",
+		},
+		{
+			Name: "gateway id mapping duplicate mapped gateway id",
+			Config: func(c *Config) {
+				c.Backend.GatewayIDMapping = []GatewayIDMapping{
+					{
+						GatewayID:       "0102030405060708",
+						MappedGatewayID: "0807060504030201",
+						BoardGatewayIDs: []string{"0807060504030202"},
+					},
+					{
+						GatewayID:       "0102030405060709",
+						MappedGatewayID: "0807060504030202",
+					},
+				}
+			},
+			ExpectedError: "invalid configuration: backend.gateway_id_mapping[1].mapped_gateway_id: gateway ID 0807060504030202 is used more than once as mapped gateway ID",
+		},
+		{
+			Name: "multitech invalid topic prefix",
+			Config: func(c *Config) {
+				c.Backend.Type = "multitech"
+				c.Backend.Multitech.Server = "tcp://127.0.0.1:1883"
+				c.Backend.Multitech.TopicPrefix = "lora/#"
+			},
+			ExpectedError: "invalid configuration: backend.multitech.topic_prefix: topic_prefix must be set and must not contain '+' or '#'",
+		},
+		{
+			Name: "concentratord mesh invalid signing key",
+			Config: func(c *Config) {
+				c.Backend.Type = "concentratord"
+				c.Backend.Concentratord.Mesh.Enabled = true
+				c.Backend.Concentratord.Mesh.Region = "EU868"
+				c.Backend.Concentratord.Mesh.Frequencies = []int{869525000}
+				c.Backend.Concentratord.Mesh.SigningKey = "0102"
+			},
+			ExpectedError: "invalid configuration: backend.concentratord.mesh.signing_key: lorawan: exactly 16 bytes are expected",
+		},
+		{
+			Name: "gcp missing jwt key file",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Type = "gcp_cloud_iot_core"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.gcp_cloud_iot_core.jwt_key_file: file must be set",
+		},
+		{
+			Name: "aws invalid credential source",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Type = "aws_iot"
+				c.Integration.MQTT.Auth.AWSIoT.Mode = "websocket_sigv4"
+				c.Integration.MQTT.Auth.AWSIoT.CredentialSource = "file"
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.aws_iot.credential_source: invalid value 'file', expected one of: 'static', 'env', 'ec2', 'ecs'",
+		},
+		{
+			Name: "aws x509 missing tls cert",
+			Config: func(c *Config) {
+				c.Integration.MQTT.Auth.Type = "aws_iot"
+				c.Integration.MQTT.Auth.AWSIoT.Mode = "x509"
+				c.Integration.MQTT.Auth.AWSIoT.TLSKey = certFile
+			},
+			ExpectedError: "invalid configuration: integration.mqtt.auth.aws_iot.tls_cert: file must be set",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			c := testConfig()
+			tst.Config(&c)
+
+			err := ValidationError(c.Validate())
+			if tst.ExpectedError == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, tst.ExpectedError)
+			}
+		})
+	}
+}
@@ -2,26 +2,40 @@ package filters
 
 import (
 	"encoding/binary"
+	"sync"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 	"github.com/brocaar/lorawan"
 )
 
-var netIDs []lorawan.NetID
-var joinEUIs [][2]lorawan.EUI64
+var (
+	mux sync.RWMutex
 
-// Setup configures the filters package.
+	netIDs   []lorawan.NetID
+	joinEUIs [][2]lorawan.EUI64
+	minRSSI  int
+	minSNR   float64
+)
+
+// Setup configures the filters package. It is safe to call Setup again to
+// apply a new configuration (e.g. on configuration reload), in which case
+// the previous filters are replaced.
 func Setup(conf config.Config) error {
+	var newNetIDs []lorawan.NetID
+	var newJoinEUIs [][2]lorawan.EUI64
+
 	for _, netIDStr := range conf.Filters.NetIDs {
 		var netID lorawan.NetID
 		if err := netID.UnmarshalText([]byte(netIDStr)); err != nil {
 			return errors.Wrap(err, "unmarshal NetID error")
 		}
 
-		netIDs = append(netIDs, netID)
+		newNetIDs = append(newNetIDs, netID)
 		log.WithFields(log.Fields{
 			"net_id": netID,
 		}).Info("filters: NetID filter configured")
@@ -39,7 +53,7 @@ func Setup(conf config.Config) error {
 			joinEUISet[i] = joinEUI
 		}
 
-		joinEUIs = append(joinEUIs, joinEUISet)
+		newJoinEUIs = append(newJoinEUIs, joinEUISet)
 
 		log.WithFields(log.Fields{
 			"join_eui_from": joinEUISet[0],
@@ -47,6 +61,23 @@ func Setup(conf config.Config) error {
 		}).Info("filters: JoinEUI range configured")
 	}
 
+	if conf.Filters.MinRSSI != 0 || conf.Filters.MinSNR != 0 {
+		log.WithFields(log.Fields{
+			"min_rssi": conf.Filters.MinRSSI,
+			"min_snr":  conf.Filters.MinSNR,
+		}).Info("filters: RSSI / SNR filter configured")
+	}
+
+	setupLocationFilter(conf)
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	netIDs = newNetIDs
+	joinEUIs = newJoinEUIs
+	minRSSI = conf.Filters.MinRSSI
+	minSNR = conf.Filters.MinSNR
+
 	return nil
 }
 
@@ -56,6 +87,9 @@ func Setup(conf config.Config) error {
 // * If no filters are configured
 // * In case the PHYPayload is not a valid LoRaWAN frame
 func MatchFilters(b []byte) bool {
+	mux.RLock()
+	defer mux.RUnlock()
+
 	// return true when no filters are configured
 	if len(netIDs) == 0 && len(joinEUIs) == 0 {
 		return true
@@ -80,6 +114,32 @@ func MatchFilters(b []byte) bool {
 	}
 }
 
+// MatchRadioFilters will match the RSSI and SNR of the given uplink frame
+// against the configured min. RSSI and SNR. This function returns true when
+// the frame must be forwarded. The SNR filter is only applied to LoRa
+// modulated frames.
+func MatchRadioFilters(uplinkFrame *gw.UplinkFrame) bool {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	rxInfo := uplinkFrame.GetRxInfo()
+	if rxInfo == nil {
+		return true
+	}
+
+	if minRSSI != 0 && int(rxInfo.GetRssi()) < minRSSI {
+		uplinkFilteredCounter("rssi").Inc()
+		return false
+	}
+
+	if minSNR != 0 && uplinkFrame.GetTxInfo().GetModulation() == common.Modulation_LORA && rxInfo.GetLoraSnr() < minSNR {
+		uplinkFilteredCounter("snr").Inc()
+		return false
+	}
+
+	return true
+}
+
 func matchNetIDFilter(netID lorawan.NetID) bool {
 	if len(netIDs) == 0 {
 		return true
@@ -133,7 +193,12 @@ func filterDevAddr(phy lorawan.PHYPayload) bool {
 		return true
 	}
 
-	return matchNetIDFilterForDevAddr(mac.FHDR.DevAddr)
+	if !matchNetIDFilterForDevAddr(mac.FHDR.DevAddr) {
+		uplinkFilteredCounter("net_id").Inc()
+		return false
+	}
+
+	return true
 }
 
 func filterJoinRequest(phy lorawan.PHYPayload) bool {
@@ -142,15 +207,28 @@ func filterJoinRequest(phy lorawan.PHYPayload) bool {
 		return true
 	}
 
-	return matchJoinEUIFilter(jr.JoinEUI)
+	if !matchJoinEUIFilter(jr.JoinEUI) {
+		uplinkFilteredCounter("join_eui").Inc()
+		return false
+	}
+
+	return true
 }
 
 func filterRejoinRequest(phy lorawan.PHYPayload) bool {
 	switch v := phy.MACPayload.(type) {
 	case *lorawan.RejoinRequestType02Payload:
-		return matchNetIDFilter(v.NetID)
+		if !matchNetIDFilter(v.NetID) {
+			uplinkFilteredCounter("net_id").Inc()
+			return false
+		}
+		return true
 	case *lorawan.RejoinRequestType1Payload:
-		return matchJoinEUIFilter(v.JoinEUI)
+		if !matchJoinEUIFilter(v.JoinEUI) {
+			uplinkFilteredCounter("join_eui").Inc()
+			return false
+		}
+		return true
 	default:
 		return true
 	}
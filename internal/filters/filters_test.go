@@ -3,6 +3,8 @@ package filters
 import (
 	"testing"
 
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 	"github.com/brocaar/lorawan"
 	"github.com/stretchr/testify/require"
@@ -233,4 +235,93 @@ func TestFilters(t *testing.T) {
 			assert.Equal(tst.Expected, MatchFilters(b))
 		})
 	}
+
+	t.Run("setup replaces previous filters", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Filters.NetIDs = []string{"000001"}
+		assert.NoError(Setup(conf))
+		assert.Len(netIDs, 1)
+
+		assert.NoError(Setup(config.Config{}))
+		assert.Len(netIDs, 0)
+		assert.Len(joinEUIs, 0)
+	})
+}
+
+func TestRadioFilters(t *testing.T) {
+	tests := []struct {
+		Name       string
+		MinRSSI    int
+		MinSNR     float64
+		Modulation common.Modulation
+		RSSI       int32
+		SNR        float64
+		Expected   bool
+	}{
+		{
+			Name:       "no filter",
+			Modulation: common.Modulation_LORA,
+			RSSI:       -140,
+			SNR:        -25,
+			Expected:   true,
+		},
+		{
+			Name:       "rssi above min",
+			MinRSSI:    -120,
+			Modulation: common.Modulation_LORA,
+			RSSI:       -110,
+			Expected:   true,
+		},
+		{
+			Name:       "rssi below min",
+			MinRSSI:    -120,
+			Modulation: common.Modulation_LORA,
+			RSSI:       -121,
+			Expected:   false,
+		},
+		{
+			Name:       "snr above min",
+			MinSNR:     -15,
+			Modulation: common.Modulation_LORA,
+			SNR:        -10,
+			Expected:   true,
+		},
+		{
+			Name:       "snr below min",
+			MinSNR:     -15,
+			Modulation: common.Modulation_LORA,
+			SNR:        -17.5,
+			Expected:   false,
+		},
+		{
+			Name:       "snr filter not applied to fsk",
+			MinSNR:     -15,
+			Modulation: common.Modulation_FSK,
+			SNR:        -17.5,
+			Expected:   true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var conf config.Config
+			conf.Filters.MinRSSI = tst.MinRSSI
+			conf.Filters.MinSNR = tst.MinSNR
+			assert.NoError(Setup(conf))
+
+			assert.Equal(tst.Expected, MatchRadioFilters(&gw.UplinkFrame{
+				TxInfo: &gw.UplinkTXInfo{
+					Modulation: tst.Modulation,
+				},
+				RxInfo: &gw.UplinkRXInfo{
+					Rssi:    tst.RSSI,
+					LoraSnr: tst.SNR,
+				},
+			}))
+		})
+	}
 }
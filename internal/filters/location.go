@@ -0,0 +1,128 @@
+package filters
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// earthRadius is the mean radius of the earth (meters).
+const earthRadius = 6371008.8
+
+var (
+	locationMux sync.Mutex
+
+	locationMaxSpeed  float64 // m/s
+	locationTolerance float64 // meters
+	locationAction    string
+	lastLocations     map[lorawan.EUI64]acceptedLocation
+)
+
+// acceptedLocation holds the last accepted location of a gateway.
+type acceptedLocation struct {
+	location common.Location
+	time     time.Time
+}
+
+func setupLocationFilter(conf config.Config) {
+	locationMux.Lock()
+	defer locationMux.Unlock()
+
+	locationMaxSpeed = conf.Filters.Location.MaxSpeed / 3.6
+	locationTolerance = conf.Filters.Location.Tolerance
+	locationAction = conf.Filters.Location.Action
+	lastLocations = make(map[lorawan.EUI64]acceptedLocation)
+
+	if locationMaxSpeed != 0 {
+		log.WithFields(log.Fields{
+			"max_speed": conf.Filters.Location.MaxSpeed,
+			"tolerance": locationTolerance,
+			"action":    locationAction,
+		}).Info("filters: location filter configured")
+	}
+}
+
+// FilterGatewayLocation validates the location of the given gateway stats
+// against the last accepted location of the gateway. When the gateway would
+// have moved faster than the configured max. speed, the location is either
+// removed from the stats or flagged using the location_implausible meta-data
+// key, depending on the configured action. This function returns false in
+// case the location was implausible.
+func FilterGatewayLocation(stats *gw.GatewayStats) bool {
+	return filterGatewayLocation(stats, time.Now())
+}
+
+func filterGatewayLocation(stats *gw.GatewayStats, now time.Time) bool {
+	if stats.Location == nil {
+		return true
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], stats.GatewayId)
+
+	locationMux.Lock()
+	defer locationMux.Unlock()
+
+	if locationMaxSpeed == 0 {
+		return true
+	}
+
+	last, ok := lastLocations[gatewayID]
+	if !ok || plausibleLocation(last, *stats.Location, now) {
+		lastLocations[gatewayID] = acceptedLocation{
+			location: *stats.Location,
+			time:     now,
+		}
+		return true
+	}
+
+	locationFilteredCounter(locationAction).Inc()
+	log.WithFields(log.Fields{
+		"gateway_id":     gatewayID,
+		"latitude":       stats.Location.Latitude,
+		"longitude":      stats.Location.Longitude,
+		"last_latitude":  last.location.Latitude,
+		"last_longitude": last.location.Longitude,
+		"action":         locationAction,
+	}).Warning("filters: implausible gateway location")
+
+	switch locationAction {
+	case "flag":
+		if stats.MetaData == nil {
+			stats.MetaData = make(map[string]string)
+		}
+		stats.MetaData["location_implausible"] = "true"
+	default:
+		stats.Location = nil
+	}
+
+	return false
+}
+
+// plausibleLocation returns true when the distance between the last accepted
+// location and the given location could have been travelled at the max.
+// speed. As the elapsed time since the last accepted location keeps growing,
+// a gateway which has really been moved is eventually accepted.
+func plausibleLocation(last acceptedLocation, loc common.Location, now time.Time) bool {
+	distance := haversineDistance(last.location, loc)
+	return distance <= locationTolerance+locationMaxSpeed*now.Sub(last.time).Seconds()
+}
+
+// haversineDistance returns the great-circle distance (meters) between the
+// given locations.
+func haversineDistance(a, b common.Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
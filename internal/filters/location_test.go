@@ -0,0 +1,125 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHaversineDistance(t *testing.T) {
+	assert := require.New(t)
+
+	// Paris - London
+	d := haversineDistance(
+		common.Location{Latitude: 48.8566, Longitude: 2.3522},
+		common.Location{Latitude: 51.5074, Longitude: -0.1278},
+	)
+	assert.InDelta(343500, d, 1000)
+}
+
+func TestFilterGatewayLocation(t *testing.T) {
+	now := time.Now()
+
+	// ~1.1 km north of the initial location
+	initial := common.Location{Latitude: 52.0, Longitude: 5.0}
+	moved := common.Location{Latitude: 52.01, Longitude: 5.0}
+
+	tests := []struct {
+		Name             string
+		MaxSpeed         float64
+		Action           string
+		Elapsed          time.Duration
+		Location         common.Location
+		Expected         bool
+		ExpectedLocation bool
+		ExpectedFlag     bool
+	}{
+		{
+			Name:             "filter disabled",
+			Elapsed:          time.Second,
+			Location:         moved,
+			Expected:         true,
+			ExpectedLocation: true,
+		},
+		{
+			Name:             "within tolerance",
+			MaxSpeed:         100,
+			Action:           "drop",
+			Elapsed:          time.Second,
+			Location:         common.Location{Latitude: 52.0005, Longitude: 5.0},
+			Expected:         true,
+			ExpectedLocation: true,
+		},
+		{
+			Name:             "plausible speed",
+			MaxSpeed:         100,
+			Action:           "drop",
+			Elapsed:          time.Minute,
+			Location:         moved,
+			Expected:         true,
+			ExpectedLocation: true,
+		},
+		{
+			Name:     "implausible speed, drop",
+			MaxSpeed: 100,
+			Action:   "drop",
+			Elapsed:  10 * time.Second,
+			Location: moved,
+		},
+		{
+			Name:             "implausible speed, flag",
+			MaxSpeed:         100,
+			Action:           "flag",
+			Elapsed:          10 * time.Second,
+			Location:         moved,
+			ExpectedLocation: true,
+			ExpectedFlag:     true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var conf config.Config
+			conf.Filters.Location.MaxSpeed = tst.MaxSpeed
+			conf.Filters.Location.Tolerance = 100
+			conf.Filters.Location.Action = tst.Action
+			assert.NoError(Setup(conf))
+
+			gatewayID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+			loc := initial
+			assert.True(filterGatewayLocation(&gw.GatewayStats{GatewayId: gatewayID, Location: &loc}, now))
+
+			loc = tst.Location
+			stats := gw.GatewayStats{GatewayId: gatewayID, Location: &loc}
+			assert.Equal(tst.Expected, filterGatewayLocation(&stats, now.Add(tst.Elapsed)))
+			assert.Equal(tst.ExpectedLocation, stats.Location != nil)
+			assert.Equal(tst.ExpectedFlag, stats.MetaData["location_implausible"] == "true")
+		})
+	}
+
+	t.Run("moved gateway is eventually accepted", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Filters.Location.MaxSpeed = 100
+		conf.Filters.Location.Tolerance = 100
+		conf.Filters.Location.Action = "drop"
+		assert.NoError(Setup(conf))
+
+		gatewayID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		loc := initial
+		assert.True(filterGatewayLocation(&gw.GatewayStats{GatewayId: gatewayID, Location: &loc}, now))
+
+		loc = moved
+		assert.False(filterGatewayLocation(&gw.GatewayStats{GatewayId: gatewayID, Location: &loc}, now.Add(10*time.Second)))
+
+		loc = moved
+		assert.True(filterGatewayLocation(&gw.GatewayStats{GatewayId: gatewayID, Location: &loc}, now.Add(time.Minute)))
+	})
+}
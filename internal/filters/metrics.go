@@ -0,0 +1,26 @@
+package filters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ufc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "filters_uplink_filtered_count",
+		Help: "The number of uplink frames dropped by the configured filters (per filter).",
+	}, []string{"filter"})
+
+	lfc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "filters_location_filtered_count",
+		Help: "The number of implausible gateway locations filtered by the location filter (per action).",
+	}, []string{"action"})
+)
+
+func uplinkFilteredCounter(filter string) prometheus.Counter {
+	return ufc.With(prometheus.Labels{"filter": filter})
+}
+
+func locationFilteredCounter(action string) prometheus.Counter {
+	return lfc.With(prometheus.Labels{"action": action})
+}
@@ -0,0 +1,88 @@
+package forwarder
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// antennaGainTable adjusts the TX power of downlinks for the gain of the
+// antenna selected by the downlink. The TX power of a downlink is requested
+// as EIRP, the TX power of the concentrator is the EIRP minus the antenna
+// gain.
+type antennaGainTable struct {
+	// gains contains the antenna gains (dB) that apply to all gateways.
+	gains map[uint32]float64
+
+	// gatewayGains contains the per-gateway antenna gains (dB), these take
+	// precedence over gains.
+	gatewayGains map[lorawan.EUI64]map[uint32]float64
+}
+
+func newAntennaGainTable(conf []config.AntennaGain) (*antennaGainTable, error) {
+	t := antennaGainTable{
+		gains:        make(map[uint32]float64),
+		gatewayGains: make(map[lorawan.EUI64]map[uint32]float64),
+	}
+
+	for _, ag := range conf {
+		if ag.GatewayID == "" {
+			t.gains[ag.Antenna] = ag.Gain
+			continue
+		}
+
+		var gatewayID lorawan.EUI64
+		if err := gatewayID.UnmarshalText([]byte(ag.GatewayID)); err != nil {
+			return nil, errors.Wrap(err, "unmarshal gateway_id error")
+		}
+
+		if t.gatewayGains[gatewayID] == nil {
+			t.gatewayGains[gatewayID] = make(map[uint32]float64)
+		}
+		t.gatewayGains[gatewayID][ag.Antenna] = ag.Gain
+	}
+
+	return &t, nil
+}
+
+// gain returns the gain of the given gateway antenna. It returns false when
+// no gain has been configured.
+func (t *antennaGainTable) gain(gatewayID lorawan.EUI64, antenna uint32) (float64, bool) {
+	if gain, ok := t.gatewayGains[gatewayID][antenna]; ok {
+		return gain, true
+	}
+	gain, ok := t.gains[antenna]
+	return gain, ok
+}
+
+// adjustDownlink adjusts the TX power of the given downlink for the gain of
+// the selected antenna. It returns the adjustment (dB). The TX info is copied
+// before it is modified, as it might be shared with the caller.
+func (t *antennaGainTable) adjustDownlink(df *gw.DownlinkFrame) int32 {
+	if df.TxInfo == nil {
+		return 0
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], df.TxInfo.GetGatewayId())
+
+	gain, ok := t.gain(gatewayID, df.TxInfo.GetAntenna())
+	if !ok {
+		return 0
+	}
+
+	adjustment := int32(math.Round(gain))
+	if adjustment == 0 {
+		return 0
+	}
+
+	txInfo := *df.TxInfo
+	txInfo.Power -= adjustment
+	df.TxInfo = &txInfo
+
+	return adjustment
+}
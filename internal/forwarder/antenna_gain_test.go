@@ -0,0 +1,56 @@
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestAntennaGainTable(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	otherGatewayID := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	table, err := newAntennaGainTable([]config.AntennaGain{
+		{Antenna: 0, Gain: 2.4},
+		{Antenna: 1, Gain: 6},
+		{GatewayID: gatewayID.String(), Antenna: 1, Gain: 2.5},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name               string
+		GatewayID          lorawan.EUI64
+		Antenna            uint32
+		ExpectedAdjustment int32
+		ExpectedPower      int32
+	}{
+		{"all gateways antenna 0", otherGatewayID, 0, 2, 25},
+		{"all gateways antenna 1", otherGatewayID, 1, 6, 21},
+		{"gateway antenna 0 fallback", gatewayID, 0, 2, 25},
+		{"gateway antenna 1", gatewayID, 1, 3, 24},
+		{"no gain configured", gatewayID, 2, 0, 27},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			txInfo := gw.DownlinkTXInfo{
+				GatewayId: tst.GatewayID[:],
+				Power:     27,
+				Antenna:   tst.Antenna,
+			}
+			df := gw.DownlinkFrame{TxInfo: &txInfo}
+
+			assert.Equal(tst.ExpectedAdjustment, table.adjustDownlink(&df))
+			assert.Equal(tst.ExpectedPower, df.TxInfo.Power)
+
+			// the original tx info must not be modified
+			assert.EqualValues(27, txInfo.Power)
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// minClockDriftSamples defines the min. number of samples needed before the
+// drift is estimated.
+const minClockDriftSamples = 10
+
+// maxClockDriftJump defines the max. difference between the wall-clock and
+// concentrator counter elapsed time of two consecutive samples. A bigger
+// difference indicates that the concentrator counter has been reset (e.g.
+// after a packet-forwarder restart) and the samples are discarded.
+const maxClockDriftJump = time.Second
+
+// clockDriftSample contains a single sample, expressed in microseconds
+// relative to the first sample.
+type clockDriftSample struct {
+	time    time.Time
+	wall    int64
+	counter int64
+}
+
+// clockDriftGateway contains the samples of a single gateway.
+type clockDriftGateway struct {
+	samples              []clockDriftSample
+	firstTime            time.Time
+	lastCounter          uint32
+	lastCounterUnwrapped int64
+	drift                float64
+}
+
+// elapsed returns the elapsed wall-clock time and the elapsed (unwrapped)
+// concentrator counter in microseconds since the first sample.
+func (g *clockDriftGateway) elapsed(counter uint32, t time.Time) (int64, int64) {
+	return int64(t.Sub(g.firstTime) / time.Microsecond), g.lastCounterUnwrapped + int64(counter-g.lastCounter)
+}
+
+// clockDriftEstimator estimates, per gateway, the drift between the
+// concentrator counter and the wall-clock time over a sliding window.
+type clockDriftEstimator struct {
+	sync.RWMutex
+
+	window        time.Duration
+	maxCorrection time.Duration
+	gateways      map[lorawan.EUI64]*clockDriftGateway
+
+	// metrics is used to expose the estimated drift (optional).
+	metrics *gatewayMetrics
+}
+
+func newClockDriftEstimator(window, maxCorrection time.Duration, metrics *gatewayMetrics) *clockDriftEstimator {
+	return &clockDriftEstimator{
+		window:        window,
+		maxCorrection: maxCorrection,
+		gateways:      make(map[lorawan.EUI64]*clockDriftGateway),
+		metrics:       metrics,
+	}
+}
+
+// addUplink adds a sample for the given uplink. Uplinks of which the context
+// does not contain the 32 bit concentrator counter are ignored.
+func (e *clockDriftEstimator) addUplink(uplinkFrame gw.UplinkFrame, now time.Time) {
+	rxInfo := uplinkFrame.GetRxInfo()
+	if len(rxInfo.GetContext()) != 4 {
+		return
+	}
+
+	// the GPS time is more accurate than the time the uplink was received
+	// by the ChirpStack Gateway Bridge.
+	if rxInfo.GetTime() != nil {
+		if t, err := ptypes.Timestamp(rxInfo.GetTime()); err == nil {
+			now = t
+		}
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], rxInfo.GetGatewayId())
+
+	e.addSample(gatewayID, binary.BigEndian.Uint32(rxInfo.GetContext()), now)
+}
+
+// addSample adds a sample for the given gateway.
+func (e *clockDriftEstimator) addSample(gatewayID lorawan.EUI64, counter uint32, t time.Time) {
+	e.Lock()
+	defer e.Unlock()
+
+	gw, ok := e.gateways[gatewayID]
+	if ok && len(gw.samples) != 0 {
+		last := gw.samples[len(gw.samples)-1]
+		wall, unwrapped := gw.elapsed(counter, t)
+
+		jump := (unwrapped - last.counter) - (wall - last.wall)
+		if jump < 0 {
+			jump = -jump
+		}
+
+		if time.Duration(jump)*time.Microsecond > maxClockDriftJump {
+			ok = false
+		}
+	}
+
+	if !ok {
+		gw = &clockDriftGateway{
+			firstTime:   t,
+			lastCounter: counter,
+		}
+		e.gateways[gatewayID] = gw
+	}
+
+	wall, unwrapped := gw.elapsed(counter, t)
+	gw.lastCounter = counter
+	gw.lastCounterUnwrapped = unwrapped
+	gw.samples = append(gw.samples, clockDriftSample{
+		time:    t,
+		wall:    wall,
+		counter: unwrapped,
+	})
+
+	// remove the samples outside the window
+	for len(gw.samples) != 0 && t.Sub(gw.samples[0].time) > e.window {
+		gw.samples = gw.samples[1:]
+	}
+
+	gw.drift = estimateClockDrift(gw.samples)
+	if e.metrics != nil {
+		e.metrics.setClockDrift(gatewayID, gw.drift*1e6)
+	}
+}
+
+// removeGateway removes the samples of the given gateway, e.g. after it
+// unsubscribed.
+func (e *clockDriftEstimator) removeGateway(gatewayID lorawan.EUI64) {
+	e.Lock()
+	defer e.Unlock()
+
+	delete(e.gateways, gatewayID)
+}
+
+// getDrift returns the estimated drift for the given gateway. The drift is
+// expressed as the ratio of the concentrator counter elapsed time minus the
+// wall-clock elapsed time, over the wall-clock elapsed time.
+func (e *clockDriftEstimator) getDrift(gatewayID lorawan.EUI64) float64 {
+	e.RLock()
+	defer e.RUnlock()
+
+	gw, ok := e.gateways[gatewayID]
+	if !ok {
+		return 0
+	}
+	return gw.drift
+}
+
+// correctDownlink corrects the delay of delay-based downlink frames, using
+// the estimated drift of the gateway. It returns the applied correction.
+func (e *clockDriftEstimator) correctDownlink(downlinkFrame *gw.DownlinkFrame) time.Duration {
+	txInfo := downlinkFrame.GetTxInfo()
+	if txInfo.GetTiming() != gw.DownlinkTiming_DELAY || len(txInfo.GetContext()) != 4 {
+		return 0
+	}
+
+	timingInfo := txInfo.GetDelayTimingInfo()
+	if timingInfo == nil || timingInfo.GetDelay() == nil {
+		return 0
+	}
+
+	delay, err := ptypes.Duration(timingInfo.GetDelay())
+	if err != nil {
+		return 0
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], txInfo.GetGatewayId())
+
+	correction := time.Duration(float64(delay/time.Microsecond)*e.getDrift(gatewayID)) * time.Microsecond
+	if correction > e.maxCorrection {
+		correction = e.maxCorrection
+	}
+	if correction < -e.maxCorrection {
+		correction = -e.maxCorrection
+	}
+
+	if correction == 0 {
+		return 0
+	}
+
+	timingInfo.Delay = ptypes.DurationProto(delay + correction)
+	return correction
+}
+
+// estimateClockDrift returns the estimated drift using a least squares
+// linear regression of the concentrator counter over the wall-clock time.
+func estimateClockDrift(samples []clockDriftSample) float64 {
+	if len(samples) < minClockDriftSamples {
+		return 0
+	}
+
+	// use the first sample as origin to keep the numbers small
+	var sumW, sumC float64
+	for _, s := range samples {
+		sumW += float64(s.wall - samples[0].wall)
+		sumC += float64(s.counter - samples[0].counter)
+	}
+	n := float64(len(samples))
+	meanW := sumW / n
+	meanC := sumC / n
+
+	var cov, variance float64
+	for _, s := range samples {
+		w := float64(s.wall-samples[0].wall) - meanW
+		c := float64(s.counter-samples[0].counter) - meanC
+		cov += w * c
+		variance += w * w
+	}
+
+	if variance == 0 {
+		return 0
+	}
+
+	return cov/variance - 1
+}
@@ -0,0 +1,155 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestClockDriftEstimator(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// addUplinks adds an uplink every 30 seconds, with the concentrator
+	// counter drifting with the given ppm. The counter starts close to the
+	// 32 bit boundary to test wrapping.
+	addUplinks := func(e *clockDriftEstimator, ppm float64, count int) {
+		start := time.Now()
+		counter := uint32(0xffffffff - 60000000)
+
+		for i := 0; i < count; i++ {
+			elapsed := time.Duration(i) * 30 * time.Second
+			ctx := make([]byte, 4)
+			binary.BigEndian.PutUint32(ctx, counter+uint32(float64(elapsed/time.Microsecond)*(1+ppm/1e6)))
+
+			e.addUplink(gw.UplinkFrame{
+				RxInfo: &gw.UplinkRXInfo{
+					GatewayId: gatewayID[:],
+					Context:   ctx,
+				},
+			}, start.Add(elapsed))
+		}
+	}
+
+	downlink := func(delay time.Duration) gw.DownlinkFrame {
+		return gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID[:],
+				Context:   []byte{1, 2, 3, 4},
+				Timing:    gw.DownlinkTiming_DELAY,
+				TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+					DelayTimingInfo: &gw.DelayTimingInfo{
+						Delay: ptypes.DurationProto(delay),
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		Name               string
+		PPM                float64
+		Uplinks            int
+		MaxCorrection      time.Duration
+		Delay              time.Duration
+		ExpectedCorrection time.Duration
+	}{
+		{
+			Name:               "positive drift",
+			PPM:                100,
+			Uplinks:            20,
+			MaxCorrection:      time.Millisecond,
+			Delay:              5 * time.Second,
+			ExpectedCorrection: 500 * time.Microsecond,
+		},
+		{
+			Name:               "negative drift",
+			PPM:                -50,
+			Uplinks:            20,
+			MaxCorrection:      time.Millisecond,
+			Delay:              2 * time.Second,
+			ExpectedCorrection: -100 * time.Microsecond,
+		},
+		{
+			Name:               "correction is bounded",
+			PPM:                100,
+			Uplinks:            20,
+			MaxCorrection:      200 * time.Microsecond,
+			Delay:              5 * time.Second,
+			ExpectedCorrection: 200 * time.Microsecond,
+		},
+		{
+			Name:               "not enough samples",
+			PPM:                100,
+			Uplinks:            minClockDriftSamples - 1,
+			MaxCorrection:      time.Millisecond,
+			Delay:              5 * time.Second,
+			ExpectedCorrection: 0,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			e := newClockDriftEstimator(time.Hour, tst.MaxCorrection, nil)
+			addUplinks(e, tst.PPM, tst.Uplinks)
+
+			df := downlink(tst.Delay)
+			correction := e.correctDownlink(&df)
+			assert.InDelta(int64(tst.ExpectedCorrection), int64(correction), float64(2*time.Microsecond))
+
+			delay, err := ptypes.Duration(df.GetTxInfo().GetDelayTimingInfo().GetDelay())
+			assert.NoError(err)
+			assert.Equal(tst.Delay+correction, delay)
+		})
+	}
+
+	t.Run("immediately downlink is not corrected", func(t *testing.T) {
+		assert := require.New(t)
+
+		e := newClockDriftEstimator(time.Hour, time.Millisecond, nil)
+		addUplinks(e, 100, 20)
+
+		df := gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID[:],
+				Timing:    gw.DownlinkTiming_IMMEDIATELY,
+			},
+		}
+		assert.Equal(time.Duration(0), e.correctDownlink(&df))
+	})
+
+	t.Run("counter reset", func(t *testing.T) {
+		assert := require.New(t)
+
+		e := newClockDriftEstimator(time.Hour, time.Millisecond, nil)
+		addUplinks(e, 100, 20)
+		e.addSample(gatewayID, 1000, time.Now().Add(time.Hour))
+
+		assert.Len(e.gateways[gatewayID].samples, 1)
+		assert.Equal(float64(0), e.getDrift(gatewayID))
+	})
+
+	t.Run("metrics and remove gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		m, err := newGatewayMetrics(prometheus.NewRegistry(), 1)
+		assert.NoError(err)
+
+		e := newClockDriftEstimator(time.Hour, time.Millisecond, m)
+		addUplinks(e, 100, 20)
+		assert.InDelta(100, testutil.ToFloat64(m.clockDrift.WithLabelValues(gatewayID.String())), 0.1)
+
+		e.removeGateway(gatewayID)
+		assert.Len(e.gateways, 0)
+		assert.Equal(float64(0), e.getDrift(gatewayID))
+	})
+}
@@ -0,0 +1,63 @@
+package forwarder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// deduplicator collects the uplinks with the same PHYPayload and frequency,
+// received within the deduplication window (e.g. from multiple packet
+// forwarders connected to the same ChirpStack Gateway Bridge), into a single
+// uplink frame-set.
+type deduplicator struct {
+	sync.Mutex
+
+	window  time.Duration
+	publish func(gw.UplinkFrameSet)
+	sets    map[string]*gw.UplinkFrameSet
+}
+
+func newDeduplicator(window time.Duration, publish func(gw.UplinkFrameSet)) *deduplicator {
+	return &deduplicator{
+		window:  window,
+		publish: publish,
+		sets:    make(map[string]*gw.UplinkFrameSet),
+	}
+}
+
+// add adds the given uplink. The first uplink of a set starts the
+// deduplication window, after which the set is published.
+func (d *deduplicator) add(uplinkFrame gw.UplinkFrame) {
+	key := fmt.Sprintf("%x/%d", uplinkFrame.GetPhyPayload(), uplinkFrame.GetTxInfo().GetFrequency())
+
+	d.Lock()
+	defer d.Unlock()
+
+	if set, ok := d.sets[key]; ok {
+		set.RxInfo = append(set.RxInfo, uplinkFrame.RxInfo)
+		uplinkDuplicateCounter().Inc()
+		return
+	}
+
+	d.sets[key] = &gw.UplinkFrameSet{
+		PhyPayload: uplinkFrame.PhyPayload,
+		TxInfo:     uplinkFrame.TxInfo,
+		RxInfo:     []*gw.UplinkRXInfo{uplinkFrame.RxInfo},
+	}
+
+	time.AfterFunc(d.window, func() {
+		d.flush(key)
+	})
+}
+
+func (d *deduplicator) flush(key string) {
+	d.Lock()
+	set := d.sets[key]
+	delete(d.sets, key)
+	d.Unlock()
+
+	d.publish(*set)
+}
@@ -0,0 +1,75 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestDeduplicator(t *testing.T) {
+	assert := require.New(t)
+
+	sets := make(chan gw.UplinkFrameSet, 10)
+	d := newDeduplicator(50*time.Millisecond, func(set gw.UplinkFrameSet) {
+		sets <- set
+	})
+
+	uplink := func(gatewayID lorawan.EUI64, phyPayload []byte, frequency uint32) gw.UplinkFrame {
+		return gw.UplinkFrame{
+			PhyPayload: phyPayload,
+			TxInfo: &gw.UplinkTXInfo{
+				Frequency: frequency,
+			},
+			RxInfo: &gw.UplinkRXInfo{
+				GatewayId: gatewayID[:],
+			},
+		}
+	}
+
+	gw1 := lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+	gw2 := lorawan.EUI64{2, 2, 2, 2, 2, 2, 2, 2}
+
+	d.add(uplink(gw1, []byte{1, 2, 3}, 868100000))
+	d.add(uplink(gw2, []byte{1, 2, 3}, 868100000))
+	// other frequency
+	d.add(uplink(gw2, []byte{1, 2, 3}, 868300000))
+	// other payload
+	d.add(uplink(gw1, []byte{3, 2, 1}, 868100000))
+
+	received := make(map[uint32][]gw.UplinkFrameSet)
+	for i := 0; i < 3; i++ {
+		select {
+		case set := <-sets:
+			received[set.TxInfo.Frequency] = append(received[set.TxInfo.Frequency], set)
+		case <-time.After(time.Second):
+			assert.FailNow("uplink frame-set not published")
+		}
+	}
+
+	assert.Len(received[868300000], 1)
+	assert.Len(received[868300000][0].RxInfo, 1)
+
+	assert.Len(received[868100000], 2)
+	for _, set := range received[868100000] {
+		if len(set.RxInfo) == 2 {
+			assert.Equal([]byte{1, 2, 3}, set.PhyPayload)
+			assert.Equal(gw1[:], set.RxInfo[0].GatewayId)
+			assert.Equal(gw2[:], set.RxInfo[1].GatewayId)
+		} else {
+			assert.Equal([]byte{3, 2, 1}, set.PhyPayload)
+		}
+	}
+
+	// after the window, the same uplink results in a new set
+	d.add(uplink(gw1, []byte{1, 2, 3}, 868100000))
+	select {
+	case set := <-sets:
+		assert.Len(set.RxInfo, 1)
+	case <-time.After(time.Second):
+		assert.FailNow("uplink frame-set not published")
+	}
+}
@@ -0,0 +1,100 @@
+package forwarder
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/band"
+)
+
+// rx2DelayOffset defines the offset of the RX2 receive-window relative to the
+// RX1 receive-window (RECEIVE_DELAY2 - RECEIVE_DELAY1).
+const rx2DelayOffset = time.Second
+
+// downlinkRetrier re-attempts a downlink rejected by the gateway in the RX2
+// receive-window. As the DownlinkFrame only contains the RX1 parameters, the
+// RX2 parameters are taken from the configuration (or the region defaults).
+// The RX1 and RX2 attempts are the items 0 and 1 of the downlink.
+type downlinkRetrier struct {
+	errors       map[string]struct{}
+	rx2Frequency uint32
+	rx2DataRate  band.DataRate
+}
+
+func newDownlinkRetrier(conf config.Config) (*downlinkRetrier, error) {
+	retryConf := conf.Forwarder.DownlinkRetry
+
+	b, err := band.GetConfig(band.Name(retryConf.Region), false, lorawan.DwellTimeNoLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "get band config error")
+	}
+	defaults := b.GetDefaults()
+
+	r := downlinkRetrier{
+		errors:       make(map[string]struct{}),
+		rx2Frequency: uint32(defaults.RX2Frequency),
+	}
+
+	for _, e := range retryConf.Errors {
+		r.errors[e] = struct{}{}
+	}
+
+	if retryConf.RX2Frequency != 0 {
+		r.rx2Frequency = uint32(retryConf.RX2Frequency)
+	}
+
+	dr := defaults.RX2DataRate
+	if retryConf.RX2DataRate != -1 {
+		dr = retryConf.RX2DataRate
+	}
+	r.rx2DataRate, err = b.GetDataRate(dr)
+	if err != nil {
+		return nil, errors.Wrap(err, "get rx2 data-rate error")
+	}
+	if r.rx2DataRate.Modulation != band.LoRaModulation {
+		return nil, errors.New("rx2 data-rate must use LoRa modulation")
+	}
+
+	return &r, nil
+}
+
+// retryFrame returns the downlink frame for the RX2 receive-window, given
+// the rejected downlink (item). It returns false when the downlink can not
+// be retried, e.g. because the error is not retryable, the downlink was
+// already retried or the downlink does not use delay timing (RX1).
+func (r *downlinkRetrier) retryFrame(txAck gw.DownlinkTXAck, downlinkFrame gw.DownlinkFrame, itemIndex uint32) (gw.DownlinkFrame, bool, error) {
+	if _, ok := r.errors[txAck.GetError()]; !ok || itemIndex != 0 {
+		return gw.DownlinkFrame{}, false, nil
+	}
+
+	txInfo := downlinkFrame.GetTxInfo()
+	if txInfo.GetTiming() != gw.DownlinkTiming_DELAY || txInfo.GetLoraModulationInfo() == nil {
+		return gw.DownlinkFrame{}, false, nil
+	}
+
+	delay, err := ptypes.Duration(txInfo.GetDelayTimingInfo().GetDelay())
+	if err != nil {
+		return gw.DownlinkFrame{}, false, errors.Wrap(err, "parse delay error")
+	}
+
+	out := downlinkFrame
+	out.TxInfo = proto.Clone(txInfo).(*gw.DownlinkTXInfo)
+	out.TxInfo.Frequency = r.rx2Frequency
+	out.TxInfo.TimingInfo = &gw.DownlinkTXInfo_DelayTimingInfo{
+		DelayTimingInfo: &gw.DelayTimingInfo{
+			Delay: ptypes.DurationProto(delay + rx2DelayOffset),
+		},
+	}
+
+	modInfo := out.TxInfo.GetLoraModulationInfo()
+	modInfo.SpreadingFactor = uint32(r.rx2DataRate.SpreadFactor)
+	modInfo.Bandwidth = uint32(r.rx2DataRate.Bandwidth)
+
+	return out, true, nil
+}
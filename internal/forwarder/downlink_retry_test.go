@@ -0,0 +1,107 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestDownlinkRetrier(t *testing.T) {
+	var conf config.Config
+	conf.Forwarder.DownlinkRetry.Enabled = true
+	conf.Forwarder.DownlinkRetry.Region = "EU868"
+	conf.Forwarder.DownlinkRetry.Errors = []string{"COLLISION_BEACON", "TX_FREQ"}
+	conf.Forwarder.DownlinkRetry.RX2DataRate = -1
+
+	r, err := newDownlinkRetrier(conf)
+	require.NoError(t, err)
+
+	rx1 := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3},
+		Token:      1234,
+		TxInfo: &gw.DownlinkTXInfo{
+			Frequency:  868100000,
+			Power:      14,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:             125,
+					SpreadingFactor:       7,
+					CodeRate:              "4/5",
+					PolarizationInversion: true,
+				},
+			},
+			Timing: gw.DownlinkTiming_DELAY,
+			TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+				DelayTimingInfo: &gw.DelayTimingInfo{
+					Delay: ptypes.DurationProto(time.Second),
+				},
+			},
+			Context: []byte{1, 2, 3, 4},
+		},
+	}
+
+	t.Run("Retry", func(t *testing.T) {
+		assert := require.New(t)
+
+		out, ok, err := r.retryFrame(gw.DownlinkTXAck{Error: "TX_FREQ"}, rx1, 0)
+		assert.NoError(err)
+		assert.True(ok)
+
+		assert.Equal(rx1.PhyPayload, out.PhyPayload)
+		assert.Equal(rx1.Token, out.Token)
+		assert.EqualValues(869525000, out.TxInfo.Frequency)
+		assert.EqualValues(14, out.TxInfo.Power)
+		assert.Equal(&gw.LoRaModulationInfo{
+			Bandwidth:             125,
+			SpreadingFactor:       12,
+			CodeRate:              "4/5",
+			PolarizationInversion: true,
+		}, out.TxInfo.GetLoraModulationInfo())
+		assert.Equal(ptypes.DurationProto(2*time.Second), out.TxInfo.GetDelayTimingInfo().GetDelay())
+		assert.Equal(rx1.TxInfo.Context, out.TxInfo.Context)
+
+		// the original frame is not modified
+		assert.EqualValues(868100000, rx1.TxInfo.Frequency)
+		assert.EqualValues(7, rx1.TxInfo.GetLoraModulationInfo().SpreadingFactor)
+	})
+
+	t.Run("Error not retryable", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, ok, err := r.retryFrame(gw.DownlinkTXAck{Error: "TOO_LATE"}, rx1, 0)
+		assert.NoError(err)
+		assert.False(ok)
+	})
+
+	t.Run("Already retried", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, ok, err := r.retryFrame(gw.DownlinkTXAck{Error: "TX_FREQ"}, rx1, 1)
+		assert.NoError(err)
+		assert.False(ok)
+	})
+
+	t.Run("Immediately", func(t *testing.T) {
+		assert := require.New(t)
+
+		df := rx1
+		df.TxInfo = &gw.DownlinkTXInfo{
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{},
+			},
+			Timing: gw.DownlinkTiming_IMMEDIATELY,
+		}
+
+		_, ok, err := r.retryFrame(gw.DownlinkTXAck{Error: "TX_FREQ"}, df, 0)
+		assert.NoError(err)
+		assert.False(ok)
+	})
+}
@@ -0,0 +1,161 @@
+package forwarder
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/ism2400"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/band"
+)
+
+// Downlink TX acknowledgement errors of the downlinks rejected by the
+// downlink validation.
+const (
+	validationFrequencyError = "TX_FREQ"
+	validationPowerError     = "TX_POWER"
+	validationDataRateError  = "TX_DATA_RATE"
+)
+
+// frequencyRange defines a downlink frequency range and its max. TX power.
+type frequencyRange struct {
+	minFreq  uint32 // Hz, inclusive
+	maxFreq  uint32 // Hz, inclusive
+	maxPower int32  // dBm (EIRP)
+}
+
+// downlinkFrequencyRanges contains the downlink frequency ranges and the
+// max. TX power per region (LoRaWAN Regional Parameters).
+var downlinkFrequencyRanges = map[string][]frequencyRange{
+	"EU868": {
+		{minFreq: 863000000, maxFreq: 869399999, maxPower: 16},
+		{minFreq: 869400000, maxFreq: 869650000, maxPower: 27},
+		{minFreq: 869650001, maxFreq: 870000000, maxPower: 16},
+	},
+	"EU433": {
+		{minFreq: 433050000, maxFreq: 434790000, maxPower: 12},
+	},
+	"US915": {
+		{minFreq: 923300000, maxFreq: 927500000, maxPower: 30},
+	},
+	"AU915": {
+		{minFreq: 923300000, maxFreq: 927500000, maxPower: 30},
+	},
+	"AS923": {
+		{minFreq: 915000000, maxFreq: 928000000, maxPower: 16},
+	},
+	"KR920": {
+		{minFreq: 920900000, maxFreq: 923300000, maxPower: 23},
+	},
+	"IN865": {
+		{minFreq: 865000000, maxFreq: 867000000, maxPower: 30},
+	},
+	"CN470": {
+		{minFreq: 500300000, maxFreq: 509700000, maxPower: 19},
+	},
+	"CN779": {
+		{minFreq: 779500000, maxFreq: 786500000, maxPower: 12},
+	},
+	"RU864": {
+		{minFreq: 864000000, maxFreq: 870000000, maxPower: 16},
+	},
+	ism2400.Name: {
+		{minFreq: ism2400.MinFrequency, maxFreq: ism2400.MaxFrequency, maxPower: ism2400.MaxEIRP},
+	},
+}
+
+// downlinkValidator rejects the downlinks of which the frequency, TX power
+// or data-rate are outside the limits of the configured region, before
+// these are sent to the gateway.
+type downlinkValidator struct {
+	region string
+	ranges []frequencyRange
+
+	// dataRateIndex returns the index of the given downlink data-rate, or an
+	// error when the data-rate is not valid for the region.
+	dataRateIndex func(dr band.DataRate) (int, error)
+
+	// maxPower overrides the max. TX power of the region when set.
+	maxPower int32
+}
+
+func newDownlinkValidator(region string, maxPower int) (*downlinkValidator, error) {
+	ranges, ok := downlinkFrequencyRanges[region]
+	if !ok {
+		return nil, fmt.Errorf("downlink validation is not defined for region: %s", region)
+	}
+
+	v := downlinkValidator{
+		region:   region,
+		ranges:   ranges,
+		maxPower: int32(maxPower),
+	}
+
+	// the LoRa 2.4 GHz band is not defined by the LoRaWAN Regional Parameters
+	if region == ism2400.Name {
+		v.dataRateIndex = ism2400.GetDataRateIndex
+		return &v, nil
+	}
+
+	b, err := band.GetConfig(band.Name(region), false, lorawan.DwellTimeNoLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "get band config error")
+	}
+	v.dataRateIndex = func(dr band.DataRate) (int, error) {
+		return b.GetDataRateIndex(false, dr)
+	}
+
+	return &v, nil
+}
+
+// validate validates the given downlink. When the downlink is rejected, it
+// returns the TX acknowledgement error and an error describing the reason.
+func (v *downlinkValidator) validate(downlinkFrame gw.DownlinkFrame) (string, error) {
+	txInfo := downlinkFrame.GetTxInfo()
+
+	var freqRange *frequencyRange
+	for i := range v.ranges {
+		if txInfo.GetFrequency() >= v.ranges[i].minFreq && txInfo.GetFrequency() <= v.ranges[i].maxFreq {
+			freqRange = &v.ranges[i]
+			break
+		}
+	}
+	if freqRange == nil {
+		return validationFrequencyError, fmt.Errorf("frequency %d Hz is outside the %s downlink frequency range", txInfo.GetFrequency(), v.region)
+	}
+
+	maxPower := freqRange.maxPower
+	if v.maxPower != 0 {
+		maxPower = v.maxPower
+	}
+	if txInfo.GetPower() > maxPower {
+		return validationPowerError, fmt.Errorf("tx power %d dBm exceeds the max. tx power of %d dBm at %d Hz", txInfo.GetPower(), maxPower, txInfo.GetFrequency())
+	}
+
+	var dr band.DataRate
+	if mod := txInfo.GetLoraModulationInfo(); mod != nil {
+		dr = band.DataRate{
+			Modulation:   band.LoRaModulation,
+			SpreadFactor: int(mod.GetSpreadingFactor()),
+			Bandwidth:    int(mod.GetBandwidth()),
+		}
+	} else if mod := txInfo.GetFskModulationInfo(); mod != nil {
+		dr = band.DataRate{
+			Modulation: band.FSKModulation,
+			BitRate:    int(mod.GetDatarate()),
+		}
+	} else {
+		return validationDataRateError, errors.New("modulation info is missing")
+	}
+
+	if _, err := v.dataRateIndex(dr); err != nil {
+		if dr.Modulation == band.LoRaModulation {
+			return validationDataRateError, fmt.Errorf("SF%d / %d kHz is not a valid %s downlink data-rate", dr.SpreadFactor, dr.Bandwidth, v.region)
+		}
+		return validationDataRateError, fmt.Errorf("FSK %d bps is not a valid %s downlink data-rate", dr.BitRate, v.region)
+	}
+
+	return "", nil
+}
@@ -0,0 +1,171 @@
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestDownlinkValidator(t *testing.T) {
+	lora := func(frequency uint32, power int32, sf, bw uint32) gw.DownlinkFrame {
+		return gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				Frequency:  frequency,
+				Power:      power,
+				Modulation: common.Modulation_LORA,
+				ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+					LoraModulationInfo: &gw.LoRaModulationInfo{
+						SpreadingFactor: sf,
+						Bandwidth:       bw,
+					},
+				},
+			},
+		}
+	}
+
+	fsk := func(frequency uint32, power int32, datarate uint32) gw.DownlinkFrame {
+		return gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				Frequency:  frequency,
+				Power:      power,
+				Modulation: common.Modulation_FSK,
+				ModulationInfo: &gw.DownlinkTXInfo_FskModulationInfo{
+					FskModulationInfo: &gw.FSKModulationInfo{
+						Datarate: datarate,
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("unknown region", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := newDownlinkValidator("EU999", 0)
+		assert.Error(err)
+	})
+
+	tests := []struct {
+		Name          string
+		Region        string
+		MaxPower      int
+		DownlinkFrame gw.DownlinkFrame
+		ExpectedError string
+		ExpectedMsg   string
+	}{
+		{
+			Name:          "EU868 valid",
+			Region:        "EU868",
+			DownlinkFrame: lora(868100000, 14, 12, 125),
+		},
+		{
+			Name:          "EU868 valid high power sub-band",
+			Region:        "EU868",
+			DownlinkFrame: lora(869525000, 27, 9, 125),
+		},
+		{
+			Name:          "EU868 valid fsk",
+			Region:        "EU868",
+			DownlinkFrame: fsk(868800000, 14, 50000),
+		},
+		{
+			Name:          "EU868 frequency out of range",
+			Region:        "EU868",
+			DownlinkFrame: lora(923300000, 14, 12, 125),
+			ExpectedError: "TX_FREQ",
+			ExpectedMsg:   "frequency 923300000 Hz is outside the EU868 downlink frequency range",
+		},
+		{
+			Name:          "EU868 power exceeded",
+			Region:        "EU868",
+			DownlinkFrame: lora(868100000, 20, 12, 125),
+			ExpectedError: "TX_POWER",
+			ExpectedMsg:   "tx power 20 dBm exceeds the max. tx power of 16 dBm at 868100000 Hz",
+		},
+		{
+			Name:          "EU868 max power override",
+			Region:        "EU868",
+			MaxPower:      20,
+			DownlinkFrame: lora(868100000, 20, 12, 125),
+		},
+		{
+			Name:          "EU868 invalid data-rate",
+			Region:        "EU868",
+			DownlinkFrame: lora(868100000, 14, 12, 500),
+			ExpectedError: "TX_DATA_RATE",
+			ExpectedMsg:   "SF12 / 500 kHz is not a valid EU868 downlink data-rate",
+		},
+		{
+			Name:          "EU868 missing modulation info",
+			Region:        "EU868",
+			DownlinkFrame: gw.DownlinkFrame{TxInfo: &gw.DownlinkTXInfo{Frequency: 868100000}},
+			ExpectedError: "TX_DATA_RATE",
+			ExpectedMsg:   "modulation info is missing",
+		},
+		{
+			Name:          "US915 valid",
+			Region:        "US915",
+			DownlinkFrame: lora(923300000, 20, 12, 500),
+		},
+		{
+			Name:          "US915 uplink frequency",
+			Region:        "US915",
+			DownlinkFrame: lora(902300000, 20, 12, 500),
+			ExpectedError: "TX_FREQ",
+			ExpectedMsg:   "frequency 902300000 Hz is outside the US915 downlink frequency range",
+		},
+		{
+			Name:          "US915 uplink data-rate",
+			Region:        "US915",
+			DownlinkFrame: lora(923300000, 20, 10, 125),
+			ExpectedError: "TX_DATA_RATE",
+			ExpectedMsg:   "SF10 / 125 kHz is not a valid US915 downlink data-rate",
+		},
+		{
+			Name:          "US915 fsk",
+			Region:        "US915",
+			DownlinkFrame: fsk(923300000, 20, 50000),
+			ExpectedError: "TX_DATA_RATE",
+			ExpectedMsg:   "FSK 50000 bps is not a valid US915 downlink data-rate",
+		},
+		{
+			Name:          "ISM2400 valid",
+			Region:        "ISM2400",
+			DownlinkFrame: lora(2403000000, 10, 12, 812),
+		},
+		{
+			Name:          "ISM2400 power exceeded",
+			Region:        "ISM2400",
+			DownlinkFrame: lora(2479000000, 14, 12, 812),
+			ExpectedError: "TX_POWER",
+			ExpectedMsg:   "tx power 14 dBm exceeds the max. tx power of 10 dBm at 2479000000 Hz",
+		},
+		{
+			Name:          "ISM2400 invalid data-rate",
+			Region:        "ISM2400",
+			DownlinkFrame: lora(2403000000, 10, 12, 125),
+			ExpectedError: "TX_DATA_RATE",
+			ExpectedMsg:   "SF12 / 125 kHz is not a valid ISM2400 downlink data-rate",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			v, err := newDownlinkValidator(tst.Region, tst.MaxPower)
+			assert.NoError(err)
+
+			txError, err := v.validate(tst.DownlinkFrame)
+			assert.Equal(tst.ExpectedError, txError)
+			if tst.ExpectedMsg == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, tst.ExpectedMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package forwarder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/airtime"
+	"github.com/brocaar/lorawan"
+)
+
+// dutyCycleError defines the downlink TX acknowledgement error of a downlink
+// rejected because it would exceed the duty-cycle limit.
+const dutyCycleError = "DUTY_CYCLE_OVERFLOW"
+
+// subBand defines a regulatory sub-band and its duty-cycle limit.
+type subBand struct {
+	name      string
+	minFreq   uint32 // Hz, inclusive
+	maxFreq   uint32 // Hz, exclusive
+	dutyCycle float64
+}
+
+// dutyCycleSubBands contains the sub-bands with a duty-cycle limit per
+// region (ETSI EN 300 220).
+var dutyCycleSubBands = map[string][]subBand{
+	"EU868": {
+		{name: "863.0-865.0", minFreq: 863000000, maxFreq: 865000000, dutyCycle: 0.001},
+		{name: "865.0-868.0", minFreq: 865000000, maxFreq: 868000000, dutyCycle: 0.01},
+		{name: "868.0-868.6", minFreq: 868000000, maxFreq: 868600000, dutyCycle: 0.01},
+		{name: "868.7-869.2", minFreq: 868700000, maxFreq: 869200000, dutyCycle: 0.001},
+		{name: "869.4-869.65", minFreq: 869400000, maxFreq: 869650000, dutyCycle: 0.1},
+		{name: "869.7-870.0", minFreq: 869700000, maxFreq: 870000000, dutyCycle: 0.01},
+	},
+	"EU433": {
+		{name: "433.05-434.79", minFreq: 433050000, maxFreq: 434790000, dutyCycle: 0.1},
+	},
+}
+
+// transmission contains the airtime of a (scheduled) downlink.
+type transmission struct {
+	downlinkID uuid.UUID
+	time       time.Time
+	airtime    time.Duration
+}
+
+type dutyCycleKey struct {
+	gatewayID lorawan.EUI64
+	subBand   string
+}
+
+// dutyCycleTracker tracks the cumulative airtime of the downlinks per
+// gateway and sub-band within a sliding window and rejects the downlinks
+// that would exceed the duty-cycle limit of the sub-band.
+type dutyCycleTracker struct {
+	sync.Mutex
+
+	window        time.Duration
+	subBands      []subBand
+	transmissions map[dutyCycleKey][]transmission
+
+	// metrics exposes the remaining airtime when set (per-gateway metrics).
+	metrics *gatewayMetrics
+}
+
+func newDutyCycleTracker(region string, window time.Duration, metrics *gatewayMetrics) (*dutyCycleTracker, error) {
+	subBands, ok := dutyCycleSubBands[region]
+	if !ok {
+		return nil, fmt.Errorf("duty-cycle limits are not defined for region: %s", region)
+	}
+
+	return &dutyCycleTracker{
+		window:        window,
+		subBands:      subBands,
+		transmissions: make(map[dutyCycleKey][]transmission),
+		metrics:       metrics,
+	}, nil
+}
+
+// getSubBand returns the sub-band for the given frequency. It returns false
+// when the frequency is not within a sub-band with duty-cycle limit.
+func (t *dutyCycleTracker) getSubBand(frequency uint32) (subBand, bool) {
+	for _, sb := range t.subBands {
+		if frequency >= sb.minFreq && frequency < sb.maxFreq {
+			return sb, true
+		}
+	}
+
+	return subBand{}, false
+}
+
+// reserve adds the airtime of the given downlink to the used airtime of the
+// sub-band. It returns an error when this would exceed the duty-cycle limit,
+// in which case the airtime is not added.
+func (t *dutyCycleTracker) reserve(downlinkFrame gw.DownlinkFrame, now time.Time) error {
+	sb, ok := t.getSubBand(downlinkFrame.GetTxInfo().GetFrequency())
+	if !ok {
+		return nil
+	}
+
+	at, err := airtime.DownlinkAirtime(&downlinkFrame)
+	if err != nil {
+		return errors.Wrap(err, "calculate airtime error")
+	}
+
+	var key dutyCycleKey
+	copy(key.gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	key.subBand = sb.name
+
+	var downID uuid.UUID
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	t.Lock()
+	defer t.Unlock()
+
+	used := t.used(key, now)
+	budget := t.budget(sb)
+
+	if used+at > budget {
+		t.setRemaining(key.gatewayID, sb.name, budget-used)
+		return fmt.Errorf("duty-cycle limit of sub-band %s exceeded (used: %s, airtime: %s, budget: %s)", sb.name, used, at, budget)
+	}
+
+	t.transmissions[key] = append(t.transmissions[key], transmission{
+		downlinkID: downID,
+		time:       now,
+		airtime:    at,
+	})
+	t.setRemaining(key.gatewayID, sb.name, budget-used-at)
+
+	return nil
+}
+
+// release removes the airtime of the given downlink, e.g. when the downlink
+// was not transmitted.
+func (t *dutyCycleTracker) release(gatewayID lorawan.EUI64, downID uuid.UUID, now time.Time) {
+	if downID == uuid.Nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	for _, sb := range t.subBands {
+		key := dutyCycleKey{gatewayID: gatewayID, subBand: sb.name}
+
+		for i, tx := range t.transmissions[key] {
+			if tx.downlinkID == downID {
+				t.transmissions[key] = append(t.transmissions[key][:i], t.transmissions[key][i+1:]...)
+				t.setRemaining(gatewayID, sb.name, t.budget(sb)-t.used(key, now))
+				return
+			}
+		}
+	}
+}
+
+// setRemaining exposes the remaining airtime of the given gateway and
+// sub-band.
+func (t *dutyCycleTracker) setRemaining(gatewayID lorawan.EUI64, subBand string, remaining time.Duration) {
+	if t.metrics != nil {
+		t.metrics.setDutyCycleRemaining(gatewayID, subBand, remaining)
+	}
+}
+
+// used returns the used airtime within the window, after removing the
+// transmissions which are outside the window. It must be called with the
+// lock held.
+func (t *dutyCycleTracker) used(key dutyCycleKey, now time.Time) time.Duration {
+	var used time.Duration
+	var transmissions []transmission
+
+	for _, tx := range t.transmissions[key] {
+		if now.Sub(tx.time) >= t.window {
+			continue
+		}
+
+		used += tx.airtime
+		transmissions = append(transmissions, tx)
+	}
+
+	if len(transmissions) == 0 {
+		delete(t.transmissions, key)
+	} else {
+		t.transmissions[key] = transmissions
+	}
+
+	return used
+}
+
+// budget returns the airtime budget of the given sub-band within the window.
+func (t *dutyCycleTracker) budget(sb subBand) time.Duration {
+	return time.Duration(float64(t.window) * sb.dutyCycle)
+}
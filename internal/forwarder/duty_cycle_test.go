@@ -0,0 +1,123 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/airtime"
+	"github.com/brocaar/lorawan"
+)
+
+func TestDutyCycleTracker(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	downlink := func(gatewayID lorawan.EUI64, frequency uint32) gw.DownlinkFrame {
+		downID, _ := uuid.NewV4()
+
+		return gw.DownlinkFrame{
+			PhyPayload: make([]byte, 20),
+			DownlinkId: downID[:],
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId:  gatewayID[:],
+				Frequency:  frequency,
+				Modulation: common.Modulation_LORA,
+				ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+					LoraModulationInfo: &gw.LoRaModulationInfo{
+						Bandwidth:       125,
+						SpreadingFactor: 12,
+						CodeRate:        "4/5",
+					},
+				},
+			},
+		}
+	}
+
+	df := downlink(gatewayID, 868100000)
+	at, err := airtime.DownlinkAirtime(&df)
+	require.NoError(t, err)
+
+	// window resulting in a 1% budget of 2.5 downlinks
+	window := at * 250
+
+	t.Run("unknown region", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := newDutyCycleTracker("US915", window, nil)
+		assert.Error(err)
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		tr, err := newDutyCycleTracker("EU868", window, nil)
+		assert.NoError(err)
+
+		assert.NoError(tr.reserve(downlink(gatewayID, 868100000), now))
+		assert.NoError(tr.reserve(downlink(gatewayID, 868300000), now))
+		assert.Error(tr.reserve(downlink(gatewayID, 868500000), now))
+
+		// other sub-band
+		assert.NoError(tr.reserve(downlink(gatewayID, 869525000), now))
+
+		// other gateway
+		assert.NoError(tr.reserve(downlink(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}, 868100000), now))
+
+		// outside sub-bands with duty-cycle limit
+		for i := 0; i < 5; i++ {
+			assert.NoError(tr.reserve(downlink(gatewayID, 869300000), now))
+		}
+
+		// the first transmissions are outside the window
+		assert.NoError(tr.reserve(downlink(gatewayID, 868100000), now.Add(window)))
+	})
+
+	t.Run("release", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		tr, err := newDutyCycleTracker("EU868", window, nil)
+		assert.NoError(err)
+
+		df := downlink(gatewayID, 868100000)
+		var downID uuid.UUID
+		copy(downID[:], df.DownlinkId)
+
+		assert.NoError(tr.reserve(df, now))
+		assert.NoError(tr.reserve(downlink(gatewayID, 868100000), now))
+		assert.Error(tr.reserve(downlink(gatewayID, 868100000), now))
+
+		tr.release(gatewayID, downID, now)
+		assert.NoError(tr.reserve(downlink(gatewayID, 868100000), now))
+	})
+
+	t.Run("remaining airtime metrics", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		m, err := newGatewayMetrics(prometheus.NewRegistry(), 1)
+		assert.NoError(err)
+
+		tr, err := newDutyCycleTracker("EU868", window, m)
+		assert.NoError(err)
+
+		assert.NoError(tr.reserve(downlink(gatewayID, 868100000), now))
+		assert.InDelta((window/100 - at).Seconds(), testutil.ToFloat64(m.dutyCycleRemaining.WithLabelValues(gatewayID.String(), "868.0-868.6")), 0.001)
+
+		// the gateways exceeding the max. number of gateways are not exposed
+		assert.NoError(tr.reserve(downlink(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}, 868100000), now))
+		assert.Equal(1, seriesCount(m.dutyCycleRemaining))
+
+		// the series are removed together with the other per-gateway series
+		m.setSubscription(gatewayID, false, now)
+		m.cleanup(now.Add(gatewayMetricsGracePeriod))
+		assert.Equal(0, seriesCount(m.dutyCycleRemaining))
+	})
+}
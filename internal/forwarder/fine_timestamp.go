@@ -0,0 +1,126 @@
+package forwarder
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// fineTimestampDecrypter decrypts the encrypted fine-timestamp of the
+// uplinks, using the AES key configured for the gateway (or the default key).
+type fineTimestampDecrypter struct {
+	defaultKey *lorawan.AES128Key
+	keys       map[lorawan.EUI64]lorawan.AES128Key
+}
+
+func newFineTimestampDecrypter(conf config.Config) (*fineTimestampDecrypter, error) {
+	d := fineTimestampDecrypter{
+		keys: make(map[lorawan.EUI64]lorawan.AES128Key),
+	}
+
+	if conf.Forwarder.FineTimestamp.AESKey != "" {
+		var key lorawan.AES128Key
+		if err := key.UnmarshalText([]byte(conf.Forwarder.FineTimestamp.AESKey)); err != nil {
+			return nil, errors.Wrap(err, "unmarshal aes_key error")
+		}
+		d.defaultKey = &key
+	}
+
+	for _, gwConf := range conf.Forwarder.FineTimestamp.Gateways {
+		var gatewayID lorawan.EUI64
+		var key lorawan.AES128Key
+
+		if err := gatewayID.UnmarshalText([]byte(gwConf.GatewayID)); err != nil {
+			return nil, errors.Wrap(err, "unmarshal gateway_id error")
+		}
+		if err := key.UnmarshalText([]byte(gwConf.AESKey)); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal aes_key of gateway %s error", gatewayID)
+		}
+
+		d.keys[gatewayID] = key
+	}
+
+	return &d, nil
+}
+
+// decrypt replaces the encrypted fine-timestamp of the given uplink by the
+// plain fine-timestamp. Uplinks without encrypted fine-timestamp and uplinks
+// of gateways without AES key are not modified.
+func (d *fineTimestampDecrypter) decrypt(uplinkFrame *gw.UplinkFrame) error {
+	rxInfo := uplinkFrame.GetRxInfo()
+	ts := rxInfo.GetEncryptedFineTimestamp()
+	if ts == nil {
+		return nil
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], rxInfo.GetGatewayId())
+
+	key, ok := d.keys[gatewayID]
+	if !ok {
+		if d.defaultKey == nil {
+			return nil
+		}
+		key = *d.defaultKey
+	}
+
+	if rxInfo.GetTime() == nil {
+		return errors.New("uplink time is required to decrypt the fine-timestamp")
+	}
+
+	rxTime, err := ptypes.Timestamp(rxInfo.GetTime())
+	if err != nil {
+		return errors.Wrap(err, "get uplink time error")
+	}
+
+	plain, err := decryptFineTimestamp(key, rxTime, ts)
+	if err != nil {
+		return err
+	}
+
+	rxInfo.FineTimestampType = gw.FineTimestampType_PLAIN
+	rxInfo.FineTimestamp = &gw.UplinkRXInfo_PlainFineTimestamp{
+		PlainFineTimestamp: plain,
+	}
+
+	return nil
+}
+
+// decryptFineTimestamp decrypts the nanosecond part of the fine-timestamp.
+// The seconds are taken from the (GPS) time at which the uplink was
+// received.
+func decryptFineTimestamp(key lorawan.AES128Key, rxTime time.Time, ts *gw.EncryptedFineTimestamp) (*gw.PlainFineTimestamp, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher error")
+	}
+
+	if len(ts.GetEncryptedNs()) != block.BlockSize() {
+		return nil, errors.Errorf("invalid encrypted fine-timestamp length, expected %d bytes, got %d", block.BlockSize(), len(ts.GetEncryptedNs()))
+	}
+
+	b := make([]byte, block.BlockSize())
+	block.Decrypt(b, ts.GetEncryptedNs())
+
+	nsec := binary.BigEndian.Uint64(b[len(b)-8:])
+	if nsec >= uint64(time.Second) {
+		return nil, errors.Errorf("invalid fine-timestamp nanoseconds: %d", nsec)
+	}
+
+	t := rxTime.Truncate(time.Second).Add(time.Duration(nsec))
+	tsProto, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "timestamp proto error")
+	}
+
+	return &gw.PlainFineTimestamp{
+		Time: tsProto,
+	}, nil
+}
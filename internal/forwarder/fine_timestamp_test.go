@@ -0,0 +1,115 @@
+package forwarder
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestFineTimestampDecrypter(t *testing.T) {
+	key := lorawan.AES128Key{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	encrypt := func(nsec uint64) []byte {
+		block, err := aes.NewCipher(key[:])
+		require.NoError(t, err)
+
+		b := make([]byte, 16)
+		binary.BigEndian.PutUint64(b[8:], nsec)
+		block.Encrypt(b, b)
+		return b
+	}
+
+	uplink := func(gatewayID lorawan.EUI64, rxTime time.Time, encryptedNS []byte) gw.UplinkFrame {
+		rxTimeProto, err := ptypes.TimestampProto(rxTime)
+		require.NoError(t, err)
+
+		return gw.UplinkFrame{
+			RxInfo: &gw.UplinkRXInfo{
+				GatewayId:         gatewayID[:],
+				Time:              rxTimeProto,
+				FineTimestampType: gw.FineTimestampType_ENCRYPTED,
+				FineTimestamp: &gw.UplinkRXInfo_EncryptedFineTimestamp{
+					EncryptedFineTimestamp: &gw.EncryptedFineTimestamp{
+						EncryptedNs: encryptedNS,
+					},
+				},
+			},
+		}
+	}
+
+	rxTime := time.Date(2021, 1, 2, 3, 4, 5, 123456000, time.UTC)
+
+	t.Run("Gateway key", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Forwarder.FineTimestamp.Gateways = []config.FineTimestampKey{
+			{GatewayID: gatewayID.String(), AESKey: key.String()},
+		}
+		d, err := newFineTimestampDecrypter(conf)
+		assert.NoError(err)
+
+		up := uplink(gatewayID, rxTime, encrypt(123456789))
+		assert.NoError(d.decrypt(&up))
+		assert.Equal(gw.FineTimestampType_PLAIN, up.RxInfo.FineTimestampType)
+
+		ts, err := ptypes.Timestamp(up.RxInfo.GetPlainFineTimestamp().GetTime())
+		assert.NoError(err)
+		assert.True(ts.Equal(time.Date(2021, 1, 2, 3, 4, 5, 123456789, time.UTC)))
+
+		// other gateway without default key
+		up = uplink(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}, rxTime, encrypt(123456789))
+		assert.NoError(d.decrypt(&up))
+		assert.Equal(gw.FineTimestampType_ENCRYPTED, up.RxInfo.FineTimestampType)
+	})
+
+	t.Run("Default key", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Forwarder.FineTimestamp.AESKey = key.String()
+		d, err := newFineTimestampDecrypter(conf)
+		assert.NoError(err)
+
+		up := uplink(gatewayID, rxTime, encrypt(5))
+		assert.NoError(d.decrypt(&up))
+		ts, err := ptypes.Timestamp(up.RxInfo.GetPlainFineTimestamp().GetTime())
+		assert.NoError(err)
+		assert.True(ts.Equal(time.Date(2021, 1, 2, 3, 4, 5, 5, time.UTC)))
+	})
+
+	t.Run("Invalid nanoseconds", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Forwarder.FineTimestamp.AESKey = key.String()
+		d, err := newFineTimestampDecrypter(conf)
+		assert.NoError(err)
+
+		up := uplink(gatewayID, rxTime, encrypt(uint64(time.Second)))
+		assert.EqualError(d.decrypt(&up), "invalid fine-timestamp nanoseconds: 1000000000")
+		assert.Equal(gw.FineTimestampType_ENCRYPTED, up.RxInfo.FineTimestampType)
+	})
+
+	t.Run("Missing time", func(t *testing.T) {
+		assert := require.New(t)
+
+		var conf config.Config
+		conf.Forwarder.FineTimestamp.AESKey = key.String()
+		d, err := newFineTimestampDecrypter(conf)
+		assert.NoError(err)
+
+		up := uplink(gatewayID, rxTime, encrypt(5))
+		up.RxInfo.Time = nil
+		assert.EqualError(d.decrypt(&up), "uplink time is required to decrypt the fine-timestamp")
+	})
+}
@@ -1,19 +1,48 @@
 package forwarder
 
 import (
+	"encoding/base64"
+	"time"
+
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/hooks"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/capture"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/filters"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/gwv4"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/metadata"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/metrics/snmp"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/statscounters"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/tracing"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/webui"
 	"github.com/brocaar/lorawan"
 )
 
-var alwaysSubscribe []lorawan.EUI64
+var (
+	alwaysSubscribe    []lorawan.EUI64
+	antennaGain        *antennaGainTable
+	clockDrift         *clockDriftEstimator
+	dutyCycle          *dutyCycleTracker
+	dedup              *deduplicator
+	fineTimestamp      *fineTimestampDecrypter
+	gwMetrics          *gatewayMetrics
+	downlinkRetry      *downlinkRetrier
+	downlinkValidation *downlinkValidator
+	lbt                *lbtTracker
+	rateLimit          *rateLimiter
+	rfStats            *rfMetrics
+	statsAggregation   *statsAggregator
+	downlinks          = newDownlinkCache()
+)
 
 // Setup configures the forwarder.
 func Setup(conf config.Config) error {
@@ -34,11 +63,95 @@ func Setup(conf config.Config) error {
 			return errors.Wrap(err, "unmarshal gateway_id error")
 		}
 
-		if err := i.SetGatewaySubscription(true, gatewayID); err != nil {
-			return errors.Wrap(err, "subscribe gateway error")
+		// the integration uses the mapped gateway ID(s)
+		for _, gatewayID := range backend.MappedGatewayIDs(gatewayID) {
+			if err := i.SetGatewaySubscription(true, gatewayID); err != nil {
+				return errors.Wrap(err, "subscribe gateway error")
+			}
+
+			alwaysSubscribe = append(alwaysSubscribe, gatewayID)
+		}
+	}
+
+	if conf.Metrics.Prometheus.PerGateway {
+		var err error
+		gwMetrics, err = newGatewayMetrics(prometheus.DefaultRegisterer, conf.Metrics.Prometheus.MaxGateways)
+		if err != nil {
+			return errors.Wrap(err, "setup per-gateway metrics error")
+		}
+		go gatewayMetricsCleanupLoop()
+	}
+
+	if conf.Forwarder.ClockDriftCompensation {
+		clockDrift = newClockDriftEstimator(conf.Forwarder.ClockDriftWindow, time.Duration(conf.Forwarder.MaxTimingCorrectionUS)*time.Microsecond, gwMetrics)
+	}
+
+	if conf.Forwarder.DutyCycle.Enabled {
+		var err error
+		dutyCycle, err = newDutyCycleTracker(conf.Forwarder.DutyCycle.Region, conf.Forwarder.DutyCycle.Window, gwMetrics)
+		if err != nil {
+			return errors.Wrap(err, "setup duty-cycle tracking error")
+		}
+	}
+
+	if conf.Forwarder.LBT.Enabled {
+		var err error
+		lbt, err = newLBTTracker(conf.Forwarder.LBT.Region, conf.Forwarder.LBT.ChannelBusyBackoff)
+		if err != nil {
+			return errors.Wrap(err, "setup listen-before-talk error")
+		}
+	}
+
+	if conf.Forwarder.DownlinkValidation.Enabled {
+		var err error
+		downlinkValidation, err = newDownlinkValidator(conf.Forwarder.DownlinkValidation.Region, conf.Forwarder.DownlinkValidation.MaxTXPower)
+		if err != nil {
+			return errors.Wrap(err, "setup downlink validation error")
+		}
+	}
+
+	if conf.Forwarder.RateLimit.Enabled {
+		rateLimit = newRateLimiter(conf.Forwarder.RateLimit.EventsPerSecond, conf.Forwarder.RateLimit.Burst)
+	}
+
+	if conf.Forwarder.DownlinkRetry.Enabled {
+		var err error
+		downlinkRetry, err = newDownlinkRetrier(conf)
+		if err != nil {
+			return errors.Wrap(err, "setup downlink retry error")
+		}
+	}
+
+	if conf.Forwarder.Deduplication.Enabled {
+		dedup = newDeduplicator(conf.Forwarder.Deduplication.Window, publishUplinkFrameSet)
+	}
+
+	if conf.Forwarder.StatsAggregation.Enabled {
+		statsAggregation = newStatsAggregator(conf.Forwarder.StatsAggregation.Interval, conf.Forwarder.StatsAggregation.BridgeCounters, health.Reconnects, publishGatewayStats)
+	}
+
+	if conf.Forwarder.FineTimestamp.AESKey != "" || len(conf.Forwarder.FineTimestamp.Gateways) != 0 {
+		var err error
+		fineTimestamp, err = newFineTimestampDecrypter(conf)
+		if err != nil {
+			return errors.Wrap(err, "setup fine-timestamp decryption error")
+		}
+	}
+
+	if len(conf.Forwarder.AntennaGain) != 0 {
+		var err error
+		antennaGain, err = newAntennaGainTable(conf.Forwarder.AntennaGain)
+		if err != nil {
+			return errors.Wrap(err, "setup antenna gain error")
 		}
+	}
 
-		alwaysSubscribe = append(alwaysSubscribe, gatewayID)
+	if conf.Metrics.Prometheus.RFMetrics {
+		var err error
+		rfStats, err = newRFMetrics(prometheus.DefaultRegisterer)
+		if err != nil {
+			return errors.Wrap(err, "setup rf metrics error")
+		}
 	}
 
 	go gatewaySubscribeLoop()
@@ -49,6 +162,7 @@ func Setup(conf config.Config) error {
 	go forwardGatewayConfigurationLoop()
 	go forwardRawPacketForwarderCommandLoop()
 	go forwardRawPacketForwarderEventLoop()
+	go forwardLogEventLoop()
 
 	return nil
 }
@@ -58,72 +172,454 @@ func gatewaySubscribeLoop() {
 		if err := integration.GetIntegration().SetGatewaySubscription(event.Subscribe, event.GatewayID); err != nil {
 			log.WithError(err).Error("set gateway subscription error")
 		}
+
+		if event.ConnState != nil {
+			publishConnState(event)
+		}
+
+		snmp.SetGatewayConnected(event.GatewayID, event.Subscribe)
+
+		if gwMetrics != nil {
+			gwMetrics.setSubscription(event.GatewayID, event.Subscribe, time.Now())
+		}
+
+		if clockDrift != nil && !event.Subscribe {
+			clockDrift.removeGateway(event.GatewayID)
+		}
+	}
+}
+
+func gatewayMetricsCleanupLoop() {
+	for {
+		time.Sleep(time.Minute)
+		gwMetrics.cleanup(time.Now())
+	}
+}
+
+// publishConnState publishes the connection state of the given subscribe
+// event.
+func publishConnState(event events.Subscribe) {
+	connState := *event.ConnState
+	connState.GatewayId = event.GatewayID[:]
+	connState.State = events.ConnStateOffline
+	if event.Subscribe {
+		connState.State = events.ConnStateOnline
+	}
+
+	if err := integration.GetIntegration().PublishEvent(event.GatewayID, integration.EventConn, uuid.Nil, &connState); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id": event.GatewayID,
+			"event_type": integration.EventConn,
+		}).Error("publish event error")
 	}
 }
 
 func forwardUplinkFrameLoop() {
 	for uplinkFrame := range backend.GetBackend().GetUplinkFrameChan() {
+		var gatewayID lorawan.EUI64
+		var uplinkID uuid.UUID
+		copy(gatewayID[:], uplinkFrame.GetRxInfo().GetGatewayId())
+		copy(uplinkID[:], uplinkFrame.GetRxInfo().GetUplinkId())
+		countBridgeEvent(gatewayID, counterUplinkReceived)
+
+		tracing.StartTrace(uplinkID, "uplink", tracing.Attr("gateway_id", gatewayID), tracing.Attr("uplink_id", uplinkID))
+
+		if clockDrift != nil {
+			clockDrift.addUplink(uplinkFrame, time.Now())
+		}
+
+		// The filters are applied here (instead of by the backends), such
+		// that these are applied to the uplinks of all the backends.
+		span := tracing.StartSpan(uplinkID, "filters")
+		if !filters.MatchFilters(uplinkFrame.PhyPayload) {
+			countBridgeEvent(gatewayID, counterUplinkDropped)
+			log.WithFields(log.Fields{
+				"data_base64": base64.StdEncoding.EncodeToString(uplinkFrame.PhyPayload),
+			}).Debug("frame dropped because of configured filters")
+			span.End(nil)
+			tracing.EndTrace(uplinkID, errors.New("dropped by filters"))
+			continue
+		}
+
+		if !filters.MatchRadioFilters(&uplinkFrame) {
+			countBridgeEvent(gatewayID, counterUplinkDropped)
+			log.WithFields(log.Fields{
+				"rssi": uplinkFrame.GetRxInfo().GetRssi(),
+				"snr":  uplinkFrame.GetRxInfo().GetLoraSnr(),
+			}).Debug("frame dropped because of configured rssi / snr filters")
+			span.End(nil)
+			tracing.EndTrace(uplinkID, errors.New("dropped by rssi / snr filters"))
+			continue
+		}
+
+		if rateLimited(gatewayID, integration.EventUp) {
+			countBridgeEvent(gatewayID, counterUplinkDropped)
+			span.End(nil)
+			tracing.EndTrace(uplinkID, errors.New("dropped by rate limit"))
+			continue
+		}
+		span.End(nil)
+
 		go func(uplinkFrame gw.UplinkFrame) {
 			var gatewayID lorawan.EUI64
 			var uplinkID uuid.UUID
 			copy(gatewayID[:], uplinkFrame.RxInfo.GatewayId)
 			copy(uplinkID[:], uplinkFrame.RxInfo.UplinkId)
 
-			if err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventUp, uplinkID, &uplinkFrame); err != nil {
+			if fineTimestamp != nil && uplinkFrame.GetRxInfo().GetEncryptedFineTimestamp() != nil {
+				if err := fineTimestamp.decrypt(&uplinkFrame); err != nil {
+					fineTimestampDecryptCounter("error").Inc()
+					log.WithError(err).WithFields(log.Fields{
+						"gateway_id": gatewayID,
+						"uplink_id":  uplinkID,
+					}).Error("decrypt fine-timestamp error")
+				} else if uplinkFrame.GetRxInfo().GetPlainFineTimestamp() != nil {
+					fineTimestampDecryptCounter("ok").Inc()
+				}
+			}
+
+			span := tracing.StartSpan(uplinkID, "hooks")
+			err := hooks.RunUplinkHooks(&uplinkFrame)
+			span.End(err)
+			if err != nil {
+				countBridgeEvent(gatewayID, counterUplinkDropped)
+				logHookError(err, log.Fields{
+					"gateway_id": gatewayID,
+					"event_type": integration.EventUp,
+					"uplink_id":  uplinkID,
+				})
+				tracing.EndTrace(uplinkID, err)
+				return
+			}
+
+			countBridgeEvent(gatewayID, counterUplinkForwarded)
+			snmp.GatewayEvent(gatewayID, snmp.EventUplink)
+			webui.Uplink(uplinkFrame)
+			capture.Uplink(uplinkFrame)
+			if gwMetrics != nil {
+				gwMetrics.uplinkCounter(gatewayID).Inc()
+			}
+			if rfStats != nil {
+				rfStats.observeUplink(uplinkFrame)
+			}
+
+			// the deduplicated uplinks are published as a new (uplink set)
+			// trace, see publishUplinkFrameSet
+			if dedup != nil {
+				dedup.add(uplinkFrame)
+				tracing.EndTrace(uplinkID, nil)
+				return
+			}
+
+			err = integration.GetIntegration().PublishEvent(gatewayID, integration.EventUp, uplinkID, &uplinkFrame)
+			if err != nil {
 				log.WithError(err).WithFields(log.Fields{
 					"gateway_id": gatewayID,
 					"event_type": integration.EventUp,
 					"uplink_id":  uplinkID,
 				}).Error("publish event error")
 			}
+			tracing.EndTrace(uplinkID, err)
 		}(uplinkFrame)
 	}
 }
 
+// rateLimited returns true when the given event of the gateway exceeds the
+// configured rate limit, in which case the event must be dropped.
+func rateLimited(gatewayID lorawan.EUI64, event string) bool {
+	if rateLimit == nil || rateLimit.allow(gatewayID, time.Now()) {
+		return false
+	}
+
+	rateLimitDropCounter(event).Inc()
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"event_type": event,
+	}).Debug("event dropped because of rate limit")
+
+	return true
+}
+
+// publishUplinkFrameSet publishes the deduplicated uplinks. The gateway and
+// uplink ID of the first received uplink are used for publishing.
+func publishUplinkFrameSet(set gw.UplinkFrameSet) {
+	var gatewayID lorawan.EUI64
+	var uplinkID uuid.UUID
+	copy(gatewayID[:], set.RxInfo[0].GetGatewayId())
+	copy(uplinkID[:], set.RxInfo[0].GetUplinkId())
+
+	tracing.StartTrace(uplinkID, "uplink_set", tracing.Attr("gateway_id", gatewayID), tracing.Attr("uplink_id", uplinkID), tracing.Attr("gateway_count", len(set.RxInfo)))
+
+	err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventUpSet, uplinkID, &set)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"event_type": integration.EventUpSet,
+			"uplink_id":  uplinkID,
+		}).Error("publish event error")
+	}
+	tracing.EndTrace(uplinkID, err)
+}
+
 func forwardGatewayStatsLoop() {
 	for stats := range backend.GetBackend().GetGatewayStatsChan() {
-		go func(stats gw.GatewayStats) {
-			var gatewayID lorawan.EUI64
-			var statsID uuid.UUID
-			copy(gatewayID[:], stats.GatewayId)
-			copy(statsID[:], stats.StatsId)
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], stats.GatewayId)
+		if rateLimited(gatewayID, integration.EventStats) {
+			continue
+		}
 
-			// add meta-data to stats
-			stats.MetaData = metadata.Get()
+		if statsAggregation != nil {
+			statsAggregation.add(stats)
+			continue
+		}
 
-			if err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventStats, statsID, &stats); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"gateway_id": gatewayID,
-					"event_type": integration.EventStats,
-					"stats_id":   statsID,
-				}).Error("publish event error")
+		go publishGatewayStats(stats)
+	}
+}
+
+// publishGatewayStats adds the meta-data and location to the given stats,
+// runs the stats hooks and publishes the stats.
+func publishGatewayStats(stats gw.GatewayStats) {
+	var gatewayID lorawan.EUI64
+	var statsID uuid.UUID
+	copy(gatewayID[:], stats.GatewayId)
+	copy(statsID[:], stats.StatsId)
+
+	// add meta-data to stats, the backend might already have set
+	// meta-data (e.g. the Semtech UDP rx counters)
+	if md := metadata.Get(); len(md) != 0 {
+		if stats.MetaData == nil {
+			stats.MetaData = make(map[string]string)
+		}
+		for k, v := range md {
+			stats.MetaData[k] = v
+		}
+	}
+
+	// the gpsd location overrides the location reported by the
+	// packet-forwarder (e.g. the static location of its config)
+	if loc, fix := metadata.GetLocation(); fix != "" {
+		if stats.MetaData == nil {
+			stats.MetaData = make(map[string]string)
+		}
+		stats.MetaData["gps_fix"] = fix
+
+		if loc != nil {
+			if fix == "2d" && stats.Location != nil {
+				loc.Altitude = stats.Location.Altitude
 			}
-		}(stats)
+			stats.Location = loc
+		}
+	}
+
+	// drop or flag implausible locations (e.g. bad GPS fixes)
+	filters.FilterGatewayLocation(&stats)
+
+	statscounters.Add(&stats)
+
+	if err := hooks.RunStatsHooks(&stats); err != nil {
+		logHookError(err, log.Fields{
+			"gateway_id": gatewayID,
+			"event_type": integration.EventStats,
+			"stats_id":   statsID,
+		})
+		return
+	}
+
+	snmp.GatewayEvent(gatewayID, snmp.EventStats)
+	if gwMetrics != nil {
+		gwMetrics.statsCounter(gatewayID).Inc()
+	}
+
+	if err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventStats, statsID, &stats); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"event_type": integration.EventStats,
+			"stats_id":   statsID,
+		}).Error("publish event error")
+	}
+}
+
+// countBridgeEvent increments the given bridge counter of the gateway, which
+// is added to the aggregated stats.
+func countBridgeEvent(gatewayID lorawan.EUI64, c bridgeCounter) {
+	if statsAggregation != nil {
+		statsAggregation.count(gatewayID, c)
 	}
 }
 
 func forwardDownlinkTxAckLoop() {
 	for txAck := range backend.GetBackend().GetDownlinkTXAckChan() {
-		go func(txAck gw.DownlinkTXAck) {
-			var gatewayID lorawan.EUI64
-			copy(gatewayID[:], txAck.GatewayId)
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], txAck.GatewayId)
+		countBridgeEvent(gatewayID, counterDownlinkAckReceived)
 
-			var downID uuid.UUID
-			copy(downID[:], txAck.DownlinkId)
+		go forwardDownlinkTxAck(txAck)
+	}
+}
 
-			if err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventAck, downID, &txAck); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"gateway_id":  gatewayID,
-					"event_type":  integration.EventAck,
-					"downlink_id": downID,
-				}).Error("publish event error")
-			}
-		}(txAck)
+func forwardDownlinkTxAck(txAck gw.DownlinkTXAck) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], txAck.GatewayId)
+
+	var downID uuid.UUID
+	copy(downID[:], txAck.DownlinkId)
+
+	span := tracing.StartSpan(downID, "tx_ack", tracing.Attr("error", txAck.Error))
+
+	// add the tx meta-data of the transmitted downlink
+	var downlinkFrame *gw.DownlinkFrame
+	var itemIndex uint32
+	var itemErrors []string
+	if item, ok := downlinks.pop(downID); ok {
+		downlinkFrame = &item.downlinkFrame
+		itemIndex = item.itemIndex
+		itemErrors = item.itemErrors
+	}
+
+	if lbt != nil && lbt.handleTXAck(&txAck, downlinkFrame.GetTxInfo().GetFrequency(), time.Now()) {
+		lbtChannelBusyCounter(gatewayID, downlinkFrame.GetTxInfo().GetFrequency()).Inc()
+	}
+
+	// the airtime of a downlink which was not transmitted does not count
+	// for the duty-cycle
+	if dutyCycle != nil && txAck.Error != "" && txAck.Error != dutyCycleError {
+		dutyCycle.release(gatewayID, downID, time.Now())
+	}
+
+	// the ack is not published when the downlink is retried, the ack of the
+	// retry will be published instead
+	if txAck.Error != "" && downlinkFrame != nil && retryDownlink(txAck, *downlinkFrame, itemIndex, itemErrors) {
+		span.SetAttribute("retried", true)
+		span.End(nil)
+		return
+	}
+	span.End(nil)
+
+	ack, err := enrichDownlinkTXAck(txAck, downlinkFrame)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id":  gatewayID,
+			"downlink_id": downID,
+		}).Warning("enrich downlink tx ack error")
+	}
+	ack.ItemIndex = itemIndex
+	ack.ItemErrors = itemErrors
+
+	// the pending items of a v4 downlink are not attempted once an item has
+	// been transmitted (or could not be retried)
+	ack.ItemCount = itemIndex + 1 + uint32(gwv4.DiscardDownlinkItems(downID))
+
+	snmp.GatewayEvent(gatewayID, snmp.EventDownlinkAck)
+	webui.DownlinkTXAck(txAck)
+	capture.DownlinkTXAck(txAck)
+	if ack.Error != "" {
+		snmp.GatewayEvent(gatewayID, snmp.EventDownlinkError)
 	}
+
+	if gwMetrics != nil {
+		gwMetrics.downlinkAckCounter(gatewayID).Inc()
+		if ack.Error != "" {
+			gwMetrics.downlinkErrorCounter(gatewayID).Inc()
+		}
+	}
+
+	if err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventAck, downID, &ack); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id":  gatewayID,
+			"event_type":  integration.EventAck,
+			"downlink_id": downID,
+		}).Error("publish event error")
+	}
+
+	var ackErr error
+	if ack.Error != "" {
+		ackErr = errors.New(ack.Error)
+	}
+	tracing.EndTrace(downID, ackErr)
+}
+
+// retryDownlink re-attempts the rejected downlink using the next item of the
+// (v4) downlink frame or, when enabled, in the RX2 receive-window. It returns
+// true when the retry was sent to the backend.
+func retryDownlink(txAck gw.DownlinkTXAck, downlinkFrame gw.DownlinkFrame, itemIndex uint32, itemErrors []string) bool {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], txAck.GatewayId)
+
+	var downID uuid.UUID
+	copy(downID[:], txAck.DownlinkId)
+
+	logFields := log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+		"error":       txAck.Error,
+	}
+
+	retryFrame, ok := gwv4.PopDownlinkItem(downID)
+	if !ok && downlinkRetry != nil {
+		var err error
+		retryFrame, ok, err = downlinkRetry.retryFrame(txAck, downlinkFrame, itemIndex)
+		if err != nil {
+			log.WithError(err).WithFields(logFields).Error("forwarder: get downlink retry frame error")
+			return false
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	if downlinkValidation != nil {
+		if txError, err := downlinkValidation.validate(retryFrame); err != nil {
+			downlinkValidationRejectCounter(txError).Inc()
+			log.WithError(err).WithFields(logFields).Warning("forwarder: downlink retry rejected by validation")
+			return false
+		}
+	}
+
+	if lbt != nil {
+		if err := lbt.check(retryFrame, time.Now()); err != nil {
+			log.WithError(err).WithFields(logFields).Warning("forwarder: downlink retry rejected by listen-before-talk back-off")
+			return false
+		}
+	}
+
+	if dutyCycle != nil {
+		if err := dutyCycle.reserve(retryFrame, time.Now()); err != nil {
+			log.WithError(err).WithFields(logFields).Warning("forwarder: downlink retry rejected by duty-cycle")
+			return false
+		}
+	}
+
+	downlinks.setItem(retryFrame, itemIndex+1, append(append([]string{}, itemErrors...), txAck.Error), time.Now())
+
+	if antennaGain != nil {
+		antennaGain.adjustDownlink(&retryFrame)
+	}
+
+	if err := backend.GetBackend().SendDownlinkFrame(retryFrame); err != nil {
+		downlinks.pop(downID)
+		if dutyCycle != nil {
+			dutyCycle.release(gatewayID, downID, time.Now())
+		}
+		log.WithError(err).WithFields(logFields).Error("forwarder: send downlink retry error")
+		return false
+	}
+
+	downlinkRetryCounter(txAck.Error).Inc()
+	log.WithFields(logFields).Info("forwarder: downlink rejected, retrying with next item")
+
+	return true
 }
 
 func forwardRawPacketForwarderEventLoop() {
 	for raw := range backend.GetBackend().GetRawPacketForwarderEventChan() {
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], raw.GatewayId)
+		if rateLimited(gatewayID, integration.EventRaw) {
+			continue
+		}
+
 		go func(raw gw.RawPacketForwarderEvent) {
 			var gatewayID lorawan.EUI64
 			copy(gatewayID[:], raw.GatewayId)
@@ -142,11 +638,158 @@ func forwardRawPacketForwarderEventLoop() {
 	}
 }
 
+func forwardLogEventLoop() {
+	for logEvent := range backend.GetBackend().GetLogEventChan() {
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], logEvent.GatewayId)
+		if rateLimited(gatewayID, integration.EventLog) {
+			continue
+		}
+
+		go func(logEvent events.Log) {
+			var gatewayID lorawan.EUI64
+			copy(gatewayID[:], logEvent.GatewayId)
+
+			var logID uuid.UUID
+			copy(logID[:], logEvent.LogId)
+
+			if err := integration.GetIntegration().PublishEvent(gatewayID, integration.EventLog, logID, &logEvent); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"gateway_id": gatewayID,
+					"event_type": integration.EventLog,
+					"log_id":     logID,
+				}).Error("publish event error")
+			}
+		}(logEvent)
+	}
+}
+
 func forwardDownlinkFrameLoop() {
 	for downlinkFrame := range integration.GetIntegration().GetDownlinkFrameChan() {
 		go func(downlinkFrame gw.DownlinkFrame) {
-			if err := backend.GetBackend().SendDownlinkFrame(downlinkFrame); err != nil {
+			var downID uuid.UUID
+			copy(downID[:], downlinkFrame.GetDownlinkId())
+
+			// the trace might already be started by the integration
+			tracing.StartTrace(downID, "downlink", tracing.Attr("downlink_id", downID))
+
+			span := tracing.StartSpan(downID, "hooks")
+			err := hooks.RunDownlinkHooks(&downlinkFrame)
+			span.End(err)
+			if err != nil {
+				logHookError(err, log.Fields{
+					"downlink_id": downID,
+				})
+
+				// the network server must not wait for the ack of a
+				// downlink which will never be sent
+				forwardDownlinkTxAck(gw.DownlinkTXAck{
+					GatewayId:  downlinkFrame.GetTxInfo().GetGatewayId(),
+					Token:      downlinkFrame.GetToken(),
+					DownlinkId: downlinkFrame.GetDownlinkId(),
+					Error:      hookDropError,
+				})
+				return
+			}
+
+			if clockDrift != nil {
+				if correction := clockDrift.correctDownlink(&downlinkFrame); correction != 0 {
+					log.WithFields(log.Fields{
+						"downlink_id": downID,
+						"correction":  correction,
+					}).Debug("delay corrected for clock-drift")
+				}
+			}
+
+			downlinks.set(downlinkFrame, time.Now())
+
+			var gatewayID lorawan.EUI64
+			copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+
+			countBridgeEvent(gatewayID, counterDownlinkReceived)
+			snmp.GatewayEvent(gatewayID, snmp.EventDownlink)
+			webui.Downlink(downlinkFrame)
+			capture.Downlink(downlinkFrame)
+			if gwMetrics != nil {
+				gwMetrics.downlinkCounter(gatewayID).Inc()
+			}
+			if rfStats != nil {
+				rfStats.observeDownlink(downlinkFrame)
+			}
+
+			if downlinkValidation != nil {
+				if txError, err := downlinkValidation.validate(downlinkFrame); err != nil {
+					downlinkValidationRejectCounter(txError).Inc()
+					log.WithError(err).WithFields(log.Fields{
+						"gateway_id":  gatewayID,
+						"downlink_id": downID,
+					}).Warning("downlink rejected by validation")
+
+					forwardDownlinkTxAck(gw.DownlinkTXAck{
+						GatewayId:  gatewayID[:],
+						Token:      downlinkFrame.GetToken(),
+						DownlinkId: downlinkFrame.GetDownlinkId(),
+						Error:      txError,
+					})
+					return
+				}
+			}
+
+			if lbt != nil {
+				if err := lbt.check(downlinkFrame, time.Now()); err != nil {
+					log.WithError(err).WithFields(log.Fields{
+						"gateway_id":  gatewayID,
+						"downlink_id": downID,
+					}).Warning("downlink rejected by listen-before-talk back-off")
+
+					forwardDownlinkTxAck(gw.DownlinkTXAck{
+						GatewayId:  gatewayID[:],
+						Token:      downlinkFrame.GetToken(),
+						DownlinkId: downlinkFrame.GetDownlinkId(),
+						Error:      lbtError,
+					})
+					return
+				}
+			}
+
+			if dutyCycle != nil {
+				if err := dutyCycle.reserve(downlinkFrame, time.Now()); err != nil {
+					log.WithError(err).WithFields(log.Fields{
+						"gateway_id":  gatewayID,
+						"downlink_id": downID,
+					}).Warning("downlink rejected by duty-cycle")
+
+					forwardDownlinkTxAck(gw.DownlinkTXAck{
+						GatewayId:  gatewayID[:],
+						Token:      downlinkFrame.GetToken(),
+						DownlinkId: downlinkFrame.GetDownlinkId(),
+						Error:      dutyCycleError,
+					})
+					return
+				}
+			}
+
+			if antennaGain != nil {
+				if adjustment := antennaGain.adjustDownlink(&downlinkFrame); adjustment != 0 {
+					log.WithFields(log.Fields{
+						"gateway_id":  gatewayID,
+						"downlink_id": downID,
+						"antenna":     downlinkFrame.GetTxInfo().GetAntenna(),
+						"adjustment":  adjustment,
+					}).Debug("tx power adjusted for antenna gain")
+				}
+			}
+
+			span = tracing.StartSpan(downID, "backend_send", tracing.Attr("gateway_id", gatewayID))
+			err = backend.GetBackend().SendDownlinkFrame(downlinkFrame)
+			span.End(err)
+			if err != nil {
+				// the downlink was not transmitted
+				if dutyCycle != nil {
+					dutyCycle.release(gatewayID, downID, time.Now())
+				}
 				log.WithError(err).Error("send downlink frame error")
+				tracing.EndTrace(downID, err)
 			}
 		}(downlinkFrame)
 	}
@@ -171,3 +814,17 @@ func forwardRawPacketForwarderCommandLoop() {
 		}(raw)
 	}
 }
+
+// hookDropError is the TX ack error of the downlinks dropped by a hook.
+const hookDropError = "DROPPED_BY_HOOK"
+
+// logHookError logs the error returned by the hooks. In case of
+// hooks.ErrDrop, the event was intentionally dropped.
+func logHookError(err error, fields log.Fields) {
+	if err == hooks.ErrDrop {
+		log.WithFields(fields).Debug("forwarder: event dropped by hook")
+		return
+	}
+
+	log.WithError(err).WithFields(fields).Error("forwarder: hook error, event dropped")
+}
@@ -0,0 +1,206 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/brocaar/lorawan"
+)
+
+// gatewayLabelOther defines the gateway_id label value used for the gateways
+// exceeding the max. number of gateways.
+const gatewayLabelOther = "other"
+
+// gatewayMetricsGracePeriod defines the duration after which the series of an
+// unsubscribed gateway are removed.
+var gatewayMetricsGracePeriod = 10 * time.Minute
+
+// gatewayMetrics implements the per-gateway counters. To protect the TSDB,
+// the number of distinct gateway_id label values is capped. The events of
+// gateways exceeding this cap are counted using the gateway_id="other" label.
+type gatewayMetrics struct {
+	sync.Mutex
+
+	maxGateways int
+
+	// gateways contains the gateways having their own series. The value is
+	// the time the gateway unsubscribed (zero while subscribed).
+	gateways map[lorawan.EUI64]time.Time
+
+	uplink        *prometheus.CounterVec
+	downlink      *prometheus.CounterVec
+	downlinkAck   *prometheus.CounterVec
+	downlinkError *prometheus.CounterVec
+	stats         *prometheus.CounterVec
+
+	// dutyCycleRemaining contains the remaining duty-cycle airtime per
+	// gateway and sub-band. subBands contains the sub-band label values, in
+	// order to remove the series of a gateway.
+	dutyCycleRemaining *prometheus.GaugeVec
+	subBands           map[string]struct{}
+
+	clockDrift *prometheus.GaugeVec
+}
+
+func newGatewayMetrics(reg prometheus.Registerer, maxGateways int) (*gatewayMetrics, error) {
+	m := gatewayMetrics{
+		maxGateways: maxGateways,
+		gateways:    make(map[lorawan.EUI64]time.Time),
+
+		uplink: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_gateway_uplink_count",
+			Help: "The number of forwarded uplinks (per gateway).",
+		}, []string{"gateway_id"}),
+		downlink: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_gateway_downlink_count",
+			Help: "The number of forwarded downlinks (per gateway).",
+		}, []string{"gateway_id"}),
+		downlinkAck: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_gateway_downlink_ack_count",
+			Help: "The number of forwarded downlink acknowledgements (per gateway).",
+		}, []string{"gateway_id"}),
+		downlinkError: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_gateway_downlink_ack_error_count",
+			Help: "The number of forwarded downlink acknowledgements containing an error (per gateway).",
+		}, []string{"gateway_id"}),
+		stats: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_gateway_stats_count",
+			Help: "The number of forwarded gateway stats (per gateway).",
+		}, []string{"gateway_id"}),
+
+		dutyCycleRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "forwarder_duty_cycle_remaining_seconds",
+			Help: "The remaining downlink airtime within the duty-cycle window in seconds (per gateway and sub-band).",
+		}, []string{"gateway_id", "sub_band"}),
+		subBands: make(map[string]struct{}),
+
+		clockDrift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "forwarder_clock_drift_ppm",
+			Help: "The estimated drift between the concentrator counter and the wall-clock time in ppm (per gateway).",
+		}, []string{"gateway_id"}),
+	}
+
+	for _, c := range m.counterVecs() {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Wrap(err, "register metric error")
+		}
+	}
+	for _, g := range []*prometheus.GaugeVec{m.dutyCycleRemaining, m.clockDrift} {
+		if err := reg.Register(g); err != nil {
+			return nil, errors.Wrap(err, "register metric error")
+		}
+	}
+
+	return &m, nil
+}
+
+func (m *gatewayMetrics) counterVecs() []*prometheus.CounterVec {
+	return []*prometheus.CounterVec{m.uplink, m.downlink, m.downlinkAck, m.downlinkError, m.stats}
+}
+
+// label returns the gateway_id label value for the given gateway.
+func (m *gatewayMetrics) label(gatewayID lorawan.EUI64) string {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.gateways[gatewayID]; !ok {
+		if len(m.gateways) >= m.maxGateways {
+			return gatewayLabelOther
+		}
+
+		m.gateways[gatewayID] = time.Time{}
+	}
+
+	return gatewayID.String()
+}
+
+func (m *gatewayMetrics) uplinkCounter(gatewayID lorawan.EUI64) prometheus.Counter {
+	return m.uplink.WithLabelValues(m.label(gatewayID))
+}
+
+func (m *gatewayMetrics) downlinkCounter(gatewayID lorawan.EUI64) prometheus.Counter {
+	return m.downlink.WithLabelValues(m.label(gatewayID))
+}
+
+func (m *gatewayMetrics) downlinkAckCounter(gatewayID lorawan.EUI64) prometheus.Counter {
+	return m.downlinkAck.WithLabelValues(m.label(gatewayID))
+}
+
+func (m *gatewayMetrics) downlinkErrorCounter(gatewayID lorawan.EUI64) prometheus.Counter {
+	return m.downlinkError.WithLabelValues(m.label(gatewayID))
+}
+
+func (m *gatewayMetrics) statsCounter(gatewayID lorawan.EUI64) prometheus.Counter {
+	return m.stats.WithLabelValues(m.label(gatewayID))
+}
+
+// setDutyCycleRemaining sets the remaining duty-cycle airtime of the given
+// gateway and sub-band. As the remaining airtime of multiple gateways can not
+// be aggregated, it is not set for the gateways exceeding the max. number of
+// gateways.
+func (m *gatewayMetrics) setDutyCycleRemaining(gatewayID lorawan.EUI64, subBand string, remaining time.Duration) {
+	label := m.label(gatewayID)
+	if label == gatewayLabelOther {
+		return
+	}
+
+	m.Lock()
+	m.subBands[subBand] = struct{}{}
+	m.Unlock()
+
+	m.dutyCycleRemaining.WithLabelValues(label, subBand).Set(remaining.Seconds())
+}
+
+// setClockDrift sets the estimated clock drift (ppm) of the given gateway.
+// Like the remaining duty-cycle airtime, it is not set for the gateways
+// exceeding the max. number of gateways.
+func (m *gatewayMetrics) setClockDrift(gatewayID lorawan.EUI64, ppm float64) {
+	label := m.label(gatewayID)
+	if label == gatewayLabelOther {
+		return
+	}
+
+	m.clockDrift.WithLabelValues(label).Set(ppm)
+}
+
+// setSubscription marks the gateway as (un)subscribed. The series of
+// unsubscribed gateways are removed by cleanup after the grace period.
+func (m *gatewayMetrics) setSubscription(gatewayID lorawan.EUI64, subscribe bool, now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.gateways[gatewayID]; !ok {
+		return
+	}
+
+	if subscribe {
+		m.gateways[gatewayID] = time.Time{}
+	} else {
+		m.gateways[gatewayID] = now
+	}
+}
+
+// cleanup removes the series of the gateways that unsubscribed more than the
+// grace period ago.
+func (m *gatewayMetrics) cleanup(now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	for gatewayID, unsubscribedAt := range m.gateways {
+		if unsubscribedAt.IsZero() || now.Sub(unsubscribedAt) < gatewayMetricsGracePeriod {
+			continue
+		}
+
+		for _, c := range m.counterVecs() {
+			c.DeleteLabelValues(gatewayID.String())
+		}
+		m.clockDrift.DeleteLabelValues(gatewayID.String())
+		for subBand := range m.subBands {
+			m.dutyCycleRemaining.DeleteLabelValues(gatewayID.String(), subBand)
+		}
+		delete(m.gateways, gatewayID)
+	}
+}
@@ -0,0 +1,121 @@
+package forwarder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestGatewayMetrics(t *testing.T) {
+	gw1 := lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+	gw2 := lorawan.EUI64{2, 2, 2, 2, 2, 2, 2, 2}
+	gw3 := lorawan.EUI64{3, 3, 3, 3, 3, 3, 3, 3}
+
+	t.Run("cap", func(t *testing.T) {
+		assert := require.New(t)
+
+		m, err := newGatewayMetrics(prometheus.NewRegistry(), 2)
+		assert.NoError(err)
+
+		m.uplinkCounter(gw1).Inc()
+		m.uplinkCounter(gw2).Inc()
+		m.uplinkCounter(gw2).Inc()
+		m.uplinkCounter(gw3).Inc()
+		m.statsCounter(gw3).Inc()
+
+		assert.NoError(testutil.CollectAndCompare(m.uplink, strings.NewReader(`
+# HELP forwarder_gateway_uplink_count The number of forwarded uplinks (per gateway).
+# TYPE forwarder_gateway_uplink_count counter
+forwarder_gateway_uplink_count{gateway_id="0101010101010101"} 1
+forwarder_gateway_uplink_count{gateway_id="0202020202020202"} 2
+forwarder_gateway_uplink_count{gateway_id="other"} 1
+`)))
+		assert.Equal(float64(1), testutil.ToFloat64(m.stats.WithLabelValues(gatewayLabelOther)))
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		assert := require.New(t)
+
+		m, err := newGatewayMetrics(prometheus.NewRegistry(), 1)
+		assert.NoError(err)
+
+		now := time.Now()
+
+		m.uplinkCounter(gw1).Inc()
+		m.downlinkAckCounter(gw1).Inc()
+		m.setSubscription(gw1, false, now)
+
+		// within the grace period the series are kept
+		m.cleanup(now.Add(gatewayMetricsGracePeriod - time.Second))
+		assert.Equal(1, seriesCount(m.uplink))
+		assert.Equal(gw1.String(), m.label(gw1))
+
+		// the gateway re-subscribed
+		m.setSubscription(gw1, true, now)
+		m.cleanup(now.Add(2 * gatewayMetricsGracePeriod))
+		assert.Equal(1, seriesCount(m.uplink))
+
+		// the series are removed after the grace period
+		m.setSubscription(gw1, false, now)
+		assert.Equal(gatewayLabelOther, m.label(gw2))
+		m.cleanup(now.Add(gatewayMetricsGracePeriod))
+		assert.Equal(0, seriesCount(m.uplink))
+		assert.Equal(0, seriesCount(m.downlinkAck))
+
+		// which frees up the label for other gateways
+		assert.Equal(gw2.String(), m.label(gw2))
+	})
+
+	t.Run("clock drift", func(t *testing.T) {
+		assert := require.New(t)
+
+		m, err := newGatewayMetrics(prometheus.NewRegistry(), 1)
+		assert.NoError(err)
+
+		now := time.Now()
+
+		// the gateways exceeding the cap are not exposed
+		m.setClockDrift(gw1, 12.5)
+		m.setClockDrift(gw2, 3)
+		assert.Equal(1, seriesCount(m.clockDrift))
+		assert.Equal(12.5, testutil.ToFloat64(m.clockDrift.WithLabelValues(gw1.String())))
+
+		m.setSubscription(gw1, false, now)
+		m.cleanup(now.Add(gatewayMetricsGracePeriod))
+		assert.Equal(0, seriesCount(m.clockDrift))
+	})
+
+	t.Run("default mode", func(t *testing.T) {
+		assert := require.New(t)
+
+		// per-gateway metrics are disabled by default
+		assert.Nil(gwMetrics)
+
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		assert.NoError(err)
+		for _, mf := range mfs {
+			assert.False(strings.HasPrefix(mf.GetName(), "forwarder_gateway_"), mf.GetName())
+		}
+	})
+}
+
+// seriesCount returns the number of series of the given collector.
+func seriesCount(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var count int
+	for range ch {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,141 @@
+package forwarder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// lbtError defines the downlink TX acknowledgement error of a downlink
+// rejected because the channel was busy (listen-before-talk).
+const lbtError = "CHANNEL_BUSY"
+
+// lbtErrors contains the TX acknowledgement errors reported by the
+// packet-forwarders for a downlink rejected by listen-before-talk. These are
+// replaced by lbtError.
+var lbtErrors = map[string]struct{}{
+	"LBT":             {},
+	"LBT_BUSY":        {},
+	"LBT_NOT_ALLOWED": {},
+	lbtError:          {},
+}
+
+// lbtBand defines a frequency range requiring listen-before-talk.
+type lbtBand struct {
+	minFreq uint32 // Hz, inclusive
+	maxFreq uint32 // Hz, exclusive
+}
+
+// lbtBands contains the frequency ranges requiring listen-before-talk per
+// region (ARIB STD-T108 for AS923 Japan, KC for KR920).
+var lbtBands = map[string][]lbtBand{
+	"AS923": {
+		{minFreq: 920600000, maxFreq: 928000000},
+	},
+	"KR920": {
+		{minFreq: 920900000, maxFreq: 923300000},
+	},
+}
+
+type lbtKey struct {
+	gatewayID lorawan.EUI64
+	frequency uint32
+}
+
+// lbtTracker tracks the channels reported busy by the gateways. Downlinks
+// for a channel reported busy are rejected until the back-off period has
+// expired.
+type lbtTracker struct {
+	sync.Mutex
+
+	backoff time.Duration
+	bands   []lbtBand
+
+	// busy contains the time the channel was reported busy.
+	busy map[lbtKey]time.Time
+}
+
+func newLBTTracker(region string, backoff time.Duration) (*lbtTracker, error) {
+	bands, ok := lbtBands[region]
+	if !ok {
+		return nil, fmt.Errorf("listen-before-talk is not defined for region: %s", region)
+	}
+
+	return &lbtTracker{
+		backoff: backoff,
+		bands:   bands,
+		busy:    make(map[lbtKey]time.Time),
+	}, nil
+}
+
+// inBand returns true when the given frequency requires listen-before-talk.
+func (t *lbtTracker) inBand(frequency uint32) bool {
+	for _, b := range t.bands {
+		if frequency >= b.minFreq && frequency < b.maxFreq {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleTXAck replaces the listen-before-talk error of the given TX
+// acknowledgement by lbtError and records the channel as busy. It returns
+// true when the downlink was rejected by listen-before-talk. As the downlinks
+// rejected by the back-off are acknowledged with the same error, false is
+// returned for a channel which is already within its back-off period.
+func (t *lbtTracker) handleTXAck(txAck *gw.DownlinkTXAck, frequency uint32, now time.Time) bool {
+	if _, ok := lbtErrors[txAck.Error]; !ok {
+		return false
+	}
+	txAck.Error = lbtError
+
+	if t.backoff == 0 || !t.inBand(frequency) {
+		return true
+	}
+
+	var key lbtKey
+	copy(key.gatewayID[:], txAck.GatewayId)
+	key.frequency = frequency
+
+	t.Lock()
+	defer t.Unlock()
+
+	if busyAt, ok := t.busy[key]; ok && now.Sub(busyAt) < t.backoff {
+		return false
+	}
+	t.busy[key] = now
+
+	return true
+}
+
+// check returns an error when the channel of the given downlink was reported
+// busy within the back-off period.
+func (t *lbtTracker) check(downlinkFrame gw.DownlinkFrame, now time.Time) error {
+	if t.backoff == 0 {
+		return nil
+	}
+
+	var key lbtKey
+	copy(key.gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	key.frequency = downlinkFrame.GetTxInfo().GetFrequency()
+
+	t.Lock()
+	defer t.Unlock()
+
+	// remove the channels for which the back-off has expired
+	for k, busyAt := range t.busy {
+		if now.Sub(busyAt) >= t.backoff {
+			delete(t.busy, k)
+		}
+	}
+
+	if busyAt, ok := t.busy[key]; ok {
+		return fmt.Errorf("channel %d Hz reported busy %s ago", key.frequency, now.Sub(busyAt))
+	}
+
+	return nil
+}
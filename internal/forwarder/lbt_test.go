@@ -0,0 +1,94 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestLBTTracker(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	downlink := func(frequency uint32) gw.DownlinkFrame {
+		return gw.DownlinkFrame{
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID[:],
+				Frequency: frequency,
+			},
+		}
+	}
+
+	t.Run("unknown region", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := newLBTTracker("EU868", time.Second)
+		assert.Error(err)
+	})
+
+	t.Run("error mapping", func(t *testing.T) {
+		tests := []struct {
+			Error         string
+			ExpectedError string
+			ExpectedBusy  bool
+		}{
+			{"", "", false},
+			{"TX_FREQ", "TX_FREQ", false},
+			{"LBT_NOT_ALLOWED", "CHANNEL_BUSY", true},
+			{"LBT", "CHANNEL_BUSY", true},
+			{"CHANNEL_BUSY", "CHANNEL_BUSY", true},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.Error, func(t *testing.T) {
+				assert := require.New(t)
+
+				tr, err := newLBTTracker("KR920", 0)
+				assert.NoError(err)
+
+				txAck := gw.DownlinkTXAck{GatewayId: gatewayID[:], Error: tst.Error}
+				assert.Equal(tst.ExpectedBusy, tr.handleTXAck(&txAck, 922100000, time.Now()))
+				assert.Equal(tst.ExpectedError, txAck.Error)
+			})
+		}
+	})
+
+	t.Run("back-off", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		tr, err := newLBTTracker("KR920", time.Second)
+		assert.NoError(err)
+
+		txAck := gw.DownlinkTXAck{GatewayId: gatewayID[:], Error: "LBT_NOT_ALLOWED"}
+		assert.True(tr.handleTXAck(&txAck, 922100000, now))
+
+		// same channel within back-off
+		assert.Error(tr.check(downlink(922100000), now.Add(500*time.Millisecond)))
+
+		// the back-off rejection is not a new busy indication
+		txAck = gw.DownlinkTXAck{GatewayId: gatewayID[:], Error: lbtError}
+		assert.False(tr.handleTXAck(&txAck, 922100000, now.Add(500*time.Millisecond)))
+
+		// other channel
+		assert.NoError(tr.check(downlink(922300000), now.Add(500*time.Millisecond)))
+
+		// back-off expired
+		assert.NoError(tr.check(downlink(922100000), now.Add(time.Second)))
+	})
+
+	t.Run("out of band", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		tr, err := newLBTTracker("KR920", time.Second)
+		assert.NoError(err)
+
+		txAck := gw.DownlinkTXAck{GatewayId: gatewayID[:], Error: "LBT"}
+		assert.True(tr.handleTXAck(&txAck, 868100000, now))
+		assert.NoError(tr.check(downlink(868100000), now))
+	})
+}
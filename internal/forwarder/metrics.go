@@ -0,0 +1,66 @@
+package forwarder
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/brocaar/lorawan"
+)
+
+var (
+	udc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "forwarder_uplink_duplicate_count",
+		Help: "The number of duplicate uplinks merged into an uplink frame-set by the deduplication.",
+	})
+
+	ftd = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwarder_fine_timestamp_decrypt_count",
+		Help: "The number of encrypted fine-timestamps decrypted by the forwarder (per result).",
+	}, []string{"result"})
+
+	drc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwarder_downlink_retry_count",
+		Help: "The number of downlinks rejected by the gateway and retried in the next receive-window (per error).",
+	}, []string{"error"})
+
+	lcb = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwarder_lbt_channel_busy_count",
+		Help: "The number of downlinks rejected by the gateway because the channel was busy (listen-before-talk) (per gateway and frequency).",
+	}, []string{"gateway_id", "frequency"})
+
+	rld = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwarder_rate_limit_drop_count",
+		Help: "The number of events dropped because the gateway exceeded the rate limit (per event type).",
+	}, []string{"event"})
+
+	dvr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forwarder_downlink_validation_reject_count",
+		Help: "The number of downlinks rejected by the downlink validation (per error).",
+	}, []string{"error"})
+)
+
+func uplinkDuplicateCounter() prometheus.Counter {
+	return udc
+}
+
+func fineTimestampDecryptCounter(result string) prometheus.Counter {
+	return ftd.With(prometheus.Labels{"result": result})
+}
+
+func downlinkRetryCounter(txError string) prometheus.Counter {
+	return drc.With(prometheus.Labels{"error": txError})
+}
+
+func lbtChannelBusyCounter(gatewayID lorawan.EUI64, frequency uint32) prometheus.Counter {
+	return lcb.With(prometheus.Labels{"gateway_id": gatewayID.String(), "frequency": strconv.FormatUint(uint64(frequency), 10)})
+}
+
+func rateLimitDropCounter(event string) prometheus.Counter {
+	return rld.With(prometheus.Labels{"event": event})
+}
+
+func downlinkValidationRejectCounter(txError string) prometheus.Counter {
+	return dvr.With(prometheus.Labels{"error": txError})
+}
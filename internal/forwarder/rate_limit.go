@@ -0,0 +1,86 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/brocaar/lorawan"
+)
+
+// rateLimitCleanupInterval defines the interval in which the buckets of the
+// idle gateways are removed.
+var rateLimitCleanupInterval = time.Minute
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// rateLimiter implements a token-bucket rate limiter per gateway. Each
+// bucket is refilled with rate tokens per second, up to burst tokens. An
+// event consumes one token.
+type rateLimiter struct {
+	sync.Mutex
+
+	rate  float64
+	burst float64
+
+	buckets     map[lorawan.EUI64]*tokenBucket
+	lastCleanup time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[lorawan.EUI64]*tokenBucket),
+	}
+}
+
+// allow returns true when the event of the given gateway is within the rate
+// limit, in which case a token is consumed.
+func (l *rateLimiter) allow(gatewayID lorawan.EUI64, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if now.Sub(l.lastCleanup) >= rateLimitCleanupInterval {
+		l.cleanup(now)
+	}
+
+	b, ok := l.buckets[gatewayID]
+	if !ok {
+		b = &tokenBucket{
+			tokens:    l.burst,
+			updatedAt: now,
+		}
+		l.buckets[gatewayID] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updatedAt).Seconds()*l.rate
+	if tokens > l.burst {
+		tokens = l.burst
+	}
+	return tokens
+}
+
+// cleanup removes the full buckets, as these are equal to a new bucket.
+func (l *rateLimiter) cleanup(now time.Time) {
+	for id, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, id)
+		}
+	}
+	l.lastCleanup = now
+}
@@ -0,0 +1,56 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestRateLimiter(t *testing.T) {
+	gw1 := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	gw2 := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	t.Run("burst and refill", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		l := newRateLimiter(2, 3)
+
+		// burst
+		for i := 0; i < 3; i++ {
+			assert.True(l.allow(gw1, now))
+		}
+		assert.False(l.allow(gw1, now))
+
+		// the buckets are per gateway
+		assert.True(l.allow(gw2, now))
+
+		// refilled with one token after 500ms
+		assert.True(l.allow(gw1, now.Add(500*time.Millisecond)))
+		assert.False(l.allow(gw1, now.Add(500*time.Millisecond)))
+
+		// the bucket does not exceed the burst
+		for i := 0; i < 3; i++ {
+			assert.True(l.allow(gw1, now.Add(time.Hour)))
+		}
+		assert.False(l.allow(gw1, now.Add(time.Hour)))
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		assert := require.New(t)
+		now := time.Now()
+
+		l := newRateLimiter(1, 2)
+		assert.True(l.allow(gw1, now))
+		assert.True(l.allow(gw2, now))
+		assert.Len(l.buckets, 2)
+
+		// the full buckets are removed, the gw2 bucket is re-created
+		assert.True(l.allow(gw2, now.Add(rateLimitCleanupInterval)))
+		assert.Len(l.buckets, 1)
+		assert.Contains(l.buckets, gw2)
+	})
+}
@@ -0,0 +1,87 @@
+package forwarder
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// rfMetrics implements the RF metrics, exposing the uplinks by modulation
+// parameters and frequency, the downlinks by TX power and frequency and the
+// RSSI / SNR distribution of the uplinks. The label values are bounded by the
+// channel-plan of the gateways, therefore these are not capped.
+type rfMetrics struct {
+	uplink   *prometheus.CounterVec
+	downlink *prometheus.CounterVec
+	rssi     *prometheus.HistogramVec
+	snr      *prometheus.HistogramVec
+}
+
+func newRFMetrics(reg prometheus.Registerer) (*rfMetrics, error) {
+	m := rfMetrics{
+		uplink: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_rf_uplink_count",
+			Help: "The number of forwarded uplinks (per modulation, spreading-factor, bandwidth and frequency).",
+		}, []string{"modulation", "spreading_factor", "bandwidth", "frequency"}),
+		downlink: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "forwarder_rf_downlink_count",
+			Help: "The number of forwarded downlinks (per TX power and frequency).",
+		}, []string{"tx_power", "frequency"}),
+		rssi: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "forwarder_rf_uplink_rssi_dbm",
+			Help:    "The RSSI of the forwarded uplinks in dBm (per spreading-factor).",
+			Buckets: prometheus.LinearBuckets(-130, 10, 10),
+		}, []string{"spreading_factor"}),
+		snr: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "forwarder_rf_uplink_snr_db",
+			Help:    "The SNR of the forwarded LoRa uplinks in dB (per spreading-factor).",
+			Buckets: prometheus.LinearBuckets(-20, 2.5, 13),
+		}, []string{"spreading_factor"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.uplink, m.downlink, m.rssi, m.snr} {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Wrap(err, "register metric error")
+		}
+	}
+
+	return &m, nil
+}
+
+// observeUplink updates the metrics for the given uplink.
+func (m *rfMetrics) observeUplink(uplinkFrame gw.UplinkFrame) {
+	txInfo := uplinkFrame.GetTxInfo()
+	frequency := strconv.FormatUint(uint64(txInfo.GetFrequency()), 10)
+
+	var sf, bw string
+	if mod := txInfo.GetLoraModulationInfo(); mod != nil {
+		sf = strconv.FormatUint(uint64(mod.GetSpreadingFactor()), 10)
+		bw = strconv.FormatUint(uint64(mod.GetBandwidth()), 10)
+	}
+
+	m.uplink.With(prometheus.Labels{
+		"modulation":       txInfo.GetModulation().String(),
+		"spreading_factor": sf,
+		"bandwidth":        bw,
+		"frequency":        frequency,
+	}).Inc()
+
+	m.rssi.With(prometheus.Labels{"spreading_factor": sf}).Observe(float64(uplinkFrame.GetRxInfo().GetRssi()))
+	if txInfo.GetModulation() == common.Modulation_LORA {
+		m.snr.With(prometheus.Labels{"spreading_factor": sf}).Observe(uplinkFrame.GetRxInfo().GetLoraSnr())
+	}
+}
+
+// observeDownlink updates the metrics for the given downlink.
+func (m *rfMetrics) observeDownlink(downlinkFrame gw.DownlinkFrame) {
+	txInfo := downlinkFrame.GetTxInfo()
+
+	m.downlink.With(prometheus.Labels{
+		"tx_power":  strconv.FormatInt(int64(txInfo.GetPower()), 10),
+		"frequency": strconv.FormatUint(uint64(txInfo.GetFrequency()), 10),
+	}).Inc()
+}
@@ -0,0 +1,86 @@
+package forwarder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestRFMetrics(t *testing.T) {
+	assert := require.New(t)
+
+	reg := prometheus.NewRegistry()
+	m, err := newRFMetrics(reg)
+	assert.NoError(err)
+
+	loraUplink := gw.UplinkFrame{
+		TxInfo: &gw.UplinkTXInfo{
+			Frequency:  868100000,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:       125,
+					SpreadingFactor: 7,
+				},
+			},
+		},
+		RxInfo: &gw.UplinkRXInfo{
+			Rssi:    -85,
+			LoraSnr: 7.5,
+		},
+	}
+	fskUplink := gw.UplinkFrame{
+		TxInfo: &gw.UplinkTXInfo{
+			Frequency:  868800000,
+			Modulation: common.Modulation_FSK,
+		},
+		RxInfo: &gw.UplinkRXInfo{
+			Rssi: -60,
+		},
+	}
+
+	m.observeUplink(loraUplink)
+	m.observeUplink(loraUplink)
+	m.observeUplink(fskUplink)
+	m.observeDownlink(gw.DownlinkFrame{
+		TxInfo: &gw.DownlinkTXInfo{
+			Frequency: 869525000,
+			Power:     27,
+		},
+	})
+
+	assert.NoError(testutil.CollectAndCompare(m.uplink, strings.NewReader(`
+# HELP forwarder_rf_uplink_count The number of forwarded uplinks (per modulation, spreading-factor, bandwidth and frequency).
+# TYPE forwarder_rf_uplink_count counter
+forwarder_rf_uplink_count{bandwidth="",frequency="868800000",modulation="FSK",spreading_factor=""} 1
+forwarder_rf_uplink_count{bandwidth="125",frequency="868100000",modulation="LORA",spreading_factor="7"} 2
+`)))
+
+	assert.NoError(testutil.CollectAndCompare(m.downlink, strings.NewReader(`
+# HELP forwarder_rf_downlink_count The number of forwarded downlinks (per TX power and frequency).
+# TYPE forwarder_rf_downlink_count counter
+forwarder_rf_downlink_count{frequency="869525000",tx_power="27"} 1
+`)))
+
+	// the SNR is only observed for LoRa uplinks
+	mfs, err := reg.Gather()
+	assert.NoError(err)
+	sampleCounts := make(map[string]uint64)
+	for _, mf := range mfs {
+		for _, metric := range mf.GetMetric() {
+			if h := metric.GetHistogram(); h != nil {
+				sampleCounts[mf.GetName()] += h.GetSampleCount()
+			}
+		}
+	}
+	assert.Equal(map[string]uint64{
+		"forwarder_rf_uplink_rssi_dbm": 3,
+		"forwarder_rf_uplink_snr_db":   2,
+	}, sampleCounts)
+}
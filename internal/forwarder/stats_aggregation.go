@@ -0,0 +1,163 @@
+package forwarder
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// bridgeCounter defines a counter of the events handled by the bridge for a
+// gateway.
+type bridgeCounter int
+
+// Bridge counters.
+const (
+	counterStatsReceived bridgeCounter = iota
+	counterUplinkReceived
+	counterUplinkForwarded
+	counterUplinkDropped
+	counterDownlinkReceived
+	counterDownlinkAckReceived
+)
+
+// bridgeCounterKeys contains the meta-data keys of the bridge counters.
+var bridgeCounterKeys = [...]string{
+	counterStatsReceived:       "bridge_stats_received",
+	counterUplinkReceived:      "bridge_uplink_received",
+	counterUplinkForwarded:     "bridge_uplink_forwarded",
+	counterUplinkDropped:       "bridge_uplink_dropped",
+	counterDownlinkReceived:    "bridge_downlink_received",
+	counterDownlinkAckReceived: "bridge_downlink_ack_received",
+}
+
+// bridgeCounters contains the bridge counters of a gateway since the
+// previous published stats.
+type bridgeCounters struct {
+	counters   [len(bridgeCounterKeys)]uint64
+	reconnects uint64
+}
+
+// statsAggregator merges the stats received from a gateway within the
+// aggregation interval into a single stats event. The interval starts with
+// the first stats of the gateway, after which the aggregated stats are
+// published.
+type statsAggregator struct {
+	sync.Mutex
+
+	interval       time.Duration
+	bridgeCounters bool
+	publish        func(gw.GatewayStats)
+	reconnects     func() uint64
+
+	stats    map[lorawan.EUI64]*gw.GatewayStats
+	counters map[lorawan.EUI64]*bridgeCounters
+}
+
+func newStatsAggregator(interval time.Duration, withCounters bool, reconnects func() uint64, publish func(gw.GatewayStats)) *statsAggregator {
+	return &statsAggregator{
+		interval:       interval,
+		bridgeCounters: withCounters,
+		publish:        publish,
+		reconnects:     reconnects,
+		stats:          make(map[lorawan.EUI64]*gw.GatewayStats),
+		counters:       make(map[lorawan.EUI64]*bridgeCounters),
+	}
+}
+
+// count increments the given bridge counter of the gateway.
+func (a *statsAggregator) count(gatewayID lorawan.EUI64, c bridgeCounter) {
+	if !a.bridgeCounters {
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.getCounters(gatewayID).counters[c]++
+}
+
+// add adds the given stats. The rx / tx packet counters are summed, the other
+// fields are taken from the last stats which has these set.
+func (a *statsAggregator) add(stats gw.GatewayStats) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], stats.GatewayId)
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.bridgeCounters {
+		a.getCounters(gatewayID).counters[counterStatsReceived]++
+	}
+
+	agg, ok := a.stats[gatewayID]
+	if !ok {
+		a.stats[gatewayID] = &stats
+
+		time.AfterFunc(a.interval, func() {
+			a.flush(gatewayID)
+		})
+		return
+	}
+
+	agg.RxPacketsReceived += stats.RxPacketsReceived
+	agg.RxPacketsReceivedOk += stats.RxPacketsReceivedOk
+	agg.TxPacketsReceived += stats.TxPacketsReceived
+	agg.TxPacketsEmitted += stats.TxPacketsEmitted
+
+	if stats.Time != nil {
+		agg.Time = stats.Time
+	}
+	if stats.Location != nil {
+		agg.Location = stats.Location
+	}
+	if stats.Ip != "" {
+		agg.Ip = stats.Ip
+	}
+	if stats.ConfigVersion != "" {
+		agg.ConfigVersion = stats.ConfigVersion
+	}
+	if len(stats.MetaData) != 0 {
+		if agg.MetaData == nil {
+			agg.MetaData = make(map[string]string)
+		}
+		for k, v := range stats.MetaData {
+			agg.MetaData[k] = v
+		}
+	}
+}
+
+func (a *statsAggregator) flush(gatewayID lorawan.EUI64) {
+	a.Lock()
+	stats := a.stats[gatewayID]
+	delete(a.stats, gatewayID)
+
+	if a.bridgeCounters {
+		counters := a.getCounters(gatewayID)
+		reconnects := a.reconnects()
+
+		if stats.MetaData == nil {
+			stats.MetaData = make(map[string]string)
+		}
+		for i, v := range counters.counters {
+			stats.MetaData[bridgeCounterKeys[i]] = strconv.FormatUint(v, 10)
+		}
+		stats.MetaData["bridge_integration_reconnects"] = strconv.FormatUint(reconnects-counters.reconnects, 10)
+
+		a.counters[gatewayID] = &bridgeCounters{reconnects: reconnects}
+	}
+	a.Unlock()
+
+	a.publish(*stats)
+}
+
+func (a *statsAggregator) getCounters(gatewayID lorawan.EUI64) *bridgeCounters {
+	c, ok := a.counters[gatewayID]
+	if !ok {
+		c = &bridgeCounters{reconnects: a.reconnects()}
+		a.counters[gatewayID] = c
+	}
+	return c
+}
@@ -0,0 +1,128 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestStatsAggregator(t *testing.T) {
+	assert := require.New(t)
+
+	var reconnects uint64 = 2
+	published := make(chan gw.GatewayStats, 10)
+	a := newStatsAggregator(50*time.Millisecond, true, func() uint64 { return reconnects }, func(stats gw.GatewayStats) {
+		published <- stats
+	})
+
+	gw1 := lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+	gw2 := lorawan.EUI64{2, 2, 2, 2, 2, 2, 2, 2}
+
+	a.count(gw1, counterUplinkReceived)
+	a.count(gw1, counterUplinkReceived)
+	a.count(gw1, counterUplinkForwarded)
+	a.count(gw1, counterUplinkDropped)
+	a.count(gw1, counterDownlinkReceived)
+	reconnects = 3
+
+	a.add(gw.GatewayStats{
+		GatewayId:         gw1[:],
+		StatsId:           []byte{1},
+		ConfigVersion:     "1.0.0",
+		RxPacketsReceived: 2,
+		TxPacketsReceived: 1,
+		MetaData:          map[string]string{"foo": "bar"},
+	})
+	a.add(gw.GatewayStats{
+		GatewayId:           gw1[:],
+		StatsId:             []byte{2},
+		Location:            &common.Location{Latitude: 1.123},
+		RxPacketsReceived:   3,
+		RxPacketsReceivedOk: 2,
+		TxPacketsEmitted:    1,
+		MetaData:            map[string]string{"foo": "baz"},
+	})
+	a.add(gw.GatewayStats{
+		GatewayId:         gw2[:],
+		RxPacketsReceived: 5,
+	})
+
+	received := make(map[lorawan.EUI64]gw.GatewayStats)
+	for i := 0; i < 2; i++ {
+		select {
+		case stats := <-published:
+			var gatewayID lorawan.EUI64
+			copy(gatewayID[:], stats.GatewayId)
+			received[gatewayID] = stats
+		case <-time.After(time.Second):
+			assert.FailNow("stats not published")
+		}
+	}
+
+	assert.Equal(gw.GatewayStats{
+		GatewayId:           gw1[:],
+		StatsId:             []byte{1},
+		ConfigVersion:       "1.0.0",
+		Location:            &common.Location{Latitude: 1.123},
+		RxPacketsReceived:   5,
+		RxPacketsReceivedOk: 2,
+		TxPacketsReceived:   1,
+		TxPacketsEmitted:    1,
+		MetaData: map[string]string{
+			"foo":                           "baz",
+			"bridge_stats_received":         "2",
+			"bridge_uplink_received":        "2",
+			"bridge_uplink_forwarded":       "1",
+			"bridge_uplink_dropped":         "1",
+			"bridge_downlink_received":      "1",
+			"bridge_downlink_ack_received":  "0",
+			"bridge_integration_reconnects": "1",
+		},
+	}, received[gw1])
+
+	assert.EqualValues(5, received[gw2].RxPacketsReceived)
+	assert.Equal("1", received[gw2].MetaData["bridge_stats_received"])
+	assert.Equal("0", received[gw2].MetaData["bridge_uplink_received"])
+
+	t.Run("counters are reset", func(t *testing.T) {
+		assert := require.New(t)
+
+		a.add(gw.GatewayStats{
+			GatewayId: gw1[:],
+		})
+
+		select {
+		case stats := <-published:
+			assert.Equal("1", stats.MetaData["bridge_stats_received"])
+			assert.Equal("0", stats.MetaData["bridge_uplink_received"])
+			assert.Equal("0", stats.MetaData["bridge_integration_reconnects"])
+		case <-time.After(time.Second):
+			assert.FailNow("stats not published")
+		}
+	})
+
+	t.Run("without bridge counters", func(t *testing.T) {
+		assert := require.New(t)
+
+		a := newStatsAggregator(10*time.Millisecond, false, func() uint64 { return 0 }, func(stats gw.GatewayStats) {
+			published <- stats
+		})
+
+		a.count(gw1, counterUplinkReceived)
+		a.add(gw.GatewayStats{
+			GatewayId: gw1[:],
+		})
+
+		select {
+		case stats := <-published:
+			assert.Nil(stats.MetaData)
+		case <-time.After(time.Second):
+			assert.FailNow("stats not published")
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/airtime"
+)
+
+// downlinkCacheDuration defines the duration a downlink frame is kept for
+// enriching the downlink TX acknowledgement.
+var downlinkCacheDuration = time.Minute
+
+// downlinkCacheCleanupInterval defines the interval at which the expired
+// items are removed from the downlink cache.
+var downlinkCacheCleanupInterval = 10 * time.Second
+
+// downlinkTXAck extends the gw.DownlinkTXAck message with the TX meta-data
+// of the transmitted item. The fields 1 - 4 are equal to gw.DownlinkTXAck,
+// such that consumers are able to decode it as gw.DownlinkTXAck.
+type downlinkTXAck struct {
+	// Gateway ID.
+	GatewayId []byte `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayID,proto3" json:"gateway_id,omitempty"`
+	// Token (uint16 value).
+	Token uint32 `protobuf:"varint,2,opt,name=token,proto3" json:"token,omitempty"`
+	// Error.
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// Downlink ID (UUID).
+	DownlinkId []byte `protobuf:"bytes,4,opt,name=downlink_id,json=downlinkID,proto3" json:"downlink_id,omitempty"`
+	// Index of the transmitted item.
+	ItemIndex uint32 `protobuf:"varint,100,opt,name=item_index,json=itemIndex,proto3" json:"item_index,omitempty"`
+	// Time on air of the transmitted item.
+	Airtime *duration.Duration `protobuf:"bytes,101,opt,name=airtime,proto3" json:"airtime,omitempty"`
+	// TX frequency (in Hz).
+	Frequency uint32 `protobuf:"varint,102,opt,name=frequency,proto3" json:"frequency,omitempty"`
+	// TX power (EIRP in dBm).
+	Power int32 `protobuf:"varint,103,opt,name=power,proto3" json:"power,omitempty"`
+	// Errors of the previous (rejected) items.
+	ItemErrors []string `protobuf:"bytes,104,rep,name=item_errors,json=itemErrors,proto3" json:"item_errors,omitempty"`
+	// Number of items of the downlink, the items after the transmitted item
+	// were not attempted.
+	ItemCount uint32 `protobuf:"varint,105,opt,name=item_count,json=itemCount,proto3" json:"item_count,omitempty"`
+}
+
+func (m *downlinkTXAck) Reset()         { *m = downlinkTXAck{} }
+func (m *downlinkTXAck) String() string { return proto.CompactTextString(m) }
+func (*downlinkTXAck) ProtoMessage()    {}
+
+func (m *downlinkTXAck) GetGatewayId() []byte           { return m.GatewayId }
+func (m *downlinkTXAck) GetDownlinkId() []byte          { return m.DownlinkId }
+func (m *downlinkTXAck) GetError() string               { return m.Error }
+func (m *downlinkTXAck) GetItemIndex() uint32           { return m.ItemIndex }
+func (m *downlinkTXAck) GetItemErrors() []string        { return m.ItemErrors }
+func (m *downlinkTXAck) GetItemCount() uint32           { return m.ItemCount }
+func (m *downlinkTXAck) GetAirtime() *duration.Duration { return m.Airtime }
+func (m *downlinkTXAck) GetFrequency() uint32           { return m.Frequency }
+func (m *downlinkTXAck) GetPower() int32                { return m.Power }
+
+type downlinkCacheItem struct {
+	downlinkFrame gw.DownlinkFrame
+	itemIndex     uint32
+	itemErrors    []string
+	createdAt     time.Time
+}
+
+// downlinkCache stores the downlink frames by downlink ID until the
+// downlink TX acknowledgement has been received.
+type downlinkCache struct {
+	sync.Mutex
+	items       map[uuid.UUID]downlinkCacheItem
+	lastCleanup time.Time
+}
+
+func newDownlinkCache() *downlinkCache {
+	return &downlinkCache{
+		items: make(map[uuid.UUID]downlinkCacheItem),
+	}
+}
+
+// set stores the given downlink frame.
+func (c *downlinkCache) set(downlinkFrame gw.DownlinkFrame, now time.Time) {
+	c.setItem(downlinkFrame, 0, nil, now)
+}
+
+// setItem stores the given downlink frame as the given item of the downlink
+// (e.g. 1 for the RX2 retry), together with the errors of the previous
+// (rejected) items.
+func (c *downlinkCache) setItem(downlinkFrame gw.DownlinkFrame, itemIndex uint32, itemErrors []string, now time.Time) {
+	var downID uuid.UUID
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+	if downID == uuid.Nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if now.Sub(c.lastCleanup) >= downlinkCacheCleanupInterval {
+		c.cleanup(now)
+	}
+
+	// the frame is cloned, as the frame passed to the backend might be
+	// modified by the backend (e.g. the bandwidth unit)
+	c.items[downID] = downlinkCacheItem{
+		downlinkFrame: *proto.Clone(&downlinkFrame).(*gw.DownlinkFrame),
+		itemIndex:     itemIndex,
+		itemErrors:    itemErrors,
+		createdAt:     now,
+	}
+}
+
+// cleanup removes the expired items, e.g. for which no ack was received. It
+// must be called with the lock held.
+func (c *downlinkCache) cleanup(now time.Time) {
+	for id, item := range c.items {
+		if now.Sub(item.createdAt) > downlinkCacheDuration {
+			delete(c.items, id)
+		}
+	}
+	c.lastCleanup = now
+}
+
+// pop returns and removes the downlink frame item for the given downlink ID.
+func (c *downlinkCache) pop(downID uuid.UUID) (downlinkCacheItem, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	item, ok := c.items[downID]
+	delete(c.items, downID)
+
+	return item, ok
+}
+
+// enrichDownlinkTXAck returns the downlink TX acknowledgement, extended with
+// the TX meta-data of the given downlink frame. The TX meta-data is only set
+// when the item was transmitted (no error).
+func enrichDownlinkTXAck(txAck gw.DownlinkTXAck, downlinkFrame *gw.DownlinkFrame) (downlinkTXAck, error) {
+	out := downlinkTXAck{
+		GatewayId:  txAck.GetGatewayId(),
+		Token:      txAck.GetToken(),
+		Error:      txAck.GetError(),
+		DownlinkId: txAck.GetDownlinkId(),
+	}
+
+	if downlinkFrame == nil || txAck.GetError() != "" {
+		return out, nil
+	}
+
+	txInfo := downlinkFrame.GetTxInfo()
+	out.Frequency = txInfo.GetFrequency()
+	out.Power = txInfo.GetPower()
+
+	d, err := airtime.DownlinkAirtime(downlinkFrame)
+	if err != nil {
+		return out, errors.Wrap(err, "calculate airtime error")
+	}
+	out.Airtime = ptypes.DurationProto(d)
+
+	return out, nil
+}
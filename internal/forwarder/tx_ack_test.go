@@ -0,0 +1,180 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestEnrichDownlinkTXAck(t *testing.T) {
+	downID, err := uuid.NewV4()
+	require.NoError(t, err)
+
+	loraFrame := gw.DownlinkFrame{
+		PhyPayload: make([]byte, 13),
+		DownlinkId: downID[:],
+		TxInfo: &gw.DownlinkTXInfo{
+			Frequency:  869525000,
+			Power:      27,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:       125,
+					SpreadingFactor: 12,
+					CodeRate:        "4/5",
+				},
+			},
+		},
+	}
+
+	fskFrame := gw.DownlinkFrame{
+		PhyPayload: make([]byte, 13),
+		DownlinkId: downID[:],
+		TxInfo: &gw.DownlinkTXInfo{
+			Frequency:  868800000,
+			Power:      14,
+			Modulation: common.Modulation_FSK,
+			ModulationInfo: &gw.DownlinkTXInfo_FskModulationInfo{
+				FskModulationInfo: &gw.FSKModulationInfo{
+					Datarate: 50000,
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		Name            string
+		TXAck           gw.DownlinkTXAck
+		DownlinkFrame   *gw.DownlinkFrame
+		ExpectedAirtime time.Duration
+		ExpectedFreq    uint32
+		ExpectedPower   int32
+	}{
+		{
+			Name:            "lora",
+			TXAck:           gw.DownlinkTXAck{GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Token: 1234, DownlinkId: downID[:]},
+			DownlinkFrame:   &loraFrame,
+			ExpectedAirtime: 1155072 * time.Microsecond,
+			ExpectedFreq:    869525000,
+			ExpectedPower:   27,
+		},
+		{
+			Name:            "fsk",
+			TXAck:           gw.DownlinkTXAck{GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Token: 1234, DownlinkId: downID[:]},
+			DownlinkFrame:   &fskFrame,
+			ExpectedAirtime: 3840 * time.Microsecond,
+			ExpectedFreq:    868800000,
+			ExpectedPower:   14,
+		},
+		{
+			Name:          "error",
+			TXAck:         gw.DownlinkTXAck{GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Token: 1234, DownlinkId: downID[:], Error: "TOO_LATE"},
+			DownlinkFrame: &loraFrame,
+		},
+		{
+			Name:  "unknown downlink",
+			TXAck: gw.DownlinkTXAck{GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Token: 1234, DownlinkId: downID[:]},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			ack, err := enrichDownlinkTXAck(tst.TXAck, tst.DownlinkFrame)
+			assert.NoError(err)
+
+			assert.Equal(uint32(0), ack.ItemIndex)
+			assert.Equal(tst.ExpectedFreq, ack.Frequency)
+			assert.Equal(tst.ExpectedPower, ack.Power)
+
+			if tst.ExpectedAirtime == 0 {
+				assert.Nil(ack.Airtime)
+			} else {
+				d, err := ptypes.Duration(ack.Airtime)
+				assert.NoError(err)
+				assert.Equal(tst.ExpectedAirtime, d)
+			}
+
+			// the enriched ack must be decodable as gw.DownlinkTXAck
+			b, err := proto.Marshal(&ack)
+			assert.NoError(err)
+
+			var txAck gw.DownlinkTXAck
+			assert.NoError(proto.Unmarshal(b, &txAck))
+			txAck.XXX_unrecognized = nil
+			assert.Equal(tst.TXAck, txAck)
+		})
+	}
+}
+
+func TestDownlinkCache(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	c := newDownlinkCache()
+
+	id1, _ := uuid.NewV4()
+	id2, _ := uuid.NewV4()
+
+	c.set(gw.DownlinkFrame{DownlinkId: id1[:], Token: 1}, now)
+	c.set(gw.DownlinkFrame{DownlinkId: id2[:], Token: 2}, now.Add(2*downlinkCacheDuration))
+
+	// id1 has expired
+	assert.Len(c.items, 1)
+	_, ok := c.pop(id1)
+	assert.False(ok)
+
+	item, ok := c.pop(id2)
+	assert.True(ok)
+	assert.Equal(uint32(2), item.downlinkFrame.Token)
+
+	// pop removes the item
+	_, ok = c.pop(id2)
+	assert.False(ok)
+
+	// the expired items are only removed once per cleanup interval
+	id3, _ := uuid.NewV4()
+	ts := now.Add(3 * downlinkCacheDuration)
+	c.set(gw.DownlinkFrame{DownlinkId: id1[:]}, ts)
+	c.set(gw.DownlinkFrame{DownlinkId: id2[:]}, ts.Add(downlinkCacheDuration-downlinkCacheCleanupInterval/2))
+	c.set(gw.DownlinkFrame{DownlinkId: id3[:]}, ts.Add(downlinkCacheDuration+time.Second))
+	assert.Len(c.items, 3)
+	c.set(gw.DownlinkFrame{DownlinkId: id3[:]}, ts.Add(downlinkCacheDuration+downlinkCacheCleanupInterval))
+	assert.Len(c.items, 2)
+	_, ok = c.pop(id1)
+	assert.False(ok)
+	_, ok = c.pop(id2)
+	assert.True(ok)
+	_, ok = c.pop(id3)
+	assert.True(ok)
+
+	// retried item
+	c.setItem(gw.DownlinkFrame{DownlinkId: id1[:]}, 1, []string{"TX_FREQ"}, now)
+	item, ok = c.pop(id1)
+	assert.True(ok)
+	assert.Equal(uint32(1), item.itemIndex)
+	assert.Equal([]string{"TX_FREQ"}, item.itemErrors)
+
+	// the cached frame is not modified by modifying the stored frame
+	df := gw.DownlinkFrame{
+		DownlinkId: id1[:],
+		TxInfo: &gw.DownlinkTXInfo{
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{Bandwidth: 125},
+			},
+		},
+	}
+	c.set(df, now)
+	df.TxInfo.GetLoraModulationInfo().Bandwidth = 125000
+	item, ok = c.pop(id1)
+	assert.True(ok)
+	assert.EqualValues(125, item.downlinkFrame.GetTxInfo().GetLoraModulationInfo().GetBandwidth())
+}
@@ -0,0 +1,215 @@
+// Package health implements the health (liveness) and ready (readiness)
+// endpoints. The backends and integrations report their state to this
+// package, which is then exposed as JSON.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// MirrorPrefix defines the name prefix of the mirror integrations. The
+// state of the mirror integrations is reported, but does not affect the
+// readiness of the bridge.
+const MirrorPrefix = "mirror/"
+
+var (
+	mu               sync.RWMutex
+	backendTimeout   time.Duration
+	lastBackendEvent time.Time
+	integrations     = make(map[string]*integrationState)
+)
+
+type integrationState struct {
+	connected   bool
+	connects    uint64
+	lastPublish time.Time
+}
+
+// Status contains the status of the subsystems.
+type Status struct {
+	Ready        bool                         `json:"ready"`
+	Backend      BackendStatus                `json:"backend"`
+	Integrations map[string]IntegrationStatus `json:"integrations"`
+}
+
+// BackendStatus contains the packet-forwarder connectivity status.
+type BackendStatus struct {
+	Ready     bool       `json:"ready"`
+	LastEvent *time.Time `json:"last_event,omitempty"`
+}
+
+// IntegrationStatus contains the status of a single integration.
+type IntegrationStatus struct {
+	Ready       bool       `json:"ready"`
+	Connected   bool       `json:"connected"`
+	Reconnects  uint64     `json:"reconnects"`
+	LastPublish *time.Time `json:"last_publish,omitempty"`
+}
+
+// Setup configures the health package.
+func Setup(conf config.Config) error {
+	mu.Lock()
+	backendTimeout = conf.Health.BackendTimeout
+	mu.Unlock()
+
+	if !conf.Health.EndpointEnabled {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"bind": conf.Health.Bind,
+	}).Info("health: starting health server")
+
+	server := http.Server{
+		Handler: Handler(),
+		Addr:    conf.Health.Bind,
+	}
+
+	go func() {
+		err := server.ListenAndServe()
+		log.WithError(err).Error("health: health server error")
+	}()
+
+	return nil
+}
+
+// Handler returns the HTTP handler exposing the /health and /ready
+// endpoints.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, GetStatus(time.Now()), http.StatusOK)
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		status := GetStatus(time.Now())
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeStatus(w, status, code)
+	})
+	return mux
+}
+
+// BackendEvent must be called by the backends on each event received from
+// the packet-forwarder (e.g. PULL_DATA or a Concentratord event).
+func BackendEvent() {
+	mu.Lock()
+	lastBackendEvent = time.Now()
+	mu.Unlock()
+}
+
+// SetIntegrationConnected sets the connection state of the given
+// integration. Once registered, the integration must be connected for the
+// bridge to be ready.
+func SetIntegrationConnected(name string, connected bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	state := getIntegrationState(name)
+	if connected && !state.connected {
+		state.connects++
+	}
+	state.connected = connected
+}
+
+// Reconnects returns the total number of re-connects of the integrations,
+// excluding the mirror integrations.
+func Reconnects() uint64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var out uint64
+	for name, state := range integrations {
+		if !strings.HasPrefix(name, MirrorPrefix) {
+			out += state.reconnects()
+		}
+	}
+	return out
+}
+
+// IntegrationPublished must be called by the integrations after each
+// successful publish.
+func IntegrationPublished(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	getIntegrationState(name).lastPublish = time.Now()
+}
+
+// GetStatus returns the status of the subsystems at the given time.
+func GetStatus(now time.Time) Status {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	status := Status{
+		Ready:        true,
+		Integrations: make(map[string]IntegrationStatus),
+	}
+
+	// The backend can only be considered not ready when a timeout has been
+	// configured, as a bridge without any gateway is a valid state.
+	status.Backend.Ready = backendTimeout == 0 || now.Sub(lastBackendEvent) < backendTimeout
+	if !lastBackendEvent.IsZero() {
+		t := lastBackendEvent
+		status.Backend.LastEvent = &t
+	}
+	status.Ready = status.Backend.Ready
+
+	for name, state := range integrations {
+		is := IntegrationStatus{
+			Ready:      state.connected,
+			Connected:  state.connected,
+			Reconnects: state.reconnects(),
+		}
+		if !state.lastPublish.IsZero() {
+			t := state.lastPublish
+			is.LastPublish = &t
+		}
+
+		status.Integrations[name] = is
+		if !strings.HasPrefix(name, MirrorPrefix) {
+			status.Ready = status.Ready && is.Ready
+		}
+	}
+
+	return status
+}
+
+// reconnects returns the number of connects following the initial connect.
+func (s *integrationState) reconnects() uint64 {
+	if s.connects == 0 {
+		return 0
+	}
+	return s.connects - 1
+}
+
+func getIntegrationState(name string) *integrationState {
+	state, ok := integrations[name]
+	if !ok {
+		state = &integrationState{}
+		integrations[name] = state
+	}
+	return state
+}
+
+func writeStatus(w http.ResponseWriter, status Status, code int) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		log.WithError(err).Error("health: marshal status error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
@@ -0,0 +1,109 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestHealth(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Health.BackendTimeout = time.Minute
+	assert.NoError(Setup(conf))
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	get := func(path string) (int, Status) {
+		resp, err := http.Get(server.URL + path)
+		assert.NoError(err)
+		defer resp.Body.Close()
+
+		var status Status
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&status))
+		return resp.StatusCode, status
+	}
+
+	t.Run("no backend event", func(t *testing.T) {
+		assert := require.New(t)
+
+		code, status := get("/health")
+		assert.Equal(http.StatusOK, code)
+		assert.False(status.Ready)
+		assert.Nil(status.Backend.LastEvent)
+
+		code, _ = get("/ready")
+		assert.Equal(http.StatusServiceUnavailable, code)
+	})
+
+	t.Run("integration not connected", func(t *testing.T) {
+		assert := require.New(t)
+
+		BackendEvent()
+		SetIntegrationConnected("mqtt", false)
+
+		code, status := get("/ready")
+		assert.Equal(http.StatusServiceUnavailable, code)
+		assert.True(status.Backend.Ready)
+		assert.NotNil(status.Backend.LastEvent)
+		assert.Equal(IntegrationStatus{}, status.Integrations["mqtt"])
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		assert := require.New(t)
+
+		SetIntegrationConnected("mqtt", true)
+		IntegrationPublished("mqtt")
+
+		code, status := get("/ready")
+		assert.Equal(http.StatusOK, code)
+		assert.True(status.Ready)
+		assert.True(status.Integrations["mqtt"].Connected)
+		assert.NotNil(status.Integrations["mqtt"].LastPublish)
+	})
+
+	t.Run("mirror integration not connected", func(t *testing.T) {
+		assert := require.New(t)
+
+		SetIntegrationConnected(MirrorPrefix+"mqtt", false)
+
+		code, status := get("/ready")
+		assert.Equal(http.StatusOK, code)
+		assert.True(status.Ready)
+		assert.False(status.Integrations[MirrorPrefix+"mqtt"].Ready)
+	})
+
+	t.Run("reconnects", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.EqualValues(0, Reconnects())
+
+		SetIntegrationConnected("mqtt", false)
+		SetIntegrationConnected("mqtt", true)
+		SetIntegrationConnected(MirrorPrefix+"mqtt", true)
+		SetIntegrationConnected(MirrorPrefix+"mqtt", false)
+		SetIntegrationConnected(MirrorPrefix+"mqtt", true)
+
+		status := GetStatus(time.Now())
+		assert.EqualValues(1, status.Integrations["mqtt"].Reconnects)
+		assert.EqualValues(1, status.Integrations[MirrorPrefix+"mqtt"].Reconnects)
+		assert.EqualValues(1, Reconnects())
+	})
+
+	t.Run("backend timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		status := GetStatus(time.Now().Add(2 * time.Minute))
+		assert.False(status.Ready)
+		assert.False(status.Backend.Ready)
+		assert.True(status.Integrations["mqtt"].Ready)
+	})
+}
@@ -0,0 +1,630 @@
+// Package amqp implements an AMQP 0.9.1 (e.g. RabbitMQ) integration.
+package amqp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// Backend implements an AMQP backend.
+type Backend struct {
+	sync.RWMutex
+
+	// pubMux serializes the publishing, so that the publisher confirms can
+	// be matched against the published events.
+	pubMux sync.Mutex
+
+	conn        *amqp.Connection
+	pubChan     *amqp.Channel
+	subChan     *amqp.Channel
+	confirms    chan amqp.Confirmation
+	deliveryTag uint64
+	closed      bool
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+	gateways                      map[lorawan.EUI64]string
+
+	// healthName contains the name under which the connection state is
+	// reported to the health package.
+	healthName string
+
+	url               string
+	tlsConfig         *tls.Config
+	exchange          string
+	publisherConfirms bool
+	confirmTimeout    time.Duration
+	reconnectInterval time.Duration
+
+	commandsEnabled           bool
+	eventRoutingKeyTemplate   *template.Template
+	commandQueueTemplate      *template.Template
+	commandRoutingKeyTemplate *template.Template
+
+	// marshalers contains the per event-type marshalers, marshal and
+	// unmarshal are the functions of the default marshaler.
+	marshalers marshaler.Set
+	marshal    func(msg proto.Message) ([]byte, error)
+	unmarshal  func(b []byte, msg proto.Message) error
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	var err error
+	amqpConf := conf.Integration.AMQP
+
+	b := Backend{
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[lorawan.EUI64]string),
+
+		url:               amqpConf.URL,
+		exchange:          amqpConf.Exchange,
+		publisherConfirms: amqpConf.PublisherConfirms,
+		confirmTimeout:    amqpConf.ConfirmTimeout,
+		reconnectInterval: amqpConf.ReconnectInterval,
+		commandsEnabled:   amqpConf.CommandsEnabled,
+	}
+
+	b.healthName = "amqp"
+	if conf.Integration.IsMirror {
+		b.healthName = health.MirrorPrefix + "amqp"
+	}
+
+	if b.reconnectInterval == 0 {
+		b.reconnectInterval = 2 * time.Second
+	}
+
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/amqp: %s", err)
+	}
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	b.eventRoutingKeyTemplate, err = template.New("event").Parse(amqpConf.EventRoutingKeyTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/amqp: parse event routing-key template error")
+	}
+
+	b.commandQueueTemplate, err = template.New("queue").Parse(amqpConf.CommandQueueTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/amqp: parse command queue template error")
+	}
+
+	b.commandRoutingKeyTemplate, err = template.New("command").Parse(amqpConf.CommandRoutingKeyTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/amqp: parse command routing-key template error")
+	}
+
+	b.tlsConfig, err = newTLSConfig(amqpConf.CACert, amqpConf.TLSCert, amqpConf.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/amqp: new tls config error")
+	}
+
+	health.SetIntegrationConnected(b.healthName, false)
+	b.connectLoop()
+
+	return &b, nil
+}
+
+// newTLSConfig returns the TLS configuration for the given certificate
+// files, or nil when none are set. Note that TLS is only used for amqps://
+// URLs.
+func newTLSConfig(caCert, tlsCert, tlsKey string) (*tls.Config, error) {
+	if caCert == "" && tlsCert == "" && tlsKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if caCert != "" {
+		rawCACert, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, errors.Wrap(err, "load ca certificate error")
+		}
+
+		certpool := x509.NewCertPool()
+		if !certpool.AppendCertsFromPEM(rawCACert) {
+			return nil, errors.New("append ca certificate error")
+		}
+		tlsConfig.RootCAs = certpool
+	}
+
+	if tlsCert != "" && tlsKey != "" {
+		kp, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls key-pair error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{kp}
+	}
+
+	return tlsConfig, nil
+}
+
+// connectLoop blocks until connected to the AMQP server (or until the
+// backend has been closed).
+func (b *Backend) connectLoop() {
+	for {
+		b.RLock()
+		closed := b.closed
+		b.RUnlock()
+		if closed {
+			return
+		}
+
+		if err := b.connect(); err != nil {
+			log.WithError(err).Error("integration/amqp: connection error")
+			time.Sleep(b.reconnectInterval)
+			continue
+		}
+
+		return
+	}
+}
+
+// connect connects to the AMQP server and opens the publish and subscribe
+// channels.
+func (b *Backend) connect() error {
+	log.Info("integration/amqp: connecting to amqp server")
+
+	conn, err := amqp.DialConfig(b.url, amqp.Config{
+		TLSClientConfig: b.tlsConfig,
+		Properties: amqp.Table{
+			"connection_name": "chirpstack-gateway-bridge",
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "dial error")
+	}
+
+	pubChan, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "open publish channel error")
+	}
+
+	var confirms chan amqp.Confirmation
+	if b.publisherConfirms {
+		if err := pubChan.Confirm(false); err != nil {
+			conn.Close()
+			return errors.Wrap(err, "enable publisher confirms error")
+		}
+		confirms = pubChan.NotifyPublish(make(chan amqp.Confirmation, 1))
+	}
+
+	subChan, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "open subscribe channel error")
+	}
+
+	b.pubMux.Lock()
+	b.Lock()
+	b.conn = conn
+	b.pubChan = pubChan
+	b.subChan = subChan
+	b.confirms = confirms
+	b.deliveryTag = 0
+	b.Unlock()
+	b.pubMux.Unlock()
+
+	amqpConnectCounter().Inc()
+	health.SetIntegrationConnected(b.healthName, true)
+	log.Info("integration/amqp: connected to amqp server")
+
+	go b.watchConnection(conn.NotifyClose(make(chan *amqp.Error, 1)))
+
+	return nil
+}
+
+// watchConnection reconnects and restores the gateway subscriptions once
+// the connection has been closed by an error.
+func (b *Backend) watchConnection(closeChan chan *amqp.Error) {
+	amqpErr := <-closeChan
+
+	// The channel is closed without error on a graceful close.
+	if amqpErr == nil {
+		return
+	}
+
+	amqpDisconnectCounter().Inc()
+	health.SetIntegrationConnected(b.healthName, false)
+	log.WithError(amqpErr).Error("integration/amqp: connection to amqp server lost")
+
+	time.Sleep(b.reconnectInterval)
+	b.connectLoop()
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	for gatewayID := range b.gateways {
+		if err := b.subscribeGateway(gatewayID); err != nil {
+			log.WithError(err).WithField("gateway_id", gatewayID).Error("integration/amqp: restore gateway subscription error")
+		}
+	}
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	log.Info("integration/amqp: closing backend")
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
+	health.SetIntegrationConnected(b.healthName, false)
+
+	if b.conn == nil {
+		return nil
+	}
+
+	if err := b.conn.Close(); err != nil {
+		return errors.Wrap(err, "close connection error")
+	}
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway to its command
+// queue. The subscriptions are restored after a reconnect.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/amqp: set gateway subscription called")
+
+	if !b.commandsEnabled {
+		return nil
+	}
+
+	queue, ok := b.gateways[gatewayID]
+	if ok == subscribe {
+		return nil
+	}
+
+	if !subscribe {
+		log.WithFields(log.Fields{
+			"queue": queue,
+		}).Info("integration/amqp: cancelling queue consumer")
+
+		delete(b.gateways, gatewayID)
+
+		// As the queue is declared as auto-delete, it is deleted by the
+		// server once the consumer has been cancelled.
+		if err := b.subChan.Cancel(queue, false); err != nil {
+			return errors.Wrap(err, "cancel consumer error")
+		}
+		return nil
+	}
+
+	return b.subscribeGateway(gatewayID)
+}
+
+// subscribeGateway declares and binds the command queue of the given
+// gateway and starts consuming it. The caller must hold the lock.
+func (b *Backend) subscribeGateway(gatewayID lorawan.EUI64) error {
+	data := struct{ GatewayID lorawan.EUI64 }{gatewayID}
+
+	queue := bytes.NewBuffer(nil)
+	if err := b.commandQueueTemplate.Execute(queue, data); err != nil {
+		return errors.Wrap(err, "execute command queue template error")
+	}
+
+	routingKey := bytes.NewBuffer(nil)
+	if err := b.commandRoutingKeyTemplate.Execute(routingKey, data); err != nil {
+		return errors.Wrap(err, "execute command routing-key template error")
+	}
+
+	log.WithFields(log.Fields{
+		"queue":       queue.String(),
+		"exchange":    b.exchange,
+		"routing_key": routingKey.String(),
+	}).Info("integration/amqp: consuming command queue")
+
+	if _, err := b.subChan.QueueDeclare(queue.String(), false, true, false, false, nil); err != nil {
+		return errors.Wrap(err, "declare queue error")
+	}
+
+	if err := b.subChan.QueueBind(queue.String(), routingKey.String(), b.exchange, false, nil); err != nil {
+		return errors.Wrap(err, "bind queue error")
+	}
+
+	// The queue name is used as consumer tag.
+	deliveries, err := b.subChan.Consume(queue.String(), queue.String(), false, false, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "consume queue error")
+	}
+	b.gateways[gatewayID] = queue.String()
+
+	go func() {
+		for d := range deliveries {
+			b.handleCommand(d)
+		}
+	}()
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	amqpEventCounter(event).Inc()
+	idPrefix := map[string]string{
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
+	}
+	return b.publish(gatewayID, event, log.Fields{
+		idPrefix[event] + "id": id,
+	}, v)
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, fields log.Fields, msg proto.Message) error {
+	m := b.marshalers.Event(event)
+
+	routingKey := bytes.NewBuffer(nil)
+	if err := b.eventRoutingKeyTemplate.Execute(routingKey, struct {
+		GatewayID lorawan.EUI64
+		EventType string
+		Marshaler string
+	}{gatewayID, event, m.Name}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+
+	bytes, err := m.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	fields["exchange"] = b.exchange
+	fields["routing_key"] = routingKey.String()
+	fields["event"] = event
+
+	log.WithFields(fields).Info("integration/amqp: publishing event")
+
+	b.pubMux.Lock()
+	defer b.pubMux.Unlock()
+
+	b.RLock()
+	pubChan := b.pubChan
+	confirms := b.confirms
+	b.RUnlock()
+
+	if pubChan == nil {
+		return errors.New("not connected")
+	}
+
+	if err := pubChan.Publish(b.exchange, routingKey.String(), false, false, amqp.Publishing{
+		ContentType:  contentType(m.Name),
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		Body:         bytes,
+	}); err != nil {
+		return errors.Wrap(err, "publish error")
+	}
+
+	if confirms != nil {
+		b.deliveryTag++
+		if err := b.waitForConfirm(confirms, b.deliveryTag); err != nil {
+			return err
+		}
+	}
+
+	health.IntegrationPublished(b.healthName)
+
+	return nil
+}
+
+// waitForConfirm waits for the publisher confirm of the given delivery tag.
+// Confirms of previous (timed out) publishes are skipped.
+func (b *Backend) waitForConfirm(confirms chan amqp.Confirmation, deliveryTag uint64) error {
+	timeout := time.After(b.confirmTimeout)
+
+	for {
+		select {
+		case c, ok := <-confirms:
+			if !ok {
+				return errors.New("channel closed before publisher confirm")
+			}
+
+			if c.DeliveryTag < deliveryTag {
+				continue
+			}
+
+			if !c.Ack {
+				amqpNackCounter().Inc()
+				return errors.New("publish not acknowledged by server")
+			}
+
+			return nil
+		case <-timeout:
+			amqpNackCounter().Inc()
+			return errors.New("publisher confirm timeout")
+		}
+	}
+}
+
+func (b *Backend) handleCommand(d amqp.Delivery) {
+	var err error
+
+	// The last token of the routing key contains the command type.
+	command := d.RoutingKey[strings.LastIndex(d.RoutingKey, ".")+1:]
+
+	switch command {
+	case "down":
+		amqpCommandCounter("down").Inc()
+		err = b.handleDownlinkFrame(d.Body)
+	case "config":
+		amqpCommandCounter("config").Inc()
+		err = b.handleGatewayConfiguration(d.Body)
+	case "exec":
+		amqpCommandCounter("exec").Inc()
+		err = b.handleGatewayCommandExecRequest(d.Body)
+	case "raw":
+		amqpCommandCounter("raw").Inc()
+		err = b.handleRawPacketForwarderCommand(d.Body)
+	default:
+		log.WithFields(log.Fields{
+			"routing_key": d.RoutingKey,
+		}).Warning("integration/amqp: unexpected command received")
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"routing_key": d.RoutingKey,
+		}).WithError(err).Error("integration/amqp: handle command error")
+	}
+
+	// Invalid commands are acknowledged too, as these would otherwise be
+	// redelivered over and over.
+	if err := d.Ack(false); err != nil {
+		log.WithError(err).Error("integration/amqp: acknowledge command error")
+	}
+}
+
+func (b *Backend) handleDownlinkFrame(data []byte) error {
+	var downlinkFrame gw.DownlinkFrame
+	if err := b.unmarshal(data, &downlinkFrame); err != nil {
+		return errors.Wrap(err, "unmarshal downlink frame error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var downID uuid.UUID
+	copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+	}).Info("integration/amqp: downlink frame received")
+
+	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
+}
+
+func (b *Backend) handleGatewayConfiguration(data []byte) error {
+	var gatewayConfig gw.GatewayConfiguration
+	if err := b.unmarshal(data, &gatewayConfig); err != nil {
+		return errors.Wrap(err, "unmarshal gateway configuration error")
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], gatewayConfig.GetGatewayId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+	}).Info("integration/amqp: gateway configuration received")
+
+	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
+}
+
+func (b *Backend) handleGatewayCommandExecRequest(data []byte) error {
+	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
+	if err := b.unmarshal(data, &gatewayCommandExecRequest); err != nil {
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var execID uuid.UUID
+	copy(gatewayID[:], gatewayCommandExecRequest.GetGatewayId())
+	copy(execID[:], gatewayCommandExecRequest.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/amqp: gateway command execution request received")
+
+	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(data []byte) error {
+	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
+	if err := b.unmarshal(data, &rawPacketForwarderCommand); err != nil {
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var rawID uuid.UUID
+	copy(gatewayID[:], rawPacketForwarderCommand.GetGatewayId())
+	copy(rawID[:], rawPacketForwarderCommand.GetRawId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"raw_id":     rawID,
+	}).Info("integration/amqp: raw packet-forwarder command received")
+
+	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
+
+// contentType returns the content-type for the given marshaler.
+func contentType(marshalerName string) string {
+	switch marshalerName {
+	case marshaler.Protobuf:
+		return "application/octet-stream"
+	case marshaler.CBOR:
+		return "application/cbor"
+	default:
+		return "application/json"
+	}
+}
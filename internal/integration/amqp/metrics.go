@@ -0,0 +1,53 @@
+package amqp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_amqp_event_count",
+		Help: "The number of gateway events published by the AMQP integration (per event).",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_amqp_command_count",
+		Help: "The number of commands received by the AMQP integration (per command).",
+	}, []string{"command"})
+
+	amqpc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_amqp_connect_count",
+		Help: "The number of times the integration connected to the AMQP server.",
+	})
+
+	amqpd = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_amqp_disconnect_count",
+		Help: "The number of times the integration disconnected from the AMQP server.",
+	})
+
+	amqpn = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_amqp_publish_nack_count",
+		Help: "The number of events that were not confirmed by the AMQP server (nack or timeout).",
+	})
+)
+
+func amqpEventCounter(e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": e})
+}
+
+func amqpCommandCounter(c string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": c})
+}
+
+func amqpConnectCounter() prometheus.Counter {
+	return amqpc
+}
+
+func amqpDisconnectCounter() prometheus.Counter {
+	return amqpd
+}
+
+func amqpNackCounter() prometheus.Counter {
+	return amqpn
+}
@@ -0,0 +1,588 @@
+// Package awssqs implements an AWS SQS / SNS integration.
+//
+// Events are published to an SNS topic or an SQS queue and commands are
+// consumed from an SQS queue (using long polling). The gateway ID, the event
+// or command type and the marshaler are stored as message attributes. As SNS
+// and SQS only support text message bodies, the payloads of the binary
+// marshalers (protobuf and cbor) are base64 encoded.
+package awssqs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/awsauth"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// Message attributes.
+const (
+	attrGatewayID = "gateway_id"
+	attrEvent     = "event"
+	attrCommand   = "command"
+	attrMarshaler = "marshaler"
+)
+
+// API versions of the SNS and SQS Query APIs.
+const (
+	snsAPIVersion = "2010-03-31"
+	sqsAPIVersion = "2012-11-05"
+)
+
+const (
+	receiveMaxMessages   = 10
+	receiveRetryInterval = 2 * time.Second
+
+	// credentialsRefreshMargin defines the margin before the expiration of
+	// the credentials at which these are refreshed.
+	credentialsRefreshMargin = 5 * time.Minute
+)
+
+// Backend implements an AWS SQS / SNS backend.
+type Backend struct {
+	sync.RWMutex
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	receiveDone chan struct{}
+
+	client        *http.Client
+	receiveClient *http.Client
+
+	credentialsMux      sync.Mutex
+	credentialsProvider awsauth.CredentialsProvider
+	credentials         awsauth.Credentials
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+
+	gateways map[lorawan.EUI64]struct{}
+
+	region          string
+	snsEndpoint     string
+	eventTopicARN   string
+	eventQueueURL   string
+	commandQueueURL string
+	waitTime        time.Duration
+
+	// marshalers contains the per event-type marshalers, unmarshal is the
+	// unmarshal function of the default marshaler.
+	marshalers marshaler.Set
+	unmarshal  func(b []byte, msg proto.Message) error
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	sqsConf := conf.Integration.AWSSQS
+
+	b := Backend{
+		client: &http.Client{
+			Timeout: sqsConf.Timeout,
+		},
+		receiveClient: &http.Client{
+			Timeout: sqsConf.WaitTime + sqsConf.Timeout,
+		},
+		receiveDone: make(chan struct{}),
+
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[lorawan.EUI64]struct{}),
+
+		region:          sqsConf.Region,
+		snsEndpoint:     strings.TrimRight(sqsConf.SNSEndpoint, "/"),
+		eventTopicARN:   sqsConf.EventTopicARN,
+		eventQueueURL:   sqsConf.EventQueueURL,
+		commandQueueURL: sqsConf.CommandQueueURL,
+		waitTime:        sqsConf.WaitTime,
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	if b.snsEndpoint == "" {
+		b.snsEndpoint = fmt.Sprintf("https://sns.%s.amazonaws.com", b.region)
+	}
+
+	var err error
+	b.credentialsProvider, err = awsauth.NewCredentialsProvider(sqsConf.CredentialSource, awsauth.Credentials{
+		AccessKeyID:     sqsConf.AccessKeyID,
+		SecretAccessKey: sqsConf.SecretAccessKey,
+		SessionToken:    sqsConf.SessionToken,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/awssqs: new credentials provider error")
+	}
+
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/awssqs: %s", err)
+	}
+	b.unmarshal = func(body []byte, msg proto.Message) error {
+		body, err := decodeBody(b.marshalers.Default.Name, body)
+		if err != nil {
+			return err
+		}
+		return b.marshalers.Default.Unmarshal(body, msg)
+	}
+
+	if sqsConf.CommandsEnabled {
+		log.WithFields(log.Fields{
+			"queue_url": b.commandQueueURL,
+		}).Info("integration/awssqs: starting command receiver")
+
+		go b.receiveLoop()
+	} else {
+		close(b.receiveDone)
+	}
+
+	return &b, nil
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	log.Info("integration/awssqs: closing backend")
+
+	b.cancel()
+	<-b.receiveDone
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway. Commands are only
+// accepted for the subscribed gateways.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/awssqs: set gateway subscription called")
+
+	if subscribe {
+		b.gateways[gatewayID] = struct{}{}
+	} else {
+		delete(b.gateways, gatewayID)
+	}
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	sqsEventCounter(event).Inc()
+	idPrefix := map[string]string{
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id":           gatewayID,
+		"event":                event,
+		"topic_arn":            b.eventTopicARN,
+		"queue_url":            b.eventQueueURL,
+		idPrefix[event] + "id": id,
+	}).Info("integration/awssqs: publishing event")
+
+	if err := b.publish(gatewayID, event, v); err != nil {
+		sqsEventErrorCounter(event).Inc()
+		return err
+	}
+
+	return nil
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, msg proto.Message) error {
+	m := b.marshalers.Event(event)
+
+	data, err := m.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	attributes := [][2]string{
+		{attrGatewayID, gatewayID.String()},
+		{attrEvent, event},
+		{attrMarshaler, m.Name},
+	}
+
+	// SNS and SQS use a different prefix for the message attributes.
+	params := url.Values{}
+	var endpoint, service, prefix string
+	if b.eventTopicARN != "" {
+		endpoint, service, prefix = b.snsEndpoint, "sns", "MessageAttributes.entry"
+		params.Set("Action", "Publish")
+		params.Set("Version", snsAPIVersion)
+		params.Set("TopicArn", b.eventTopicARN)
+		params.Set("Message", encodeBody(m.Name, data))
+	} else {
+		endpoint, service, prefix = b.eventQueueURL, "sqs", "MessageAttribute"
+		params.Set("Action", "SendMessage")
+		params.Set("Version", sqsAPIVersion)
+		params.Set("MessageBody", encodeBody(m.Name, data))
+	}
+
+	for i, attr := range attributes {
+		p := fmt.Sprintf("%s.%d.", prefix, i+1)
+		params.Set(p+"Name", attr[0])
+		params.Set(p+"Value.DataType", "String")
+		params.Set(p+"Value.StringValue", attr[1])
+	}
+
+	if err := b.call(b.ctx, b.client, endpoint, service, params, nil); err != nil {
+		return errors.Wrap(err, "publish error")
+	}
+
+	return nil
+}
+
+// receiveLoop receives the commands from the command queue until the
+// backend is closed.
+func (b *Backend) receiveLoop() {
+	defer close(b.receiveDone)
+
+	for {
+		msgs, err := b.receive()
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.WithError(err).Error("integration/awssqs: receive commands error")
+
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(receiveRetryInterval):
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			b.handleCommand(msg)
+
+			params := url.Values{}
+			params.Set("Action", "DeleteMessage")
+			params.Set("Version", sqsAPIVersion)
+			params.Set("ReceiptHandle", msg.ReceiptHandle)
+			if err := b.call(b.ctx, b.client, b.commandQueueURL, "sqs", params, nil); err != nil {
+				log.WithError(err).WithField("message_id", msg.MessageID).Error("integration/awssqs: delete command error")
+			}
+		}
+	}
+}
+
+// receive returns the received messages, using long polling.
+func (b *Backend) receive() ([]sqsMessage, error) {
+	params := url.Values{}
+	params.Set("Action", "ReceiveMessage")
+	params.Set("Version", sqsAPIVersion)
+	params.Set("MaxNumberOfMessages", fmt.Sprintf("%d", receiveMaxMessages))
+	params.Set("WaitTimeSeconds", fmt.Sprintf("%d", int(b.waitTime/time.Second)))
+	params.Set("MessageAttributeName.1", "All")
+
+	var resp receiveMessageResponse
+	if err := b.call(b.ctx, b.receiveClient, b.commandQueueURL, "sqs", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Messages, nil
+}
+
+// call performs a SNS or SQS Query API call. The response is unmarshaled
+// into resp when not nil.
+func (b *Backend) call(ctx context.Context, client *http.Client, endpoint, service string, params url.Values, resp interface{}) error {
+	creds, err := b.getCredentials()
+	if err != nil {
+		return errors.Wrap(err, "get credentials error")
+	}
+
+	body := []byte(params.Encode())
+
+	r, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	awsauth.SignRequest(r, body, service, b.region, creds, time.Now())
+
+	httpResp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response error")
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected 200 response, got: %d (%s)", httpResp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if resp != nil {
+		if err := xml.Unmarshal(respBody, resp); err != nil {
+			return errors.Wrap(err, "unmarshal response error")
+		}
+	}
+
+	return nil
+}
+
+// getCredentials returns the AWS credentials. Expiring credentials (e.g.
+// of an IAM role) are refreshed before these expire.
+func (b *Backend) getCredentials() (awsauth.Credentials, error) {
+	b.credentialsMux.Lock()
+	defer b.credentialsMux.Unlock()
+
+	if b.credentials.AccessKeyID != "" && (b.credentials.Expiration.IsZero() || time.Now().Add(credentialsRefreshMargin).Before(b.credentials.Expiration)) {
+		return b.credentials, nil
+	}
+
+	creds, err := b.credentialsProvider()
+	if err != nil {
+		return creds, err
+	}
+	b.credentials = creds
+
+	return creds, nil
+}
+
+// handleCommand handles the received command. The command type is read from
+// the command attribute. Commands for unknown gateways are discarded.
+func (b *Backend) handleCommand(msg sqsMessage) {
+	attributes := msg.attributes()
+	command := attributes[attrCommand]
+
+	var gatewayID lorawan.EUI64
+	if err := gatewayID.UnmarshalText([]byte(attributes[attrGatewayID])); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"message_id": msg.MessageID,
+		}).Warning("integration/awssqs: command received with invalid gateway id")
+		return
+	}
+
+	b.RLock()
+	_, ok := b.gateways[gatewayID]
+	b.RUnlock()
+	if !ok {
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"message_id": msg.MessageID,
+		}).Warning("integration/awssqs: command received for unknown gateway")
+		return
+	}
+
+	body := []byte(msg.Body)
+
+	var err error
+	switch command {
+	case "down":
+		sqsCommandCounter("down").Inc()
+		err = b.handleDownlinkFrame(body)
+	case "config":
+		sqsCommandCounter("config").Inc()
+		err = b.handleGatewayConfiguration(body)
+	case "exec":
+		sqsCommandCounter("exec").Inc()
+		err = b.handleGatewayCommandExecRequest(body)
+	case "raw":
+		sqsCommandCounter("raw").Inc()
+		err = b.handleRawPacketForwarderCommand(body)
+	default:
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"command":    command,
+			"message_id": msg.MessageID,
+		}).Warning("integration/awssqs: unexpected command received")
+		return
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"command":    command,
+			"message_id": msg.MessageID,
+		}).WithError(err).Error("integration/awssqs: handle command error")
+	}
+}
+
+func (b *Backend) handleDownlinkFrame(body []byte) error {
+	var downlinkFrame gw.DownlinkFrame
+	if err := b.unmarshal(body, &downlinkFrame); err != nil {
+		return errors.Wrap(err, "unmarshal downlink frame error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var downID uuid.UUID
+	copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+	}).Info("integration/awssqs: downlink frame received")
+
+	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
+}
+
+func (b *Backend) handleGatewayConfiguration(body []byte) error {
+	var gatewayConfig gw.GatewayConfiguration
+	if err := b.unmarshal(body, &gatewayConfig); err != nil {
+		return errors.Wrap(err, "unmarshal gateway configuration error")
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], gatewayConfig.GetGatewayId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+	}).Info("integration/awssqs: gateway configuration received")
+
+	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
+}
+
+func (b *Backend) handleGatewayCommandExecRequest(body []byte) error {
+	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
+	if err := b.unmarshal(body, &gatewayCommandExecRequest); err != nil {
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var execID uuid.UUID
+	copy(gatewayID[:], gatewayCommandExecRequest.GetGatewayId())
+	copy(execID[:], gatewayCommandExecRequest.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/awssqs: gateway command execution request received")
+
+	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(body []byte) error {
+	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
+	if err := b.unmarshal(body, &rawPacketForwarderCommand); err != nil {
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var rawID uuid.UUID
+	copy(gatewayID[:], rawPacketForwarderCommand.GetGatewayId())
+	copy(rawID[:], rawPacketForwarderCommand.GetRawId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"raw_id":     rawID,
+	}).Info("integration/awssqs: raw packet-forwarder command received")
+
+	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
+
+// binaryMarshaler returns true when the given marshaler does not produce
+// text.
+func binaryMarshaler(name string) bool {
+	return name == marshaler.Protobuf || name == marshaler.CBOR
+}
+
+// encodeBody returns the message body for the given payload.
+func encodeBody(marshalerName string, b []byte) string {
+	if binaryMarshaler(marshalerName) {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return string(b)
+}
+
+// decodeBody returns the payload of the given message body.
+func decodeBody(marshalerName string, b []byte) ([]byte, error) {
+	if !binaryMarshaler(marshalerName) {
+		return b, nil
+	}
+
+	out, err := base64.StdEncoding.DecodeString(string(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decode error")
+	}
+	return out, nil
+}
+
+// SQS Query API messages.
+type receiveMessageResponse struct {
+	Messages []sqsMessage `xml:"ReceiveMessageResult>Message"`
+}
+
+type sqsMessage struct {
+	MessageID         string             `xml:"MessageId"`
+	ReceiptHandle     string             `xml:"ReceiptHandle"`
+	Body              string             `xml:"Body"`
+	MessageAttributes []messageAttribute `xml:"MessageAttribute"`
+}
+
+type messageAttribute struct {
+	Name        string `xml:"Name"`
+	StringValue string `xml:"Value>StringValue"`
+}
+
+// attributes returns the message attributes as map.
+func (m sqsMessage) attributes() map[string]string {
+	out := make(map[string]string)
+	for _, attr := range m.MessageAttributes {
+		out[attr.Name] = attr.StringValue
+	}
+	return out
+}
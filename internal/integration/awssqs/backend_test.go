@@ -0,0 +1,233 @@
+package awssqs
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type request struct {
+	path          string
+	authorization string
+	form          url.Values
+}
+
+type AWSSQSBackendTestSuite struct {
+	suite.Suite
+
+	server       *httptest.Server
+	requests     chan request
+	receiveQueue chan sqsMessage
+	backend      *Backend
+	gatewayID    lorawan.EUI64
+}
+
+func (ts *AWSSQSBackendTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	log.SetLevel(log.ErrorLevel)
+
+	ts.requests = make(chan request, 10)
+	ts.receiveQueue = make(chan sqsMessage, 10)
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+
+		if form.Get("Action") == "ReceiveMessage" {
+			var resp receiveMessageResponse
+			select {
+			case msg := <-ts.receiveQueue:
+				resp.Messages = append(resp.Messages, msg)
+			case <-time.After(10 * time.Millisecond):
+			}
+			xml.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		ts.requests <- request{
+			path:          r.URL.Path,
+			authorization: r.Header.Get("Authorization"),
+			form:          form,
+		}
+		w.Write([]byte("<Response/>"))
+	}))
+
+	ts.gatewayID = lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.AWSSQS.CommandsEnabled = true
+	conf.Integration.AWSSQS.Region = "eu-west-1"
+	conf.Integration.AWSSQS.CredentialSource = "static"
+	conf.Integration.AWSSQS.AccessKeyID = "AKIDEXAMPLE"
+	conf.Integration.AWSSQS.SecretAccessKey = "secret"
+	conf.Integration.AWSSQS.EventTopicARN = "arn:aws:sns:eu-west-1:123456789012:events"
+	conf.Integration.AWSSQS.CommandQueueURL = ts.server.URL + "/123456789012/commands"
+	conf.Integration.AWSSQS.SNSEndpoint = ts.server.URL + "/sns"
+	conf.Integration.AWSSQS.Timeout = time.Second
+
+	var err error
+	ts.backend, err = NewBackend(conf)
+	assert.NoError(err)
+	assert.NoError(ts.backend.SetGatewaySubscription(true, ts.gatewayID))
+}
+
+func (ts *AWSSQSBackendTestSuite) TearDownSuite() {
+	assert := require.New(ts.T())
+	assert.NoError(ts.backend.Close())
+	ts.server.Close()
+}
+
+func (ts *AWSSQSBackendTestSuite) TestPublishEvent() {
+	assert := require.New(ts.T())
+
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	uplink := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", id, &uplink))
+
+	req := <-ts.requests
+	assert.Equal("/sns", req.path)
+	assert.Equal("Publish", req.form.Get("Action"))
+	assert.Equal("arn:aws:sns:eu-west-1:123456789012:events", req.form.Get("TopicArn"))
+	assert.Equal("gateway_id", req.form.Get("MessageAttributes.entry.1.Name"))
+	assert.Equal("0807060504030201", req.form.Get("MessageAttributes.entry.1.Value.StringValue"))
+	assert.Equal("event", req.form.Get("MessageAttributes.entry.2.Name"))
+	assert.Equal("up", req.form.Get("MessageAttributes.entry.2.Value.StringValue"))
+	assert.Equal("marshaler", req.form.Get("MessageAttributes.entry.3.Name"))
+	assert.Equal("json", req.form.Get("MessageAttributes.entry.3.Value.StringValue"))
+	assert.Regexp(`^AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/\d{8}/eu-west-1/sns/aws4_request, `, req.authorization)
+
+	var pl gw.UplinkFrame
+	assert.NoError(jsonpb.UnmarshalString(req.form.Get("Message"), &pl))
+	assert.Equal(uplink.PhyPayload, pl.PhyPayload)
+}
+
+func (ts *AWSSQSBackendTestSuite) TestDownlinkCommand() {
+	assert := require.New(ts.T())
+
+	pl := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+	var m jsonpb.Marshaler
+	str, err := m.MarshalToString(&pl)
+	assert.NoError(err)
+
+	ts.receiveQueue <- sqsMessage{
+		MessageID:     "message-1",
+		ReceiptHandle: "receipt-1",
+		Body:          str,
+		MessageAttributes: []messageAttribute{
+			{Name: "gateway_id", StringValue: "0807060504030201"},
+			{Name: "command", StringValue: "down"},
+		},
+	}
+
+	downlink := <-ts.backend.GetDownlinkFrameChan()
+	assert.Equal(pl.PhyPayload, downlink.PhyPayload)
+
+	req := <-ts.requests
+	assert.Equal("/123456789012/commands", req.path)
+	assert.Equal("DeleteMessage", req.form.Get("Action"))
+	assert.Equal("receipt-1", req.form.Get("ReceiptHandle"))
+	assert.Regexp(`^AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/\d{8}/eu-west-1/sqs/aws4_request, `, req.authorization)
+}
+
+func (ts *AWSSQSBackendTestSuite) TestUnknownGatewayCommand() {
+	assert := require.New(ts.T())
+
+	ts.receiveQueue <- sqsMessage{
+		MessageID:     "message-2",
+		ReceiptHandle: "receipt-2",
+		Body:          "{}",
+		MessageAttributes: []messageAttribute{
+			{Name: "gateway_id", StringValue: "0101010101010101"},
+			{Name: "command", StringValue: "down"},
+		},
+	}
+
+	// the command is discarded, but must still be deleted
+	req := <-ts.requests
+	assert.Equal("DeleteMessage", req.form.Get("Action"))
+	assert.Equal("receipt-2", req.form.Get("ReceiptHandle"))
+
+	select {
+	case <-ts.backend.GetDownlinkFrameChan():
+		assert.Fail("unexpected downlink frame")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestAWSSQSBackend(t *testing.T) {
+	suite.Run(t, new(AWSSQSBackendTestSuite))
+}
+
+func TestPublishEventQueue(t *testing.T) {
+	assert := require.New(t)
+
+	forms := make(chan url.Values, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(b))
+		forms <- form
+		w.Write([]byte("<SendMessageResponse/>"))
+	}))
+	defer server.Close()
+
+	var conf config.Config
+	conf.Integration.Marshaler = "protobuf"
+	conf.Integration.AWSSQS.Region = "eu-west-1"
+	conf.Integration.AWSSQS.CredentialSource = "static"
+	conf.Integration.AWSSQS.AccessKeyID = "AKIDEXAMPLE"
+	conf.Integration.AWSSQS.SecretAccessKey = "secret"
+	conf.Integration.AWSSQS.EventQueueURL = server.URL + "/123456789012/events"
+	conf.Integration.AWSSQS.Timeout = time.Second
+
+	b, err := NewBackend(conf)
+	assert.NoError(err)
+	defer b.Close()
+
+	gatewayID := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	stats := gw.GatewayStats{GatewayId: gatewayID[:], RxPacketsReceived: 10}
+	assert.NoError(b.PublishEvent(gatewayID, "stats", uuid.Nil, &stats))
+
+	form := <-forms
+	assert.Equal("SendMessage", form.Get("Action"))
+	assert.Equal("event", form.Get("MessageAttribute.2.Name"))
+	assert.Equal("stats", form.Get("MessageAttribute.2.Value.StringValue"))
+	assert.Equal("protobuf", form.Get("MessageAttribute.3.Value.StringValue"))
+
+	// protobuf payloads are base64 encoded
+	body, err := base64.StdEncoding.DecodeString(form.Get("MessageBody"))
+	assert.NoError(err)
+	var pl gw.GatewayStats
+	assert.NoError(proto.Unmarshal(body, &pl))
+	assert.Equal(uint32(10), pl.RxPacketsReceived)
+	assert.True(strings.HasPrefix(form.Get("Version"), "2012"))
+}
@@ -0,0 +1,35 @@
+package awssqs
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_aws_sqs_event_count",
+		Help: "The number of gateway events published by the AWS SQS / SNS integration (per event).",
+	}, []string{"event"})
+
+	eec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_aws_sqs_event_error_count",
+		Help: "The number of gateway events which could not be published by the AWS SQS / SNS integration (per event).",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_aws_sqs_command_count",
+		Help: "The number of commands received by the AWS SQS / SNS integration (per command).",
+	}, []string{"command"})
+)
+
+func sqsEventCounter(e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": e})
+}
+
+func sqsEventErrorCounter(e string) prometheus.Counter {
+	return eec.With(prometheus.Labels{"event": e})
+}
+
+func sqsCommandCounter(c string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": c})
+}
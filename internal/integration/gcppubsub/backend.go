@@ -0,0 +1,530 @@
+// Package gcppubsub implements a GCP Pub/Sub integration.
+//
+// Events are published directly to a Pub/Sub topic and commands are consumed
+// from a Pub/Sub subscription. The message attributes match the attributes
+// which were set by Cloud IoT Core, such that existing Pub/Sub consumers do
+// not need to be modified.
+package gcppubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// Message attributes (as set by Cloud IoT Core).
+const (
+	attrDeviceID               = "deviceId"
+	attrDeviceRegistryID       = "deviceRegistryId"
+	attrDeviceRegistryLocation = "deviceRegistryLocation"
+	attrProjectID              = "projectId"
+	attrSubFolder              = "subFolder"
+
+	// attrMarshaler contains the marshaler of the event (e.g. json).
+	attrMarshaler = "marshaler"
+)
+
+const (
+	pullMaxMessages   = 10
+	pullTimeout       = 30 * time.Second
+	pullRetryInterval = 2 * time.Second
+)
+
+// Backend implements a GCP Pub/Sub backend.
+type Backend struct {
+	sync.RWMutex
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	pullDone chan struct{}
+
+	client     *http.Client
+	pullClient *http.Client
+	tokens     *tokenSource
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+
+	// gateways maps the Cloud IoT Core device ID to the gateway ID.
+	gateways map[string]lorawan.EUI64
+
+	endpoint     string
+	projectID    string
+	cloudRegion  string
+	registryID   string
+	topic        string
+	subscription string
+
+	// marshalers contains the per event-type marshalers, marshal and
+	// unmarshal are the functions of the default marshaler.
+	marshalers marshaler.Set
+	marshal    func(msg proto.Message) ([]byte, error)
+	unmarshal  func(b []byte, msg proto.Message) error
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	psConf := conf.Integration.GCPPubSub
+
+	b := Backend{
+		client: &http.Client{
+			Timeout: psConf.Timeout,
+		},
+		pullClient: &http.Client{
+			Timeout: pullTimeout + psConf.Timeout,
+		},
+		pullDone: make(chan struct{}),
+
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[string]lorawan.EUI64),
+
+		endpoint:     strings.TrimRight(psConf.Endpoint, "/"),
+		projectID:    psConf.ProjectID,
+		cloudRegion:  psConf.CloudRegion,
+		registryID:   psConf.RegistryID,
+		topic:        psConf.EventTopic,
+		subscription: psConf.CommandSubscription,
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	// The credentials are optional, e.g. the Pub/Sub emulator does not
+	// require authentication.
+	if psConf.CredentialsFile != "" {
+		sa, err := readServiceAccount(psConf.CredentialsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/gcppubsub: read service-account error")
+		}
+
+		b.tokens, err = newTokenSource(sa)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/gcppubsub: new token source error")
+		}
+
+		if b.projectID == "" {
+			b.projectID = sa.ProjectID
+		}
+	}
+
+	if b.projectID == "" {
+		return nil, errors.New("integration/gcppubsub: project_id must be set")
+	}
+
+	var err error
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/gcppubsub: %s", err)
+	}
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	if psConf.CommandsEnabled {
+		log.WithFields(log.Fields{
+			"project_id":   b.projectID,
+			"subscription": b.subscription,
+		}).Info("integration/gcppubsub: starting command subscriber")
+
+		go b.pullLoop()
+	} else {
+		close(b.pullDone)
+	}
+
+	return &b, nil
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	log.Info("integration/gcppubsub: closing backend")
+
+	b.cancel()
+	<-b.pullDone
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway. Commands are only
+// accepted for the subscribed gateways.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/gcppubsub: set gateway subscription called")
+
+	if subscribe {
+		b.gateways[deviceID(gatewayID)] = gatewayID
+	} else {
+		delete(b.gateways, deviceID(gatewayID))
+	}
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	pubsubEventCounter(event).Inc()
+	idPrefix := map[string]string{
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id":           gatewayID,
+		"event":                event,
+		"topic":                b.topic,
+		idPrefix[event] + "id": id,
+	}).Info("integration/gcppubsub: publishing event")
+
+	if err := b.publish(gatewayID, event, v); err != nil {
+		pubsubEventErrorCounter(event).Inc()
+		return err
+	}
+
+	return nil
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, msg proto.Message) error {
+	m := b.marshalers.Event(event)
+
+	data, err := m.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	req := publishRequest{
+		Messages: []pubsubMessage{
+			{
+				Data: data,
+				Attributes: map[string]string{
+					attrDeviceID:               deviceID(gatewayID),
+					attrDeviceRegistryID:       b.registryID,
+					attrDeviceRegistryLocation: b.cloudRegion,
+					attrProjectID:              b.projectID,
+					attrSubFolder:              event,
+					attrMarshaler:              m.Name,
+				},
+			},
+		},
+	}
+
+	path := fmt.Sprintf("projects/%s/topics/%s:publish", b.projectID, b.topic)
+	if err := b.call(b.ctx, b.client, path, req, nil); err != nil {
+		return errors.Wrap(err, "publish error")
+	}
+
+	return nil
+}
+
+// pullLoop pulls the commands from the subscription until the backend is
+// closed.
+func (b *Backend) pullLoop() {
+	defer close(b.pullDone)
+
+	for {
+		msgs, err := b.pull()
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.WithError(err).Error("integration/gcppubsub: pull commands error")
+
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(pullRetryInterval):
+			}
+			continue
+		}
+
+		var ackIDs []string
+		for _, msg := range msgs {
+			b.handleCommand(msg.Message)
+			ackIDs = append(ackIDs, msg.AckID)
+		}
+
+		if len(ackIDs) == 0 {
+			continue
+		}
+
+		req := acknowledgeRequest{AckIDs: ackIDs}
+		path := fmt.Sprintf("projects/%s/subscriptions/%s:acknowledge", b.projectID, b.subscription)
+		if err := b.call(b.ctx, b.client, path, req, nil); err != nil {
+			log.WithError(err).Error("integration/gcppubsub: acknowledge commands error")
+		}
+	}
+}
+
+// pull returns the received messages. As this is a long-polling request,
+// a timeout is not considered as an error.
+func (b *Backend) pull() ([]receivedMessage, error) {
+	ctx, cancel := context.WithTimeout(b.ctx, pullTimeout)
+	defer cancel()
+
+	var resp pullResponse
+	path := fmt.Sprintf("projects/%s/subscriptions/%s:pull", b.projectID, b.subscription)
+	err := b.call(ctx, b.pullClient, path, pullRequest{MaxMessages: pullMaxMessages}, &resp)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, nil
+	}
+
+	return resp.ReceivedMessages, err
+}
+
+// call performs a Pub/Sub API call. The response is unmarshaled into resp
+// when not nil.
+func (b *Backend) call(ctx context.Context, client *http.Client, path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "marshal request error")
+	}
+
+	r, err := http.NewRequest("POST", b.endpoint+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+
+	if b.tokens != nil {
+		token, err := b.tokens.getToken()
+		if err != nil {
+			return errors.Wrap(err, "get token error")
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpResp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response error")
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected 200 response, got: %d (%s)", httpResp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if resp != nil {
+		if err := json.Unmarshal(respBody, resp); err != nil {
+			return errors.Wrap(err, "unmarshal response error")
+		}
+	}
+
+	return nil
+}
+
+// handleCommand handles the received command. The command type is read from
+// the subFolder attribute. Commands for unknown gateways are discarded.
+func (b *Backend) handleCommand(msg pubsubMessage) {
+	devID := msg.Attributes[attrDeviceID]
+	command := msg.Attributes[attrSubFolder]
+
+	b.RLock()
+	_, ok := b.gateways[devID]
+	b.RUnlock()
+	if !ok {
+		log.WithFields(log.Fields{
+			"device_id":  devID,
+			"message_id": msg.MessageID,
+		}).Warning("integration/gcppubsub: command received for unknown gateway")
+		return
+	}
+
+	var err error
+	switch command {
+	case "down":
+		pubsubCommandCounter("down").Inc()
+		err = b.handleDownlinkFrame(msg.Data)
+	case "config":
+		pubsubCommandCounter("config").Inc()
+		err = b.handleGatewayConfiguration(msg.Data)
+	case "exec":
+		pubsubCommandCounter("exec").Inc()
+		err = b.handleGatewayCommandExecRequest(msg.Data)
+	case "raw":
+		pubsubCommandCounter("raw").Inc()
+		err = b.handleRawPacketForwarderCommand(msg.Data)
+	default:
+		log.WithFields(log.Fields{
+			"device_id":  devID,
+			"sub_folder": command,
+			"message_id": msg.MessageID,
+		}).Warning("integration/gcppubsub: unexpected command received")
+		return
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"device_id":  devID,
+			"sub_folder": command,
+			"message_id": msg.MessageID,
+		}).WithError(err).Error("integration/gcppubsub: handle command error")
+	}
+}
+
+func (b *Backend) handleDownlinkFrame(body []byte) error {
+	var downlinkFrame gw.DownlinkFrame
+	if err := b.unmarshal(body, &downlinkFrame); err != nil {
+		return errors.Wrap(err, "unmarshal downlink frame error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var downID uuid.UUID
+	copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+	}).Info("integration/gcppubsub: downlink frame received")
+
+	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
+}
+
+func (b *Backend) handleGatewayConfiguration(body []byte) error {
+	var gatewayConfig gw.GatewayConfiguration
+	if err := b.unmarshal(body, &gatewayConfig); err != nil {
+		return errors.Wrap(err, "unmarshal gateway configuration error")
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], gatewayConfig.GetGatewayId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+	}).Info("integration/gcppubsub: gateway configuration received")
+
+	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
+}
+
+func (b *Backend) handleGatewayCommandExecRequest(body []byte) error {
+	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
+	if err := b.unmarshal(body, &gatewayCommandExecRequest); err != nil {
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var execID uuid.UUID
+	copy(gatewayID[:], gatewayCommandExecRequest.GetGatewayId())
+	copy(execID[:], gatewayCommandExecRequest.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/gcppubsub: gateway command execution request received")
+
+	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(body []byte) error {
+	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
+	if err := b.unmarshal(body, &rawPacketForwarderCommand); err != nil {
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var rawID uuid.UUID
+	copy(gatewayID[:], rawPacketForwarderCommand.GetGatewayId())
+	copy(rawID[:], rawPacketForwarderCommand.GetRawId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"raw_id":     rawID,
+	}).Info("integration/gcppubsub: raw packet-forwarder command received")
+
+	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
+
+// deviceID returns the Cloud IoT Core device ID for the given gateway ID.
+func deviceID(gatewayID lorawan.EUI64) string {
+	return "gw-" + gatewayID.String()
+}
+
+// Pub/Sub REST API messages. Note that []byte values are base64 encoded by
+// encoding/json, as expected by the API.
+type pubsubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	MessageID  string            `json:"messageId,omitempty"`
+}
+
+type publishRequest struct {
+	Messages []pubsubMessage `json:"messages"`
+}
+
+type pullRequest struct {
+	MaxMessages int `json:"maxMessages"`
+}
+
+type pullResponse struct {
+	ReceivedMessages []receivedMessage `json:"receivedMessages"`
+}
+
+type receivedMessage struct {
+	AckID   string        `json:"ackId"`
+	Message pubsubMessage `json:"message"`
+}
+
+type acknowledgeRequest struct {
+	AckIDs []string `json:"ackIds"`
+}
@@ -0,0 +1,230 @@
+package gcppubsub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/jsonpb"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type request struct {
+	path          string
+	authorization string
+	body          []byte
+}
+
+type GCPPubSubBackendTestSuite struct {
+	suite.Suite
+
+	tempDir    string
+	privateKey *rsa.PrivateKey
+	server     *httptest.Server
+	requests   chan request
+	pullQueue  chan receivedMessage
+	backend    *Backend
+	gatewayID  lorawan.EUI64
+}
+
+func (ts *GCPPubSubBackendTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	log.SetLevel(log.ErrorLevel)
+
+	var err error
+	ts.tempDir, err = ioutil.TempDir("", "gcppubsub")
+	assert.NoError(err)
+
+	ts.privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+
+	saJSON, err := json.Marshal(serviceAccount{
+		ProjectID:    "test-project",
+		PrivateKeyID: "key-id",
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(ts.privateKey),
+		})),
+		ClientEmail: "bridge@test-project.iam.gserviceaccount.com",
+	})
+	assert.NoError(err)
+	credentialsFile := filepath.Join(ts.tempDir, "credentials.json")
+	assert.NoError(ioutil.WriteFile(credentialsFile, saJSON, 0600))
+
+	ts.requests = make(chan request, 10)
+	ts.pullQueue = make(chan receivedMessage, 10)
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+
+		if strings.HasSuffix(r.URL.Path, ":pull") {
+			var resp pullResponse
+			select {
+			case msg := <-ts.pullQueue:
+				resp.ReceivedMessages = append(resp.ReceivedMessages, msg)
+			case <-time.After(10 * time.Millisecond):
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		ts.requests <- request{
+			path:          r.URL.Path,
+			authorization: r.Header.Get("Authorization"),
+			body:          b,
+		}
+		w.Write([]byte("{}"))
+	}))
+
+	ts.gatewayID = lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.GCPPubSub.CommandsEnabled = true
+	conf.Integration.GCPPubSub.CredentialsFile = credentialsFile
+	conf.Integration.GCPPubSub.CloudRegion = "europe-west1"
+	conf.Integration.GCPPubSub.RegistryID = "test-registry"
+	conf.Integration.GCPPubSub.EventTopic = "events"
+	conf.Integration.GCPPubSub.CommandSubscription = "commands"
+	conf.Integration.GCPPubSub.Endpoint = ts.server.URL
+	conf.Integration.GCPPubSub.Timeout = time.Second
+
+	ts.backend, err = NewBackend(conf)
+	assert.NoError(err)
+	assert.NoError(ts.backend.SetGatewaySubscription(true, ts.gatewayID))
+}
+
+func (ts *GCPPubSubBackendTestSuite) TearDownSuite() {
+	assert := require.New(ts.T())
+	assert.NoError(ts.backend.Close())
+	ts.server.Close()
+	os.RemoveAll(ts.tempDir)
+}
+
+func (ts *GCPPubSubBackendTestSuite) TestPublishEvent() {
+	assert := require.New(ts.T())
+
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	uplink := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", id, &uplink))
+
+	req := <-ts.requests
+	assert.Equal("/v1/projects/test-project/topics/events:publish", req.path)
+
+	var pubReq publishRequest
+	assert.NoError(json.Unmarshal(req.body, &pubReq))
+	assert.Len(pubReq.Messages, 1)
+	assert.Equal(map[string]string{
+		"deviceId":               "gw-0807060504030201",
+		"deviceRegistryId":       "test-registry",
+		"deviceRegistryLocation": "europe-west1",
+		"marshaler":              "json",
+		"projectId":              "test-project",
+		"subFolder":              "up",
+	}, pubReq.Messages[0].Attributes)
+
+	var pl gw.UplinkFrame
+	assert.NoError(jsonpb.UnmarshalString(string(pubReq.Messages[0].Data), &pl))
+	assert.Equal(uplink.PhyPayload, pl.PhyPayload)
+
+	ts.T().Run("Token", func(t *testing.T) {
+		assert := require.New(t)
+		assert.True(strings.HasPrefix(req.authorization, "Bearer "))
+
+		var claims jwt.StandardClaims
+		token, err := jwt.ParseWithClaims(strings.TrimPrefix(req.authorization, "Bearer "), &claims, func(*jwt.Token) (interface{}, error) {
+			return &ts.privateKey.PublicKey, nil
+		})
+		assert.NoError(err)
+		assert.Equal("key-id", token.Header["kid"])
+		assert.Equal("bridge@test-project.iam.gserviceaccount.com", claims.Issuer)
+		assert.Equal("https://pubsub.googleapis.com/", claims.Audience)
+	})
+}
+
+func (ts *GCPPubSubBackendTestSuite) TestDownlinkCommand() {
+	assert := require.New(ts.T())
+
+	pl := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+	var m jsonpb.Marshaler
+	str, err := m.MarshalToString(&pl)
+	assert.NoError(err)
+
+	ts.pullQueue <- receivedMessage{
+		AckID: "ack-1",
+		Message: pubsubMessage{
+			Data: []byte(str),
+			Attributes: map[string]string{
+				"deviceId":  "gw-0807060504030201",
+				"subFolder": "down",
+			},
+		},
+	}
+
+	downlink := <-ts.backend.GetDownlinkFrameChan()
+	assert.Equal(pl.PhyPayload, downlink.PhyPayload)
+
+	req := <-ts.requests
+	assert.Equal("/v1/projects/test-project/subscriptions/commands:acknowledge", req.path)
+	assert.JSONEq(`{"ackIds": ["ack-1"]}`, string(req.body))
+}
+
+func (ts *GCPPubSubBackendTestSuite) TestUnknownGatewayCommand() {
+	assert := require.New(ts.T())
+
+	ts.pullQueue <- receivedMessage{
+		AckID: "ack-2",
+		Message: pubsubMessage{
+			Data: []byte("{}"),
+			Attributes: map[string]string{
+				"deviceId":  "gw-0101010101010101",
+				"subFolder": "down",
+			},
+		},
+	}
+
+	// the command is discarded, but must still be acknowledged
+	req := <-ts.requests
+	assert.Equal("/v1/projects/test-project/subscriptions/commands:acknowledge", req.path)
+	assert.JSONEq(`{"ackIds": ["ack-2"]}`, string(req.body))
+
+	select {
+	case <-ts.backend.GetDownlinkFrameChan():
+		assert.Fail("unexpected downlink frame")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestGCPPubSubBackend(t *testing.T) {
+	suite.Run(t, new(GCPPubSubBackendTestSuite))
+}
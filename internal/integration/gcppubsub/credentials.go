@@ -0,0 +1,100 @@
+package gcppubsub
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// The Pub/Sub API accepts a self-signed JWT (signed using the service-account
+// key) as access token, using the API endpoint as audience. This avoids the
+// OAuth2 token exchange.
+const (
+	tokenAudience   = "https://pubsub.googleapis.com/"
+	tokenExpiration = time.Hour
+)
+
+// serviceAccount contains the fields of the service-account JSON key-file
+// which are used by this integration.
+type serviceAccount struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+}
+
+// tokenSource returns (cached) signed JWT tokens for the service-account.
+type tokenSource struct {
+	sync.Mutex
+
+	email      string
+	keyID      string
+	privateKey *rsa.PrivateKey
+
+	token     string
+	expiresAt time.Time
+}
+
+func newTokenSource(sa serviceAccount) (*tokenSource, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key error")
+	}
+
+	return &tokenSource{
+		email:      sa.ClientEmail,
+		keyID:      sa.PrivateKeyID,
+		privateKey: privateKey,
+	}, nil
+}
+
+func readServiceAccount(path string) (serviceAccount, error) {
+	var sa serviceAccount
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return sa, errors.Wrap(err, "read credentials file error")
+	}
+
+	if err := json.Unmarshal(b, &sa); err != nil {
+		return sa, errors.Wrap(err, "unmarshal credentials file error")
+	}
+
+	return sa, nil
+}
+
+// getToken returns the token, a new token is signed when the current token
+// expires within a minute.
+func (ts *tokenSource) getToken() (string, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	now := time.Now()
+	if ts.token != "" && ts.expiresAt.Sub(now) > time.Minute {
+		return ts.token, nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Issuer:    ts.email,
+		Subject:   ts.email,
+		Audience:  tokenAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(tokenExpiration).Unix(),
+	})
+	token.Header["kid"] = ts.keyID
+
+	signed, err := token.SignedString(ts.privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "sign token error")
+	}
+
+	ts.token = signed
+	ts.expiresAt = now.Add(tokenExpiration)
+
+	return ts.token, nil
+}
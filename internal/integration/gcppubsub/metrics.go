@@ -0,0 +1,35 @@
+package gcppubsub
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_gcp_pub_sub_event_count",
+		Help: "The number of gateway events published by the GCP Pub/Sub integration (per event).",
+	}, []string{"event"})
+
+	eec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_gcp_pub_sub_event_error_count",
+		Help: "The number of gateway events which could not be published by the GCP Pub/Sub integration (per event).",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_gcp_pub_sub_command_count",
+		Help: "The number of commands received by the GCP Pub/Sub integration (per command).",
+	}, []string{"command"})
+)
+
+func pubsubEventCounter(e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": e})
+}
+
+func pubsubEventErrorCounter(e string) prometheus.Counter {
+	return eec.With(prometheus.Labels{"event": e})
+}
+
+func pubsubCommandCounter(c string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": c})
+}
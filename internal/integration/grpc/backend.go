@@ -0,0 +1,388 @@
+// Package grpc implements a gRPC integration, streaming the gateway events to
+// (and receiving the gateway commands from) a gRPC server.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// streamMethod holds the full method name of the bidirectional stream.
+const streamMethod = "/gwbridge.GatewayBridgeService/Stream"
+
+// reconnectInterval defines the initial interval between two stream
+// (re)connect attempts. The interval is doubled on each failed attempt, up
+// to the max. reconnect interval.
+const reconnectInterval = time.Second
+
+var streamDesc = grpc.StreamDesc{
+	StreamName:    "Stream",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// Backend implements a gRPC backend.
+type Backend struct {
+	sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conn                 *grpc.ClientConn
+	commandsEnabled      bool
+	maxReconnectInterval time.Duration
+
+	// stream holds the current stream, it is nil when not connected.
+	stream grpc.ClientStream
+	// sendMux serializes the sends, as a gRPC stream does not support
+	// concurrent sends.
+	sendMux sync.Mutex
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+	gateways                      map[lorawan.EUI64]struct{}
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	b := Backend{
+		commandsEnabled:               conf.Integration.GRPC.CommandsEnabled,
+		maxReconnectInterval:          conf.Integration.GRPC.MaxReconnectInterval,
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[lorawan.EUI64]struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	var dialOpts []grpc.DialOption
+
+	if conf.Integration.GRPC.TLS {
+		tlsConfig, err := newTLSConfig(conf.Integration.GRPC.CACert, conf.Integration.GRPC.TLSCert, conf.Integration.GRPC.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/grpc: new tls config error")
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+
+	log.WithFields(log.Fields{
+		"server": conf.Integration.GRPC.Server,
+	}).Info("integration/grpc: connecting to grpc server")
+
+	var err error
+	b.conn, err = grpc.Dial(conf.Integration.GRPC.Server, dialOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/grpc: dial grpc server error")
+	}
+
+	go b.streamLoop()
+
+	return &b, nil
+}
+
+func newTLSConfig(caCert, tlsCert, tlsKey string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if caCert != "" {
+		b, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, errors.Wrap(err, "load ca-cert error")
+		}
+		certpool := x509.NewCertPool()
+		certpool.AppendCertsFromPEM(b)
+
+		tlsConfig.RootCAs = certpool
+	}
+
+	if tlsCert != "" && tlsKey != "" {
+		kp, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls key-pair error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{kp}
+	}
+
+	return tlsConfig, nil
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	b.cancel()
+	return b.conn.Close()
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway. When not
+// connected, the subscription is sent once the stream has been
+// (re)connected.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/grpc: set gateway subscription called")
+
+	if subscribe {
+		b.gateways[gatewayID] = struct{}{}
+	} else {
+		delete(b.gateways, gatewayID)
+	}
+
+	if b.stream == nil {
+		return nil
+	}
+
+	if err := b.send(b.stream, &Event{
+		GatewayId:           gatewayID[:],
+		GatewaySubscription: &GatewaySubscription{Subscribe: subscribe},
+	}); err != nil {
+		log.WithError(err).WithField("gateway_id", gatewayID).Error("integration/grpc: send gateway subscription error")
+	}
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	e := Event{
+		GatewayId: gatewayID[:],
+	}
+
+	switch v := v.(type) {
+	case *gw.UplinkFrame:
+		e.UplinkFrame = v
+	case *gw.UplinkFrameSet:
+		e.UplinkFrameSet = v
+	case *gw.GatewayStats:
+		e.GatewayStats = v
+	case *gw.DownlinkTXAck:
+		e.DownlinkTxAck = v
+	case *gw.GatewayCommandExecResponse:
+		e.GatewayCommandExecResponse = v
+	case *gw.RawPacketForwarderEvent:
+		e.RawPacketForwarderEvent = v
+	case *events.ConnState:
+		e.ConnState = v
+	case *events.Log:
+		e.Log = v
+	default:
+		return fmt.Errorf("unexpected event type: %T", v)
+	}
+
+	grpcEventCounter(event).Inc()
+
+	b.RLock()
+	stream := b.stream
+	b.RUnlock()
+
+	if stream == nil {
+		return errors.New("not connected")
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"event":      event,
+		"id":         id,
+	}).Info("integration/grpc: publishing event")
+
+	return b.send(stream, &e)
+}
+
+func (b *Backend) send(stream grpc.ClientStream, e *Event) error {
+	b.sendMux.Lock()
+	defer b.sendMux.Unlock()
+
+	if err := stream.SendMsg(e); err != nil {
+		return errors.Wrap(err, "send event error")
+	}
+
+	return nil
+}
+
+// streamLoop opens the stream and receives the commands. On a stream error,
+// the stream is re-opened until the backend is closed.
+func (b *Backend) streamLoop() {
+	interval := reconnectInterval
+
+	for {
+		if connected := b.runStream(); connected {
+			interval = reconnectInterval
+		}
+
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-b.ctx.Done():
+			return
+		}
+
+		if interval *= 2; b.maxReconnectInterval > 0 && interval > b.maxReconnectInterval {
+			interval = b.maxReconnectInterval
+		}
+	}
+}
+
+// runStream opens the stream and receives the commands until the stream
+// fails. It returns true when the stream was connected.
+func (b *Backend) runStream() bool {
+	ctx, cancel := context.WithCancel(b.ctx)
+	defer cancel()
+
+	stream, err := b.conn.NewStream(ctx, &streamDesc, streamMethod, grpc.WaitForReady(true))
+	if err != nil {
+		if b.ctx.Err() == nil {
+			log.WithError(err).Error("integration/grpc: open stream error")
+		}
+		return false
+	}
+
+	// The subscriptions are (re)sent before the stream is made available
+	// for publishing events.
+	b.Lock()
+	for gatewayID := range b.gateways {
+		if err := b.send(stream, &Event{
+			GatewayId:           gatewayID[:],
+			GatewaySubscription: &GatewaySubscription{Subscribe: true},
+		}); err != nil {
+			b.Unlock()
+			log.WithError(err).WithField("gateway_id", gatewayID).Error("integration/grpc: send gateway subscription error")
+			return false
+		}
+	}
+	b.stream = stream
+	b.Unlock()
+
+	grpcConnectCounter().Inc()
+	log.Info("integration/grpc: stream connected")
+
+	defer func() {
+		b.Lock()
+		b.stream = nil
+		b.Unlock()
+
+		grpcDisconnectCounter().Inc()
+	}()
+
+	for {
+		var cmd Command
+		if err := stream.RecvMsg(&cmd); err != nil {
+			if b.ctx.Err() == nil {
+				log.WithError(err).Error("integration/grpc: stream error")
+			}
+			return true
+		}
+
+		b.handleCommand(cmd)
+	}
+}
+
+func (b *Backend) handleCommand(cmd Command) {
+	if !b.commandsEnabled {
+		log.Warning("integration/grpc: command received while commands are disabled")
+		return
+	}
+
+	switch {
+	case cmd.DownlinkFrame != nil:
+		grpcCommandCounter("down").Inc()
+
+		var gatewayID lorawan.EUI64
+		var downID uuid.UUID
+		copy(gatewayID[:], cmd.DownlinkFrame.GetTxInfo().GetGatewayId())
+		copy(downID[:], cmd.DownlinkFrame.GetDownlinkId())
+
+		log.WithFields(log.Fields{
+			"gateway_id":  gatewayID,
+			"downlink_id": downID,
+		}).Info("integration/grpc: downlink frame received")
+
+		b.downlinkFrameChan <- *cmd.DownlinkFrame
+	case cmd.GatewayConfiguration != nil:
+		grpcCommandCounter("config").Inc()
+
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], cmd.GatewayConfiguration.GetGatewayId())
+
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+		}).Info("integration/grpc: gateway configuration received")
+
+		b.gatewayConfigurationChan <- *cmd.GatewayConfiguration
+	case cmd.GatewayCommandExecRequest != nil:
+		grpcCommandCounter("exec").Inc()
+
+		var gatewayID lorawan.EUI64
+		var execID uuid.UUID
+		copy(gatewayID[:], cmd.GatewayCommandExecRequest.GetGatewayId())
+		copy(execID[:], cmd.GatewayCommandExecRequest.GetExecId())
+
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"exec_id":    execID,
+		}).Info("integration/grpc: gateway command execution request received")
+
+		b.gatewayCommandExecRequestChan <- *cmd.GatewayCommandExecRequest
+	case cmd.RawPacketForwarderCommand != nil:
+		grpcCommandCounter("raw").Inc()
+
+		var gatewayID lorawan.EUI64
+		var rawID uuid.UUID
+		copy(gatewayID[:], cmd.RawPacketForwarderCommand.GetGatewayId())
+		copy(rawID[:], cmd.RawPacketForwarderCommand.GetRawId())
+
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"raw_id":     rawID,
+		}).Info("integration/grpc: raw packet-forwarder command received")
+
+		b.rawPacketForwarderCommandChan <- *cmd.RawPacketForwarderCommand
+	default:
+		log.Warning("integration/grpc: unexpected command received")
+	}
+}
@@ -0,0 +1,199 @@
+package grpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// testServer implements the server side of the stream.
+type testServer struct {
+	streams chan grpc.ServerStream
+}
+
+func (s *testServer) serviceDesc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "gwbridge.GatewayBridgeService",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Stream",
+				ServerStreams: true,
+				ClientStreams: true,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					s.streams <- stream
+					<-stream.Context().Done()
+					return nil
+				},
+			},
+		},
+	}
+}
+
+type GRPCBackendTestSuite struct {
+	suite.Suite
+
+	server    *grpc.Server
+	ts        *testServer
+	backend   *Backend
+	stream    grpc.ServerStream
+	gatewayID lorawan.EUI64
+}
+
+func (ts *GRPCBackendTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	log.SetLevel(log.ErrorLevel)
+
+	ts.gatewayID = lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+
+	ts.ts = &testServer{streams: make(chan grpc.ServerStream, 1)}
+	ts.server = grpc.NewServer()
+	ts.server.RegisterService(ts.ts.serviceDesc(), ts.ts)
+	go ts.server.Serve(ln)
+
+	var conf config.Config
+	conf.Integration.GRPC.CommandsEnabled = true
+	conf.Integration.GRPC.Server = ln.Addr().String()
+
+	ts.backend, err = NewBackend(conf)
+	assert.NoError(err)
+	assert.NoError(ts.backend.SetGatewaySubscription(true, ts.gatewayID))
+
+	select {
+	case ts.stream = <-ts.ts.streams:
+	case <-time.After(5 * time.Second):
+		assert.FailNow("stream not opened")
+	}
+}
+
+func (ts *GRPCBackendTestSuite) TearDownSuite() {
+	ts.backend.Close()
+	ts.server.Stop()
+}
+
+func (ts *GRPCBackendTestSuite) TestGatewaySubscription() {
+	assert := require.New(ts.T())
+
+	var e Event
+	assert.NoError(ts.stream.RecvMsg(&e))
+	assert.Equal(ts.gatewayID[:], e.GatewayId)
+	assert.True(proto.Equal(&GatewaySubscription{Subscribe: true}, e.GatewaySubscription))
+}
+
+func (ts *GRPCBackendTestSuite) TestPublishEvent() {
+	tests := []struct {
+		Name     string
+		Event    string
+		Message  proto.Message
+		Expected Event
+	}{
+		{
+			Name:  "uplink",
+			Event: "up",
+			Message: &gw.UplinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+			},
+			Expected: Event{
+				GatewayId: ts.gatewayID[:],
+				UplinkFrame: &gw.UplinkFrame{
+					PhyPayload: []byte{1, 2, 3, 4},
+				},
+			},
+		},
+		{
+			Name:  "conn",
+			Event: "conn",
+			Message: &events.ConnState{
+				GatewayId: ts.gatewayID[:],
+				State:     events.ConnStateOnline,
+			},
+			Expected: Event{
+				GatewayId: ts.gatewayID[:],
+				ConnState: &events.ConnState{
+					GatewayId: ts.gatewayID[:],
+					State:     events.ConnStateOnline,
+				},
+			},
+		},
+	}
+
+	// wait for the stream to be made available for publishing
+	for i := 0; i < 50; i++ {
+		ts.backend.RLock()
+		connected := ts.backend.stream != nil
+		ts.backend.RUnlock()
+		if connected {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tst := range tests {
+		ts.T().Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(ts.backend.PublishEvent(ts.gatewayID, tst.Event, uuid.Nil, tst.Message))
+
+			// skip the gateway subscription (in case not yet received)
+			var e Event
+			for {
+				assert.NoError(ts.stream.RecvMsg(&e))
+				if e.GatewaySubscription == nil {
+					break
+				}
+			}
+
+			assert.True(proto.Equal(&tst.Expected, &e))
+		})
+	}
+}
+
+func (ts *GRPCBackendTestSuite) TestCommands() {
+	ts.T().Run("Downlink", func(t *testing.T) {
+		assert := require.New(t)
+
+		downlink := gw.DownlinkFrame{
+			PhyPayload: []byte{1, 2, 3, 4},
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: ts.gatewayID[:],
+			},
+		}
+		assert.NoError(ts.stream.SendMsg(&Command{DownlinkFrame: &downlink}))
+
+		received := <-ts.backend.GetDownlinkFrameChan()
+		assert.True(proto.Equal(&downlink, &received))
+	})
+
+	ts.T().Run("Exec", func(t *testing.T) {
+		assert := require.New(t)
+
+		execReq := gw.GatewayCommandExecRequest{
+			GatewayId: ts.gatewayID[:],
+			Command:   "reboot",
+		}
+		assert.NoError(ts.stream.SendMsg(&Command{GatewayCommandExecRequest: &execReq}))
+
+		received := <-ts.backend.GetGatewayCommandExecRequestChan()
+		assert.True(proto.Equal(&execReq, &received))
+	})
+}
+
+func TestGRPCBackend(t *testing.T) {
+	suite.Run(t, new(GRPCBackendTestSuite))
+}
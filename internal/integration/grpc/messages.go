@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+)
+
+// Event contains a gateway event sent to the server. Only one of the event
+// fields is set (on the wire, these are encoded as a oneof).
+type Event struct {
+	// Gateway ID.
+	GatewayId []byte `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayID,proto3" json:"gateway_id,omitempty"`
+	// Uplink frame.
+	UplinkFrame *gw.UplinkFrame `protobuf:"bytes,2,opt,name=uplink_frame,json=uplinkFrame,proto3" json:"uplink_frame,omitempty"`
+	// Gateway stats.
+	GatewayStats *gw.GatewayStats `protobuf:"bytes,3,opt,name=gateway_stats,json=gatewayStats,proto3" json:"gateway_stats,omitempty"`
+	// Downlink TX acknowledgement.
+	DownlinkTxAck *gw.DownlinkTXAck `protobuf:"bytes,4,opt,name=downlink_tx_ack,json=downlinkTXAck,proto3" json:"downlink_tx_ack,omitempty"`
+	// Gateway command execution response.
+	GatewayCommandExecResponse *gw.GatewayCommandExecResponse `protobuf:"bytes,5,opt,name=gateway_command_exec_response,json=gatewayCommandExecResponse,proto3" json:"gateway_command_exec_response,omitempty"`
+	// Raw packet-forwarder event.
+	RawPacketForwarderEvent *gw.RawPacketForwarderEvent `protobuf:"bytes,6,opt,name=raw_packet_forwarder_event,json=rawPacketForwarderEvent,proto3" json:"raw_packet_forwarder_event,omitempty"`
+	// Connection state.
+	ConnState *events.ConnState `protobuf:"bytes,7,opt,name=conn_state,json=connState,proto3" json:"conn_state,omitempty"`
+	// Log event.
+	Log *events.Log `protobuf:"bytes,8,opt,name=log,proto3" json:"log,omitempty"`
+	// Gateway subscription.
+	GatewaySubscription *GatewaySubscription `protobuf:"bytes,9,opt,name=gateway_subscription,json=gatewaySubscription,proto3" json:"gateway_subscription,omitempty"`
+	// Deduplicated uplink frames.
+	UplinkFrameSet *gw.UplinkFrameSet `protobuf:"bytes,10,opt,name=uplink_frame_set,json=uplinkFrameSet,proto3" json:"uplink_frame_set,omitempty"`
+}
+
+// Reset resets the event.
+func (m *Event) Reset() { *m = Event{} }
+
+// String returns the text representation of the event.
+func (m *Event) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*Event) ProtoMessage() {}
+
+// GatewaySubscription informs the server that the commands for the gateway
+// must (no longer) be sent over this stream.
+type GatewaySubscription struct {
+	// Subscribe (true) or unsubscribe (false).
+	Subscribe bool `protobuf:"varint,1,opt,name=subscribe,proto3" json:"subscribe,omitempty"`
+}
+
+// Reset resets the gateway subscription.
+func (m *GatewaySubscription) Reset() { *m = GatewaySubscription{} }
+
+// String returns the text representation of the gateway subscription.
+func (m *GatewaySubscription) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*GatewaySubscription) ProtoMessage() {}
+
+// Command contains a gateway command received from the server. Only one of
+// the command fields is set (on the wire, these are encoded as a oneof).
+type Command struct {
+	// Downlink frame.
+	DownlinkFrame *gw.DownlinkFrame `protobuf:"bytes,1,opt,name=downlink_frame,json=downlinkFrame,proto3" json:"downlink_frame,omitempty"`
+	// Gateway configuration.
+	GatewayConfiguration *gw.GatewayConfiguration `protobuf:"bytes,2,opt,name=gateway_configuration,json=gatewayConfiguration,proto3" json:"gateway_configuration,omitempty"`
+	// Gateway command execution request.
+	GatewayCommandExecRequest *gw.GatewayCommandExecRequest `protobuf:"bytes,3,opt,name=gateway_command_exec_request,json=gatewayCommandExecRequest,proto3" json:"gateway_command_exec_request,omitempty"`
+	// Raw packet-forwarder command.
+	RawPacketForwarderCommand *gw.RawPacketForwarderCommand `protobuf:"bytes,4,opt,name=raw_packet_forwarder_command,json=rawPacketForwarderCommand,proto3" json:"raw_packet_forwarder_command,omitempty"`
+}
+
+// Reset resets the command.
+func (m *Command) Reset() { *m = Command{} }
+
+// String returns the text representation of the command.
+func (m *Command) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*Command) ProtoMessage() {}
@@ -0,0 +1,44 @@
+package grpc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_grpc_event_count",
+		Help: "The number of gateway events published by the gRPC integration (per event).",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_grpc_command_count",
+		Help: "The number of commands received by the gRPC integration (per command).",
+	}, []string{"command"})
+
+	sc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_grpc_connect_count",
+		Help: "The number of times the integration connected the stream to the gRPC server.",
+	})
+
+	sd = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_grpc_disconnect_count",
+		Help: "The number of times the stream to the gRPC server was disconnected.",
+	})
+)
+
+func grpcEventCounter(e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": e})
+}
+
+func grpcCommandCounter(c string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": c})
+}
+
+func grpcConnectCounter() prometheus.Counter {
+	return sc
+}
+
+func grpcDisconnectCounter() prometheus.Counter {
+	return sd
+}
@@ -0,0 +1,86 @@
+package gwv4
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// downlinkItemsDuration defines the duration the pending downlink items are
+// kept, e.g. when no ack is received for the first item.
+var downlinkItemsDuration = time.Minute
+
+var downlinkItems = newDownlinkItemStore()
+
+type pendingItems struct {
+	frames    []gw.DownlinkFrame
+	createdAt time.Time
+}
+
+// downlinkItemStore stores the pending items of the v4 downlink frames by
+// downlink ID.
+type downlinkItemStore struct {
+	sync.Mutex
+	items map[uuid.UUID]pendingItems
+}
+
+func newDownlinkItemStore() *downlinkItemStore {
+	return &downlinkItemStore{
+		items: make(map[uuid.UUID]pendingItems),
+	}
+}
+
+func (s *downlinkItemStore) set(frames []gw.DownlinkFrame) {
+	var downID uuid.UUID
+	copy(downID[:], frames[0].GetDownlinkId())
+	if downID == uuid.Nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	for id, item := range s.items {
+		if now.Sub(item.createdAt) > downlinkItemsDuration {
+			delete(s.items, id)
+		}
+	}
+
+	s.items[downID] = pendingItems{
+		frames:    frames,
+		createdAt: now,
+	}
+}
+
+func (s *downlinkItemStore) pop(downID uuid.UUID) (gw.DownlinkFrame, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	item, ok := s.items[downID]
+	if !ok || len(item.frames) == 0 {
+		return gw.DownlinkFrame{}, false
+	}
+
+	out := item.frames[0]
+	item.frames = item.frames[1:]
+	if len(item.frames) == 0 {
+		delete(s.items, downID)
+	} else {
+		s.items[downID] = item
+	}
+
+	return out, true
+}
+
+func (s *downlinkItemStore) discard(downID uuid.UUID) int {
+	s.Lock()
+	defer s.Unlock()
+
+	n := len(s.items[downID].frames)
+	delete(s.items, downID)
+	return n
+}
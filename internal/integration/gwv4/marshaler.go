@@ -0,0 +1,79 @@
+package gwv4
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// Wrap wraps the given marshal and unmarshal functions of an integration,
+// such that the uplink, stats and ack events are marshaled as v4 messages
+// and that the downlink frames are unmarshaled from v4 messages. Other
+// messages are passed through as-is.
+//
+// Only the first item of a v4 downlink frame is returned by unmarshal, the
+// other items are stored and can be retrieved using PopDownlinkItem when the
+// first item was rejected by the gateway. Downlink frames without items are
+// unmarshaled as v3 DownlinkFrame, such that v3 network servers are still
+// able to send downlinks.
+func Wrap(marshal func(proto.Message) ([]byte, error), unmarshal func([]byte, proto.Message) error) (func(proto.Message) ([]byte, error), func([]byte, proto.Message) error) {
+	wrappedMarshal := func(msg proto.Message) ([]byte, error) {
+		switch v := msg.(type) {
+		case *gw.UplinkFrame:
+			up, err := UplinkFrameFromV3(*v)
+			if err != nil {
+				return nil, errors.Wrap(err, "translate uplink frame error")
+			}
+			return marshal(&up)
+		case *gw.GatewayStats:
+			stats := GatewayStatsFromV3(*v)
+			return marshal(&stats)
+		case txAck:
+			ack := downlinkTxAckFromV3(v)
+			return marshal(&ack)
+		default:
+			return marshal(msg)
+		}
+	}
+
+	wrappedUnmarshal := func(b []byte, msg proto.Message) error {
+		df, ok := msg.(*gw.DownlinkFrame)
+		if !ok {
+			return unmarshal(b, msg)
+		}
+
+		var v4 DownlinkFrame
+		if err := unmarshal(b, &v4); err != nil || len(v4.Items) == 0 {
+			return unmarshal(b, msg)
+		}
+
+		frames, err := DownlinkFrameToV3(v4)
+		if err != nil {
+			return errors.Wrap(err, "translate downlink frame error")
+		}
+
+		*df = frames[0]
+		if len(frames) > 1 {
+			downlinkItems.set(frames[1:])
+		}
+
+		return nil
+	}
+
+	return wrappedMarshal, wrappedUnmarshal
+}
+
+// PopDownlinkItem returns and removes the next pending item of the given
+// downlink. It returns false when there are no pending items.
+func PopDownlinkItem(downID uuid.UUID) (gw.DownlinkFrame, bool) {
+	return downlinkItems.pop(downID)
+}
+
+// DiscardDownlinkItems removes the pending items of the given downlink, e.g.
+// after an item has been transmitted. It returns the number of removed
+// items.
+func DiscardDownlinkItems(downID uuid.UUID) int {
+	return downlinkItems.discard(downID)
+}
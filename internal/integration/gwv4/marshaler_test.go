@@ -0,0 +1,200 @@
+package gwv4
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestWrap(t *testing.T) {
+	marshalers := []struct {
+		Name      string
+		Marshal   func(proto.Message) ([]byte, error)
+		Unmarshal func([]byte, proto.Message) error
+	}{
+		{
+			Name:      "protobuf",
+			Marshal:   proto.Marshal,
+			Unmarshal: proto.Unmarshal,
+		},
+		{
+			Name: "json",
+			Marshal: func(msg proto.Message) ([]byte, error) {
+				m := &jsonpb.Marshaler{EmitDefaults: true}
+				str, err := m.MarshalToString(msg)
+				return []byte(str), err
+			},
+			Unmarshal: func(b []byte, msg proto.Message) error {
+				u := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+				return u.Unmarshal(bytes.NewReader(b), msg)
+			},
+		},
+	}
+
+	gatewayID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	downID := []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	for _, m := range marshalers {
+		t.Run(m.Name, func(t *testing.T) {
+			marshal, unmarshal := Wrap(m.Marshal, m.Unmarshal)
+
+			t.Run("uplink frame", func(t *testing.T) {
+				assert := require.New(t)
+
+				b, err := marshal(&gw.UplinkFrame{
+					PhyPayload: []byte{1, 2, 3},
+					TxInfo: &gw.UplinkTXInfo{
+						Frequency:  868100000,
+						Modulation: common.Modulation_LORA,
+						ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+							LoraModulationInfo: &gw.LoRaModulationInfo{
+								Bandwidth:       125,
+								SpreadingFactor: 7,
+								CodeRate:        "4/5",
+							},
+						},
+					},
+					RxInfo: &gw.UplinkRXInfo{
+						GatewayId: gatewayID,
+						Rssi:      -60,
+					},
+				})
+				assert.NoError(err)
+
+				var up UplinkFrame
+				assert.NoError(m.Unmarshal(b, &up))
+				assert.Equal("0102030405060708", up.RxInfo.GatewayId)
+				assert.Equal(uint32(125000), up.TxInfo.Modulation.GetLora().Bandwidth)
+				assert.Equal(CodeRate_CR_4_5, up.TxInfo.Modulation.GetLora().CodeRate)
+				assert.Equal(gatewayID, up.RxInfoLegacy.GatewayId)
+			})
+
+			t.Run("downlink tx ack", func(t *testing.T) {
+				assert := require.New(t)
+
+				b, err := marshal(&gw.DownlinkTXAck{
+					GatewayId:  gatewayID,
+					DownlinkId: downID,
+					Error:      "TX_FREQ",
+				})
+				assert.NoError(err)
+
+				var ack DownlinkTxAck
+				assert.NoError(m.Unmarshal(b, &ack))
+				assert.Equal(uint32(1), ack.DownlinkId)
+				assert.Len(ack.Items, 1)
+				assert.Equal(TxAckStatus_TX_FREQ, ack.Items[0].Status)
+			})
+
+			t.Run("other message", func(t *testing.T) {
+				assert := require.New(t)
+
+				in := gw.RawPacketForwarderEvent{
+					GatewayId: gatewayID,
+					Payload:   []byte{1, 2, 3},
+				}
+				b, err := marshal(&in)
+				assert.NoError(err)
+
+				var out gw.RawPacketForwarderEvent
+				assert.NoError(m.Unmarshal(b, &out))
+				assert.True(proto.Equal(&in, &out))
+			})
+
+			t.Run("downlink frame", func(t *testing.T) {
+				assert := require.New(t)
+
+				item := func(freq uint32) *DownlinkFrameItem {
+					return &DownlinkFrameItem{
+						PhyPayload: []byte{1, 2, 3},
+						TxInfo: &DownlinkTxInfo{
+							Frequency: freq,
+							Modulation: &Modulation{
+								Parameters: &Modulation_Lora{
+									Lora: &LoraModulationInfo{
+										Bandwidth:       125000,
+										SpreadingFactor: 12,
+										CodeRate:        CodeRate_CR_4_5,
+									},
+								},
+							},
+							Timing: &Timing{
+								Parameters: &Timing_Immediately{
+									Immediately: &ImmediatelyTimingInfo{},
+								},
+							},
+						},
+					}
+				}
+
+				b, err := m.Marshal(&DownlinkFrame{
+					DownlinkId: 1,
+					GatewayId:  "0102030405060708",
+					Items:      []*DownlinkFrameItem{item(868100000), item(869525000)},
+				})
+				assert.NoError(err)
+
+				var df gw.DownlinkFrame
+				assert.NoError(unmarshal(b, &df))
+				assert.Equal(uint32(868100000), df.TxInfo.Frequency)
+				assert.Equal(gatewayID, df.TxInfo.GatewayId)
+				assert.Equal(downID, df.DownlinkId)
+
+				var id uuid.UUID
+				copy(id[:], downID)
+
+				next, ok := PopDownlinkItem(id)
+				assert.True(ok)
+				assert.Equal(uint32(869525000), next.TxInfo.Frequency)
+
+				_, ok = PopDownlinkItem(id)
+				assert.False(ok)
+
+				// the pending items are discarded once an item has been
+				// transmitted
+				assert.NoError(unmarshal(b, &df))
+				assert.Equal(1, DiscardDownlinkItems(id))
+				assert.Equal(0, DiscardDownlinkItems(id))
+			})
+
+			t.Run("v3 downlink frame", func(t *testing.T) {
+				assert := require.New(t)
+
+				in := gw.DownlinkFrame{
+					PhyPayload: []byte{1, 2, 3},
+					Token:      1234,
+					DownlinkId: downID,
+					TxInfo: &gw.DownlinkTXInfo{
+						GatewayId:  gatewayID,
+						Frequency:  868100000,
+						Modulation: common.Modulation_LORA,
+						ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+							LoraModulationInfo: &gw.LoRaModulationInfo{
+								Bandwidth:       125,
+								SpreadingFactor: 12,
+								CodeRate:        "4/5",
+							},
+						},
+						Timing: gw.DownlinkTiming_IMMEDIATELY,
+						TimingInfo: &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+							ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+						},
+					},
+				}
+				b, err := m.Marshal(&in)
+				assert.NoError(err)
+
+				var out gw.DownlinkFrame
+				assert.NoError(unmarshal(b, &out))
+				assert.True(proto.Equal(&in, &out))
+			})
+		})
+	}
+}
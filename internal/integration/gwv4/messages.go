@@ -0,0 +1,512 @@
+package gwv4
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// The messages in this file implement the subset of the ChirpStack v4 gw
+// Protobuf messages (chirpstack/api/proto/gw/gw.proto) used by the
+// ChirpStack Gateway Bridge. The field numbers are equal to the v4
+// definitions. The legacy fields have the layout of the v3 messages, such
+// that these messages can also be decoded by v3 consumers.
+
+// CodeRate defines the (LoRa) code-rate.
+type CodeRate int32
+
+// Code-rates.
+const (
+	CodeRate_CR_UNDEFINED CodeRate = 0
+	CodeRate_CR_4_5       CodeRate = 1
+	CodeRate_CR_4_6       CodeRate = 2
+	CodeRate_CR_4_7       CodeRate = 3
+	CodeRate_CR_4_8       CodeRate = 4
+	CodeRate_CR_3_8       CodeRate = 5
+	CodeRate_CR_2_6       CodeRate = 6
+	CodeRate_CR_1_4       CodeRate = 7
+	CodeRate_CR_1_6       CodeRate = 8
+	CodeRate_CR_5_6       CodeRate = 9
+	CodeRate_CR_LI_4_5    CodeRate = 10
+	CodeRate_CR_LI_4_6    CodeRate = 11
+	CodeRate_CR_LI_4_8    CodeRate = 12
+)
+
+var CodeRate_name = map[int32]string{
+	0:  "CR_UNDEFINED",
+	1:  "CR_4_5",
+	2:  "CR_4_6",
+	3:  "CR_4_7",
+	4:  "CR_4_8",
+	5:  "CR_3_8",
+	6:  "CR_2_6",
+	7:  "CR_1_4",
+	8:  "CR_1_6",
+	9:  "CR_5_6",
+	10: "CR_LI_4_5",
+	11: "CR_LI_4_6",
+	12: "CR_LI_4_8",
+}
+
+var CodeRate_value = map[string]int32{
+	"CR_UNDEFINED": 0,
+	"CR_4_5":       1,
+	"CR_4_6":       2,
+	"CR_4_7":       3,
+	"CR_4_8":       4,
+	"CR_3_8":       5,
+	"CR_2_6":       6,
+	"CR_1_4":       7,
+	"CR_1_6":       8,
+	"CR_5_6":       9,
+	"CR_LI_4_5":    10,
+	"CR_LI_4_6":    11,
+	"CR_LI_4_8":    12,
+}
+
+func (x CodeRate) String() string { return proto.EnumName(CodeRate_name, int32(x)) }
+
+// TxAckStatus defines the status of a downlink item.
+type TxAckStatus int32
+
+// TX acknowledgement statuses.
+const (
+	TxAckStatus_IGNORED          TxAckStatus = 0
+	TxAckStatus_OK               TxAckStatus = 1
+	TxAckStatus_TOO_LATE         TxAckStatus = 2
+	TxAckStatus_TOO_EARLY        TxAckStatus = 3
+	TxAckStatus_COLLISION_PACKET TxAckStatus = 4
+	TxAckStatus_COLLISION_BEACON TxAckStatus = 5
+	TxAckStatus_TX_FREQ          TxAckStatus = 6
+	TxAckStatus_TX_POWER         TxAckStatus = 7
+	TxAckStatus_GPS_UNLOCKED     TxAckStatus = 8
+	TxAckStatus_QUEUE_FULL       TxAckStatus = 9
+	TxAckStatus_INTERNAL_ERROR   TxAckStatus = 10
+)
+
+var TxAckStatus_name = map[int32]string{
+	0:  "IGNORED",
+	1:  "OK",
+	2:  "TOO_LATE",
+	3:  "TOO_EARLY",
+	4:  "COLLISION_PACKET",
+	5:  "COLLISION_BEACON",
+	6:  "TX_FREQ",
+	7:  "TX_POWER",
+	8:  "GPS_UNLOCKED",
+	9:  "QUEUE_FULL",
+	10: "INTERNAL_ERROR",
+}
+
+var TxAckStatus_value = map[string]int32{
+	"IGNORED":          0,
+	"OK":               1,
+	"TOO_LATE":         2,
+	"TOO_EARLY":        3,
+	"COLLISION_PACKET": 4,
+	"COLLISION_BEACON": 5,
+	"TX_FREQ":          6,
+	"TX_POWER":         7,
+	"GPS_UNLOCKED":     8,
+	"QUEUE_FULL":       9,
+	"INTERNAL_ERROR":   10,
+}
+
+func (x TxAckStatus) String() string { return proto.EnumName(TxAckStatus_name, int32(x)) }
+
+func init() {
+	proto.RegisterEnum("gw.CodeRate", CodeRate_name, CodeRate_value)
+	proto.RegisterEnum("gw.TxAckStatus", TxAckStatus_name, TxAckStatus_value)
+}
+
+// Modulation contains the modulation parameters.
+type Modulation struct {
+	// Types that are valid to be assigned to Parameters:
+	//	*Modulation_Lora
+	//	*Modulation_Fsk
+	//	*Modulation_LrFhss
+	Parameters isModulation_Parameters `protobuf_oneof:"parameters"`
+}
+
+func (m *Modulation) Reset()         { *m = Modulation{} }
+func (m *Modulation) String() string { return proto.CompactTextString(m) }
+func (*Modulation) ProtoMessage()    {}
+
+type isModulation_Parameters interface {
+	isModulation_Parameters()
+}
+
+// Modulation_Lora contains the LoRa modulation parameters.
+type Modulation_Lora struct {
+	Lora *LoraModulationInfo `protobuf:"bytes,3,opt,name=lora,proto3,oneof"`
+}
+
+// Modulation_Fsk contains the FSK modulation parameters.
+type Modulation_Fsk struct {
+	Fsk *FskModulationInfo `protobuf:"bytes,4,opt,name=fsk,proto3,oneof"`
+}
+
+// Modulation_LrFhss contains the LR-FHSS modulation parameters.
+type Modulation_LrFhss struct {
+	LrFhss *LrFhssModulationInfo `protobuf:"bytes,5,opt,name=lr_fhss,json=lrFhss,proto3,oneof"`
+}
+
+func (*Modulation_Lora) isModulation_Parameters()   {}
+func (*Modulation_Fsk) isModulation_Parameters()    {}
+func (*Modulation_LrFhss) isModulation_Parameters() {}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*Modulation) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*Modulation_Lora)(nil),
+		(*Modulation_Fsk)(nil),
+		(*Modulation_LrFhss)(nil),
+	}
+}
+
+// GetLora returns the LoRa modulation parameters.
+func (m *Modulation) GetLora() *LoraModulationInfo {
+	if x, ok := m.GetParameters().(*Modulation_Lora); ok {
+		return x.Lora
+	}
+	return nil
+}
+
+// GetFsk returns the FSK modulation parameters.
+func (m *Modulation) GetFsk() *FskModulationInfo {
+	if x, ok := m.GetParameters().(*Modulation_Fsk); ok {
+		return x.Fsk
+	}
+	return nil
+}
+
+// GetLrFhss returns the LR-FHSS modulation parameters.
+func (m *Modulation) GetLrFhss() *LrFhssModulationInfo {
+	if x, ok := m.GetParameters().(*Modulation_LrFhss); ok {
+		return x.LrFhss
+	}
+	return nil
+}
+
+// GetParameters returns the modulation parameters.
+func (m *Modulation) GetParameters() isModulation_Parameters {
+	if m != nil {
+		return m.Parameters
+	}
+	return nil
+}
+
+// LoraModulationInfo contains the LoRa modulation parameters.
+type LoraModulationInfo struct {
+	// Bandwidth (Hz).
+	Bandwidth uint32 `protobuf:"varint,1,opt,name=bandwidth,proto3" json:"bandwidth,omitempty"`
+	// Spreading-factor.
+	SpreadingFactor uint32 `protobuf:"varint,2,opt,name=spreading_factor,json=spreadingFactor,proto3" json:"spreading_factor,omitempty"`
+	// Code-rate (v3 string notation, e.g. 4/5).
+	CodeRateLegacy string `protobuf:"bytes,3,opt,name=code_rate_legacy,json=codeRateLegacy,proto3" json:"code_rate_legacy,omitempty"`
+	// Code-rate.
+	CodeRate CodeRate `protobuf:"varint,5,opt,name=code_rate,json=codeRate,proto3,enum=gw.CodeRate" json:"code_rate,omitempty"`
+	// Polarization inversion.
+	PolarizationInversion bool `protobuf:"varint,4,opt,name=polarization_inversion,json=polarizationInversion,proto3" json:"polarization_inversion,omitempty"`
+}
+
+func (m *LoraModulationInfo) Reset()         { *m = LoraModulationInfo{} }
+func (m *LoraModulationInfo) String() string { return proto.CompactTextString(m) }
+func (*LoraModulationInfo) ProtoMessage()    {}
+
+// FskModulationInfo contains the FSK modulation parameters.
+type FskModulationInfo struct {
+	// Frequency deviation (Hz).
+	FrequencyDeviation uint32 `protobuf:"varint,1,opt,name=frequency_deviation,json=frequencyDeviation,proto3" json:"frequency_deviation,omitempty"`
+	// Bitrate (bit/s).
+	Datarate uint32 `protobuf:"varint,2,opt,name=datarate,proto3" json:"datarate,omitempty"`
+}
+
+func (m *FskModulationInfo) Reset()         { *m = FskModulationInfo{} }
+func (m *FskModulationInfo) String() string { return proto.CompactTextString(m) }
+func (*FskModulationInfo) ProtoMessage()    {}
+
+// LrFhssModulationInfo contains the LR-FHSS modulation parameters.
+type LrFhssModulationInfo struct {
+	// Operating channel width (OCW) in Hz.
+	OperatingChannelWidth uint32 `protobuf:"varint,1,opt,name=operating_channel_width,json=operatingChannelWidth,proto3" json:"operating_channel_width,omitempty"`
+	// Code-rate (v3 string notation, e.g. 2/6).
+	CodeRateLegacy string `protobuf:"bytes,2,opt,name=code_rate_legacy,json=codeRateLegacy,proto3" json:"code_rate_legacy,omitempty"`
+	// Hopping grid number of steps.
+	GridSteps uint32 `protobuf:"varint,3,opt,name=grid_steps,json=gridSteps,proto3" json:"grid_steps,omitempty"`
+	// Code-rate.
+	CodeRate CodeRate `protobuf:"varint,4,opt,name=code_rate,json=codeRate,proto3,enum=gw.CodeRate" json:"code_rate,omitempty"`
+}
+
+func (m *LrFhssModulationInfo) Reset()         { *m = LrFhssModulationInfo{} }
+func (m *LrFhssModulationInfo) String() string { return proto.CompactTextString(m) }
+func (*LrFhssModulationInfo) ProtoMessage()    {}
+
+// UplinkFrame contains an uplink frame.
+type UplinkFrame struct {
+	// PHYPayload.
+	PhyPayload []byte `protobuf:"bytes,1,opt,name=phy_payload,json=phyPayload,proto3" json:"phy_payload,omitempty"`
+	// TX meta-data (v3).
+	TxInfoLegacy *gw.UplinkTXInfo `protobuf:"bytes,2,opt,name=tx_info_legacy,json=txInfoLegacy,proto3" json:"tx_info_legacy,omitempty"`
+	// RX meta-data (v3).
+	RxInfoLegacy *gw.UplinkRXInfo `protobuf:"bytes,3,opt,name=rx_info_legacy,json=rxInfoLegacy,proto3" json:"rx_info_legacy,omitempty"`
+	// TX meta-data.
+	TxInfo *UplinkTxInfo `protobuf:"bytes,4,opt,name=tx_info,json=txInfo,proto3" json:"tx_info,omitempty"`
+	// RX meta-data.
+	RxInfo *UplinkRxInfo `protobuf:"bytes,5,opt,name=rx_info,json=rxInfo,proto3" json:"rx_info,omitempty"`
+}
+
+func (m *UplinkFrame) Reset()         { *m = UplinkFrame{} }
+func (m *UplinkFrame) String() string { return proto.CompactTextString(m) }
+func (*UplinkFrame) ProtoMessage()    {}
+
+// UplinkTxInfo contains the uplink TX meta-data.
+type UplinkTxInfo struct {
+	// Frequency (Hz).
+	Frequency uint32 `protobuf:"varint,1,opt,name=frequency,proto3" json:"frequency,omitempty"`
+	// Modulation.
+	Modulation *Modulation `protobuf:"bytes,2,opt,name=modulation,proto3" json:"modulation,omitempty"`
+}
+
+func (m *UplinkTxInfo) Reset()         { *m = UplinkTxInfo{} }
+func (m *UplinkTxInfo) String() string { return proto.CompactTextString(m) }
+func (*UplinkTxInfo) ProtoMessage()    {}
+
+// UplinkRxInfo contains the uplink RX meta-data.
+type UplinkRxInfo struct {
+	// Gateway ID (HEX encoded).
+	GatewayId string `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayId,proto3" json:"gateway_id,omitempty"`
+	// Uplink ID.
+	UplinkId uint32 `protobuf:"varint,2,opt,name=uplink_id,json=uplinkId,proto3" json:"uplink_id,omitempty"`
+	// RX time (only set when the gateway has a GPS time source).
+	Time *timestamp.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	// RX time since GPS epoch.
+	TimeSinceGpsEpoch *duration.Duration `protobuf:"bytes,4,opt,name=time_since_gps_epoch,json=timeSinceGpsEpoch,proto3" json:"time_since_gps_epoch,omitempty"`
+	// Fine-timestamp (nanosecond precision) since GPS epoch.
+	FineTimeSinceGpsEpoch *duration.Duration `protobuf:"bytes,5,opt,name=fine_time_since_gps_epoch,json=fineTimeSinceGpsEpoch,proto3" json:"fine_time_since_gps_epoch,omitempty"`
+	// RSSI.
+	Rssi int32 `protobuf:"varint,6,opt,name=rssi,proto3" json:"rssi,omitempty"`
+	// SNR.
+	Snr float32 `protobuf:"fixed32,7,opt,name=snr,proto3" json:"snr,omitempty"`
+	// Channel.
+	Channel uint32 `protobuf:"varint,8,opt,name=channel,proto3" json:"channel,omitempty"`
+	// RF chain.
+	RfChain uint32 `protobuf:"varint,9,opt,name=rf_chain,json=rfChain,proto3" json:"rf_chain,omitempty"`
+	// Board.
+	Board uint32 `protobuf:"varint,10,opt,name=board,proto3" json:"board,omitempty"`
+	// Antenna.
+	Antenna uint32 `protobuf:"varint,11,opt,name=antenna,proto3" json:"antenna,omitempty"`
+	// Location.
+	Location *common.Location `protobuf:"bytes,12,opt,name=location,proto3" json:"location,omitempty"`
+	// Gateway specific context.
+	Context []byte `protobuf:"bytes,13,opt,name=context,proto3" json:"context,omitempty"`
+	// Additional gateway meta-data.
+	Metadata map[string]string `protobuf:"bytes,15,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *UplinkRxInfo) Reset()         { *m = UplinkRxInfo{} }
+func (m *UplinkRxInfo) String() string { return proto.CompactTextString(m) }
+func (*UplinkRxInfo) ProtoMessage()    {}
+
+// DownlinkFrame contains a downlink frame, containing one or multiple items
+// (e.g. for the RX1 and RX2 receive-windows). The gateway attempts the items
+// in order, until an item is accepted.
+type DownlinkFrame struct {
+	// Downlink ID.
+	DownlinkId uint32 `protobuf:"varint,3,opt,name=downlink_id,json=downlinkId,proto3" json:"downlink_id,omitempty"`
+	// Downlink ID (v3 UUID).
+	DownlinkIdLegacy []byte `protobuf:"bytes,4,opt,name=downlink_id_legacy,json=downlinkIdLegacy,proto3" json:"downlink_id_legacy,omitempty"`
+	// Downlink frame items.
+	Items []*DownlinkFrameItem `protobuf:"bytes,5,rep,name=items,proto3" json:"items,omitempty"`
+	// Gateway ID (v3 bytes).
+	GatewayIdLegacy []byte `protobuf:"bytes,6,opt,name=gateway_id_legacy,json=gatewayIdLegacy,proto3" json:"gateway_id_legacy,omitempty"`
+	// Gateway ID (HEX encoded).
+	GatewayId string `protobuf:"bytes,7,opt,name=gateway_id,json=gatewayId,proto3" json:"gateway_id,omitempty"`
+}
+
+func (m *DownlinkFrame) Reset()         { *m = DownlinkFrame{} }
+func (m *DownlinkFrame) String() string { return proto.CompactTextString(m) }
+func (*DownlinkFrame) ProtoMessage()    {}
+
+// DownlinkFrameItem contains a downlink frame item.
+type DownlinkFrameItem struct {
+	// PHYPayload.
+	PhyPayload []byte `protobuf:"bytes,1,opt,name=phy_payload,json=phyPayload,proto3" json:"phy_payload,omitempty"`
+	// TX meta-data (v3).
+	TxInfoLegacy *gw.DownlinkTXInfo `protobuf:"bytes,2,opt,name=tx_info_legacy,json=txInfoLegacy,proto3" json:"tx_info_legacy,omitempty"`
+	// TX meta-data.
+	TxInfo *DownlinkTxInfo `protobuf:"bytes,3,opt,name=tx_info,json=txInfo,proto3" json:"tx_info,omitempty"`
+}
+
+func (m *DownlinkFrameItem) Reset()         { *m = DownlinkFrameItem{} }
+func (m *DownlinkFrameItem) String() string { return proto.CompactTextString(m) }
+func (*DownlinkFrameItem) ProtoMessage()    {}
+
+// DownlinkTxInfo contains the downlink TX meta-data.
+type DownlinkTxInfo struct {
+	// Frequency (Hz).
+	Frequency uint32 `protobuf:"varint,1,opt,name=frequency,proto3" json:"frequency,omitempty"`
+	// TX power (dBm EIRP).
+	Power int32 `protobuf:"varint,2,opt,name=power,proto3" json:"power,omitempty"`
+	// Modulation.
+	Modulation *Modulation `protobuf:"bytes,3,opt,name=modulation,proto3" json:"modulation,omitempty"`
+	// Board.
+	Board uint32 `protobuf:"varint,4,opt,name=board,proto3" json:"board,omitempty"`
+	// Antenna.
+	Antenna uint32 `protobuf:"varint,5,opt,name=antenna,proto3" json:"antenna,omitempty"`
+	// Timing.
+	Timing *Timing `protobuf:"bytes,6,opt,name=timing,proto3" json:"timing,omitempty"`
+	// Gateway specific context.
+	Context []byte `protobuf:"bytes,7,opt,name=context,proto3" json:"context,omitempty"`
+}
+
+func (m *DownlinkTxInfo) Reset()         { *m = DownlinkTxInfo{} }
+func (m *DownlinkTxInfo) String() string { return proto.CompactTextString(m) }
+func (*DownlinkTxInfo) ProtoMessage()    {}
+
+// Timing contains the downlink timing parameters.
+type Timing struct {
+	// Types that are valid to be assigned to Parameters:
+	//	*Timing_Immediately
+	//	*Timing_Delay
+	//	*Timing_GpsEpoch
+	Parameters isTiming_Parameters `protobuf_oneof:"parameters"`
+}
+
+func (m *Timing) Reset()         { *m = Timing{} }
+func (m *Timing) String() string { return proto.CompactTextString(m) }
+func (*Timing) ProtoMessage()    {}
+
+type isTiming_Parameters interface {
+	isTiming_Parameters()
+}
+
+// Timing_Immediately contains the immediately timing parameters.
+type Timing_Immediately struct {
+	Immediately *ImmediatelyTimingInfo `protobuf:"bytes,1,opt,name=immediately,proto3,oneof"`
+}
+
+// Timing_Delay contains the delay timing parameters.
+type Timing_Delay struct {
+	Delay *DelayTimingInfo `protobuf:"bytes,2,opt,name=delay,proto3,oneof"`
+}
+
+// Timing_GpsEpoch contains the GPS epoch timing parameters.
+type Timing_GpsEpoch struct {
+	GpsEpoch *GPSEpochTimingInfo `protobuf:"bytes,3,opt,name=gps_epoch,json=gpsEpoch,proto3,oneof"`
+}
+
+func (*Timing_Immediately) isTiming_Parameters() {}
+func (*Timing_Delay) isTiming_Parameters()       {}
+func (*Timing_GpsEpoch) isTiming_Parameters()    {}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*Timing) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*Timing_Immediately)(nil),
+		(*Timing_Delay)(nil),
+		(*Timing_GpsEpoch)(nil),
+	}
+}
+
+// GetParameters returns the timing parameters.
+func (m *Timing) GetParameters() isTiming_Parameters {
+	if m != nil {
+		return m.Parameters
+	}
+	return nil
+}
+
+// ImmediatelyTimingInfo contains the immediately timing parameters.
+type ImmediatelyTimingInfo struct{}
+
+func (m *ImmediatelyTimingInfo) Reset()         { *m = ImmediatelyTimingInfo{} }
+func (m *ImmediatelyTimingInfo) String() string { return proto.CompactTextString(m) }
+func (*ImmediatelyTimingInfo) ProtoMessage()    {}
+
+// DelayTimingInfo contains the delay timing parameters.
+type DelayTimingInfo struct {
+	// Delay relative to the RX time of the uplink (context).
+	Delay *duration.Duration `protobuf:"bytes,1,opt,name=delay,proto3" json:"delay,omitempty"`
+}
+
+func (m *DelayTimingInfo) Reset()         { *m = DelayTimingInfo{} }
+func (m *DelayTimingInfo) String() string { return proto.CompactTextString(m) }
+func (*DelayTimingInfo) ProtoMessage()    {}
+
+// GPSEpochTimingInfo contains the GPS epoch timing parameters.
+type GPSEpochTimingInfo struct {
+	// Duration since GPS epoch.
+	TimeSinceGpsEpoch *duration.Duration `protobuf:"bytes,1,opt,name=time_since_gps_epoch,json=timeSinceGpsEpoch,proto3" json:"time_since_gps_epoch,omitempty"`
+}
+
+func (m *GPSEpochTimingInfo) Reset()         { *m = GPSEpochTimingInfo{} }
+func (m *GPSEpochTimingInfo) String() string { return proto.CompactTextString(m) }
+func (*GPSEpochTimingInfo) ProtoMessage()    {}
+
+// DownlinkTxAck contains the downlink TX acknowledgement.
+type DownlinkTxAck struct {
+	// Gateway ID (v3 bytes).
+	GatewayIdLegacy []byte `protobuf:"bytes,1,opt,name=gateway_id_legacy,json=gatewayIdLegacy,proto3" json:"gateway_id_legacy,omitempty"`
+	// Gateway ID (HEX encoded).
+	GatewayId string `protobuf:"bytes,6,opt,name=gateway_id,json=gatewayId,proto3" json:"gateway_id,omitempty"`
+	// Downlink ID.
+	DownlinkId uint32 `protobuf:"varint,2,opt,name=downlink_id,json=downlinkId,proto3" json:"downlink_id,omitempty"`
+	// Downlink ID (v3 UUID).
+	DownlinkIdLegacy []byte `protobuf:"bytes,4,opt,name=downlink_id_legacy,json=downlinkIdLegacy,proto3" json:"downlink_id_legacy,omitempty"`
+	// Status per downlink frame item.
+	Items []*DownlinkTxAckItem `protobuf:"bytes,5,rep,name=items,proto3" json:"items,omitempty"`
+	// Time on air of the transmitted item (not part of the v4 definitions).
+	Airtime *duration.Duration `protobuf:"bytes,101,opt,name=airtime,proto3" json:"airtime,omitempty"`
+	// TX frequency of the transmitted item in Hz (not part of the v4
+	// definitions).
+	Frequency uint32 `protobuf:"varint,102,opt,name=frequency,proto3" json:"frequency,omitempty"`
+	// TX power of the transmitted item in dBm EIRP (not part of the v4
+	// definitions).
+	Power int32 `protobuf:"varint,103,opt,name=power,proto3" json:"power,omitempty"`
+}
+
+func (m *DownlinkTxAck) Reset()         { *m = DownlinkTxAck{} }
+func (m *DownlinkTxAck) String() string { return proto.CompactTextString(m) }
+func (*DownlinkTxAck) ProtoMessage()    {}
+
+// DownlinkTxAckItem contains the status of a downlink frame item.
+type DownlinkTxAckItem struct {
+	// Status.
+	Status TxAckStatus `protobuf:"varint,1,opt,name=status,proto3,enum=gw.TxAckStatus" json:"status,omitempty"`
+}
+
+func (m *DownlinkTxAckItem) Reset()         { *m = DownlinkTxAckItem{} }
+func (m *DownlinkTxAckItem) String() string { return proto.CompactTextString(m) }
+func (*DownlinkTxAckItem) ProtoMessage()    {}
+
+// GatewayStats contains the gateway statistics.
+type GatewayStats struct {
+	// Gateway ID (v3 bytes).
+	GatewayIdLegacy []byte `protobuf:"bytes,1,opt,name=gateway_id_legacy,json=gatewayIdLegacy,proto3" json:"gateway_id_legacy,omitempty"`
+	// Gateway ID (HEX encoded).
+	GatewayId string `protobuf:"bytes,17,opt,name=gateway_id,json=gatewayId,proto3" json:"gateway_id,omitempty"`
+	// Gateway time.
+	Time *timestamp.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Gateway location.
+	Location *common.Location `protobuf:"bytes,3,opt,name=location,proto3" json:"location,omitempty"`
+	// Gateway configuration version.
+	ConfigVersion string `protobuf:"bytes,4,opt,name=config_version,json=configVersion,proto3" json:"config_version,omitempty"`
+	// Number of radio packets received.
+	RxPacketsReceived uint32 `protobuf:"varint,5,opt,name=rx_packets_received,json=rxPacketsReceived,proto3" json:"rx_packets_received,omitempty"`
+	// Number of radio packets received with valid PHY CRC.
+	RxPacketsReceivedOk uint32 `protobuf:"varint,6,opt,name=rx_packets_received_ok,json=rxPacketsReceivedOk,proto3" json:"rx_packets_received_ok,omitempty"`
+	// Number of downlink packets received for transmission.
+	TxPacketsReceived uint32 `protobuf:"varint,7,opt,name=tx_packets_received,json=txPacketsReceived,proto3" json:"tx_packets_received,omitempty"`
+	// Number of downlink packets emitted.
+	TxPacketsEmitted uint32 `protobuf:"varint,8,opt,name=tx_packets_emitted,json=txPacketsEmitted,proto3" json:"tx_packets_emitted,omitempty"`
+	// Additional gateway meta-data.
+	MetaData map[string]string `protobuf:"bytes,10,rep,name=meta_data,json=metaData,proto3" json:"meta_data,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *GatewayStats) Reset()         { *m = GatewayStats{} }
+func (m *GatewayStats) String() string { return proto.CompactTextString(m) }
+func (*GatewayStats) ProtoMessage()    {}
@@ -0,0 +1,406 @@
+package gwv4
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/ism2400"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/timesync"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
+)
+
+var codeRates = map[string]CodeRate{
+	"4/5": CodeRate_CR_4_5,
+	"4/6": CodeRate_CR_4_6,
+	"4/7": CodeRate_CR_4_7,
+	"4/8": CodeRate_CR_4_8,
+	"3/8": CodeRate_CR_3_8,
+	"2/6": CodeRate_CR_2_6,
+	"1/4": CodeRate_CR_1_4,
+	"1/6": CodeRate_CR_1_6,
+	"5/6": CodeRate_CR_5_6,
+
+	// long-interleaving code-rates (LoRa 2.4 GHz)
+	"4/5LI": CodeRate_CR_LI_4_5,
+	"4/6LI": CodeRate_CR_LI_4_6,
+	"4/8LI": CodeRate_CR_LI_4_8,
+}
+
+// txAck is implemented by the gw.DownlinkTXAck message and the extended
+// TX acknowledgement published by the forwarder.
+type txAck interface {
+	GetGatewayId() []byte
+	GetDownlinkId() []byte
+	GetError() string
+}
+
+// itemTXAck is implemented by TX acknowledgements containing the index of
+// the acknowledged item, the errors of the previous (rejected) items and
+// the number of items of the downlink.
+type itemTXAck interface {
+	GetItemIndex() uint32
+	GetItemErrors() []string
+	GetItemCount() uint32
+}
+
+// txInfoTXAck is implemented by TX acknowledgements containing the TX
+// meta-data of the transmitted item.
+type txInfoTXAck interface {
+	GetAirtime() *duration.Duration
+	GetFrequency() uint32
+	GetPower() int32
+}
+
+// UplinkFrameFromV3 returns the v4 UplinkFrame for the given v3 UplinkFrame.
+// The v3 TX and RX meta-data are included as legacy fields.
+func UplinkFrameFromV3(in gw.UplinkFrame) (UplinkFrame, error) {
+	out := UplinkFrame{
+		PhyPayload:   in.PhyPayload,
+		TxInfoLegacy: in.TxInfo,
+		RxInfoLegacy: in.RxInfo,
+	}
+
+	if txInfo := in.GetTxInfo(); txInfo != nil {
+		out.TxInfo = &UplinkTxInfo{
+			Frequency: txInfo.GetFrequency(),
+		}
+
+		if modInfo := txInfo.GetLoraModulationInfo(); modInfo != nil {
+			out.TxInfo.Modulation = loraModulationFromV3(modInfo)
+		}
+		if modInfo := txInfo.GetFskModulationInfo(); modInfo != nil {
+			out.TxInfo.Modulation = fskModulationFromV3(modInfo)
+		}
+		if modInfo := lrfhss.GetUplinkModulationInfo(txInfo); modInfo != nil {
+			out.TxInfo.Modulation = lrFHSSModulationFromV3(modInfo)
+		}
+	}
+
+	if rxInfo := in.GetRxInfo(); rxInfo != nil {
+		out.RxInfo = &UplinkRxInfo{
+			GatewayId:         hex.EncodeToString(rxInfo.GetGatewayId()),
+			UplinkId:          idFromUUID(rxInfo.GetUplinkId()),
+			Time:              rxInfo.GetTime(),
+			TimeSinceGpsEpoch: rxInfo.GetTimeSinceGpsEpoch(),
+			Rssi:              rxInfo.GetRssi(),
+			Snr:               float32(rxInfo.GetLoraSnr()),
+			Channel:           rxInfo.GetChannel(),
+			RfChain:           rxInfo.GetRfChain(),
+			Board:             rxInfo.GetBoard(),
+			Antenna:           rxInfo.GetAntenna(),
+			Location:          rxInfo.GetLocation(),
+			Context:           rxInfo.GetContext(),
+		}
+
+		if ts := rxInfo.GetPlainFineTimestamp().GetTime(); ts != nil {
+			t, err := ptypes.Timestamp(ts)
+			if err != nil {
+				return out, errors.Wrap(err, "parse fine-timestamp error")
+			}
+			out.RxInfo.FineTimeSinceGpsEpoch = ptypes.DurationProto(gps.Time(t).TimeSinceGPSEpoch())
+		}
+
+		// the estimated gateway clock offset, if available
+		var gatewayID lorawan.EUI64
+		copy(gatewayID[:], rxInfo.GetGatewayId())
+		out.RxInfo.Metadata = timesync.GetMetaData(gatewayID)
+	}
+
+	return out, nil
+}
+
+// GatewayStatsFromV3 returns the v4 GatewayStats for the given v3
+// GatewayStats.
+func GatewayStatsFromV3(in gw.GatewayStats) GatewayStats {
+	return GatewayStats{
+		GatewayIdLegacy:     in.GatewayId,
+		GatewayId:           hex.EncodeToString(in.GatewayId),
+		Time:                in.Time,
+		Location:            in.Location,
+		ConfigVersion:       in.ConfigVersion,
+		RxPacketsReceived:   in.RxPacketsReceived,
+		RxPacketsReceivedOk: in.RxPacketsReceivedOk,
+		TxPacketsReceived:   in.TxPacketsReceived,
+		TxPacketsEmitted:    in.TxPacketsEmitted,
+		MetaData:            in.MetaData,
+	}
+}
+
+// downlinkTxAckFromV3 returns the v4 DownlinkTxAck for the given v3 TX
+// acknowledgement. It contains the status of the acknowledged item, of the
+// items attempted before and of the items which were not attempted.
+func downlinkTxAckFromV3(in txAck) DownlinkTxAck {
+	out := DownlinkTxAck{
+		GatewayIdLegacy:  in.GetGatewayId(),
+		GatewayId:        hex.EncodeToString(in.GetGatewayId()),
+		DownlinkId:       idFromUUID(in.GetDownlinkId()),
+		DownlinkIdLegacy: in.GetDownlinkId(),
+	}
+
+	if ack, ok := in.(txInfoTXAck); ok {
+		out.Airtime = ack.GetAirtime()
+		out.Frequency = ack.GetFrequency()
+		out.Power = ack.GetPower()
+	}
+
+	var itemIndex, itemCount uint32
+	var itemErrors []string
+	if ack, ok := in.(itemTXAck); ok {
+		itemIndex = ack.GetItemIndex()
+		itemErrors = ack.GetItemErrors()
+		itemCount = ack.GetItemCount()
+	}
+
+	for i := uint32(0); i <= itemIndex; i++ {
+		var status TxAckStatus
+		if i < itemIndex {
+			status = TxAckStatus_INTERNAL_ERROR
+			if int(i) < len(itemErrors) {
+				status = txAckStatus(itemErrors[i])
+			}
+		} else {
+			status = txAckStatus(in.GetError())
+		}
+
+		out.Items = append(out.Items, &DownlinkTxAckItem{Status: status})
+	}
+
+	for i := itemIndex + 1; i < itemCount; i++ {
+		out.Items = append(out.Items, &DownlinkTxAckItem{Status: TxAckStatus_IGNORED})
+	}
+
+	return out
+}
+
+// DownlinkFrameToV3 returns a v3 DownlinkFrame for each item of the given
+// v4 DownlinkFrame.
+func DownlinkFrameToV3(in DownlinkFrame) ([]gw.DownlinkFrame, error) {
+	gatewayID := in.GatewayIdLegacy
+	if in.GatewayId != "" {
+		var err error
+		gatewayID, err = hex.DecodeString(in.GatewayId)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode gateway id error")
+		}
+	}
+
+	downlinkID := in.DownlinkIdLegacy
+	if len(downlinkID) == 0 {
+		downlinkID = uuidFromID(in.DownlinkId)
+	}
+
+	var out []gw.DownlinkFrame
+	for i, item := range in.Items {
+		if item == nil {
+			return nil, fmt.Errorf("item %d: item must not be empty", i)
+		}
+
+		txInfo := item.TxInfoLegacy
+		if item.TxInfo != nil {
+			var err error
+			txInfo, err = downlinkTXInfoToV3(item.TxInfo)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d error", i)
+			}
+		}
+		if txInfo == nil {
+			return nil, fmt.Errorf("item %d: tx_info must be set", i)
+		}
+		txInfo.GatewayId = gatewayID
+
+		out = append(out, gw.DownlinkFrame{
+			PhyPayload: item.PhyPayload,
+			TxInfo:     txInfo,
+			DownlinkId: downlinkID,
+		})
+	}
+
+	return out, nil
+}
+
+func downlinkTXInfoToV3(in *DownlinkTxInfo) (*gw.DownlinkTXInfo, error) {
+	out := gw.DownlinkTXInfo{
+		Frequency: in.Frequency,
+		Power:     in.Power,
+		Board:     in.Board,
+		Antenna:   in.Antenna,
+		Context:   in.Context,
+	}
+
+	switch v := in.Modulation.GetParameters().(type) {
+	case *Modulation_Lora:
+		if v.Lora == nil {
+			return nil, errors.New("lora modulation parameters must be set")
+		}
+
+		codeRate := v.Lora.CodeRateLegacy
+		if codeRate == "" {
+			codeRate = codeRateToV3(v.Lora.CodeRate)
+		}
+
+		out.Modulation = common.Modulation_LORA
+		out.ModulationInfo = &gw.DownlinkTXInfo_LoraModulationInfo{
+			LoraModulationInfo: &gw.LoRaModulationInfo{
+				Bandwidth:             ism2400.BandwidthKHz(v.Lora.Bandwidth),
+				SpreadingFactor:       v.Lora.SpreadingFactor,
+				CodeRate:              codeRate,
+				PolarizationInversion: v.Lora.PolarizationInversion,
+			},
+		}
+	case *Modulation_Fsk:
+		if v.Fsk == nil {
+			return nil, errors.New("fsk modulation parameters must be set")
+		}
+
+		out.Modulation = common.Modulation_FSK
+		out.ModulationInfo = &gw.DownlinkTXInfo_FskModulationInfo{
+			FskModulationInfo: &gw.FSKModulationInfo{
+				FrequencyDeviation: v.Fsk.FrequencyDeviation,
+				Datarate:           v.Fsk.Datarate,
+			},
+		}
+	case *Modulation_LrFhss:
+		if v.LrFhss == nil {
+			return nil, errors.New("lr-fhss modulation parameters must be set")
+		}
+
+		codeRate := v.LrFhss.CodeRateLegacy
+		if codeRate == "" {
+			codeRate = codeRateToV3(v.LrFhss.CodeRate)
+		}
+
+		if err := lrfhss.SetDownlinkModulationInfo(&out, &lrfhss.ModulationInfo{
+			OperatingChannelWidth: v.LrFhss.OperatingChannelWidth,
+			CodeRate:              codeRate,
+			GridSteps:             v.LrFhss.GridSteps,
+		}); err != nil {
+			return nil, errors.Wrap(err, "set lr-fhss modulation info error")
+		}
+	default:
+		return nil, errors.New("modulation must be set")
+	}
+
+	switch v := in.Timing.GetParameters().(type) {
+	case *Timing_Immediately:
+		out.Timing = gw.DownlinkTiming_IMMEDIATELY
+		out.TimingInfo = &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+			ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+		}
+	case *Timing_Delay:
+		if v.Delay == nil {
+			return nil, errors.New("delay timing parameters must be set")
+		}
+
+		out.Timing = gw.DownlinkTiming_DELAY
+		out.TimingInfo = &gw.DownlinkTXInfo_DelayTimingInfo{
+			DelayTimingInfo: &gw.DelayTimingInfo{
+				Delay: v.Delay.Delay,
+			},
+		}
+	case *Timing_GpsEpoch:
+		if v.GpsEpoch == nil {
+			return nil, errors.New("gps epoch timing parameters must be set")
+		}
+
+		out.Timing = gw.DownlinkTiming_GPS_EPOCH
+		out.TimingInfo = &gw.DownlinkTXInfo_GpsEpochTimingInfo{
+			GpsEpochTimingInfo: &gw.GPSEpochTimingInfo{
+				TimeSinceGpsEpoch: v.GpsEpoch.TimeSinceGpsEpoch,
+			},
+		}
+	default:
+		return nil, errors.New("timing must be set")
+	}
+
+	return &out, nil
+}
+
+func loraModulationFromV3(in *gw.LoRaModulationInfo) *Modulation {
+	return &Modulation{
+		Parameters: &Modulation_Lora{
+			Lora: &LoraModulationInfo{
+				Bandwidth:             ism2400.BandwidthHz(in.GetBandwidth()),
+				SpreadingFactor:       in.GetSpreadingFactor(),
+				CodeRateLegacy:        in.GetCodeRate(),
+				CodeRate:              codeRates[in.GetCodeRate()],
+				PolarizationInversion: in.GetPolarizationInversion(),
+			},
+		},
+	}
+}
+
+func fskModulationFromV3(in *gw.FSKModulationInfo) *Modulation {
+	return &Modulation{
+		Parameters: &Modulation_Fsk{
+			Fsk: &FskModulationInfo{
+				FrequencyDeviation: in.GetFrequencyDeviation(),
+				Datarate:           in.GetDatarate(),
+			},
+		},
+	}
+}
+
+func lrFHSSModulationFromV3(in *lrfhss.ModulationInfo) *Modulation {
+	return &Modulation{
+		Parameters: &Modulation_LrFhss{
+			LrFhss: &LrFhssModulationInfo{
+				OperatingChannelWidth: in.GetOperatingChannelWidth(),
+				CodeRateLegacy:        in.GetCodeRate(),
+				CodeRate:              codeRates[in.GetCodeRate()],
+				GridSteps:             in.GetGridSteps(),
+			},
+		},
+	}
+}
+
+// codeRateToV3 returns the v3 string notation of the given code-rate.
+func codeRateToV3(codeRate CodeRate) string {
+	for k, cr := range codeRates {
+		if cr == codeRate {
+			return k
+		}
+	}
+	return ""
+}
+
+// txAckStatus returns the TX acknowledgement status for the given v3 error.
+// Errors which are not defined by v4 (e.g. DUTY_CYCLE_OVERFLOW) are mapped
+// to INTERNAL_ERROR.
+func txAckStatus(err string) TxAckStatus {
+	if err == "" {
+		return TxAckStatus_OK
+	}
+	if v, ok := TxAckStatus_value[err]; ok {
+		return TxAckStatus(v)
+	}
+	return TxAckStatus_INTERNAL_ERROR
+}
+
+// idFromUUID returns the v4 (uint32) ID for the given v3 (UUID) ID. This is
+// the first four bytes of the UUID.
+func idFromUUID(b []byte) uint32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// uuidFromID returns the v3 (UUID) ID for the given v4 (uint32) ID, such
+// that idFromUUID returns the original ID.
+func uuidFromID(id uint32) []byte {
+	if id == 0 {
+		return nil
+	}
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint32(b, id)
+	return b
+}
@@ -0,0 +1,475 @@
+package gwv4
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
+)
+
+type testItemTXAck struct {
+	gw.DownlinkTXAck
+	itemIndex  uint32
+	itemErrors []string
+	itemCount  uint32
+}
+
+func (a *testItemTXAck) GetItemIndex() uint32    { return a.itemIndex }
+func (a *testItemTXAck) GetItemErrors() []string { return a.itemErrors }
+func (a *testItemTXAck) GetItemCount() uint32    { return a.itemCount }
+
+type testTXInfoTXAck struct {
+	gw.DownlinkTXAck
+	airtime   *duration.Duration
+	frequency uint32
+	power     int32
+}
+
+func (a *testTXInfoTXAck) GetAirtime() *duration.Duration { return a.airtime }
+func (a *testTXInfoTXAck) GetFrequency() uint32           { return a.frequency }
+func (a *testTXInfoTXAck) GetPower() int32                { return a.power }
+
+func TestUplinkFrameFromV3(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 600, time.UTC)
+	nowPB, _ := ptypes.TimestampProto(now)
+
+	in := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.UplinkTXInfo{
+			Frequency:  868100000,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:             125,
+					SpreadingFactor:       12,
+					CodeRate:              "4/5",
+					PolarizationInversion: true,
+				},
+			},
+		},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId:         []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			UplinkId:          []byte{0, 0, 1, 2, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			Time:              nowPB,
+			TimeSinceGpsEpoch: ptypes.DurationProto(time.Hour),
+			Rssi:              -120,
+			LoraSnr:           -7.25,
+			Channel:           2,
+			Context:           []byte{1, 2, 3, 4},
+			FineTimestampType: gw.FineTimestampType_PLAIN,
+			FineTimestamp: &gw.UplinkRXInfo_PlainFineTimestamp{
+				PlainFineTimestamp: &gw.PlainFineTimestamp{
+					Time: nowPB,
+				},
+			},
+		},
+	}
+
+	out, err := UplinkFrameFromV3(in)
+	assert.NoError(err)
+
+	assert.Equal(in.TxInfo, out.TxInfoLegacy)
+	assert.Equal(in.RxInfo, out.RxInfoLegacy)
+	assert.Equal(&UplinkTxInfo{
+		Frequency: 868100000,
+		Modulation: &Modulation{
+			Parameters: &Modulation_Lora{
+				Lora: &LoraModulationInfo{
+					Bandwidth:             125000,
+					SpreadingFactor:       12,
+					CodeRateLegacy:        "4/5",
+					CodeRate:              CodeRate_CR_4_5,
+					PolarizationInversion: true,
+				},
+			},
+		},
+	}, out.TxInfo)
+
+	assert.Equal("0102030405060708", out.RxInfo.GatewayId)
+	assert.Equal(uint32(258), out.RxInfo.UplinkId)
+	assert.Equal(nowPB, out.RxInfo.Time)
+	assert.Equal(float32(-7.25), out.RxInfo.Snr)
+	assert.Equal(uint32(2), out.RxInfo.Channel)
+
+	fine, err := ptypes.Duration(out.RxInfo.FineTimeSinceGpsEpoch)
+	assert.NoError(err)
+	assert.Equal(600, int(fine%time.Second))
+}
+
+func TestUplinkFrameFromV3LRFHSS(t *testing.T) {
+	assert := require.New(t)
+
+	in := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.UplinkTXInfo{
+			Frequency: 868100000,
+		},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+	}
+	assert.NoError(lrfhss.SetUplinkModulationInfo(in.TxInfo, &lrfhss.ModulationInfo{
+		OperatingChannelWidth: 137000,
+		CodeRate:              "2/6",
+		GridSteps:             8,
+	}))
+
+	out, err := UplinkFrameFromV3(in)
+	assert.NoError(err)
+	assert.Equal(&Modulation{
+		Parameters: &Modulation_LrFhss{
+			LrFhss: &LrFhssModulationInfo{
+				OperatingChannelWidth: 137000,
+				CodeRateLegacy:        "2/6",
+				CodeRate:              CodeRate_CR_2_6,
+				GridSteps:             8,
+			},
+		},
+	}, out.TxInfo.Modulation)
+}
+
+func TestDownlinkTxAckFromV3(t *testing.T) {
+	gatewayID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	downID := []byte{0, 0, 0, 1, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	tests := []struct {
+		Name          string
+		In            txAck
+		ExpectedItems []TxAckStatus
+	}{
+		{
+			Name: "ok",
+			In: &gw.DownlinkTXAck{
+				GatewayId:  gatewayID,
+				DownlinkId: downID,
+			},
+			ExpectedItems: []TxAckStatus{TxAckStatus_OK},
+		},
+		{
+			Name: "error",
+			In: &gw.DownlinkTXAck{
+				GatewayId:  gatewayID,
+				DownlinkId: downID,
+				Error:      "TOO_LATE",
+			},
+			ExpectedItems: []TxAckStatus{TxAckStatus_TOO_LATE},
+		},
+		{
+			Name: "v3 only error",
+			In: &gw.DownlinkTXAck{
+				GatewayId:  gatewayID,
+				DownlinkId: downID,
+				Error:      "DUTY_CYCLE_OVERFLOW",
+			},
+			ExpectedItems: []TxAckStatus{TxAckStatus_INTERNAL_ERROR},
+		},
+		{
+			Name: "second item ok",
+			In: &testItemTXAck{
+				DownlinkTXAck: gw.DownlinkTXAck{
+					GatewayId:  gatewayID,
+					DownlinkId: downID,
+				},
+				itemIndex:  1,
+				itemErrors: []string{"COLLISION_BEACON"},
+			},
+			ExpectedItems: []TxAckStatus{TxAckStatus_COLLISION_BEACON, TxAckStatus_OK},
+		},
+		{
+			Name: "first item ok, second item ignored",
+			In: &testItemTXAck{
+				DownlinkTXAck: gw.DownlinkTXAck{
+					GatewayId:  gatewayID,
+					DownlinkId: downID,
+				},
+				itemIndex: 0,
+				itemCount: 2,
+			},
+			ExpectedItems: []TxAckStatus{TxAckStatus_OK, TxAckStatus_IGNORED},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			out := downlinkTxAckFromV3(tst.In)
+			assert.Equal(gatewayID, out.GatewayIdLegacy)
+			assert.Equal("0102030405060708", out.GatewayId)
+			assert.Equal(uint32(1), out.DownlinkId)
+			assert.Equal(downID, out.DownlinkIdLegacy)
+
+			var items []TxAckStatus
+			for _, item := range out.Items {
+				items = append(items, item.Status)
+			}
+			assert.Equal(tst.ExpectedItems, items)
+		})
+	}
+}
+
+func TestDownlinkTxAckFromV3TXInfo(t *testing.T) {
+	assert := require.New(t)
+
+	in := testTXInfoTXAck{
+		DownlinkTXAck: gw.DownlinkTXAck{
+			GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		airtime:   ptypes.DurationProto(time.Second),
+		frequency: 868100000,
+		power:     14,
+	}
+
+	out := downlinkTxAckFromV3(&in)
+	assert.Equal(ptypes.DurationProto(time.Second), out.Airtime)
+	assert.Equal(uint32(868100000), out.Frequency)
+	assert.Equal(int32(14), out.Power)
+}
+
+func TestDownlinkFrameToV3LRFHSS(t *testing.T) {
+	assert := require.New(t)
+
+	out, err := DownlinkFrameToV3(DownlinkFrame{
+		DownlinkId: 1,
+		GatewayId:  "0102030405060708",
+		Items: []*DownlinkFrameItem{
+			{
+				PhyPayload: []byte{1, 2, 3},
+				TxInfo: &DownlinkTxInfo{
+					Frequency: 868100000,
+					Power:     14,
+					Modulation: &Modulation{
+						Parameters: &Modulation_LrFhss{
+							LrFhss: &LrFhssModulationInfo{
+								OperatingChannelWidth: 137000,
+								CodeRate:              CodeRate_CR_2_6,
+								GridSteps:             52,
+							},
+						},
+					},
+					Timing: &Timing{
+						Parameters: &Timing_Immediately{
+							Immediately: &ImmediatelyTimingInfo{},
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(err)
+	assert.Len(out, 1)
+	assert.Equal(lrfhss.Modulation, out[0].TxInfo.Modulation)
+	assert.Equal(&lrfhss.ModulationInfo{
+		OperatingChannelWidth: 137000,
+		CodeRate:              "2/6",
+		GridSteps:             52,
+	}, lrfhss.GetDownlinkModulationInfo(out[0].TxInfo))
+}
+
+func TestDownlinkFrameToV3(t *testing.T) {
+	legacyTXInfo := gw.DownlinkTXInfo{
+		Frequency:  869525000,
+		Power:      27,
+		Modulation: common.Modulation_LORA,
+		ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+			LoraModulationInfo: &gw.LoRaModulationInfo{
+				Bandwidth:             125,
+				SpreadingFactor:       12,
+				CodeRate:              "4/5",
+				PolarizationInversion: true,
+			},
+		},
+		Timing: gw.DownlinkTiming_IMMEDIATELY,
+		TimingInfo: &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+			ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+		},
+	}
+
+	tests := []struct {
+		Name          string
+		In            DownlinkFrame
+		Expected      []gw.DownlinkFrame
+		ExpectedError string
+	}{
+		{
+			Name: "two items",
+			In: DownlinkFrame{
+				DownlinkId: 1,
+				GatewayId:  "0102030405060708",
+				Items: []*DownlinkFrameItem{
+					{
+						PhyPayload: []byte{1, 2, 3},
+						TxInfo: &DownlinkTxInfo{
+							Frequency: 868100000,
+							Power:     14,
+							Modulation: &Modulation{
+								Parameters: &Modulation_Lora{
+									Lora: &LoraModulationInfo{
+										Bandwidth:             125000,
+										SpreadingFactor:       7,
+										CodeRate:              CodeRate_CR_4_5,
+										PolarizationInversion: true,
+									},
+								},
+							},
+							Timing: &Timing{
+								Parameters: &Timing_Delay{
+									Delay: &DelayTimingInfo{
+										Delay: ptypes.DurationProto(time.Second),
+									},
+								},
+							},
+							Context: []byte{1, 2, 3, 4},
+						},
+					},
+					{
+						PhyPayload: []byte{1, 2, 3},
+						TxInfo: &DownlinkTxInfo{
+							Frequency: 869525000,
+							Power:     27,
+							Modulation: &Modulation{
+								Parameters: &Modulation_Fsk{
+									Fsk: &FskModulationInfo{
+										FrequencyDeviation: 25000,
+										Datarate:           50000,
+									},
+								},
+							},
+							Timing: &Timing{
+								Parameters: &Timing_GpsEpoch{
+									GpsEpoch: &GPSEpochTimingInfo{
+										TimeSinceGpsEpoch: ptypes.DurationProto(time.Hour),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Expected: []gw.DownlinkFrame{
+				{
+					PhyPayload: []byte{1, 2, 3},
+					DownlinkId: []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+					TxInfo: &gw.DownlinkTXInfo{
+						GatewayId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+						Frequency:  868100000,
+						Power:      14,
+						Modulation: common.Modulation_LORA,
+						ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+							LoraModulationInfo: &gw.LoRaModulationInfo{
+								Bandwidth:             125,
+								SpreadingFactor:       7,
+								CodeRate:              "4/5",
+								PolarizationInversion: true,
+							},
+						},
+						Timing: gw.DownlinkTiming_DELAY,
+						TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+							DelayTimingInfo: &gw.DelayTimingInfo{
+								Delay: ptypes.DurationProto(time.Second),
+							},
+						},
+						Context: []byte{1, 2, 3, 4},
+					},
+				},
+				{
+					PhyPayload: []byte{1, 2, 3},
+					DownlinkId: []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+					TxInfo: &gw.DownlinkTXInfo{
+						GatewayId:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+						Frequency:  869525000,
+						Power:      27,
+						Modulation: common.Modulation_FSK,
+						ModulationInfo: &gw.DownlinkTXInfo_FskModulationInfo{
+							FskModulationInfo: &gw.FSKModulationInfo{
+								FrequencyDeviation: 25000,
+								Datarate:           50000,
+							},
+						},
+						Timing: gw.DownlinkTiming_GPS_EPOCH,
+						TimingInfo: &gw.DownlinkTXInfo_GpsEpochTimingInfo{
+							GpsEpochTimingInfo: &gw.GPSEpochTimingInfo{
+								TimeSinceGpsEpoch: ptypes.DurationProto(time.Hour),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: "legacy tx info",
+			In: DownlinkFrame{
+				DownlinkIdLegacy: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				GatewayIdLegacy:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				Items: []*DownlinkFrameItem{
+					{
+						PhyPayload:   []byte{1, 2, 3},
+						TxInfoLegacy: &legacyTXInfo,
+					},
+				},
+			},
+			Expected: []gw.DownlinkFrame{
+				{
+					PhyPayload: []byte{1, 2, 3},
+					DownlinkId: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+					TxInfo:     &legacyTXInfo,
+				},
+			},
+		},
+		{
+			Name: "missing timing",
+			In: DownlinkFrame{
+				GatewayId: "0102030405060708",
+				Items: []*DownlinkFrameItem{
+					{
+						TxInfo: &DownlinkTxInfo{
+							Modulation: &Modulation{
+								Parameters: &Modulation_Fsk{
+									Fsk: &FskModulationInfo{},
+								},
+							},
+						},
+					},
+				},
+			},
+			ExpectedError: "item 0 error: timing must be set",
+		},
+		{
+			Name: "missing tx info",
+			In: DownlinkFrame{
+				GatewayId: "0102030405060708",
+				Items:     []*DownlinkFrameItem{{}},
+			},
+			ExpectedError: "item 0: tx_info must be set",
+		},
+		{
+			Name: "invalid gateway id",
+			In: DownlinkFrame{
+				GatewayId: "foo",
+			},
+			ExpectedError: "decode gateway id error: encoding/hex: invalid byte: U+006F 'o'",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			out, err := DownlinkFrameToV3(tst.In)
+			if tst.ExpectedError != "" {
+				assert.EqualError(err, tst.ExpectedError)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tst.Expected, out)
+		})
+	}
+}
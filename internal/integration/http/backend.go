@@ -0,0 +1,451 @@
+// Package http implements a HTTP (webhook) integration.
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// Request headers.
+const (
+	headerEventType = "X-Event-Type"
+	headerGatewayID = "X-Gateway-ID"
+	headerSignature = "X-Signature-SHA256"
+)
+
+// Backend implements a HTTP backend.
+type Backend struct {
+	sync.RWMutex
+
+	client   *http.Client
+	server   *http.Server
+	listener net.Listener
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+	gateways                      map[lorawan.EUI64]struct{}
+
+	eventURL         string
+	eventURLs        map[string]string
+	headers          map[string]string
+	hmacSecret       []byte
+	maxRetries       int
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+
+	// marshalers contains the per event-type marshalers, marshal and
+	// unmarshal are the functions of the default marshaler.
+	marshalers marshaler.Set
+	marshal    func(msg proto.Message) ([]byte, error)
+	unmarshal  func(b []byte, msg proto.Message) error
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	httpConf := conf.Integration.HTTP
+
+	b := Backend{
+		client: &http.Client{
+			Timeout: httpConf.Timeout,
+		},
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[lorawan.EUI64]struct{}),
+
+		eventURL:         httpConf.EventURL,
+		eventURLs:        httpConf.EventURLs,
+		headers:          httpConf.Headers,
+		hmacSecret:       []byte(httpConf.HMACSecret),
+		maxRetries:       httpConf.MaxRetries,
+		retryInterval:    httpConf.RetryInterval,
+		maxRetryInterval: httpConf.MaxRetryInterval,
+	}
+
+	if b.eventURL == "" && len(b.eventURLs) == 0 {
+		return nil, errors.New("integration/http: at least one event url must be configured")
+	}
+
+	var err error
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/http: %s", err)
+	}
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	if httpConf.CommandsEnabled {
+		log.WithFields(log.Fields{
+			"bind": httpConf.CommandBind,
+		}).Info("integration/http: starting command listener")
+
+		b.listener, err = net.Listen("tcp", httpConf.CommandBind)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/http: create command listener error")
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/gateway/", b.handleCommand)
+
+		b.server = &http.Server{
+			Handler: mux,
+		}
+
+		go func() {
+			if err := b.server.Serve(b.listener); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Error("integration/http: command listener error")
+			}
+		}()
+	}
+
+	return &b, nil
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	log.Info("integration/http: closing backend")
+
+	if b.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := b.server.Shutdown(ctx); err != nil {
+			return errors.Wrap(err, "shutdown command listener error")
+		}
+	}
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway. Commands are only
+// accepted for the subscribed gateways.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/http: set gateway subscription called")
+
+	if subscribe {
+		b.gateways[gatewayID] = struct{}{}
+	} else {
+		delete(b.gateways, gatewayID)
+	}
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	httpEventCounter(event).Inc()
+	idPrefix := map[string]string{
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
+	}
+	return b.publish(gatewayID, event, log.Fields{
+		idPrefix[event] + "id": id,
+	}, v)
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, fields log.Fields, msg proto.Message) error {
+	url := b.eventURL
+	if u, ok := b.eventURLs[event]; ok {
+		url = u
+	}
+
+	// no endpoint has been configured for this event type
+	if url == "" {
+		return nil
+	}
+
+	m := b.marshalers.Event(event)
+
+	bytes, err := m.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	fields["url"] = url
+	fields["event"] = event
+
+	interval := b.retryInterval
+	for i := 0; ; i++ {
+		log.WithFields(fields).Info("integration/http: publishing event")
+
+		retry, err := b.post(url, gatewayID, event, m.Name, bytes)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || i >= b.maxRetries {
+			httpEventErrorCounter(event).Inc()
+			return errors.Wrap(err, "post event error")
+		}
+
+		log.WithError(err).WithFields(fields).WithField("retry_in", interval).Warning("integration/http: post event error, retrying")
+		httpEventRetryCounter(event).Inc()
+
+		time.Sleep(interval)
+		interval = interval * 2
+		if interval > b.maxRetryInterval {
+			interval = b.maxRetryInterval
+		}
+	}
+}
+
+// post posts the given payload to the url. It returns true when the request
+// can be retried (e.g. on a connection error or a 5xx response).
+func (b *Backend) post(url string, gatewayID lorawan.EUI64, event, marshalerName string, payload []byte) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return false, errors.Wrap(err, "new request error")
+	}
+
+	for k, v := range b.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType(marshalerName))
+	req.Header.Set(headerEventType, event)
+	req.Header.Set(headerGatewayID, gatewayID.String())
+	if len(b.hmacSecret) != 0 {
+		req.Header.Set(headerSignature, b.sign(payload))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("expected 2xx response, got: %d", resp.StatusCode)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// sign returns the hex encoded HMAC-SHA256 signature of the given payload.
+func (b *Backend) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, b.hmacSecret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleCommand handles the POST /gateway/{gateway_id}/command/{command}
+// requests.
+func (b *Backend) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "command" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var gatewayID lorawan.EUI64
+	if err := gatewayID.UnmarshalText([]byte(parts[1])); err != nil {
+		http.Error(w, "invalid gateway id", http.StatusBadRequest)
+		return
+	}
+
+	b.RLock()
+	_, ok := b.gateways[gatewayID]
+	b.RUnlock()
+	if !ok {
+		http.Error(w, "gateway is not connected", http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body error", http.StatusBadRequest)
+		return
+	}
+
+	if len(b.hmacSecret) != 0 {
+		if !hmac.Equal([]byte(r.Header.Get(headerSignature)), []byte(b.sign(body))) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	command := parts[3]
+	switch command {
+	case "down":
+		httpCommandCounter("down").Inc()
+		err = b.handleDownlinkFrame(body)
+	case "config":
+		httpCommandCounter("config").Inc()
+		err = b.handleGatewayConfiguration(body)
+	case "exec":
+		httpCommandCounter("exec").Inc()
+		err = b.handleGatewayCommandExecRequest(body)
+	case "raw":
+		httpCommandCounter("raw").Inc()
+		err = b.handleRawPacketForwarderCommand(body)
+	default:
+		log.WithFields(log.Fields{
+			"path": r.URL.Path,
+		}).Warning("integration/http: unexpected command received")
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": r.URL.Path,
+		}).WithError(err).Error("integration/http: handle command error")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (b *Backend) handleDownlinkFrame(body []byte) error {
+	var downlinkFrame gw.DownlinkFrame
+	if err := b.unmarshal(body, &downlinkFrame); err != nil {
+		return errors.Wrap(err, "unmarshal downlink frame error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var downID uuid.UUID
+	copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+	}).Info("integration/http: downlink frame received")
+
+	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
+}
+
+func (b *Backend) handleGatewayConfiguration(body []byte) error {
+	var gatewayConfig gw.GatewayConfiguration
+	if err := b.unmarshal(body, &gatewayConfig); err != nil {
+		return errors.Wrap(err, "unmarshal gateway configuration error")
+	}
+
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], gatewayConfig.GetGatewayId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+	}).Info("integration/http: gateway configuration received")
+
+	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
+}
+
+func (b *Backend) handleGatewayCommandExecRequest(body []byte) error {
+	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
+	if err := b.unmarshal(body, &gatewayCommandExecRequest); err != nil {
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var execID uuid.UUID
+	copy(gatewayID[:], gatewayCommandExecRequest.GetGatewayId())
+	copy(execID[:], gatewayCommandExecRequest.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/http: gateway command execution request received")
+
+	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(body []byte) error {
+	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
+	if err := b.unmarshal(body, &rawPacketForwarderCommand); err != nil {
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var rawID uuid.UUID
+	copy(gatewayID[:], rawPacketForwarderCommand.GetGatewayId())
+	copy(rawID[:], rawPacketForwarderCommand.GetRawId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"raw_id":     rawID,
+	}).Info("integration/http: raw packet-forwarder command received")
+
+	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
+
+// contentType returns the content-type for the given marshaler.
+func contentType(marshalerName string) string {
+	switch marshalerName {
+	case marshaler.Protobuf:
+		return "application/x-protobuf"
+	case marshaler.CBOR:
+		return "application/cbor"
+	default:
+		return "application/json"
+	}
+}
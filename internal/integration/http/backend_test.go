@@ -0,0 +1,230 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type request struct {
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+type HTTPBackendTestSuite struct {
+	suite.Suite
+
+	server    *httptest.Server
+	requests  chan request
+	status    chan int
+	backend   *Backend
+	gatewayID lorawan.EUI64
+}
+
+func (ts *HTTPBackendTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	log.SetLevel(log.ErrorLevel)
+
+	ts.requests = make(chan request, 10)
+	ts.status = make(chan int, 10)
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		ts.requests <- request{
+			path:    r.URL.Path,
+			headers: r.Header,
+			body:    b,
+		}
+
+		select {
+		case status := <-ts.status:
+			w.WriteHeader(status)
+		default:
+		}
+	}))
+
+	ts.gatewayID = lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.HTTP.CommandsEnabled = true
+	conf.Integration.HTTP.CommandBind = "127.0.0.1:0"
+	conf.Integration.HTTP.EventURL = ts.server.URL + "/events"
+	conf.Integration.HTTP.EventURLs = map[string]string{
+		"stats": ts.server.URL + "/stats",
+	}
+	conf.Integration.HTTP.Headers = map[string]string{
+		"Authorization": "Bearer secret",
+	}
+	conf.Integration.HTTP.Timeout = time.Second
+	conf.Integration.HTTP.HMACSecret = "hmac-secret"
+	conf.Integration.HTTP.MaxRetries = 2
+	conf.Integration.HTTP.RetryInterval = time.Millisecond
+	conf.Integration.HTTP.MaxRetryInterval = 2 * time.Millisecond
+
+	var err error
+	ts.backend, err = NewBackend(conf)
+	assert.NoError(err)
+	assert.NoError(ts.backend.SetGatewaySubscription(true, ts.gatewayID))
+}
+
+func (ts *HTTPBackendTestSuite) TearDownSuite() {
+	ts.backend.Close()
+	ts.server.Close()
+}
+
+func (ts *HTTPBackendTestSuite) TestPublishUplinkFrame() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	uplink := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		RxInfo: &gw.UplinkRXInfo{
+			UplinkId: id[:],
+		},
+	}
+
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", id, &uplink))
+	req := <-ts.requests
+
+	assert.Equal("/events", req.path)
+	assert.Equal("application/json", req.headers.Get("Content-Type"))
+	assert.Equal("Bearer secret", req.headers.Get("Authorization"))
+	assert.Equal("up", req.headers.Get("X-Event-Type"))
+	assert.Equal("0807060504030201", req.headers.Get("X-Gateway-ID"))
+	assert.Equal(ts.backend.sign(req.body), req.headers.Get("X-Signature-SHA256"))
+
+	var pl gw.UplinkFrame
+	assert.NoError(ts.backend.unmarshal(req.body, &pl))
+	assert.Equal(uplink, pl)
+}
+
+func (ts *HTTPBackendTestSuite) TestPublishGatewayStats() {
+	assert := require.New(ts.T())
+
+	stats := gw.GatewayStats{
+		GatewayId: ts.gatewayID[:],
+	}
+
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "stats", uuid.Nil, &stats))
+	req := <-ts.requests
+	assert.Equal("/stats", req.path)
+}
+
+func (ts *HTTPBackendTestSuite) TestPublishRetry() {
+	ts.T().Run("Retry on server error", func(t *testing.T) {
+		assert := require.New(t)
+
+		ts.status <- http.StatusInternalServerError
+		ts.status <- http.StatusServiceUnavailable
+
+		assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "ack", uuid.Nil, &gw.DownlinkTXAck{}))
+		assert.Len(ts.requests, 3)
+		for len(ts.requests) != 0 {
+			<-ts.requests
+		}
+	})
+
+	ts.T().Run("Max retries", func(t *testing.T) {
+		assert := require.New(t)
+
+		for i := 0; i < 3; i++ {
+			ts.status <- http.StatusInternalServerError
+		}
+
+		assert.Error(ts.backend.PublishEvent(ts.gatewayID, "ack", uuid.Nil, &gw.DownlinkTXAck{}))
+		assert.Len(ts.requests, 3)
+		for len(ts.requests) != 0 {
+			<-ts.requests
+		}
+	})
+
+	ts.T().Run("No retry on client error", func(t *testing.T) {
+		assert := require.New(t)
+
+		ts.status <- http.StatusBadRequest
+
+		assert.Error(ts.backend.PublishEvent(ts.gatewayID, "ack", uuid.Nil, &gw.DownlinkTXAck{}))
+		assert.Len(ts.requests, 1)
+		<-ts.requests
+	})
+}
+
+func (ts *HTTPBackendTestSuite) TestDownlinkFrameHandler() {
+	downlink := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+
+	b, err := ts.backend.marshal(&downlink)
+	require.NoError(ts.T(), err)
+
+	url := fmt.Sprintf("http://%s/gateway/0807060504030201/command/down", ts.backend.listener.Addr())
+
+	ts.T().Run("Valid signature", func(t *testing.T) {
+		assert := require.New(t)
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+		assert.NoError(err)
+		req.Header.Set("X-Signature-SHA256", ts.backend.sign(b))
+
+		respChan := make(chan *http.Response)
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(err)
+			respChan <- resp
+		}()
+
+		receivedDownlink := <-ts.backend.GetDownlinkFrameChan()
+		assert.Equal(downlink, receivedDownlink)
+
+		resp := <-respChan
+		assert.Equal(http.StatusAccepted, resp.StatusCode)
+	})
+
+	ts.T().Run("Invalid signature", func(t *testing.T) {
+		assert := require.New(t)
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+		assert.NoError(err)
+		req.Header.Set("X-Signature-SHA256", "invalid")
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	ts.T().Run("Unknown gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		url := fmt.Sprintf("http://%s/gateway/0102030405060708/command/down", ts.backend.listener.Addr())
+		req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+		assert.NoError(err)
+		req.Header.Set("X-Signature-SHA256", ts.backend.sign(b))
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		assert.Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestHTTPBackend(t *testing.T) {
+	suite.Run(t, new(HTTPBackendTestSuite))
+}
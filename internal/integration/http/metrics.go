@@ -0,0 +1,44 @@
+package http
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_http_event_count",
+		Help: "The number of gateway events published by the HTTP integration (per event).",
+	}, []string{"event"})
+
+	eec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_http_event_error_count",
+		Help: "The number of gateway events which could not be published by the HTTP integration (per event).",
+	}, []string{"event"})
+
+	erc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_http_event_retry_count",
+		Help: "The number of gateway event publish retries by the HTTP integration (per event).",
+	}, []string{"event"})
+
+	cc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_http_command_count",
+		Help: "The number of commands received by the HTTP integration (per command).",
+	}, []string{"command"})
+)
+
+func httpEventCounter(e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": e})
+}
+
+func httpEventErrorCounter(e string) prometheus.Counter {
+	return eec.With(prometheus.Labels{"event": e})
+}
+
+func httpEventRetryCounter(e string) prometheus.Counter {
+	return erc.With(prometheus.Labels{"event": e})
+}
+
+func httpCommandCounter(c string) prometheus.Counter {
+	return cc.With(prometheus.Labels{"command": c})
+}
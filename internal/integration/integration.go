@@ -1,34 +1,201 @@
 package integration
 
 import (
+	"fmt"
+
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/amqp"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/awssqs"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/gcppubsub"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/grpc"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/http"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/kafka"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/mqtt"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/nats"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/plugin"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/semtechudp"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/standby"
 	"github.com/brocaar/lorawan"
 )
 
 // Event types.
 const (
 	EventUp    = "up"
+	EventUpSet = "up_set"
 	EventStats = "stats"
 	EventAck   = "ack"
 	EventRaw   = "raw"
+	EventLog   = "log"
+	EventConn  = "conn"
 )
 
 var integration Integration
 
 // Setup configures the integration.
 func Setup(conf config.Config) error {
-	var err error
-	integration, err = mqtt.NewBackend(conf)
+	integrations, err := newIntegrations(conf, "")
 	if err != nil {
-		return errors.Wrap(err, "setup mqtt integration error")
+		return err
+	}
+
+	mp := newMultiplexer(integrations)
+	if err := mp.setRoutes(conf.Integration.Routes, ""); err != nil {
+		return errors.Wrap(err, "setup routes error")
+	}
+	integration = mp
+
+	// The mirror integrations are setup in the background, as some
+	// integrations block until connected. Events are queued (or dropped when
+	// the queue is full) until the mirror integrations are setup.
+	if conf.Mirror.Enabled {
+		m := newMirror(integration, conf.Mirror.QueueSize)
+		integration = m
+
+		go func() {
+			integrations, err := newIntegrations(mirrorConfig(conf), health.MirrorPrefix)
+			if err != nil {
+				log.WithError(err).Error("integration: setup mirror integration error")
+				return
+			}
+
+			mp := newMultiplexer(integrations)
+			if err := mp.setRoutes(mirrorConfig(conf).Integration.Routes, health.MirrorPrefix); err != nil {
+				log.WithError(err).Error("integration: setup mirror routes error")
+				return
+			}
+
+			m.start(mp)
+		}()
+	}
+
+	// In hot-standby mode, the events and commands are dropped while this
+	// instance is standby.
+	if standby.Enabled() {
+		integration = newHotStandby(integration, standby.IsActive)
+	}
+
+	return nil
+}
+
+// newIntegrations creates the integrations enabled in the given
+// configuration. The given prefix is prepended to the integration names.
+func newIntegrations(conf config.Config, namePrefix string) ([]multiplexedIntegration, error) {
+	enabled := conf.Integration.Enabled
+	if len(enabled) == 0 {
+		enabled = []string{"mqtt"}
 	}
 
+	var integrations []multiplexedIntegration
+	for _, name := range enabled {
+		var i multiplexedIntegration
+		var err error
+
+		switch name {
+		case "mqtt":
+			i.integration, err = mqtt.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup mqtt integration error")
+			}
+			i.commandsEnabled = conf.Integration.MQTT.CommandsEnabled
+		case "kafka":
+			i.integration, err = kafka.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup kafka integration error")
+			}
+			i.commandsEnabled = conf.Integration.Kafka.CommandsEnabled
+		case "grpc":
+			i.integration, err = grpc.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup grpc integration error")
+			}
+			i.commandsEnabled = conf.Integration.GRPC.CommandsEnabled
+		case "nats":
+			i.integration, err = nats.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup nats integration error")
+			}
+			i.commandsEnabled = conf.Integration.NATS.CommandsEnabled
+		case "http":
+			i.integration, err = http.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup http integration error")
+			}
+			i.commandsEnabled = conf.Integration.HTTP.CommandsEnabled
+		case "amqp":
+			i.integration, err = amqp.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup amqp integration error")
+			}
+			i.commandsEnabled = conf.Integration.AMQP.CommandsEnabled
+		case "gcp_pub_sub":
+			i.integration, err = gcppubsub.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup gcp pub/sub integration error")
+			}
+			i.commandsEnabled = conf.Integration.GCPPubSub.CommandsEnabled
+		case "aws_sqs":
+			i.integration, err = awssqs.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup aws sqs integration error")
+			}
+			i.commandsEnabled = conf.Integration.AWSSQS.CommandsEnabled
+		case "plugin":
+			i.integration, err = plugin.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup plugin integration error")
+			}
+			i.commandsEnabled = conf.Integration.Plugin.CommandsEnabled
+		case "semtech_udp":
+			i.integration, err = semtechudp.NewBackend(conf)
+			if err != nil {
+				return nil, errors.Wrap(err, "setup semtech udp integration error")
+			}
+			i.commandsEnabled = conf.Integration.SemtechUDP.CommandsEnabled
+		default:
+			return nil, fmt.Errorf("unknown integration: %s", name)
+		}
+
+		i.name = namePrefix + name
+		integrations = append(integrations, i)
+	}
+
+	return integrations, nil
+}
+
+// mirrorConfig returns the configuration used to setup the mirror
+// integrations. The mirror integrations never receive commands.
+func mirrorConfig(conf config.Config) config.Config {
+	conf.Integration = conf.Mirror.Integration
+	conf.Integration.IsMirror = true
+
+	conf.Integration.MQTT.CommandsEnabled = false
+	conf.Integration.Kafka.CommandsEnabled = false
+	conf.Integration.GRPC.CommandsEnabled = false
+	conf.Integration.NATS.CommandsEnabled = false
+	conf.Integration.HTTP.CommandsEnabled = false
+	conf.Integration.AMQP.CommandsEnabled = false
+	conf.Integration.GCPPubSub.CommandsEnabled = false
+	conf.Integration.AWSSQS.CommandsEnabled = false
+	conf.Integration.Plugin.CommandsEnabled = false
+	conf.Integration.SemtechUDP.CommandsEnabled = false
+	conf.Integration.MQTT.RemoteConfig.Enabled = false
+
+	return conf
+}
+
+// Reload applies the given (reloaded) configuration to the integrations
+// implementing the Reloader interface.
+func Reload(conf config.Config) error {
+	if r, ok := integration.(Reloader); ok {
+		return r.Reload(conf)
+	}
 	return nil
 }
 
@@ -62,3 +229,10 @@ type Integration interface {
 	// Close closes the integration.
 	Close() error
 }
+
+// Reloader defines the interface that an integration must implement in case
+// it supports applying configuration changes without being re-created.
+type Reloader interface {
+	// Reload applies the given configuration.
+	Reload(config.Config) error
+}
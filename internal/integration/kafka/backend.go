@@ -0,0 +1,481 @@
+// Package kafka implements a Kafka integration.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// commandHeader holds the name of the message header containing the command
+// type (e.g. down).
+const commandHeader = "command"
+
+// eventHeader holds the name of the message header containing the event
+// type (e.g. up).
+const eventHeader = "event"
+
+// marshalerHeader holds the name of the message header containing the
+// marshaler of the event (e.g. json).
+const marshalerHeader = "marshaler"
+
+// batchTimeout defines the max. time that the writer waits before publishing
+// the (incomplete) batch. The default of one second would delay the TX
+// acknowledgements too much.
+const batchTimeout = 10 * time.Millisecond
+
+// writer defines the interface of a Kafka writer.
+type writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// reader defines the interface of a Kafka reader.
+type reader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// Backend implements a Kafka backend.
+type Backend struct {
+	sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// newWriter returns a new writer for the given topic.
+	newWriter func(topic string) writer
+	writers   map[string]writer
+	reader    reader
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+	gateways                      map[lorawan.EUI64]struct{}
+
+	eventTopicTemplate *template.Template
+
+	// marshalers contains the per event-type marshalers, marshal and
+	// unmarshal are the functions of the default marshaler.
+	marshalers marshaler.Set
+	marshal    func(msg proto.Message) ([]byte, error)
+	unmarshal  func(b []byte, msg proto.Message) error
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	var err error
+
+	b := Backend{
+		writers:                       make(map[string]writer),
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[lorawan.EUI64]struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	if len(conf.Integration.Kafka.Brokers) == 0 {
+		return nil, errors.New("integration/kafka: at least one broker must be configured")
+	}
+
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/kafka: %s", err)
+	}
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	b.eventTopicTemplate, err = template.New("event").Parse(conf.Integration.Kafka.EventTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/kafka: parse event-topic template error")
+	}
+
+	dialer, err := newDialer(conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/kafka: new dialer error")
+	}
+
+	b.newWriter = func(topic string) writer {
+		return kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      conf.Integration.Kafka.Brokers,
+			Topic:        topic,
+			Dialer:       dialer,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: batchTimeout,
+		})
+	}
+
+	if conf.Integration.Kafka.CommandsEnabled {
+		log.WithFields(log.Fields{
+			"topic":          conf.Integration.Kafka.CommandTopic,
+			"consumer_group": conf.Integration.Kafka.ConsumerGroup,
+		}).Info("integration/kafka: consuming command topic")
+
+		b.reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers: conf.Integration.Kafka.Brokers,
+			GroupID: conf.Integration.Kafka.ConsumerGroup,
+			Topic:   conf.Integration.Kafka.CommandTopic,
+			Dialer:  dialer,
+		})
+
+		go b.commandLoop()
+	}
+
+	return &b, nil
+}
+
+// newDialer returns the dialer for the configured TLS and SASL settings.
+func newDialer(conf config.Config) (*kafka.Dialer, error) {
+	kConf := conf.Integration.Kafka
+
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	if kConf.TLS {
+		tlsConfig := &tls.Config{}
+
+		if kConf.CACert != "" {
+			cacert, err := ioutil.ReadFile(kConf.CACert)
+			if err != nil {
+				return nil, errors.Wrap(err, "load ca-cert error")
+			}
+			certpool := x509.NewCertPool()
+			certpool.AppendCertsFromPEM(cacert)
+
+			tlsConfig.RootCAs = certpool
+		}
+
+		if kConf.TLSCert != "" && kConf.TLSKey != "" {
+			kp, err := tls.LoadX509KeyPair(kConf.TLSCert, kConf.TLSKey)
+			if err != nil {
+				return nil, errors.Wrap(err, "load tls key-pair error")
+			}
+			tlsConfig.Certificates = []tls.Certificate{kp}
+		}
+
+		dialer.TLS = tlsConfig
+	}
+
+	var mechanism sasl.Mechanism
+	var err error
+
+	switch kConf.SASL.Mechanism {
+	case "":
+	case "plain":
+		mechanism = plain.Mechanism{
+			Username: kConf.SASL.Username,
+			Password: kConf.SASL.Password,
+		}
+	case "scram_sha_256":
+		mechanism, err = scram.Mechanism(scram.SHA256, kConf.SASL.Username, kConf.SASL.Password)
+	case "scram_sha_512":
+		mechanism, err = scram.Mechanism(scram.SHA512, kConf.SASL.Username, kConf.SASL.Password)
+	default:
+		return nil, fmt.Errorf("unknown sasl mechanism: %s", kConf.SASL.Mechanism)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "new sasl mechanism error")
+	}
+	dialer.SASLMechanism = mechanism
+
+	return dialer, nil
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	b.cancel()
+
+	if b.reader != nil {
+		if err := b.reader.Close(); err != nil {
+			return errors.Wrap(err, "close reader error")
+		}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	for topic, w := range b.writers {
+		if err := w.Close(); err != nil {
+			return errors.Wrapf(err, "close writer error (topic: %s)", topic)
+		}
+	}
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway. As the commands of
+// all gateways are consumed from the same topic, this only updates the set of
+// gateways for which the commands are handled.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/kafka: set gateway subscription called")
+
+	if subscribe {
+		b.gateways[gatewayID] = struct{}{}
+	} else {
+		delete(b.gateways, gatewayID)
+	}
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	kafkaEventCounter(event).Inc()
+	idPrefix := map[string]string{
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
+	}
+	return b.publish(gatewayID, event, log.Fields{
+		idPrefix[event] + "id": id,
+	}, v)
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, fields log.Fields, msg proto.Message) error {
+	m := b.marshalers.Event(event)
+
+	topic := bytes.NewBuffer(nil)
+	if err := b.eventTopicTemplate.Execute(topic, struct {
+		GatewayID lorawan.EUI64
+		EventType string
+		Marshaler string
+	}{gatewayID, event, m.Name}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+
+	bytes, err := m.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	fields["topic"] = topic.String()
+	fields["event"] = event
+
+	log.WithFields(fields).Info("integration/kafka: publishing event")
+	if err := b.getWriter(topic.String()).WriteMessages(b.ctx, kafka.Message{
+		Key:   []byte(gatewayID.String()),
+		Value: bytes,
+		Headers: []kafka.Header{
+			{Key: eventHeader, Value: []byte(event)},
+			{Key: marshalerHeader, Value: []byte(m.Name)},
+		},
+	}); err != nil {
+		return errors.Wrap(err, "write message error")
+	}
+
+	return nil
+}
+
+// getWriter returns the writer for the given topic. The writer is created
+// on first use.
+func (b *Backend) getWriter(topic string) writer {
+	b.Lock()
+	defer b.Unlock()
+
+	w, ok := b.writers[topic]
+	if !ok {
+		w = b.newWriter(topic)
+		b.writers[topic] = w
+	}
+
+	return w
+}
+
+// commandLoop reads the messages from the command topic until the backend
+// is closed.
+func (b *Backend) commandLoop() {
+	for {
+		msg, err := b.reader.ReadMessage(b.ctx)
+		if err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+
+			log.WithError(err).Error("integration/kafka: read command error")
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if err := b.handleCommand(msg); err != nil {
+			log.WithFields(log.Fields{
+				"topic":     msg.Topic,
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+			}).WithError(err).Error("integration/kafka: handle command error")
+		}
+	}
+}
+
+func (b *Backend) handleCommand(msg kafka.Message) error {
+	var gatewayID lorawan.EUI64
+	if err := gatewayID.UnmarshalText(msg.Key); err != nil {
+		return errors.Wrap(err, "decode gateway id from message key error")
+	}
+
+	b.RLock()
+	_, ok := b.gateways[gatewayID]
+	b.RUnlock()
+
+	// The command is intended for a gateway connected to a different
+	// ChirpStack Gateway Bridge instance.
+	if !ok {
+		log.WithField("gateway_id", gatewayID).Debug("integration/kafka: ignoring command for unknown gateway")
+		return nil
+	}
+
+	var command string
+	for _, h := range msg.Headers {
+		if h.Key == commandHeader {
+			command = string(h.Value)
+		}
+	}
+
+	switch command {
+	case "down":
+		kafkaCommandCounter("down").Inc()
+		return b.handleDownlinkFrame(gatewayID, msg)
+	case "config":
+		kafkaCommandCounter("config").Inc()
+		return b.handleGatewayConfiguration(gatewayID, msg)
+	case "exec":
+		kafkaCommandCounter("exec").Inc()
+		return b.handleGatewayCommandExecRequest(gatewayID, msg)
+	case "raw":
+		kafkaCommandCounter("raw").Inc()
+		return b.handleRawPacketForwarderCommand(gatewayID, msg)
+	default:
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"command":    command,
+		}).Warning("integration/kafka: unexpected command received")
+	}
+
+	return nil
+}
+
+func (b *Backend) handleDownlinkFrame(gatewayID lorawan.EUI64, msg kafka.Message) error {
+	var downlinkFrame gw.DownlinkFrame
+	if err := b.unmarshal(msg.Value, &downlinkFrame); err != nil {
+		return errors.Wrap(err, "unmarshal downlink frame error")
+	}
+
+	var downID uuid.UUID
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+	}).Info("integration/kafka: downlink frame received")
+
+	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
+}
+
+func (b *Backend) handleGatewayConfiguration(gatewayID lorawan.EUI64, msg kafka.Message) error {
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+	}).Info("integration/kafka: gateway configuration received")
+
+	var gatewayConfig gw.GatewayConfiguration
+	if err := b.unmarshal(msg.Value, &gatewayConfig); err != nil {
+		return errors.Wrap(err, "unmarshal gateway configuration error")
+	}
+
+	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
+}
+
+func (b *Backend) handleGatewayCommandExecRequest(gatewayID lorawan.EUI64, msg kafka.Message) error {
+	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
+	if err := b.unmarshal(msg.Value, &gatewayCommandExecRequest); err != nil {
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
+	}
+
+	var execID uuid.UUID
+	copy(execID[:], gatewayCommandExecRequest.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/kafka: gateway command execution request received")
+
+	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(gatewayID lorawan.EUI64, msg kafka.Message) error {
+	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
+	if err := b.unmarshal(msg.Value, &rawPacketForwarderCommand); err != nil {
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
+	}
+
+	var rawID uuid.UUID
+	copy(rawID[:], rawPacketForwarderCommand.GetRawId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"raw_id":     rawID,
+	}).Info("integration/kafka: raw packet-forwarder command received")
+
+	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
@@ -0,0 +1,265 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type fakeWriter struct {
+	sync.Mutex
+
+	topic    string
+	messages []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.Lock()
+	defer w.Unlock()
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+type fakeReader struct {
+	messages chan kafka.Message
+}
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+type KafkaBackendTestSuite struct {
+	suite.Suite
+
+	backend   *Backend
+	writers   map[string]*fakeWriter
+	reader    *fakeReader
+	gatewayID lorawan.EUI64
+}
+
+func (ts *KafkaBackendTestSuite) SetupTest() {
+	assert := require.New(ts.T())
+
+	log.SetLevel(log.ErrorLevel)
+
+	ts.gatewayID = lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	ts.writers = make(map[string]*fakeWriter)
+	ts.reader = &fakeReader{messages: make(chan kafka.Message)}
+
+	var conf config.Config
+	conf.Integration.Marshaler = "protobuf"
+	conf.Integration.Kafka.Brokers = []string{"127.0.0.1:9092"}
+	conf.Integration.Kafka.EventTopicTemplate = "gateway.{{ .EventType }}"
+
+	var err error
+	ts.backend, err = NewBackend(conf)
+	assert.NoError(err)
+
+	ts.backend.newWriter = func(topic string) writer {
+		w := &fakeWriter{topic: topic}
+		ts.writers[topic] = w
+		return w
+	}
+	ts.backend.reader = ts.reader
+	go ts.backend.commandLoop()
+
+	assert.NoError(ts.backend.SetGatewaySubscription(true, ts.gatewayID))
+}
+
+func (ts *KafkaBackendTestSuite) TearDownTest() {
+	ts.backend.Close()
+}
+
+func (ts *KafkaBackendTestSuite) TestPublishEvent() {
+	assert := require.New(ts.T())
+
+	uplink := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", uuid.Nil, &uplink))
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", uuid.Nil, &uplink))
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "stats", uuid.Nil, &gw.GatewayStats{}))
+
+	assert.Len(ts.writers, 2)
+
+	w, ok := ts.writers["gateway.up"]
+	assert.True(ok)
+	assert.Len(w.messages, 2)
+
+	msg := w.messages[0]
+	assert.Equal("0807060504030201", string(msg.Key))
+	assert.Equal([]kafka.Header{
+		{Key: "event", Value: []byte("up")},
+		{Key: "marshaler", Value: []byte("protobuf")},
+	}, msg.Headers)
+
+	var received gw.UplinkFrame
+	assert.NoError(proto.Unmarshal(msg.Value, &received))
+	assert.True(proto.Equal(&uplink, &received))
+
+	_, ok = ts.writers["gateway.stats"]
+	assert.True(ok)
+}
+
+func (ts *KafkaBackendTestSuite) TestCommands() {
+	downlink := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+	downlinkB, err := proto.Marshal(&downlink)
+	ts.Require().NoError(err)
+
+	ts.T().Run("Downlink", func(t *testing.T) {
+		assert := require.New(t)
+
+		ts.reader.messages <- kafka.Message{
+			Key:     []byte(ts.gatewayID.String()),
+			Value:   downlinkB,
+			Headers: []kafka.Header{{Key: "command", Value: []byte("down")}},
+		}
+
+		received := <-ts.backend.GetDownlinkFrameChan()
+		assert.True(proto.Equal(&downlink, &received))
+	})
+
+	ts.T().Run("Exec", func(t *testing.T) {
+		assert := require.New(t)
+
+		execReq := gw.GatewayCommandExecRequest{
+			GatewayId: ts.gatewayID[:],
+			Command:   "reboot",
+		}
+		b, err := proto.Marshal(&execReq)
+		assert.NoError(err)
+
+		ts.reader.messages <- kafka.Message{
+			Key:     []byte(ts.gatewayID.String()),
+			Value:   b,
+			Headers: []kafka.Header{{Key: "command", Value: []byte("exec")}},
+		}
+
+		received := <-ts.backend.GetGatewayCommandExecRequestChan()
+		assert.True(proto.Equal(&execReq, &received))
+	})
+
+	ts.T().Run("Unknown gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		ts.reader.messages <- kafka.Message{
+			Key:     []byte("0102030405060708"),
+			Value:   downlinkB,
+			Headers: []kafka.Header{{Key: "command", Value: []byte("down")}},
+		}
+
+		select {
+		case <-ts.backend.GetDownlinkFrameChan():
+			assert.Fail("unexpected downlink for unknown gateway")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	ts.T().Run("Unsubscribed gateway", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.backend.SetGatewaySubscription(false, ts.gatewayID))
+
+		ts.reader.messages <- kafka.Message{
+			Key:     []byte(ts.gatewayID.String()),
+			Value:   downlinkB,
+			Headers: []kafka.Header{{Key: "command", Value: []byte("down")}},
+		}
+
+		select {
+		case <-ts.backend.GetDownlinkFrameChan():
+			assert.Fail("unexpected downlink for unsubscribed gateway")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestKafkaBackend(t *testing.T) {
+	suite.Run(t, new(KafkaBackendTestSuite))
+}
+
+func TestNewDialer(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Mechanism     string
+		ExpectedName  string
+		ExpectedError string
+	}{
+		{
+			Name: "no sasl",
+		},
+		{
+			Name:         "plain",
+			Mechanism:    "plain",
+			ExpectedName: "PLAIN",
+		},
+		{
+			Name:         "scram sha-512",
+			Mechanism:    "scram_sha_512",
+			ExpectedName: "SCRAM-SHA-512",
+		},
+		{
+			Name:          "invalid",
+			Mechanism:     "gssapi",
+			ExpectedError: "unknown sasl mechanism: gssapi",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var conf config.Config
+			conf.Integration.Kafka.SASL.Mechanism = tst.Mechanism
+			conf.Integration.Kafka.SASL.Username = "user"
+			conf.Integration.Kafka.SASL.Password = "secret"
+
+			dialer, err := newDialer(conf)
+			if tst.ExpectedError != "" {
+				assert.EqualError(err, tst.ExpectedError)
+				return
+			}
+			assert.NoError(err)
+
+			if tst.ExpectedName == "" {
+				assert.Nil(dialer.SASLMechanism)
+			} else {
+				assert.Equal(tst.ExpectedName, dialer.SASLMechanism.Name())
+			}
+		})
+	}
+}
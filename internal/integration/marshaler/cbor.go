@@ -0,0 +1,342 @@
+// Package marshaler implements the marshalers of the integration payloads
+// which are not provided by the protobuf packages.
+package marshaler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// cborEncMode uses the shortest float encoding, to keep the payloads as
+// compact as possible, and sorts the map keys such that the same message
+// always results in the same payload.
+var cborEncMode cbor.EncMode
+
+func init() {
+	var err error
+	cborEncMode, err = cbor.EncOptions{
+		Sort:          cbor.SortCanonical,
+		ShortestFloat: cbor.ShortestFloat16,
+	}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MarshalCBOR marshals the given message to CBOR. Messages are encoded as
+// CBOR maps, using the (original) proto field names as keys. Fields set to
+// their default value are omitted, bytes fields are encoded as byte strings,
+// enums as integers and oneof fields as if they were regular fields (like
+// the JSON mapping). Well-known types (e.g. google.protobuf.Timestamp) are
+// encoded like any other message.
+func MarshalCBOR(msg proto.Message) ([]byte, error) {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected pointer to struct, got: %T", msg)
+	}
+
+	m, err := encodeMessage(v.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return cborEncMode.Marshal(m)
+}
+
+// UnmarshalCBOR unmarshals the given CBOR encoded payload into the given
+// message. Unknown fields are ignored.
+func UnmarshalCBOR(b []byte, msg proto.Message) error {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected pointer to struct, got: %T", msg)
+	}
+
+	var m interface{}
+	if err := cbor.Unmarshal(b, &m); err != nil {
+		return errors.Wrap(err, "cbor unmarshal error")
+	}
+
+	msg.Reset()
+	return decodeMessage(m, v.Elem())
+}
+
+func encodeMessage(s reflect.Value) (map[string]interface{}, error) {
+	sprops := proto.GetProperties(s.Type())
+	out := make(map[string]interface{})
+
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		sf := s.Type().Field(i)
+
+		if strings.HasPrefix(sf.Name, "XXX_") {
+			continue
+		}
+
+		// oneof: the interface contains a pointer to a wrapper struct,
+		// containing the field which is set
+		if sf.Tag.Get("protobuf_oneof") != "" {
+			if f.IsNil() {
+				continue
+			}
+
+			w := f.Elem().Elem()
+			prop := proto.GetProperties(w.Type()).Prop[0]
+
+			// the value is always included (also when it has its default
+			// value) as otherwise the set field would be lost
+			val, err := encodeValue(w.Field(0))
+			if err != nil {
+				return nil, errors.Wrapf(err, "encode field %s error", prop.OrigName)
+			}
+			out[prop.OrigName] = val
+			continue
+		}
+
+		if isZero(f) {
+			continue
+		}
+
+		prop := sprops.Prop[i]
+		val, err := encodeValue(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode field %s error", prop.OrigName)
+		}
+		out[prop.OrigName] = val
+	}
+
+	return out, nil
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unsupported type: %s", v.Type())
+		}
+		return encodeMessage(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+
+		out := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			val, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	case reflect.Map:
+		out := make(map[interface{}]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			key, err := encodeValue(k)
+			if err != nil {
+				return nil, err
+			}
+			val, err := encodeValue(v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			out[key] = val
+		}
+		return out, nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32:
+		return float32(v.Float()), nil
+	case reflect.Float64:
+		return v.Float(), nil
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", v.Type())
+	}
+}
+
+func decodeMessage(v interface{}, s reflect.Value) error {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Errorf("expected map, got: %T", v)
+	}
+
+	sprops := proto.GetProperties(s.Type())
+	fields := make(map[string]int)
+	for i, prop := range sprops.Prop {
+		if strings.HasPrefix(prop.Name, "XXX_") || s.Type().Field(i).Tag.Get("protobuf_oneof") != "" {
+			continue
+		}
+		fields[prop.OrigName] = i
+	}
+
+	for k, val := range m {
+		name, ok := k.(string)
+		if !ok {
+			return fmt.Errorf("expected string key, got: %T", k)
+		}
+
+		if i, ok := fields[name]; ok {
+			if err := decodeValue(val, s.Field(i)); err != nil {
+				return errors.Wrapf(err, "decode field %s error", name)
+			}
+			continue
+		}
+
+		if oop, ok := sprops.OneofTypes[name]; ok {
+			w := reflect.New(oop.Type.Elem())
+			if err := decodeValue(val, w.Elem().Field(0)); err != nil {
+				return errors.Wrapf(err, "decode field %s error", name)
+			}
+			s.Field(oop.Field).Set(w)
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(v interface{}, f reflect.Value) error {
+	if v == nil {
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.Ptr:
+		n := reflect.New(f.Type().Elem())
+		if err := decodeMessage(v, n.Elem()); err != nil {
+			return err
+		}
+		f.Set(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.Uint8 {
+			b, ok := v.([]byte)
+			if !ok {
+				return fmt.Errorf("expected bytes, got: %T", v)
+			}
+			f.SetBytes(b)
+			return nil
+		}
+
+		l, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got: %T", v)
+		}
+		s := reflect.MakeSlice(f.Type(), len(l), len(l))
+		for i := range l {
+			if err := decodeValue(l[i], s.Index(i)); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+	case reflect.Map:
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return fmt.Errorf("expected map, got: %T", v)
+		}
+		out := reflect.MakeMapWithSize(f.Type(), len(m))
+		for k, val := range m {
+			key := reflect.New(f.Type().Key()).Elem()
+			if err := decodeValue(k, key); err != nil {
+				return err
+			}
+			elem := reflect.New(f.Type().Elem()).Elem()
+			if err := decodeValue(val, elem); err != nil {
+				return err
+			}
+			out.SetMapIndex(key, elem)
+		}
+		f.Set(out)
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got: %T", v)
+		}
+		f.SetBool(b)
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got: %T", v)
+		}
+		f.SetString(s)
+	case reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := v.(type) {
+		case uint64:
+			i = int64(n)
+			if i < 0 {
+				return fmt.Errorf("integer overflow: %d", n)
+			}
+		case int64:
+			i = n
+		default:
+			return fmt.Errorf("expected integer, got: %T", v)
+		}
+		if f.OverflowInt(i) {
+			return fmt.Errorf("integer overflow: %d", i)
+		}
+		f.SetInt(i)
+	case reflect.Uint32, reflect.Uint64:
+		n, ok := v.(uint64)
+		if !ok {
+			return fmt.Errorf("expected unsigned integer, got: %T", v)
+		}
+		if f.OverflowUint(n) {
+			return fmt.Errorf("integer overflow: %d", n)
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var fl float64
+		switch n := v.(type) {
+		case float64:
+			fl = n
+		case float32:
+			fl = float64(n)
+		case uint64:
+			fl = float64(n)
+		case int64:
+			fl = float64(n)
+		default:
+			return fmt.Errorf("expected float, got: %T", v)
+		}
+		f.SetFloat(fl)
+	default:
+		return fmt.Errorf("unsupported type: %s", f.Type())
+	}
+
+	return nil
+}
+
+// isZero returns true when the value is the proto3 default value, in which
+// case the field is omitted.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.String:
+		return v.String() == ""
+	case reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+
+	return false
+}
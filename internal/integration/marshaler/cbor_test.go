@@ -0,0 +1,247 @@
+package marshaler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+)
+
+func TestCBOR(t *testing.T) {
+	now, _ := ptypes.TimestampProto(time.Date(2020, 1, 2, 3, 4, 5, 600, time.UTC))
+	gatewayID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	tests := []struct {
+		Name    string
+		Message proto.Message
+	}{
+		{
+			Name: "uplink frame",
+			Message: &gw.UplinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				TxInfo: &gw.UplinkTXInfo{
+					Frequency:  868100000,
+					Modulation: common.Modulation_LORA,
+					ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+						LoraModulationInfo: &gw.LoRaModulationInfo{
+							Bandwidth:             125,
+							SpreadingFactor:       12,
+							CodeRate:              "4/5",
+							PolarizationInversion: true,
+						},
+					},
+				},
+				RxInfo: &gw.UplinkRXInfo{
+					GatewayId:         gatewayID,
+					Time:              now,
+					TimeSinceGpsEpoch: ptypes.DurationProto(time.Hour),
+					Rssi:              -120,
+					LoraSnr:           -7.25,
+					Location: &common.Location{
+						Latitude:  52.3740364,
+						Longitude: 4.9144401,
+						Altitude:  10.5,
+					},
+					FineTimestampType: gw.FineTimestampType_ENCRYPTED,
+					FineTimestamp: &gw.UplinkRXInfo_EncryptedFineTimestamp{
+						EncryptedFineTimestamp: &gw.EncryptedFineTimestamp{
+							AesKeyIndex: 0,
+							EncryptedNs: []byte{1, 2, 3},
+						},
+					},
+					Context:   []byte{1, 2, 3, 4},
+					UplinkId:  id,
+					CrcStatus: gw.CRCStatus_CRC_OK,
+				},
+			},
+		},
+		{
+			Name: "gateway stats",
+			Message: &gw.GatewayStats{
+				GatewayId:           gatewayID,
+				Ip:                  "192.168.1.1",
+				Time:                now,
+				RxPacketsReceived:   10,
+				RxPacketsReceivedOk: 5,
+				MetaData: map[string]string{
+					"serial": "1234",
+				},
+				StatsId: id,
+			},
+		},
+		{
+			Name: "downlink tx ack",
+			Message: &gw.DownlinkTXAck{
+				GatewayId:  gatewayID,
+				Token:      1234,
+				Error:      "TOO_LATE",
+				DownlinkId: id,
+			},
+		},
+		{
+			Name: "gateway command exec response",
+			Message: &gw.GatewayCommandExecResponse{
+				GatewayId: gatewayID,
+				ExecId:    id,
+				Stdout:    []byte("hello"),
+			},
+		},
+		{
+			Name: "raw packet-forwarder event",
+			Message: &gw.RawPacketForwarderEvent{
+				GatewayId: gatewayID,
+				RawId:     id,
+				Payload:   []byte{1, 2, 3},
+			},
+		},
+		{
+			Name: "conn state",
+			Message: &events.ConnState{
+				GatewayId:   gatewayID,
+				State:       events.ConnStateOnline,
+				BackendType: "semtech_udp",
+				ConnectTime: now,
+			},
+		},
+		{
+			Name: "log",
+			Message: &events.Log{
+				GatewayId: gatewayID,
+				LogId:     id,
+				Time:      now,
+				Severity:  "ERROR",
+				Message:   "radio error",
+			},
+		},
+		{
+			Name: "downlink frame",
+			Message: &gw.DownlinkFrame{
+				PhyPayload: []byte{1, 2, 3, 4},
+				Token:      1234,
+				DownlinkId: id,
+				TxInfo: &gw.DownlinkTXInfo{
+					GatewayId:  gatewayID,
+					Frequency:  868100000,
+					Power:      14,
+					Modulation: common.Modulation_FSK,
+					ModulationInfo: &gw.DownlinkTXInfo_FskModulationInfo{
+						FskModulationInfo: &gw.FSKModulationInfo{
+							FrequencyDeviation: 25000,
+							Datarate:           50000,
+						},
+					},
+					Timing: gw.DownlinkTiming_DELAY,
+					// all fields of the oneof have their default value
+					TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+						DelayTimingInfo: &gw.DelayTimingInfo{},
+					},
+					Context: []byte{1, 2, 3, 4},
+				},
+			},
+		},
+		{
+			Name: "gateway configuration",
+			Message: &gw.GatewayConfiguration{
+				GatewayId: gatewayID,
+				Version:   "1.2.3",
+				Channels: []*gw.ChannelConfiguration{
+					{
+						Frequency:  868100000,
+						Modulation: common.Modulation_LORA,
+						ModulationConfig: &gw.ChannelConfiguration_LoraModulationConfig{
+							LoraModulationConfig: &gw.LoRaModulationConfig{
+								Bandwidth:        125,
+								SpreadingFactors: []uint32{7, 8, 9, 10, 11, 12},
+							},
+						},
+					},
+					{
+						Frequency:  868800000,
+						Modulation: common.Modulation_FSK,
+						ModulationConfig: &gw.ChannelConfiguration_FskModulationConfig{
+							FskModulationConfig: &gw.FSKModulationConfig{
+								Bandwidth: 125,
+								Bitrate:   50000,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: "gateway command exec request",
+			Message: &gw.GatewayCommandExecRequest{
+				GatewayId: gatewayID,
+				Command:   "reboot",
+				ExecId:    id,
+				Stdin:     []byte("yes"),
+				Environment: map[string]string{
+					"FOO": "bar",
+				},
+			},
+		},
+		{
+			Name: "raw packet-forwarder command",
+			Message: &gw.RawPacketForwarderCommand{
+				GatewayId: gatewayID,
+				RawId:     id,
+				Payload:   []byte{1, 2, 3},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			b, err := MarshalCBOR(tst.Message)
+			assert.NoError(err)
+
+			out := reflect.New(reflect.TypeOf(tst.Message).Elem()).Interface().(proto.Message)
+			assert.NoError(UnmarshalCBOR(b, out))
+			assert.True(proto.Equal(tst.Message, out), "expected: %s, got: %s", tst.Message, out)
+
+			// the payload must be more compact than the JSON payload
+			marshaler := &jsonpb.Marshaler{EmitDefaults: true}
+			str, err := marshaler.MarshalToString(tst.Message)
+			assert.NoError(err)
+			assert.True(len(b) < len(str))
+		})
+	}
+
+	t.Run("unknown fields are ignored", func(t *testing.T) {
+		assert := require.New(t)
+
+		b, err := MarshalCBOR(&gw.GatewayCommandExecResponse{
+			GatewayId: gatewayID,
+			ExecId:    id,
+			Stderr:    []byte("error"),
+		})
+		assert.NoError(err)
+
+		var out gw.RawPacketForwarderEvent
+		assert.NoError(UnmarshalCBOR(b, &out))
+		assert.Equal(gatewayID, out.GatewayId)
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		assert := require.New(t)
+
+		b, err := cborEncMode.Marshal(map[string]interface{}{
+			"token": "1234",
+		})
+		assert.NoError(err)
+
+		var out gw.DownlinkTXAck
+		assert.Error(UnmarshalCBOR(b, &out))
+	})
+}
@@ -0,0 +1,141 @@
+package marshaler
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/gwv4"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
+)
+
+// Marshaler names.
+const (
+	JSON         = "json"
+	ProtobufJSON = "protobuf_json"
+	Protobuf     = "protobuf"
+	CBOR         = "cbor"
+)
+
+// Marshaler contains the marshal and unmarshal functions of a marshaler.
+type Marshaler struct {
+	// Name contains the marshaler name, e.g. to reference the marshaler in
+	// the event topic template.
+	Name string
+
+	Marshal   func(proto.Message) ([]byte, error)
+	Unmarshal func([]byte, proto.Message) error
+}
+
+// WrapFunc wraps the marshal and unmarshal functions (e.g. gwv4.Wrap).
+type WrapFunc func(func(proto.Message) ([]byte, error), func([]byte, proto.Message) error) (func(proto.Message) ([]byte, error), func([]byte, proto.Message) error)
+
+// New returns the marshaler for the given name.
+func New(name string) (Marshaler, error) {
+	m := Marshaler{
+		Name: name,
+	}
+
+	switch name {
+	case JSON, ProtobufJSON:
+		// The legacy json marshaler includes the fields set to their
+		// default value, the protobuf_json marshaler implements the
+		// canonical Protobuf JSON mapping (which omits these).
+		emitDefaults := name == JSON
+		m.Marshal = func(msg proto.Message) ([]byte, error) {
+			marshaler := &jsonpb.Marshaler{
+				EnumsAsInts:  false,
+				EmitDefaults: emitDefaults,
+			}
+			str, err := marshaler.MarshalToString(msg)
+			return []byte(str), err
+		}
+
+		m.Unmarshal = func(b []byte, msg proto.Message) error {
+			unmarshaler := &jsonpb.Unmarshaler{
+				AllowUnknownFields: true, // we don't want to fail on unknown fields
+			}
+			return unmarshaler.Unmarshal(bytes.NewReader(b), msg)
+		}
+	case Protobuf:
+		m.Marshal = func(msg proto.Message) ([]byte, error) {
+			return proto.Marshal(msg)
+		}
+
+		m.Unmarshal = func(b []byte, msg proto.Message) error {
+			return proto.Unmarshal(b, msg)
+		}
+	case CBOR:
+		m.Marshal = MarshalCBOR
+		m.Unmarshal = UnmarshalCBOR
+	default:
+		return m, fmt.Errorf("unknown marshaler: %s", name)
+	}
+
+	// the LR-FHSS modulation info is not part of the v3 messages
+	m.Marshal, m.Unmarshal = lrfhss.Wrap(m.Marshal, m.Unmarshal)
+
+	return m, nil
+}
+
+// Set contains the default marshaler and the per event-type marshalers.
+type Set struct {
+	Default Marshaler
+	events  map[string]Marshaler
+}
+
+// NewSet returns the marshaler set for the given integration configuration.
+// When set, the given wrap function is applied to each marshaler.
+func NewSet(conf config.Integration, wrap WrapFunc) (Set, error) {
+	newMarshaler := func(name string) (Marshaler, error) {
+		m, err := New(name)
+		if err != nil {
+			return m, err
+		}
+		if wrap != nil {
+			m.Marshal, m.Unmarshal = wrap(m.Marshal, m.Unmarshal)
+		}
+		return m, nil
+	}
+
+	var s Set
+	var err error
+
+	s.Default, err = newMarshaler(conf.Marshaler)
+	if err != nil {
+		return s, err
+	}
+
+	s.events = make(map[string]Marshaler)
+	for event, name := range conf.EventMarshalers {
+		s.events[event], err = newMarshaler(name)
+		if err != nil {
+			return s, fmt.Errorf("event %s: %s", event, err)
+		}
+	}
+
+	return s, nil
+}
+
+// NewSetForConfig returns the marshaler set for the given integration
+// configuration. When the v4 API version is configured, the marshalers are
+// wrapped by gwv4.Wrap.
+func NewSetForConfig(conf config.Integration) (Set, error) {
+	var wrap WrapFunc
+	if conf.APIVersion == "v4" {
+		wrap = gwv4.Wrap
+	}
+
+	return NewSet(conf, wrap)
+}
+
+// Event returns the marshaler for the given event type.
+func (s Set) Event(event string) Marshaler {
+	if m, ok := s.events[event]; ok {
+		return m
+	}
+	return s.Default
+}
@@ -0,0 +1,131 @@
+package marshaler
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/gwv4"
+)
+
+func TestNew(t *testing.T) {
+	stats := gw.GatewayStats{
+		GatewayId:         []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		RxPacketsReceived: 10,
+	}
+
+	tests := []struct {
+		Name     string
+		Expected string
+	}{
+		{
+			Name:     JSON,
+			Expected: `"rxPacketsReceivedOK":0`,
+		},
+		{
+			Name:     ProtobufJSON,
+			Expected: `{"gatewayID":"AQIDBAUGBwg=","rxPacketsReceived":10}`,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			m, err := New(tst.Name)
+			assert.NoError(err)
+			assert.Equal(tst.Name, m.Name)
+
+			b, err := m.Marshal(&stats)
+			assert.NoError(err)
+			assert.Contains(string(b), tst.Expected)
+
+			var out gw.GatewayStats
+			assert.NoError(m.Unmarshal(b, &out))
+			assert.True(proto.Equal(&stats, &out))
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := New("xml")
+		assert.EqualError(err, "unknown marshaler: xml")
+	})
+}
+
+func TestSet(t *testing.T) {
+	assert := require.New(t)
+
+	var wrapped int
+	wrap := func(m func(proto.Message) ([]byte, error), u func([]byte, proto.Message) error) (func(proto.Message) ([]byte, error), func([]byte, proto.Message) error) {
+		wrapped++
+		return m, u
+	}
+
+	var conf config.Integration
+	conf.Marshaler = Protobuf
+	conf.EventMarshalers = map[string]string{
+		"stats": JSON,
+	}
+
+	s, err := NewSet(conf, wrap)
+	assert.NoError(err)
+	assert.Equal(2, wrapped)
+	assert.Equal(Protobuf, s.Default.Name)
+	assert.Equal(Protobuf, s.Event("up").Name)
+	assert.Equal(JSON, s.Event("stats").Name)
+
+	conf.EventMarshalers["up"] = "xml"
+	_, err = NewSet(conf, nil)
+	assert.EqualError(err, "event up: unknown marshaler: xml")
+}
+
+func TestNewSetForConfig(t *testing.T) {
+	up := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3},
+		RxInfo: &gw.UplinkRXInfo{
+			GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+	}
+
+	for _, name := range []string{JSON, Protobuf, CBOR} {
+		t.Run(name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var conf config.Integration
+			conf.Marshaler = name
+
+			s, err := NewSetForConfig(conf)
+			assert.NoError(err)
+
+			b, err := s.Default.Marshal(&up)
+			assert.NoError(err)
+
+			var out gw.UplinkFrame
+			assert.NoError(s.Default.Unmarshal(b, &out))
+			assert.True(proto.Equal(&up, &out))
+
+			t.Run("v4", func(t *testing.T) {
+				assert := require.New(t)
+
+				conf.APIVersion = "v4"
+				s, err := NewSetForConfig(conf)
+				assert.NoError(err)
+
+				b, err := s.Default.Marshal(&up)
+				assert.NoError(err)
+
+				m, err := New(name)
+				assert.NoError(err)
+
+				var out gwv4.UplinkFrame
+				assert.NoError(m.Unmarshal(b, &out))
+				assert.Equal("0102030405060708", out.RxInfo.GatewayId)
+			})
+		})
+	}
+}
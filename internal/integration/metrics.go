@@ -0,0 +1,53 @@
+package integration
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_publish_error_count",
+		Help: "The number of events that could not be published (per integration and event).",
+	}, []string{"integration", "event"})
+
+	mdc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mirror_drop_count",
+		Help: "The number of events that were not mirrored because the mirror queue was full (per event).",
+	}, []string{"event"})
+
+	sdc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_standby_drop_count",
+		Help: "The number of events and commands that were dropped because the instance is standby (per event or command).",
+	}, []string{"type"})
+
+	ruc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_route_uplink_count",
+		Help: "The number of uplinks matching the route (per route).",
+	}, []string{"route"})
+
+	rnc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_route_unmatched_count",
+		Help: "The number of uplinks not matching any route.",
+	})
+)
+
+func publishErrorCounter(integration, event string) prometheus.Counter {
+	return pec.With(prometheus.Labels{"integration": integration, "event": event})
+}
+
+func mirrorDropCounter(event string) prometheus.Counter {
+	return mdc.With(prometheus.Labels{"event": event})
+}
+
+func standbyDropCounter(typ string) prometheus.Counter {
+	return sdc.With(prometheus.Labels{"type": typ})
+}
+
+func routeUplinkCounter(route string) prometheus.Counter {
+	return ruc.With(prometheus.Labels{"route": route})
+}
+
+func routeUnmatchedCounter() prometheus.Counter {
+	return rnc
+}
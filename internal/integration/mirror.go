@@ -0,0 +1,134 @@
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// mirrorEvent contains an event queued for the mirror integration.
+type mirrorEvent struct {
+	gatewayID lorawan.EUI64
+	event     string
+	id        uuid.UUID
+	v         proto.Message
+}
+
+// mirror implements an Integration which publishes the events to the
+// primary integration and to the mirror integration. The events are handed
+// to the mirror integration through a bounded queue, such that a slow or
+// failing mirror integration never blocks the primary integration. When the
+// queue is full, the event is dropped for the mirror integration.
+//
+// Commands are only received from (and gateway subscriptions are only set
+// for) the primary integration.
+type mirror struct {
+	Integration
+
+	mux    sync.RWMutex
+	mirror Integration
+	queue  chan mirrorEvent
+}
+
+func newMirror(primary Integration, queueSize int) *mirror {
+	return &mirror{
+		Integration: primary,
+		queue:       make(chan mirrorEvent, queueSize),
+	}
+}
+
+// start starts publishing the queued events to the given mirror integration.
+func (m *mirror) start(i Integration) {
+	m.mux.Lock()
+	m.mirror = i
+	m.mux.Unlock()
+
+	go m.publishLoop(i)
+}
+
+// PublishEvent queues the event for the mirror integration and publishes it
+// to the primary integration.
+func (m *mirror) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	select {
+	case m.queue <- mirrorEvent{gatewayID: gatewayID, event: event, id: id, v: v}:
+	default:
+		mirrorDropCounter(event).Inc()
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"event_type": event,
+		}).Warning("integration: mirror queue is full, dropping event")
+	}
+
+	return m.Integration.PublishEvent(gatewayID, event, id, v)
+}
+
+// Close closes the primary and mirror integrations.
+func (m *mirror) Close() error {
+	var errs []string
+
+	if err := m.Integration.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	m.mux.RLock()
+	mi := m.mirror
+	m.mux.RUnlock()
+
+	if mi != nil {
+		if err := mi.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("mirror: %s", err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("close integration error: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// Reload applies the given configuration to the primary and mirror
+// integrations implementing the Reloader interface.
+func (m *mirror) Reload(conf config.Config) error {
+	var errs []string
+
+	if r, ok := m.Integration.(Reloader); ok {
+		if err := r.Reload(conf); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	m.mux.RLock()
+	mi := m.mirror
+	m.mux.RUnlock()
+
+	if r, ok := mi.(Reloader); ok {
+		if err := r.Reload(mirrorConfig(conf)); err != nil {
+			errs = append(errs, fmt.Sprintf("mirror: %s", err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("reload integration error: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+func (m *mirror) publishLoop(i Integration) {
+	for e := range m.queue {
+		if err := i.PublishEvent(e.gatewayID, e.event, e.id, e.v); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"gateway_id": e.gatewayID,
+				"event_type": e.event,
+			}).Error("integration: publish mirror event error")
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// blockingIntegration blocks publishing until unblocked.
+type blockingIntegration struct {
+	*testIntegration
+
+	unblock chan struct{}
+}
+
+func (i *blockingIntegration) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	<-i.unblock
+	return i.testIntegration.PublishEvent(gatewayID, event, id, v)
+}
+
+func TestMirror(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	primary := newTestIntegration(nil)
+	mirrored := &blockingIntegration{
+		testIntegration: newTestIntegration(nil),
+		unblock:         make(chan struct{}),
+	}
+
+	m := newMirror(primary, 2)
+
+	published := func(i *testIntegration) []publishedEvent {
+		i.Lock()
+		defer i.Unlock()
+		return i.published
+	}
+
+	t.Run("publish before start", func(t *testing.T) {
+		assert := require.New(t)
+
+		dropCount := testutil.ToFloat64(mirrorDropCounter(EventStats))
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(m.PublishEvent(gatewayID, EventStats, uuid.Nil, &gw.GatewayStats{}))
+		}
+
+		// the primary integration is not blocked by the mirror
+		assert.Len(published(primary), 3)
+		assert.Equal(dropCount+1, testutil.ToFloat64(mirrorDropCounter(EventStats)))
+	})
+
+	t.Run("blocking mirror", func(t *testing.T) {
+		assert := require.New(t)
+
+		m.start(mirrored)
+
+		// one event is consumed by the (blocked) publish loop, freeing
+		// one slot of the queue
+		time.Sleep(10 * time.Millisecond)
+
+		dropCount := testutil.ToFloat64(mirrorDropCounter(EventUp))
+		for i := 0; i < 3; i++ {
+			assert.NoError(m.PublishEvent(gatewayID, EventUp, uuid.Nil, &gw.UplinkFrame{}))
+		}
+
+		assert.Len(published(primary), 6)
+		assert.Equal(dropCount+2, testutil.ToFloat64(mirrorDropCounter(EventUp)))
+	})
+
+	t.Run("unblock mirror", func(t *testing.T) {
+		assert := require.New(t)
+
+		close(mirrored.unblock)
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal([]publishedEvent{
+			{GatewayID: gatewayID, Event: EventStats},
+			{GatewayID: gatewayID, Event: EventStats},
+			{GatewayID: gatewayID, Event: EventUp},
+		}, published(mirrored.testIntegration))
+	})
+
+	t.Run("gateway subscription", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(m.SetGatewaySubscription(true, gatewayID))
+		assert.Equal(map[lorawan.EUI64]bool{gatewayID: true}, primary.subscriptions)
+		assert.Len(mirrored.subscriptions, 0)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(m.Close())
+		assert.True(primary.closed)
+		assert.True(mirrored.closed)
+	})
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/awsauth"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// AWS IoT Core authentication modes.
+const (
+	awsIoTModeWebSocketSigV4   = "websocket_sigv4"
+	awsIoTModeCustomAuthorizer = "custom_authorizer"
+	awsIoTModeX509             = "x509"
+)
+
+// awsIoTX509ALPN defines the ALPN protocol name for connecting using X.509
+// client certificates on port 443.
+// See: https://docs.aws.amazon.com/iot/latest/developerguide/protocols.html
+const awsIoTX509ALPN = "x-amzn-mqtt-ca"
+
+// awsIoTService defines the service name used for signing.
+const awsIoTService = "iotdevicegateway"
+
+// awsIoTCredentialsRefreshMargin defines the margin before the expiration
+// of the credentials, after which the credentials are refreshed.
+const awsIoTCredentialsRefreshMargin = 5 * time.Minute
+
+// awsIoTMinReconnectAfter defines the min. duration between two credentials
+// triggered re-connects.
+const awsIoTMinReconnectAfter = time.Minute
+
+// AWSIoTAuthentication implements the AWS IoT Core authentication, using
+// either MQTT over WebSocket with a SigV4 signed URL, a custom authorizer or
+// X.509 client certificates.
+type AWSIoTAuthentication struct {
+	sync.Mutex
+
+	mode     string
+	endpoint string
+	region   string
+	clientID string
+
+	credentialsProvider awsauth.CredentialsProvider
+	credentials         awsauth.Credentials
+
+	username string
+	password string
+
+	tlsConfig *tls.Config
+}
+
+// NewAWSIoTAuthentication creates an AWSIoTAuthentication.
+func NewAWSIoTAuthentication(c config.Config) (Authentication, error) {
+	conf := c.Integration.MQTT.Auth.AWSIoT
+
+	if conf.Endpoint == "" {
+		return nil, errors.New("endpoint must be set")
+	}
+
+	if conf.ClientID == "" {
+		return nil, errors.New("client_id must be set")
+	}
+
+	tlsConfig, err := newTLSConfig(conf.CACert, "", "")
+	if err != nil {
+		return nil, errors.Wrap(err, "new tls config error")
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+
+	auth := AWSIoTAuthentication{
+		mode:      conf.Mode,
+		endpoint:  conf.Endpoint,
+		region:    conf.Region,
+		clientID:  conf.ClientID,
+		tlsConfig: tlsConfig,
+	}
+
+	switch conf.Mode {
+	case awsIoTModeWebSocketSigV4:
+		if conf.Region == "" {
+			return nil, errors.New("region must be set")
+		}
+
+		auth.credentialsProvider, err = awsauth.NewCredentialsProvider(conf.CredentialSource, awsauth.Credentials{
+			AccessKeyID:     conf.AccessKeyID,
+			SecretAccessKey: conf.SecretAccessKey,
+			SessionToken:    conf.SessionToken,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "new credentials provider error")
+		}
+	case awsIoTModeCustomAuthorizer:
+		if conf.AuthorizerName == "" {
+			return nil, errors.New("authorizer_name must be set")
+		}
+
+		// The custom authorizer is selected using the username query
+		// parameters, using ALPN to connect on port 443.
+		// See: https://docs.aws.amazon.com/iot/latest/developerguide/custom-auth.html
+		query := []string{"x-amz-customauthorizer-name=" + url.QueryEscape(conf.AuthorizerName)}
+		if conf.AuthorizerSignature != "" {
+			query = append(query, "x-amz-customauthorizer-signature="+url.QueryEscape(conf.AuthorizerSignature))
+		}
+		if conf.AuthorizerTokenKeyName != "" {
+			query = append(query, url.QueryEscape(conf.AuthorizerTokenKeyName)+"="+url.QueryEscape(conf.AuthorizerToken))
+		}
+
+		auth.username = conf.Username + "?" + strings.Join(query, "&")
+		auth.password = conf.AuthorizerToken
+		auth.tlsConfig.NextProtos = []string{"mqtt"}
+	case awsIoTModeX509:
+		kp, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls key-pair error")
+		}
+
+		auth.tlsConfig.Certificates = []tls.Certificate{kp}
+		auth.tlsConfig.NextProtos = []string{awsIoTX509ALPN}
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", conf.Mode)
+	}
+
+	return &auth, nil
+}
+
+// Init applies the initial configuration.
+func (a *AWSIoTAuthentication) Init(opts *mqtt.ClientOptions) error {
+	opts.SetClientID(a.clientID)
+	opts.SetTLSConfig(a.tlsConfig)
+
+	switch a.mode {
+	case awsIoTModeCustomAuthorizer:
+		opts.AddBroker(fmt.Sprintf("ssl://%s:443", a.endpoint))
+		opts.SetUsername(a.username)
+		opts.SetPassword(a.password)
+	case awsIoTModeX509:
+		opts.AddBroker(fmt.Sprintf("ssl://%s:443", a.endpoint))
+	}
+
+	return nil
+}
+
+// Update updates the authentication options.
+// In case of the WebSocket mode, this refreshes the credentials when these
+// are (about to) expire and sets a freshly signed broker URL.
+func (a *AWSIoTAuthentication) Update(opts *mqtt.ClientOptions) error {
+	if a.mode != awsIoTModeWebSocketSigV4 {
+		return nil
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if a.credentials.AccessKeyID == "" || a.credentialsExpire(time.Now()) {
+		creds, err := a.credentialsProvider()
+		if err != nil {
+			return errors.Wrap(err, "get aws credentials error")
+		}
+		a.credentials = creds
+
+		log.WithFields(log.Fields{
+			"access_key_id": creds.AccessKeyID,
+			"expiration":    creds.Expiration,
+		}).Info("mqtt/auth: aws credentials refreshed")
+	}
+
+	// The broker list is replaced, as the previous URL contains the previous
+	// signature.
+	opts.Servers = nil
+	opts.AddBroker(a.signURL(time.Now()))
+
+	return nil
+}
+
+// ReconnectAfter returns a time.Duration after which the MQTT client must re-connect.
+// Note: return 0 to disable the periodical re-connect feature.
+func (a *AWSIoTAuthentication) ReconnectAfter() time.Duration {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.mode != awsIoTModeWebSocketSigV4 || a.credentials.Expiration.IsZero() {
+		return 0
+	}
+
+	d := time.Until(a.credentials.Expiration) - awsIoTCredentialsRefreshMargin
+	if d < awsIoTMinReconnectAfter {
+		d = awsIoTMinReconnectAfter
+	}
+
+	return d
+}
+
+// credentialsExpire returns true when the credentials expire within the
+// refresh margin.
+func (a *AWSIoTAuthentication) credentialsExpire(now time.Time) bool {
+	if a.credentials.Expiration.IsZero() {
+		return false
+	}
+	return !now.Add(awsIoTCredentialsRefreshMargin).Before(a.credentials.Expiration)
+}
+
+// signURL returns the SigV4 signed WebSocket URL.
+// See: https://docs.aws.amazon.com/iot/latest/developerguide/protocols.html#mqtt-ws
+func (a *AWSIoTAuthentication) signURL(t time.Time) string {
+	emptyHash := sha256.Sum256(nil)
+	u := awsauth.PresignURL("wss", a.endpoint, "/mqtt", awsIoTService, a.region, a.credentials, t, 0, hex.EncodeToString(emptyHash[:]))
+
+	// AWS IoT expects the session token to be added after signing.
+	if a.credentials.SessionToken != "" {
+		u += "&X-Amz-Security-Token=" + awsauth.URIEncode(a.credentials.SessionToken)
+	}
+
+	return u
+}
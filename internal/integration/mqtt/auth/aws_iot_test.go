@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/awsauth"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestAWSIoTWebSocketSigV4(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Integration.MQTT.Auth.AWSIoT.Mode = "websocket_sigv4"
+	conf.Integration.MQTT.Auth.AWSIoT.Endpoint = "example-ats.iot.eu-west-1.amazonaws.com"
+	conf.Integration.MQTT.Auth.AWSIoT.Region = "eu-west-1"
+	conf.Integration.MQTT.Auth.AWSIoT.ClientID = "0102030405060708"
+	conf.Integration.MQTT.Auth.AWSIoT.CredentialSource = "static"
+
+	a, err := NewAWSIoTAuthentication(conf)
+	assert.NoError(err)
+
+	// The credentials are provided by the test, the first set expires within
+	// the refresh margin.
+	var calls int
+	aws := a.(*AWSIoTAuthentication)
+	aws.credentialsProvider = func() (awsauth.Credentials, error) {
+		calls++
+		exp := time.Now().Add(awsIoTCredentialsRefreshMargin + 10*time.Minute)
+		if calls == 1 {
+			exp = time.Now().Add(awsIoTCredentialsRefreshMargin - time.Second)
+		}
+
+		return awsauth.Credentials{
+			AccessKeyID:     fmt.Sprintf("AKID%d", calls),
+			SecretAccessKey: "secret",
+			SessionToken:    fmt.Sprintf("token/%d", calls),
+			Expiration:      exp,
+		}, nil
+	}
+
+	opts := mqtt.NewClientOptions()
+	assert.NoError(a.Init(opts))
+	assert.Equal("0102030405060708", opts.ClientID)
+
+	t.Run("signed url", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(a.Update(opts))
+		assert.Equal(1, calls)
+		assert.Len(opts.Servers, 1)
+
+		u := opts.Servers[0]
+		assert.Equal("wss", u.Scheme)
+		assert.Equal("example-ats.iot.eu-west-1.amazonaws.com", u.Host)
+		assert.Equal("/mqtt", u.Path)
+
+		q := u.Query()
+		assert.Equal("AWS4-HMAC-SHA256", q.Get("X-Amz-Algorithm"))
+		assert.Equal("host", q.Get("X-Amz-SignedHeaders"))
+		assert.Regexp(`^AKID1/\d{8}/eu-west-1/iotdevicegateway/aws4_request$`, q.Get("X-Amz-Credential"))
+		assert.Len(q.Get("X-Amz-Signature"), 64)
+		assert.Equal("token/1", q.Get("X-Amz-Security-Token"))
+
+		// the security token is not part of the signed query
+		raw := u.RawQuery
+		assert.Regexp(`X-Amz-Signature=[0-9a-f]{64}&X-Amz-Security-Token=token%2F1$`, raw)
+	})
+
+	t.Run("reconnect after is limited", func(t *testing.T) {
+		assert := require.New(t)
+		assert.Equal(awsIoTMinReconnectAfter, a.ReconnectAfter())
+	})
+
+	t.Run("refresh on reconnect", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(a.Update(opts))
+		assert.Equal(2, calls)
+		assert.Len(opts.Servers, 1)
+
+		q := opts.Servers[0].Query()
+		assert.Regexp(`^AKID2/`, q.Get("X-Amz-Credential"))
+		assert.Equal("token/2", q.Get("X-Amz-Security-Token"))
+
+		reconnectAfter := a.ReconnectAfter()
+		assert.True(reconnectAfter > 9*time.Minute && reconnectAfter <= 10*time.Minute)
+	})
+
+	t.Run("valid credentials are re-used", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(a.Update(opts))
+		assert.Equal(2, calls)
+	})
+}
+
+func TestAWSIoTCustomAuthorizer(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Integration.MQTT.Auth.AWSIoT.Mode = "custom_authorizer"
+	conf.Integration.MQTT.Auth.AWSIoT.Endpoint = "example-ats.iot.eu-west-1.amazonaws.com"
+	conf.Integration.MQTT.Auth.AWSIoT.ClientID = "0102030405060708"
+	conf.Integration.MQTT.Auth.AWSIoT.Username = "gateway"
+	conf.Integration.MQTT.Auth.AWSIoT.AuthorizerName = "my-authorizer"
+	conf.Integration.MQTT.Auth.AWSIoT.AuthorizerTokenKeyName = "token"
+	conf.Integration.MQTT.Auth.AWSIoT.AuthorizerToken = "abc/123"
+	conf.Integration.MQTT.Auth.AWSIoT.AuthorizerSignature = "c2lnbmF0dXJl"
+
+	a, err := NewAWSIoTAuthentication(conf)
+	assert.NoError(err)
+
+	opts := mqtt.NewClientOptions()
+	assert.NoError(a.Init(opts))
+	assert.NoError(a.Update(opts))
+
+	assert.Equal([]*url.URL{{Scheme: "ssl", Host: "example-ats.iot.eu-west-1.amazonaws.com:443"}}, opts.Servers)
+	assert.Equal("gateway?x-amz-customauthorizer-name=my-authorizer&x-amz-customauthorizer-signature=c2lnbmF0dXJl&token=abc%2F123", opts.Username)
+	assert.Equal("abc/123", opts.Password)
+	assert.Equal([]string{"mqtt"}, opts.TLSConfig.NextProtos)
+	assert.Equal(time.Duration(0), a.ReconnectAfter())
+}
+
+func TestAWSIoTX509(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "aws-iot")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "0102030405060708"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+	assert.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600))
+	assert.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	var conf config.Config
+	conf.Integration.MQTT.Auth.AWSIoT.Mode = "x509"
+	conf.Integration.MQTT.Auth.AWSIoT.Endpoint = "example-ats.iot.eu-west-1.amazonaws.com"
+	conf.Integration.MQTT.Auth.AWSIoT.ClientID = "0102030405060708"
+	conf.Integration.MQTT.Auth.AWSIoT.TLSCert = certFile
+	conf.Integration.MQTT.Auth.AWSIoT.TLSKey = keyFile
+
+	a, err := NewAWSIoTAuthentication(conf)
+	assert.NoError(err)
+
+	opts := mqtt.NewClientOptions()
+	assert.NoError(a.Init(opts))
+	assert.NoError(a.Update(opts))
+
+	assert.Equal([]*url.URL{{Scheme: "ssl", Host: "example-ats.iot.eu-west-1.amazonaws.com:443"}}, opts.Servers)
+	assert.Equal([]string{"x-amzn-mqtt-ca"}, opts.TLSConfig.NextProtos)
+	assert.Len(opts.TLSConfig.Certificates, 1)
+	assert.Equal(time.Duration(0), a.ReconnectAfter())
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// See:
+// https://docs.microsoft.com/en-us/azure/iot-dps/iot-dps-mqtt-support
+const (
+	dpsAPIVersion       = "2019-03-31"
+	dpsResponseTopic    = "$dps/registrations/res/"
+	dpsDefaultRetry     = 3 * time.Second
+	dpsStatusAssigned   = "assigned"
+	dpsStatusAssigning  = "assigning"
+	dpsStatusUnassigned = "unassigned"
+)
+
+// dpsRegistrationState contains the IoT Hub assignment returned by the
+// Device Provisioning Service. It is also used as state-file format.
+type dpsRegistrationState struct {
+	AssignedHub string `json:"assignedHub"`
+	DeviceID    string `json:"deviceId"`
+}
+
+type dpsOperation struct {
+	OperationID       string               `json:"operationId"`
+	Status            string               `json:"status"`
+	RegistrationState dpsRegistrationState `json:"registrationState"`
+}
+
+// dpsResponse contains a (parsed) response received from the Device
+// Provisioning Service.
+type dpsResponse struct {
+	status     int
+	requestID  string
+	retryAfter time.Duration
+	operation  dpsOperation
+}
+
+// deriveDeviceKey derives the device key from the enrollment group key, as
+// documented by the Device Provisioning Service.
+func deriveDeviceKey(groupKey []byte, registrationID string) []byte {
+	mac := hmac.New(sha256.New, groupKey)
+	mac.Write([]byte(registrationID))
+	return mac.Sum(nil)
+}
+
+// parseDPSResponse parses the given response topic and payload, e.g.:
+// $dps/registrations/res/202/?$rid=1&retry-after=3
+func parseDPSResponse(topic string, payload []byte) (dpsResponse, error) {
+	var resp dpsResponse
+
+	if !strings.HasPrefix(topic, dpsResponseTopic) {
+		return resp, fmt.Errorf("unexpected topic: %s", topic)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(topic, dpsResponseTopic), "/?", 2)
+	if len(parts) != 2 {
+		return resp, fmt.Errorf("unexpected topic: %s", topic)
+	}
+
+	status, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return resp, errors.Wrap(err, "parse status error")
+	}
+	resp.status = status
+
+	query, err := url.ParseQuery(parts[1])
+	if err != nil {
+		return resp, errors.Wrap(err, "parse query error")
+	}
+	resp.requestID = query.Get("$rid")
+
+	resp.retryAfter = dpsDefaultRetry
+	if ra := query.Get("retry-after"); ra != "" {
+		if sec, err := strconv.Atoi(ra); err == nil && sec > 0 {
+			resp.retryAfter = time.Duration(sec) * time.Second
+		}
+	}
+
+	if status >= 300 {
+		return resp, fmt.Errorf("registration error, status: %d, response: %s", status, payload)
+	}
+
+	if err := json.Unmarshal(payload, &resp.operation); err != nil {
+		return resp, errors.Wrap(err, "unmarshal payload error")
+	}
+
+	return resp, nil
+}
+
+func readDPSStateFile(path string) (dpsRegistrationState, bool, error) {
+	var state dpsRegistrationState
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, false, nil
+		}
+		return state, false, errors.Wrap(err, "read state file error")
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, false, errors.Wrap(err, "unmarshal state file error")
+	}
+
+	return state, true, nil
+}
+
+func writeDPSStateFile(path string, state dpsRegistrationState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshal state error")
+	}
+
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return errors.Wrap(err, "write state file error")
+	}
+
+	return nil
+}
+
+// provisionAzureIoTHubDevice returns the IoT Hub assignment for the device.
+// When a state file is configured and contains the result of a previous
+// registration, this is returned. Otherwise the device is registered using
+// the Device Provisioning Service. The deviceKey is nil in case of X.509
+// authentication.
+func provisionAzureIoTHubDevice(conf config.AzureIoTHubProvisioning, tlsConfig *tls.Config, deviceKey []byte) (dpsRegistrationState, error) {
+	if conf.StateFile != "" {
+		state, ok, err := readDPSStateFile(conf.StateFile)
+		if err != nil {
+			return state, err
+		}
+		if ok {
+			log.WithFields(log.Fields{
+				"hostname":  state.AssignedHub,
+				"device_id": state.DeviceID,
+			}).Info("mqtt/auth: using azure iot hub assignment from state file")
+			return state, nil
+		}
+	}
+
+	state, err := registerDPSDevice(conf, tlsConfig, deviceKey)
+	if err != nil {
+		return state, err
+	}
+
+	log.WithFields(log.Fields{
+		"hostname":  state.AssignedHub,
+		"device_id": state.DeviceID,
+	}).Info("mqtt/auth: device registered using azure device provisioning service")
+
+	if conf.StateFile != "" {
+		if err := writeDPSStateFile(conf.StateFile, state); err != nil {
+			return state, err
+		}
+	}
+
+	return state, nil
+}
+
+// registerDPSDevice registers the device using the Device Provisioning
+// Service MQTT API.
+func registerDPSDevice(conf config.AzureIoTHubProvisioning, tlsConfig *tls.Config, deviceKey []byte) (dpsRegistrationState, error) {
+	var state dpsRegistrationState
+	var rid uint64
+	responses := make(chan mqtt.Message, 1)
+
+	log.WithFields(log.Fields{
+		"endpoint":        conf.Endpoint,
+		"id_scope":        conf.IDScope,
+		"registration_id": conf.RegistrationID,
+	}).Info("mqtt/auth: registering device using azure device provisioning service")
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(fmt.Sprintf("ssl://%s:8883", conf.Endpoint))
+	opts.SetClientID(conf.RegistrationID)
+	opts.SetUsername(fmt.Sprintf("%s/registrations/%s/api-version=%s", conf.IDScope, conf.RegistrationID, dpsAPIVersion))
+	opts.SetTLSConfig(tlsConfig)
+	opts.SetAutoReconnect(false)
+
+	if deviceKey != nil {
+		token, err := createSASToken(fmt.Sprintf("%s/registrations/%s", conf.IDScope, conf.RegistrationID), deviceKey, conf.Timeout)
+		if err != nil {
+			return state, errors.Wrap(err, "create SAS token error")
+		}
+		opts.SetPassword(token + "&skn=registration")
+	}
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); !token.WaitTimeout(conf.Timeout) || token.Error() != nil {
+		return state, errors.Wrap(tokenError(token), "connect to device provisioning service error")
+	}
+	defer client.Disconnect(250)
+
+	if token := client.Subscribe(dpsResponseTopic+"#", 1, func(c mqtt.Client, msg mqtt.Message) {
+		responses <- msg
+	}); !token.WaitTimeout(conf.Timeout) || token.Error() != nil {
+		return state, errors.Wrap(tokenError(token), "subscribe to device provisioning service error")
+	}
+
+	publish := func(topic string, payload []byte) error {
+		if token := client.Publish(topic, 1, false, payload); !token.WaitTimeout(conf.Timeout) || token.Error() != nil {
+			return tokenError(token)
+		}
+		return nil
+	}
+
+	payload, err := json.Marshal(struct {
+		RegistrationID string `json:"registrationId"`
+	}{conf.RegistrationID})
+	if err != nil {
+		return state, errors.Wrap(err, "marshal registration request error")
+	}
+
+	if err := publish(fmt.Sprintf("$dps/registrations/PUT/iotdps-register/?$rid=%d", atomic.AddUint64(&rid, 1)), payload); err != nil {
+		return state, errors.Wrap(err, "publish registration request error")
+	}
+
+	deadline := time.After(conf.Timeout)
+	for {
+		var msg mqtt.Message
+		select {
+		case msg = <-responses:
+		case <-deadline:
+			return state, errors.New("device provisioning service registration timeout")
+		}
+
+		resp, err := parseDPSResponse(msg.Topic(), msg.Payload())
+		if err != nil {
+			return state, err
+		}
+
+		switch resp.operation.Status {
+		case dpsStatusAssigned:
+			return resp.operation.RegistrationState, nil
+		case dpsStatusAssigning, dpsStatusUnassigned:
+			time.Sleep(resp.retryAfter)
+
+			topic := fmt.Sprintf("$dps/registrations/GET/iotdps-get-operationstatus/?$rid=%d&operationId=%s", atomic.AddUint64(&rid, 1), resp.operation.OperationID)
+			if err := publish(topic, nil); err != nil {
+				return state, errors.Wrap(err, "publish operation status request error")
+			}
+		default:
+			return state, fmt.Errorf("device provisioning service registration failed, status: %s", resp.operation.Status)
+		}
+	}
+}
+
+// tokenError returns the error of the given token, or a timeout error in
+// case the token did not complete.
+func tokenError(token mqtt.Token) error {
+	if err := token.Error(); err != nil {
+		return err
+	}
+	return errors.New("timeout")
+}
+
+// decodeProvisioningKey returns the device key to use for the DPS and IoT Hub
+// authentication. In case of an enrollment group, the device key is derived
+// from the group key.
+func decodeProvisioningKey(conf config.AzureIoTHubProvisioning) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(conf.SymmetricKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode symmetric key error")
+	}
+
+	if conf.EnrollmentGroup {
+		key = deriveDeviceKey(key, conf.RegistrationID)
+	}
+
+	return key, nil
+}
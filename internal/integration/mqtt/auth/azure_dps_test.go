@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestDecodeProvisioningKey(t *testing.T) {
+	assert := require.New(t)
+
+	conf := config.AzureIoTHubProvisioning{
+		RegistrationID: "0102030405060708",
+		SymmetricKey:   "c2VjcmV0LWdyb3VwLWtleQ==",
+	}
+
+	key, err := decodeProvisioningKey(conf)
+	assert.NoError(err)
+	assert.Equal("secret-group-key", string(key))
+
+	conf.EnrollmentGroup = true
+	key, err = decodeProvisioningKey(conf)
+	assert.NoError(err)
+	assert.Equal("BWeGnLYcCLHrm+FTyMHp1rrZHftUqQHq2Zs9YmhXjYo=", base64.StdEncoding.EncodeToString(key))
+}
+
+func TestParseDPSResponse(t *testing.T) {
+	tests := []struct {
+		Name             string
+		Topic            string
+		Payload          string
+		ExpectedResponse dpsResponse
+		ExpectedError    string
+	}{
+		{
+			Name:    "assigning",
+			Topic:   "$dps/registrations/res/202/?$rid=1&retry-after=5",
+			Payload: `{"operationId":"4.abc","status":"assigning"}`,
+			ExpectedResponse: dpsResponse{
+				status:     202,
+				requestID:  "1",
+				retryAfter: 5 * time.Second,
+				operation: dpsOperation{
+					OperationID: "4.abc",
+					Status:      "assigning",
+				},
+			},
+		},
+		{
+			Name:    "assigned",
+			Topic:   "$dps/registrations/res/200/?$rid=2",
+			Payload: `{"operationId":"4.abc","status":"assigned","registrationState":{"assignedHub":"test.azure-devices.net","deviceId":"0102030405060708"}}`,
+			ExpectedResponse: dpsResponse{
+				status:     200,
+				requestID:  "2",
+				retryAfter: dpsDefaultRetry,
+				operation: dpsOperation{
+					OperationID: "4.abc",
+					Status:      "assigned",
+					RegistrationState: dpsRegistrationState{
+						AssignedHub: "test.azure-devices.net",
+						DeviceID:    "0102030405060708",
+					},
+				},
+			},
+		},
+		{
+			Name:          "unauthorized",
+			Topic:         "$dps/registrations/res/401/?$rid=1",
+			Payload:       `{"errorCode":401002}`,
+			ExpectedError: `registration error, status: 401, response: {"errorCode":401002}`,
+		},
+		{
+			Name:          "unexpected topic",
+			Topic:         "devices/test/messages/devicebound",
+			ExpectedError: "unexpected topic: devices/test/messages/devicebound",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := parseDPSResponse(tst.Topic, []byte(tst.Payload))
+			if tst.ExpectedError != "" {
+				assert.EqualError(err, tst.ExpectedError)
+				return
+			}
+
+			assert.NoError(err)
+			assert.Equal(tst.ExpectedResponse, resp)
+		})
+	}
+}
+
+func TestProvisionAzureIoTHubDeviceStateFile(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "azure-dps")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	stateFile := filepath.Join(dir, "state.json")
+	state := dpsRegistrationState{
+		AssignedHub: "test.azure-devices.net",
+		DeviceID:    "0102030405060708",
+	}
+	assert.NoError(writeDPSStateFile(stateFile, state))
+
+	// the device must not be registered again as the state file exists
+	out, err := provisionAzureIoTHubDevice(config.AzureIoTHubProvisioning{
+		IDScope:        "0ne00000000",
+		RegistrationID: "0102030405060708",
+		Endpoint:       "localhost",
+		StateFile:      stateFile,
+		Timeout:        time.Second,
+	}, nil, nil)
+	assert.NoError(err)
+	assert.Equal(state, out)
+}
@@ -56,6 +56,8 @@ type AzureIoTHubAuthentication struct {
 	authType authType
 
 	clientID           string
+	deviceID           string
+	moduleID           string
 	username           string
 	deviceKey          []byte
 	hostname           string
@@ -81,6 +83,35 @@ func NewAzureIoTHubAuthentication(c config.Config) (Authentication, error) {
 
 	if conf.TLSCert != "" || conf.TLSKey != "" {
 		at = authTypeX509
+
+		kp, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls key-pair error")
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{kp}
+	}
+
+	// When the Device Provisioning Service is configured, the IoT Hub
+	// hostname and device ID are retrieved from the DPS registration.
+	if conf.Provisioning.IDScope != "" {
+		var deviceKey []byte
+		if at == authTypeSymmetric {
+			var err error
+			deviceKey, err = decodeProvisioningKey(conf.Provisioning)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode provisioning key error")
+			}
+			conf.DeviceKey = base64.StdEncoding.EncodeToString(deviceKey)
+		}
+
+		state, err := provisionAzureIoTHubDevice(conf.Provisioning, &tlsConfig, deviceKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "azure device provisioning error")
+		}
+
+		conf.Hostname = state.AssignedHub
+		conf.DeviceID = state.DeviceID
 	}
 
 	if at == authTypeSymmetric {
@@ -96,6 +127,8 @@ func NewAzureIoTHubAuthentication(c config.Config) (Authentication, error) {
 					conf.Hostname = v
 				case "DeviceId":
 					conf.DeviceID = v
+				case "ModuleId":
+					conf.ModuleID = v
 				case "SharedAccessKey":
 					conf.DeviceKey = v
 				}
@@ -111,19 +144,21 @@ func NewAzureIoTHubAuthentication(c config.Config) (Authentication, error) {
 		auth.sasTokenExpiration = conf.SASTokenExpiration
 	}
 
-	if at == authTypeX509 {
-		kp, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
-		if err != nil {
-			return nil, errors.Wrap(err, "load tls key-pair error")
-		}
-
-		tlsConfig.Certificates = []tls.Certificate{kp}
-	}
-
-	auth.clientID = conf.DeviceID
+	auth.authType = at
+	auth.deviceID = conf.DeviceID
+	auth.moduleID = conf.ModuleID
 	auth.hostname = conf.Hostname
 	auth.tlsConfig = &tlsConfig
-	auth.username = fmt.Sprintf("%s/%s", conf.Hostname, conf.DeviceID)
+
+	// When a module id is set, the module identity is used to authenticate.
+	// See: https://docs.microsoft.com/en-us/azure/iot-hub/iot-hub-mqtt-support#using-the-mqtt-protocol-directly-as-a-module
+	if conf.ModuleID != "" {
+		auth.clientID = fmt.Sprintf("%s/%s", conf.DeviceID, conf.ModuleID)
+		auth.username = fmt.Sprintf("%s/%s/%s", conf.Hostname, conf.DeviceID, conf.ModuleID)
+	} else {
+		auth.clientID = conf.DeviceID
+		auth.username = fmt.Sprintf("%s/%s", conf.Hostname, conf.DeviceID)
+	}
 
 	return &auth, nil
 }
@@ -144,8 +179,11 @@ func (a *AzureIoTHubAuthentication) Update(opts *mqtt.ClientOptions) error {
 	if a.authType == authTypeSymmetric {
 		resourceURI := fmt.Sprintf("%s/devices/%s",
 			a.hostname,
-			a.clientID,
+			a.deviceID,
 		)
+		if a.moduleID != "" {
+			resourceURI = fmt.Sprintf("%s/modules/%s", resourceURI, a.moduleID)
+		}
 		token, err := createSASToken(resourceURI, a.deviceKey, a.sasTokenExpiration)
 		if err != nil {
 			return errors.Wrap(err, "create SAS token error")
@@ -163,6 +201,17 @@ func (a *AzureIoTHubAuthentication) ReconnectAfter() time.Duration {
 	return a.sasTokenExpiration
 }
 
+// DeviceID returns the IoT Hub device id.
+func (a *AzureIoTHubAuthentication) DeviceID() string {
+	return a.deviceID
+}
+
+// ModuleID returns the IoT Hub module id. This returns an empty string
+// when the device identity is used.
+func (a *AzureIoTHubAuthentication) ModuleID() string {
+	return a.moduleID
+}
+
 func createSASToken(uri string, deviceKey []byte, expiration time.Duration) (string, error) {
 	encoded := url.QueryEscape(uri)
 	exp := time.Now().Add(expiration).Unix()
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 )
 
 func TestParseConnectionString(t *testing.T) {
@@ -44,3 +46,44 @@ func TestParseConnectionString(t *testing.T) {
 		})
 	}
 }
+
+func TestNewAzureIoTHubAuthentication(t *testing.T) {
+	tests := []struct {
+		Name             string
+		ConnectionString string
+		ExpectedClientID string
+		ExpectedUsername string
+		ExpectedModuleID string
+	}{
+		{
+			Name:             "device identity",
+			ConnectionString: "HostName=gateways-eu868.azure-devices.net;DeviceId=00800000a00016b6;SharedAccessKey=WWVQv+auegGaG2mm2/0FIS24xqkmZW/z5cYBO898+8I=",
+			ExpectedClientID: "00800000a00016b6",
+			ExpectedUsername: "gateways-eu868.azure-devices.net/00800000a00016b6",
+		},
+		{
+			Name:             "module identity",
+			ConnectionString: "HostName=gateways-eu868.azure-devices.net;DeviceId=edge-device;ModuleId=chirpstack-gateway-bridge;SharedAccessKey=WWVQv+auegGaG2mm2/0FIS24xqkmZW/z5cYBO898+8I=",
+			ExpectedClientID: "edge-device/chirpstack-gateway-bridge",
+			ExpectedUsername: "gateways-eu868.azure-devices.net/edge-device/chirpstack-gateway-bridge",
+			ExpectedModuleID: "chirpstack-gateway-bridge",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var conf config.Config
+			conf.Integration.MQTT.Auth.AzureIoTHub.DeviceConnectionString = tst.ConnectionString
+
+			a, err := NewAzureIoTHubAuthentication(conf)
+			assert.NoError(err)
+
+			azureAuth := a.(*AzureIoTHubAuthentication)
+			assert.Equal(tst.ExpectedClientID, azureAuth.clientID)
+			assert.Equal(tst.ExpectedUsername, azureAuth.username)
+			assert.Equal(tst.ExpectedModuleID, azureAuth.ModuleID())
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clientCertificateGenerator generates the MQTT client certificates, signed
+// by the configured CA.
+type clientCertificateGenerator struct {
+	caCert     *x509.Certificate
+	caKey      crypto.Signer
+	commonName string
+	lifetime   time.Duration
+}
+
+func newClientCertificateGenerator(caCertFile, caKeyFile, commonName string, lifetime time.Duration) (*clientCertificateGenerator, error) {
+	kp, err := tls.LoadX509KeyPair(caCertFile, caKeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "load ca key-pair error")
+	}
+
+	caCert, err := x509.ParseCertificate(kp.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "parse ca certificate error")
+	}
+
+	caKey, ok := kp.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("ca key does not implement crypto.Signer")
+	}
+
+	return &clientCertificateGenerator{
+		caCert:     caCert,
+		caKey:      caKey,
+		commonName: commonName,
+		lifetime:   lifetime,
+	}, nil
+}
+
+// generate generates a new client certificate (and key), valid from the
+// given time for the configured lifetime.
+func (g *clientCertificateGenerator) generate(now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "generate key error")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "generate serial number error")
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: g.commonName,
+		},
+		NotBefore:   now,
+		NotAfter:    now.Add(g.lifetime),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, g.caCert, key.Public(), g.caKey)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "create certificate error")
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "parse certificate error")
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der, g.caCert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
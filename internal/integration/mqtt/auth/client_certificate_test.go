@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertificateGenerator(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "client-certificate")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	caTmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, &caTmpl, &caTmpl, caKey.Public(), caKey)
+	assert.NoError(err)
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	assert.NoError(err)
+
+	caCertFile := filepath.Join(dir, "ca.pem")
+	caKeyFile := filepath.Join(dir, "ca-key.pem")
+	assert.NoError(ioutil.WriteFile(caCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	assert.NoError(ioutil.WriteFile(caKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}), 0600))
+
+	g, err := newClientCertificateGenerator(caCertFile, caKeyFile, "0102030405060708", time.Hour)
+	assert.NoError(err)
+
+	now := time.Now()
+	cert, err := g.generate(now)
+	assert.NoError(err)
+	assert.Len(cert.Certificate, 2)
+	assert.Equal("0102030405060708", cert.Leaf.Subject.CommonName)
+	assert.True(cert.Leaf.NotAfter.Sub(now.Add(time.Hour)) < time.Second)
+
+	ca, err := x509.ParseCertificate(caDER)
+	assert.NoError(err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(err)
+}
@@ -2,11 +2,15 @@ package auth
 
 import (
 	"crypto/tls"
+	"net/url"
+	"strings"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/certreload"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 )
 
@@ -19,32 +23,61 @@ type GenericAuthentication struct {
 	clientID     string
 
 	tlsConfig *tls.Config
+	certs     *certreload.Reloader
+
+	// When configured, the client certificate is generated (and renewed
+	// before it expires) using the configured CA.
+	certGenerator *clientCertificateGenerator
+	certLifetime  time.Duration
+	renewBefore   time.Duration
+	certExpiry    time.Time
 }
 
 // NewGenericAuthentication creates a GenericAuthentication.
 func NewGenericAuthentication(conf config.Config) (Authentication, error) {
-	tlsConfig, err := newTLSConfig(
-		conf.Integration.MQTT.Auth.Generic.CACert,
-		conf.Integration.MQTT.Auth.Generic.TLSCert,
-		conf.Integration.MQTT.Auth.Generic.TLSKey,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "mqtt/auth: new tls config error")
-	}
-
-	return &GenericAuthentication{
-		tlsConfig:    tlsConfig,
+	a := GenericAuthentication{
 		servers:      conf.Integration.MQTT.Auth.Generic.Servers,
 		username:     conf.Integration.MQTT.Auth.Generic.Username,
 		password:     conf.Integration.MQTT.Auth.Generic.Password,
 		cleanSession: conf.Integration.MQTT.Auth.Generic.CleanSession,
 		clientID:     conf.Integration.MQTT.Auth.Generic.ClientID,
-	}, nil
+	}
+
+	// the certificates are reloaded when modified, such that these can be
+	// rotated without a restart
+	var err error
+	generic := conf.Integration.MQTT.Auth.Generic
+	if generic.CACert != "" || generic.TLSCert != "" || generic.TLSKey != "" {
+		a.certs, err = certreload.New(generic.CACert, generic.TLSCert, generic.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "mqtt/auth: new tls config error")
+		}
+		a.tlsConfig = a.certs.ClientConfig()
+	}
+
+	if cc := conf.Integration.MQTT.Auth.Generic.ClientCertificate; cc.CAKey != "" {
+		a.certGenerator, err = newClientCertificateGenerator(cc.CACert, cc.CAKey, cc.CommonName, cc.Lifetime)
+		if err != nil {
+			return nil, errors.Wrap(err, "mqtt/auth: new client certificate generator error")
+		}
+		a.certLifetime = cc.Lifetime
+		a.renewBefore = cc.RenewBefore
+
+		if a.tlsConfig == nil {
+			a.tlsConfig = &tls.Config{}
+		}
+	}
+
+	return &a, nil
 }
 
 // Init applies the initial configuration.
 func (a *GenericAuthentication) Init(opts *mqtt.ClientOptions) error {
 	for _, server := range a.servers {
+		if u, ok := unixSocketURL(server); ok {
+			opts.Servers = append(opts.Servers, u)
+			continue
+		}
 		opts.AddBroker(server)
 	}
 	opts.SetUsername(a.username)
@@ -59,13 +92,71 @@ func (a *GenericAuthentication) Init(opts *mqtt.ClientOptions) error {
 	return nil
 }
 
-// Update updates the authentication options.
+// Update updates the authentication options. When the client certificate
+// is generated, a new certificate is generated when the current certificate
+// expires within the renew before duration.
 func (a *GenericAuthentication) Update(opts *mqtt.ClientOptions) error {
+	if a.certs != nil {
+		// the client certificate is reloaded on each TLS handshake, the
+		// CA certificate is reloaded on (re)connect
+		a.tlsConfig = a.certs.ClientConfig()
+		if a.certGenerator == nil {
+			opts.SetTLSConfig(a.tlsConfig)
+		}
+	}
+
+	if a.certGenerator == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if a.certExpiry.Sub(now) > a.renewBefore {
+		return nil
+	}
+
+	cert, err := a.certGenerator.generate(now)
+	if err != nil {
+		return errors.Wrap(err, "generate client certificate error")
+	}
+	a.certExpiry = cert.Leaf.NotAfter
+
+	log.WithFields(log.Fields{
+		"common_name": cert.Leaf.Subject.CommonName,
+		"expires_at":  a.certExpiry,
+	}).Info("mqtt/auth: client certificate generated")
+
+	// The tls.Config must not be modified once in use.
+	tlsConfig := a.tlsConfig.Clone()
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	tlsConfig.GetClientCertificate = nil
+	opts.SetTLSConfig(tlsConfig)
+
 	return nil
 }
 
+// unixSocketURL returns the broker URL for the given unix:// server (e.g.
+// unix:///var/run/mosquitto/mqtt.sock). The MQTT client dials the host of
+// the URL, therefore the path of the socket is set as host. It returns false
+// when the given server is not a unix socket.
+func unixSocketURL(server string) (*url.URL, bool) {
+	if !strings.HasPrefix(server, "unix://") {
+		return nil, false
+	}
+
+	path := strings.TrimPrefix(server, "unix://")
+	return &url.URL{
+		Scheme: "unix",
+		Host:   path,
+		Opaque: "//" + path, // such that String() returns the configured server
+	}, true
+}
+
 // ReconnectAfter returns a time.Duration after which the MQTT client must re-connect.
 // Note: return 0 to disable the periodical re-connect feature.
 func (a *GenericAuthentication) ReconnectAfter() time.Duration {
+	if a.certGenerator != nil {
+		// re-connect (with a renewed certificate) before the certificate expires
+		return a.certLifetime - a.renewBefore
+	}
 	return 0
 }
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestGenericAuthenticationUnixSocket(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Integration.MQTT.Auth.Generic.Servers = []string{
+		"unix:///var/run/mosquitto/mqtt.sock",
+		"tcp://127.0.0.1:1883",
+	}
+
+	a, err := NewGenericAuthentication(conf)
+	assert.NoError(err)
+
+	opts := mqtt.NewClientOptions()
+	assert.NoError(a.Init(opts))
+	assert.Len(opts.Servers, 2)
+
+	assert.Equal("unix", opts.Servers[0].Scheme)
+	assert.Equal("/var/run/mosquitto/mqtt.sock", opts.Servers[0].Host)
+	assert.Equal("unix:///var/run/mosquitto/mqtt.sock", opts.Servers[0].String())
+
+	assert.Equal("tcp", opts.Servers[1].Scheme)
+	assert.Equal("127.0.0.1:1883", opts.Servers[1].Host)
+}
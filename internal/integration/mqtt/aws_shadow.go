@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/lorawan"
+)
+
+// awsShadowUpdateTopic defines the AWS IoT device shadow update topic.
+// See: https://docs.aws.amazon.com/iot/latest/developerguide/device-shadow-mqtt.html
+const awsShadowUpdateTopic = "$aws/things/%s/shadow/update"
+
+// awsShadowEvents contains the events which are reported to the device
+// shadow.
+var awsShadowEvents = map[string]struct{}{
+	"stats": {},
+	"conn":  {},
+}
+
+// awsShadowUpdate defines the shadow update document.
+type awsShadowUpdate struct {
+	State struct {
+		Reported map[string]json.RawMessage `json:"reported"`
+	} `json:"state"`
+}
+
+// newAWSShadowUpdate returns the shadow update document in which the given
+// message is reported under the event key, e.g. state.reported.stats.
+func newAWSShadowUpdate(event string, msg proto.Message) ([]byte, error) {
+	m := jsonpb.Marshaler{
+		EmitDefaults: true,
+	}
+	str, err := m.MarshalToString(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal message error")
+	}
+
+	var doc awsShadowUpdate
+	doc.State.Reported = map[string]json.RawMessage{
+		event: json.RawMessage(str),
+	}
+
+	return json.Marshal(doc)
+}
+
+// updateAWSShadow reports the given event to the device shadow of the
+// gateway. This is a no-op when the shadow reporter is disabled or the event
+// is not reported to the shadow.
+func (b *Backend) updateAWSShadow(gatewayID lorawan.EUI64, event string, msg proto.Message) {
+	if b.awsThingNameTemplate == nil {
+		return
+	}
+
+	if _, ok := awsShadowEvents[event]; !ok {
+		return
+	}
+
+	if err := b.publishAWSShadowUpdate(b.awsThingNameTemplate, gatewayID, event, msg); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"event":      event,
+		}).Error("integration/mqtt: update aws iot device shadow error")
+	}
+}
+
+func (b *Backend) publishAWSShadowUpdate(thingNameTemplate *template.Template, gatewayID lorawan.EUI64, event string, msg proto.Message) error {
+	thingName := bytes.NewBuffer(nil)
+	if err := thingNameTemplate.Execute(thingName, struct {
+		GatewayID lorawan.EUI64
+	}{gatewayID}); err != nil {
+		return errors.Wrap(err, "execute thing name template error")
+	}
+
+	payload, err := newAWSShadowUpdate(event, msg)
+	if err != nil {
+		return errors.Wrap(err, "new shadow update error")
+	}
+
+	if !b.conn.IsConnectionOpen() {
+		return errors.New("not connected")
+	}
+
+	topic := fmt.Sprintf(awsShadowUpdateTopic, thingName.String())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"event":      event,
+		"topic":      topic,
+	}).Debug("integration/mqtt: updating aws iot device shadow")
+
+	if token := b.conn.Publish(topic, b.qos, false, payload); token.Wait() && token.Error() != nil {
+		return errors.Wrap(token.Error(), "publish error")
+	}
+
+	mqttAWSShadowUpdateCounter(event).Inc()
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestNewAWSShadowUpdate(t *testing.T) {
+	assert := require.New(t)
+
+	b, err := newAWSShadowUpdate("stats", &gw.GatewayStats{
+		GatewayId:         []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		RxPacketsReceived: 10,
+	})
+	assert.NoError(err)
+
+	var doc struct {
+		State struct {
+			Reported struct {
+				Stats struct {
+					GatewayID         string `json:"gatewayId"`
+					RxPacketsReceived int    `json:"rxPacketsReceived"`
+				} `json:"stats"`
+			} `json:"reported"`
+		} `json:"state"`
+	}
+	assert.NoError(json.Unmarshal(b, &doc))
+	assert.Equal("AQIDBAUGBwg=", doc.State.Reported.Stats.GatewayID)
+	assert.Equal(10, doc.State.Reported.Stats.RxPacketsReceived)
+}
@@ -0,0 +1,108 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Azure IoT Hub direct method topics.
+// See: https://docs.microsoft.com/en-us/azure/iot-hub/iot-hub-mqtt-support#respond-to-a-direct-method
+const (
+	azureDirectMethodPrefix         = "$iothub/methods/POST/"
+	azureDirectMethodTopic          = azureDirectMethodPrefix + "#"
+	azureDirectMethodResponseFormat = "$iothub/methods/res/%d/?$rid=%s"
+)
+
+// azureDirectMethodResponse contains the direct method response payload.
+type azureDirectMethodResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// parseAzureDirectMethodTopic returns the method name and request id from
+// the given direct method topic.
+// Example: $iothub/methods/POST/downlink/?$rid=1
+func parseAzureDirectMethodTopic(topic string) (string, string, error) {
+	if !strings.HasPrefix(topic, azureDirectMethodPrefix) {
+		return "", "", fmt.Errorf("topic %s is not a direct method topic", topic)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(topic, azureDirectMethodPrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("method name is missing in topic %s", topic)
+	}
+
+	query, err := url.ParseQuery(strings.TrimPrefix(parts[1], "?"))
+	if err != nil {
+		return "", "", errors.Wrap(err, "parse query error")
+	}
+
+	rid := query.Get("$rid")
+	if rid == "" {
+		return "", "", fmt.Errorf("request id is missing in topic %s", topic)
+	}
+
+	return parts[0], rid, nil
+}
+
+func (b *Backend) handleAzureDirectMethod(c paho.Client, msg paho.Message) {
+	method, rid, err := parseAzureDirectMethodTopic(msg.Topic())
+	if err != nil {
+		log.WithError(err).WithField("topic", msg.Topic()).Error("integration/mqtt: parse direct method topic error")
+		return
+	}
+
+	status := http.StatusOK
+
+	switch method {
+	case "downlink":
+		mqttCommandCounter("down").Inc()
+		err = b.handleDownlinkFrame(c, msg)
+	case "config":
+		mqttCommandCounter("config").Inc()
+		err = b.handleGatewayConfiguration(c, msg)
+	case "exec":
+		err = b.handleGatewayCommandExecRequest(c, msg)
+	default:
+		status = http.StatusNotFound
+		err = fmt.Errorf("unknown method: %s", method)
+	}
+
+	var resp azureDirectMethodResponse
+	if err != nil {
+		if status == http.StatusOK {
+			status = http.StatusBadRequest
+		}
+		resp.Error = err.Error()
+
+		log.WithError(err).WithFields(log.Fields{
+			"method": method,
+			"rid":    rid,
+		}).Error("integration/mqtt: handle direct method error")
+	}
+
+	bb, err := json.Marshal(resp)
+	if err != nil {
+		log.WithError(err).Error("integration/mqtt: marshal direct method response error")
+		return
+	}
+
+	topic := fmt.Sprintf(azureDirectMethodResponseFormat, status, rid)
+
+	log.WithFields(log.Fields{
+		"method": method,
+		"rid":    rid,
+		"status": status,
+		"topic":  topic,
+	}).Info("integration/mqtt: publishing direct method response")
+
+	if token := c.Publish(topic, b.qos, false, bb); token.Wait() && token.Error() != nil {
+		log.WithError(token.Error()).WithField("topic", topic).Error("integration/mqtt: publish direct method response error")
+	}
+}
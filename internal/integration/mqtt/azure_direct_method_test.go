@@ -0,0 +1,177 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+)
+
+type testMessage struct {
+	paho.Message
+
+	topic   string
+	payload []byte
+}
+
+func (m testMessage) Topic() string {
+	return m.topic
+}
+
+func (m testMessage) Payload() []byte {
+	return m.payload
+}
+
+type testPublish struct {
+	topic   string
+	payload []byte
+}
+
+type testClient struct {
+	paho.Client
+
+	published []testPublish
+}
+
+func (c *testClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.published = append(c.published, testPublish{topic: topic, payload: payload.([]byte)})
+	return &paho.DummyToken{}
+}
+
+func TestParseAzureDirectMethodTopic(t *testing.T) {
+	tests := []struct {
+		Name           string
+		Topic          string
+		ExpectedMethod string
+		ExpectedRID    string
+		ExpectedError  error
+	}{
+		{
+			Name:           "valid topic",
+			Topic:          "$iothub/methods/POST/downlink/?$rid=1",
+			ExpectedMethod: "downlink",
+			ExpectedRID:    "1",
+		},
+		{
+			Name:          "missing rid",
+			Topic:         "$iothub/methods/POST/downlink/",
+			ExpectedError: errors.New("request id is missing in topic $iothub/methods/POST/downlink/"),
+		},
+		{
+			Name:          "missing method",
+			Topic:         "$iothub/methods/POST/",
+			ExpectedError: errors.New("method name is missing in topic $iothub/methods/POST/"),
+		},
+		{
+			Name:          "not a direct method",
+			Topic:         "devices/0102030405060708/messages/devicebound/down",
+			ExpectedError: errors.New("topic devices/0102030405060708/messages/devicebound/down is not a direct method topic"),
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			method, rid, err := parseAzureDirectMethodTopic(tst.Topic)
+			if tst.ExpectedError != nil {
+				assert.Error(err)
+				assert.Equal(tst.ExpectedError.Error(), err.Error())
+				return
+			}
+
+			assert.NoError(err)
+			assert.Equal(tst.ExpectedMethod, method)
+			assert.Equal(tst.ExpectedRID, rid)
+		})
+	}
+}
+
+func TestHandleAzureDirectMethod(t *testing.T) {
+	assert := require.New(t)
+
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.MQTT.EventTopicTemplate = "gateway/{{ .GatewayID }}/event/{{ .EventType }}"
+	conf.Integration.MQTT.CommandTopicTemplate = "gateway/{{ .GatewayID }}/command/#"
+
+	b := Backend{
+		downlinkFrameChan:             make(chan gw.DownlinkFrame, 1),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration, 1),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest, 1),
+	}
+	var err error
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	assert.NoError(err)
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	downlink := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+	}
+	downlinkB, err := b.marshal(&downlink)
+	assert.NoError(err)
+
+	tests := []struct {
+		Name             string
+		Topic            string
+		Payload          []byte
+		ExpectedTopic    string
+		ExpectedResponse azureDirectMethodResponse
+		ExpectedDownlink *gw.DownlinkFrame
+	}{
+		{
+			Name:             "downlink",
+			Topic:            "$iothub/methods/POST/downlink/?$rid=10",
+			Payload:          downlinkB,
+			ExpectedTopic:    "$iothub/methods/res/200/?$rid=10",
+			ExpectedDownlink: &downlink,
+		},
+		{
+			Name:          "invalid downlink payload",
+			Topic:         "$iothub/methods/POST/downlink/?$rid=11",
+			Payload:       []byte("foo"),
+			ExpectedTopic: "$iothub/methods/res/400/?$rid=11",
+		},
+		{
+			Name:          "unknown method",
+			Topic:         "$iothub/methods/POST/reboot/?$rid=12",
+			Payload:       []byte("{}"),
+			ExpectedTopic: "$iothub/methods/res/404/?$rid=12",
+			ExpectedResponse: azureDirectMethodResponse{
+				Error: "unknown method: reboot",
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			c := testClient{}
+			b.handleCommand(&c, testMessage{topic: tst.Topic, payload: tst.Payload})
+
+			assert.Len(c.published, 1)
+			assert.Equal(tst.ExpectedTopic, c.published[0].topic)
+
+			var resp azureDirectMethodResponse
+			assert.NoError(json.Unmarshal(c.published[0].payload, &resp))
+			if tst.ExpectedResponse.Error != "" {
+				assert.Equal(tst.ExpectedResponse, resp)
+			}
+
+			if tst.ExpectedDownlink != nil {
+				received := <-b.downlinkFrameChan
+				assert.Equal(*tst.ExpectedDownlink, received)
+			} else {
+				assert.NotEqual("", resp.Error)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package mqtt
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"strings"
 	"sync"
 	"text/template"
@@ -10,14 +12,16 @@ import (
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gofrs/uuid"
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/mqtt/auth"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/tracing"
 	"github.com/brocaar/lorawan"
 )
 
@@ -35,13 +39,52 @@ type Backend struct {
 	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
 	gateways                      map[lorawan.EUI64]struct{}
 	terminateOnConnectError       bool
+	eventBuffer                   *eventBuffer
+	storeAndForward               *storeAndForward
 
+	// failover is set when the broker failover is managed by the
+	// integration (round-robin or fail-back to the primary broker).
+	failover *brokerFailover
+
+	// healthName contains the name under which the connection state is
+	// reported to the health package.
+	healthName string
+
+	authType             string
 	qos                  uint8
+	protocolVersion      int
+	v5                   v5Options
+	userProperties       bool
 	eventTopicTemplate   *template.Template
 	commandTopicTemplate *template.Template
 
-	marshal   func(msg proto.Message) ([]byte, error)
-	unmarshal func(b []byte, msg proto.Message) error
+	// eventQOS contains the per event-type QoS (overriding qos) and
+	// retainedEvents the event types which are published as retained
+	// message.
+	eventQOS       map[string]uint8
+	retainedEvents map[string]bool
+
+	// sharedSubscriptionGroup is set when the command topics must be
+	// subscribed using a shared subscription.
+	sharedSubscriptionGroup string
+
+	// awsThingNameTemplate is set when the AWS IoT device shadow reporter
+	// is enabled.
+	awsThingNameTemplate *template.Template
+
+	// marshalers contains the per event-type marshalers, marshal and
+	// unmarshal are the functions of the default marshaler.
+	marshalers marshaler.Set
+	marshal    func(msg proto.Message) ([]byte, error)
+	unmarshal  func(b []byte, msg proto.Message) error
+
+	// compressor is set when the event payloads must be compressed.
+	compressor *compressor
+
+	// remoteConfigTopic and remoteConfigStateTopic are set when the remote
+	// configuration is enabled.
+	remoteConfigTopic      string
+	remoteConfigStateTopic string
 }
 
 // NewBackend creates a new Backend.
@@ -49,7 +92,18 @@ func NewBackend(conf config.Config) (*Backend, error) {
 	var err error
 
 	b := Backend{
-		qos:                           conf.Integration.MQTT.Auth.Generic.QOS,
+		authType:        conf.Integration.MQTT.Auth.Type,
+		qos:             conf.Integration.MQTT.Auth.Generic.QOS,
+		eventQOS:        conf.Integration.MQTT.EventQOS,
+		retainedEvents:  make(map[string]bool),
+		protocolVersion: conf.Integration.MQTT.ProtocolVersion,
+		userProperties:  conf.Integration.MQTT.V5.UserProperties,
+		v5: v5Options{
+			topicAliasMaximum: conf.Integration.MQTT.V5.TopicAliasMaximum,
+			messageExpiry:     uint32(conf.Integration.MQTT.V5.MessageExpiryInterval / time.Second),
+			sessionExpiry:     uint32(conf.Integration.MQTT.V5.SessionExpiryInterval / time.Second),
+		},
+		sharedSubscriptionGroup:       conf.Integration.MQTT.SharedSubscriptionGroup,
 		terminateOnConnectError:       conf.Integration.MQTT.TerminateOnConnectError,
 		clientOpts:                    paho.NewClientOptions(),
 		downlinkFrameChan:             make(chan gw.DownlinkFrame),
@@ -57,6 +111,16 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
 		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
 		gateways:                      make(map[lorawan.EUI64]struct{}),
+		eventBuffer:                   newEventBuffer(conf.Integration.MQTT.EventBuffer.MaxCount, conf.Integration.MQTT.EventBuffer.MaxAge),
+	}
+
+	for _, event := range conf.Integration.MQTT.RetainedEvents {
+		b.retainedEvents[event] = true
+	}
+
+	b.healthName = "mqtt"
+	if conf.Integration.IsMirror {
+		b.healthName = health.MirrorPrefix + "mqtt"
 	}
 
 	switch conf.Integration.MQTT.Auth.Type {
@@ -81,37 +145,65 @@ func NewBackend(conf config.Config) (*Backend, error) {
 
 		conf.Integration.MQTT.EventTopicTemplate = "devices/{{ .GatewayID }}/messages/events/{{ .EventType }}"
 		conf.Integration.MQTT.CommandTopicTemplate = "devices/{{ .GatewayID }}/messages/devicebound/#"
-	default:
-		return nil, fmt.Errorf("integration/mqtt: unknown auth type: %s", conf.Integration.MQTT.Auth.Type)
-	}
 
-	switch conf.Integration.Marshaler {
-	case "json":
-		b.marshal = func(msg proto.Message) ([]byte, error) {
-			marshaler := &jsonpb.Marshaler{
-				EnumsAsInts:  false,
-				EmitDefaults: true,
-			}
-			str, err := marshaler.MarshalToString(msg)
-			return []byte(str), err
+		// When using the module identity, the topics are prefixed by the
+		// device and module id.
+		if a, ok := b.auth.(*auth.AzureIoTHubAuthentication); ok && a.ModuleID() != "" {
+			conf.Integration.MQTT.EventTopicTemplate = fmt.Sprintf("devices/%s/modules/%s/messages/events/{{ .EventType }}", a.DeviceID(), a.ModuleID())
+			conf.Integration.MQTT.CommandTopicTemplate = fmt.Sprintf("devices/%s/modules/%s/messages/devicebound/#", a.DeviceID(), a.ModuleID())
 		}
 
-		b.unmarshal = func(b []byte, msg proto.Message) error {
-			unmarshaler := &jsonpb.Unmarshaler{
-				AllowUnknownFields: true, // we don't want to fail on unknown fields
-			}
-			return unmarshaler.Unmarshal(bytes.NewReader(b), msg)
+		// Commands are received as direct methods instead of
+		// cloud-to-device messages.
+		if conf.Integration.MQTT.Auth.AzureIoTHub.DirectMethods {
+			conf.Integration.MQTT.CommandTopicTemplate = azureDirectMethodTopic
+		}
+	case "aws_iot":
+		b.auth, err = auth.NewAWSIoTAuthentication(conf)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/mqtt: new aws iot authentication error")
 		}
-	case "protobuf":
-		b.marshal = func(msg proto.Message) ([]byte, error) {
-			return proto.Marshal(msg)
+
+		// AWS IoT Core reserves the topics starting with $ (e.g. for the
+		// device shadow), these can't be used for events and commands.
+		for _, t := range []string{conf.Integration.MQTT.EventTopicTemplate, conf.Integration.MQTT.CommandTopicTemplate} {
+			if strings.HasPrefix(t, "$") {
+				return nil, fmt.Errorf("integration/mqtt: topic template '%s' is reserved by aws iot", t)
+			}
 		}
 
-		b.unmarshal = func(b []byte, msg proto.Message) error {
-			return proto.Unmarshal(b, msg)
+		if conf.Integration.MQTT.Auth.AWSIoT.Shadow.Enabled {
+			b.awsThingNameTemplate, err = template.New("thing").Parse(conf.Integration.MQTT.Auth.AWSIoT.Shadow.ThingNameTemplate)
+			if err != nil {
+				return nil, errors.Wrap(err, "integration/mqtt: parse thing name template error")
+			}
 		}
 	default:
-		return nil, fmt.Errorf("integration/mqtt: unknown marshaler: %s", conf.Integration.Marshaler)
+		return nil, fmt.Errorf("integration/mqtt: unknown auth type: %s", conf.Integration.MQTT.Auth.Type)
+	}
+
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/mqtt: %s", err)
+	}
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	b.compressor, err = newCompressor(conf.Integration.MQTT.Compression.Algorithm, conf.Integration.MQTT.Compression.MinSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/mqtt: new compressor error")
+	}
+
+	if conf.Integration.MQTT.StoreAndForward.Path != "" {
+		b.storeAndForward, err = newStoreAndForward(
+			conf.Integration.MQTT.StoreAndForward.Path,
+			conf.Integration.MQTT.StoreAndForward.MaxSize,
+			conf.Integration.MQTT.StoreAndForward.MaxAge,
+			conf.Integration.MQTT.StoreAndForward.ReplayRetention,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/mqtt: open store-and-forward error")
+		}
 	}
 
 	b.eventTopicTemplate, err = template.New("event").Parse(conf.Integration.MQTT.EventTopicTemplate)
@@ -124,6 +216,18 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		return nil, errors.Wrap(err, "integration/mqtt: parse event-topic template error")
 	}
 
+	if conf.Integration.MQTT.RemoteConfig.Enabled {
+		b.remoteConfigTopic, err = remoteConfigTopic(conf.Integration.MQTT.RemoteConfig.ConfigTopicTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/mqtt: remote configuration topic error")
+		}
+
+		b.remoteConfigStateTopic, err = remoteConfigTopic(conf.Integration.MQTT.RemoteConfig.StateTopicTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration/mqtt: remote configuration state topic error")
+		}
+	}
+
 	b.clientOpts.SetProtocolVersion(4)
 	b.clientOpts.SetAutoReconnect(true) // this is required for buffering messages in case offline!
 	b.clientOpts.SetOnConnectHandler(b.onConnected)
@@ -134,9 +238,22 @@ func NewBackend(conf config.Config) (*Backend, error) {
 		return nil, errors.Wrap(err, "mqtt: init authentication error")
 	}
 
+	// Without round-robin or fail-back, the failover to the next broker is
+	// handled by the MQTT client.
+	generic := conf.Integration.MQTT.Auth.Generic
+	if b.authType == "generic" && len(b.clientOpts.Servers) > 1 && (generic.RoundRobin || generic.PrimaryCheckInterval != 0) {
+		b.failover = newBrokerFailover(b.clientOpts.Servers, generic.RoundRobin)
+	}
+
+	health.SetIntegrationConnected(b.healthName, false)
+
 	b.connectLoop()
 	go b.reconnectLoop()
 
+	if b.failover != nil && !generic.RoundRobin {
+		go b.primaryCheckLoop(generic.PrimaryCheckInterval)
+	}
+
 	return &b, nil
 }
 
@@ -147,6 +264,13 @@ func (b *Backend) Close() error {
 	b.Unlock()
 
 	b.conn.Disconnect(250)
+
+	if b.storeAndForward != nil {
+		if err := b.storeAndForward.close(); err != nil {
+			return errors.Wrap(err, "close store-and-forward error")
+		}
+	}
+
 	return nil
 }
 
@@ -214,51 +338,131 @@ func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64
 	return nil
 }
 
-func (b *Backend) subscribeGateway(gatewayID lorawan.EUI64) error {
+// commandTopic returns the command topic (filter) of the given gateway. When
+// a shared subscription group is configured, the topic is prefixed by
+// $share/[group]/ such that each command is delivered to only one of the
+// subscribers of the group.
+func (b *Backend) commandTopic(gatewayID lorawan.EUI64) (string, error) {
 	topic := bytes.NewBuffer(nil)
 	if err := b.commandTopicTemplate.Execute(topic, struct{ GatewayID lorawan.EUI64 }{gatewayID}); err != nil {
-		return errors.Wrap(err, "execute command topic template error")
+		return "", errors.Wrap(err, "execute command topic template error")
+	}
+
+	if b.sharedSubscriptionGroup != "" {
+		return "$share/" + b.sharedSubscriptionGroup + "/" + topic.String(), nil
+	}
+
+	return topic.String(), nil
+}
+
+func (b *Backend) subscribeGateway(gatewayID lorawan.EUI64) error {
+	topic, err := b.commandTopic(gatewayID)
+	if err != nil {
+		return err
 	}
 	log.WithFields(log.Fields{
-		"topic": topic.String(),
+		"topic": topic,
 		"qos":   b.qos,
 	}).Info("integration/mqtt: subscribing to topic")
 
-	if token := b.conn.Subscribe(topic.String(), b.qos, b.handleCommand); token.Wait() && token.Error() != nil {
+	if token := b.conn.Subscribe(topic, b.qos, b.handleCommand); token.Wait() && token.Error() != nil {
 		return errors.Wrap(token.Error(), "subscribe topic error")
 	}
 	return nil
 }
 
 func (b *Backend) unsubscribeGateway(gatewayID lorawan.EUI64) error {
-	topic := bytes.NewBuffer(nil)
-	if err := b.commandTopicTemplate.Execute(topic, struct{ GatewayID lorawan.EUI64 }{gatewayID}); err != nil {
-		return errors.Wrap(err, "execute command topic template error")
+	topic, err := b.commandTopic(gatewayID)
+	if err != nil {
+		return err
 	}
 	log.WithFields(log.Fields{
-		"topic": topic.String(),
+		"topic": topic,
 	}).Info("integration/mqtt: unsubscribing from topic")
 
-	if token := b.conn.Unsubscribe(topic.String()); token.Wait() && token.Error() != nil {
+	if token := b.conn.Unsubscribe(topic); token.Wait() && token.Error() != nil {
 		return errors.Wrap(token.Error(), "unsubscribe topic error")
 	}
 
 	return nil
 }
 
+// Reload applies the event and command topic templates of the given
+// (reloaded) configuration. When the command topic template has changed, the
+// gateways are re-subscribed using the new topic. This is only supported
+// for the generic authentication type, as the other authentication types
+// define their own topics.
+func (b *Backend) Reload(conf config.Config) error {
+	if b.authType != "generic" {
+		return nil
+	}
+
+	eventTopicTemplate, err := template.New("event").Parse(conf.Integration.MQTT.EventTopicTemplate)
+	if err != nil {
+		return errors.Wrap(err, "integration/mqtt: parse event-topic template error")
+	}
+
+	commandTopicTemplate, err := template.New("command").Parse(conf.Integration.MQTT.CommandTopicTemplate)
+	if err != nil {
+		return errors.Wrap(err, "integration/mqtt: parse command-topic template error")
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.eventTopicTemplate = eventTopicTemplate
+
+	if b.commandTopicTemplate.Root.String() == commandTopicTemplate.Root.String() {
+		return nil
+	}
+
+	// When disconnected, the gateways are subscribed using the new topic
+	// on re-connect.
+	if b.conn == nil || !b.conn.IsConnectionOpen() {
+		b.commandTopicTemplate = commandTopicTemplate
+		return nil
+	}
+
+	for gatewayID := range b.gateways {
+		if err := b.unsubscribeGateway(gatewayID); err != nil {
+			log.WithError(err).WithField("gateway_id", gatewayID).Error("integration/mqtt: unsubscribe gateway error")
+		}
+	}
+
+	b.commandTopicTemplate = commandTopicTemplate
+
+	for gatewayID := range b.gateways {
+		if err := b.subscribeGateway(gatewayID); err != nil {
+			log.WithError(err).WithField("gateway_id", gatewayID).Error("integration/mqtt: subscribe gateway error")
+		}
+	}
+
+	log.Info("integration/mqtt: topic templates reloaded")
+
+	return nil
+}
+
 // PublishEvent publishes the given event.
 func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
 	mqttEventCounter(event).Inc()
 	idPrefix := map[string]string{
-		"up":    "uplink_",
-		"ack":   "downlink_",
-		"stats": "stats_",
-		"exec":  "exec_",
-		"raw":   "raw_",
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
 	}
-	return b.publish(gatewayID, event, log.Fields{
+	if err := b.publish(gatewayID, event, id, log.Fields{
 		idPrefix[event] + "id": id,
-	}, v)
+	}, v); err != nil {
+		return err
+	}
+
+	b.updateAWSShadow(gatewayID, event, v)
+
+	return nil
 }
 
 func (b *Backend) connect() error {
@@ -269,7 +473,35 @@ func (b *Backend) connect() error {
 		return errors.Wrap(err, "integration/mqtt: update authentication error")
 	}
 
-	b.conn = paho.NewClient(b.clientOpts)
+	if b.failover == nil {
+		return b.connectClient()
+	}
+
+	var err error
+	for _, i := range b.failover.order() {
+		server := b.failover.servers[i]
+		b.clientOpts.Servers = []*url.URL{server}
+
+		if err = b.connectClient(); err == nil {
+			b.failover.setCurrent(i)
+			log.WithField("server", server.String()).Info("integration/mqtt: selected mqtt broker")
+			return nil
+		}
+
+		log.WithError(err).WithField("server", server.String()).Error("integration/mqtt: connect to mqtt broker error")
+	}
+
+	return err
+}
+
+// connectClient creates a new client and connects to the broker(s) of the
+// client options.
+func (b *Backend) connectClient() error {
+	if b.protocolVersion == 5 {
+		b.conn = newV5Client(b.clientOpts, b.v5)
+	} else {
+		b.conn = paho.NewClient(b.clientOpts)
+	}
 	if token := b.conn.Connect(); token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
@@ -296,6 +528,7 @@ func (b *Backend) connectLoop() {
 
 func (b *Backend) disconnect() error {
 	mqttDisconnectCounter().Inc()
+	health.SetIntegrationConnected(b.healthName, false)
 
 	b.Lock()
 	defer b.Unlock()
@@ -323,12 +556,30 @@ func (b *Backend) reconnectLoop() {
 
 func (b *Backend) onConnected(c paho.Client) {
 	mqttConnectCounter().Inc()
+	health.SetIntegrationConnected(b.healthName, true)
 
 	b.RLock()
 	defer b.RUnlock()
 
 	log.Info("integration/mqtt: connected to mqtt broker")
 
+	// Flush the events which could not be published while disconnected,
+	// before resuming normal publishing.
+	if err := b.eventBuffer.flush(func(e bufferedEvent) error {
+		log.WithFields(log.Fields{
+			"topic": e.topic,
+			"qos":   b.qosForEvent(e.event),
+			"event": e.event,
+		}).Info("integration/mqtt: publishing buffered event")
+
+		if token := c.Publish(e.topic, b.qosForEvent(e.event), b.isRetainedEvent(e.event), e.payload); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("integration/mqtt: flush event buffer error")
+	}
+
 	for gatewayID := range b.gateways {
 		for {
 			if err := b.subscribeGateway(gatewayID); err != nil {
@@ -340,20 +591,89 @@ func (b *Backend) onConnected(c paho.Client) {
 			break
 		}
 	}
+
+	if b.remoteConfigTopic != "" {
+		if err := b.subscribeRemoteConfig(c); err != nil {
+			log.WithError(err).Error("integration/mqtt: subscribe remote configuration error")
+		}
+	}
+
+	// The stored events are published in the background, as these might
+	// be many.
+	if b.storeAndForward != nil {
+		go b.flushStoreAndForward(c)
+	}
+}
+
+// flushStoreAndForward publishes the events stored on disk.
+func (b *Backend) flushStoreAndForward(c paho.Client) {
+	if err := b.storeAndForward.flush(func(e bufferedEvent) error {
+		log.WithFields(log.Fields{
+			"topic": e.topic,
+			"qos":   b.qosForEvent(e.event),
+			"event": e.event,
+		}).Info("integration/mqtt: publishing stored event")
+
+		if token := c.Publish(e.topic, b.qosForEvent(e.event), b.isRetainedEvent(e.event), e.payload); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+		b.retainEvent(e)
+		return nil
+	}); err != nil {
+		log.WithError(err).Error("integration/mqtt: flush store-and-forward error")
+	}
 }
 
 func (b *Backend) onConnectionLost(c paho.Client, err error) {
 	mqttDisconnectCounter().Inc()
+	health.SetIntegrationConnected(b.healthName, false)
 	log.WithError(err).Error("mqtt: connection error")
+
+	if b.failover != nil {
+		go b.failoverReconnect(c)
+	}
 }
 
-func (b *Backend) handleDownlinkFrame(c paho.Client, msg paho.Message) {
+// failoverReconnect disconnects the given client, which stops the MQTT
+// client from re-connecting to the lost broker, and connects to the next
+// available broker.
+func (b *Backend) failoverReconnect(c paho.Client) {
+	if b.closed {
+		return
+	}
+
+	c.Disconnect(0)
+	b.connectLoop()
+}
+
+// primaryCheckLoop checks the primary broker at the given interval while
+// connected to an other broker. Once the primary broker is reachable again,
+// the integration re-connects to the primary broker.
+func (b *Backend) primaryCheckLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if b.closed {
+			return
+		}
+
+		if b.failover.onPrimary() || !b.failover.primaryReachable() {
+			continue
+		}
+
+		log.WithField("server", b.failover.servers[0].String()).Info("integration/mqtt: primary mqtt broker is reachable, failing back")
+
+		mqttFailbackCounter().Inc()
+		mqttReconnectCounter().Inc()
+
+		b.disconnect()
+		b.connectLoop()
+	}
+}
+
+func (b *Backend) handleDownlinkFrame(c paho.Client, msg paho.Message) error {
 	var downlinkFrame gw.DownlinkFrame
 	if err := b.unmarshal(msg.Payload(), &downlinkFrame); err != nil {
-		log.WithFields(log.Fields{
-			"topic": msg.Topic(),
-		}).WithError(err).Error("integration/mqtt: unmarshal downlink frame error")
-		return
+		return errors.Wrap(err, "unmarshal downlink frame error")
 	}
 
 	var gatewayID lorawan.EUI64
@@ -366,31 +686,33 @@ func (b *Backend) handleDownlinkFrame(c paho.Client, msg paho.Message) {
 		"downlink_id": downID,
 	}).Info("integration/mqtt: downlink frame received")
 
+	tracing.StartTrace(downID, "downlink", tracing.Attr("gateway_id", gatewayID), tracing.Attr("downlink_id", downID), tracing.Attr("topic", msg.Topic()))
+
 	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
 }
 
 // TODO: this feature is deprecated. Remove this in the next major release.
-func (b *Backend) handleGatewayConfiguration(c paho.Client, msg paho.Message) {
+func (b *Backend) handleGatewayConfiguration(c paho.Client, msg paho.Message) error {
 	log.WithFields(log.Fields{
 		"topic": msg.Topic(),
 	}).Info("integration/mqtt: gateway configuration received")
 
 	var gatewayConfig gw.GatewayConfiguration
 	if err := b.unmarshal(msg.Payload(), &gatewayConfig); err != nil {
-		log.WithError(err).Error("integration/mqtt: unmarshal gateway configuration error")
-		return
+		return errors.Wrap(err, "unmarshal gateway configuration error")
 	}
 
 	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
 }
 
-func (b *Backend) handleGatewayCommandExecRequest(c paho.Client, msg paho.Message) {
+func (b *Backend) handleGatewayCommandExecRequest(c paho.Client, msg paho.Message) error {
 	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
 	if err := b.unmarshal(msg.Payload(), &gatewayCommandExecRequest); err != nil {
-		log.WithFields(log.Fields{
-			"topic": msg.Topic(),
-		}).WithError(err).Error("integration/mqtt: unmarshal gateway command execution request error")
-		return
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
 	}
 
 	var gatewayID lorawan.EUI64
@@ -404,15 +726,39 @@ func (b *Backend) handleGatewayCommandExecRequest(c paho.Client, msg paho.Messag
 	}).Info("integration/mqtt: gateway command execution request received")
 
 	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
 }
 
-func (b *Backend) handleRawPacketForwarderCommand(c paho.Client, msg paho.Message) {
+// handlePurgeRequest handles the purge command by requesting the execution
+// of the built-in purge_downlinks command. The number of purged downlinks is
+// published as exec event.
+func (b *Backend) handlePurgeRequest(c paho.Client, msg paho.Message) error {
+	var req gw.GatewayCommandExecRequest
+	if err := b.unmarshal(msg.Payload(), &req); err != nil {
+		return errors.Wrap(err, "unmarshal purge request error")
+	}
+	req.Command = "purge_downlinks"
+
+	var gatewayID lorawan.EUI64
+	var execID uuid.UUID
+	copy(gatewayID[:], req.GetGatewayId())
+	copy(execID[:], req.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/mqtt: purge downlinks request received")
+
+	b.gatewayCommandExecRequestChan <- req
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(c paho.Client, msg paho.Message) error {
 	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
 	if err := b.unmarshal(msg.Payload(), &rawPacketForwarderCommand); err != nil {
-		log.WithFields(log.Fields{
-			"topic": msg.Topic(),
-		}).WithError(err).Error("integration/mqtt: unmarshal raw packet-forwarder command error")
-		return
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
 	}
 
 	var gatewayID lorawan.EUI64
@@ -426,47 +772,257 @@ func (b *Backend) handleRawPacketForwarderCommand(c paho.Client, msg paho.Messag
 	}).Info("integration/mqtt: raw packet-forwarder command received")
 
 	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
+
+// replayRequest contains the time range of the events to replay. As there
+// is no Protobuf message defined for this command, this is always JSON
+// encoded.
+type replayRequest struct {
+	GatewayID lorawan.EUI64 `json:"gatewayID"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+}
+
+func (b *Backend) handleReplayRequest(c paho.Client, msg paho.Message) error {
+	if b.storeAndForward == nil || b.storeAndForward.retention == 0 {
+		return errors.New("replay requires store-and-forward with replay_retention")
+	}
+
+	var req replayRequest
+	if err := json.Unmarshal(msg.Payload(), &req); err != nil {
+		return errors.Wrap(err, "unmarshal replay request error")
+	}
+
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": req.GatewayID,
+		"start":      req.Start,
+		"end":        req.End,
+	}).Info("integration/mqtt: replay request received")
+
+	// The events are replayed in the background, as the command handler
+	// must not block the MQTT client.
+	go func() {
+		n, err := b.storeAndForward.replay(req.GatewayID, req.Start, req.End, func(e bufferedEvent) error {
+			if token := c.Publish(e.topic, b.qosForEvent(e.event), false, e.payload); token.Wait() && token.Error() != nil {
+				return token.Error()
+			}
+			mqttReplayCounter(e.event).Inc()
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).WithField("gateway_id", req.GatewayID).Error("integration/mqtt: replay events error")
+		}
+
+		log.WithFields(log.Fields{
+			"gateway_id": req.GatewayID,
+			"count":      n,
+		}).Info("integration/mqtt: events replayed")
+	}()
+
+	return nil
 }
 
 func (b *Backend) handleCommand(c paho.Client, msg paho.Message) {
-	if strings.HasSuffix(msg.Topic(), "down") || strings.Contains(msg.Topic(), "command=down") {
+	var err error
+
+	if strings.HasPrefix(msg.Topic(), azureDirectMethodPrefix) {
+		b.handleAzureDirectMethod(c, msg)
+		return
+	} else if strings.HasSuffix(msg.Topic(), "down") || strings.Contains(msg.Topic(), "command=down") {
 		mqttCommandCounter("down").Inc()
-		b.handleDownlinkFrame(c, msg)
+		err = b.handleDownlinkFrame(c, msg)
 	} else if strings.HasSuffix(msg.Topic(), "config") || strings.Contains(msg.Topic(), "command=config") {
 		mqttCommandCounter("config").Inc()
-		b.handleGatewayConfiguration(c, msg)
+		err = b.handleGatewayConfiguration(c, msg)
 	} else if strings.HasSuffix(msg.Topic(), "exec") || strings.Contains(msg.Topic(), "command=exec") {
-		b.handleGatewayCommandExecRequest(c, msg)
+		err = b.handleGatewayCommandExecRequest(c, msg)
 	} else if strings.HasSuffix(msg.Topic(), "raw") || strings.Contains(msg.Topic(), "command=raw") {
-		b.handleRawPacketForwarderCommand(c, msg)
+		err = b.handleRawPacketForwarderCommand(c, msg)
+	} else if strings.HasSuffix(msg.Topic(), "replay") || strings.Contains(msg.Topic(), "command=replay") {
+		mqttCommandCounter("replay").Inc()
+		err = b.handleReplayRequest(c, msg)
+	} else if strings.HasSuffix(msg.Topic(), "purge") || strings.Contains(msg.Topic(), "command=purge") {
+		mqttCommandCounter("purge").Inc()
+		err = b.handlePurgeRequest(c, msg)
 	} else {
 		log.WithFields(log.Fields{
 			"topic": msg.Topic(),
 		}).Warning("integration/mqtt: unexpected command received")
 	}
-}
 
-func (b *Backend) publish(gatewayID lorawan.EUI64, event string, fields log.Fields, msg proto.Message) error {
-	topic := bytes.NewBuffer(nil)
-	if err := b.eventTopicTemplate.Execute(topic, struct {
-		GatewayID lorawan.EUI64
-		EventType string
-	}{gatewayID, event}); err != nil {
-		return errors.Wrap(err, "execute event template error")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"topic": msg.Topic(),
+		}).WithError(err).Error("integration/mqtt: handle command error")
 	}
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, id uuid.UUID, fields log.Fields, msg proto.Message) error {
+	b.RLock()
+	eventTopicTemplate := b.eventTopicTemplate
+	b.RUnlock()
 
-	bytes, err := b.marshal(msg)
+	m := b.marshalers.Event(event)
+
+	span := tracing.StartSpan(id, "mqtt_marshal", tracing.Attr("marshaler", m.Name))
+	bytes, err := m.Marshal(msg)
 	if err != nil {
+		span.End(err)
 		return errors.Wrap(err, "marshal message error")
 	}
 
+	bytes, contentEncoding, err := b.compressor.compress(bytes)
+	span.End(err)
+	if err != nil {
+		return errors.Wrap(err, "compress message error")
+	}
+
+	topic := new(strings.Builder)
+	if err := eventTopicTemplate.Execute(topic, struct {
+		GatewayID       lorawan.EUI64
+		EventType       string
+		Marshaler       string
+		ContentEncoding string
+	}{gatewayID, event, m.Name, contentEncoding}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+
 	fields["topic"] = topic.String()
-	fields["qos"] = b.qos
+	if contentEncoding != "" {
+		fields["content_encoding"] = contentEncoding
+	}
+	fields["qos"] = b.qosForEvent(event)
 	fields["event"] = event
 
+	// In case there are buffered events, the event is added to the buffer to
+	// retain the order of events.
+	if b.isBufferedEvent(event) && (b.eventBuffer.len() != 0 || !b.conn.IsConnectionOpen()) {
+		b.bufferEvent(event, topic.String(), bytes, fields)
+		return nil
+	}
+
+	// Same as above, but for the events which are stored on disk.
+	if b.isStoredEvent(event) && (b.storeAndForward.len() != 0 || !b.conn.IsConnectionOpen()) {
+		return b.storeEvent(gatewayID, event, topic.String(), bytes, fields)
+	}
+
 	log.WithFields(fields).Info("integration/mqtt: publishing event")
-	if token := b.conn.Publish(topic.String(), b.qos, false, bytes); token.Wait() && token.Error() != nil {
+	span = tracing.StartSpan(id, "mqtt_publish", tracing.Attr("topic", topic.String()), tracing.Attr("qos", b.qosForEvent(event)))
+	token := b.publishEvent(gatewayID, event, contentEncoding, topic.String(), bytes)
+	token.Wait()
+	span.End(token.Error())
+	if token.Error() != nil {
+		if b.isBufferedEvent(event) {
+			log.WithError(token.Error()).WithFields(fields).Error("integration/mqtt: publish event error")
+			b.bufferEvent(event, topic.String(), bytes, fields)
+			return nil
+		}
+
+		if b.isStoredEvent(event) {
+			log.WithError(token.Error()).WithFields(fields).Error("integration/mqtt: publish event error")
+			return b.storeEvent(gatewayID, event, topic.String(), bytes, fields)
+		}
+
 		return token.Error()
 	}
+
+	if b.isStoredEvent(event) {
+		b.retainEvent(bufferedEvent{
+			gatewayID: gatewayID,
+			event:     event,
+			topic:     topic.String(),
+			payload:   bytes,
+			createdAt: time.Now(),
+		})
+	}
+
+	health.IntegrationPublished(b.healthName)
 	return nil
 }
+
+// publishEvent publishes the given payload. When using MQTT 5 and user
+// properties are enabled, the gateway ID and event type are added as user
+// properties. When using MQTT 5, the content-encoding of a compressed payload
+// is added as user property.
+func (b *Backend) publishEvent(gatewayID lorawan.EUI64, event, contentEncoding, topic string, payload []byte) paho.Token {
+	if c, ok := b.conn.(*v5Client); ok && (b.userProperties || contentEncoding != "") {
+		props := make(map[string]string)
+		if b.userProperties {
+			props["gateway_id"] = gatewayID.String()
+			props["event_type"] = event
+		}
+		if contentEncoding != "" {
+			props["content_encoding"] = contentEncoding
+		}
+
+		return c.PublishWithProperties(topic, b.qosForEvent(event), b.isRetainedEvent(event), payload, props)
+	}
+
+	return b.conn.Publish(topic, b.qosForEvent(event), b.isRetainedEvent(event), payload)
+}
+
+// qosForEvent returns the QoS for the given event type.
+func (b *Backend) qosForEvent(event string) uint8 {
+	if qos, ok := b.eventQOS[event]; ok {
+		return qos
+	}
+	return b.qos
+}
+
+// isRetainedEvent returns true when the given event must be published as
+// retained message. By default this is the case for the conn event, such
+// that the last known connection-state of each gateway is available to
+// subscribers connecting afterwards.
+func (b *Backend) isRetainedEvent(event string) bool {
+	return b.retainedEvents[event]
+}
+
+// isBufferedEvent returns true when the given event must be buffered in case
+// it can't be published. This is the case for events which are a response to
+// a command, as the network-server would otherwise retry the command.
+func (b *Backend) isBufferedEvent(event string) bool {
+	return b.eventBuffer.enabled() && (event == "ack" || event == "exec")
+}
+
+func (b *Backend) bufferEvent(event, topic string, payload []byte, fields log.Fields) {
+	log.WithFields(fields).Warning("integration/mqtt: not connected, buffering event")
+
+	b.eventBuffer.add(bufferedEvent{
+		event:     event,
+		topic:     topic,
+		payload:   payload,
+		createdAt: time.Now(),
+	})
+}
+
+// isStoredEvent returns true when the given event must be stored on disk in
+// case it can't be published.
+func (b *Backend) isStoredEvent(event string) bool {
+	return b.storeAndForward != nil && (event == "up" || event == "up_set")
+}
+
+func (b *Backend) storeEvent(gatewayID lorawan.EUI64, event, topic string, payload []byte, fields log.Fields) error {
+	log.WithFields(fields).Warning("integration/mqtt: not connected, storing event")
+
+	return b.storeAndForward.add(bufferedEvent{
+		gatewayID: gatewayID,
+		event:     event,
+		topic:     topic,
+		payload:   payload,
+		createdAt: time.Now(),
+	})
+}
+
+// retainEvent retains the given published event for replay. Errors are
+// logged, as the event has already been published.
+func (b *Backend) retainEvent(e bufferedEvent) {
+	if err := b.storeAndForward.retain(e); err != nil {
+		log.WithError(err).WithField("event", e.event).Error("integration/mqtt: retain event error")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
 	"github.com/brocaar/lorawan"
 )
@@ -61,6 +62,9 @@ func (ts *MQTTBackendTestSuite) SetupSuite() {
 	conf.Integration.MQTT.Auth.Generic.Username = username
 	conf.Integration.MQTT.Auth.Generic.Password = password
 	conf.Integration.MQTT.Auth.Generic.CleanSession = true
+	conf.Integration.MQTT.EventBuffer.MaxCount = 10
+	conf.Integration.MQTT.EventBuffer.MaxAge = 30 * time.Second
+	conf.Integration.MQTT.RetainedEvents = []string{"conn"}
 
 	var err error
 	ts.backend, err = NewBackend(conf)
@@ -167,6 +171,114 @@ func (ts *MQTTBackendTestSuite) TestPublishDownlinkTXAck() {
 	assert.Equal(txAck, txAckReceived)
 }
 
+func (ts *MQTTBackendTestSuite) TestPublishLogEvent() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	logEvent := events.Log{
+		GatewayId: ts.gatewayID[:],
+		LogId:     id[:],
+		Severity:  "ERROR",
+		Message:   "SX1301 radio A error",
+	}
+
+	logChan := make(chan events.Log)
+	token := ts.mqttClient.Subscribe("gateway/+/event/log", 0, func(c paho.Client, msg paho.Message) {
+		assert.Contains(string(msg.Payload()), `"severity":"ERROR"`)
+
+		var pl events.Log
+		assert.NoError(ts.backend.unmarshal(msg.Payload(), &pl))
+		logChan <- pl
+	})
+	token.Wait()
+	assert.NoError(token.Error())
+
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "log", id, &logEvent))
+	logReceived := <-logChan
+	assert.Equal(logEvent, logReceived)
+}
+
+func (ts *MQTTBackendTestSuite) TestPublishConnState() {
+	assert := require.New(ts.T())
+
+	connState := events.ConnState{
+		GatewayId:       ts.gatewayID[:],
+		State:           events.ConnStateOffline,
+		BackendType:     "semtech_udp",
+		RemoteAddress:   "192.168.1.10:54321",
+		ProtocolVersion: "2",
+		Reason:          "keepalive timeout (no PULL_DATA received within 1m0s)",
+	}
+
+	connChan := make(chan events.ConnState)
+	token := ts.mqttClient.Subscribe("gateway/+/event/conn", 0, func(c paho.Client, msg paho.Message) {
+		assert.Contains(string(msg.Payload()), `"state":"OFFLINE"`)
+		assert.Contains(string(msg.Payload()), `"reason":"keepalive timeout (no PULL_DATA received within 1m0s)"`)
+
+		var pl events.ConnState
+		assert.NoError(ts.backend.unmarshal(msg.Payload(), &pl))
+		connChan <- pl
+	})
+	token.Wait()
+	assert.NoError(token.Error())
+	defer func() {
+		ts.mqttClient.Unsubscribe("gateway/+/event/conn").Wait()
+	}()
+
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "conn", uuid.Nil, &connState))
+	connReceived := <-connChan
+	assert.Equal(connState, connReceived)
+}
+
+func (ts *MQTTBackendTestSuite) TestBufferedDownlinkTXAck() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	txAckChan := make(chan gw.DownlinkTXAck, 1)
+	token := ts.mqttClient.Subscribe("gateway/+/event/ack", 0, func(c paho.Client, msg paho.Message) {
+		var pl gw.DownlinkTXAck
+		assert.NoError(ts.backend.unmarshal(msg.Payload(), &pl))
+		txAckChan <- pl
+	})
+	token.Wait()
+	assert.NoError(token.Error())
+	defer func() {
+		ts.mqttClient.Unsubscribe("gateway/+/event/ack").Wait()
+	}()
+
+	// handle downlink
+	downlink := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		DownlinkId: id[:],
+	}
+	b, err := ts.backend.marshal(&downlink)
+	assert.NoError(err)
+
+	token = ts.mqttClient.Publish("gateway/0807060504030201/command/down", 0, false, b)
+	token.Wait()
+	assert.NoError(token.Error())
+	<-ts.backend.GetDownlinkFrameChan()
+
+	// the connection is lost before the ack is published
+	assert.NoError(ts.backend.disconnect())
+
+	txAck := gw.DownlinkTXAck{
+		GatewayId:  ts.gatewayID[:],
+		Token:      1234,
+		DownlinkId: id[:],
+	}
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "ack", id, &txAck))
+	assert.Equal(1, ts.backend.eventBuffer.len())
+
+	// the buffered ack is published on re-connect
+	ts.backend.connectLoop()
+	txAckReceived := <-txAckChan
+	assert.Equal(txAck, txAckReceived)
+	assert.Equal(0, ts.backend.eventBuffer.len())
+}
+
 func (ts *MQTTBackendTestSuite) TestDownlinkFrameHandler() {
 	assert := require.New(ts.T())
 
@@ -230,6 +342,28 @@ func (ts *MQTTBackendTestSuite) TestGatewayCommandExecRequest() {
 	assert.Equal(execReq, receivedExecReq)
 }
 
+func (ts *MQTTBackendTestSuite) TestPurgeRequest() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	req := gw.GatewayCommandExecRequest{
+		GatewayId: ts.gatewayID[:],
+		ExecId:    id[:],
+	}
+
+	b, err := ts.backend.marshal(&req)
+	assert.NoError(err)
+
+	token := ts.mqttClient.Publish("gateway/0807060504030201/command/purge", 0, false, b)
+	token.Wait()
+	assert.NoError(token.Error())
+
+	req.Command = "purge_downlinks"
+	receivedExecReq := <-ts.backend.GetGatewayCommandExecRequestChan()
+	assert.Equal(req, receivedExecReq)
+}
+
 func (ts *MQTTBackendTestSuite) TestRawPacketForwarderCommand() {
 	assert := require.New(ts.T())
 	id, err := uuid.NewV4()
@@ -252,6 +386,86 @@ func (ts *MQTTBackendTestSuite) TestRawPacketForwarderCommand() {
 	assert.Equal(pl, received)
 }
 
+func (ts *MQTTBackendTestSuite) TestReload() {
+	assert := require.New(ts.T())
+
+	var conf config.Config
+	conf.Integration.MQTT.EventTopicTemplate = "reloaded/{{ .GatewayID }}/event/{{ .EventType }}"
+	conf.Integration.MQTT.CommandTopicTemplate = "reloaded/{{ .GatewayID }}/command/#"
+	assert.NoError(ts.backend.Reload(conf))
+
+	defer func() {
+		conf.Integration.MQTT.EventTopicTemplate = "gateway/{{ .GatewayID }}/event/{{ .EventType }}"
+		conf.Integration.MQTT.CommandTopicTemplate = "gateway/{{ .GatewayID }}/command/#"
+		assert.NoError(ts.backend.Reload(conf))
+	}()
+
+	ts.T().Run("Event", func(t *testing.T) {
+		assert := require.New(t)
+
+		uplink := gw.UplinkFrame{
+			PhyPayload: []byte{1, 2, 3, 4},
+		}
+
+		uplinkFrameChan := make(chan gw.UplinkFrame)
+		token := ts.mqttClient.Subscribe("reloaded/+/event/up", 0, func(c paho.Client, msg paho.Message) {
+			var pl gw.UplinkFrame
+			assert.NoError(ts.backend.unmarshal(msg.Payload(), &pl))
+			uplinkFrameChan <- pl
+		})
+		token.Wait()
+		assert.NoError(token.Error())
+
+		assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", uuid.Nil, &uplink))
+		uplinkReceived := <-uplinkFrameChan
+		assert.Equal(uplink, uplinkReceived)
+	})
+
+	ts.T().Run("Command", func(t *testing.T) {
+		assert := require.New(t)
+
+		downlink := gw.DownlinkFrame{
+			PhyPayload: []byte{4, 3, 2, 1},
+		}
+
+		b, err := ts.backend.marshal(&downlink)
+		assert.NoError(err)
+
+		token := ts.mqttClient.Publish("reloaded/0807060504030201/command/down", 0, false, b)
+		token.Wait()
+		assert.NoError(token.Error())
+
+		receivedDownlink := <-ts.backend.GetDownlinkFrameChan()
+		assert.Equal(downlink, receivedDownlink)
+	})
+}
+
 func TestMQTTBackend(t *testing.T) {
 	suite.Run(t, new(MQTTBackendTestSuite))
 }
+
+func TestEventQoSAndRetain(t *testing.T) {
+	assert := require.New(t)
+
+	b := Backend{
+		qos:            1,
+		eventQOS:       map[string]uint8{"stats": 0, "ack": 2},
+		retainedEvents: map[string]bool{"conn": true, "stats": true},
+	}
+
+	tests := []struct {
+		event          string
+		expectedQoS    uint8
+		expectedRetain bool
+	}{
+		{"up", 1, false},
+		{"stats", 0, true},
+		{"ack", 2, false},
+		{"conn", 1, true},
+	}
+
+	for _, tst := range tests {
+		assert.Equal(tst.expectedQoS, b.qosForEvent(tst.event), tst.event)
+		assert.Equal(tst.expectedRetain, b.isRetainedEvent(tst.event), tst.event)
+	}
+}
@@ -0,0 +1,555 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	paho5 "github.com/eclipse/paho.golang/paho"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// v5Options contains the MQTT 5 specific options.
+type v5Options struct {
+	// topicAliasMaximum is the max. number of topic aliases used for
+	// publishing. The broker max. is used when it is lower.
+	topicAliasMaximum uint16
+
+	// messageExpiry is the message expiry interval (in seconds) of the
+	// published messages.
+	messageExpiry uint32
+
+	// sessionExpiry is the session expiry interval (in seconds). When set,
+	// the broker retains the session (subscriptions and undelivered QoS 1
+	// and 2 messages) for the given interval after disconnecting.
+	sessionExpiry uint32
+}
+
+// v5Client implements the paho (MQTT 3.1.1) Client interface using the
+// MQTT 5 client, such that the Backend can use either protocol version.
+// In contrast to the MQTT 3.1.1 client, the MQTT 5 client does not implement
+// the connection handling, this is implemented by v5Client (using the
+// client options).
+type v5Client struct {
+	sync.RWMutex
+
+	opts    *paho.ClientOptions
+	reader  paho.ClientOptionsReader
+	v5      v5Options
+	timeout time.Duration
+
+	client    *paho5.Client
+	router    *v5Router
+	connected bool
+	closed    bool
+
+	// aliases contains the topic aliases of the current connection.
+	aliases           map[string]uint16
+	topicAliasMaximum uint16
+}
+
+func newV5Client(opts *paho.ClientOptions, v5 v5Options) *v5Client {
+	timeout := opts.WriteTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &v5Client{
+		opts:    opts,
+		reader:  paho.NewClient(opts).OptionsReader(),
+		v5:      v5,
+		timeout: timeout,
+		router:  newV5Router(),
+	}
+}
+
+// IsConnected returns true when the client is connected.
+func (c *v5Client) IsConnected() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.connected
+}
+
+// IsConnectionOpen returns true when the client is connected.
+func (c *v5Client) IsConnectionOpen() bool {
+	return c.IsConnected()
+}
+
+// Connect connects to the first reachable server.
+func (c *v5Client) Connect() paho.Token {
+	return newV5Token(func() error {
+		return c.connect()
+	})
+}
+
+// Disconnect disconnects from the server. The client does not re-connect
+// after calling Disconnect.
+func (c *v5Client) Disconnect(quiesce uint) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.closed = true
+	if c.client != nil && c.connected {
+		c.client.Disconnect(&paho5.Disconnect{ReasonCode: 0})
+	}
+	c.connected = false
+}
+
+// Publish publishes the given payload.
+func (c *v5Client) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	return c.PublishWithProperties(topic, qos, retained, payload, nil)
+}
+
+// PublishWithProperties publishes the given payload, including the given
+// user properties.
+func (c *v5Client) PublishWithProperties(topic string, qos byte, retained bool, payload interface{}, user map[string]string) paho.Token {
+	return newV5Token(func() error {
+		var b []byte
+		switch p := payload.(type) {
+		case []byte:
+			b = p
+		case string:
+			b = []byte(p)
+		default:
+			return fmt.Errorf("unknown payload type: %T", payload)
+		}
+
+		c.Lock()
+		client := c.client
+		if client == nil || !c.connected {
+			c.Unlock()
+			return errors.New("not connected")
+		}
+
+		pub := paho5.Publish{
+			QoS:     qos,
+			Retain:  retained,
+			Topic:   topic,
+			Payload: b,
+			Properties: &paho5.PublishProperties{
+				User: user,
+			},
+		}
+
+		if c.v5.messageExpiry != 0 {
+			expiry := c.v5.messageExpiry
+			pub.Properties.MessageExpiry = &expiry
+		}
+
+		// Once an alias has been assigned to the topic (by sending both the
+		// topic and alias), only the alias needs to be sent.
+		if alias, ok := c.aliases[topic]; ok {
+			pub.Topic = ""
+			pub.Properties.TopicAlias = &alias
+		} else if len(c.aliases) < int(c.topicAliasMaximum) {
+			alias := uint16(len(c.aliases) + 1)
+			c.aliases[topic] = alias
+			pub.Properties.TopicAlias = &alias
+		}
+		c.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+
+		resp, err := client.Publish(ctx, &pub)
+		if err != nil {
+			return err
+		}
+		if resp != nil && resp.ReasonCode >= 0x80 {
+			return fmt.Errorf("publish error, reason code: %d", resp.ReasonCode)
+		}
+		return nil
+	})
+}
+
+// Subscribe subscribes to the given topic.
+func (c *v5Client) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+// SubscribeMultiple subscribes to the given topics.
+func (c *v5Client) SubscribeMultiple(filters map[string]byte, callback paho.MessageHandler) paho.Token {
+	return newV5Token(func() error {
+		c.RLock()
+		client := c.client
+		connected := c.connected
+		c.RUnlock()
+
+		if client == nil || !connected {
+			return errors.New("not connected")
+		}
+
+		sub := paho5.Subscribe{
+			Subscriptions: make(map[string]paho5.SubscribeOptions),
+		}
+		for topic, qos := range filters {
+			c.AddRoute(topic, callback)
+			sub.Subscriptions[topic] = paho5.SubscribeOptions{QoS: qos}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+
+		suback, err := client.Subscribe(ctx, &sub)
+		if err != nil {
+			return err
+		}
+		for _, code := range suback.Reasons {
+			if code >= 0x80 {
+				return fmt.Errorf("subscribe error, reason code: %d", code)
+			}
+		}
+		return nil
+	})
+}
+
+// Unsubscribe unsubscribes from the given topics.
+func (c *v5Client) Unsubscribe(topics ...string) paho.Token {
+	return newV5Token(func() error {
+		c.RLock()
+		client := c.client
+		connected := c.connected
+		c.RUnlock()
+
+		for _, topic := range topics {
+			c.router.unregister(topic)
+		}
+
+		if client == nil || !connected {
+			return errors.New("not connected")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+
+		_, err := client.Unsubscribe(ctx, &paho5.Unsubscribe{Topics: topics})
+		return err
+	})
+}
+
+// AddRoute adds the handler for the given topic, without subscribing.
+func (c *v5Client) AddRoute(topic string, callback paho.MessageHandler) {
+	c.router.register(topic, func(p *paho5.Publish) {
+		callback(c, &v5Message{p})
+	})
+}
+
+// OptionsReader returns the client options reader.
+func (c *v5Client) OptionsReader() paho.ClientOptionsReader {
+	return c.reader
+}
+
+func (c *v5Client) connect() error {
+	if len(c.opts.Servers) == 0 {
+		return errors.New("no servers configured")
+	}
+
+	var conn net.Conn
+	var err error
+	for _, server := range c.opts.Servers {
+		conn, err = c.dial(server)
+		if err == nil {
+			break
+		}
+
+		log.WithError(err).WithField("server", server.String()).Error("integration/mqtt: connect to server error")
+	}
+	if err != nil {
+		return err
+	}
+
+	client := paho5.NewClient()
+	client.Router = c.router
+	client.PacketTimeout = c.timeout
+	client.Conn = &v5Conn{
+		Conn: conn,
+		onError: func(err error) {
+			c.onConnectionLost(client, err)
+		},
+	}
+	client.OnDisconnect = func(d packets.Disconnect) {
+		c.onConnectionLost(client, fmt.Errorf("server initiated disconnect, reason code: %d", d.ReasonCode))
+	}
+
+	cp := paho5.Connect{
+		ClientID:   c.opts.ClientID,
+		Username:   c.opts.Username,
+		Password:   []byte(c.opts.Password),
+		CleanStart: c.opts.CleanSession,
+		KeepAlive:  uint16(c.opts.KeepAlive),
+	}
+	cp.UsernameFlag = cp.Username != ""
+	cp.PasswordFlag = len(cp.Password) != 0
+	if c.v5.sessionExpiry != 0 {
+		cp.Properties = &paho5.ConnectProperties{
+			SessionExpiryInterval: &c.v5.sessionExpiry,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	ca, err := client.Connect(ctx, &cp)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	var topicAliasMaximum uint16
+	if ca.Properties != nil && ca.Properties.TopicAliasMaximum != nil {
+		topicAliasMaximum = *ca.Properties.TopicAliasMaximum
+	}
+	if c.v5.topicAliasMaximum < topicAliasMaximum {
+		topicAliasMaximum = c.v5.topicAliasMaximum
+	}
+
+	c.Lock()
+	c.client = client
+	c.connected = true
+	c.aliases = make(map[string]uint16)
+	c.topicAliasMaximum = topicAliasMaximum
+	c.Unlock()
+
+	if c.opts.OnConnect != nil {
+		go c.opts.OnConnect(c)
+	}
+
+	return nil
+}
+
+func (c *v5Client) dial(server *url.URL) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: c.opts.ConnectTimeout}
+
+	switch server.Scheme {
+	case "tcp", "mqtt":
+		return dialer.Dial("tcp", server.Host)
+	case "ssl", "tls", "tcps", "mqtts":
+		return tls.DialWithDialer(&dialer, "tcp", server.Host, c.opts.TLSConfig)
+	case "unix":
+		// the host contains the path of the socket
+		return dialer.Dial("unix", server.Host)
+	default:
+		return nil, fmt.Errorf("unsupported scheme for mqtt v5: %s", server.Scheme)
+	}
+}
+
+// onConnectionLost is called when the connection of the given client has
+// been lost. When auto-reconnect is enabled, the client re-connects in the
+// background.
+func (c *v5Client) onConnectionLost(client *paho5.Client, err error) {
+	c.Lock()
+	if c.client != client || !c.connected {
+		c.Unlock()
+		return
+	}
+	c.connected = false
+	closed := c.closed
+	c.Unlock()
+
+	if closed {
+		return
+	}
+
+	if c.opts.OnConnectionLost != nil {
+		c.opts.OnConnectionLost(c, err)
+	}
+
+	if c.opts.AutoReconnect {
+		go c.reconnect()
+	}
+}
+
+func (c *v5Client) reconnect() {
+	interval := time.Second
+	for {
+		c.RLock()
+		closed := c.closed
+		c.RUnlock()
+		if closed {
+			return
+		}
+
+		err := c.connect()
+		if err == nil {
+			return
+		}
+		log.WithError(err).Error("integration/mqtt: re-connect error")
+
+		time.Sleep(interval)
+		interval = interval * 2
+		if c.opts.MaxReconnectInterval != 0 && interval > c.opts.MaxReconnectInterval {
+			interval = c.opts.MaxReconnectInterval
+		}
+	}
+}
+
+// v5Conn wraps the network connection, to detect lost connections.
+type v5Conn struct {
+	net.Conn
+
+	once    sync.Once
+	onError func(error)
+}
+
+// Read reads from the connection. On error, the onError callback is called
+// (once).
+func (c *v5Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.once.Do(func() {
+			go c.onError(err)
+		})
+	}
+	return n, err
+}
+
+// v5Router implements the MQTT 5 Router interface, resolving the topic
+// aliases of the received messages.
+type v5Router struct {
+	sync.RWMutex
+
+	handlers map[string]paho5.MessageHandler
+	aliases  map[uint16]string
+}
+
+func newV5Router() *v5Router {
+	return &v5Router{
+		handlers: make(map[string]paho5.MessageHandler),
+		aliases:  make(map[uint16]string),
+	}
+}
+
+func (r *v5Router) register(topic string, h paho5.MessageHandler) {
+	r.Lock()
+	defer r.Unlock()
+	r.handlers[topic] = h
+}
+
+func (r *v5Router) unregister(topic string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.handlers, topic)
+}
+
+// RegisterHandler registers the handler for the given topic.
+func (r *v5Router) RegisterHandler(topic string, h paho5.MessageHandler) {
+	r.register(topic, h)
+}
+
+// UnregisterHandler removes the handler for the given topic.
+func (r *v5Router) UnregisterHandler(topic string) {
+	r.unregister(topic)
+}
+
+// Route calls the handlers matching the topic of the given message.
+func (r *v5Router) Route(pb *packets.Publish) {
+	m := paho5.PublishFromPacketPublish(pb)
+
+	r.Lock()
+	if m.Properties.TopicAlias != nil {
+		if m.Topic != "" {
+			r.aliases[*m.Properties.TopicAlias] = m.Topic
+		} else {
+			m.Topic = r.aliases[*m.Properties.TopicAlias]
+		}
+	}
+
+	var handlers []paho5.MessageHandler
+	for filter, h := range r.handlers {
+		if topicMatches(filter, m.Topic) {
+			handlers = append(handlers, h)
+		}
+	}
+	r.Unlock()
+
+	for _, h := range handlers {
+		h(m)
+	}
+}
+
+// topicMatches returns true when the topic matches the given topic filter.
+// The $share/[group]/ prefix of a shared subscription filter is ignored.
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	if len(f) > 2 && f[0] == "$share" {
+		f = f[2:]
+	}
+
+	for i := range f {
+		if f[i] == "#" {
+			return true
+		}
+		if i >= len(t) || (f[i] != "+" && f[i] != t[i]) {
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
+
+// v5Message implements the paho Message interface.
+type v5Message struct {
+	publish *paho5.Publish
+}
+
+func (m *v5Message) Duplicate() bool   { return false }
+func (m *v5Message) Qos() byte         { return m.publish.QoS }
+func (m *v5Message) Retained() bool    { return m.publish.Retain }
+func (m *v5Message) Topic() string     { return m.publish.Topic }
+func (m *v5Message) MessageID() uint16 { return 0 }
+func (m *v5Message) Payload() []byte   { return m.publish.Payload }
+func (m *v5Message) Ack()              {}
+
+// v5Token implements the paho Token interface.
+type v5Token struct {
+	done chan struct{}
+	err  error
+}
+
+// newV5Token returns a token which completes once the given function
+// returns.
+func newV5Token(f func() error) *v5Token {
+	t := v5Token{
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		t.err = f()
+		close(t.done)
+	}()
+
+	return &t
+}
+
+func (t *v5Token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *v5Token) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func (t *v5Token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package mqtt
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/jsonpb"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// testV5Server implements a minimal MQTT 5 server, returning the received
+// PUBLISH packets.
+type testV5Server struct {
+	listener net.Listener
+	conn     net.Conn
+	publish  chan *packets.Publish
+	suback   chan struct{}
+}
+
+func newTestV5Server(topicAliasMaximum uint16) (*testV5Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := testV5Server{
+		listener: ln,
+		publish:  make(chan *packets.Publish, 10),
+		suback:   make(chan struct{}, 10),
+	}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conn = conn
+
+		for {
+			cp, err := packets.ReadPacket(conn)
+			if err != nil {
+				return
+			}
+
+			switch p := cp.Content.(type) {
+			case *packets.Connect:
+				connack := packets.NewControlPacket(packets.CONNACK)
+				connack.Content.(*packets.Connack).Properties = &packets.Properties{
+					TopicAliasMaximum: &topicAliasMaximum,
+				}
+				connack.WriteTo(conn)
+			case *packets.Subscribe:
+				suback := packets.NewControlPacket(packets.SUBACK)
+				suback.Content.(*packets.Suback).PacketID = p.PacketID
+				suback.Content.(*packets.Suback).Reasons = make([]byte, len(p.Subscriptions))
+				suback.WriteTo(conn)
+				s.suback <- struct{}{}
+			case *packets.Publish:
+				s.publish <- p
+			case *packets.Pingreq:
+				packets.NewControlPacket(packets.PINGRESP).WriteTo(conn)
+			}
+		}
+	}()
+
+	return &s, nil
+}
+
+func (s *testV5Server) close() {
+	s.listener.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func TestV5Client(t *testing.T) {
+	assert := require.New(t)
+	log.SetLevel(log.ErrorLevel)
+
+	server, err := newTestV5Server(5)
+	assert.NoError(err)
+	defer server.close()
+
+	gatewayID := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.MQTT.ProtocolVersion = 5
+	conf.Integration.MQTT.V5.TopicAliasMaximum = 10
+	conf.Integration.MQTT.V5.MessageExpiryInterval = time.Minute
+	conf.Integration.MQTT.V5.UserProperties = true
+	conf.Integration.MQTT.EventTopicTemplate = "gateway/{{ .GatewayID }}/event/{{ .EventType }}"
+	conf.Integration.MQTT.CommandTopicTemplate = "gateway/{{ .GatewayID }}/command/#"
+	conf.Integration.MQTT.Auth.Type = "generic"
+	conf.Integration.MQTT.Auth.Generic.Servers = []string{"tcp://" + server.listener.Addr().String()}
+	conf.Integration.MQTT.Auth.Generic.CleanSession = true
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+
+	assert.NoError(backend.SetGatewaySubscription(true, gatewayID))
+	<-server.suback
+
+	t.Run("Publish", func(t *testing.T) {
+		assert := require.New(t)
+
+		id, err := uuid.NewV4()
+		assert.NoError(err)
+		uplink := gw.UplinkFrame{
+			PhyPayload: []byte{1, 2, 3, 4},
+			RxInfo: &gw.UplinkRXInfo{
+				UplinkId: id[:],
+			},
+		}
+
+		// The first publish assigns the alias, the second one only uses the
+		// alias.
+		for i, topic := range []string{"gateway/0807060504030201/event/up", ""} {
+			assert.NoError(backend.PublishEvent(gatewayID, "up", id, &uplink))
+			pub := <-server.publish
+
+			assert.Equal(topic, pub.Topic, i)
+			assert.Equal(uint16(1), *pub.Properties.TopicAlias)
+			assert.Equal(uint32(60), *pub.Properties.MessageExpiry)
+			assert.Equal(map[string]string{
+				"gateway_id": "0807060504030201",
+				"event_type": "up",
+			}, pub.Properties.User)
+
+			var pl gw.UplinkFrame
+			assert.NoError(jsonpb.UnmarshalString(string(pub.Payload), &pl))
+			assert.Equal(uplink, pl)
+		}
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		assert := require.New(t)
+
+		downlink := gw.DownlinkFrame{
+			PhyPayload: []byte{1, 2, 3, 4},
+			TxInfo: &gw.DownlinkTXInfo{
+				GatewayId: gatewayID[:],
+			},
+		}
+		b, err := backend.marshal(&downlink)
+		assert.NoError(err)
+
+		// The server assigns an alias to the topic on the first publish and
+		// only uses the alias for the second publish.
+		alias := uint16(1)
+		for _, topic := range []string{"gateway/0807060504030201/command/down", ""} {
+			pub := packets.NewControlPacket(packets.PUBLISH)
+			pub.Content.(*packets.Publish).Topic = topic
+			pub.Content.(*packets.Publish).Payload = b
+			pub.Content.(*packets.Publish).Properties = &packets.Properties{
+				TopicAlias: &alias,
+			}
+			_, err = pub.WriteTo(server.conn)
+			assert.NoError(err)
+
+			assert.Equal(downlink, <-backend.GetDownlinkFrameChan())
+		}
+	})
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter  string
+		topic   string
+		matches bool
+	}{
+		{"gateway/0807060504030201/command/#", "gateway/0807060504030201/command/down", true},
+		{"gateway/0807060504030201/command/#", "gateway/0102030405060708/command/down", false},
+		{"gateway/+/command/down", "gateway/0807060504030201/command/down", true},
+		{"gateway/+/command/down", "gateway/0807060504030201/command/config", false},
+		{"gateway/0807060504030201/command", "gateway/0807060504030201/command/down", false},
+		{"$share/bridge/gateway/+/command/#", "gateway/0807060504030201/command/down", true},
+		{"$share/bridge/gateway/+/command/#", "gateway/0807060504030201/event/up", false},
+	}
+
+	for _, tst := range tests {
+		require.Equal(t, tst.matches, topicMatches(tst.filter, tst.topic), tst.filter+" "+tst.topic)
+	}
+}
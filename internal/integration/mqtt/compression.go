@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Compression algorithms.
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// compressor compresses the event payloads which are equal to or larger than
+// the configured min. size. A nil compressor does not compress.
+type compressor struct {
+	algorithm string
+	minSize   int
+	zstd      *zstd.Encoder
+}
+
+// newCompressor returns the compressor for the given algorithm. It returns
+// nil when compression is disabled.
+func newCompressor(algorithm string, minSize int) (*compressor, error) {
+	c := compressor{
+		algorithm: algorithm,
+		minSize:   minSize,
+	}
+
+	switch algorithm {
+	case "", compressionNone:
+		return nil, nil
+	case compressionGzip:
+	case compressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "new zstd encoder error")
+		}
+		c.zstd = enc
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", algorithm)
+	}
+
+	return &c, nil
+}
+
+// compress returns the (compressed) payload and its content-encoding. The
+// content-encoding is empty when the payload has not been compressed.
+func (c *compressor) compress(b []byte) ([]byte, string, error) {
+	if c == nil || len(b) < c.minSize {
+		return b, "", nil
+	}
+
+	var out []byte
+	switch c.algorithm {
+	case compressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, "", errors.Wrap(err, "gzip write error")
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", errors.Wrap(err, "gzip close error")
+		}
+		out = buf.Bytes()
+	case compressionZstd:
+		out = c.zstd.EncodeAll(b, nil)
+	}
+
+	// Payloads which do not compress (e.g. already compressed or very small)
+	// are published as-is.
+	if len(out) >= len(b) {
+		return b, "", nil
+	}
+
+	mqttCompressionSavedBytesCounter(c.algorithm).Add(float64(len(b) - len(out)))
+
+	return out, c.algorithm, nil
+}
@@ -0,0 +1,100 @@
+package mqtt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressor(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"gatewayID":"0102030405060708","rssi":-60}`), 20)
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := newCompressor("none", 0)
+		assert.NoError(err)
+		assert.Nil(c)
+
+		out, enc, err := c.compress(payload)
+		assert.NoError(err)
+		assert.Equal("", enc)
+		assert.Equal(payload, out)
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := newCompressor("brotli", 0)
+		assert.EqualError(err, "unknown compression algorithm: brotli")
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := newCompressor("gzip", 100)
+		assert.NoError(err)
+
+		out, enc, err := c.compress(payload)
+		assert.NoError(err)
+		assert.Equal("gzip", enc)
+		assert.True(len(out) < len(payload))
+
+		r, err := gzip.NewReader(bytes.NewReader(out))
+		assert.NoError(err)
+		b, err := ioutil.ReadAll(r)
+		assert.NoError(err)
+		assert.Equal(payload, b)
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := newCompressor("zstd", 100)
+		assert.NoError(err)
+
+		out, enc, err := c.compress(payload)
+		assert.NoError(err)
+		assert.Equal("zstd", enc)
+		assert.True(len(out) < len(payload))
+
+		dec, err := zstd.NewReader(nil)
+		assert.NoError(err)
+		b, err := dec.DecodeAll(out, nil)
+		assert.NoError(err)
+		assert.Equal(payload, b)
+	})
+
+	t.Run("below min size", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := newCompressor("gzip", len(payload)+1)
+		assert.NoError(err)
+
+		out, enc, err := c.compress(payload)
+		assert.NoError(err)
+		assert.Equal("", enc)
+		assert.Equal(payload, out)
+	})
+
+	t.Run("incompressible", func(t *testing.T) {
+		assert := require.New(t)
+
+		random := make([]byte, 256)
+		_, err := rand.Read(random)
+		assert.NoError(err)
+
+		c, err := newCompressor("zstd", 0)
+		assert.NoError(err)
+
+		out, enc, err := c.compress(random)
+		assert.NoError(err)
+		assert.Equal("", enc)
+		assert.Equal(random, out)
+	})
+}
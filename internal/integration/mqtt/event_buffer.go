@@ -0,0 +1,89 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/brocaar/lorawan"
+)
+
+// bufferedEvent contains an event which could not be published.
+type bufferedEvent struct {
+	gatewayID lorawan.EUI64
+	event     string
+	topic     string
+	payload   []byte
+	createdAt time.Time
+}
+
+// eventBuffer buffers events that could not be published because the
+// connection to the MQTT broker was lost. The buffer is bounded by the
+// number of events and the age of the events.
+type eventBuffer struct {
+	sync.Mutex
+
+	maxCount int
+	maxAge   time.Duration
+	events   []bufferedEvent
+}
+
+func newEventBuffer(maxCount int, maxAge time.Duration) *eventBuffer {
+	return &eventBuffer{
+		maxCount: maxCount,
+		maxAge:   maxAge,
+	}
+}
+
+// enabled returns true when events can be buffered.
+func (b *eventBuffer) enabled() bool {
+	return b.maxCount > 0
+}
+
+// len returns the number of buffered events.
+func (b *eventBuffer) len() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.events)
+}
+
+// add adds the given event to the buffer. In case the buffer is full, the
+// oldest event is discarded.
+func (b *eventBuffer) add(e bufferedEvent) {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.events) >= b.maxCount {
+		mqttEventBufferDiscardCounter(b.events[0].event).Inc()
+		b.events = b.events[1:]
+	}
+
+	b.events = append(b.events, e)
+	mqttEventBufferCounter(e.event).Inc()
+}
+
+// flush calls the given publish function for each buffered event, in the
+// order in which they were added. Events older than the max age are
+// discarded. In case publish returns an error, flushing stops and the
+// remaining events are kept in the buffer.
+func (b *eventBuffer) flush(publish func(e bufferedEvent) error) error {
+	b.Lock()
+	defer b.Unlock()
+
+	for len(b.events) != 0 {
+		e := b.events[0]
+
+		if b.maxAge > 0 && time.Since(e.createdAt) > b.maxAge {
+			mqttEventBufferDiscardCounter(e.event).Inc()
+			b.events = b.events[1:]
+			continue
+		}
+
+		if err := publish(e); err != nil {
+			return err
+		}
+
+		b.events = b.events[1:]
+	}
+
+	return nil
+}
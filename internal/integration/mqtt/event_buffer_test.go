@@ -0,0 +1,57 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBuffer(t *testing.T) {
+	t.Run("max count", func(t *testing.T) {
+		assert := require.New(t)
+
+		b := newEventBuffer(2, time.Minute)
+		b.add(bufferedEvent{event: "ack", topic: "a", createdAt: time.Now()})
+		b.add(bufferedEvent{event: "ack", topic: "b", createdAt: time.Now()})
+		b.add(bufferedEvent{event: "ack", topic: "c", createdAt: time.Now()})
+		assert.Equal(2, b.len())
+
+		var topics []string
+		assert.NoError(b.flush(func(e bufferedEvent) error {
+			topics = append(topics, e.topic)
+			return nil
+		}))
+		assert.Equal([]string{"b", "c"}, topics)
+		assert.Equal(0, b.len())
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		assert := require.New(t)
+
+		b := newEventBuffer(10, time.Minute)
+		b.add(bufferedEvent{event: "ack", topic: "a", createdAt: time.Now().Add(-2 * time.Minute)})
+		b.add(bufferedEvent{event: "exec", topic: "b", createdAt: time.Now()})
+
+		var topics []string
+		assert.NoError(b.flush(func(e bufferedEvent) error {
+			topics = append(topics, e.topic)
+			return nil
+		}))
+		assert.Equal([]string{"b"}, topics)
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		assert := require.New(t)
+
+		b := newEventBuffer(10, time.Minute)
+		b.add(bufferedEvent{event: "ack", topic: "a", createdAt: time.Now()})
+		b.add(bufferedEvent{event: "ack", topic: "b", createdAt: time.Now()})
+
+		assert.Error(b.flush(func(e bufferedEvent) error {
+			return errors.New("not connected")
+		}))
+		assert.Equal(2, b.len())
+	})
+}
@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// primaryCheckTimeout defines the dial timeout of the primary broker check.
+var primaryCheckTimeout = 5 * time.Second
+
+// brokerFailover implements the broker selection when multiple brokers are
+// configured and failover is managed by the integration (round-robin or
+// fail-back to the primary broker). The client is connected to a single
+// broker at a time, such that the connected broker is known.
+type brokerFailover struct {
+	sync.Mutex
+
+	servers    []*url.URL
+	roundRobin bool
+
+	// current contains the index of the connected broker, -1 when not
+	// connected yet.
+	current int
+}
+
+func newBrokerFailover(servers []*url.URL, roundRobin bool) *brokerFailover {
+	return &brokerFailover{
+		servers:    servers,
+		roundRobin: roundRobin,
+		current:    -1,
+	}
+}
+
+// order returns the indices of the brokers in the order in which these must
+// be tried. Without round-robin, this always starts with the primary (first)
+// broker. With round-robin, this starts with the broker following the broker
+// used last.
+func (f *brokerFailover) order() []int {
+	f.Lock()
+	defer f.Unlock()
+
+	start := 0
+	if f.roundRobin {
+		start = f.current + 1
+	}
+
+	out := make([]int, len(f.servers))
+	for i := range out {
+		out[i] = (start + i) % len(f.servers)
+	}
+	return out
+}
+
+// setCurrent sets the index of the connected broker.
+func (f *brokerFailover) setCurrent(i int) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.current = i
+}
+
+// onPrimary returns true when connected to the primary broker.
+func (f *brokerFailover) onPrimary() bool {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.current == 0
+}
+
+// primaryReachable returns true when a TCP (or unix socket) connection to
+// the primary broker can be established.
+func (f *brokerFailover) primaryReachable() bool {
+	u := f.servers[0]
+
+	network := "tcp"
+	host := u.Host
+	if u.Scheme == "unix" {
+		// the host contains the path of the socket
+		network = "unix"
+	} else if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort(u.Scheme))
+	}
+
+	conn, err := net.DialTimeout(network, host, primaryCheckTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "ssl", "tls", "tcps", "mqtts":
+		return "8883"
+	case "ws":
+		return "80"
+	case "wss":
+		return "443"
+	default:
+		return "1883"
+	}
+}
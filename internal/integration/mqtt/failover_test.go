@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerFailover(t *testing.T) {
+	servers := func(s ...string) []*url.URL {
+		var out []*url.URL
+		for _, str := range s {
+			u, err := url.Parse(str)
+			require.NoError(t, err)
+			out = append(out, u)
+		}
+		return out
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		assert := require.New(t)
+
+		f := newBrokerFailover(servers("tcp://a:1883", "tcp://b:1883", "tcp://c:1883"), false)
+		assert.Equal([]int{0, 1, 2}, f.order())
+		assert.False(f.onPrimary())
+
+		f.setCurrent(1)
+		assert.Equal([]int{0, 1, 2}, f.order())
+		assert.False(f.onPrimary())
+
+		f.setCurrent(0)
+		assert.True(f.onPrimary())
+	})
+
+	t.Run("round-robin", func(t *testing.T) {
+		assert := require.New(t)
+
+		f := newBrokerFailover(servers("tcp://a:1883", "tcp://b:1883", "tcp://c:1883"), true)
+		assert.Equal([]int{0, 1, 2}, f.order())
+
+		f.setCurrent(0)
+		assert.Equal([]int{1, 2, 0}, f.order())
+
+		f.setCurrent(2)
+		assert.Equal([]int{0, 1, 2}, f.order())
+	})
+
+	t.Run("primary reachable", func(t *testing.T) {
+		assert := require.New(t)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		addr := ln.Addr().String()
+
+		f := newBrokerFailover(servers("tcp://"+addr, "tcp://b:1883"), false)
+		assert.True(f.primaryReachable())
+
+		assert.NoError(ln.Close())
+		assert.False(f.primaryReachable())
+	})
+
+	t.Run("primary reachable unix socket", func(t *testing.T) {
+		assert := require.New(t)
+
+		dir, err := ioutil.TempDir("", "failover")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "mqtt.sock")
+		ln, err := net.Listen("unix", path)
+		assert.NoError(err)
+
+		f := newBrokerFailover(append([]*url.URL{{Scheme: "unix", Host: path}}, servers("tcp://b:1883")...), false)
+		assert.True(f.primaryReachable())
+
+		assert.NoError(ln.Close())
+		assert.False(f.primaryReachable())
+	})
+}
@@ -30,6 +30,51 @@ var (
 		Name: "integration_mqtt_reconnect_count",
 		Help: "The number of times the integration reconnected to the MQTT broker (this also increments the disconnect and connect counters).",
 	})
+
+	mqttfb = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_mqtt_failback_count",
+		Help: "The number of times the integration failed back to the primary MQTT broker (this also increments the reconnect counter).",
+	})
+
+	ebc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_event_buffer_count",
+		Help: "The number of events buffered by the MQTT integration because they could not be published (per event).",
+	}, []string{"event"})
+
+	ebdc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_event_buffer_discard_count",
+		Help: "The number of buffered events discarded by the MQTT integration because they exceeded the max age or buffer size (per event).",
+	}, []string{"event"})
+
+	sfc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_store_and_forward_count",
+		Help: "The number of events stored on disk by the MQTT integration because they could not be published (per event).",
+	}, []string{"event"})
+
+	sfdc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_store_and_forward_discard_count",
+		Help: "The number of stored events discarded by the MQTT integration because they exceeded the max age or store size (per event).",
+	}, []string{"event"})
+
+	rpc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_replay_count",
+		Help: "The number of retained events replayed by the MQTT integration on a replay command (per event).",
+	}, []string{"event"})
+
+	asc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_aws_shadow_update_count",
+		Help: "The number of AWS IoT device shadow updates published by the MQTT integration (per event).",
+	}, []string{"event"})
+
+	csb = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_compression_saved_bytes",
+		Help: "The number of payload bytes saved by compressing the events published by the MQTT integration (per algorithm).",
+	}, []string{"algorithm"})
+
+	rcc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_mqtt_remote_config_count",
+		Help: "The number of remote configurations received by the MQTT integration.",
+	})
 )
 
 func mqttEventCounter(e string) prometheus.Counter {
@@ -51,3 +96,39 @@ func mqttDisconnectCounter() prometheus.Counter {
 func mqttReconnectCounter() prometheus.Counter {
 	return mqttr
 }
+
+func mqttFailbackCounter() prometheus.Counter {
+	return mqttfb
+}
+
+func mqttEventBufferCounter(e string) prometheus.Counter {
+	return ebc.With(prometheus.Labels{"event": e})
+}
+
+func mqttEventBufferDiscardCounter(e string) prometheus.Counter {
+	return ebdc.With(prometheus.Labels{"event": e})
+}
+
+func mqttStoreAndForwardCounter(e string) prometheus.Counter {
+	return sfc.With(prometheus.Labels{"event": e})
+}
+
+func mqttStoreAndForwardDiscardCounter(e string) prometheus.Counter {
+	return sfdc.With(prometheus.Labels{"event": e})
+}
+
+func mqttReplayCounter(e string) prometheus.Counter {
+	return rpc.With(prometheus.Labels{"event": e})
+}
+
+func mqttAWSShadowUpdateCounter(e string) prometheus.Counter {
+	return asc.With(prometheus.Labels{"event": e})
+}
+
+func mqttCompressionSavedBytesCounter(a string) prometheus.Counter {
+	return csb.With(prometheus.Labels{"algorithm": a})
+}
+
+func mqttRemoteConfigCounter() prometheus.Counter {
+	return rcc
+}
@@ -0,0 +1,98 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"text/template"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/remoteconfig"
+)
+
+// remoteConfigTopic returns the remote configuration topic for the given
+// topic template.
+func remoteConfigTopic(topicTemplate string) (string, error) {
+	tmpl, err := template.New("remote_config").Parse(topicTemplate)
+	if err != nil {
+		return "", errors.Wrap(err, "parse topic template error")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "get hostname error")
+	}
+
+	topic := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(topic, struct{ Hostname string }{hostname}); err != nil {
+		return "", errors.Wrap(err, "execute topic template error")
+	}
+
+	return topic.String(), nil
+}
+
+// subscribeRemoteConfig subscribes to the remote configuration topic and
+// publishes the current configuration state.
+func (b *Backend) subscribeRemoteConfig(c paho.Client) error {
+	log.WithFields(log.Fields{
+		"topic": b.remoteConfigTopic,
+		"qos":   b.qos,
+	}).Info("integration/mqtt: subscribing to remote configuration topic")
+
+	if token := c.Subscribe(b.remoteConfigTopic, b.qos, b.handleRemoteConfig); token.Wait() && token.Error() != nil {
+		return errors.Wrap(token.Error(), "subscribe topic error")
+	}
+
+	return b.publishRemoteConfigState(c)
+}
+
+// publishRemoteConfigState publishes the remote configuration state as
+// retained message, such that it is available to the network server or fleet
+// management tooling at any time.
+func (b *Backend) publishRemoteConfigState(c paho.Client) error {
+	state, err := remoteconfig.GetState()
+	if err != nil {
+		return errors.Wrap(err, "get remote configuration state error")
+	}
+
+	bb, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	log.WithFields(log.Fields{
+		"topic": b.remoteConfigStateTopic,
+		"qos":   b.qos,
+		"hash":  state.Hash,
+	}).Info("integration/mqtt: publishing remote configuration state")
+
+	if token := c.Publish(b.remoteConfigStateTopic, b.qos, true, bb); token.Wait() && token.Error() != nil {
+		return errors.Wrap(token.Error(), "publish remote configuration state error")
+	}
+
+	return nil
+}
+
+// handleRemoteConfig handles the received configuration. As applying the
+// configuration might (re)subscribe topics, this must not block the MQTT
+// message handler.
+func (b *Backend) handleRemoteConfig(c paho.Client, msg paho.Message) {
+	mqttRemoteConfigCounter().Inc()
+
+	payload := msg.Payload()
+
+	go func() {
+		if err := remoteconfig.Apply(payload); err != nil {
+			log.WithError(err).WithField("topic", msg.Topic()).Error("integration/mqtt: apply remote configuration error")
+		} else {
+			log.WithField("topic", msg.Topic()).Info("integration/mqtt: remote configuration applied")
+		}
+
+		if err := b.publishRemoteConfigState(c); err != nil {
+			log.WithError(err).Error("integration/mqtt: publish remote configuration state error")
+		}
+	}()
+}
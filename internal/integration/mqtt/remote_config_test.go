@@ -0,0 +1,22 @@
+package mqtt
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteConfigTopic(t *testing.T) {
+	assert := require.New(t)
+
+	hostname, err := os.Hostname()
+	assert.NoError(err)
+
+	topic, err := remoteConfigTopic("chirpstack-gateway-bridge/{{ .Hostname }}/config/set")
+	assert.NoError(err)
+	assert.Equal("chirpstack-gateway-bridge/"+hostname+"/config/set", topic)
+
+	_, err = remoteConfigTopic("chirpstack-gateway-bridge/{{ .GatewayID }}/config/set")
+	assert.Error(err)
+}
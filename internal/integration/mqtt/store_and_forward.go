@@ -0,0 +1,357 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/brocaar/lorawan"
+)
+
+var (
+	storeAndForwardBucket = []byte("events")
+	replayBucket          = []byte("replay")
+)
+
+// storeAndForward persists the events which could not be published because
+// the connection to the MQTT broker was lost, so that these survive a
+// restart. The store is bounded by the total size of the stored events and
+// the age of the events.
+//
+// When a replay retention is configured, the published events are retained
+// for this duration, such that these can be replayed on request (e.g. after
+// an outage of the network-server).
+type storeAndForward struct {
+	sync.Mutex
+
+	// flushMux makes sure that only one flush is running at a time, as
+	// concurrent flushes would publish the same events.
+	flushMux sync.Mutex
+
+	db        *bolt.DB
+	maxSize   int
+	maxAge    time.Duration
+	retention time.Duration
+
+	// size holds the total size of the stored events.
+	size int
+	// count holds the number of stored events.
+	count int
+}
+
+// storedEvent is the on-disk representation of a bufferedEvent.
+type storedEvent struct {
+	GatewayID lorawan.EUI64 `json:"gatewayID"`
+	Event     string        `json:"event"`
+	Topic     string        `json:"topic"`
+	Payload   []byte        `json:"payload"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// newStoreAndForward opens (or creates) the store at the given path. A
+// retention of 0 disables the retaining of published events.
+func newStoreAndForward(path string, maxSize int, maxAge, retention time.Duration) (*storeAndForward, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "open database error")
+	}
+
+	s := storeAndForward{
+		db:        db,
+		maxSize:   maxSize,
+		maxAge:    maxAge,
+		retention: retention,
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(replayBucket); err != nil {
+			return err
+		}
+
+		bucket, err := tx.CreateBucketIfNotExists(storeAndForwardBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			s.size += len(v)
+			s.count++
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "init database error")
+	}
+
+	return &s, nil
+}
+
+// len returns the number of stored events.
+func (s *storeAndForward) len() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.count
+}
+
+// add stores the given event. In case the max. size is exceeded, the oldest
+// events are discarded. A max. size of 0 disables the size limit.
+func (s *storeAndForward) add(e bufferedEvent) error {
+	b, err := json.Marshal(storedEvent{
+		GatewayID: e.gatewayID,
+		Event:     e.event,
+		Topic:     e.topic,
+		Payload:   e.payload,
+		CreatedAt: e.createdAt,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal event error")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var discarded []string
+	var discardedSize int
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(storeAndForwardBucket)
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil && s.maxSize > 0 && s.size-discardedSize+len(b) > s.maxSize; k, v = c.First() {
+			discarded = append(discarded, eventOf(v))
+			discardedSize += len(v)
+
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+
+		return bucket.Put(key, b)
+	})
+	if err != nil {
+		return errors.Wrap(err, "store event error")
+	}
+
+	for _, event := range discarded {
+		mqttStoreAndForwardDiscardCounter(event).Inc()
+	}
+
+	s.size += len(b) - discardedSize
+	s.count += 1 - len(discarded)
+	mqttStoreAndForwardCounter(e.event).Inc()
+
+	return nil
+}
+
+// flush calls the given publish function for each stored event, in the
+// order in which they were added. Events older than the max age are
+// discarded. In case publish returns an error, flushing stops and the
+// remaining events are kept in the store. The store is not locked while
+// publishing, so that events can be added during the flush.
+func (s *storeAndForward) flush(publish func(e bufferedEvent) error) error {
+	s.flushMux.Lock()
+	defer s.flushMux.Unlock()
+
+	for {
+		key, v, err := s.first()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return nil
+		}
+
+		var se storedEvent
+		if err := json.Unmarshal(v, &se); err != nil {
+			// an event which can't be decoded is discarded, as it would
+			// block the store otherwise
+			mqttStoreAndForwardDiscardCounter("").Inc()
+		} else if s.maxAge > 0 && time.Since(se.CreatedAt) > s.maxAge {
+			mqttStoreAndForwardDiscardCounter(se.Event).Inc()
+		} else if err := publish(bufferedEvent{
+			gatewayID: se.GatewayID,
+			event:     se.Event,
+			topic:     se.Topic,
+			payload:   se.Payload,
+			createdAt: se.CreatedAt,
+		}); err != nil {
+			return err
+		}
+
+		if err := s.delete(key); err != nil {
+			return err
+		}
+	}
+}
+
+// first returns the key and value of the oldest event, or nil when the
+// store is empty.
+func (s *storeAndForward) first() ([]byte, []byte, error) {
+	var key, value []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k, v := tx.Bucket(storeAndForwardBucket).Cursor().First()
+		if k != nil {
+			// the slices are only valid during the transaction
+			key = append([]byte{}, k...)
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read event error")
+	}
+
+	return key, value, nil
+}
+
+// delete deletes the event with the given key. Note that the event might
+// already have been discarded by add during the flush.
+func (s *storeAndForward) delete(key []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var deleted int
+	var size int
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(storeAndForwardBucket)
+
+		v := bucket.Get(key)
+		if v == nil {
+			return nil
+		}
+
+		deleted = 1
+		size = len(v)
+
+		return bucket.Delete(key)
+	})
+	if err != nil {
+		return errors.Wrap(err, "delete event error")
+	}
+
+	s.size -= size
+	s.count -= deleted
+
+	return nil
+}
+
+// retain retains the given (published) event for the replay retention.
+// Events exceeding the retention are removed.
+func (s *storeAndForward) retain(e bufferedEvent) error {
+	if s.retention == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(storedEvent{
+		GatewayID: e.gatewayID,
+		Event:     e.event,
+		Topic:     e.topic,
+		Payload:   e.payload,
+		CreatedAt: e.createdAt,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal event error")
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(replayBucket)
+
+		// The keys are ordered by time, the expired events are therefore
+		// at the start of the bucket.
+		cutoff := time.Now().Add(-s.retention).UnixNano()
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k[:8])) < cutoff; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(replayKey(e.createdAt, seq), b)
+	})
+	if err != nil {
+		return errors.Wrap(err, "retain event error")
+	}
+
+	return nil
+}
+
+// replay calls the given publish function for each retained event of the
+// given gateway, created within the given time range (start inclusive, end
+// exclusive), in the order in which they were created. It returns the number
+// of replayed events.
+func (s *storeAndForward) replay(gatewayID lorawan.EUI64, start, end time.Time, publish func(e bufferedEvent) error) (int, error) {
+	var events []bufferedEvent
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(replayBucket).Cursor()
+
+		for k, v := c.Seek(replayKey(start, 0)); k != nil && int64(binary.BigEndian.Uint64(k[:8])) < end.UnixNano(); k, v = c.Next() {
+			var se storedEvent
+			if err := json.Unmarshal(v, &se); err != nil || se.GatewayID != gatewayID {
+				continue
+			}
+
+			events = append(events, bufferedEvent{
+				gatewayID: se.GatewayID,
+				event:     se.Event,
+				topic:     se.Topic,
+				payload:   se.Payload,
+				createdAt: se.CreatedAt,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "read events error")
+	}
+
+	for i, e := range events {
+		if err := publish(e); err != nil {
+			return i, err
+		}
+	}
+
+	return len(events), nil
+}
+
+// replayKey returns the key of a retained event, which is ordered by the
+// time at which the event was created.
+func replayKey(createdAt time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], uint64(createdAt.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// close closes the store.
+func (s *storeAndForward) close() error {
+	return s.db.Close()
+}
+
+// eventOf returns the event type of the given stored event.
+func eventOf(b []byte) string {
+	var se storedEvent
+	json.Unmarshal(b, &se)
+	return se.Event
+}
@@ -0,0 +1,151 @@
+package mqtt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestStoreAndForward(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store_and_forward")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	flushTopics := func(s *storeAndForward) ([]string, error) {
+		var topics []string
+		err := s.flush(func(e bufferedEvent) error {
+			topics = append(topics, e.topic)
+			return nil
+		})
+		return topics, err
+	}
+
+	t.Run("persisted", func(t *testing.T) {
+		assert := require.New(t)
+		path := filepath.Join(dir, "persisted.db")
+
+		s, err := newStoreAndForward(path, 0, time.Minute, 0)
+		assert.NoError(err)
+		assert.NoError(s.add(bufferedEvent{event: "up", topic: "a", payload: []byte{1, 2, 3}, createdAt: time.Now()}))
+		assert.NoError(s.add(bufferedEvent{event: "up", topic: "b", payload: []byte{4, 5, 6}, createdAt: time.Now()}))
+		assert.NoError(s.close())
+
+		s, err = newStoreAndForward(path, 0, time.Minute, 0)
+		assert.NoError(err)
+		defer s.close()
+		assert.Equal(2, s.len())
+
+		var events []bufferedEvent
+		assert.NoError(s.flush(func(e bufferedEvent) error {
+			events = append(events, e)
+			return nil
+		}))
+		assert.Len(events, 2)
+		assert.Equal("a", events[0].topic)
+		assert.Equal([]byte{1, 2, 3}, events[0].payload)
+		assert.Equal("b", events[1].topic)
+		assert.Equal(0, s.len())
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newStoreAndForward(filepath.Join(dir, "max_size.db"), 400, time.Minute, 0)
+		assert.NoError(err)
+		defer s.close()
+
+		for _, topic := range []string{"a", "b", "c"} {
+			assert.NoError(s.add(bufferedEvent{event: "up", topic: topic, payload: make([]byte, 50), createdAt: time.Now()}))
+		}
+		assert.Equal(2, s.len())
+
+		topics, err := flushTopics(s)
+		assert.NoError(err)
+		assert.Equal([]string{"b", "c"}, topics)
+		assert.Equal(0, s.len())
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newStoreAndForward(filepath.Join(dir, "max_age.db"), 0, time.Minute, 0)
+		assert.NoError(err)
+		defer s.close()
+
+		assert.NoError(s.add(bufferedEvent{event: "up", topic: "a", createdAt: time.Now().Add(-2 * time.Minute)}))
+		assert.NoError(s.add(bufferedEvent{event: "up", topic: "b", createdAt: time.Now()}))
+
+		topics, err := flushTopics(s)
+		assert.NoError(err)
+		assert.Equal([]string{"b"}, topics)
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newStoreAndForward(filepath.Join(dir, "publish_error.db"), 0, time.Minute, 0)
+		assert.NoError(err)
+		defer s.close()
+
+		assert.NoError(s.add(bufferedEvent{event: "up", topic: "a", createdAt: time.Now()}))
+		assert.NoError(s.add(bufferedEvent{event: "up", topic: "b", createdAt: time.Now()}))
+
+		assert.Error(s.flush(func(e bufferedEvent) error {
+			return errors.New("not connected")
+		}))
+		assert.Equal(2, s.len())
+
+		topics, err := flushTopics(s)
+		assert.NoError(err)
+		assert.Equal([]string{"a", "b"}, topics)
+	})
+}
+
+func TestStoreAndForwardReplay(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "store_and_forward_replay")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	gw1 := lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+	gw2 := lorawan.EUI64{2, 2, 2, 2, 2, 2, 2, 2}
+	now := time.Now()
+
+	s, err := newStoreAndForward(filepath.Join(dir, "replay.db"), 0, time.Minute, time.Hour)
+	assert.NoError(err)
+	defer s.close()
+
+	// expired
+	assert.NoError(s.retain(bufferedEvent{gatewayID: gw1, event: "up", topic: "a", createdAt: now.Add(-2 * time.Hour)}))
+	assert.NoError(s.retain(bufferedEvent{gatewayID: gw1, event: "up", topic: "b", createdAt: now.Add(-30 * time.Minute)}))
+	assert.NoError(s.retain(bufferedEvent{gatewayID: gw2, event: "up", topic: "c", createdAt: now.Add(-20 * time.Minute)}))
+	assert.NoError(s.retain(bufferedEvent{gatewayID: gw1, event: "up_set", topic: "d", createdAt: now.Add(-10 * time.Minute)}))
+	assert.NoError(s.retain(bufferedEvent{gatewayID: gw1, event: "up", topic: "e", createdAt: now}))
+
+	replayTopics := func(gatewayID lorawan.EUI64, start, end time.Time) []string {
+		var topics []string
+		n, err := s.replay(gatewayID, start, end, func(e bufferedEvent) error {
+			topics = append(topics, e.topic)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal(len(topics), n)
+		return topics
+	}
+
+	assert.Equal([]string{"b", "d", "e"}, replayTopics(gw1, now.Add(-3*time.Hour), now.Add(time.Second)))
+	assert.Equal([]string{"b", "d"}, replayTopics(gw1, now.Add(-3*time.Hour), now))
+	assert.Equal([]string{"d"}, replayTopics(gw1, now.Add(-15*time.Minute), now))
+	assert.Equal([]string{"c"}, replayTopics(gw2, now.Add(-time.Hour), now))
+
+	// the retained events are not part of the store-and-forward events
+	assert.Equal(0, s.len())
+}
@@ -0,0 +1,244 @@
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/tracing"
+	"github.com/brocaar/lorawan"
+)
+
+// multiplexedIntegration contains an integration handled by the multiplexer.
+type multiplexedIntegration struct {
+	name            string
+	integration     Integration
+	commandsEnabled bool
+}
+
+// multiplexer implements an Integration which fans out the events to all
+// the integrations. Commands are only received from (and gateway
+// subscriptions are only set for) the integrations with commands enabled,
+// to avoid duplicate downlinks. When routes are configured, the uplinks are
+// only published to the integrations of the matching routes.
+type multiplexer struct {
+	integrations []multiplexedIntegration
+
+	routerMux  sync.RWMutex
+	router     *router
+	namePrefix string
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+}
+
+func newMultiplexer(integrations []multiplexedIntegration) *multiplexer {
+	m := multiplexer{
+		integrations:                  integrations,
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+	}
+
+	for _, i := range m.integrations {
+		if !i.commandsEnabled {
+			continue
+		}
+
+		m.forwardCommands(i.integration)
+	}
+
+	return &m
+}
+
+// setRoutes configures the uplink routes. The given prefix is prepended to
+// the integration names of the routes (see newIntegrations).
+func (m *multiplexer) setRoutes(routes []config.IntegrationRoute, namePrefix string) error {
+	r, err := newRouter(routes, namePrefix)
+	if err != nil {
+		return err
+	}
+
+	m.routerMux.Lock()
+	defer m.routerMux.Unlock()
+
+	m.router = r
+	m.namePrefix = namePrefix
+
+	return nil
+}
+
+// SetGatewaySubscription updates the gateway subscription of the
+// integrations with commands enabled.
+func (m *multiplexer) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	var errs []string
+
+	for _, i := range m.integrations {
+		if !i.commandsEnabled {
+			continue
+		}
+
+		if err := i.integration.SetGatewaySubscription(subscribe, gatewayID); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", i.name, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("set gateway subscription error: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// PublishEvent publishes the given event to all integrations (or for
+// uplinks, to the integrations selected by the routes). The event is
+// published concurrently, a failing integration does not block the others.
+func (m *multiplexer) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	var errs []string
+
+	m.routerMux.RLock()
+	r := m.router
+	m.routerMux.RUnlock()
+
+	var routed map[string]bool
+	if r != nil {
+		routed = r.getIntegrations(v)
+	}
+
+	for _, i := range m.integrations {
+		if r != nil && !r.publish(i.name, routed) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i multiplexedIntegration) {
+			defer wg.Done()
+
+			span := tracing.StartSpan(id, "publish", tracing.Attr("integration", i.name), tracing.Attr("event", event))
+			err := i.integration.PublishEvent(gatewayID, event, id, v)
+			span.End(err)
+
+			if err != nil {
+				publishErrorCounter(i.name, event).Inc()
+
+				mux.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %s", i.name, err))
+				mux.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return fmt.Errorf("publish event error: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the channel for downlink frames.
+func (m *multiplexer) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return m.downlinkFrameChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (m *multiplexer) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return m.rawPacketForwarderCommandChan
+}
+
+// GetGatewayConfigurationChan returns the channel for gateway configuration.
+func (m *multiplexer) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return m.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan() returns the channel for gateway command execution.
+func (m *multiplexer) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return m.gatewayCommandExecRequestChan
+}
+
+// Close closes all integrations.
+func (m *multiplexer) Close() error {
+	var errs []string
+
+	for _, i := range m.integrations {
+		if err := i.integration.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", i.name, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("close integration error: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// Reload applies the given configuration to the routes and to the
+// integrations implementing the Reloader interface.
+func (m *multiplexer) Reload(conf config.Config) error {
+	var errs []string
+
+	m.routerMux.RLock()
+	namePrefix := m.namePrefix
+	m.routerMux.RUnlock()
+
+	if err := m.setRoutes(conf.Integration.Routes, namePrefix); err != nil {
+		errs = append(errs, fmt.Sprintf("routes: %s", err))
+	}
+
+	for _, i := range m.integrations {
+		r, ok := i.integration.(Reloader)
+		if !ok {
+			continue
+		}
+
+		if err := r.Reload(conf); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", i.name, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("reload integration error: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// forwardCommands forwards the commands of the given integration to the
+// multiplexer channels.
+func (m *multiplexer) forwardCommands(i Integration) {
+	go func() {
+		for downlinkFrame := range i.GetDownlinkFrameChan() {
+			m.downlinkFrameChan <- downlinkFrame
+		}
+	}()
+
+	go func() {
+		for gatewayConfig := range i.GetGatewayConfigurationChan() {
+			m.gatewayConfigurationChan <- gatewayConfig
+		}
+	}()
+
+	go func() {
+		for execReq := range i.GetGatewayCommandExecRequestChan() {
+			m.gatewayCommandExecRequestChan <- execReq
+		}
+	}()
+
+	go func() {
+		for raw := range i.GetRawPacketForwarderChan() {
+			m.rawPacketForwarderCommandChan <- raw
+		}
+	}()
+}
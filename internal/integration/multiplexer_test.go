@@ -0,0 +1,157 @@
+package integration
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+type publishedEvent struct {
+	GatewayID lorawan.EUI64
+	Event     string
+	ID        uuid.UUID
+}
+
+type testIntegration struct {
+	sync.Mutex
+
+	publishError  error
+	published     []publishedEvent
+	subscriptions map[lorawan.EUI64]bool
+	closed        bool
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+}
+
+func newTestIntegration(publishError error) *testIntegration {
+	return &testIntegration{
+		publishError:                  publishError,
+		subscriptions:                 make(map[lorawan.EUI64]bool),
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+	}
+}
+
+func (i *testIntegration) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	i.Lock()
+	defer i.Unlock()
+	i.subscriptions[gatewayID] = subscribe
+	return nil
+}
+
+func (i *testIntegration) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	if i.publishError != nil {
+		return i.publishError
+	}
+
+	i.Lock()
+	defer i.Unlock()
+	i.published = append(i.published, publishedEvent{GatewayID: gatewayID, Event: event, ID: id})
+	return nil
+}
+
+func (i *testIntegration) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return i.downlinkFrameChan
+}
+
+func (i *testIntegration) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return i.rawPacketForwarderCommandChan
+}
+
+func (i *testIntegration) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return i.gatewayConfigurationChan
+}
+
+func (i *testIntegration) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return i.gatewayCommandExecRequestChan
+}
+
+func (i *testIntegration) Close() error {
+	i.closed = true
+	return nil
+}
+
+func TestMultiplexer(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	commands := newTestIntegration(nil)
+	failing := newTestIntegration(errors.New("boom"))
+
+	m := newMultiplexer([]multiplexedIntegration{
+		{name: "commands", integration: commands, commandsEnabled: true},
+		{name: "failing", integration: failing},
+	})
+
+	t.Run("publish event", func(t *testing.T) {
+		assert := require.New(t)
+
+		errorCount := testutil.ToFloat64(publishErrorCounter("failing", EventUp))
+
+		id, err := uuid.NewV4()
+		assert.NoError(err)
+
+		err = m.PublishEvent(gatewayID, EventUp, id, &gw.UplinkFrame{})
+		assert.EqualError(err, "publish event error: failing: boom")
+
+		// the failing integration does not block the other integration
+		assert.Equal([]publishedEvent{{GatewayID: gatewayID, Event: EventUp, ID: id}}, commands.published)
+		assert.Equal(errorCount+1, testutil.ToFloat64(publishErrorCounter("failing", EventUp)))
+		assert.Equal(float64(0), testutil.ToFloat64(publishErrorCounter("commands", EventUp)))
+	})
+
+	t.Run("gateway subscription", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(m.SetGatewaySubscription(true, gatewayID))
+		assert.Equal(map[lorawan.EUI64]bool{gatewayID: true}, commands.subscriptions)
+		assert.Len(failing.subscriptions, 0)
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		assert := require.New(t)
+
+		downlinkFrame := gw.DownlinkFrame{Token: 1234}
+		commands.downlinkFrameChan <- downlinkFrame
+		assert.Equal(downlinkFrame, <-m.GetDownlinkFrameChan())
+
+		gatewayConfig := gw.GatewayConfiguration{Version: "1.2.3"}
+		commands.gatewayConfigurationChan <- gatewayConfig
+		assert.Equal(gatewayConfig, <-m.GetGatewayConfigurationChan())
+
+		execReq := gw.GatewayCommandExecRequest{Command: "reboot"}
+		commands.gatewayCommandExecRequestChan <- execReq
+		assert.Equal(execReq, <-m.GetGatewayCommandExecRequestChan())
+
+		raw := gw.RawPacketForwarderCommand{Payload: []byte{1, 2, 3}}
+		commands.rawPacketForwarderCommandChan <- raw
+		assert.Equal(raw, <-m.GetRawPacketForwarderChan())
+
+		// commands of the integration without commands enabled are ignored
+		select {
+		case failing.downlinkFrameChan <- gw.DownlinkFrame{}:
+			t.Fatal("downlink frame must not be consumed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(m.Close())
+		assert.True(commands.closed)
+		assert.True(failing.closed)
+	})
+}
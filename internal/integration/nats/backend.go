@@ -0,0 +1,421 @@
+// Package nats implements a NATS (and NATS JetStream) integration.
+package nats
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// Backend implements a NATS backend.
+type Backend struct {
+	sync.RWMutex
+
+	conn *nats.Conn
+	js   nats.JetStreamContext
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+	gateways                      map[lorawan.EUI64]*nats.Subscription
+
+	commandsEnabled        bool
+	eventSubjectTemplate   *template.Template
+	commandSubjectTemplate *template.Template
+
+	// marshalers contains the per event-type marshalers, marshal and
+	// unmarshal are the functions of the default marshaler.
+	marshalers marshaler.Set
+	marshal    func(msg proto.Message) ([]byte, error)
+	unmarshal  func(b []byte, msg proto.Message) error
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	var err error
+	natsConf := conf.Integration.NATS
+
+	b := Backend{
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+		gateways:                      make(map[lorawan.EUI64]*nats.Subscription),
+
+		commandsEnabled: natsConf.CommandsEnabled,
+	}
+
+	if len(natsConf.Servers) == 0 {
+		return nil, errors.New("integration/nats: at least one server must be configured")
+	}
+
+	b.marshalers, err = marshaler.NewSetForConfig(conf.Integration)
+	if err != nil {
+		return nil, fmt.Errorf("integration/nats: %s", err)
+	}
+	b.marshal = b.marshalers.Default.Marshal
+	b.unmarshal = b.marshalers.Default.Unmarshal
+
+	b.eventSubjectTemplate, err = template.New("event").Parse(natsConf.EventSubjectTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/nats: parse event-subject template error")
+	}
+
+	b.commandSubjectTemplate, err = template.New("command").Parse(natsConf.CommandSubjectTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/nats: parse command-subject template error")
+	}
+
+	opts := []nats.Option{
+		nats.Name("chirpstack-gateway-bridge"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsConf.ReconnectWait),
+		nats.RetryOnFailedConnect(true),
+		nats.ReconnectHandler(b.onConnected),
+		nats.DisconnectErrHandler(b.onDisconnected),
+	}
+
+	if natsConf.Username != "" || natsConf.Password != "" {
+		opts = append(opts, nats.UserInfo(natsConf.Username, natsConf.Password))
+	}
+	if natsConf.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(natsConf.CredentialsFile))
+	}
+	if natsConf.CACert != "" {
+		opts = append(opts, nats.RootCAs(natsConf.CACert))
+	}
+	if natsConf.TLSCert != "" && natsConf.TLSKey != "" {
+		opts = append(opts, nats.ClientCert(natsConf.TLSCert, natsConf.TLSKey))
+	}
+
+	log.WithFields(log.Fields{
+		"servers": natsConf.Servers,
+	}).Info("integration/nats: connecting to nats server(s)")
+
+	// With RetryOnFailedConnect, the connection is (re)tried in the
+	// background when the servers are not reachable, in which case the
+	// reconnect handler is called once connected.
+	b.conn, err = nats.Connect(strings.Join(natsConf.Servers, ","), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/nats: connect error")
+	}
+	if b.conn.IsConnected() {
+		b.onConnected(b.conn)
+	}
+
+	if natsConf.JetStream.Enabled {
+		b.js, err = b.conn.JetStream()
+		if err != nil {
+			b.conn.Close()
+			return nil, errors.Wrap(err, "integration/nats: new jetstream context error")
+		}
+
+		if natsConf.JetStream.Stream != "" {
+			if err := b.addStream(natsConf.JetStream.Stream, natsConf.JetStream.Subjects); err != nil {
+				b.conn.Close()
+				return nil, errors.Wrap(err, "integration/nats: add stream error")
+			}
+		}
+	}
+
+	return &b, nil
+}
+
+// addStream creates the JetStream stream capturing the events, in case it
+// does not exist.
+func (b *Backend) addStream(name string, subjects []string) error {
+	if _, err := b.js.StreamInfo(name); err == nil {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"stream":   name,
+		"subjects": subjects,
+	}).Info("integration/nats: creating jetstream stream")
+
+	_, err := b.js.AddStream(&nats.StreamConfig{
+		Name:     name,
+		Subjects: subjects,
+		Storage:  nats.FileStorage,
+	})
+	return err
+}
+
+// Close closes the backend.
+func (b *Backend) Close() error {
+	log.Info("integration/nats: closing backend")
+
+	if err := b.conn.Drain(); err != nil {
+		b.conn.Close()
+		return errors.Wrap(err, "drain connection error")
+	}
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription (un)subscribes the given gateway to its command
+// subject. The subscriptions are restored by the client after a reconnect.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/nats: set gateway subscription called")
+
+	if !b.commandsEnabled {
+		return nil
+	}
+
+	sub, ok := b.gateways[gatewayID]
+	if ok == subscribe {
+		return nil
+	}
+
+	if !subscribe {
+		log.WithFields(log.Fields{
+			"subject": sub.Subject,
+		}).Info("integration/nats: unsubscribing from subject")
+
+		if err := sub.Unsubscribe(); err != nil {
+			return errors.Wrap(err, "unsubscribe subject error")
+		}
+		delete(b.gateways, gatewayID)
+		return nil
+	}
+
+	subject := bytes.NewBuffer(nil)
+	if err := b.commandSubjectTemplate.Execute(subject, struct{ GatewayID lorawan.EUI64 }{gatewayID}); err != nil {
+		return errors.Wrap(err, "execute command subject template error")
+	}
+
+	log.WithFields(log.Fields{
+		"subject": subject.String(),
+	}).Info("integration/nats: subscribing to subject")
+
+	sub, err := b.conn.Subscribe(subject.String(), b.handleCommand)
+	if err != nil {
+		return errors.Wrap(err, "subscribe subject error")
+	}
+	b.gateways[gatewayID] = sub
+
+	return nil
+}
+
+// PublishEvent publishes the given event.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	natsEventCounter(event).Inc()
+	idPrefix := map[string]string{
+		"up":     "uplink_",
+		"up_set": "uplink_",
+		"ack":    "downlink_",
+		"stats":  "stats_",
+		"exec":   "exec_",
+		"raw":    "raw_",
+		"log":    "log_",
+	}
+	return b.publish(gatewayID, event, log.Fields{
+		idPrefix[event] + "id": id,
+	}, v)
+}
+
+func (b *Backend) publish(gatewayID lorawan.EUI64, event string, fields log.Fields, msg proto.Message) error {
+	m := b.marshalers.Event(event)
+
+	subject := bytes.NewBuffer(nil)
+	if err := b.eventSubjectTemplate.Execute(subject, struct {
+		GatewayID lorawan.EUI64
+		EventType string
+		Marshaler string
+	}{gatewayID, event, m.Name}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+
+	bytes, err := m.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	fields["subject"] = subject.String()
+	fields["event"] = event
+	fields["jetstream"] = b.js != nil
+
+	log.WithFields(fields).Info("integration/nats: publishing event")
+
+	// When JetStream is enabled, the publish is acknowledged by the server
+	// once the event has been persisted in the stream.
+	if b.js != nil {
+		if _, err := b.js.Publish(subject.String(), bytes); err != nil {
+			return errors.Wrap(err, "jetstream publish error")
+		}
+		return nil
+	}
+
+	if err := b.conn.Publish(subject.String(), bytes); err != nil {
+		return errors.Wrap(err, "publish error")
+	}
+
+	return nil
+}
+
+func (b *Backend) onConnected(c *nats.Conn) {
+	natsConnectCounter().Inc()
+	log.WithFields(log.Fields{
+		"server": c.ConnectedUrl(),
+	}).Info("integration/nats: connected to nats server")
+}
+
+func (b *Backend) onDisconnected(c *nats.Conn, err error) {
+	// The disconnect handler is also called when closing the connection.
+	if c.IsClosed() {
+		return
+	}
+
+	natsDisconnectCounter().Inc()
+	log.WithError(err).Error("integration/nats: disconnected from nats server")
+}
+
+func (b *Backend) handleCommand(msg *nats.Msg) {
+	var err error
+
+	// The last token of the subject contains the command type.
+	command := msg.Subject[strings.LastIndex(msg.Subject, ".")+1:]
+
+	switch command {
+	case "down":
+		natsCommandCounter("down").Inc()
+		err = b.handleDownlinkFrame(msg)
+	case "config":
+		natsCommandCounter("config").Inc()
+		err = b.handleGatewayConfiguration(msg)
+	case "exec":
+		natsCommandCounter("exec").Inc()
+		err = b.handleGatewayCommandExecRequest(msg)
+	case "raw":
+		natsCommandCounter("raw").Inc()
+		err = b.handleRawPacketForwarderCommand(msg)
+	default:
+		log.WithFields(log.Fields{
+			"subject": msg.Subject,
+		}).Warning("integration/nats: unexpected command received")
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"subject": msg.Subject,
+		}).WithError(err).Error("integration/nats: handle command error")
+	}
+}
+
+func (b *Backend) handleDownlinkFrame(msg *nats.Msg) error {
+	var downlinkFrame gw.DownlinkFrame
+	if err := b.unmarshal(msg.Data, &downlinkFrame); err != nil {
+		return errors.Wrap(err, "unmarshal downlink frame error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var downID uuid.UUID
+	copy(gatewayID[:], downlinkFrame.GetTxInfo().GetGatewayId())
+	copy(downID[:], downlinkFrame.GetDownlinkId())
+
+	log.WithFields(log.Fields{
+		"gateway_id":  gatewayID,
+		"downlink_id": downID,
+	}).Info("integration/nats: downlink frame received")
+
+	b.downlinkFrameChan <- downlinkFrame
+
+	return nil
+}
+
+func (b *Backend) handleGatewayConfiguration(msg *nats.Msg) error {
+	log.WithFields(log.Fields{
+		"subject": msg.Subject,
+	}).Info("integration/nats: gateway configuration received")
+
+	var gatewayConfig gw.GatewayConfiguration
+	if err := b.unmarshal(msg.Data, &gatewayConfig); err != nil {
+		return errors.Wrap(err, "unmarshal gateway configuration error")
+	}
+
+	b.gatewayConfigurationChan <- gatewayConfig
+
+	return nil
+}
+
+func (b *Backend) handleGatewayCommandExecRequest(msg *nats.Msg) error {
+	var gatewayCommandExecRequest gw.GatewayCommandExecRequest
+	if err := b.unmarshal(msg.Data, &gatewayCommandExecRequest); err != nil {
+		return errors.Wrap(err, "unmarshal gateway command execution request error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var execID uuid.UUID
+	copy(gatewayID[:], gatewayCommandExecRequest.GetGatewayId())
+	copy(execID[:], gatewayCommandExecRequest.GetExecId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"exec_id":    execID,
+	}).Info("integration/nats: gateway command execution request received")
+
+	b.gatewayCommandExecRequestChan <- gatewayCommandExecRequest
+
+	return nil
+}
+
+func (b *Backend) handleRawPacketForwarderCommand(msg *nats.Msg) error {
+	var rawPacketForwarderCommand gw.RawPacketForwarderCommand
+	if err := b.unmarshal(msg.Data, &rawPacketForwarderCommand); err != nil {
+		return errors.Wrap(err, "unmarshal raw packet-forwarder command error")
+	}
+
+	var gatewayID lorawan.EUI64
+	var rawID uuid.UUID
+	copy(gatewayID[:], rawPacketForwarderCommand.GetGatewayId())
+	copy(rawID[:], rawPacketForwarderCommand.GetRawId())
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"raw_id":     rawID,
+	}).Info("integration/nats: raw packet-forwarder command received")
+
+	b.rawPacketForwarderCommandChan <- rawPacketForwarderCommand
+
+	return nil
+}
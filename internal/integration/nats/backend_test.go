@@ -0,0 +1,195 @@
+package nats
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type NATSBackendTestSuite struct {
+	suite.Suite
+
+	server     string
+	natsClient *nats.Conn
+	backend    *Backend
+	gatewayID  lorawan.EUI64
+}
+
+func (ts *NATSBackendTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	log.SetLevel(log.ErrorLevel)
+
+	ts.server = "nats://127.0.0.1:4222"
+	if v := os.Getenv("TEST_NATS_SERVER"); v != "" {
+		ts.server = v
+	}
+
+	var err error
+	ts.natsClient, err = nats.Connect(ts.server)
+	assert.NoError(err)
+
+	ts.gatewayID = lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+
+	ts.backend, err = NewBackend(ts.config())
+	assert.NoError(err)
+	assert.NoError(ts.backend.SetGatewaySubscription(true, ts.gatewayID))
+	assert.NoError(ts.backend.conn.Flush())
+}
+
+func (ts *NATSBackendTestSuite) TearDownSuite() {
+	ts.natsClient.Close()
+	ts.backend.Close()
+}
+
+func (ts *NATSBackendTestSuite) config() config.Config {
+	var conf config.Config
+	conf.Integration.Marshaler = "protobuf"
+	conf.Integration.NATS.CommandsEnabled = true
+	conf.Integration.NATS.Servers = []string{ts.server}
+	conf.Integration.NATS.EventSubjectTemplate = "gateway.{{ .GatewayID }}.event.{{ .EventType }}"
+	conf.Integration.NATS.CommandSubjectTemplate = "gateway.{{ .GatewayID }}.command.*"
+	conf.Integration.NATS.ReconnectWait = time.Second
+	return conf
+}
+
+func (ts *NATSBackendTestSuite) TestSubscribeGateway() {
+	assert := require.New(ts.T())
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	assert.NoError(ts.backend.SetGatewaySubscription(true, gatewayID))
+	_, ok := ts.backend.gateways[gatewayID]
+	assert.True(ok)
+
+	ts.T().Run("Unsubscribe", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.backend.SetGatewaySubscription(false, gatewayID))
+		_, ok := ts.backend.gateways[gatewayID]
+		assert.False(ok)
+	})
+}
+
+func (ts *NATSBackendTestSuite) TestPublishUplinkFrame() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	uplink := gw.UplinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		RxInfo: &gw.UplinkRXInfo{
+			UplinkId: id[:],
+		},
+	}
+
+	sub, err := ts.natsClient.SubscribeSync("gateway.*.event.up")
+	assert.NoError(err)
+	defer sub.Unsubscribe()
+	assert.NoError(ts.natsClient.Flush())
+
+	assert.NoError(ts.backend.PublishEvent(ts.gatewayID, "up", id, &uplink))
+
+	msg, err := sub.NextMsg(time.Second)
+	assert.NoError(err)
+	assert.Equal("gateway.0807060504030201.event.up", msg.Subject)
+
+	var pl gw.UplinkFrame
+	assert.NoError(ts.backend.unmarshal(msg.Data, &pl))
+	assert.True(proto.Equal(&uplink, &pl))
+}
+
+func (ts *NATSBackendTestSuite) TestDownlinkFrame() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	downlink := gw.DownlinkFrame{
+		PhyPayload: []byte{1, 2, 3, 4},
+		DownlinkId: id[:],
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: ts.gatewayID[:],
+		},
+	}
+
+	b, err := ts.backend.marshal(&downlink)
+	assert.NoError(err)
+	assert.NoError(ts.natsClient.Publish("gateway.0807060504030201.command.down", b))
+
+	select {
+	case received := <-ts.backend.GetDownlinkFrameChan():
+		assert.True(proto.Equal(&downlink, &received))
+	case <-time.After(time.Second):
+		assert.FailNow("downlink not received")
+	}
+}
+
+func (ts *NATSBackendTestSuite) TestGatewayCommandExecRequest() {
+	assert := require.New(ts.T())
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+
+	execReq := gw.GatewayCommandExecRequest{
+		GatewayId: ts.gatewayID[:],
+		Command:   "reboot",
+		ExecId:    id[:],
+	}
+
+	b, err := ts.backend.marshal(&execReq)
+	assert.NoError(err)
+	assert.NoError(ts.natsClient.Publish("gateway.0807060504030201.command.exec", b))
+
+	select {
+	case received := <-ts.backend.GetGatewayCommandExecRequestChan():
+		assert.True(proto.Equal(&execReq, &received))
+	case <-time.After(time.Second):
+		assert.FailNow("exec request not received")
+	}
+}
+
+func (ts *NATSBackendTestSuite) TestJetStream() {
+	assert := require.New(ts.T())
+
+	conf := ts.config()
+	conf.Integration.NATS.CommandsEnabled = false
+	conf.Integration.NATS.EventSubjectTemplate = "jetstream.{{ .GatewayID }}.event.{{ .EventType }}"
+	conf.Integration.NATS.JetStream.Enabled = true
+	conf.Integration.NATS.JetStream.Stream = "TEST_GATEWAY_EVENTS"
+	conf.Integration.NATS.JetStream.Subjects = []string{"jetstream.*.event.*"}
+
+	backend, err := NewBackend(conf)
+	assert.NoError(err)
+	defer backend.Close()
+	defer backend.js.DeleteStream(conf.Integration.NATS.JetStream.Stream)
+
+	// commands are disabled
+	assert.NoError(backend.SetGatewaySubscription(true, ts.gatewayID))
+	assert.Len(backend.gateways, 0)
+
+	id, err := uuid.NewV4()
+	assert.NoError(err)
+	stats := gw.GatewayStats{
+		GatewayId: ts.gatewayID[:],
+		StatsId:   id[:],
+	}
+	assert.NoError(backend.PublishEvent(ts.gatewayID, "stats", id, &stats))
+
+	info, err := backend.js.StreamInfo(conf.Integration.NATS.JetStream.Stream)
+	assert.NoError(err)
+	assert.EqualValues(1, info.State.Msgs)
+}
+
+func TestNATSBackend(t *testing.T) {
+	suite.Run(t, new(NATSBackendTestSuite))
+}
@@ -0,0 +1,212 @@
+// Package plugin implements the plugin integration. A plugin is an external
+// binary, started and supervised by the ChirpStack Gateway Bridge, which
+// implements the gRPC integration service on a unix socket.
+package plugin
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/grpc"
+)
+
+// SocketEnvVar holds the name of the environment variable containing the
+// path of the unix socket on which the plugin must serve the gRPC
+// integration service.
+const SocketEnvVar = "CHIRPSTACK_GATEWAY_BRIDGE_PLUGIN_SOCKET"
+
+// Backend implements the plugin integration. The events and commands are
+// handled by the embedded gRPC integration, connected to the socket of the
+// plugin.
+type Backend struct {
+	*grpc.Backend
+
+	sync.Mutex
+
+	path            string
+	args            []string
+	dir             string
+	socket          string
+	restartInterval time.Duration
+
+	// cmd holds the running plugin process, exited receives the result of
+	// waiting for this process.
+	cmd    *exec.Cmd
+	exited chan error
+	closed bool
+	done   chan struct{}
+}
+
+// NewBackend starts the plugin and creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	var err error
+
+	b := Backend{
+		path:            conf.Integration.Plugin.Path,
+		args:            conf.Integration.Plugin.Args,
+		restartInterval: conf.Integration.Plugin.RestartInterval,
+		done:            make(chan struct{}),
+	}
+
+	b.dir, err = ioutil.TempDir("", "chirpstack-gateway-bridge-plugin")
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/plugin: create socket directory error")
+	}
+	b.socket = filepath.Join(b.dir, "plugin.sock")
+
+	if err := b.start(); err != nil {
+		os.RemoveAll(b.dir)
+		return nil, errors.Wrap(err, "integration/plugin: start plugin error")
+	}
+
+	// The gRPC integration re-connects until the plugin is serving on the
+	// socket, also after a plugin restart.
+	conf.Integration.GRPC.CommandsEnabled = conf.Integration.Plugin.CommandsEnabled
+	conf.Integration.GRPC.Server = "unix:" + b.socket
+	conf.Integration.GRPC.MaxReconnectInterval = b.restartInterval
+	conf.Integration.GRPC.TLS = false
+
+	b.Backend, err = grpc.NewBackend(conf)
+	if err != nil {
+		b.stop()
+		os.RemoveAll(b.dir)
+		return nil, errors.Wrap(err, "integration/plugin: new grpc integration error")
+	}
+
+	go b.superviseLoop()
+
+	return &b, nil
+}
+
+// Close stops the plugin and closes the backend.
+func (b *Backend) Close() error {
+	b.stop()
+	<-b.done
+
+	err := b.Backend.Close()
+	os.RemoveAll(b.dir)
+	return err
+}
+
+// start starts the plugin process. The output of the plugin is logged.
+func (b *Backend) start() error {
+	// A stale socket of a previous run would prevent the plugin from
+	// listening.
+	os.Remove(b.socket)
+
+	pr, pw := io.Pipe()
+
+	cmd := exec.Command(b.path, b.args...)
+	cmd.Env = append(os.Environ(), SocketEnvVar+"="+b.socket)
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		return err
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			log.WithFields(log.Fields{
+				"path":   b.path,
+				"output": scanner.Text(),
+			}).Info("integration/plugin: plugin output")
+		}
+	}()
+
+	// The pipe is closed once the process has exited, which stops the output
+	// logging.
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		exited <- err
+	}()
+
+	b.Lock()
+	b.cmd = cmd
+	b.exited = exited
+	closed := b.closed
+	b.Unlock()
+
+	// The backend might have been closed while (re)starting the plugin.
+	if closed {
+		cmd.Process.Kill()
+	}
+
+	pluginStartCounter().Inc()
+	log.WithFields(log.Fields{
+		"path": b.path,
+		"pid":  cmd.Process.Pid,
+	}).Info("integration/plugin: plugin started")
+
+	return nil
+}
+
+// stop kills the plugin process. The plugin is not restarted after calling
+// stop.
+func (b *Backend) stop() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
+	if b.cmd != nil && b.cmd.Process != nil {
+		b.cmd.Process.Kill()
+	}
+}
+
+// superviseLoop waits for the plugin to exit and restarts it after the
+// restart interval, until the backend is closed.
+func (b *Backend) superviseLoop() {
+	defer close(b.done)
+
+	for {
+		b.Lock()
+		exited := b.exited
+		b.Unlock()
+
+		err := <-exited
+
+		b.Lock()
+		closed := b.closed
+		b.Unlock()
+
+		if closed {
+			return
+		}
+
+		pluginExitCounter().Inc()
+		log.WithError(err).WithField("path", b.path).Error("integration/plugin: plugin exited, restarting")
+
+		for {
+			time.Sleep(b.restartInterval)
+
+			b.Lock()
+			closed := b.closed
+			b.Unlock()
+
+			if closed {
+				return
+			}
+
+			if err := b.start(); err != nil {
+				log.WithError(err).WithField("path", b.path).Error("integration/plugin: start plugin error")
+				continue
+			}
+
+			break
+		}
+	}
+}
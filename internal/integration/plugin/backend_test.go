@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	ggrpc "google.golang.org/grpc"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/integration/grpc"
+	"github.com/brocaar/lorawan"
+)
+
+// TestMain runs the test binary as plugin when started by the Backend.
+func TestMain(m *testing.M) {
+	if socket := os.Getenv(SocketEnvVar); socket != "" {
+		runTestPlugin(socket)
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// runTestPlugin serves the gRPC integration service. For each subscribed
+// gateway, a downlink frame is sent back. On a log event, the plugin exits.
+func runTestPlugin(socket string) {
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	server := ggrpc.NewServer()
+	server.RegisterService(&ggrpc.ServiceDesc{
+		ServiceName: "gwbridge.GatewayBridgeService",
+		HandlerType: (*interface{})(nil),
+		Streams: []ggrpc.StreamDesc{
+			{
+				StreamName:    "Stream",
+				ServerStreams: true,
+				ClientStreams: true,
+				Handler: func(srv interface{}, stream ggrpc.ServerStream) error {
+					for {
+						var e grpc.Event
+						if err := stream.RecvMsg(&e); err != nil {
+							return err
+						}
+
+						if e.Log != nil {
+							os.Exit(1)
+						}
+
+						if e.GatewaySubscription != nil && e.GatewaySubscription.Subscribe {
+							if err := stream.SendMsg(&grpc.Command{
+								DownlinkFrame: &gw.DownlinkFrame{
+									TxInfo: &gw.DownlinkTXInfo{
+										GatewayId: e.GatewayId,
+									},
+								},
+							}); err != nil {
+								return err
+							}
+						}
+					}
+				},
+			},
+		},
+	}, struct{}{})
+	server.Serve(ln)
+}
+
+func TestBackend(t *testing.T) {
+	assert := require.New(t)
+
+	log.SetLevel(log.ErrorLevel)
+
+	var conf config.Config
+	conf.Integration.Plugin.CommandsEnabled = true
+	conf.Integration.Plugin.Path = os.Args[0]
+	conf.Integration.Plugin.RestartInterval = 100 * time.Millisecond
+
+	b, err := NewBackend(conf)
+	assert.NoError(err)
+	defer b.Close()
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	assert.NoError(b.SetGatewaySubscription(true, gatewayID))
+
+	select {
+	case pl := <-b.GetDownlinkFrameChan():
+		assert.Equal(gatewayID[:], pl.GetTxInfo().GetGatewayId())
+	case <-time.After(5 * time.Second):
+		assert.FailNow("downlink not received")
+	}
+
+	t.Run("plugin is restarted", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(b.PublishEvent(gatewayID, "log", uuid.Nil, &events.Log{Message: "exit"}))
+
+		// After the restart, the gateway subscription is sent again.
+		select {
+		case pl := <-b.GetDownlinkFrameChan():
+			assert.Equal(gatewayID[:], pl.GetTxInfo().GetGatewayId())
+		case <-time.After(5 * time.Second):
+			assert.FailNow("downlink not received after restart")
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package plugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	psc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_plugin_start_count",
+		Help: "The number of times the plugin was started (this includes restarts).",
+	})
+
+	pec = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_plugin_exit_count",
+		Help: "The number of times the plugin exited unexpectedly.",
+	})
+)
+
+func pluginStartCounter() prometheus.Counter {
+	return psc
+}
+
+func pluginExitCounter() prometheus.Counter {
+	return pec
+}
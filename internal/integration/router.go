@@ -0,0 +1,239 @@
+package integration
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// devAddrPrefix contains a DevAddr prefix (e.g. 26000000/7).
+type devAddrPrefix struct {
+	prefix uint32
+	size   int
+}
+
+// match returns true when the given DevAddr matches the prefix.
+func (p devAddrPrefix) match(devAddr lorawan.DevAddr) bool {
+	if p.size == 0 {
+		return true
+	}
+	mask := ^uint32(0) << uint(32-p.size)
+	return binary.BigEndian.Uint32(devAddr[:])&mask == p.prefix&mask
+}
+
+// route contains a parsed uplink routing rule.
+type route struct {
+	name            string
+	integrations    []string
+	netIDs          []lorawan.NetID
+	devAddrPrefixes []devAddrPrefix
+	joinEUIs        [][2]lorawan.EUI64
+}
+
+// router selects the integrations to which an uplink is published. Uplinks
+// are published to the integrations of the matching routes. Integrations
+// which are not part of any route receive all uplinks.
+type router struct {
+	routes []route
+	routed map[string]bool
+}
+
+// newRouter creates a router for the given routes. It returns nil when no
+// routes are configured. The given prefix is prepended to the integration
+// names (see newIntegrations).
+func newRouter(routes []config.IntegrationRoute, namePrefix string) (*router, error) {
+	if len(routes) == 0 {
+		return nil, nil
+	}
+
+	r := router{
+		routed: make(map[string]bool),
+	}
+
+	for _, rc := range routes {
+		rt := route{
+			name: rc.Name,
+		}
+
+		for _, name := range rc.Integrations {
+			rt.integrations = append(rt.integrations, namePrefix+name)
+			r.routed[namePrefix+name] = true
+		}
+
+		for _, s := range rc.NetIDs {
+			var netID lorawan.NetID
+			if err := netID.UnmarshalText([]byte(s)); err != nil {
+				return nil, errors.Wrapf(err, "route %s: unmarshal NetID error", rc.Name)
+			}
+			rt.netIDs = append(rt.netIDs, netID)
+		}
+
+		for _, s := range rc.DevAddrPrefixes {
+			p, err := parseDevAddrPrefix(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "route %s: parse DevAddr prefix error", rc.Name)
+			}
+			rt.devAddrPrefixes = append(rt.devAddrPrefixes, p)
+		}
+
+		for _, set := range rc.JoinEUIs {
+			var joinEUISet [2]lorawan.EUI64
+			for i, s := range set {
+				if err := joinEUISet[i].UnmarshalText([]byte(s)); err != nil {
+					return nil, errors.Wrapf(err, "route %s: unmarshal JoinEUI error", rc.Name)
+				}
+			}
+			rt.joinEUIs = append(rt.joinEUIs, joinEUISet)
+		}
+
+		log.WithFields(log.Fields{
+			"route":        rt.name,
+			"integrations": strings.Join(rt.integrations, ", "),
+		}).Info("integration: uplink route configured")
+
+		r.routes = append(r.routes, rt)
+	}
+
+	return &r, nil
+}
+
+// parseDevAddrPrefix parses the given DevAddr prefix (e.g. 26000000/7).
+func parseDevAddrPrefix(s string) (devAddrPrefix, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return devAddrPrefix{}, fmt.Errorf("expected DevAddr/size, got: %s", s)
+	}
+
+	var devAddr lorawan.DevAddr
+	if err := devAddr.UnmarshalText([]byte(parts[0])); err != nil {
+		return devAddrPrefix{}, errors.Wrap(err, "unmarshal DevAddr error")
+	}
+
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size < 0 || size > 32 {
+		return devAddrPrefix{}, fmt.Errorf("invalid prefix size: %s", parts[1])
+	}
+
+	return devAddrPrefix{
+		prefix: binary.BigEndian.Uint32(devAddr[:]),
+		size:   size,
+	}, nil
+}
+
+// getIntegrations returns the set of integrations of the routes matching
+// the given event. It returns nil when the event is not an uplink, in which
+// case it must be published to all integrations.
+func (r *router) getIntegrations(v interface{}) map[string]bool {
+	var phyPayload []byte
+
+	switch e := v.(type) {
+	case *gw.UplinkFrame:
+		phyPayload = e.GetPhyPayload()
+	case *gw.UplinkFrameSet:
+		phyPayload = e.GetPhyPayload()
+	default:
+		return nil
+	}
+
+	// uplinks which can not be decoded are routed to all routes (see match)
+	var phy lorawan.PHYPayload
+	if err := phy.UnmarshalBinary(phyPayload); err != nil {
+		log.WithError(err).Debug("integration: unmarshal phypayload error")
+	}
+
+	out := make(map[string]bool)
+	for _, rt := range r.routes {
+		if !rt.match(phy) {
+			continue
+		}
+
+		routeUplinkCounter(rt.name).Inc()
+		for _, i := range rt.integrations {
+			out[i] = true
+		}
+	}
+
+	if len(out) == 0 {
+		routeUnmatchedCounter().Inc()
+	}
+
+	return out
+}
+
+// publish returns true when the event must be published to the given
+// integration, given the integrations returned by getIntegrations.
+// Integrations which are not part of any route receive all events.
+func (r *router) publish(name string, integrations map[string]bool) bool {
+	return integrations == nil || !r.routed[name] || integrations[name]
+}
+
+// match returns true when the given PHYPayload matches the route. A route
+// without filters matches all uplinks, as do the uplinks which could not be
+// decoded and the proprietary uplinks.
+func (rt route) match(phy lorawan.PHYPayload) bool {
+	if len(rt.netIDs) == 0 && len(rt.devAddrPrefixes) == 0 && len(rt.joinEUIs) == 0 {
+		return true
+	}
+
+	switch v := phy.MACPayload.(type) {
+	case *lorawan.MACPayload:
+		return rt.matchDevAddr(v.FHDR.DevAddr)
+	case *lorawan.JoinRequestPayload:
+		return rt.matchJoinEUI(v.JoinEUI)
+	case *lorawan.RejoinRequestType02Payload:
+		return rt.matchNetID(v.NetID)
+	case *lorawan.RejoinRequestType1Payload:
+		return rt.matchJoinEUI(v.JoinEUI)
+	default:
+		return true
+	}
+}
+
+func (rt route) matchDevAddr(devAddr lorawan.DevAddr) bool {
+	for _, netID := range rt.netIDs {
+		if devAddr.IsNetID(netID) {
+			return true
+		}
+	}
+
+	for _, p := range rt.devAddrPrefixes {
+		if p.match(devAddr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rt route) matchNetID(netID lorawan.NetID) bool {
+	for _, n := range rt.netIDs {
+		if n == netID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rt route) matchJoinEUI(joinEUI lorawan.EUI64) bool {
+	joinEUIInt := binary.BigEndian.Uint64(joinEUI[:])
+
+	for _, pair := range rt.joinEUIs {
+		min := binary.BigEndian.Uint64(pair[0][:])
+		max := binary.BigEndian.Uint64(pair[1][:])
+
+		if joinEUIInt >= min && joinEUIInt <= max {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestRouter(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	private := newTestIntegration(nil)
+	partner := newTestIntegration(nil)
+	archive := newTestIntegration(nil)
+
+	m := newMultiplexer([]multiplexedIntegration{
+		{name: "mqtt", integration: private},
+		{name: "http", integration: partner},
+		{name: "kafka", integration: archive},
+	})
+	require.NoError(t, m.setRoutes([]config.IntegrationRoute{
+		{
+			Name:         "private",
+			Integrations: []string{"mqtt"},
+			NetIDs:       []string{"000000"},
+			JoinEUIs:     [][2]string{{"0000000000000000", "00000000000000ff"}},
+		},
+		{
+			Name:            "partner",
+			Integrations:    []string{"http"},
+			DevAddrPrefixes: []string{"26000000/7"},
+		},
+	}, ""))
+
+	phyPayload := func(phy lorawan.PHYPayload) []byte {
+		b, err := phy.MarshalBinary()
+		require.NoError(t, err)
+		return b
+	}
+
+	dataUp := func(devAddr lorawan.DevAddr) []byte {
+		return phyPayload(lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{
+				MType: lorawan.UnconfirmedDataUp,
+				Major: lorawan.LoRaWANR1,
+			},
+			MACPayload: &lorawan.MACPayload{
+				FHDR: lorawan.FHDR{
+					DevAddr: devAddr,
+				},
+			},
+		})
+	}
+
+	joinRequest := func(joinEUI lorawan.EUI64) []byte {
+		return phyPayload(lorawan.PHYPayload{
+			MHDR: lorawan.MHDR{
+				MType: lorawan.JoinRequest,
+				Major: lorawan.LoRaWANR1,
+			},
+			MACPayload: &lorawan.JoinRequestPayload{
+				JoinEUI: joinEUI,
+			},
+		})
+	}
+
+	tests := []struct {
+		Name      string
+		Event     string
+		Message   proto.Message
+		Private   bool
+		Partner   bool
+		Unmatched bool
+	}{
+		{
+			Name:    "private uplink",
+			Event:   EventUp,
+			Message: &gw.UplinkFrame{PhyPayload: dataUp(lorawan.DevAddr{1, 2, 3, 4})},
+			Private: true,
+		},
+		{
+			Name:    "partner uplink",
+			Event:   EventUp,
+			Message: &gw.UplinkFrame{PhyPayload: dataUp(lorawan.DevAddr{0x26, 1, 2, 3})},
+			Partner: true,
+		},
+		{
+			Name:    "partner uplink set",
+			Event:   EventUpSet,
+			Message: &gw.UplinkFrameSet{PhyPayload: dataUp(lorawan.DevAddr{0x27, 1, 2, 3})},
+			Partner: true,
+		},
+		{
+			Name:    "private join-request",
+			Event:   EventUp,
+			Message: &gw.UplinkFrame{PhyPayload: joinRequest(lorawan.EUI64{0, 0, 0, 0, 0, 0, 0, 1})},
+			Private: true,
+		},
+		{
+			Name:      "unmatched uplink",
+			Event:     EventUp,
+			Message:   &gw.UplinkFrame{PhyPayload: dataUp(lorawan.DevAddr{0xfe, 1, 2, 3})},
+			Unmatched: true,
+		},
+		{
+			Name:    "invalid phypayload",
+			Event:   EventUp,
+			Message: &gw.UplinkFrame{PhyPayload: []byte{1, 2, 3}},
+			Private: true,
+			Partner: true,
+		},
+		{
+			Name:    "stats",
+			Event:   EventStats,
+			Message: &gw.GatewayStats{},
+			Private: true,
+			Partner: true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			private.published = nil
+			partner.published = nil
+			archive.published = nil
+			unmatchedCount := testutil.ToFloat64(routeUnmatchedCounter())
+
+			assert.NoError(m.PublishEvent(gatewayID, tst.Event, uuid.Nil, tst.Message))
+
+			assert.Equal(tst.Private, len(private.published) == 1)
+			assert.Equal(tst.Partner, len(partner.published) == 1)
+
+			// the integration which is not part of any route receives all events
+			assert.Len(archive.published, 1)
+
+			if tst.Unmatched {
+				assert.Equal(unmatchedCount+1, testutil.ToFloat64(routeUnmatchedCounter()))
+			}
+		})
+	}
+}
+
+func TestParseDevAddrPrefix(t *testing.T) {
+	assert := require.New(t)
+
+	p, err := parseDevAddrPrefix("26000000/7")
+	assert.NoError(err)
+	assert.True(p.match(lorawan.DevAddr{0x26, 1, 2, 3}))
+	assert.True(p.match(lorawan.DevAddr{0x27, 1, 2, 3}))
+	assert.False(p.match(lorawan.DevAddr{0x28, 1, 2, 3}))
+
+	_, err = parseDevAddrPrefix("26000000")
+	assert.Error(err)
+
+	_, err = parseDevAddrPrefix("26000000/33")
+	assert.Error(err)
+}
@@ -0,0 +1,511 @@
+// Package semtechudp implements the Semtech UDP integration. For each gateway,
+// it acts as a Semtech UDP packet-forwarder towards a (legacy) network
+// server, e.g. to feed both ChirpStack and a legacy network server during a
+// migration.
+package semtechudp
+
+import (
+	"encoding"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp/packets"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+const (
+	// maxUplinkDelay defines the max. delay between an uplink and the
+	// downlink scheduled using the timestamp of this uplink.
+	maxUplinkDelay = 20 * time.Second
+
+	// maxUplinkContexts defines the max. number of uplink contexts stored per
+	// gateway.
+	maxUplinkContexts = 32
+
+	// maxDownlinkAge defines the max. age of a downlink for which a TX_ACK
+	// is sent.
+	maxDownlinkAge = time.Minute
+
+	// readBufferSize defines the size of the UDP read buffer.
+	readBufferSize = 65507
+)
+
+// uplinkContext contains the context of a forwarded uplink.
+type uplinkContext struct {
+	tmst    uint32
+	context []byte
+}
+
+// downlink contains the PULL_RESP token of a received downlink.
+type downlink struct {
+	token uint16
+	time  time.Time
+}
+
+// gateway contains the UDP connection of a single gateway to the network
+// server.
+type gateway struct {
+	sync.Mutex
+
+	id   lorawan.EUI64
+	conn *net.UDPConn
+	done chan struct{}
+
+	uplinks   []uplinkContext
+	downlinks map[uuid.UUID]downlink
+}
+
+// Backend implements the Semtech UDP integration.
+type Backend struct {
+	sync.RWMutex
+
+	server            *net.UDPAddr
+	keepaliveInterval time.Duration
+	commandsEnabled   bool
+	gateways          map[lorawan.EUI64]*gateway
+	closed            bool
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+}
+
+// NewBackend creates a new Backend.
+func NewBackend(conf config.Config) (*Backend, error) {
+	udpConf := conf.Integration.SemtechUDP
+
+	server, err := net.ResolveUDPAddr("udp", udpConf.Server)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/semtechudp: resolve server address error")
+	}
+
+	b := Backend{
+		server:            server,
+		keepaliveInterval: udpConf.KeepaliveInterval,
+		commandsEnabled:   udpConf.CommandsEnabled,
+		gateways:          make(map[lorawan.EUI64]*gateway),
+
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+	}
+
+	log.WithField("server", udpConf.Server).Info("integration/semtechudp: forwarding to network server")
+
+	return &b, nil
+}
+
+// Close closes the UDP connections of all gateways.
+func (b *Backend) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	log.Info("integration/semtechudp: closing backend")
+
+	b.closed = true
+	for gatewayID, g := range b.gateways {
+		g.close()
+		delete(b.gateways, gatewayID)
+	}
+
+	return nil
+}
+
+// GetDownlinkFrameChan returns the downlink frame channel.
+func (b *Backend) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return b.downlinkFrameChan
+}
+
+// GetGatewayConfigurationChan returns the gateway configuration channel.
+func (b *Backend) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return b.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan returns the channel for gateway command execution.
+func (b *Backend) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return b.gatewayCommandExecRequestChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (b *Backend) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return b.rawPacketForwarderCommandChan
+}
+
+// SetGatewaySubscription opens or closes the UDP connection of the given
+// gateway. Once opened, the PULL_DATA keepalives are sent to the network
+// server, such that it can send downlinks to the gateway.
+func (b *Backend) SetGatewaySubscription(subscribe bool, gatewayID lorawan.EUI64) error {
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"subscribe":  subscribe,
+	}).Debug("integration/semtechudp: set gateway subscription called")
+
+	if subscribe {
+		_, err := b.getGateway(gatewayID)
+		return err
+	}
+
+	b.closeGateway(gatewayID)
+	return nil
+}
+
+// PublishEvent forwards the given event to the network server. Only the
+// uplink, stats and ack events are supported by the Semtech UDP protocol,
+// the other events are ignored.
+func (b *Backend) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	switch pl := v.(type) {
+	case *gw.UplinkFrame:
+		eventCounter(event).Inc()
+		return b.publishUplinkFrame(gatewayID, *pl)
+	case *gw.UplinkFrameSet:
+		eventCounter(event).Inc()
+		for _, rxInfo := range pl.RxInfo {
+			var rxGatewayID lorawan.EUI64
+			copy(rxGatewayID[:], rxInfo.GetGatewayId())
+
+			if err := b.publishUplinkFrame(rxGatewayID, gw.UplinkFrame{
+				PhyPayload: pl.PhyPayload,
+				TxInfo:     pl.TxInfo,
+				RxInfo:     rxInfo,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *gw.GatewayStats:
+		eventCounter(event).Inc()
+		return b.publishGatewayStats(gatewayID, *pl)
+	case *gw.DownlinkTXAck:
+		eventCounter(event).Inc()
+		return b.publishDownlinkTXAck(gatewayID, *pl)
+	case *events.ConnState:
+		if pl.State == events.ConnStateOffline {
+			b.closeGateway(gatewayID)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *Backend) publishUplinkFrame(gatewayID lorawan.EUI64, frame gw.UplinkFrame) error {
+	rxpk, err := getRXPK(frame)
+	if err != nil {
+		return errors.Wrap(err, "get rxpk error")
+	}
+
+	g, err := b.getGateway(gatewayID)
+	if err != nil {
+		return err
+	}
+
+	g.addUplinkContext(rxpk.Tmst, frame.GetRxInfo().GetContext())
+
+	return g.send(packets.PushDataPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		RandomToken:     uint16(rand.Uint32()),
+		GatewayMAC:      gatewayID,
+		Payload: packets.PushDataPayload{
+			RXPK: []packets.RXPK{rxpk},
+		},
+	}, packets.PushData)
+}
+
+func (b *Backend) publishGatewayStats(gatewayID lorawan.EUI64, stats gw.GatewayStats) error {
+	stat, err := getStat(stats)
+	if err != nil {
+		return errors.Wrap(err, "get stat error")
+	}
+
+	g, err := b.getGateway(gatewayID)
+	if err != nil {
+		return err
+	}
+
+	return g.send(packets.PushDataPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		RandomToken:     uint16(rand.Uint32()),
+		GatewayMAC:      gatewayID,
+		Payload: packets.PushDataPayload{
+			Stat: &stat,
+		},
+	}, packets.PushData)
+}
+
+// publishDownlinkTXAck sends the TX_ACK for a downlink received from the
+// network server. Acks of downlinks received from other integrations are
+// ignored.
+func (b *Backend) publishDownlinkTXAck(gatewayID lorawan.EUI64, ack gw.DownlinkTXAck) error {
+	b.RLock()
+	g, ok := b.gateways[gatewayID]
+	b.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	var downID uuid.UUID
+	copy(downID[:], ack.GetDownlinkId())
+
+	g.Lock()
+	down, ok := g.downlinks[downID]
+	delete(g.downlinks, downID)
+	g.Unlock()
+	if !ok {
+		return nil
+	}
+
+	ackErr := ack.Error
+	if ackErr == "" {
+		ackErr = "NONE"
+	}
+
+	return g.send(packets.TXACKPacket{
+		ProtocolVersion: packets.ProtocolVersion2,
+		RandomToken:     down.token,
+		GatewayMAC:      gatewayID,
+		Payload: &packets.TXACKPayload{
+			TXPKACK: packets.TXPKACK{
+				Error: ackErr,
+			},
+		},
+	}, packets.TXACK)
+}
+
+// getGateway returns the gateway, the UDP connection is opened when it does
+// not yet exist.
+func (b *Backend) getGateway(gatewayID lorawan.EUI64) (*gateway, error) {
+	b.RLock()
+	g, ok := b.gateways[gatewayID]
+	b.RUnlock()
+	if ok {
+		return g, nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return nil, errors.New("integration/semtechudp: backend is closed")
+	}
+
+	if g, ok := b.gateways[gatewayID]; ok {
+		return g, nil
+	}
+
+	conn, err := net.DialUDP("udp", nil, b.server)
+	if err != nil {
+		return nil, errors.Wrap(err, "integration/semtechudp: dial udp error")
+	}
+
+	g = &gateway{
+		id:        gatewayID,
+		conn:      conn,
+		done:      make(chan struct{}),
+		downlinks: make(map[uuid.UUID]downlink),
+	}
+	b.gateways[gatewayID] = g
+
+	log.WithFields(log.Fields{
+		"gateway_id": gatewayID,
+		"local_addr": conn.LocalAddr(),
+	}).Info("integration/semtechudp: gateway connection opened")
+
+	go b.readLoop(g)
+	if b.commandsEnabled {
+		go b.keepaliveLoop(g)
+	}
+
+	return g, nil
+}
+
+func (b *Backend) closeGateway(gatewayID lorawan.EUI64) {
+	b.Lock()
+	defer b.Unlock()
+
+	g, ok := b.gateways[gatewayID]
+	if !ok {
+		return
+	}
+
+	g.close()
+	delete(b.gateways, gatewayID)
+
+	log.WithField("gateway_id", gatewayID).Info("integration/semtechudp: gateway connection closed")
+}
+
+// keepaliveLoop sends the PULL_DATA packets at the keepalive interval.
+func (b *Backend) keepaliveLoop(g *gateway) {
+	ticker := time.NewTicker(b.keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.send(packets.PullDataPacket{
+			ProtocolVersion: packets.ProtocolVersion2,
+			RandomToken:     uint16(rand.Uint32()),
+			GatewayMAC:      g.id,
+		}, packets.PullData); err != nil {
+			log.WithError(err).WithField("gateway_id", g.id).Error("integration/semtechudp: send pull data error")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// readLoop reads the packets sent by the network server, until the UDP
+// connection is closed.
+func (b *Backend) readLoop(g *gateway) {
+	buf := make([]byte, readBufferSize)
+
+	for {
+		i, err := g.conn.Read(buf)
+		if err != nil {
+			select {
+			case <-g.done:
+				return
+			default:
+			}
+
+			// A read error is returned when the network server is not
+			// (yet) listening (ICMP port unreachable).
+			log.WithError(err).WithField("gateway_id", g.id).Debug("integration/semtechudp: read udp packet error")
+			time.Sleep(time.Second)
+			continue
+		}
+
+		data := make([]byte, i)
+		copy(data, buf[:i])
+
+		if err := b.handlePacket(g, data); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"gateway_id":  g.id,
+				"data_base64": data,
+			}).Error("integration/semtechudp: could not handle packet")
+		}
+	}
+}
+
+func (b *Backend) handlePacket(g *gateway, data []byte) error {
+	pt, err := packets.GetPacketType(data)
+	if err != nil {
+		return err
+	}
+	udpReadCounter(pt.String()).Inc()
+
+	switch pt {
+	case packets.PushACK, packets.PullACK:
+		log.WithFields(log.Fields{
+			"gateway_id":  g.id,
+			"packet_type": pt,
+		}).Debug("integration/semtechudp: ack received")
+		return nil
+	case packets.PullResp:
+		return b.handlePullResp(g, data)
+	default:
+		return errors.Errorf("integration/semtechudp: unexpected packet type: %s", pt)
+	}
+}
+
+func (b *Backend) handlePullResp(g *gateway, data []byte) error {
+	var p packets.PullRespPacket
+	if err := p.UnmarshalBinary(data); err != nil {
+		return errors.Wrap(err, "unmarshal pull resp error")
+	}
+
+	if !b.commandsEnabled {
+		return nil
+	}
+
+	g.Lock()
+	frame, err := getDownlinkFrame(g.id, p.RandomToken, p.Payload.TXPK, g.uplinks)
+	if err == nil {
+		var downID uuid.UUID
+		copy(downID[:], frame.DownlinkId)
+		g.addDownlink(downID, p.RandomToken, time.Now())
+	}
+	g.Unlock()
+
+	if err != nil {
+		return errors.Wrap(err, "get downlink frame error")
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id":  g.id,
+		"token":       p.RandomToken,
+		"downlink_id": uuid.FromBytesOrNil(frame.DownlinkId),
+	}).Info("integration/semtechudp: downlink frame received")
+
+	b.downlinkFrameChan <- frame
+
+	return nil
+}
+
+// send sends the given packet to the network server.
+func (g *gateway) send(p encoding.BinaryMarshaler, pt packets.PacketType) error {
+	bb, err := p.MarshalBinary()
+	if err != nil {
+		return errors.Wrap(err, "marshal binary error")
+	}
+
+	udpWriteCounter(pt.String()).Inc()
+	if _, err := g.conn.Write(bb); err != nil {
+		return errors.Wrap(err, "write udp packet error")
+	}
+
+	return nil
+}
+
+// addUplinkContext stores the context of the given uplink.
+func (g *gateway) addUplinkContext(tmst uint32, ctx []byte) {
+	if len(ctx) == 0 {
+		return
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	g.uplinks = append(g.uplinks, uplinkContext{
+		tmst:    tmst,
+		context: ctx,
+	})
+
+	if len(g.uplinks) > maxUplinkContexts {
+		g.uplinks = g.uplinks[len(g.uplinks)-maxUplinkContexts:]
+	}
+}
+
+// addDownlink stores the PULL_RESP token of the given downlink and removes
+// the downlinks for which no ack has been received within the max. age. The
+// gateway must be locked.
+func (g *gateway) addDownlink(downID uuid.UUID, token uint16, now time.Time) {
+	for id, down := range g.downlinks {
+		if now.Sub(down.time) > maxDownlinkAge {
+			delete(g.downlinks, id)
+		}
+	}
+
+	g.downlinks[downID] = downlink{
+		token: token,
+		time:  now,
+	}
+}
+
+func (g *gateway) close() {
+	close(g.done)
+	g.conn.Close()
+}
@@ -0,0 +1,293 @@
+package semtechudp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/events"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp/packets"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestBackend(t *testing.T) {
+	assert := require.New(t)
+
+	// the (legacy) network server
+	nsAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	ns, err := net.ListenUDP("udp", nsAddr)
+	assert.NoError(err)
+	defer ns.Close()
+
+	var conf config.Config
+	conf.Integration.SemtechUDP.CommandsEnabled = true
+	conf.Integration.SemtechUDP.Server = ns.LocalAddr().String()
+	conf.Integration.SemtechUDP.KeepaliveInterval = time.Minute
+
+	b, err := NewBackend(conf)
+	assert.NoError(err)
+	defer b.Close()
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	read := func() ([]byte, *net.UDPAddr) {
+		buf := make([]byte, 65507)
+		assert.NoError(ns.SetReadDeadline(time.Now().Add(time.Second)))
+		i, addr, err := ns.ReadFromUDP(buf)
+		assert.NoError(err)
+		return buf[:i], addr
+	}
+
+	assert.NoError(b.SetGatewaySubscription(true, gatewayID))
+
+	var gwAddr *net.UDPAddr
+	t.Run("pull data", func(t *testing.T) {
+		assert := require.New(t)
+
+		var data []byte
+		data, gwAddr = read()
+
+		var pullData packets.PullDataPacket
+		assert.NoError(pullData.UnmarshalBinary(data))
+		assert.Equal([8]byte(gatewayID), pullData.GatewayMAC)
+	})
+
+	t.Run("uplink frame", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx := make([]byte, 4)
+		binary.BigEndian.PutUint32(ctx, 1000000)
+
+		assert.NoError(b.PublishEvent(gatewayID, "up", uuid.Nil, &gw.UplinkFrame{
+			PhyPayload: []byte{1, 2, 3},
+			TxInfo: &gw.UplinkTXInfo{
+				Frequency:  868100000,
+				Modulation: common.Modulation_LORA,
+				ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+					LoraModulationInfo: &gw.LoRaModulationInfo{
+						Bandwidth:       125,
+						SpreadingFactor: 7,
+						CodeRate:        "4/5",
+					},
+				},
+			},
+			RxInfo: &gw.UplinkRXInfo{
+				GatewayId: gatewayID[:],
+				Rssi:      -60,
+				LoraSnr:   5.5,
+				Channel:   1,
+				CrcStatus: gw.CRCStatus_CRC_OK,
+				Context:   ctx,
+			},
+		}))
+
+		data, _ := read()
+
+		var pushData packets.PushDataPacket
+		assert.NoError(pushData.UnmarshalBinary(data))
+		assert.Equal(gatewayID, pushData.GatewayMAC)
+		assert.Equal([]packets.RXPK{
+			{
+				Tmst: 1000000,
+				Chan: 1,
+				Stat: 1,
+				Freq: 868.1,
+				RSSI: -60,
+				Size: 3,
+				DatR: packets.DatR{LoRa: "SF7BW125"},
+				Modu: "LORA",
+				CodR: "4/5",
+				LSNR: 5.5,
+				Data: []byte{1, 2, 3},
+			},
+		}, pushData.Payload.RXPK)
+	})
+
+	t.Run("gateway stats", func(t *testing.T) {
+		assert := require.New(t)
+
+		now := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+		ts, err := ptypes.TimestampProto(now)
+		assert.NoError(err)
+
+		assert.NoError(b.PublishEvent(gatewayID, "stats", uuid.Nil, &gw.GatewayStats{
+			GatewayId:           gatewayID[:],
+			Time:                ts,
+			RxPacketsReceived:   10,
+			RxPacketsReceivedOk: 5,
+			TxPacketsReceived:   3,
+			TxPacketsEmitted:    2,
+		}))
+
+		data, _ := read()
+
+		var pushData packets.PushDataPacket
+		assert.NoError(pushData.UnmarshalBinary(data))
+		assert.Equal(&packets.Stat{
+			Time: packets.ExpandedTime(now),
+			RXNb: 10,
+			RXOK: 5,
+			RXFW: 5,
+			DWNb: 3,
+			TXNb: 2,
+		}, pushData.Payload.Stat)
+	})
+
+	var downlinkFrame gw.DownlinkFrame
+	t.Run("pull resp", func(t *testing.T) {
+		assert := require.New(t)
+
+		tmst := uint32(2000000)
+		pullResp := packets.PullRespPacket{
+			ProtocolVersion: packets.ProtocolVersion2,
+			RandomToken:     123,
+			Payload: packets.PullRespPayload{
+				TXPK: packets.TXPK{
+					Tmst: &tmst,
+					Freq: 868.1,
+					Powe: 14,
+					Modu: "LORA",
+					DatR: packets.DatR{LoRa: "SF7BW125"},
+					CodR: "4/5",
+					IPol: true,
+					Size: 3,
+					Data: []byte{3, 2, 1},
+				},
+			},
+		}
+		bb, err := pullResp.MarshalBinary()
+		assert.NoError(err)
+		_, err = ns.WriteToUDP(bb, gwAddr)
+		assert.NoError(err)
+
+		select {
+		case downlinkFrame = <-b.GetDownlinkFrameChan():
+		case <-time.After(time.Second):
+			assert.FailNow("downlink not received")
+		}
+
+		// the context of the uplink is used, with the delay between the
+		// uplink and downlink timestamp
+		ctx := make([]byte, 4)
+		binary.BigEndian.PutUint32(ctx, 1000000)
+
+		assert.Equal(uint32(123), downlinkFrame.Token)
+		assert.Equal([]byte{3, 2, 1}, downlinkFrame.PhyPayload)
+		assert.Equal(&gw.DownlinkTXInfo{
+			GatewayId:  gatewayID[:],
+			Frequency:  868100000,
+			Power:      14,
+			Modulation: common.Modulation_LORA,
+			ModulationInfo: &gw.DownlinkTXInfo_LoraModulationInfo{
+				LoraModulationInfo: &gw.LoRaModulationInfo{
+					Bandwidth:             125,
+					SpreadingFactor:       7,
+					CodeRate:              "4/5",
+					PolarizationInversion: true,
+				},
+			},
+			Timing: gw.DownlinkTiming_DELAY,
+			TimingInfo: &gw.DownlinkTXInfo_DelayTimingInfo{
+				DelayTimingInfo: &gw.DelayTimingInfo{
+					Delay: ptypes.DurationProto(time.Second),
+				},
+			},
+			Context: ctx,
+		}, downlinkFrame.TxInfo)
+	})
+
+	t.Run("tx ack", func(t *testing.T) {
+		assert := require.New(t)
+
+		// acks of downlinks of other integrations are ignored
+		assert.NoError(b.PublishEvent(gatewayID, "ack", uuid.Nil, &gw.DownlinkTXAck{
+			GatewayId:  gatewayID[:],
+			DownlinkId: uuid.Must(uuid.NewV4()).Bytes(),
+		}))
+
+		assert.NoError(b.PublishEvent(gatewayID, "ack", uuid.Nil, &gw.DownlinkTXAck{
+			GatewayId:  gatewayID[:],
+			Token:      downlinkFrame.Token,
+			DownlinkId: downlinkFrame.DownlinkId,
+			Error:      "TOO_LATE",
+		}))
+
+		data, _ := read()
+
+		var txAck packets.TXACKPacket
+		assert.NoError(txAck.UnmarshalBinary(data))
+		assert.Equal(uint16(123), txAck.RandomToken)
+		assert.Equal(&packets.TXACKPayload{
+			TXPKACK: packets.TXPKACK{
+				Error: "TOO_LATE",
+			},
+		}, txAck.Payload)
+	})
+
+	t.Run("gateway offline", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(b.PublishEvent(gatewayID, "conn", uuid.Nil, &events.ConnState{
+			GatewayId: gatewayID[:],
+			State:     events.ConnStateOffline,
+		}))
+
+		b.RLock()
+		_, ok := b.gateways[gatewayID]
+		b.RUnlock()
+		assert.False(ok)
+	})
+}
+
+func TestGetUplinkContext(t *testing.T) {
+	uplinks := []uplinkContext{
+		{tmst: 4294000000, context: []byte{1}},
+		{tmst: 1000000, context: []byte{2}},
+		{tmst: 5000000, context: []byte{3}},
+	}
+
+	tests := []struct {
+		Name     string
+		Tmst     uint32
+		Expected []byte
+	}{
+		{
+			Name:     "most recent uplink",
+			Tmst:     6000000,
+			Expected: []byte{3},
+		},
+		{
+			Name:     "preceding uplink",
+			Tmst:     2000000,
+			Expected: []byte{2},
+		},
+		{
+			Name:     "counter wrap-around",
+			Tmst:     100000,
+			Expected: []byte{1},
+		},
+		{
+			Name: "exceeds max delay",
+			Tmst: 30000000,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			up, ok := getUplinkContext(uplinks, tst.Tmst)
+			assert.Equal(tst.Expected != nil, ok)
+			assert.Equal(tst.Expected, up.context)
+		})
+	}
+}
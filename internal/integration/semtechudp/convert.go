@@ -0,0 +1,254 @@
+package semtechudp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/backend/semtechudp/packets"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
+	"github.com/brocaar/lorawan"
+)
+
+// loRaDataRateRegex contains a regexp for parsing the data-rate string.
+var loRaDataRateRegex = regexp.MustCompile(`SF(\d+)BW(\d+)`)
+
+// contextTimestamp returns the concentrator timestamp (tmst) of the given
+// uplink context. The Semtech UDP and Concentratord backends use the 32bit
+// timestamp as context, the Basic Station backend uses the rctx and xtime,
+// of which the lower 32 bits of the xtime contain the timestamp.
+func contextTimestamp(ctx []byte) (uint32, bool) {
+	switch len(ctx) {
+	case 4:
+		return binary.BigEndian.Uint32(ctx), true
+	case 16:
+		return binary.BigEndian.Uint32(ctx[12:16]), true
+	default:
+		return 0, false
+	}
+}
+
+// getRXPK returns the rxpk for the given uplink frame.
+func getRXPK(frame gw.UplinkFrame) (packets.RXPK, error) {
+	txInfo := frame.GetTxInfo()
+	rxInfo := frame.GetRxInfo()
+
+	rxpk := packets.RXPK{
+		Freq: float64(txInfo.GetFrequency()) / 1000000,
+		Chan: uint8(rxInfo.GetChannel()),
+		RFCh: uint8(rxInfo.GetRfChain()),
+		Brd:  rxInfo.GetBoard(),
+		RSSI: int16(rxInfo.GetRssi()),
+		LSNR: rxInfo.GetLoraSnr(),
+		Size: uint16(len(frame.PhyPayload)),
+		Data: frame.PhyPayload,
+	}
+
+	rxpk.Tmst, _ = contextTimestamp(rxInfo.GetContext())
+
+	switch rxInfo.GetCrcStatus() {
+	case gw.CRCStatus_CRC_OK:
+		rxpk.Stat = 1
+	case gw.CRCStatus_BAD_CRC:
+		rxpk.Stat = -1
+	}
+
+	if rxInfo.GetTime() != nil {
+		ts, err := ptypes.Timestamp(rxInfo.GetTime())
+		if err != nil {
+			return rxpk, errors.Wrap(err, "timestamp error")
+		}
+		ct := packets.CompactTime(ts)
+		rxpk.Time = &ct
+	}
+
+	if rxInfo.GetTimeSinceGpsEpoch() != nil {
+		d, err := ptypes.Duration(rxInfo.GetTimeSinceGpsEpoch())
+		if err != nil {
+			return rxpk, errors.Wrap(err, "time since gps epoch error")
+		}
+		tmms := int64(d / time.Millisecond)
+		rxpk.Tmms = &tmms
+	}
+
+	switch txInfo.GetModulation() {
+	case common.Modulation_LORA:
+		modInfo := txInfo.GetLoraModulationInfo()
+		if modInfo == nil {
+			return rxpk, errors.New("lora_modulation_info must not be nil")
+		}
+		rxpk.Modu = "LORA"
+		rxpk.DatR.LoRa = fmt.Sprintf("SF%dBW%d", modInfo.SpreadingFactor, modInfo.Bandwidth)
+		rxpk.CodR = modInfo.CodeRate
+	case common.Modulation_FSK:
+		modInfo := txInfo.GetFskModulationInfo()
+		if modInfo == nil {
+			return rxpk, errors.New("fsk_modulation_info must not be nil")
+		}
+		rxpk.Modu = "FSK"
+		rxpk.DatR.FSK = modInfo.Datarate
+	case lrfhss.Modulation:
+		modInfo := lrfhss.GetUplinkModulationInfo(txInfo)
+		if modInfo == nil {
+			return rxpk, errors.New("lr_fhss_modulation_info must not be nil")
+		}
+		rxpk.Modu = "LR-FHSS"
+		rxpk.DatR.LRFHSS = fmt.Sprintf("M0CW%d", modInfo.OperatingChannelWidth/1000)
+		rxpk.CodR = modInfo.CodeRate
+		rxpk.HPW = uint8(modInfo.GridSteps)
+	default:
+		return rxpk, fmt.Errorf("unexpected modulation: %s", txInfo.GetModulation())
+	}
+
+	return rxpk, nil
+}
+
+// getStat returns the stat for the given gateway stats.
+func getStat(stats gw.GatewayStats) (packets.Stat, error) {
+	stat := packets.Stat{
+		RXNb: stats.RxPacketsReceived,
+		RXOK: stats.RxPacketsReceivedOk,
+		RXFW: stats.RxPacketsReceivedOk,
+		DWNb: stats.TxPacketsReceived,
+		TXNb: stats.TxPacketsEmitted,
+	}
+
+	ts := time.Now()
+	if stats.GetTime() != nil {
+		var err error
+		ts, err = ptypes.Timestamp(stats.GetTime())
+		if err != nil {
+			return stat, errors.Wrap(err, "timestamp error")
+		}
+	}
+	stat.Time = packets.ExpandedTime(ts)
+
+	if loc := stats.GetLocation(); loc != nil {
+		stat.Lati = loc.Latitude
+		stat.Long = loc.Longitude
+		stat.Alti = int32(loc.Altitude)
+	}
+
+	return stat, nil
+}
+
+// getDownlinkFrame returns the downlink frame for the given txpk. As the
+// downlink is scheduled by the (legacy) network server using the
+// concentrator timestamp, the context of the uplink of which the timestamp
+// precedes the downlink timestamp is used, such that the downlink can be
+// emitted by all backends. When there is no such uplink, the downlink
+// timestamp is used as context.
+func getDownlinkFrame(gatewayID lorawan.EUI64, token uint16, txpk packets.TXPK, uplinks []uplinkContext) (gw.DownlinkFrame, error) {
+	downID, err := uuid.NewV4()
+	if err != nil {
+		return gw.DownlinkFrame{}, errors.Wrap(err, "new uuid error")
+	}
+
+	if txpk.Freq < 0 || txpk.Freq*1000000 > math.MaxUint32 {
+		return gw.DownlinkFrame{}, fmt.Errorf("invalid frequency: %f", txpk.Freq)
+	}
+
+	frame := gw.DownlinkFrame{
+		PhyPayload: txpk.Data,
+		Token:      uint32(token),
+		DownlinkId: downID[:],
+		TxInfo: &gw.DownlinkTXInfo{
+			GatewayId: gatewayID[:],
+			Frequency: uint32(math.Round(txpk.Freq * 1000000)),
+			Power:     int32(txpk.Powe),
+			Board:     txpk.Brd,
+			Antenna:   uint32(txpk.Ant),
+		},
+	}
+
+	switch txpk.Modu {
+	case "LORA":
+		match := loRaDataRateRegex.FindStringSubmatch(txpk.DatR.LoRa)
+		if len(match) != 3 {
+			return frame, fmt.Errorf("invalid lora data-rate: %s", txpk.DatR.LoRa)
+		}
+		sf, _ := strconv.Atoi(match[1])
+		bw, _ := strconv.Atoi(match[2])
+
+		frame.TxInfo.Modulation = common.Modulation_LORA
+		frame.TxInfo.ModulationInfo = &gw.DownlinkTXInfo_LoraModulationInfo{
+			LoraModulationInfo: &gw.LoRaModulationInfo{
+				SpreadingFactor:       uint32(sf),
+				Bandwidth:             uint32(bw),
+				CodeRate:              txpk.CodR,
+				PolarizationInversion: txpk.IPol,
+			},
+		}
+	case "FSK":
+		frame.TxInfo.Modulation = common.Modulation_FSK
+		frame.TxInfo.ModulationInfo = &gw.DownlinkTXInfo_FskModulationInfo{
+			FskModulationInfo: &gw.FSKModulationInfo{
+				Datarate:           txpk.DatR.FSK,
+				FrequencyDeviation: uint32(txpk.FDev),
+			},
+		}
+	default:
+		return frame, fmt.Errorf("unexpected modulation: %s", txpk.Modu)
+	}
+
+	switch {
+	case txpk.Imme:
+		frame.TxInfo.Timing = gw.DownlinkTiming_IMMEDIATELY
+		frame.TxInfo.TimingInfo = &gw.DownlinkTXInfo_ImmediatelyTimingInfo{
+			ImmediatelyTimingInfo: &gw.ImmediatelyTimingInfo{},
+		}
+	case txpk.Tmst != nil:
+		ctx := make([]byte, 4)
+		binary.BigEndian.PutUint32(ctx, *txpk.Tmst)
+		var delay time.Duration
+
+		if up, ok := getUplinkContext(uplinks, *txpk.Tmst); ok {
+			ctx = up.context
+			delay = time.Duration(*txpk.Tmst-up.tmst) * time.Microsecond
+		}
+
+		frame.TxInfo.Context = ctx
+		frame.TxInfo.Timing = gw.DownlinkTiming_DELAY
+		frame.TxInfo.TimingInfo = &gw.DownlinkTXInfo_DelayTimingInfo{
+			DelayTimingInfo: &gw.DelayTimingInfo{
+				Delay: ptypes.DurationProto(delay),
+			},
+		}
+	case txpk.Tmms != nil:
+		frame.TxInfo.Timing = gw.DownlinkTiming_GPS_EPOCH
+		frame.TxInfo.TimingInfo = &gw.DownlinkTXInfo_GpsEpochTimingInfo{
+			GpsEpochTimingInfo: &gw.GPSEpochTimingInfo{
+				TimeSinceGpsEpoch: ptypes.DurationProto(time.Duration(*txpk.Tmms) * time.Millisecond),
+			},
+		}
+	default:
+		return frame, errors.New("txpk must contain imme, tmst or tmms")
+	}
+
+	return frame, nil
+}
+
+// getUplinkContext returns the most recent uplink of which the timestamp
+// precedes the given timestamp, within the max. uplink to downlink delay.
+// The timestamps are compared using uint32 arithmetic, as the concentrator
+// counter wraps around.
+func getUplinkContext(uplinks []uplinkContext, tmst uint32) (uplinkContext, bool) {
+	maxDelay := uint32(maxUplinkDelay / time.Microsecond)
+
+	for i := len(uplinks) - 1; i >= 0; i-- {
+		if tmst-uplinks[i].tmst <= maxDelay {
+			return uplinks[i], true
+		}
+	}
+
+	return uplinkContext{}, false
+}
@@ -0,0 +1,35 @@
+package semtechudp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_semtech_udp_event_count",
+		Help: "The number of gateway events published by the Semtech UDP integration (per event).",
+	}, []string{"event"})
+
+	uc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_semtech_udp_sent_count",
+		Help: "The number of UDP packets sent by the Semtech UDP integration (per packet_type).",
+	}, []string{"packet_type"})
+
+	ur = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_semtech_udp_received_count",
+		Help: "The number of UDP packets received by the Semtech UDP integration (per packet_type).",
+	}, []string{"packet_type"})
+)
+
+func eventCounter(e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"event": e})
+}
+
+func udpWriteCounter(pt string) prometheus.Counter {
+	return uc.With(prometheus.Labels{"packet_type": pt})
+}
+
+func udpReadCounter(pt string) prometheus.Counter {
+	return ur.With(prometheus.Labels{"packet_type": pt})
+}
@@ -0,0 +1,115 @@
+package integration
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+// hotStandby implements an Integration which only publishes the events and
+// forwards the commands while this instance is the active instance of the
+// hot-standby mode (see the standby package). The gateway subscriptions are
+// always set, such that the instance can take over directly.
+type hotStandby struct {
+	Integration
+
+	isActive func() bool
+
+	downlinkFrameChan             chan gw.DownlinkFrame
+	gatewayConfigurationChan      chan gw.GatewayConfiguration
+	gatewayCommandExecRequestChan chan gw.GatewayCommandExecRequest
+	rawPacketForwarderCommandChan chan gw.RawPacketForwarderCommand
+}
+
+func newHotStandby(i Integration, isActive func() bool) *hotStandby {
+	s := hotStandby{
+		Integration:                   i,
+		isActive:                      isActive,
+		downlinkFrameChan:             make(chan gw.DownlinkFrame),
+		gatewayConfigurationChan:      make(chan gw.GatewayConfiguration),
+		gatewayCommandExecRequestChan: make(chan gw.GatewayCommandExecRequest),
+		rawPacketForwarderCommandChan: make(chan gw.RawPacketForwarderCommand),
+	}
+
+	go func() {
+		for downlinkFrame := range i.GetDownlinkFrameChan() {
+			if s.forward("down") {
+				s.downlinkFrameChan <- downlinkFrame
+			}
+		}
+	}()
+
+	go func() {
+		for gatewayConfig := range i.GetGatewayConfigurationChan() {
+			if s.forward("config") {
+				s.gatewayConfigurationChan <- gatewayConfig
+			}
+		}
+	}()
+
+	go func() {
+		for execReq := range i.GetGatewayCommandExecRequestChan() {
+			if s.forward("exec") {
+				s.gatewayCommandExecRequestChan <- execReq
+			}
+		}
+	}()
+
+	go func() {
+		for raw := range i.GetRawPacketForwarderChan() {
+			if s.forward("raw") {
+				s.rawPacketForwarderCommandChan <- raw
+			}
+		}
+	}()
+
+	return &s
+}
+
+// PublishEvent publishes the given event when this instance is active.
+func (s *hotStandby) PublishEvent(gatewayID lorawan.EUI64, event string, id uuid.UUID, v proto.Message) error {
+	if !s.isActive() {
+		standbyDropCounter(event).Inc()
+		log.WithFields(log.Fields{
+			"gateway_id": gatewayID,
+			"event_type": event,
+		}).Debug("integration: instance is standby, dropping event")
+		return nil
+	}
+
+	return s.Integration.PublishEvent(gatewayID, event, id, v)
+}
+
+// GetDownlinkFrameChan returns the channel for downlink frames.
+func (s *hotStandby) GetDownlinkFrameChan() chan gw.DownlinkFrame {
+	return s.downlinkFrameChan
+}
+
+// GetRawPacketForwarderChan returns the channel for raw packet-forwarder commands.
+func (s *hotStandby) GetRawPacketForwarderChan() chan gw.RawPacketForwarderCommand {
+	return s.rawPacketForwarderCommandChan
+}
+
+// GetGatewayConfigurationChan returns the channel for gateway configuration.
+func (s *hotStandby) GetGatewayConfigurationChan() chan gw.GatewayConfiguration {
+	return s.gatewayConfigurationChan
+}
+
+// GetGatewayCommandExecRequestChan() returns the channel for gateway command execution.
+func (s *hotStandby) GetGatewayCommandExecRequestChan() chan gw.GatewayCommandExecRequest {
+	return s.gatewayCommandExecRequestChan
+}
+
+// forward returns true when the given command must be forwarded.
+func (s *hotStandby) forward(command string) bool {
+	if s.isActive() {
+		return true
+	}
+
+	standbyDropCounter(command).Inc()
+	log.WithField("command", command).Debug("integration: instance is standby, dropping command")
+	return false
+}
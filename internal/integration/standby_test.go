@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestHotStandby(t *testing.T) {
+	assert := require.New(t)
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	i := newTestIntegration(nil)
+
+	var active int32
+	s := newHotStandby(i, func() bool {
+		return atomic.LoadInt32(&active) == 1
+	})
+
+	t.Run("Standby", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(s.PublishEvent(gatewayID, "up", uuid.Nil, &gw.UplinkFrame{}))
+		assert.Len(i.published, 0)
+
+		i.downlinkFrameChan <- gw.DownlinkFrame{Token: 1}
+		select {
+		case <-s.GetDownlinkFrameChan():
+			assert.Fail("unexpected downlink frame")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		// the subscriptions are set, such that the instance can take over
+		assert.NoError(s.SetGatewaySubscription(true, gatewayID))
+		assert.True(i.subscriptions[gatewayID])
+	})
+
+	t.Run("Active", func(t *testing.T) {
+		assert := require.New(t)
+
+		atomic.StoreInt32(&active, 1)
+
+		assert.NoError(s.PublishEvent(gatewayID, "up", uuid.Nil, &gw.UplinkFrame{}))
+		assert.Equal([]publishedEvent{{GatewayID: gatewayID, Event: "up"}}, i.published)
+
+		i.downlinkFrameChan <- gw.DownlinkFrame{Token: 2}
+		assert.Equal(uint32(2), (<-s.GetDownlinkFrameChan()).Token)
+	})
+
+	assert.NoError(s.Close())
+	assert.True(i.closed)
+}
@@ -0,0 +1,81 @@
+// Package ism2400 defines the frequency range, bandwidths and data-rates of
+// the LoRa 2.4 GHz (SX1280) ISM band, which are not defined by the LoRaWAN
+// Regional Parameters (and thus not by the lorawan/band package).
+//
+// The LoRa 2.4 GHz bandwidths are not a whole number of kHz. As the v3 gw API
+// defines the LoRa bandwidth in kHz, these bandwidths are truncated to kHz
+// (e.g. 812.5 kHz is represented as 812 kHz). Use BandwidthHz to convert
+// these back to the exact bandwidth in Hz.
+package ism2400
+
+import (
+	"errors"
+
+	"github.com/brocaar/lorawan/band"
+)
+
+// Name defines the region name of the LoRa 2.4 GHz ISM band.
+const Name = "ISM2400"
+
+// Frequency range (Hz) of the 2.4 GHz ISM band.
+const (
+	MinFrequency = 2400000000
+	MaxFrequency = 2483500000
+)
+
+// MaxEIRP defines the max. TX power (dBm EIRP) in the 2.4 GHz ISM band.
+const MaxEIRP = 10
+
+// bandwidths maps the (truncated) LoRa 2.4 GHz bandwidths in kHz to the exact
+// bandwidth in Hz.
+var bandwidths = map[uint32]uint32{
+	203:  203125,
+	406:  406250,
+	812:  812500,
+	1625: 1625000,
+}
+
+// dataRates contains the LoRa 2.4 GHz data-rates (the index is the
+// data-rate).
+var dataRates = []band.DataRate{
+	{Modulation: band.LoRaModulation, SpreadFactor: 12, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 11, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 10, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 9, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 8, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 7, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 6, Bandwidth: 812},
+	{Modulation: band.LoRaModulation, SpreadFactor: 5, Bandwidth: 812},
+}
+
+// IsBandwidth returns true when the given bandwidth (kHz) is a LoRa 2.4 GHz
+// bandwidth.
+func IsBandwidth(bw uint32) bool {
+	_, ok := bandwidths[bw]
+	return ok
+}
+
+// BandwidthHz converts the given LoRa bandwidth in kHz to Hz, taking the
+// truncated LoRa 2.4 GHz bandwidths into account.
+func BandwidthHz(bw uint32) uint32 {
+	if hz, ok := bandwidths[bw]; ok {
+		return hz
+	}
+	return bw * 1000
+}
+
+// BandwidthKHz converts the given LoRa bandwidth in Hz to kHz. The LoRa
+// 2.4 GHz bandwidths are truncated.
+func BandwidthKHz(bw uint32) uint32 {
+	return bw / 1000
+}
+
+// GetDataRateIndex returns the data-rate index for the given data-rate.
+func GetDataRateIndex(dr band.DataRate) (int, error) {
+	for i, d := range dataRates {
+		if d.Modulation == dr.Modulation && d.SpreadFactor == dr.SpreadFactor && d.Bandwidth == dr.Bandwidth {
+			return i, nil
+		}
+	}
+	return 0, errors.New("data-rate not found")
+}
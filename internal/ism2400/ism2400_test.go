@@ -0,0 +1,38 @@
+package ism2400
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan/band"
+)
+
+func TestBandwidth(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(IsBandwidth(812))
+	assert.False(IsBandwidth(125))
+
+	assert.EqualValues(203125, BandwidthHz(203))
+	assert.EqualValues(812500, BandwidthHz(812))
+	assert.EqualValues(125000, BandwidthHz(125))
+
+	assert.EqualValues(812, BandwidthKHz(812500))
+	assert.EqualValues(1625, BandwidthKHz(1625000))
+}
+
+func TestGetDataRateIndex(t *testing.T) {
+	assert := require.New(t)
+
+	dr, err := GetDataRateIndex(band.DataRate{Modulation: band.LoRaModulation, SpreadFactor: 12, Bandwidth: 812})
+	assert.NoError(err)
+	assert.Equal(0, dr)
+
+	dr, err = GetDataRateIndex(band.DataRate{Modulation: band.LoRaModulation, SpreadFactor: 5, Bandwidth: 812})
+	assert.NoError(err)
+	assert.Equal(7, dr)
+
+	_, err = GetDataRateIndex(band.DataRate{Modulation: band.LoRaModulation, SpreadFactor: 12, Bandwidth: 125})
+	assert.Error(err)
+}
@@ -0,0 +1,129 @@
+//go:build !windows
+// +build !windows
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// journaldSocket is the socket of the journald native protocol.
+// See: https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+const journaldSocket = "/run/systemd/journal/socket"
+
+type journaldHook struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+func newJournaldHook() (log.Hook, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, errors.Wrap(err, "open socket error")
+	}
+
+	addr := &net.UnixAddr{Name: journaldSocket, Net: "unixgram"}
+
+	// Validate that journald is listening on the socket, as otherwise all
+	// entries would be lost.
+	if _, err := conn.WriteToUnix(journaldMessage(&log.Entry{Level: log.InfoLevel, Message: "journald logging enabled"}), addr); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "write to journald socket error")
+	}
+
+	return &journaldHook{
+		conn: conn,
+		addr: addr,
+	}, nil
+}
+
+func (h *journaldHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *journaldHook) Fire(entry *log.Entry) error {
+	_, err := h.conn.WriteToUnix(journaldMessage(entry), h.addr)
+	return err
+}
+
+// journaldMessage returns the entry encoded using the journald native
+// protocol. The fields of the entry are added as (upper-case) journal fields.
+func journaldMessage(entry *log.Entry) []byte {
+	var b bytes.Buffer
+
+	writeJournaldField(&b, "MESSAGE", entry.Message)
+	writeJournaldField(&b, "PRIORITY", fmt.Sprintf("%d", journaldPriority(entry.Level)))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", identifier)
+
+	var keys []string
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		writeJournaldField(&b, journaldFieldName(k), fmt.Sprintf("%v", entry.Data[k]))
+	}
+
+	return b.Bytes()
+}
+
+func writeJournaldField(b *bytes.Buffer, name, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+
+	// Values containing a newline are length-prefixed.
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journaldFieldName returns the journal field name for the given key. Field
+// names may only contain upper-case letters, digits and underscores and must
+// not start with an underscore (these are reserved) or a digit.
+func journaldFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "FIELD_" + name
+	}
+
+	return name
+}
+
+func journaldPriority(level log.Level) int {
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return 2
+	case log.ErrorLevel:
+		return 3
+	case log.WarnLevel:
+		return 4
+	case log.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
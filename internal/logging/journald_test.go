@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package logging
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournaldMessage(t *testing.T) {
+	assert := require.New(t)
+
+	b := journaldMessage(&log.Entry{
+		Level:   log.ErrorLevel,
+		Message: "backend/semtechudp: handle packet error",
+		Data: log.Fields{
+			"gateway_id": "0102030405060708",
+			"_private":   "value",
+			"error":      "line 1\nline 2",
+		},
+	})
+
+	assert.Equal("MESSAGE=backend/semtechudp: handle packet error\n"+
+		"PRIORITY=3\n"+
+		"SYSLOG_IDENTIFIER=chirpstack-gateway-bridge\n"+
+		"PRIVATE=value\n"+
+		"ERROR\n\x0d\x00\x00\x00\x00\x00\x00\x00line 1\nline 2\n"+
+		"GATEWAY_ID=0102030405060708\n", string(b))
+}
@@ -0,0 +1,10 @@
+package logging
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func newJournaldHook() (log.Hook, error) {
+	return nil, errors.New("journald logging is not supported on Windows")
+}
@@ -0,0 +1,186 @@
+// Package logging implements the configuration of the log output: the log
+// format, the syslog and journald sinks and the per-module log levels.
+package logging
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+const identifier = "chirpstack-gateway-bridge"
+
+var (
+	mux       sync.RWMutex
+	levels    map[string]log.Level
+	gatewayID *lorawan.EUI64
+
+	// extraHooks contains the hooks added by other packages (see AddHook).
+	extraHooks []log.Hook
+)
+
+// Setup configures the standard logger. It can be called multiple times, e.g.
+// on a configuration reload, in which case the previously added hooks are
+// replaced.
+func Setup(conf config.Config) error {
+	defaultLevel := log.Level(uint8(conf.General.LogLevel))
+
+	moduleLevels := map[string]log.Level{
+		"": defaultLevel,
+	}
+	for module, level := range conf.General.LogLevels {
+		moduleLevels[strings.ToLower(module)] = log.Level(uint8(level))
+	}
+
+	// The level of the logger is set to the most verbose level, the entries
+	// are filtered per module by the formatter and hooks.
+	var maxLevel log.Level
+	for _, level := range moduleLevels {
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	var formatter log.Formatter
+	switch conf.General.LogFormat {
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		formatter = &log.TextFormatter{}
+	}
+
+	hooks := make(log.LevelHooks)
+	hooks.Add(gatewayIDHook{})
+
+	if conf.General.LogToSyslog {
+		hook, err := newSyslogHook(defaultLevel)
+		if err != nil {
+			return errors.Wrap(err, "new syslog hook error")
+		}
+		hooks.Add(filterHook{hook})
+	}
+
+	if conf.General.LogToJournald {
+		hook, err := newJournaldHook()
+		if err != nil {
+			return errors.Wrap(err, "new journald hook error")
+		}
+		hooks.Add(filterHook{hook})
+	}
+
+	mux.Lock()
+	levels = moduleLevels
+	for _, hook := range extraHooks {
+		hooks.Add(filterHook{hook})
+	}
+	mux.Unlock()
+
+	log.SetFormatter(filterFormatter{formatter})
+	log.SetLevel(maxLevel)
+	log.StandardLogger().ReplaceHooks(hooks)
+
+	return nil
+}
+
+// AddHook adds the given hook to the standard logger. Unlike hooks added
+// directly to the standard logger, the hook is retained when Setup is called
+// again (e.g. on a configuration reload). The entries which are not enabled
+// for the module are not passed to the hook.
+func AddHook(hook log.Hook) {
+	mux.Lock()
+	extraHooks = append(extraHooks, hook)
+	mux.Unlock()
+
+	log.AddHook(filterHook{hook})
+}
+
+// SetGatewayID sets the gateway ID which is added to log entries which do not
+// contain a gateway_id field. This is used by backends which are connected to
+// a single gateway (e.g. the Concentratord backend).
+func SetGatewayID(id lorawan.EUI64) {
+	mux.Lock()
+	defer mux.Unlock()
+	gatewayID = &id
+}
+
+// module returns the module of the log entry, based on the message prefix.
+// E.g. the module of "backend/concentratord: uplink event received" is
+// "backend".
+func module(msg string) string {
+	i := strings.IndexAny(msg, "/:")
+	if i == -1 {
+		return ""
+	}
+	return msg[:i]
+}
+
+// enabled returns true when the entry must be logged, based on the log level
+// of the module of the entry.
+func enabled(entry *log.Entry) bool {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	level, ok := levels[module(entry.Message)]
+	if !ok {
+		level, ok = levels[""]
+	}
+	if !ok {
+		return true
+	}
+
+	return entry.Level <= level
+}
+
+// filterFormatter wraps a formatter and discards the entries which are not
+// enabled for the module.
+type filterFormatter struct {
+	log.Formatter
+}
+
+func (f filterFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if !enabled(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// filterHook wraps a hook and discards the entries which are not enabled for
+// the module.
+type filterHook struct {
+	log.Hook
+}
+
+func (h filterHook) Fire(entry *log.Entry) error {
+	if !enabled(entry) {
+		return nil
+	}
+	return h.Hook.Fire(entry)
+}
+
+// gatewayIDHook adds the gateway_id field (see SetGatewayID) to entries which
+// do not contain this field.
+type gatewayIDHook struct{}
+
+func (h gatewayIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h gatewayIDHook) Fire(entry *log.Entry) error {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	if gatewayID == nil {
+		return nil
+	}
+
+	if _, ok := entry.Data["gateway_id"]; !ok {
+		entry.Data["gateway_id"] = *gatewayID
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestSetup(t *testing.T) {
+	assert := require.New(t)
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormatter(&log.TextFormatter{})
+		gatewayID = nil
+	}()
+
+	var conf config.Config
+	conf.General.LogLevel = int(log.InfoLevel)
+	conf.General.LogFormat = "json"
+	conf.General.LogLevels = map[string]int{
+		"backend":     int(log.DebugLevel),
+		"integration": int(log.ErrorLevel),
+	}
+	assert.NoError(Setup(conf))
+	assert.Equal(log.DebugLevel, log.GetLevel())
+
+	SetGatewayID(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8})
+
+	log.Debug("backend/concentratord: debug message")
+	log.Info("integration/mqtt: info message")
+	log.Debug("metadata: debug message")
+	log.WithField("gateway_id", "0807060504030201").Info("forwarder: info message")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(lines, 2)
+
+	var entries []map[string]interface{}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		assert.NoError(json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+
+	assert.Equal("backend/concentratord: debug message", entries[0]["msg"])
+	assert.Equal("0102030405060708", entries[0]["gateway_id"])
+	assert.Equal("forwarder: info message", entries[1]["msg"])
+	assert.Equal("0807060504030201", entries[1]["gateway_id"])
+}
+
+func TestModule(t *testing.T) {
+	tests := map[string]string{
+		"backend/semtechudp: uplink received": "backend",
+		"metadata: execute command error":     "metadata",
+		"starting ChirpStack Gateway Bridge":  "",
+	}
+
+	for msg, expected := range tests {
+		require.Equal(t, expected, module(msg), msg)
+	}
+}
+
+type testHook struct {
+	entries []string
+}
+
+func (h *testHook) Levels() []log.Level {
+	return []log.Level{log.WarnLevel}
+}
+
+func (h *testHook) Fire(entry *log.Entry) error {
+	h.entries = append(h.entries, entry.Message)
+	return nil
+}
+
+func TestAddHook(t *testing.T) {
+	assert := require.New(t)
+
+	log.SetOutput(&bytes.Buffer{})
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormatter(&log.TextFormatter{})
+		log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+		extraHooks = nil
+	}()
+
+	var conf config.Config
+	conf.General.LogLevel = int(log.InfoLevel)
+	conf.General.LogLevels = map[string]int{
+		"integration": int(log.ErrorLevel),
+	}
+	assert.NoError(Setup(conf))
+
+	hook := &testHook{}
+	AddHook(hook)
+
+	log.Warning("backend: first warning")
+	log.Warning("integration/mqtt: filtered warning")
+
+	// the hook is retained on a reload
+	assert.NoError(Setup(conf))
+	log.Warning("backend: second warning")
+
+	assert.Equal([]string{"backend: first warning", "backend: second warning"}, hook.entries)
+}
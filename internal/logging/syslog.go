@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package logging
+
+import (
+	"log/syslog"
+
+	log "github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+func newSyslogHook(level log.Level) (log.Hook, error) {
+	var prio syslog.Priority
+
+	switch level {
+	case log.TraceLevel, log.DebugLevel:
+		prio = syslog.LOG_USER | syslog.LOG_DEBUG
+	case log.InfoLevel:
+		prio = syslog.LOG_USER | syslog.LOG_INFO
+	case log.WarnLevel:
+		prio = syslog.LOG_USER | syslog.LOG_WARNING
+	case log.ErrorLevel:
+		prio = syslog.LOG_USER | syslog.LOG_ERR
+	case log.FatalLevel, log.PanicLevel:
+		prio = syslog.LOG_USER | syslog.LOG_CRIT
+	}
+
+	return lsyslog.NewSyslogHook("", "", prio, identifier)
+}
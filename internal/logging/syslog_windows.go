@@ -0,0 +1,10 @@
+package logging
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func newSyslogHook(level log.Level) (log.Hook, error) {
+	return nil, errors.New("syslog logging is not supported on Windows")
+}
@@ -0,0 +1,155 @@
+// Package lrfhss implements the LR-FHSS modulation info, which is not
+// defined by the v3 gw API used by the ChirpStack Gateway Bridge.
+//
+// LR-FHSS frames have their modulation set to Modulation (LR_FHSS) and the
+// modulation info is stored as unrecognized field of the TX info. For the
+// uplink TX info, this is the field number of the lr_fhss_modulation_info
+// field of the later v3 API versions, such that the Protobuf marshaler
+// produces the same payload as these API versions. The downlink TX info
+// does not define this field in any v3 API version, the first free field
+// number is used.
+package lrfhss
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// Modulation defines the LR-FHSS modulation.
+const Modulation = common.Modulation(2)
+
+func init() {
+	// register the LR_FHSS enum name, such that it is used by the JSON
+	// (un)marshaler
+	common.Modulation_name[int32(Modulation)] = "LR_FHSS"
+	common.Modulation_value["LR_FHSS"] = int32(Modulation)
+}
+
+// ModulationInfo contains the LR-FHSS modulation parameters.
+type ModulationInfo struct {
+	// Operating channel width (OCW) in Hz.
+	OperatingChannelWidth uint32 `protobuf:"varint,1,opt,name=operating_channel_width,json=operatingChannelWidth,proto3" json:"operating_channel_width,omitempty"`
+	// Code-rate (e.g. 2/6).
+	CodeRate string `protobuf:"bytes,2,opt,name=code_rate,json=codeRate,proto3" json:"code_rate,omitempty"`
+	// Hopping grid number of steps.
+	GridSteps uint32 `protobuf:"varint,3,opt,name=grid_steps,json=gridSteps,proto3" json:"grid_steps,omitempty"`
+}
+
+func (m *ModulationInfo) Reset()         { *m = ModulationInfo{} }
+func (m *ModulationInfo) String() string { return proto.CompactTextString(m) }
+func (*ModulationInfo) ProtoMessage()    {}
+
+// GetOperatingChannelWidth returns the operating channel width (Hz).
+func (m *ModulationInfo) GetOperatingChannelWidth() uint32 {
+	if m != nil {
+		return m.OperatingChannelWidth
+	}
+	return 0
+}
+
+// GetCodeRate returns the code-rate.
+func (m *ModulationInfo) GetCodeRate() string {
+	if m != nil {
+		return m.CodeRate
+	}
+	return ""
+}
+
+// GetGridSteps returns the hopping grid number of steps.
+func (m *ModulationInfo) GetGridSteps() uint32 {
+	if m != nil {
+		return m.GridSteps
+	}
+	return 0
+}
+
+// uplinkTXInfoExt contains the LR-FHSS field of the UplinkTXInfo.
+type uplinkTXInfoExt struct {
+	LrFhssModulationInfo *ModulationInfo `protobuf:"bytes,5,opt,name=lr_fhss_modulation_info,json=lrFhssModulationInfo,proto3" json:"lr_fhss_modulation_info,omitempty"`
+	XXX_unrecognized     []byte          `json:"-"`
+}
+
+func (m *uplinkTXInfoExt) Reset()         { *m = uplinkTXInfoExt{} }
+func (m *uplinkTXInfoExt) String() string { return proto.CompactTextString(m) }
+func (*uplinkTXInfoExt) ProtoMessage()    {}
+
+// downlinkTXInfoExt contains the LR-FHSS field of the DownlinkTXInfo.
+type downlinkTXInfoExt struct {
+	LrFhssModulationInfo *ModulationInfo `protobuf:"bytes,17,opt,name=lr_fhss_modulation_info,json=lrFhssModulationInfo,proto3" json:"lr_fhss_modulation_info,omitempty"`
+	XXX_unrecognized     []byte          `json:"-"`
+}
+
+func (m *downlinkTXInfoExt) Reset()         { *m = downlinkTXInfoExt{} }
+func (m *downlinkTXInfoExt) String() string { return proto.CompactTextString(m) }
+func (*downlinkTXInfoExt) ProtoMessage()    {}
+
+// GetUplinkModulationInfo returns the LR-FHSS modulation info of the given
+// uplink TX info. It returns nil when the modulation is not LR-FHSS.
+func GetUplinkModulationInfo(txInfo *gw.UplinkTXInfo) *ModulationInfo {
+	if txInfo.GetModulation() != Modulation {
+		return nil
+	}
+
+	var ext uplinkTXInfoExt
+	if err := proto.Unmarshal(txInfo.XXX_unrecognized, &ext); err != nil {
+		return nil
+	}
+	return ext.LrFhssModulationInfo
+}
+
+// SetUplinkModulationInfo sets the modulation of the given uplink TX info to
+// LR-FHSS, using the given modulation info.
+func SetUplinkModulationInfo(txInfo *gw.UplinkTXInfo, info *ModulationInfo) error {
+	var ext uplinkTXInfoExt
+	if err := proto.Unmarshal(txInfo.XXX_unrecognized, &ext); err != nil {
+		return errors.Wrap(err, "unmarshal unrecognized fields error")
+	}
+	ext.LrFhssModulationInfo = info
+
+	b, err := proto.Marshal(&ext)
+	if err != nil {
+		return errors.Wrap(err, "marshal lr-fhss modulation info error")
+	}
+
+	txInfo.Modulation = Modulation
+	txInfo.ModulationInfo = nil
+	txInfo.XXX_unrecognized = b
+	return nil
+}
+
+// GetDownlinkModulationInfo returns the LR-FHSS modulation info of the given
+// downlink TX info. It returns nil when the modulation is not LR-FHSS.
+func GetDownlinkModulationInfo(txInfo *gw.DownlinkTXInfo) *ModulationInfo {
+	if txInfo.GetModulation() != Modulation {
+		return nil
+	}
+
+	var ext downlinkTXInfoExt
+	if err := proto.Unmarshal(txInfo.XXX_unrecognized, &ext); err != nil {
+		return nil
+	}
+	return ext.LrFhssModulationInfo
+}
+
+// SetDownlinkModulationInfo sets the modulation of the given downlink TX
+// info to LR-FHSS, using the given modulation info.
+func SetDownlinkModulationInfo(txInfo *gw.DownlinkTXInfo, info *ModulationInfo) error {
+	var ext downlinkTXInfoExt
+	if err := proto.Unmarshal(txInfo.XXX_unrecognized, &ext); err != nil {
+		return errors.Wrap(err, "unmarshal unrecognized fields error")
+	}
+	ext.LrFhssModulationInfo = info
+
+	b, err := proto.Marshal(&ext)
+	if err != nil {
+		return errors.Wrap(err, "marshal lr-fhss modulation info error")
+	}
+
+	txInfo.Modulation = Modulation
+	txInfo.ModulationInfo = nil
+	txInfo.XXX_unrecognized = b
+	return nil
+}
@@ -0,0 +1,124 @@
+package lrfhss
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+func TestUplinkModulationInfo(t *testing.T) {
+	assert := require.New(t)
+
+	info := ModulationInfo{
+		OperatingChannelWidth: 137000,
+		CodeRate:              "2/6",
+		GridSteps:             8,
+	}
+
+	txInfo := gw.UplinkTXInfo{
+		Frequency:  868100000,
+		Modulation: common.Modulation_LORA,
+		ModulationInfo: &gw.UplinkTXInfo_LoraModulationInfo{
+			LoraModulationInfo: &gw.LoRaModulationInfo{},
+		},
+	}
+	assert.Nil(GetUplinkModulationInfo(&txInfo))
+
+	assert.NoError(SetUplinkModulationInfo(&txInfo, &info))
+	assert.Equal(Modulation, txInfo.Modulation)
+	assert.Nil(txInfo.ModulationInfo)
+
+	// the modulation info must survive a Protobuf round-trip
+	b, err := proto.Marshal(&gw.UplinkFrame{TxInfo: &txInfo})
+	assert.NoError(err)
+
+	var up gw.UplinkFrame
+	assert.NoError(proto.Unmarshal(b, &up))
+	assert.Equal(uint32(868100000), up.TxInfo.Frequency)
+	assert.True(proto.Equal(&info, GetUplinkModulationInfo(up.TxInfo)))
+}
+
+func TestDownlinkModulationInfo(t *testing.T) {
+	assert := require.New(t)
+
+	info := ModulationInfo{
+		OperatingChannelWidth: 137000,
+		CodeRate:              "2/6",
+		GridSteps:             52,
+	}
+
+	txInfo := gw.DownlinkTXInfo{Frequency: 868100000}
+	assert.Nil(GetDownlinkModulationInfo(&txInfo))
+
+	assert.NoError(SetDownlinkModulationInfo(&txInfo, &info))
+
+	b, err := proto.Marshal(&gw.DownlinkFrame{TxInfo: &txInfo})
+	assert.NoError(err)
+
+	var down gw.DownlinkFrame
+	assert.NoError(proto.Unmarshal(b, &down))
+	assert.Equal(Modulation, down.TxInfo.Modulation)
+	assert.True(proto.Equal(&info, GetDownlinkModulationInfo(down.TxInfo)))
+}
+
+func TestWrap(t *testing.T) {
+	marshal, unmarshal := Wrap(
+		func(msg proto.Message) ([]byte, error) {
+			var m jsonpb.Marshaler
+			str, err := m.MarshalToString(msg)
+			return []byte(str), err
+		},
+		func(b []byte, msg proto.Message) error {
+			u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+			return u.Unmarshal(bytes.NewReader(b), msg)
+		},
+	)
+
+	info := ModulationInfo{
+		OperatingChannelWidth: 137000,
+		CodeRate:              "2/6",
+		GridSteps:             8,
+	}
+
+	t.Run("uplink", func(t *testing.T) {
+		assert := require.New(t)
+
+		txInfo := gw.UplinkTXInfo{Frequency: 868100000}
+		assert.NoError(SetUplinkModulationInfo(&txInfo, &info))
+
+		b, err := marshal(&gw.UplinkFrame{PhyPayload: []byte{1, 2, 3}, TxInfo: &txInfo})
+		assert.NoError(err)
+		assert.Contains(string(b), `"modulation":"LR_FHSS"`)
+		assert.Contains(string(b), `"lrFhssModulationInfo":{"operatingChannelWidth":137000,"codeRate":"2/6","gridSteps":8}`)
+
+		var up gw.UplinkFrame
+		assert.NoError(unmarshal(b, &up))
+		assert.Equal([]byte{1, 2, 3}, up.PhyPayload)
+		assert.True(proto.Equal(&info, GetUplinkModulationInfo(up.TxInfo)))
+	})
+
+	t.Run("downlink", func(t *testing.T) {
+		assert := require.New(t)
+
+		b := []byte(`{"phyPayload":"AQID","txInfo":{"frequency":868100000,"modulation":"LR_FHSS","lrFhssModulationInfo":{"operatingChannelWidth":137000,"codeRate":"2/6","gridSteps":8}}}`)
+
+		var down gw.DownlinkFrame
+		assert.NoError(unmarshal(b, &down))
+		assert.Equal(uint32(868100000), down.TxInfo.Frequency)
+		assert.True(proto.Equal(&info, GetDownlinkModulationInfo(down.TxInfo)))
+	})
+
+	t.Run("lora uplink", func(t *testing.T) {
+		assert := require.New(t)
+
+		b, err := marshal(&gw.UplinkFrame{TxInfo: &gw.UplinkTXInfo{Modulation: common.Modulation_LORA}})
+		assert.NoError(err)
+		assert.NotContains(string(b), "lrFhssModulationInfo")
+	})
+}
@@ -0,0 +1,150 @@
+package lrfhss
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+)
+
+// UplinkFrame implements the v3 UplinkFrame, including the LR-FHSS
+// modulation info. It is used to marshal LR-FHSS uplinks, as the JSON and
+// CBOR marshalers do not include the unrecognized fields.
+type UplinkFrame struct {
+	// PHYPayload.
+	PhyPayload []byte `protobuf:"bytes,1,opt,name=phy_payload,json=phyPayload,proto3" json:"phy_payload,omitempty"`
+	// TX meta-data.
+	TxInfo *UplinkTXInfo `protobuf:"bytes,2,opt,name=tx_info,json=txInfo,proto3" json:"tx_info,omitempty"`
+	// RX meta-data.
+	RxInfo *gw.UplinkRXInfo `protobuf:"bytes,3,opt,name=rx_info,json=rxInfo,proto3" json:"rx_info,omitempty"`
+}
+
+func (m *UplinkFrame) Reset()         { *m = UplinkFrame{} }
+func (m *UplinkFrame) String() string { return proto.CompactTextString(m) }
+func (*UplinkFrame) ProtoMessage()    {}
+
+// GetTxInfo returns the TX meta-data.
+func (m *UplinkFrame) GetTxInfo() *UplinkTXInfo {
+	if m != nil {
+		return m.TxInfo
+	}
+	return nil
+}
+
+// UplinkTXInfo implements the v3 UplinkTXInfo of LR-FHSS uplinks.
+type UplinkTXInfo struct {
+	// Frequency (Hz).
+	Frequency uint32 `protobuf:"varint,1,opt,name=frequency,proto3" json:"frequency,omitempty"`
+	// Modulation.
+	Modulation common.Modulation `protobuf:"varint,2,opt,name=modulation,proto3,enum=common.Modulation" json:"modulation,omitempty"`
+	// LR-FHSS modulation info.
+	LrFhssModulationInfo *ModulationInfo `protobuf:"bytes,5,opt,name=lr_fhss_modulation_info,json=lrFhssModulationInfo,proto3" json:"lr_fhss_modulation_info,omitempty"`
+}
+
+func (m *UplinkTXInfo) Reset()         { *m = UplinkTXInfo{} }
+func (m *UplinkTXInfo) String() string { return proto.CompactTextString(m) }
+func (*UplinkTXInfo) ProtoMessage()    {}
+
+// GetLrFhssModulationInfo returns the LR-FHSS modulation info.
+func (m *UplinkTXInfo) GetLrFhssModulationInfo() *ModulationInfo {
+	if m != nil {
+		return m.LrFhssModulationInfo
+	}
+	return nil
+}
+
+// downlinkFrame contains the LR-FHSS fields of the v3 DownlinkFrame. It is
+// used to unmarshal the LR-FHSS modulation info of downlinks.
+type downlinkFrame struct {
+	TxInfo *downlinkTXInfo `protobuf:"bytes,2,opt,name=tx_info,json=txInfo,proto3" json:"tx_info,omitempty"`
+}
+
+func (m *downlinkFrame) Reset()         { *m = downlinkFrame{} }
+func (m *downlinkFrame) String() string { return proto.CompactTextString(m) }
+func (*downlinkFrame) ProtoMessage()    {}
+
+type downlinkTXInfo struct {
+	LrFhssModulationInfo *ModulationInfo `protobuf:"bytes,17,opt,name=lr_fhss_modulation_info,json=lrFhssModulationInfo,proto3" json:"lr_fhss_modulation_info,omitempty"`
+}
+
+func (m *downlinkTXInfo) Reset()         { *m = downlinkTXInfo{} }
+func (m *downlinkTXInfo) String() string { return proto.CompactTextString(m) }
+func (*downlinkTXInfo) ProtoMessage()    {}
+
+func (m *downlinkTXInfo) GetLrFhssModulationInfo() *ModulationInfo {
+	if m != nil {
+		return m.LrFhssModulationInfo
+	}
+	return nil
+}
+
+// UplinkFrameFromV3 returns the UplinkFrame for the given v3 UplinkFrame.
+// It returns false when the uplink does not use the LR-FHSS modulation.
+func UplinkFrameFromV3(in gw.UplinkFrame) (UplinkFrame, bool) {
+	info := GetUplinkModulationInfo(in.GetTxInfo())
+	if info == nil {
+		return UplinkFrame{}, false
+	}
+
+	return UplinkFrame{
+		PhyPayload: in.PhyPayload,
+		TxInfo: &UplinkTXInfo{
+			Frequency:            in.GetTxInfo().GetFrequency(),
+			Modulation:           Modulation,
+			LrFhssModulationInfo: info,
+		},
+		RxInfo: in.RxInfo,
+	}, true
+}
+
+// Wrap wraps the given marshal and unmarshal functions, such that the
+// LR-FHSS modulation info of uplinks and downlinks is included. Other
+// messages are passed through as-is.
+func Wrap(marshal func(proto.Message) ([]byte, error), unmarshal func([]byte, proto.Message) error) (func(proto.Message) ([]byte, error), func([]byte, proto.Message) error) {
+	wrappedMarshal := func(msg proto.Message) ([]byte, error) {
+		if v, ok := msg.(*gw.UplinkFrame); ok {
+			if up, ok := UplinkFrameFromV3(*v); ok {
+				return marshal(&up)
+			}
+		}
+		return marshal(msg)
+	}
+
+	wrappedUnmarshal := func(b []byte, msg proto.Message) error {
+		if err := unmarshal(b, msg); err != nil {
+			return err
+		}
+
+		switch v := msg.(type) {
+		case *gw.UplinkFrame:
+			if v.GetTxInfo().GetModulation() != Modulation || GetUplinkModulationInfo(v.GetTxInfo()) != nil {
+				return nil
+			}
+
+			var up UplinkFrame
+			if err := unmarshal(b, &up); err != nil {
+				return errors.Wrap(err, "unmarshal lr-fhss modulation info error")
+			}
+			if info := up.TxInfo.GetLrFhssModulationInfo(); info != nil {
+				return SetUplinkModulationInfo(v.TxInfo, info)
+			}
+		case *gw.DownlinkFrame:
+			if v.GetTxInfo().GetModulation() != Modulation || GetDownlinkModulationInfo(v.GetTxInfo()) != nil {
+				return nil
+			}
+
+			var down downlinkFrame
+			if err := unmarshal(b, &down); err != nil {
+				return errors.Wrap(err, "unmarshal lr-fhss modulation info error")
+			}
+			if info := down.TxInfo.GetLrFhssModulationInfo(); info != nil {
+				return SetDownlinkModulationInfo(v.TxInfo, info)
+			}
+		}
+
+		return nil
+	}
+
+	return wrappedMarshal, wrappedUnmarshal
+}
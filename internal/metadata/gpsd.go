@@ -0,0 +1,153 @@
+package metadata
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+)
+
+// gpsdReconnectInterval defines the interval in which the connection to gpsd
+// is re-established after a connection or read error.
+var gpsdReconnectInterval = 5 * time.Second
+
+// gpsdWatch enables the JSON reports of gpsd.
+const gpsdWatch = `?WATCH={"enable":true,"json":true};`
+
+// gpsdFixModes maps the gpsd TPV mode to the fix quality.
+var gpsdFixModes = map[int]string{
+	0: "none",
+	1: "none",
+	2: "2d",
+	3: "3d",
+}
+
+// gpsdTPV implements the gpsd time-position-velocity report.
+type gpsdTPV struct {
+	Class  string   `json:"class"`
+	Mode   int      `json:"mode"`
+	Lat    float64  `json:"lat"`
+	Lon    float64  `json:"lon"`
+	Alt    *float64 `json:"alt"`
+	AltMSL *float64 `json:"altMSL"`
+	EPX    float64  `json:"epx"`
+	EPY    float64  `json:"epy"`
+}
+
+var (
+	gpsdMux sync.RWMutex
+
+	gpsdLocation  *common.Location
+	gpsdFix       string
+	gpsdUpdatedAt time.Time
+	gpsdMaxAge    time.Duration
+)
+
+// GetLocation returns the location and fix quality (none, 2d or 3d) reported
+// by gpsd. The location is nil when gpsd is not enabled, when there is no fix
+// or when the last report is older than the configured max. age. The fix
+// quality is empty when gpsd is not enabled or the last report is too old.
+func GetLocation() (*common.Location, string) {
+	gpsdMux.RLock()
+	defer gpsdMux.RUnlock()
+
+	if gpsdUpdatedAt.IsZero() || (gpsdMaxAge != 0 && time.Since(gpsdUpdatedAt) > gpsdMaxAge) {
+		return nil, ""
+	}
+
+	if gpsdLocation == nil {
+		return nil, gpsdFix
+	}
+
+	loc := *gpsdLocation
+	return &loc, gpsdFix
+}
+
+// gpsdLoop connects to gpsd and handles the reports. On error, the connection
+// is re-established after gpsdReconnectInterval.
+func gpsdLoop(server string) {
+	for {
+		if err := gpsdConnect(server); err != nil {
+			log.WithError(err).WithField("server", server).Error("metadata: gpsd error")
+		}
+
+		time.Sleep(gpsdReconnectInterval)
+	}
+}
+
+func gpsdConnect(server string) error {
+	conn, err := net.Dial("tcp", server)
+	if err != nil {
+		return errors.Wrap(err, "dial error")
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(gpsdWatch)); err != nil {
+		return errors.Wrap(err, "write watch command error")
+	}
+
+	log.WithField("server", server).Info("metadata: connected to gpsd")
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		gpsdHandleReport(scanner.Bytes(), time.Now())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "read error")
+	}
+
+	return errors.New("connection closed")
+}
+
+// gpsdHandleReport handles a single gpsd report. Only TPV reports are used,
+// other reports are ignored.
+func gpsdHandleReport(b []byte, now time.Time) {
+	var tpv gpsdTPV
+	if err := json.Unmarshal(b, &tpv); err != nil {
+		log.WithError(err).Debug("metadata: unmarshal gpsd report error")
+		return
+	}
+
+	if tpv.Class != "TPV" {
+		return
+	}
+
+	fix, ok := gpsdFixModes[tpv.Mode]
+	if !ok {
+		fix = "none"
+	}
+
+	var loc *common.Location
+	if tpv.Mode >= 2 {
+		loc = &common.Location{
+			Latitude:  tpv.Lat,
+			Longitude: tpv.Lon,
+			Source:    common.LocationSource_GPS,
+			Accuracy:  uint32(math.Round(math.Max(tpv.EPX, tpv.EPY))),
+		}
+
+		// the altitude is only valid for a 3D fix
+		if tpv.Mode == 3 {
+			if tpv.AltMSL != nil {
+				loc.Altitude = *tpv.AltMSL
+			} else if tpv.Alt != nil {
+				loc.Altitude = *tpv.Alt
+			}
+		}
+	}
+
+	gpsdMux.Lock()
+	defer gpsdMux.Unlock()
+
+	gpsdLocation = loc
+	gpsdFix = fix
+	gpsdUpdatedAt = now
+}
@@ -0,0 +1,135 @@
+package metadata
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+)
+
+func TestGPSD(t *testing.T) {
+	t.Run("reports", func(t *testing.T) {
+		tests := []struct {
+			Name             string
+			Report           string
+			ExpectedLocation *common.Location
+			ExpectedFix      string
+		}{
+			{
+				Name:        "no fix",
+				Report:      `{"class":"TPV","mode":1}`,
+				ExpectedFix: "none",
+			},
+			{
+				Name:   "2d fix",
+				Report: `{"class":"TPV","mode":2,"lat":51.5,"lon":4.1,"alt":12.5,"epx":3.2,"epy":5.6}`,
+				ExpectedLocation: &common.Location{
+					Latitude:  51.5,
+					Longitude: 4.1,
+					Source:    common.LocationSource_GPS,
+					Accuracy:  6,
+				},
+				ExpectedFix: "2d",
+			},
+			{
+				Name:   "3d fix",
+				Report: `{"class":"TPV","mode":3,"lat":51.5,"lon":4.1,"alt":12.5,"altMSL":10.5,"epx":3.2,"epy":1.1}`,
+				ExpectedLocation: &common.Location{
+					Latitude:  51.5,
+					Longitude: 4.1,
+					Altitude:  10.5,
+					Source:    common.LocationSource_GPS,
+					Accuracy:  3,
+				},
+				ExpectedFix: "3d",
+			},
+			{
+				Name:   "3d fix without altMSL",
+				Report: `{"class":"TPV","mode":3,"lat":51.5,"lon":4.1,"alt":12.5}`,
+				ExpectedLocation: &common.Location{
+					Latitude:  51.5,
+					Longitude: 4.1,
+					Altitude:  12.5,
+					Source:    common.LocationSource_GPS,
+				},
+				ExpectedFix: "3d",
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.Name, func(t *testing.T) {
+				assert := require.New(t)
+
+				gpsdHandleReport([]byte(tst.Report), time.Now())
+				loc, fix := GetLocation()
+				assert.Equal(tst.ExpectedLocation, loc)
+				assert.Equal(tst.ExpectedFix, fix)
+			})
+		}
+	})
+
+	t.Run("ignore other reports", func(t *testing.T) {
+		assert := require.New(t)
+
+		gpsdHandleReport([]byte(`{"class":"TPV","mode":2,"lat":51.5,"lon":4.1}`), time.Now())
+		gpsdHandleReport([]byte(`{"class":"SKY","satellites":[]}`), time.Now())
+		gpsdHandleReport([]byte(`invalid`), time.Now())
+
+		loc, fix := GetLocation()
+		assert.NotNil(loc)
+		assert.Equal("2d", fix)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		assert := require.New(t)
+
+		gpsdMaxAge = time.Minute
+		defer func() { gpsdMaxAge = 0 }()
+
+		gpsdHandleReport([]byte(`{"class":"TPV","mode":2,"lat":51.5,"lon":4.1}`), time.Now().Add(-2*time.Minute))
+		loc, fix := GetLocation()
+		assert.Nil(loc)
+		assert.Equal("", fix)
+	})
+
+	t.Run("connect", func(t *testing.T) {
+		assert := require.New(t)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		defer ln.Close()
+
+		watchChan := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			b := make([]byte, len(gpsdWatch))
+			if _, err := conn.Read(b); err != nil {
+				return
+			}
+			watchChan <- string(b)
+
+			conn.Write([]byte(`{"class":"VERSION","release":"3.22"}` + "\n"))
+			conn.Write([]byte(`{"class":"TPV","mode":3,"lat":1.5,"lon":2.5,"altMSL":3.5}` + "\n"))
+		}()
+
+		assert.Error(gpsdConnect(ln.Addr().String()))
+		assert.Equal(gpsdWatch, <-watchChan)
+
+		loc, fix := GetLocation()
+		assert.Equal(&common.Location{
+			Latitude:  1.5,
+			Longitude: 2.5,
+			Altitude:  3.5,
+			Source:    common.LocationSource_GPS,
+		}, loc)
+		assert.Equal("3d", fix)
+	})
+}
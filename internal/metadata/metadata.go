@@ -20,6 +20,7 @@ var (
 
 	static map[string]string
 	cmnds  map[string]string
+	system systemConfig
 	cached map[string]string
 
 	interval     time.Duration
@@ -28,21 +29,50 @@ var (
 
 // Setup configures the metadata package.
 func Setup(conf config.Config) error {
+	if err := Reload(conf); err != nil {
+		return err
+	}
+
+	if conf.MetaData.GPSD.Enabled {
+		go gpsdLoop(conf.MetaData.GPSD.Server)
+	}
+
+	go func() {
+		for {
+			runCommands()
+
+			mux.RLock()
+			i := interval
+			mux.RUnlock()
+
+			time.Sleep(i)
+		}
+	}()
+
+	return nil
+}
+
+// Reload applies the given (reloaded) configuration. The new static
+// metadata and commands are used from the next execution interval.
+func Reload(conf config.Config) error {
 	mux.Lock()
 	defer mux.Unlock()
 
 	static = conf.MetaData.Static
 	cmnds = conf.MetaData.Dynamic.Commands
+	system = systemConfig{
+		enabled:         conf.MetaData.System.Enabled,
+		prefix:          conf.MetaData.System.Prefix,
+		diskPath:        conf.MetaData.System.DiskPath,
+		temperaturePath: conf.MetaData.System.TemperaturePath,
+	}
 
 	interval = conf.MetaData.Dynamic.ExecutionInterval
 	maxExecution = conf.MetaData.Dynamic.MaxExecutionDuration
 
-	go func() {
-		for {
-			runCommands()
-			time.Sleep(interval)
-		}
-	}()
+	gpsdMux.Lock()
+	gpsdMaxAge = conf.MetaData.GPSD.MaxAge
+	gpsdMux.Unlock()
 
 	return nil
 }
@@ -56,12 +86,26 @@ func Get() map[string]string {
 }
 
 func runCommands() {
-	newKV := make(map[string]string)
+	mux.RLock()
+	sys := system
+	stat := make(map[string]string)
 	for k, v := range static {
+		stat[k] = v
+	}
+	cmds := make(map[string]string)
+	for k, cmd := range cmnds {
+		cmds[k] = cmd
+	}
+	mux.RUnlock()
+
+	// the system meta-data has the lowest priority, it is overwritten by the
+	// static and dynamic meta-data
+	newKV := getSystem(sys)
+	for k, v := range stat {
 		newKV[k] = v
 	}
 
-	for k, cmd := range cmnds {
+	for k, cmd := range cmds {
 		out, err := runCommand(cmd)
 		if err != nil {
 			log.WithError(err).WithFields(log.Fields{
@@ -88,7 +132,11 @@ func runCommand(cmdStr string) (string, error) {
 		return "", errors.New("no command is given")
 	}
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(maxExecution))
+	mux.RLock()
+	timeout := maxExecution
+	mux.RUnlock()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(timeout))
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
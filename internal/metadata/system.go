@@ -0,0 +1,172 @@
+package metadata
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// procPath defines the mount-point of the proc filesystem.
+var procPath = "/proc"
+
+// systemConfig contains the system meta-data configuration.
+type systemConfig struct {
+	enabled         bool
+	prefix          string
+	diskPath        string
+	temperaturePath string
+}
+
+// getSystem returns the system meta-data. Collectors returning an error are
+// logged and ignored.
+func getSystem(conf systemConfig) map[string]string {
+	out := make(map[string]string)
+	if !conf.enabled {
+		return out
+	}
+
+	collectors := []struct {
+		name string
+		fn   func() (map[string]string, error)
+	}{
+		{"cpu_load", getCPULoad},
+		{"memory", getMemory},
+		{"disk", func() (map[string]string, error) {
+			if conf.diskPath == "" {
+				return nil, nil
+			}
+			return getDisk(conf.diskPath)
+		}},
+		{"temperature", func() (map[string]string, error) {
+			if conf.temperaturePath == "" {
+				return nil, nil
+			}
+			return getTemperature(conf.temperaturePath)
+		}},
+	}
+
+	for _, c := range collectors {
+		kv, err := c.fn()
+		if err != nil {
+			log.WithError(err).WithField("collector", c.name).Error("metadata: read system meta-data error")
+			continue
+		}
+
+		for k, v := range kv {
+			out[conf.prefix+k] = v
+		}
+	}
+
+	return out
+}
+
+// getCPULoad returns the 1, 5 and 15 minute load average.
+func getCPULoad() (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procPath, "loadavg"))
+	if err != nil {
+		return nil, errors.Wrap(err, "read loadavg error")
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return nil, errors.New("invalid loadavg format")
+	}
+
+	return map[string]string{
+		"cpu_load_1":  fields[0],
+		"cpu_load_5":  fields[1],
+		"cpu_load_15": fields[2],
+	}, nil
+}
+
+// getMemory returns the total and available memory. For kernels not
+// reporting MemAvailable (< 3.14), the free, buffers and cached memory is
+// used as available memory.
+func getMemory() (map[string]string, error) {
+	f, err := os.Open(filepath.Join(procPath, "meminfo"))
+	if err != nil {
+		return nil, errors.Wrap(err, "open meminfo error")
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read meminfo error")
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok || total == 0 {
+		return nil, errors.New("MemTotal is missing")
+	}
+
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+
+	return map[string]string{
+		"memory_total_kb":     strconv.FormatUint(total, 10),
+		"memory_available_kb": strconv.FormatUint(available, 10),
+		"memory_used_percent": usedPercent(total, available),
+	}, nil
+}
+
+// getDisk returns the total and free disk space of the filesystem containing
+// the given path.
+func getDisk(path string) (map[string]string, error) {
+	total, free, err := diskUsage(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "get disk usage error")
+	}
+
+	return map[string]string{
+		"disk_total_kb":     strconv.FormatUint(total/1024, 10),
+		"disk_free_kb":      strconv.FormatUint(free/1024, 10),
+		"disk_used_percent": usedPercent(total, free),
+	}, nil
+}
+
+// getTemperature returns the temperature read from the given sysfs file,
+// which contains the temperature in milli-degree Celsius.
+func getTemperature(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read temperature error")
+	}
+
+	milli, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse temperature error")
+	}
+
+	return map[string]string{
+		"temperature": strconv.FormatFloat(float64(milli)/1000, 'f', 1, 64),
+	}, nil
+}
+
+func usedPercent(total, available uint64) string {
+	if total == 0 || available > total {
+		return "0"
+	}
+	return fmt.Sprintf("%.1f", float64(total-available)/float64(total)*100)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package metadata
+
+import (
+	"syscall"
+)
+
+// diskUsage returns the total and free (available to unprivileged users)
+// bytes of the filesystem containing the given path.
+func diskUsage(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	return stat.Blocks * uint64(stat.Bsize), stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,9 @@
+package metadata
+
+import (
+	"github.com/pkg/errors"
+)
+
+func diskUsage(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk usage is not supported on Windows")
+}
@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSystem(t *testing.T) {
+	assert := require.New(t)
+
+	tempDir, err := ioutil.TempDir("", "metadata")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(tempDir, "loadavg"), []byte("0.52 0.58 0.59 1/190 12345\n"), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(tempDir, "meminfo"), []byte("MemTotal:        1000000 kB\nMemFree:          200000 kB\nMemAvailable:     750000 kB\nBuffers:           10000 kB\n"), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(tempDir, "temp"), []byte("47123\n"), 0644))
+
+	oldProcPath := procPath
+	procPath = tempDir
+	defer func() {
+		procPath = oldProcPath
+	}()
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+		assert.Len(getSystem(systemConfig{}), 0)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		kv := getSystem(systemConfig{
+			enabled:         true,
+			prefix:          "system_",
+			diskPath:        tempDir,
+			temperaturePath: filepath.Join(tempDir, "temp"),
+		})
+
+		assert.Equal("0.52", kv["system_cpu_load_1"])
+		assert.Equal("0.58", kv["system_cpu_load_5"])
+		assert.Equal("0.59", kv["system_cpu_load_15"])
+		assert.Equal("1000000", kv["system_memory_total_kb"])
+		assert.Equal("750000", kv["system_memory_available_kb"])
+		assert.Equal("25.0", kv["system_memory_used_percent"])
+		assert.Equal("47.1", kv["system_temperature"])
+		assert.NotEmpty(kv["system_disk_total_kb"])
+		assert.NotEmpty(kv["system_disk_free_kb"])
+		assert.NotEmpty(kv["system_disk_used_percent"])
+	})
+
+	t.Run("collector errors are ignored", func(t *testing.T) {
+		assert := require.New(t)
+
+		kv := getSystem(systemConfig{
+			enabled:         true,
+			temperaturePath: filepath.Join(tempDir, "missing"),
+		})
+
+		assert.Equal("0.52", kv["cpu_load_1"])
+		assert.NotContains(kv, "temperature")
+		assert.NotContains(kv, "disk_free_kb")
+	})
+
+	t.Run("memory without MemAvailable", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ioutil.WriteFile(filepath.Join(tempDir, "meminfo"), []byte("MemTotal:        1000000 kB\nMemFree:          200000 kB\nBuffers:           10000 kB\nCached:           40000 kB\n"), 0644))
+
+		kv, err := getMemory()
+		assert.NoError(err)
+		assert.Equal("250000", kv["memory_available_kb"])
+		assert.Equal("75.0", kv["memory_used_percent"])
+	})
+}
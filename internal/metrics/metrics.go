@@ -3,14 +3,20 @@ package metrics
 import (
 	"net/http"
 
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/metrics/snmp"
 )
 
 // Setup configures the metrics package.
 func Setup(conf config.Config) error {
+	if err := snmp.Setup(conf); err != nil {
+		return errors.Wrap(err, "setup snmp agent error")
+	}
+
 	if !conf.Metrics.Prometheus.EndpointEnabled {
 		return nil
 	}
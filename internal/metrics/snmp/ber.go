@@ -0,0 +1,393 @@
+package snmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BER tags used by SNMPv2c.
+const (
+	tagInteger     byte = 0x02
+	tagOctetString byte = 0x04
+	tagNull        byte = 0x05
+	tagOID         byte = 0x06
+	tagSequence    byte = 0x30
+
+	tagGauge32   byte = 0x42
+	tagTimeTicks byte = 0x43
+	tagCounter64 byte = 0x46
+
+	tagNoSuchObject byte = 0x80
+	tagEndOfMIBView byte = 0x82
+
+	tagGetRequest     byte = 0xa0
+	tagGetNextRequest byte = 0xa1
+	tagResponse       byte = 0xa2
+	tagGetBulkRequest byte = 0xa5
+)
+
+// oid implements an object identifier.
+type oid []uint32
+
+// parseOID parses the given dotted OID string (e.g. 1.3.6.1.4.1).
+func parseOID(s string) (oid, error) {
+	var out oid
+	for _, p := range strings.Split(strings.Trim(s, "."), ".") {
+		i, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid: %s", s)
+		}
+		out = append(out, uint32(i))
+	}
+
+	if len(out) < 2 {
+		return nil, fmt.Errorf("invalid oid: %s", s)
+	}
+
+	return out, nil
+}
+
+func (o oid) String() string {
+	parts := make([]string, len(o))
+	for i := range o {
+		parts[i] = strconv.FormatUint(uint64(o[i]), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// append returns a copy of the OID with the given sub-identifiers appended.
+func (o oid) append(ids ...uint32) oid {
+	out := make(oid, 0, len(o)+len(ids))
+	out = append(out, o...)
+	return append(out, ids...)
+}
+
+// compare returns -1, 0 or 1 when o is lexicographically before, equal to or
+// after the given OID.
+func (o oid) compare(other oid) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		if o[i] < other[i] {
+			return -1
+		}
+		if o[i] > other[i] {
+			return 1
+		}
+	}
+
+	switch {
+	case len(o) < len(other):
+		return -1
+	case len(o) > len(other):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// value implements a BER encoded variable-binding value.
+type value struct {
+	tag  byte
+	data []byte
+}
+
+func integer(i int64) value {
+	return value{tag: tagInteger, data: encodeInt(i)}
+}
+
+func octetString(s string) value {
+	return value{tag: tagOctetString, data: []byte(s)}
+}
+
+func gauge32(i uint32) value {
+	return value{tag: tagGauge32, data: encodeUint(uint64(i))}
+}
+
+func timeTicks(i uint32) value {
+	return value{tag: tagTimeTicks, data: encodeUint(uint64(i))}
+}
+
+func counter64(i uint64) value {
+	return value{tag: tagCounter64, data: encodeUint(i)}
+}
+
+// varBind implements a variable binding.
+type varBind struct {
+	oid   oid
+	value value
+}
+
+// pdu implements the (bulk) request and response PDU.
+type pdu struct {
+	tag       byte
+	requestID int64
+	// errorStatus contains the non-repeaters for a GetBulkRequest.
+	errorStatus int64
+	// errorIndex contains the max-repetitions for a GetBulkRequest.
+	errorIndex int64
+	varBinds   []varBind
+}
+
+// message implements the SNMPv2c message.
+type message struct {
+	version   int64
+	community string
+	pdu       pdu
+}
+
+func encodeTLV(tag byte, data []byte) []byte {
+	out := []byte{tag}
+	out = append(out, encodeLength(len(data))...)
+	return append(out, data...)
+}
+
+func encodeLength(l int) []byte {
+	if l < 0x80 {
+		return []byte{byte(l)}
+	}
+
+	var b []byte
+	for ; l > 0; l >>= 8 {
+		b = append([]byte{byte(l)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func encodeInt(i int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(i)}, b...)
+		i >>= 8
+		if (i == 0 && b[0]&0x80 == 0) || (i == -1 && b[0]&0x80 != 0) {
+			return b
+		}
+	}
+}
+
+func encodeUint(i uint64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(i)}, b...)
+		i >>= 8
+		if i == 0 {
+			break
+		}
+	}
+
+	// prevent the value from being decoded as a negative number
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func encodeOID(o oid) []byte {
+	if len(o) < 2 {
+		return []byte{0}
+	}
+
+	b := encodeSubID(o[0]*40 + o[1])
+	for _, id := range o[2:] {
+		b = append(b, encodeSubID(id)...)
+	}
+	return b
+}
+
+func encodeSubID(id uint32) []byte {
+	b := []byte{byte(id & 0x7f)}
+	for id >>= 7; id > 0; id >>= 7 {
+		b = append([]byte{byte(id&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+// marshal returns the BER encoding of the message.
+func (m message) marshal() []byte {
+	var varBinds []byte
+	for _, vb := range m.pdu.varBinds {
+		data := encodeTLV(tagOID, encodeOID(vb.oid))
+		data = append(data, encodeTLV(vb.value.tag, vb.value.data)...)
+		varBinds = append(varBinds, encodeTLV(tagSequence, data)...)
+	}
+
+	var p []byte
+	p = append(p, encodeTLV(tagInteger, encodeInt(m.pdu.requestID))...)
+	p = append(p, encodeTLV(tagInteger, encodeInt(m.pdu.errorStatus))...)
+	p = append(p, encodeTLV(tagInteger, encodeInt(m.pdu.errorIndex))...)
+	p = append(p, encodeTLV(tagSequence, varBinds)...)
+
+	var data []byte
+	data = append(data, encodeTLV(tagInteger, encodeInt(m.version))...)
+	data = append(data, encodeTLV(tagOctetString, []byte(m.community))...)
+	data = append(data, encodeTLV(m.pdu.tag, p)...)
+
+	return encodeTLV(tagSequence, data)
+}
+
+// decoder decodes a BER encoded byte slice.
+type decoder struct {
+	b []byte
+}
+
+// next returns the tag and data of the next TLV.
+func (d *decoder) next() (byte, []byte, error) {
+	if len(d.b) < 2 {
+		return 0, nil, errors.New("unexpected end of data")
+	}
+
+	tag := d.b[0]
+	l := int(d.b[1])
+	offset := 2
+
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 || len(d.b) < offset+n {
+			return 0, nil, errors.New("invalid length")
+		}
+
+		l = 0
+		for _, b := range d.b[offset : offset+n] {
+			l = l<<8 | int(b)
+		}
+		offset += n
+	}
+
+	if l < 0 || len(d.b) < offset+l {
+		return 0, nil, errors.New("unexpected end of data")
+	}
+
+	data := d.b[offset : offset+l]
+	d.b = d.b[offset+l:]
+
+	return tag, data, nil
+}
+
+// expect returns the data of the next TLV, which must have the given tag.
+func (d *decoder) expect(tag byte) ([]byte, error) {
+	t, data, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	if t != tag {
+		return nil, fmt.Errorf("expected tag 0x%02x, got 0x%02x", tag, t)
+	}
+	return data, nil
+}
+
+func (d *decoder) integer() (int64, error) {
+	data, err := d.expect(tagInteger)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 || len(data) > 8 {
+		return 0, errors.New("invalid integer length")
+	}
+
+	i := int64(int8(data[0]))
+	for _, b := range data[1:] {
+		i = i<<8 | int64(b)
+	}
+	return i, nil
+}
+
+func decodeOID(data []byte) (oid, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty oid")
+	}
+
+	var ids []uint32
+	var id uint32
+	for i, b := range data {
+		id = id<<7 | uint32(b&0x7f)
+		if b&0x80 != 0 {
+			if i == len(data)-1 {
+				return nil, errors.New("invalid oid")
+			}
+			continue
+		}
+		ids = append(ids, id)
+		id = 0
+	}
+
+	var out oid
+	if ids[0] < 80 {
+		out = oid{ids[0] / 40, ids[0] % 40}
+	} else {
+		out = oid{2, ids[0] - 80}
+	}
+	return append(out, ids[1:]...), nil
+}
+
+// unmarshalMessage decodes the given BER encoded SNMP message.
+func unmarshalMessage(b []byte) (message, error) {
+	var m message
+
+	d := decoder{b: b}
+	data, err := d.expect(tagSequence)
+	if err != nil {
+		return m, errors.Wrap(err, "decode message error")
+	}
+	d = decoder{b: data}
+
+	if m.version, err = d.integer(); err != nil {
+		return m, errors.Wrap(err, "decode version error")
+	}
+
+	community, err := d.expect(tagOctetString)
+	if err != nil {
+		return m, errors.Wrap(err, "decode community error")
+	}
+	m.community = string(community)
+
+	tag, data, err := d.next()
+	if err != nil {
+		return m, errors.Wrap(err, "decode pdu error")
+	}
+	m.pdu.tag = tag
+	d = decoder{b: data}
+
+	if m.pdu.requestID, err = d.integer(); err != nil {
+		return m, errors.Wrap(err, "decode request-id error")
+	}
+	if m.pdu.errorStatus, err = d.integer(); err != nil {
+		return m, errors.Wrap(err, "decode error-status error")
+	}
+	if m.pdu.errorIndex, err = d.integer(); err != nil {
+		return m, errors.Wrap(err, "decode error-index error")
+	}
+
+	data, err = d.expect(tagSequence)
+	if err != nil {
+		return m, errors.Wrap(err, "decode variable-bindings error")
+	}
+	d = decoder{b: data}
+
+	for len(d.b) != 0 {
+		data, err := d.expect(tagSequence)
+		if err != nil {
+			return m, errors.Wrap(err, "decode variable-binding error")
+		}
+		vbd := decoder{b: data}
+
+		oidData, err := vbd.expect(tagOID)
+		if err != nil {
+			return m, errors.Wrap(err, "decode variable-binding oid error")
+		}
+
+		o, err := decodeOID(oidData)
+		if err != nil {
+			return m, errors.Wrap(err, "decode variable-binding oid error")
+		}
+
+		tag, data, err := vbd.next()
+		if err != nil {
+			return m, errors.Wrap(err, "decode variable-binding value error")
+		}
+
+		m.pdu.varBinds = append(m.pdu.varBinds, varBind{oid: o, value: value{tag: tag, data: data}})
+	}
+
+	return m, nil
+}
@@ -0,0 +1,86 @@
+package snmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOID(t *testing.T) {
+	assert := require.New(t)
+
+	o, err := parseOID("1.3.6.1.4.1.32473.1")
+	assert.NoError(err)
+	assert.Equal(oid{1, 3, 6, 1, 4, 1, 32473, 1}, o)
+	assert.Equal("1.3.6.1.4.1.32473.1", o.String())
+
+	_, err = parseOID("1")
+	assert.Error(err)
+	_, err = parseOID("1.3.a")
+	assert.Error(err)
+
+	b := encodeOID(o)
+	assert.Equal([]byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0x81, 0xfd, 0x59, 0x01}, b)
+
+	decoded, err := decodeOID(b)
+	assert.NoError(err)
+	assert.Equal(o, decoded)
+
+	assert.Equal(-1, oid{1, 3}.compare(oid{1, 3, 1}))
+	assert.Equal(-1, oid{1, 3, 1}.compare(oid{1, 4}))
+	assert.Equal(1, oid{1, 4}.compare(oid{1, 3, 1}))
+	assert.Equal(0, oid{1, 3}.compare(oid{1, 3}))
+}
+
+func TestEncodeInteger(t *testing.T) {
+	tests := []struct {
+		In       int64
+		Expected []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x00, 0x80}},
+		{256, []byte{0x01, 0x00}},
+		{-1, []byte{0xff}},
+		{-129, []byte{0xff, 0x7f}},
+	}
+
+	for _, tst := range tests {
+		assert := require.New(t)
+		assert.Equal(tst.Expected, encodeInt(tst.In))
+
+		d := decoder{b: encodeTLV(tagInteger, encodeInt(tst.In))}
+		i, err := d.integer()
+		assert.NoError(err)
+		assert.Equal(tst.In, i)
+	}
+
+	assert := require.New(t)
+	assert.Equal([]byte{0x00, 0xff, 0xff, 0xff, 0xff}, encodeUint(0xffffffff))
+	assert.Equal([]byte{0x01, 0x00}, encodeUint(256))
+}
+
+func TestMessage(t *testing.T) {
+	assert := require.New(t)
+
+	long := make([]byte, 300)
+	in := message{
+		version:   snmpVersion2c,
+		community: "public",
+		pdu: pdu{
+			tag:       tagResponse,
+			requestID: 1234,
+			varBinds: []varBind{
+				{oid: oid{1, 3, 6, 1}, value: counter64(1 << 40)},
+				{oid: oid{1, 3, 6, 2}, value: value{tag: tagOctetString, data: long}},
+			},
+		},
+	}
+
+	out, err := unmarshalMessage(in.marshal())
+	assert.NoError(err)
+	assert.Equal(in, out)
+
+	_, err = unmarshalMessage([]byte{0x30, 0x05, 0x02})
+	assert.Error(err)
+}
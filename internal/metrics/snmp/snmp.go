@@ -0,0 +1,362 @@
+// Package snmp implements a read-only SNMPv2c agent, exposing the bridge and
+// per-gateway statistics for monitoring systems which do not support
+// Prometheus.
+package snmp
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/lorawan"
+)
+
+// Event defines the gateway event type.
+type Event int
+
+// Gateway events.
+const (
+	EventUplink Event = iota
+	EventDownlink
+	EventDownlinkAck
+	EventDownlinkError
+	EventStats
+)
+
+// maxRepetitions defines the max. number of repetitions of a GetBulkRequest.
+const maxRepetitions = 50
+
+// snmpVersion2c defines the SNMP version field value of SNMPv2c.
+const snmpVersion2c = 1
+
+// Columns of the gateway table.
+const (
+	columnGatewayID uint32 = iota + 1
+	columnConnected
+	columnUplinkCount
+	columnDownlinkCount
+	columnDownlinkAckCount
+	columnDownlinkErrorCount
+	columnStatsCount
+	columnLastSeen
+)
+
+// TruthValue as defined by SNMPv2-TC.
+const (
+	truthValueTrue  = 1
+	truthValueFalse = 2
+)
+
+type gatewayState struct {
+	connected bool
+	lastSeen  time.Time
+	counters  [EventStats + 1]uint64
+}
+
+var (
+	mux sync.RWMutex
+
+	enabled   bool
+	startedAt = time.Now()
+	gateways  = make(map[lorawan.EUI64]*gatewayState)
+
+	prefix    oid
+	community string
+)
+
+// Setup configures the SNMP package and starts the agent.
+func Setup(conf config.Config) error {
+	if !conf.Metrics.SNMP.Enabled {
+		return nil
+	}
+
+	o, err := parseOID(conf.Metrics.SNMP.OIDPrefix)
+	if err != nil {
+		return errors.Wrap(err, "parse oid prefix error")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", conf.Metrics.SNMP.Bind)
+	if err != nil {
+		return errors.Wrap(err, "resolve udp address error")
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "listen udp error")
+	}
+
+	mux.Lock()
+	enabled = true
+	prefix = o
+	community = conf.Metrics.SNMP.Community
+	mux.Unlock()
+
+	log.WithFields(log.Fields{
+		"bind":       conf.Metrics.SNMP.Bind,
+		"oid_prefix": o,
+	}).Info("metrics/snmp: starting snmp agent")
+
+	go serve(conn)
+
+	return nil
+}
+
+// GatewayEvent increments the counter of the given event. The uplink, stats
+// and downlink acknowledgement events also update the last-seen timestamp of
+// the gateway.
+func GatewayEvent(gatewayID lorawan.EUI64, event Event) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	gw := getGatewayState(gatewayID)
+	gw.counters[event]++
+
+	if event == EventUplink || event == EventStats || event == EventDownlinkAck {
+		gw.lastSeen = time.Now()
+	}
+}
+
+// SetGatewayConnected sets the connection state of the given gateway.
+func SetGatewayConnected(gatewayID lorawan.EUI64, connected bool) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	getGatewayState(gatewayID).connected = connected
+}
+
+func getGatewayState(gatewayID lorawan.EUI64) *gatewayState {
+	gw, ok := gateways[gatewayID]
+	if !ok {
+		gw = &gatewayState{}
+		gateways[gatewayID] = gw
+	}
+	return gw
+}
+
+func serve(conn *net.UDPConn) {
+	buf := make([]byte, 65535)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.WithError(err).Error("metrics/snmp: read udp packet error")
+			continue
+		}
+
+		resp, err := handleRequest(buf[:n], time.Now())
+		if err != nil {
+			log.WithError(err).WithField("addr", addr).Debug("metrics/snmp: handle request error")
+			continue
+		}
+
+		if _, err := conn.WriteToUDP(resp, addr); err != nil {
+			log.WithError(err).WithField("addr", addr).Error("metrics/snmp: write udp packet error")
+		}
+	}
+}
+
+// handleRequest handles the given BER encoded request and returns the BER
+// encoded response.
+func handleRequest(b []byte, now time.Time) ([]byte, error) {
+	req, err := unmarshalMessage(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal message error")
+	}
+
+	if req.version != snmpVersion2c {
+		return nil, errors.Errorf("unsupported snmp version: %d", req.version)
+	}
+
+	mux.RLock()
+	c := community
+	mux.RUnlock()
+
+	if req.community != c {
+		return nil, errors.New("invalid community")
+	}
+
+	mib := snapshot(now)
+	resp := message{
+		version:   req.version,
+		community: req.community,
+		pdu: pdu{
+			tag:       tagResponse,
+			requestID: req.pdu.requestID,
+		},
+	}
+
+	switch req.pdu.tag {
+	case tagGetRequest:
+		for _, vb := range req.pdu.varBinds {
+			resp.pdu.varBinds = append(resp.pdu.varBinds, mib.get(vb.oid))
+		}
+	case tagGetNextRequest:
+		for _, vb := range req.pdu.varBinds {
+			resp.pdu.varBinds = append(resp.pdu.varBinds, mib.getNext(vb.oid))
+		}
+	case tagGetBulkRequest:
+		resp.pdu.varBinds = mib.getBulk(req.pdu.varBinds, int(req.pdu.errorStatus), int(req.pdu.errorIndex))
+	default:
+		return nil, errors.Errorf("unsupported pdu type: 0x%02x", req.pdu.tag)
+	}
+
+	return resp.marshal(), nil
+}
+
+// mib contains the variable bindings sorted by OID.
+type mib []varBind
+
+// snapshot returns the MIB containing the current values. The bridge objects
+// are exposed under <prefix>.1, the gateway table under <prefix>.2.1.
+// The gateway table is indexed by the 8 bytes of the gateway ID.
+func snapshot(now time.Time) mib {
+	status := health.GetStatus(now)
+
+	mux.RLock()
+	defer mux.RUnlock()
+
+	var out mib
+	var totals [EventStats + 1]uint64
+	var connected uint32
+
+	entry := prefix.append(2, 1)
+	for gatewayID, gw := range gateways {
+		index := make([]uint32, len(gatewayID))
+		for i := range gatewayID {
+			index[i] = uint32(gatewayID[i])
+		}
+
+		var lastSeen uint32
+		if !gw.lastSeen.IsZero() {
+			lastSeen = uint32(gw.lastSeen.Unix())
+		}
+
+		out = append(out,
+			varBind{entry.append(columnGatewayID).append(index...), octetString(gatewayID.String())},
+			varBind{entry.append(columnConnected).append(index...), truthValue(gw.connected)},
+			varBind{entry.append(columnUplinkCount).append(index...), counter64(gw.counters[EventUplink])},
+			varBind{entry.append(columnDownlinkCount).append(index...), counter64(gw.counters[EventDownlink])},
+			varBind{entry.append(columnDownlinkAckCount).append(index...), counter64(gw.counters[EventDownlinkAck])},
+			varBind{entry.append(columnDownlinkErrorCount).append(index...), counter64(gw.counters[EventDownlinkError])},
+			varBind{entry.append(columnStatsCount).append(index...), counter64(gw.counters[EventStats])},
+			varBind{entry.append(columnLastSeen).append(index...), gauge32(lastSeen)},
+		)
+
+		for i := range totals {
+			totals[i] += gw.counters[i]
+		}
+		if gw.connected {
+			connected++
+		}
+	}
+
+	bridge := prefix.append(1)
+	out = append(out,
+		varBind{bridge.append(1, 0), counter64(totals[EventUplink])},
+		varBind{bridge.append(2, 0), counter64(totals[EventDownlink])},
+		varBind{bridge.append(3, 0), counter64(totals[EventDownlinkAck])},
+		varBind{bridge.append(4, 0), counter64(totals[EventDownlinkError])},
+		varBind{bridge.append(5, 0), counter64(totals[EventStats])},
+		varBind{bridge.append(6, 0), gauge32(connected)},
+		varBind{bridge.append(7, 0), truthValue(status.Ready)},
+		varBind{bridge.append(8, 0), timeTicks(uint32(now.Sub(startedAt) / (10 * time.Millisecond)))},
+	)
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].oid.compare(out[j].oid) < 0
+	})
+
+	return out
+}
+
+func truthValue(b bool) value {
+	if b {
+		return integer(truthValueTrue)
+	}
+	return integer(truthValueFalse)
+}
+
+// get returns the variable binding for the given OID.
+func (m mib) get(o oid) varBind {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].oid.compare(o) >= 0
+	})
+	if i < len(m) && m[i].oid.compare(o) == 0 {
+		return m[i]
+	}
+
+	return varBind{oid: o, value: value{tag: tagNoSuchObject}}
+}
+
+// getNext returns the variable binding following the given OID.
+func (m mib) getNext(o oid) varBind {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].oid.compare(o) > 0
+	})
+	if i < len(m) {
+		return m[i]
+	}
+
+	return varBind{oid: o, value: value{tag: tagEndOfMIBView}}
+}
+
+// getBulk returns the variable bindings for a GetBulkRequest. The first
+// nonRepeaters variable bindings are handled as GetNextRequest, the others
+// are repeated up to maxRep times.
+func (m mib) getBulk(varBinds []varBind, nonRepeaters, maxRep int) []varBind {
+	if nonRepeaters < 0 {
+		nonRepeaters = 0
+	}
+	if nonRepeaters > len(varBinds) {
+		nonRepeaters = len(varBinds)
+	}
+	if maxRep < 0 {
+		maxRep = 0
+	}
+	if maxRep > maxRepetitions {
+		maxRep = maxRepetitions
+	}
+
+	var out []varBind
+	for _, vb := range varBinds[:nonRepeaters] {
+		out = append(out, m.getNext(vb.oid))
+	}
+
+	repeaters := make([]oid, 0, len(varBinds)-nonRepeaters)
+	for _, vb := range varBinds[nonRepeaters:] {
+		repeaters = append(repeaters, vb.oid)
+	}
+
+	for r := 0; r < maxRep && len(repeaters) != 0; r++ {
+		endOfMIB := true
+		for i, o := range repeaters {
+			vb := m.getNext(o)
+			out = append(out, vb)
+			repeaters[i] = vb.oid
+
+			if vb.value.tag != tagEndOfMIBView {
+				endOfMIB = false
+			}
+		}
+
+		if endOfMIB {
+			break
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,131 @@
+package snmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func TestHandleRequest(t *testing.T) {
+	assert := require.New(t)
+
+	mux.Lock()
+	enabled = true
+	prefix = oid{1, 3, 6, 1, 4, 1, 32473, 1}
+	community = "public"
+	gateways = make(map[lorawan.EUI64]*gatewayState)
+	mux.Unlock()
+
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	SetGatewayConnected(gatewayID, true)
+	GatewayEvent(gatewayID, EventUplink)
+	GatewayEvent(gatewayID, EventUplink)
+	GatewayEvent(gatewayID, EventDownlink)
+	GatewayEvent(gatewayID, EventDownlinkAck)
+	GatewayEvent(gatewayID, EventDownlinkError)
+
+	request := func(tag byte, nonRepeaters, maxRep int64, comm string, oids ...oid) ([]varBind, error) {
+		req := message{
+			version:   snmpVersion2c,
+			community: comm,
+			pdu: pdu{
+				tag:         tag,
+				requestID:   123,
+				errorStatus: nonRepeaters,
+				errorIndex:  maxRep,
+			},
+		}
+		for _, o := range oids {
+			req.pdu.varBinds = append(req.pdu.varBinds, varBind{oid: o, value: value{tag: tagNull}})
+		}
+
+		b, err := handleRequest(req.marshal(), time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := unmarshalMessage(b)
+		assert.NoError(err)
+		assert.Equal(tagResponse, resp.pdu.tag)
+		assert.EqualValues(123, resp.pdu.requestID)
+		return resp.pdu.varBinds, nil
+	}
+
+	gwIndex := []uint32{1, 2, 3, 4, 5, 6, 7, 8}
+	gwEntry := prefix.append(2, 1)
+
+	t.Run("invalid community", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := request(tagGetRequest, 0, 0, "private", prefix.append(1, 1, 0))
+		assert.Error(err)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		assert := require.New(t)
+
+		vbs, err := request(tagGetRequest, 0, 0, "public",
+			prefix.append(1, 1, 0),
+			prefix.append(1, 6, 0),
+			gwEntry.append(columnGatewayID).append(gwIndex...),
+			gwEntry.append(columnConnected).append(gwIndex...),
+			gwEntry.append(columnDownlinkErrorCount).append(gwIndex...),
+			prefix.append(1, 99, 0),
+		)
+		assert.NoError(err)
+		assert.Len(vbs, 6)
+		assert.Equal(counter64(2), vbs[0].value)
+		assert.Equal(gauge32(1), vbs[1].value)
+		assert.Equal(octetString("0102030405060708"), vbs[2].value)
+		assert.Equal(integer(truthValueTrue), vbs[3].value)
+		assert.Equal(counter64(1), vbs[4].value)
+		assert.Equal(tagNoSuchObject, vbs[5].value.tag)
+	})
+
+	t.Run("get next", func(t *testing.T) {
+		assert := require.New(t)
+
+		vbs, err := request(tagGetNextRequest, 0, 0, "public", prefix, prefix.append(2))
+		assert.NoError(err)
+		assert.Len(vbs, 2)
+		assert.Equal(prefix.append(1, 1, 0), vbs[0].oid)
+		assert.Equal(gwEntry.append(columnGatewayID).append(gwIndex...), vbs[1].oid)
+
+		vbs, err = request(tagGetNextRequest, 0, 0, "public", gwEntry.append(columnLastSeen).append(gwIndex...))
+		assert.NoError(err)
+		assert.Equal(tagEndOfMIBView, vbs[0].value.tag)
+	})
+
+	t.Run("get bulk", func(t *testing.T) {
+		assert := require.New(t)
+
+		vbs, err := request(tagGetBulkRequest, 1, 3, "public", prefix, prefix.append(2))
+		assert.NoError(err)
+		assert.Len(vbs, 4)
+		assert.Equal(prefix.append(1, 1, 0), vbs[0].oid)
+		assert.Equal(gwEntry.append(columnGatewayID).append(gwIndex...), vbs[1].oid)
+		assert.Equal(gwEntry.append(columnConnected).append(gwIndex...), vbs[2].oid)
+		assert.Equal(gwEntry.append(columnUplinkCount).append(gwIndex...), vbs[3].oid)
+		assert.Equal(counter64(2), vbs[3].value)
+
+		// stops at the end of the mib view
+		vbs, err = request(tagGetBulkRequest, 0, 10, "public", gwEntry.append(columnStatsCount).append(gwIndex...))
+		assert.NoError(err)
+		assert.Len(vbs, 2)
+		assert.Equal(gwEntry.append(columnLastSeen).append(gwIndex...), vbs[0].oid)
+		assert.Equal(tagEndOfMIBView, vbs[1].value.tag)
+	})
+
+	t.Run("disconnected", func(t *testing.T) {
+		assert := require.New(t)
+
+		SetGatewayConnected(gatewayID, false)
+		vbs, err := request(tagGetRequest, 0, 0, "public", prefix.append(1, 6, 0), gwEntry.append(columnConnected).append(gwIndex...))
+		assert.NoError(err)
+		assert.Equal(gauge32(0), vbs[0].value)
+		assert.Equal(integer(truthValueFalse), vbs[1].value)
+	})
+}
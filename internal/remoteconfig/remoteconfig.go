@@ -0,0 +1,183 @@
+// Package remoteconfig implements the remote configuration. A configuration
+// file received through the integration (e.g. MQTT) is validated, written to
+// disk and applied, as if the configuration file was modified locally and
+// reloaded.
+package remoteconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// ValidateFunc validates the given configuration file content, without
+// applying it.
+type ValidateFunc func(b []byte) error
+
+// ReloadFunc re-reads the configuration file and applies it.
+type ReloadFunc func() error
+
+// State contains the remote configuration state.
+type State struct {
+	// Hash contains the (hex encoded) SHA256 hash of the configuration file.
+	Hash string `json:"hash"`
+
+	// Error contains the error of the last received configuration, if any.
+	Error string `json:"error,omitempty"`
+
+	// UpdatedAt contains the time at which the last received configuration
+	// was applied or rejected.
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	enabled   bool
+	file      string
+	validate  ValidateFunc
+	reload    ReloadFunc
+	lastError string
+	updatedAt *time.Time
+)
+
+// Setup configures the remote configuration. The file is the path of the
+// configuration file which is overwritten by the received configuration.
+func Setup(conf config.Config, configFile string, v ValidateFunc, r ReloadFunc) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	enabled = conf.Integration.MQTT.RemoteConfig.Enabled
+	file = configFile
+	validate = v
+	reload = r
+
+	if enabled && file == "" {
+		return errors.New("remote configuration requires a configuration file")
+	}
+
+	return nil
+}
+
+// Enabled returns true when the remote configuration is enabled.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// GetState returns the current remote configuration state.
+func GetState() (State, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return State{}, errors.Wrap(err, "read configuration file error")
+	}
+
+	return State{
+		Hash:      hash(b),
+		Error:     lastError,
+		UpdatedAt: updatedAt,
+	}, nil
+}
+
+// Apply validates the given configuration file content, writes it to disk
+// and applies it. A configuration equal to the current configuration file is
+// ignored.
+func Apply(b []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !enabled {
+		return errors.New("remote configuration is disabled")
+	}
+
+	err := apply(b)
+
+	now := time.Now()
+	updatedAt = &now
+	lastError = ""
+	if err != nil {
+		lastError = err.Error()
+	}
+
+	return err
+}
+
+func apply(b []byte) error {
+	current, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Wrap(err, "read configuration file error")
+	}
+
+	if hash(current) == hash(b) {
+		log.WithField("hash", hash(b)).Info("remoteconfig: received configuration equals current configuration")
+		return nil
+	}
+
+	if err := validate(b); err != nil {
+		return errors.Wrap(err, "validate configuration error")
+	}
+
+	if err := writeFile(file, b); err != nil {
+		return errors.Wrap(err, "write configuration file error")
+	}
+
+	log.WithFields(log.Fields{
+		"file": file,
+		"hash": hash(b),
+	}).Info("remoteconfig: configuration file updated")
+
+	if err := reload(); err != nil {
+		return errors.Wrap(err, "reload configuration error")
+	}
+
+	return nil
+}
+
+// writeFile writes the file using a temporary file in the same directory,
+// such that the configuration file is never partially written.
+func writeFile(path string, b []byte) error {
+	mode := os.FileMode(0640)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func hash(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,102 @@
+package remoteconfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestRemoteConfig(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "remoteconfig")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "chirpstack-gateway-bridge.toml")
+	assert.NoError(ioutil.WriteFile(file, []byte("[general]\nlog_level=4\n"), 0600))
+
+	var reloads int
+	validate := func(b []byte) error {
+		if string(b) == "invalid" {
+			return errors.New("invalid configuration")
+		}
+		return nil
+	}
+	reload := func() error {
+		reloads++
+		return nil
+	}
+
+	var conf config.Config
+	conf.Integration.MQTT.RemoteConfig.Enabled = true
+	defer Setup(config.Config{}, "", nil, nil)
+
+	t.Run("configuration file is required", func(t *testing.T) {
+		assert := require.New(t)
+		assert.EqualError(Setup(conf, "", validate, reload), "remote configuration requires a configuration file")
+	})
+
+	assert.NoError(Setup(conf, file, validate, reload))
+
+	state, err := GetState()
+	assert.NoError(err)
+	assert.Equal(hash([]byte("[general]\nlog_level=4\n")), state.Hash)
+	assert.Nil(state.UpdatedAt)
+
+	t.Run("equal configuration", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(Apply([]byte("[general]\nlog_level=4\n")))
+		assert.Equal(0, reloads)
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.EqualError(Apply([]byte("invalid")), "validate configuration error: invalid configuration")
+		assert.Equal(0, reloads)
+
+		b, err := ioutil.ReadFile(file)
+		assert.NoError(err)
+		assert.Equal("[general]\nlog_level=4\n", string(b))
+
+		state, err := GetState()
+		assert.NoError(err)
+		assert.Equal("validate configuration error: invalid configuration", state.Error)
+		assert.NotNil(state.UpdatedAt)
+	})
+
+	t.Run("valid configuration", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(Apply([]byte("[general]\nlog_level=5\n")))
+		assert.Equal(1, reloads)
+
+		b, err := ioutil.ReadFile(file)
+		assert.NoError(err)
+		assert.Equal("[general]\nlog_level=5\n", string(b))
+
+		fi, err := os.Stat(file)
+		assert.NoError(err)
+		assert.Equal(os.FileMode(0600), fi.Mode())
+
+		state, err := GetState()
+		assert.NoError(err)
+		assert.Equal(hash(b), state.Hash)
+		assert.Equal("", state.Error)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(Setup(config.Config{}, file, validate, reload))
+		assert.EqualError(Apply([]byte("[general]\nlog_level=3\n")), "remote configuration is disabled")
+	})
+}
@@ -0,0 +1,26 @@
+package standby
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "standby_active",
+		Help: "Set to 1 when this instance is the active instance of the hot-standby mode.",
+	})
+
+	tc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "standby_transition_count",
+		Help: "The number of transitions of this instance (per state: active or standby).",
+	}, []string{"state"})
+)
+
+func standbyActiveGauge() prometheus.Gauge {
+	return ag
+}
+
+func standbyTransitionCounter(state string) prometheus.Counter {
+	return tc.With(prometheus.Labels{"state": state})
+}
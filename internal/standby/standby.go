@@ -0,0 +1,290 @@
+// Package standby implements the hot-standby mode, in which two (or more)
+// ChirpStack Gateway Bridge instances are connected to the same gateways and
+// only the active instance publishes the events and handles the commands.
+//
+// The active instance is elected using a retained MQTT lock message. The
+// active instance publishes its instance ID to the lock topic every heartbeat
+// interval. A standby instance claims the lock when the lock has been
+// released or when no heartbeat has been received for the lease duration.
+// When multiple instances claim the lock at the same time, the broker
+// delivers the claims to all instances in the same order, and the last claim
+// wins. An instance which does not receive its own heartbeats (e.g. because
+// it lost the connection to the broker) falls back to standby once the lease
+// has expired.
+package standby
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/certreload"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+var (
+	mux sync.RWMutex
+	e   *elector
+)
+
+// elector implements the election of the active instance.
+type elector struct {
+	sync.RWMutex
+
+	instanceID        string
+	lockTopic         string
+	leaseDuration     time.Duration
+	heartbeatInterval time.Duration
+
+	// owner contains the instance ID of the last received lock message and
+	// ownerSeenAt the time at which it was received.
+	owner       string
+	ownerSeenAt time.Time
+	active      bool
+
+	conn paho.Client
+
+	// publish publishes the given (retained) lock payload. This is a field,
+	// such that it can be overridden by the tests.
+	publish func(payload []byte) error
+
+	done chan struct{}
+}
+
+// Setup configures the standby package.
+func Setup(conf config.Config) error {
+	haConf := conf.HighAvailability
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !haConf.Enabled {
+		e = nil
+		return nil
+	}
+
+	instanceID := haConf.InstanceID
+	if instanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "get hostname error")
+		}
+		instanceID = hostname
+	}
+
+	el := newElector(instanceID, haConf.LockTopic, haConf.LeaseDuration, haConf.HeartbeatInterval)
+
+	opts := paho.NewClientOptions()
+	opts.AddBroker(haConf.MQTT.Server)
+	opts.SetUsername(haConf.MQTT.Username)
+	opts.SetPassword(haConf.MQTT.Password)
+	opts.SetClientID("chirpstack-gateway-bridge-standby-" + instanceID)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(el.onConnected)
+
+	if haConf.MQTT.CACert != "" || haConf.MQTT.TLSCert != "" || haConf.MQTT.TLSKey != "" {
+		certs, err := certreload.New(haConf.MQTT.CACert, haConf.MQTT.TLSCert, haConf.MQTT.TLSKey)
+		if err != nil {
+			return errors.Wrap(err, "load certificates error")
+		}
+		opts.SetTLSConfig(certs.ClientConfig())
+	}
+
+	el.conn = paho.NewClient(opts)
+	el.publish = func(payload []byte) error {
+		if token := el.conn.Publish(el.lockTopic, 1, true, payload); token.WaitTimeout(el.heartbeatInterval) && token.Error() != nil {
+			return token.Error()
+		}
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"server":      haConf.MQTT.Server,
+		"instance_id": instanceID,
+		"lock_topic":  haConf.LockTopic,
+	}).Info("standby: connecting to mqtt broker")
+
+	// Until the broker is reachable, the instance remains in standby. The
+	// connect is retried in the background.
+	go el.connectLoop()
+	go el.heartbeatLoop()
+
+	e = el
+	standbyActiveGauge().Set(0)
+
+	return nil
+}
+
+// Enabled returns true when the hot-standby mode is enabled.
+func Enabled() bool {
+	mux.RLock()
+	defer mux.RUnlock()
+	return e != nil
+}
+
+// IsActive returns true when this instance is the active instance. It always
+// returns true when the hot-standby mode is disabled.
+func IsActive() bool {
+	mux.RLock()
+	el := e
+	mux.RUnlock()
+
+	if el == nil {
+		return true
+	}
+
+	return el.isActive(time.Now())
+}
+
+// Close releases the lock (when this instance is active), such that a
+// standby instance can take over directly.
+func Close() error {
+	mux.Lock()
+	el := e
+	e = nil
+	mux.Unlock()
+
+	if el == nil {
+		return nil
+	}
+
+	return el.close()
+}
+
+func newElector(instanceID, lockTopic string, leaseDuration, heartbeatInterval time.Duration) *elector {
+	return &elector{
+		instanceID:        instanceID,
+		lockTopic:         lockTopic,
+		leaseDuration:     leaseDuration,
+		heartbeatInterval: heartbeatInterval,
+		done:              make(chan struct{}),
+	}
+}
+
+func (el *elector) connectLoop() {
+	for {
+		token := el.conn.Connect()
+		if token.Wait() && token.Error() == nil {
+			return
+		}
+
+		log.WithError(token.Error()).Error("standby: connect to mqtt broker error")
+
+		select {
+		case <-el.done:
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func (el *elector) onConnected(c paho.Client) {
+	log.WithField("lock_topic", el.lockTopic).Info("standby: connected to mqtt broker, subscribing to lock topic")
+
+	if token := c.Subscribe(el.lockTopic, 1, func(_ paho.Client, msg paho.Message) {
+		el.handleLock(msg.Payload(), time.Now())
+	}); token.Wait() && token.Error() != nil {
+		log.WithError(token.Error()).Error("standby: subscribe to lock topic error")
+	}
+}
+
+func (el *elector) heartbeatLoop() {
+	ticker := time.NewTicker(el.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-el.done:
+			return
+		case <-ticker.C:
+			el.heartbeat(time.Now())
+		}
+	}
+}
+
+// handleLock handles the received lock message. An empty payload means that
+// the lock has been released.
+func (el *elector) handleLock(payload []byte, now time.Time) {
+	el.Lock()
+	el.owner = strings.TrimSpace(string(payload))
+	el.ownerSeenAt = now
+	el.Unlock()
+
+	el.updateState(now)
+}
+
+// heartbeat publishes the instance ID to the lock topic when this instance
+// owns the lock, or when the lock has been released or has expired.
+func (el *elector) heartbeat(now time.Time) {
+	el.RLock()
+	claim := el.owner == el.instanceID || el.owner == "" || now.Sub(el.ownerSeenAt) > el.leaseDuration
+	el.RUnlock()
+
+	if claim {
+		if err := el.publish([]byte(el.instanceID)); err != nil {
+			log.WithError(err).Error("standby: publish lock error")
+		}
+	}
+
+	el.updateState(now)
+}
+
+// isActive returns true when this instance owns the lock and the lease has
+// not expired.
+func (el *elector) isActive(now time.Time) bool {
+	el.RLock()
+	defer el.RUnlock()
+	return el.owner == el.instanceID && now.Sub(el.ownerSeenAt) <= el.leaseDuration
+}
+
+// updateState logs the transitions between active and standby.
+func (el *elector) updateState(now time.Time) {
+	active := el.isActive(now)
+
+	el.Lock()
+	changed := active != el.active
+	el.active = active
+	owner := el.owner
+	el.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if active {
+		standbyActiveGauge().Set(1)
+		standbyTransitionCounter("active").Inc()
+		log.WithField("instance_id", el.instanceID).Info("standby: instance became active")
+	} else {
+		standbyActiveGauge().Set(0)
+		standbyTransitionCounter("standby").Inc()
+		log.WithFields(log.Fields{
+			"instance_id": el.instanceID,
+			"owner":       owner,
+		}).Warning("standby: instance became standby")
+	}
+}
+
+func (el *elector) close() error {
+	close(el.done)
+
+	active := el.isActive(time.Now())
+	if active {
+		log.WithField("instance_id", el.instanceID).Info("standby: releasing lock")
+		if err := el.publish(nil); err != nil {
+			return errors.Wrap(err, "release lock error")
+		}
+	}
+
+	if el.conn != nil {
+		el.conn.Disconnect(250)
+	}
+
+	return nil
+}
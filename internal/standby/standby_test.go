@@ -0,0 +1,91 @@
+package standby
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestElector(t *testing.T) {
+	// The broker is simulated by delivering the published lock messages, in
+	// order, to both instances.
+	var instances []*elector
+	var published [][]byte
+	deliver := func(now time.Time) {
+		for _, payload := range published {
+			for _, el := range instances {
+				el.handleLock(payload, now)
+			}
+		}
+		published = nil
+	}
+
+	now := time.Now()
+	for _, id := range []string{"bridge-a", "bridge-b"} {
+		el := newElector(id, "lock", 30*time.Second, 10*time.Second)
+		el.publish = func(payload []byte) error {
+			published = append(published, payload)
+			return nil
+		}
+		instances = append(instances, el)
+	}
+	a, b := instances[0], instances[1]
+
+	t.Run("Both standby", func(t *testing.T) {
+		assert := require.New(t)
+		assert.False(a.isActive(now))
+		assert.False(b.isActive(now))
+	})
+
+	t.Run("Concurrent claims, last claim wins", func(t *testing.T) {
+		assert := require.New(t)
+
+		a.heartbeat(now)
+		b.heartbeat(now)
+		deliver(now)
+		assert.False(a.isActive(now))
+		assert.True(b.isActive(now))
+
+		// the standby instance does not claim the lock while the lease is
+		// valid
+		now = now.Add(10 * time.Second)
+		a.heartbeat(now)
+		assert.Len(published, 0)
+		b.heartbeat(now)
+		deliver(now)
+		assert.False(a.isActive(now))
+		assert.True(b.isActive(now))
+	})
+
+	t.Run("Failover on lease expiration", func(t *testing.T) {
+		assert := require.New(t)
+
+		// b stops sending heartbeats (e.g. it crashed)
+		now = now.Add(31 * time.Second)
+		assert.False(b.isActive(now))
+
+		a.heartbeat(now)
+		deliver(now)
+		assert.True(a.isActive(now))
+		assert.False(b.isActive(now))
+	})
+
+	t.Run("Failover on release", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(a.close())
+		deliver(now)
+		assert.False(a.isActive(now))
+
+		b.heartbeat(now)
+		deliver(now)
+		assert.True(b.isActive(now))
+	})
+}
+
+func TestIsActiveDisabled(t *testing.T) {
+	assert := require.New(t)
+	assert.False(Enabled())
+	assert.True(IsActive())
+}
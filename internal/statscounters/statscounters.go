@@ -0,0 +1,244 @@
+// Package statscounters implements the cumulative gateway stats counters.
+// The rx / tx packet counters of the gateway stats are summed per gateway and
+// persisted in a state file, such that these continue from the stored values
+// after a restart of the ChirpStack Gateway Bridge.
+package statscounters
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// Command is the name of the built-in gateway command which resets the
+// cumulative stats counters of the gateway.
+const Command = "reset_stats_counters"
+
+// Meta-data keys of the cumulative stats counters.
+const (
+	metaRxPacketsReceivedTotal   = "rx_packets_received_total"
+	metaRxPacketsReceivedOKTotal = "rx_packets_received_ok_total"
+	metaTxPacketsReceivedTotal   = "tx_packets_received_total"
+	metaTxPacketsEmittedTotal    = "tx_packets_emitted_total"
+	metaStatsCountersSince       = "stats_counters_since"
+)
+
+// statsTotals contains the cumulative stats counters of a gateway.
+type statsTotals struct {
+	RxPacketsReceived   uint64    `json:"rxPacketsReceived"`
+	RxPacketsReceivedOK uint64    `json:"rxPacketsReceivedOK"`
+	TxPacketsReceived   uint64    `json:"txPacketsReceived"`
+	TxPacketsEmitted    uint64    `json:"txPacketsEmitted"`
+	Since               time.Time `json:"since"`
+}
+
+var (
+	mux sync.Mutex
+
+	counters *statsCounters
+)
+
+// Setup configures the stats counters and loads the stored counters.
+func Setup(conf config.Config) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !conf.Forwarder.StatsCounters.Enabled {
+		return nil
+	}
+
+	sc, err := newStatsCounters(conf.Forwarder.StatsCounters.File)
+	if err != nil {
+		return errors.Wrap(err, "load stats counters error")
+	}
+	counters = sc
+
+	go sc.saveLoop(conf.Forwarder.StatsCounters.SaveInterval)
+
+	return nil
+}
+
+// Enabled returns true when the stats counters are enabled.
+func Enabled() bool {
+	mux.Lock()
+	defer mux.Unlock()
+
+	return counters != nil
+}
+
+// Add adds the counters of the given stats to the cumulative counters of the
+// gateway and adds the cumulative counters to the stats meta-data. It is a
+// no-op when the stats counters are not enabled.
+func Add(stats *gw.GatewayStats) {
+	mux.Lock()
+	sc := counters
+	mux.Unlock()
+
+	if sc != nil {
+		sc.add(stats)
+	}
+}
+
+// Reset resets the cumulative stats counters of the given gateway.
+func Reset(gatewayID lorawan.EUI64) error {
+	mux.Lock()
+	sc := counters
+	mux.Unlock()
+
+	if sc == nil {
+		return errors.New("stats counters are not enabled")
+	}
+
+	return sc.reset(gatewayID)
+}
+
+// statsCounters keeps the cumulative stats counters per gateway.
+type statsCounters struct {
+	sync.Mutex
+
+	file   string
+	dirty  bool
+	totals map[lorawan.EUI64]*statsTotals
+}
+
+// newStatsCounters creates the stats counters and loads the stored counters
+// from the given file (if it exists).
+func newStatsCounters(file string) (*statsCounters, error) {
+	sc := statsCounters{
+		file:   file,
+		totals: make(map[lorawan.EUI64]*statsTotals),
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &sc, nil
+		}
+		return nil, errors.Wrap(err, "read stats counters file error")
+	}
+
+	if err := json.Unmarshal(b, &sc.totals); err != nil {
+		return nil, errors.Wrap(err, "unmarshal stats counters file error")
+	}
+
+	log.WithFields(log.Fields{
+		"file":     file,
+		"gateways": len(sc.totals),
+	}).Info("statscounters: stats counters loaded")
+
+	return &sc, nil
+}
+
+// add adds the counters of the given stats to the cumulative counters of the
+// gateway and adds the cumulative counters to the stats meta-data.
+func (sc *statsCounters) add(stats *gw.GatewayStats) {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], stats.GatewayId)
+
+	sc.Lock()
+	defer sc.Unlock()
+
+	t, ok := sc.totals[gatewayID]
+	if !ok {
+		t = &statsTotals{Since: time.Now().UTC().Truncate(time.Second)}
+		sc.totals[gatewayID] = t
+	}
+
+	t.RxPacketsReceived += uint64(stats.RxPacketsReceived)
+	t.RxPacketsReceivedOK += uint64(stats.RxPacketsReceivedOk)
+	t.TxPacketsReceived += uint64(stats.TxPacketsReceived)
+	t.TxPacketsEmitted += uint64(stats.TxPacketsEmitted)
+	sc.dirty = true
+
+	if stats.MetaData == nil {
+		stats.MetaData = make(map[string]string)
+	}
+	stats.MetaData[metaRxPacketsReceivedTotal] = strconv.FormatUint(t.RxPacketsReceived, 10)
+	stats.MetaData[metaRxPacketsReceivedOKTotal] = strconv.FormatUint(t.RxPacketsReceivedOK, 10)
+	stats.MetaData[metaTxPacketsReceivedTotal] = strconv.FormatUint(t.TxPacketsReceived, 10)
+	stats.MetaData[metaTxPacketsEmittedTotal] = strconv.FormatUint(t.TxPacketsEmitted, 10)
+	stats.MetaData[metaStatsCountersSince] = t.Since.Format(time.RFC3339)
+}
+
+// reset removes the cumulative counters of the given gateway and saves the
+// state file. The counters start from zero on the next stats of the gateway.
+func (sc *statsCounters) reset(gatewayID lorawan.EUI64) error {
+	sc.Lock()
+	delete(sc.totals, gatewayID)
+	sc.dirty = true
+	sc.Unlock()
+
+	return sc.save()
+}
+
+// save writes the counters to the state file when these have changed since
+// the previous save. The file is first written to a temporary file, which is
+// then renamed, such that a crash while saving does not corrupt the state.
+func (sc *statsCounters) save() error {
+	sc.Lock()
+	if !sc.dirty {
+		sc.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(sc.totals)
+	sc.dirty = false
+	sc.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "marshal stats counters error")
+	}
+
+	if err := sc.write(b); err != nil {
+		// retry on the next save
+		sc.Lock()
+		sc.dirty = true
+		sc.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// write writes the given state to the file.
+func (sc *statsCounters) write(b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(sc.file), filepath.Base(sc.file)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "create temporary file error")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write stats counters error")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close temporary file error")
+	}
+
+	if err := os.Rename(f.Name(), sc.file); err != nil {
+		return errors.Wrap(err, "rename temporary file error")
+	}
+
+	return nil
+}
+
+// saveLoop saves the counters every given interval.
+func (sc *statsCounters) saveLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		if err := sc.save(); err != nil {
+			log.WithError(err).WithField("file", sc.file).Error("statscounters: save stats counters error")
+		}
+	}
+}
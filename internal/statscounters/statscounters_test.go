@@ -0,0 +1,82 @@
+package statscounters
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/lorawan"
+)
+
+func TestStatsCounters(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "statscounters")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "stats-counters.json")
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	sc, err := newStatsCounters(file)
+	assert.NoError(err)
+
+	stats := gw.GatewayStats{
+		GatewayId:           gatewayID[:],
+		RxPacketsReceived:   10,
+		RxPacketsReceivedOk: 8,
+		TxPacketsReceived:   2,
+		TxPacketsEmitted:    1,
+	}
+	sc.add(&stats)
+	sc.add(&stats)
+	assert.Equal("20", stats.MetaData["rx_packets_received_total"])
+	assert.Equal("16", stats.MetaData["rx_packets_received_ok_total"])
+	assert.Equal("4", stats.MetaData["tx_packets_received_total"])
+	assert.Equal("2", stats.MetaData["tx_packets_emitted_total"])
+	assert.NotEmpty(stats.MetaData["stats_counters_since"])
+	assert.NoError(sc.save())
+
+	t.Run("continue after restart", func(t *testing.T) {
+		assert := require.New(t)
+
+		sc, err := newStatsCounters(file)
+		assert.NoError(err)
+
+		stats := gw.GatewayStats{
+			GatewayId:         gatewayID[:],
+			RxPacketsReceived: 5,
+		}
+		sc.add(&stats)
+		assert.Equal("25", stats.MetaData["rx_packets_received_total"])
+		assert.Equal("4", stats.MetaData["tx_packets_received_total"])
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(sc.reset(gatewayID))
+
+		sc, err := newStatsCounters(file)
+		assert.NoError(err)
+
+		stats := gw.GatewayStats{
+			GatewayId:         gatewayID[:],
+			RxPacketsReceived: 5,
+		}
+		sc.add(&stats)
+		assert.Equal("5", stats.MetaData["rx_packets_received_total"])
+		assert.Equal("0", stats.MetaData["tx_packets_received_total"])
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.False(Enabled())
+		assert.Error(Reset(gatewayID))
+	})
+}
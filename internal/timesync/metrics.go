@@ -0,0 +1,28 @@
+package timesync
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/brocaar/lorawan"
+)
+
+var (
+	og = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "timesync_offset_seconds",
+		Help: "The estimated offset between the gateway clock and the host clock in seconds (per gateway).",
+	}, []string{"gateway_id"})
+
+	rtg = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "timesync_round_trip_seconds",
+		Help: "The min. round-trip time between the host and the gateway within the window in seconds (per gateway).",
+	}, []string{"gateway_id"})
+)
+
+func offsetGauge(gatewayID lorawan.EUI64) prometheus.Gauge {
+	return og.With(prometheus.Labels{"gateway_id": gatewayID.String()})
+}
+
+func roundTripGauge(gatewayID lorawan.EUI64) prometheus.Gauge {
+	return rtg.With(prometheus.Labels{"gateway_id": gatewayID.String()})
+}
@@ -0,0 +1,212 @@
+// Package timesync implements the time synchronization for gateways without
+// a reliable time source (e.g. NTP or GPS). It provides the GPS time to the
+// backends answering time synchronization requests and estimates, per
+// gateway, the offset between the gateway clock and the clock of the
+// ChirpStack Gateway Bridge host.
+package timesync
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/gps"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// MetaDataKey defines the meta-data key containing the estimated offset (in
+// microseconds) between the gateway clock and the host clock.
+const MetaDataKey = "timesync_offset_us"
+
+var (
+	mu       sync.RWMutex
+	enabled  bool
+	window   time.Duration
+	gateways = make(map[lorawan.EUI64]*gateway)
+)
+
+// sample contains a single offset sample.
+type sample struct {
+	time       time.Time
+	offset     time.Duration
+	resolution time.Duration
+}
+
+// roundTrip contains a single round-trip measurement.
+type roundTrip struct {
+	time time.Time
+	rtt  time.Duration
+}
+
+// gateway contains the samples and round-trip measurements of a single
+// gateway within the window.
+type gateway struct {
+	samples    []sample
+	roundTrips []roundTrip
+}
+
+// Setup configures the timesync package.
+func Setup(conf config.Config) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	enabled = conf.TimeSync.Enabled
+	window = conf.TimeSync.Window
+	gateways = make(map[lorawan.EUI64]*gateway)
+
+	return nil
+}
+
+// Enabled returns true when the time synchronization is enabled.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return enabled
+}
+
+// TimeSinceGPSEpoch returns the given (host) time as time since GPS epoch.
+func TimeSinceGPSEpoch(t time.Time) time.Duration {
+	return gps.Time(t).TimeSinceGPSEpoch()
+}
+
+// AddSample adds an offset sample for the given gateway. The gateway time is
+// the time reported by the gateway, the host time is the time at which the
+// packet containing the gateway time was received. The resolution is the
+// resolution of the gateway time (e.g. a second when the gateway reports
+// the time without fractional seconds). Only the samples with the finest
+// resolution within the window are used for the estimate.
+func AddSample(gatewayID lorawan.EUI64, gatewayTime, hostTime time.Time, resolution time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	gw := getGateway(gatewayID)
+	gw.samples = append(gw.samples, sample{
+		time:       hostTime,
+		offset:     gatewayTime.Sub(hostTime),
+		resolution: resolution,
+	})
+	gw.prune(hostTime)
+
+	if offset, ok := gw.offset(); ok {
+		offsetGauge(gatewayID).Set(offset.Seconds())
+	}
+}
+
+// AddRoundTrip adds a round-trip measurement for the given gateway. Half of
+// the (min.) round-trip time is used as estimate for the latency between
+// the gateway and the host.
+func AddRoundTrip(gatewayID lorawan.EUI64, rtt time.Duration, hostTime time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	gw := getGateway(gatewayID)
+	gw.roundTrips = append(gw.roundTrips, roundTrip{
+		time: hostTime,
+		rtt:  rtt,
+	})
+	gw.prune(hostTime)
+
+	roundTripGauge(gatewayID).Set(gw.minRTT().Seconds())
+}
+
+// GetOffset returns the estimated offset between the gateway clock and the
+// host clock. A positive offset means that the gateway clock is ahead of the
+// host clock. It returns false when there is no estimate for the gateway.
+func GetOffset(gatewayID lorawan.EUI64) (time.Duration, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	gw, ok := gateways[gatewayID]
+	if !ok {
+		return 0, false
+	}
+
+	return gw.offset()
+}
+
+// GetMetaData returns the meta-data containing the estimated offset of the
+// given gateway. It returns nil when there is no estimate.
+func GetMetaData(gatewayID lorawan.EUI64) map[string]string {
+	offset, ok := GetOffset(gatewayID)
+	if !ok {
+		return nil
+	}
+
+	return map[string]string{
+		MetaDataKey: strconv.FormatInt(int64(offset/time.Microsecond), 10),
+	}
+}
+
+func getGateway(gatewayID lorawan.EUI64) *gateway {
+	gw, ok := gateways[gatewayID]
+	if !ok {
+		gw = &gateway{}
+		gateways[gatewayID] = gw
+	}
+	return gw
+}
+
+// prune removes the samples and round-trip measurements outside the window.
+func (g *gateway) prune(now time.Time) {
+	for len(g.samples) != 0 && now.Sub(g.samples[0].time) > window {
+		g.samples = g.samples[1:]
+	}
+
+	for len(g.roundTrips) != 0 && now.Sub(g.roundTrips[0].time) > window {
+		g.roundTrips = g.roundTrips[1:]
+	}
+}
+
+// minRTT returns the min. round-trip time within the window.
+func (g *gateway) minRTT() time.Duration {
+	var min time.Duration
+	for i, rt := range g.roundTrips {
+		if i == 0 || rt.rtt < min {
+			min = rt.rtt
+		}
+	}
+	return min
+}
+
+// offset returns the estimated offset. As each sample is delayed by the
+// latency between the gateway and the host, the sample with the least delay
+// (the max. offset) is the best estimate. This is corrected by half of the
+// min. round-trip time and by half of the resolution of the gateway time
+// (as the reported time is truncated).
+func (g *gateway) offset() (time.Duration, bool) {
+	if len(g.samples) == 0 {
+		return 0, false
+	}
+
+	resolution := g.samples[0].resolution
+	for _, s := range g.samples {
+		if s.resolution < resolution {
+			resolution = s.resolution
+		}
+	}
+
+	var max time.Duration
+	first := true
+	for _, s := range g.samples {
+		if s.resolution != resolution {
+			continue
+		}
+
+		if first || s.offset > max {
+			max = s.offset
+			first = false
+		}
+	}
+
+	return max + g.minRTT()/2 + resolution/2, true
+}
@@ -0,0 +1,89 @@
+package timesync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+func TestTimeSync(t *testing.T) {
+	gatewayID := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	now := time.Now()
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+		assert.NoError(Setup(config.Config{}))
+
+		AddSample(gatewayID, now.Add(time.Second), now, time.Microsecond)
+		_, ok := GetOffset(gatewayID)
+		assert.False(ok)
+		assert.Nil(GetMetaData(gatewayID))
+	})
+
+	var conf config.Config
+	conf.TimeSync.Enabled = true
+	conf.TimeSync.Window = time.Minute
+
+	t.Run("max offset", func(t *testing.T) {
+		assert := require.New(t)
+		assert.NoError(Setup(conf))
+
+		// the gateway clock is 2 seconds ahead, the samples are delayed by
+		// 30 and 10 ms
+		AddSample(gatewayID, now.Add(2*time.Second-30*time.Millisecond), now, time.Microsecond)
+		AddSample(gatewayID, now.Add(2*time.Second-10*time.Millisecond), now, time.Microsecond)
+
+		offset, ok := GetOffset(gatewayID)
+		assert.True(ok)
+		assert.Equal(2*time.Second-10*time.Millisecond+time.Microsecond/2, offset)
+	})
+
+	t.Run("round-trip correction", func(t *testing.T) {
+		assert := require.New(t)
+		assert.NoError(Setup(conf))
+
+		AddSample(gatewayID, now.Add(2*time.Second-10*time.Millisecond), now, time.Microsecond)
+		AddRoundTrip(gatewayID, 40*time.Millisecond, now)
+		AddRoundTrip(gatewayID, 20*time.Millisecond, now)
+
+		offset, ok := GetOffset(gatewayID)
+		assert.True(ok)
+		assert.Equal(2*time.Second+time.Microsecond/2, offset)
+		assert.Equal(map[string]string{
+			MetaDataKey: "2000000",
+		}, GetMetaData(gatewayID))
+	})
+
+	t.Run("finest resolution", func(t *testing.T) {
+		assert := require.New(t)
+		assert.NoError(Setup(conf))
+
+		// the second resolution sample is ignored
+		AddSample(gatewayID, now.Add(10*time.Second), now, time.Second)
+		AddSample(gatewayID, now.Add(-time.Second), now, time.Microsecond)
+
+		offset, ok := GetOffset(gatewayID)
+		assert.True(ok)
+		assert.Equal(-time.Second+time.Microsecond/2, offset)
+	})
+
+	t.Run("window", func(t *testing.T) {
+		assert := require.New(t)
+		assert.NoError(Setup(conf))
+
+		// the first sample is outside the window once the second is added
+		AddSample(gatewayID, now.Add(time.Second), now, time.Microsecond)
+		AddSample(gatewayID, now.Add(2*time.Minute), now.Add(2*time.Minute), time.Microsecond)
+
+		offset, ok := GetOffset(gatewayID)
+		assert.True(ok)
+		assert.Equal(time.Microsecond/2, offset)
+	})
+
+	assert := require.New(t)
+	assert.NoError(Setup(config.Config{}))
+}
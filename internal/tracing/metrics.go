@@ -0,0 +1,17 @@
+package tracing
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tracing_span_count",
+		Help: "The number of spans handled by the OTLP exporter (per result).",
+	}, []string{"result"})
+)
+
+func spanCounter(result string) prometheus.Counter {
+	return sc.With(prometheus.Labels{"result": result})
+}
@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// maxBatchSize defines the max. number of spans exported in a single request.
+const maxBatchSize = 512
+
+// The OTLP span kind and status codes.
+const (
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// The OTLP (JSON encoding) request structures.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// exporter exports the ended spans in batches to the OTLP endpoint. Spans
+// are dropped when the queue is full, such that a slow or unavailable
+// collector never blocks the uplink and downlink paths.
+type exporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	interval    time.Duration
+	client      *http.Client
+	spans       chan *Span
+}
+
+func newExporter(conf config.Config) *exporter {
+	return &exporter{
+		endpoint:    conf.Tracing.Endpoint,
+		headers:     conf.Tracing.Headers,
+		serviceName: conf.Tracing.ServiceName,
+		interval:    conf.Tracing.ExportInterval,
+		client: &http.Client{
+			Timeout: conf.Tracing.ExportInterval,
+		},
+		spans: make(chan *Span, conf.Tracing.QueueSize),
+	}
+}
+
+// add adds the given (ended) span to the export queue.
+func (e *exporter) add(s *Span) {
+	select {
+	case e.spans <- s:
+	default:
+		spanCounter("dropped").Inc()
+	}
+}
+
+func (e *exporter) exportLoop() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) < maxBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := e.export(batch); err != nil {
+			spanCounter("error").Add(float64(len(batch)))
+			log.WithError(err).WithField("endpoint", e.endpoint).Error("tracing: export spans error")
+		} else {
+			spanCounter("exported").Add(float64(len(batch)))
+		}
+		batch = nil
+	}
+}
+
+// export posts the given spans to the OTLP endpoint.
+func (e *exporter) export(spans []*Span) error {
+	b, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return errors.Wrap(err, "marshal request error")
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "http request error")
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("expected 2xx response, got: %d (%s)", resp.StatusCode, resp.Status)
+	}
+
+	return nil
+}
+
+// request returns the OTLP request for the given spans.
+func (e *exporter) request(spans []*Span) otlpRequest {
+	scopeSpans := otlpScopeSpans{
+		Scope: otlpScope{Name: "chirpstack-gateway-bridge"},
+	}
+
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, otlpKeyValue{
+				Key:   a.Key,
+				Value: otlpAnyValue{StringValue: a.Value},
+			})
+		}
+
+		if s.err != "" {
+			span.Status = otlpStatus{
+				Code:    statusCodeError,
+				Message: s.err,
+			}
+		}
+
+		scopeSpans.Spans = append(scopeSpans.Spans, span)
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						{Key: "service.name", Value: otlpAnyValue{StringValue: e.serviceName}},
+					},
+				},
+				ScopeSpans: []otlpScopeSpans{scopeSpans},
+			},
+		},
+	}
+}
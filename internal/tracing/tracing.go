@@ -0,0 +1,206 @@
+// Package tracing implements the tracing of the uplink and downlink paths.
+// The spans are exported to an OpenTelemetry collector using OTLP (HTTP /
+// JSON encoding).
+//
+// A trace is identified by the uplink or downlink ID (UUID), which is also
+// used as trace ID. This makes it possible to add spans to the trace from
+// the different packages handling the uplink or downlink (e.g. the forwarder
+// and the integrations), without passing the span around.
+package tracing
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// traceTTL defines the max. duration of a trace. Traces which are not ended
+// within this duration (e.g. because no TX acknowledgement was received for
+// the downlink) are ended with an error by the timer of the trace.
+var traceTTL = time.Minute
+
+var (
+	mux sync.Mutex
+
+	exp    *exporter
+	traces = make(map[uuid.UUID]*Span)
+)
+
+// Attribute holds a span attribute.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Attr returns an attribute for the given key and value.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: fmt.Sprint(value)}
+}
+
+// Span holds a single span. All the methods of Span can be called on a nil
+// Span, which is returned when tracing is disabled or when the trace is
+// unknown.
+type Span struct {
+	traceID  uuid.UUID
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []Attribute
+	err      string
+
+	// timer expires the trace (root span only).
+	timer *time.Timer
+}
+
+// Setup configures the tracing package.
+func Setup(conf config.Config) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !conf.Tracing.Enabled {
+		return nil
+	}
+
+	exp = newExporter(conf)
+	go exp.exportLoop()
+
+	log.WithFields(log.Fields{
+		"endpoint":     conf.Tracing.Endpoint,
+		"service_name": conf.Tracing.ServiceName,
+	}).Info("tracing: otlp exporter configured")
+
+	return nil
+}
+
+// StartTrace starts the trace with the given ID (the uplink or downlink ID)
+// and root span name, unless the trace has already been started (e.g. a
+// downlink trace started by the integration receiving the downlink).
+func StartTrace(id uuid.UUID, name string, attrs ...Attribute) {
+	if id == uuid.Nil {
+		return
+	}
+
+	now := time.Now()
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if exp == nil {
+		return
+	}
+
+	if _, ok := traces[id]; ok {
+		return
+	}
+
+	s := &Span{
+		traceID: id,
+		spanID:  newSpanID(),
+		name:    name,
+		start:   now,
+		attrs:   attrs,
+	}
+	s.timer = time.AfterFunc(traceTTL, func() { expireTrace(s) })
+	traces[id] = s
+}
+
+// expireTrace ends the given trace with an error, unless it has already been
+// ended.
+func expireTrace(s *Span) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if traces[s.traceID] != s {
+		return
+	}
+	delete(traces, s.traceID)
+
+	s.err = "trace expired"
+	s.end = time.Now()
+	exp.add(s)
+}
+
+// EndTrace ends the trace with the given ID. When an error is given, the
+// status of the root span is set to error.
+func EndTrace(id uuid.UUID, err error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	s, ok := traces[id]
+	if !ok {
+		return
+	}
+	delete(traces, id)
+	s.timer.Stop()
+
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.end = time.Now()
+	exp.add(s)
+}
+
+// StartSpan starts a span as child of the root span of the given trace. It
+// returns nil when the trace is unknown.
+func StartSpan(id uuid.UUID, name string, attrs ...Attribute) *Span {
+	mux.Lock()
+	defer mux.Unlock()
+
+	root, ok := traces[id]
+	if !ok {
+		return nil
+	}
+
+	return &Span{
+		traceID:  id,
+		spanID:   newSpanID(),
+		parentID: root.spanID,
+		name:     name,
+		start:    time.Now(),
+		attrs:    attrs,
+	}
+}
+
+// SetAttribute sets the given attribute.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, Attr(key, value))
+}
+
+// End ends the span. When an error is given, the status of the span is set
+// to error.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.end = time.Now()
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	if exp != nil {
+		exp.add(s)
+	}
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		log.WithError(err).Error("tracing: read random bytes error")
+	}
+	return id
+}
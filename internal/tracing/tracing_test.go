@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+func TestTracing(t *testing.T) {
+	assert := require.New(t)
+
+	requests := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if r.Header.Get("Authorization") == "Bearer secret" && json.NewDecoder(r.Body).Decode(&req) == nil {
+			requests <- req
+		}
+	}))
+	defer server.Close()
+
+	var conf config.Config
+	conf.Tracing.Enabled = true
+	conf.Tracing.Endpoint = server.URL
+	conf.Tracing.Headers = map[string]string{"Authorization": "Bearer secret"}
+	conf.Tracing.ServiceName = "test-bridge"
+	conf.Tracing.ExportInterval = 10 * time.Millisecond
+	conf.Tracing.QueueSize = 10
+	assert.NoError(Setup(conf))
+
+	uplinkID, err := uuid.NewV4()
+	assert.NoError(err)
+
+	// spans of unknown traces are ignored
+	assert.Nil(StartSpan(uplinkID, "filters"))
+
+	StartTrace(uplinkID, "uplink", Attr("uplink_id", uplinkID))
+	span := StartSpan(uplinkID, "publish", Attr("integration", "mqtt"))
+	assert.NotNil(span)
+	span.End(errors.New("publish error"))
+	EndTrace(uplinkID, nil)
+
+	var req otlpRequest
+	select {
+	case req = <-requests:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for export request")
+	}
+
+	assert.Len(req.ResourceSpans, 1)
+	assert.Equal([]otlpKeyValue{
+		{Key: "service.name", Value: otlpAnyValue{StringValue: "test-bridge"}},
+	}, req.ResourceSpans[0].Resource.Attributes)
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(spans, 2)
+
+	child, root := spans[0], spans[1]
+	assert.Equal("publish", child.Name)
+	assert.Equal("uplink", root.Name)
+	assert.Equal(hex.EncodeToString(uplinkID[:]), root.TraceID)
+	assert.Equal(root.TraceID, child.TraceID)
+	assert.Equal(root.SpanID, child.ParentSpanID)
+	assert.Equal("", root.ParentSpanID)
+	assert.Equal(otlpStatus{Code: statusCodeError, Message: "publish error"}, child.Status)
+	assert.Equal(otlpStatus{}, root.Status)
+	assert.Equal([]otlpKeyValue{
+		{Key: "uplink_id", Value: otlpAnyValue{StringValue: uplinkID.String()}},
+	}, root.Attributes)
+
+	t.Run("expired trace", func(t *testing.T) {
+		assert := require.New(t)
+
+		traceTTL = 10 * time.Millisecond
+		defer func() { traceTTL = time.Minute }()
+
+		// e.g. a downlink for which no ack is received
+		downlinkID, err := uuid.NewV4()
+		assert.NoError(err)
+		StartTrace(downlinkID, "downlink")
+
+		var req otlpRequest
+		select {
+		case req = <-requests:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for export request")
+		}
+
+		spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+		assert.Len(spans, 1)
+		assert.Equal("downlink", spans[0].Name)
+		assert.Equal(otlpStatus{Code: statusCodeError, Message: "trace expired"}, spans[0].Status)
+
+		mux.Lock()
+		assert.Len(traces, 0)
+		mux.Unlock()
+	})
+}
@@ -0,0 +1,94 @@
+package webui
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+)
+
+// redacted is the value shown instead of a secret.
+const redacted = "********"
+
+// redactedConfig returns the configuration as a map, keyed by the
+// configuration-file names, with passwords, secrets and keys redacted.
+// Certificate and key file paths are not redacted.
+func redactedConfig(c config.Config) interface{} {
+	return toMap("", reflect.ValueOf(c))
+}
+
+func toMap(key string, v reflect.Value) interface{} {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name := strings.Split(f.Tag.Get("mapstructure"), ",")[0]
+			if name == "-" || f.PkgPath != "" {
+				continue
+			}
+			// same as mapstructure, fall back to the lowercase field name
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			out[name] = toMap(name, v.Field(i))
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{})
+		for _, k := range v.MapKeys() {
+			name := fmt.Sprintf("%v", k.Interface())
+			out[name] = toMap(name, v.MapIndex(k))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return redactValue(key, fmt.Sprintf("%x", v.Interface()))
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = toMap(key, v.Index(i))
+		}
+		return out
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return toMap(key, v.Elem())
+	case reflect.String:
+		return redactValue(key, v.String())
+	default:
+		return v.Interface()
+	}
+}
+
+// redactValue redacts the value when the key refers to a secret, or masks
+// the password when the value is an URL containing user credentials.
+func redactValue(key, value string) string {
+	if value == "" {
+		return value
+	}
+
+	k := strings.ToLower(key)
+	for _, s := range []string{"password", "secret", "token", "aes_key", "signing_key", "symmetric_key", "community"} {
+		if strings.Contains(k, s) {
+			return redacted
+		}
+	}
+
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return u.String()
+		}
+	}
+
+	return value
+}
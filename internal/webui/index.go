@@ -0,0 +1,105 @@
+package webui
+
+// indexHTML contains the web interface page. It polls the status API and
+// renders the frames, connection status and errors.
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ChirpStack Gateway Bridge</title>
+<style>
+body { font-family: sans-serif; margin: 1em; color: #333; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; width: 100%; font-size: 0.85em; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 6px; text-align: left; }
+td.payload { font-family: monospace; word-break: break-all; }
+.ok { color: #2a2; }
+.error { color: #c22; }
+pre { background: #f5f5f5; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>ChirpStack Gateway Bridge</h1>
+
+<h2>Status</h2>
+<table id="status"></table>
+
+<h2>Uplinks</h2>
+<table id="uplinks"></table>
+
+<h2>Downlinks</h2>
+<table id="downlinks"></table>
+
+<h2>Recent errors</h2>
+<table id="errors"></table>
+
+<h2>Configuration</h2>
+<pre id="config"></pre>
+
+<script>
+function esc(s) {
+	return String(s === undefined || s === null ? "" : s).replace(/[&<>"]/g, function(c) {
+		return {"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;"}[c];
+	});
+}
+
+function row(cells, tag) {
+	tag = tag || "td";
+	return "<tr>" + cells.map(function(c) {
+		if (typeof c === "object" && c !== null) {
+			return "<" + tag + " class=\"" + c.cls + "\">" + esc(c.v) + "</" + tag + ">";
+		}
+		return "<" + tag + ">" + esc(c) + "</" + tag + ">";
+	}).join("") + "</tr>";
+}
+
+function state(b) {
+	return b ? {cls: "ok", v: "connected"} : {cls: "error", v: "disconnected"};
+}
+
+function render(s) {
+	var h = s.health;
+	var st = row(["Component", "State"], "th");
+	st += row(["ready", h.ready ? {cls: "ok", v: "yes"} : {cls: "error", v: "no"}]);
+	st += row(["backend", h.backend.ready ? {cls: "ok", v: "ready"} : {cls: "error", v: "not ready"}]);
+	Object.keys(h.integrations || {}).sort().forEach(function(k) {
+		st += row(["integration " + k, state(h.integrations[k].connected)]);
+	});
+	document.getElementById("status").innerHTML = st;
+
+	var up = row(["Time", "Gateway ID", "Frequency", "Data-rate", "RSSI", "SNR", "Size", "PHYPayload"], "th");
+	(s.uplinks || []).forEach(function(f) {
+		up += row([f.time, f.gateway_id, f.frequency, f.data_rate, f.rssi, f.snr, f.size, {cls: "payload", v: f.phy_payload}]);
+	});
+	document.getElementById("uplinks").innerHTML = up;
+
+	var down = row(["Time", "Gateway ID", "Frequency", "Data-rate", "Power", "Size", "Status", "PHYPayload"], "th");
+	(s.downlinks || []).forEach(function(f) {
+		var status = f.status ? {cls: f.status === "OK" ? "ok" : "error", v: f.status} : "";
+		down += row([f.time, f.gateway_id, f.frequency, f.data_rate, f.power, f.size, status, {cls: "payload", v: f.phy_payload}]);
+	});
+	document.getElementById("downlinks").innerHTML = down;
+
+	var errs = row(["Time", "Level", "Message", "Fields"], "th");
+	(s.errors || []).forEach(function(e) {
+		var fields = Object.keys(e.fields || {}).sort().map(function(k) { return k + "=" + e.fields[k]; }).join(" ");
+		errs += row([e.time, {cls: "error", v: e.level}, e.message, fields]);
+	});
+	document.getElementById("errors").innerHTML = errs;
+}
+
+function poll() {
+	fetch("api/status").then(function(r) { return r.json(); }).then(render).catch(function() {});
+}
+
+fetch("api/config").then(function(r) { return r.json(); }).then(function(c) {
+	document.getElementById("config").textContent = JSON.stringify(c, null, 2);
+});
+
+poll();
+setInterval(poll, 2000);
+</script>
+</body>
+</html>
+`
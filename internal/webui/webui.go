@@ -0,0 +1,321 @@
+// Package webui implements an optional, read-only web interface for local
+// diagnostics. It shows the live uplink and downlink frames, the connection
+// status of the backend and integrations, the recent errors and the
+// (redacted) configuration, for field technicians without MQTT tooling.
+package webui
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/config"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/health"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/logging"
+	"github.com/brocaar/chirpstack-gateway-bridge/internal/lrfhss"
+	"github.com/brocaar/lorawan"
+	"github.com/gofrs/uuid"
+)
+
+var (
+	mux sync.RWMutex
+
+	enabled   bool
+	maxFrames int
+	conf      config.Config
+
+	uplinks    []Frame
+	downlinks  []Frame
+	logEntries []LogEntry
+)
+
+// Frame contains an uplink or downlink frame.
+type Frame struct {
+	Time       time.Time `json:"time"`
+	GatewayID  string    `json:"gateway_id"`
+	ID         string    `json:"id"`
+	Frequency  uint32    `json:"frequency"`
+	DataRate   string    `json:"data_rate"`
+	RSSI       *int32    `json:"rssi,omitempty"`
+	SNR        *float64  `json:"snr,omitempty"`
+	Power      *int32    `json:"power,omitempty"`
+	Size       int       `json:"size"`
+	PHYPayload string    `json:"phy_payload"`
+
+	// Status contains the TX acknowledgement status of a downlink (OK or
+	// the error), it is empty when not (yet) acknowledged.
+	Status string `json:"status,omitempty"`
+}
+
+// LogEntry contains a warning or error log entry.
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Status contains the data shown by the web interface.
+type Status struct {
+	Health    health.Status `json:"health"`
+	Uplinks   []Frame       `json:"uplinks"`
+	Downlinks []Frame       `json:"downlinks"`
+	Errors    []LogEntry    `json:"errors"`
+}
+
+// Setup configures the web interface and starts the HTTP server.
+func Setup(c config.Config) error {
+	if !c.WebUI.Enabled {
+		return nil
+	}
+
+	mux.Lock()
+	enabled = true
+	maxFrames = c.WebUI.MaxFrames
+	conf = c
+	mux.Unlock()
+
+	logging.AddHook(errorHook{})
+
+	log.WithFields(log.Fields{
+		"bind": c.WebUI.Bind,
+	}).Info("webui: starting web interface")
+
+	server := http.Server{
+		Handler: Handler(c.WebUI.Username, c.WebUI.Password),
+		Addr:    c.WebUI.Bind,
+	}
+
+	go func() {
+		err := server.ListenAndServe()
+		log.WithError(err).Error("webui: web interface server error")
+	}()
+
+	return nil
+}
+
+// Reload updates the configuration shown by the web interface.
+func Reload(c config.Config) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	conf = c
+}
+
+// Handler returns the HTTP handler of the web interface. When the username
+// is set, HTTP basic authentication is required.
+func Handler(username, password string) http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(indexHTML))
+	})
+	m.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, GetStatus(time.Now()))
+	})
+	m.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		mux.RLock()
+		c := conf
+		mux.RUnlock()
+
+		writeJSON(w, redactedConfig(c))
+	})
+
+	if username == "" {
+		return m
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ChirpStack Gateway Bridge"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		m.ServeHTTP(w, r)
+	})
+}
+
+// GetStatus returns the status at the given time.
+func GetStatus(now time.Time) Status {
+	status := Status{
+		Health: health.GetStatus(now),
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+
+	status.Uplinks = append([]Frame{}, uplinks...)
+	status.Downlinks = append([]Frame{}, downlinks...)
+	status.Errors = append([]LogEntry{}, logEntries...)
+
+	return status
+}
+
+// Uplink adds the given uplink frame.
+func Uplink(uplinkFrame gw.UplinkFrame) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	rxInfo := uplinkFrame.GetRxInfo()
+	txInfo := uplinkFrame.GetTxInfo()
+
+	var gatewayID lorawan.EUI64
+	var uplinkID uuid.UUID
+	copy(gatewayID[:], rxInfo.GetGatewayId())
+	copy(uplinkID[:], rxInfo.GetUplinkId())
+
+	rssi := rxInfo.GetRssi()
+	snr := rxInfo.GetLoraSnr()
+
+	f := Frame{
+		Time:       time.Now(),
+		GatewayID:  gatewayID.String(),
+		ID:         uplinkID.String(),
+		Frequency:  txInfo.GetFrequency(),
+		RSSI:       &rssi,
+		Size:       len(uplinkFrame.PhyPayload),
+		PHYPayload: hex.EncodeToString(uplinkFrame.PhyPayload),
+	}
+
+	if mod := txInfo.GetLoraModulationInfo(); mod != nil {
+		f.DataRate = fmt.Sprintf("SF%dBW%d", mod.GetSpreadingFactor(), mod.GetBandwidth())
+		f.SNR = &snr
+	} else if mod := txInfo.GetFskModulationInfo(); mod != nil {
+		f.DataRate = fmt.Sprintf("FSK %d", mod.GetDatarate())
+	} else if mod := lrfhss.GetUplinkModulationInfo(txInfo); mod != nil {
+		f.DataRate = fmt.Sprintf("LR-FHSS OCW%d", mod.GetOperatingChannelWidth()/1000)
+	}
+
+	uplinks = prepend(uplinks, f)
+}
+
+// Downlink adds the given downlink frame.
+func Downlink(downlinkFrame gw.DownlinkFrame) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	txInfo := downlinkFrame.GetTxInfo()
+
+	var gatewayID lorawan.EUI64
+	var downlinkID uuid.UUID
+	copy(gatewayID[:], txInfo.GetGatewayId())
+	copy(downlinkID[:], downlinkFrame.GetDownlinkId())
+
+	power := txInfo.GetPower()
+
+	f := Frame{
+		Time:       time.Now(),
+		GatewayID:  gatewayID.String(),
+		ID:         downlinkID.String(),
+		Frequency:  txInfo.GetFrequency(),
+		Power:      &power,
+		Size:       len(downlinkFrame.PhyPayload),
+		PHYPayload: hex.EncodeToString(downlinkFrame.PhyPayload),
+	}
+
+	if mod := txInfo.GetLoraModulationInfo(); mod != nil {
+		f.DataRate = fmt.Sprintf("SF%dBW%d", mod.GetSpreadingFactor(), mod.GetBandwidth())
+	} else if mod := txInfo.GetFskModulationInfo(); mod != nil {
+		f.DataRate = fmt.Sprintf("FSK %d", mod.GetDatarate())
+	} else if mod := lrfhss.GetDownlinkModulationInfo(txInfo); mod != nil {
+		f.DataRate = fmt.Sprintf("LR-FHSS OCW%d", mod.GetOperatingChannelWidth()/1000)
+	}
+
+	downlinks = prepend(downlinks, f)
+}
+
+// DownlinkTXAck sets the status of the acknowledged downlink.
+func DownlinkTXAck(txAck gw.DownlinkTXAck) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	var downlinkID uuid.UUID
+	copy(downlinkID[:], txAck.GetDownlinkId())
+
+	status := txAck.GetError()
+	if status == "" {
+		status = "OK"
+	}
+
+	for i := range downlinks {
+		if downlinks[i].ID == downlinkID.String() {
+			downlinks[i].Status = status
+			return
+		}
+	}
+}
+
+// prepend adds the frame to the front of the given slice, dropping the
+// oldest frame(s) when exceeding the max. number of frames.
+func prepend(frames []Frame, f Frame) []Frame {
+	frames = append([]Frame{f}, frames...)
+	if len(frames) > maxFrames {
+		frames = frames[:maxFrames]
+	}
+	return frames
+}
+
+// errorHook records the warning and error log entries.
+type errorHook struct{}
+
+func (h errorHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel}
+}
+
+func (h errorHook) Fire(entry *log.Entry) error {
+	e := LogEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  make(map[string]string),
+	}
+	for k, v := range entry.Data {
+		e.Fields[k] = fmt.Sprintf("%v", v)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	logEntries = append([]LogEntry{e}, logEntries...)
+	if len(logEntries) > maxFrames {
+		logEntries = logEntries[:maxFrames]
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.WithError(err).Error("webui: marshal json error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}